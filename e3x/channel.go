@@ -42,6 +42,8 @@ const (
 	cReadBufferSize  = 100
 	cWriteBufferSize = 100
 	earlyAdHocAck    = 50
+	stalledResends   = 3
+	cStreamChunkSize = 1024
 	cBlankSeq        = uint32(0)
 	cInitialSeq      = uint32(1)
 )
@@ -74,6 +76,18 @@ type Channel struct {
 	receivedEnd  bool
 	readEnd      bool
 	needsResend  bool
+	resends      int // consecutive resends without receiving an ack
+
+	openPolicy  OpenPolicy
+	openPkt     *lob.Packet // open packet of an unreliable channel (kept for retransmission when RetryUnreliable is set)
+	openRetries int
+
+	sndPackets uint64 // packets written
+	rcvPackets uint64 // packets accepted in the read buffer
+	rcvDropped uint64 // packets dropped by the read stream
+	sndBytes   uint64 // body bytes written
+	rcvBytes   uint64 // body bytes accepted in the read buffer
+	opened     time.Time
 
 	openDeadlineReached  bool
 	writeDeadlineReached bool
@@ -89,20 +103,24 @@ type Channel struct {
 	tWriteDeadline *time.Timer
 	tResend        *time.Timer
 	tAcker         *time.Timer
+	tOpenRetry     *time.Timer
 }
 
 type ChannelOption func(*Channel) error
 
 type exchangeI interface {
 	deliverPacket(pkt *lob.Packet, dst *Pipe) error
+	deliverPackets(pkts []*lob.Packet, dst *Pipe) (int, error)
+	pathStalled(p *Pipe)
 	RemoteIdentity() *Identity
 	getTID() tracer.ID
 }
 
 type readBufferEntry struct {
-	pkt *lob.Packet
-	seq uint32
-	end bool
+	pkt  *lob.Packet
+	seq  uint32
+	end  bool
+	pipe *Pipe
 }
 
 type writeBufferEntry struct {
@@ -133,14 +151,14 @@ func newChannel(
 		iSeq:         cBlankSeq,
 		oAckedSeq:    cBlankSeq,
 		iAckedSeq:    cBlankSeq,
+		openPolicy:   DefaultOpenPolicy,
+		opened:       time.Now(),
 	}
 
 	c.cndRead = sync.NewCond(&c.mtx)
 	c.cndWrite = sync.NewCond(&c.mtx)
 	c.cndClose = sync.NewCond(&c.mtx)
 
-	c.setOpenDeadline()
-
 	c.tReadDeadline = time.AfterFunc(10*time.Second, c.onReadDeadlineReached)
 	c.tWriteDeadline = time.AfterFunc(10*time.Second, c.onWriteDeadlineReached)
 	c.tReadDeadline.Stop()
@@ -152,6 +170,7 @@ func newChannel(
 	}
 
 	c.setOptions(options...)
+	c.setOpenDeadline()
 	c.traceNew()
 
 	return c
@@ -170,6 +189,7 @@ func registerExchange(x *Exchange) ChannelOption {
 	return func(c *Channel) error {
 		c.channelHooks = x.channelHooks
 		c.channelHooks.channel = c
+		c.openPolicy = x.openPolicy.withDefaults()
 		return nil
 	}
 }
@@ -400,6 +420,8 @@ func (c *Channel) write(pkt *lob.Packet, p *Pipe) error {
 	if err != nil {
 		return c.traceWriteError(pkt, p, err)
 	}
+	c.sndPackets++
+	c.sndBytes += uint64(pkt.BodyLen())
 	statChannelSndPkt.Add(1)
 	if pkt.Header().HasAck {
 		statChannelSndAckInline.Add(1)
@@ -411,6 +433,16 @@ func (c *Channel) write(pkt *lob.Packet, p *Pipe) error {
 
 	c.traceWrite(pkt, p)
 
+	if c.oSeq == cInitialSeq && !c.serverside && (c.reliable || c.openPolicy.RetryUnreliable) {
+		c.scheduleOpenRetry()
+
+		if !c.reliable {
+			// keep the open packet for retransmission
+			c.openPkt = pkt
+			return nil
+		}
+	}
+
 	if !c.reliable {
 		pkt.Free()
 	}
@@ -419,8 +451,15 @@ func (c *Channel) write(pkt *lob.Packet, p *Pipe) error {
 }
 
 func (c *Channel) ReadPacket() (*lob.Packet, error) {
+	pkt, _, err := c.ReadPacketFrom()
+	return pkt, err
+}
+
+// ReadPacketFrom reads the next packet and returns the pipe it was received
+// over. The pipe is nil when it is unknown.
+func (c *Channel) ReadPacketFrom() (*lob.Packet, *Pipe, error) {
 	if c == nil {
-		return nil, os.ErrInvalid
+		return nil, nil, os.ErrInvalid
 	}
 
 	c.mtx.Lock()
@@ -428,13 +467,15 @@ func (c *Channel) ReadPacket() (*lob.Packet, error) {
 		c.cndRead.Wait()
 	}
 
+	var pipe *Pipe
 	pkt, err := c.peekPacket()
 	if pkt != nil {
+		pipe = c.readBuffer[0].pipe
 		c.readPacket()
 	}
 
 	c.mtx.Unlock()
-	return pkt, err
+	return pkt, pipe, err
 }
 
 func (c *Channel) blockRead() bool {
@@ -550,7 +591,8 @@ func (c *Channel) readPacket() {
 	}
 }
 
-func (c *Channel) receivedPacket(pkt *lob.Packet) {
+// receivedPacket buffers pkt which was received over p (nil when unknown).
+func (c *Channel) receivedPacket(pkt *lob.Packet, p *Pipe) {
 	const (
 		errBrokenChannel   = "broken channel"
 		errMissingSeq      = "missing seq"
@@ -561,6 +603,7 @@ func (c *Channel) receivedPacket(pkt *lob.Packet) {
 	c.mtx.Lock()
 
 	if c.broken {
+		c.rcvDropped++
 		c.mtx.Unlock()
 		c.traceDroppedPacket(pkt, errBrokenChannel)
 		statChannelRcvPktDrop.Add(1)
@@ -612,6 +655,8 @@ func (c *Channel) receivedPacket(pkt *lob.Packet) {
 			}
 
 			if changed {
+				c.resends = 0
+
 				c.cndWrite.Signal()
 				if c.deliveredEnd || c.receivedEnd {
 					c.cndClose.Signal()
@@ -626,6 +671,9 @@ func (c *Channel) receivedPacket(pkt *lob.Packet) {
 
 	if !hasSeq {
 		// drop: is not a valid packet
+		if !hasAck {
+			c.rcvDropped++
+		}
 		c.mtx.Unlock()
 		c.traceDroppedPacket(pkt, errMissingSeq)
 
@@ -643,6 +691,7 @@ func (c *Channel) receivedPacket(pkt *lob.Packet) {
 
 	if seq <= c.iSeq {
 		// drop: the reader already read a packet with this seq
+		c.rcvDropped++
 		c.mtx.Unlock()
 		c.traceDroppedPacket(pkt, errDuplicatePacket)
 		statChannelRcvPktDrop.Add(1)
@@ -651,6 +700,7 @@ func (c *Channel) receivedPacket(pkt *lob.Packet) {
 
 	if len(c.readBuffer) >= cReadBufferSize {
 		// drop: the read buffer is full
+		c.rcvDropped++
 		c.mtx.Unlock()
 		c.traceDroppedPacket(pkt, errFullBuffer)
 		statChannelRcvPktDrop.Add(1)
@@ -659,6 +709,7 @@ func (c *Channel) receivedPacket(pkt *lob.Packet) {
 
 	if c.readBuffer.IndexOf(seq) >= 0 {
 		// drop: a packet with this seq is already buffered
+		c.rcvDropped++
 		c.mtx.Unlock()
 		c.traceDroppedPacket(pkt, errDuplicatePacket)
 		statChannelRcvPktDrop.Add(1)
@@ -673,7 +724,9 @@ func (c *Channel) receivedPacket(pkt *lob.Packet) {
 		c.deliverAck()
 	}
 
-	c.readBuffer = append(c.readBuffer, &readBufferEntry{pkt, seq, end})
+	c.rcvPackets++
+	c.rcvBytes += uint64(pkt.BodyLen())
+	c.readBuffer = append(c.readBuffer, &readBufferEntry{pkt, seq, end, p})
 	sort.Sort(c.readBuffer)
 
 	c.cndRead.Signal()
@@ -878,6 +931,8 @@ func (c *Channel) processMissingPackets(ack uint32, miss []uint32) {
 		now       = time.Now()
 		oneSecAgo = now.Add(-1 * time.Second)
 		last      = ack
+		burst     []*lob.Packet
+		dst       *Pipe
 	)
 
 	for _, delta := range miss {
@@ -902,11 +957,24 @@ func (c *Channel) processMissingPackets(ack uint32, miss []uint32) {
 		}
 		e.lastResend = now
 
-		err := c.x.deliverPacket(e.pkt, e.dst)
-		if err == nil {
-			statChannelSndPkt.Add(1)
+		if len(burst) > 0 && e.dst != dst {
+			c.resendBurst(burst, dst)
+			burst = burst[:0]
 		}
+		burst, dst = append(burst, e.pkt), e.dst
+	}
+
+	c.resendBurst(burst, dst)
+}
+
+// resendBurst resends the missing packets pkts to dst in one batch.
+func (c *Channel) resendBurst(pkts []*lob.Packet, dst *Pipe) {
+	if len(pkts) == 0 {
+		return
 	}
+
+	n, _ := c.x.deliverPackets(pkts, dst)
+	statChannelSndPkt.Add(int64(n))
 }
 
 func (c *Channel) resendLastPacket() {
@@ -921,6 +989,12 @@ func (c *Channel) resendLastPacket() {
 		return
 	}
 
+	if c.oSeq == cInitialSeq && !c.isOpened() {
+		// the open packet is retransmitted according to the open policy
+		c.mtx.Unlock()
+		return
+	}
+
 	e := c.writeBuffer[c.oSeq]
 	if e == nil {
 		c.mtx.Unlock()
@@ -936,8 +1010,16 @@ func (c *Channel) resendLastPacket() {
 		hdr.Miss, hdr.HasMiss = omiss, true
 	}
 	e.lastResend = time.Now()
+
+	c.resends++
+	stalled := c.resends%stalledResends == 0
 	c.mtx.Unlock()
 
+	if stalled {
+		// the path is no longer delivering; ask the exchange to fail over
+		c.x.pathStalled(e.dst)
+	}
+
 	err := c.x.deliverPacket(e.pkt, e.dst)
 	if err == nil {
 		statChannelSndPkt.Add(1)
@@ -1046,7 +1128,7 @@ func (c *Channel) setOpenDeadline() {
 		}
 
 		c.tOpenDeadline = time.AfterFunc(
-			60*time.Second,
+			c.openPolicy.Timeout,
 			c.onOpenDeadlineReached,
 		)
 	}
@@ -1054,6 +1136,7 @@ func (c *Channel) setOpenDeadline() {
 
 func (c *Channel) unsetTimers() {
 	c.unsetOpenDeadline()
+	c.unsetOpenRetry()
 	c.unsetCloseDeadline()
 	c.unsetReadDeadline()
 	c.unsetWriteDeadline()
@@ -1171,6 +1254,57 @@ func (c *Channel) Write(b []byte) (int, error) {
 	return n, nil
 }
 
+// ReadFrom implements the io.ReaderFrom interface. Data is read from r directly
+// into packet buffers, which avoids the intermediate buffer used by io.Copy.
+func (c *Channel) ReadFrom(r io.Reader) (int64, error) {
+	var n int64
+
+	for {
+		pkt := lob.New(nil)
+		m, err := pkt.ReadBodyFrom(r, cStreamChunkSize)
+
+		if m > 0 {
+			werr := c.WritePacket(pkt)
+			if werr != nil {
+				return n, werr
+			}
+			n += int64(m)
+		} else {
+			pkt.Free()
+		}
+
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// WriteTo implements the io.WriterTo interface. Packet bodies are written
+// to w directly from the received packets.
+func (c *Channel) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+
+	for {
+		pkt, err := c.ReadPacket()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+
+		m, err := pkt.WriteBodyTo(w)
+		pkt.Free()
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
 // SetDeadline implements the net.Conn SetDeadline method.
 func (c *Channel) SetDeadline(d time.Time) error {
 	c.mtx.Lock()
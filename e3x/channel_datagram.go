@@ -0,0 +1,75 @@
+package e3x
+
+import (
+	"errors"
+	"os"
+
+	"github.com/telehash/gogotelehash/internal/lob"
+)
+
+var (
+	ErrReliableChannel  = errors.New("e3x: datagrams require an unreliable channel")
+	ErrDatagramTooLarge = errors.New("e3x: datagram too large")
+)
+
+// MaxDatagramSize is the largest datagram that can be written with WriteDatagram.
+// It leaves room for the channel header and the cipherset overhead.
+const MaxDatagramSize = 1280
+
+// DatagramStats holds the packet counters of a channel.
+type DatagramStats struct {
+	Sent     uint64 // datagrams written to the exchange
+	Received uint64 // datagrams received and buffered for reading
+	Dropped  uint64 // datagrams dropped (full read buffer, duplicates, broken channel)
+}
+
+// WriteDatagram writes b as a single packet. Datagrams are delivered at most once
+// and may be dropped or reordered by the network.
+func (c *Channel) WriteDatagram(b []byte) error {
+	if c == nil {
+		return os.ErrInvalid
+	}
+
+	if c.reliable {
+		return ErrReliableChannel
+	}
+
+	if len(b) > MaxDatagramSize {
+		return ErrDatagramTooLarge
+	}
+
+	return c.WritePacket(lob.New(b))
+}
+
+// ReadDatagram reads the next datagram. The returned slice is owned by the caller.
+func (c *Channel) ReadDatagram() ([]byte, error) {
+	if c == nil {
+		return nil, os.ErrInvalid
+	}
+
+	if c.reliable {
+		return nil, ErrReliableChannel
+	}
+
+	pkt, err := c.ReadPacket()
+	if err != nil {
+		return nil, err
+	}
+
+	b := pkt.Body(make([]byte, 0, pkt.BodyLen()))
+	pkt.Free()
+
+	return b, nil
+}
+
+// DatagramStats returns the packet counters of the channel.
+func (c *Channel) DatagramStats() DatagramStats {
+	c.mtx.Lock()
+	stats := DatagramStats{
+		Sent:     c.sndPackets,
+		Received: c.rcvPackets,
+		Dropped:  c.rcvDropped,
+	}
+	c.mtx.Unlock()
+	return stats
+}
@@ -0,0 +1,40 @@
+package e3x
+
+import (
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/mock"
+
+	"github.com/telehash/gogotelehash/internal/lob"
+)
+
+func TestDatagrams(t *testing.T) {
+	assert := assert.New(t)
+
+	x := &MockExchange{}
+	x.On("deliverPacket", mock.Anything).Return(nil)
+
+	c := newChannel("a", "telemetry", false, true, x)
+
+	for i := 0; i < cReadBufferSize+5; i++ {
+		c.receivedPacket(lob.New([]byte("sample")), nil)
+	}
+
+	b, err := c.ReadDatagram()
+	assert.NoError(err)
+	assert.Equal("sample", string(b))
+
+	err = c.WriteDatagram([]byte("ok"))
+	assert.NoError(err)
+
+	err = c.WriteDatagram(make([]byte, MaxDatagramSize+1))
+	assert.Equal(ErrDatagramTooLarge, err)
+
+	assert.Equal(DatagramStats{Sent: 1, Received: cReadBufferSize, Dropped: 5}, c.DatagramStats())
+
+	r := newChannel("a", "stream", true, true, x)
+	assert.Equal(ErrReliableChannel, r.WriteDatagram([]byte("x")))
+	_, err = r.ReadDatagram()
+	assert.Equal(ErrReliableChannel, err)
+}
@@ -0,0 +1,138 @@
+package e3x
+
+import (
+	"os"
+	"time"
+
+	"github.com/telehash/gogotelehash/internal/hashname"
+	"github.com/telehash/gogotelehash/internal/lob"
+)
+
+// ChannelDirection indicates which side opened a channel.
+type ChannelDirection uint8
+
+const (
+	// ChannelOutbound channels were opened by the local endpoint.
+	ChannelOutbound ChannelDirection = iota
+	// ChannelInbound channels were opened by the remote endpoint.
+	ChannelInbound
+)
+
+func (d ChannelDirection) String() string {
+	if d == ChannelInbound {
+		return "inbound"
+	}
+	return "outbound"
+}
+
+// ChannelHandle is a snapshot of an open channel. It can be used to inspect
+// and cancel channels that are owned by other parts of the program.
+type ChannelHandle struct {
+	ID        uint32
+	Type      string
+	Hashname  hashname.H
+	Reliable  bool
+	Direction ChannelDirection
+	Opened    time.Time
+
+	BytesSent     uint64 // body bytes written to the exchange
+	BytesReceived uint64 // body bytes accepted in the read buffer
+
+	c *Channel
+}
+
+// Age returns the time since the channel was opened.
+func (h *ChannelHandle) Age() time.Duration {
+	return time.Since(h.Opened)
+}
+
+// Channel returns the channel described by h.
+func (h *ChannelHandle) Channel() *Channel {
+	return h.c
+}
+
+// Cancel breaks the channel. When possible the remote endpoint is notified
+// with an err packet containing reason. Unlike Channel.Error, Cancel never
+// blocks on a stuck write stream.
+func (h *ChannelHandle) Cancel(reason string) error {
+	return h.c.cancel(reason)
+}
+
+// Handle returns a snapshot of the channel.
+func (c *Channel) Handle() *ChannelHandle {
+	c.mtx.Lock()
+	h := &ChannelHandle{
+		ID:            c.id,
+		Type:          c.typ,
+		Hashname:      c.hashname,
+		Reliable:      c.reliable,
+		Opened:        c.opened,
+		BytesSent:     c.sndBytes,
+		BytesReceived: c.rcvBytes,
+		c:             c,
+	}
+	if c.serverside {
+		h.Direction = ChannelInbound
+	}
+	c.mtx.Unlock()
+	return h
+}
+
+// Channels returns handles for all the open channels of the exchange.
+func (x *Exchange) Channels() []*ChannelHandle {
+	channels := x.channels.All()
+
+	l := make([]*ChannelHandle, 0, len(channels))
+	for _, c := range channels {
+		l = append(l, c.Handle())
+	}
+
+	return l
+}
+
+// Channels returns handles for all the open channels of the endpoint.
+func (e *Endpoint) Channels() []*ChannelHandle {
+	var l []*ChannelHandle
+
+	for _, x := range e.GetExchanges() {
+		l = append(l, x.Channels()...)
+	}
+
+	return l
+}
+
+func (c *Channel) cancel(reason string) error {
+	if c == nil {
+		return os.ErrInvalid
+	}
+
+	if reason == "" {
+		reason = "canceled"
+	}
+
+	c.mtx.Lock()
+
+	if c.broken {
+		c.mtx.Unlock()
+		return &BrokenChannelError{c.hashname, c.typ, c.id}
+	}
+
+	if !c.deliveredEnd && !c.blockWrite() {
+		// best effort; the channel is broken regardless of the outcome
+		pkt := &lob.Packet{}
+		pkt.Header().SetString("err", reason)
+		c.write(pkt, nil)
+	}
+
+	c.broken = true
+	c.unsetTimers()
+
+	c.cndWrite.Broadcast()
+	c.cndRead.Broadcast()
+	c.cndClose.Broadcast()
+
+	c.mtx.Unlock()
+
+	c.channelHooks.Closed()
+	return nil
+}
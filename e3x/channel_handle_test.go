@@ -0,0 +1,85 @@
+package e3x
+
+import (
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/internal/lob"
+)
+
+func TestChannelHandles(t *testing.T) {
+	withTwoEndpoints(t, func(A, B *Endpoint) {
+		var (
+			assert   = assert.New(t)
+			accepted = make(chan *Channel, 1)
+		)
+
+		l := A.Listen("ping", true)
+		defer l.Close()
+
+		go func() {
+			c, err := l.AcceptChannel()
+			if err != nil {
+				close(accepted)
+				return
+			}
+
+			pkt, err := c.ReadPacket()
+			if err == nil {
+				pkt.Free()
+				c.WritePacket(lob.New([]byte("pong")))
+			}
+			accepted <- c
+		}()
+
+		ident, err := A.LocalIdentity()
+		assert.NoError(err)
+
+		c, err := B.Open(ident, "ping", true)
+		if !assert.NoError(err) {
+			return
+		}
+		defer c.Kill()
+
+		assert.NoError(c.WritePacket(lob.New([]byte("ping"))))
+		_, err = c.ReadPacket()
+		assert.NoError(err)
+
+		s := <-accepted
+		if !assert.NotNil(s) {
+			return
+		}
+
+		handles := B.Channels()
+		if assert.Len(handles, 1) {
+			h := handles[0]
+			assert.Equal("ping", h.Type)
+			assert.Equal(A.LocalHashname(), h.Hashname)
+			assert.Equal(ChannelOutbound, h.Direction)
+			assert.Equal(uint64(4), h.BytesSent)
+			assert.Equal(uint64(4), h.BytesReceived)
+			assert.True(h.Age() > 0)
+			assert.Equal(c, h.Channel())
+		}
+
+		handles = A.Channels()
+		if assert.Len(handles, 1) {
+			h := handles[0]
+			assert.Equal(ChannelInbound, h.Direction)
+			assert.Equal(B.LocalHashname(), h.Hashname)
+			assert.NoError(h.Cancel("stuck"))
+			assert.IsType(&BrokenChannelError{}, h.Cancel("stuck"))
+		}
+
+		_, err = s.ReadPacket()
+		assert.IsType(&BrokenChannelError{}, err)
+
+		// the remote endpoint receives the reason
+		pkt, err := c.ReadPacket()
+		if assert.NoError(err) {
+			reason, _ := pkt.Header().GetString("err")
+			assert.Equal("stuck", reason)
+		}
+	})
+}
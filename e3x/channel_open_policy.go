@@ -0,0 +1,149 @@
+package e3x
+
+import (
+	"time"
+)
+
+// OpenPolicy controls the retransmission of the initial packet of a channel
+// opened by the local endpoint.
+type OpenPolicy struct {
+	// Timeout after which a channel that didn't receive a response is broken.
+	// Defaults to 60 seconds.
+	Timeout time.Duration
+
+	// RetryInterval is the delay before the first retransmission of the open
+	// packet. The delay is doubled after each retransmission (up to MaxRetryInterval).
+	// Defaults to 1 second.
+	RetryInterval time.Duration
+
+	// MaxRetryInterval caps the delay between retransmissions.
+	// Defaults to 8 seconds.
+	MaxRetryInterval time.Duration
+
+	// MaxRetries is the number of retransmissions after which the channel is
+	// broken. Zero means the open packet is retransmitted until Timeout.
+	MaxRetries int
+
+	// RetryUnreliable enables the retransmission of the open packet of
+	// unreliable channels. Unreliable packets carry no sequence number, so the
+	// peer reads every retransmitted open packet that arrives before it
+	// answered; only enable it for protocols that tolerate duplicates.
+	// The open packets of reliable channels are always retransmitted.
+	RetryUnreliable bool
+}
+
+// DefaultOpenPolicy is used by endpoints that were opened without
+// the ChannelOpenPolicy option.
+var DefaultOpenPolicy = OpenPolicy{
+	Timeout:          60 * time.Second,
+	RetryInterval:    1 * time.Second,
+	MaxRetryInterval: 8 * time.Second,
+}
+
+// ChannelOpenPolicy sets the open policy for all channels opened by the endpoint.
+func ChannelOpenPolicy(policy OpenPolicy) EndpointOption {
+	return func(e *Endpoint) error {
+		e.openPolicy = policy
+		return nil
+	}
+}
+
+func (p OpenPolicy) withDefaults() OpenPolicy {
+	if p.Timeout <= 0 {
+		p.Timeout = DefaultOpenPolicy.Timeout
+	}
+	if p.RetryInterval <= 0 {
+		p.RetryInterval = DefaultOpenPolicy.RetryInterval
+	}
+	if p.MaxRetryInterval <= 0 {
+		p.MaxRetryInterval = DefaultOpenPolicy.MaxRetryInterval
+	}
+	if p.MaxRetryInterval < p.RetryInterval {
+		p.MaxRetryInterval = p.RetryInterval
+	}
+	return p
+}
+
+func (p OpenPolicy) retryInterval(retries int) time.Duration {
+	d := p.RetryInterval
+	for i := 0; i < retries && d < p.MaxRetryInterval; i++ {
+		d *= 2
+	}
+	if d > p.MaxRetryInterval {
+		d = p.MaxRetryInterval
+	}
+	return d
+}
+
+func withOpenPolicy(policy OpenPolicy) ChannelOption {
+	return func(c *Channel) error {
+		c.openPolicy = policy.withDefaults()
+		return nil
+	}
+}
+
+// isOpened returns true when a client channel received a response to its open packet.
+func (c *Channel) isOpened() bool {
+	return c.serverside || c.iBufferedSeq >= cInitialSeq || c.oAckedSeq >= cInitialSeq
+}
+
+func (c *Channel) scheduleOpenRetry() {
+	d := c.openPolicy.retryInterval(c.openRetries)
+
+	if c.tOpenRetry == nil {
+		c.tOpenRetry = time.AfterFunc(d, c.onOpenRetry)
+	} else {
+		c.tOpenRetry.Reset(d)
+	}
+}
+
+func (c *Channel) unsetOpenRetry() {
+	if c.tOpenRetry != nil {
+		c.tOpenRetry.Stop()
+	}
+}
+
+func (c *Channel) onOpenRetry() {
+	c.mtx.Lock()
+
+	if c.broken || c.isOpened() {
+		c.openPkt = nil
+		c.mtx.Unlock()
+		return
+	}
+
+	if c.openPolicy.MaxRetries > 0 && c.openRetries >= c.openPolicy.MaxRetries {
+		c.openPkt = nil
+		c.mtx.Unlock()
+		c.onOpenDeadlineReached()
+		return
+	}
+
+	var (
+		pkt = c.openPkt
+		dst *Pipe
+	)
+
+	if c.reliable {
+		e := c.writeBuffer[cInitialSeq]
+		if e == nil {
+			c.mtx.Unlock()
+			return
+		}
+		pkt, dst = e.pkt, e.dst
+	}
+
+	c.openRetries++
+	c.mtx.Unlock()
+
+	err := c.x.deliverPacket(pkt, dst)
+	if err == nil {
+		statChannelSndPkt.Add(1)
+	}
+
+	c.mtx.Lock()
+	if !c.broken && !c.isOpened() {
+		c.scheduleOpenRetry()
+	}
+	c.mtx.Unlock()
+}
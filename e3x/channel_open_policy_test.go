@@ -0,0 +1,115 @@
+package e3x
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/internal/lob"
+)
+
+// countingExchange counts the delivered packets. Unlike the call log of
+// MockExchange the count can be read while timers deliver packets.
+type countingExchange struct {
+	MockExchange
+
+	mtx       sync.Mutex
+	delivered int
+}
+
+func (x *countingExchange) deliverPacket(pkt *lob.Packet, dst *Pipe) error {
+	x.mtx.Lock()
+	x.delivered++
+	x.mtx.Unlock()
+	return nil
+}
+
+func (x *countingExchange) deliverPackets(pkts []*lob.Packet, dst *Pipe) (int, error) {
+	for _, pkt := range pkts {
+		x.deliverPacket(pkt, dst)
+	}
+	return len(pkts), nil
+}
+
+func (x *countingExchange) count() int {
+	x.mtx.Lock()
+	defer x.mtx.Unlock()
+	return x.delivered
+}
+
+func TestOpenPolicyRetries(t *testing.T) {
+	assert := assert.New(t)
+
+	x := &countingExchange{}
+
+	c := newChannel("a", "ping", false, false, x, withOpenPolicy(OpenPolicy{
+		RetryInterval:   10 * time.Millisecond,
+		MaxRetries:      2,
+		RetryUnreliable: true,
+	}))
+
+	err := c.WritePacket(lob.New([]byte("ping")))
+	assert.NoError(err)
+
+	time.Sleep(200 * time.Millisecond)
+
+	assert.Equal(3, x.count())
+
+	_, err = c.ReadPacket()
+	assert.IsType(&BrokenChannelError{}, err)
+}
+
+func TestOpenPolicyUnreliable(t *testing.T) {
+	assert := assert.New(t)
+
+	x := &countingExchange{}
+
+	c := newChannel("a", "ping", false, false, x, withOpenPolicy(OpenPolicy{
+		RetryInterval: 10 * time.Millisecond,
+	}))
+
+	err := c.WritePacket(lob.New([]byte("ping")))
+	assert.NoError(err)
+
+	time.Sleep(100 * time.Millisecond)
+
+	// the open packet of an unreliable channel is not retransmitted by default
+	assert.Equal(1, x.count())
+	c.Kill()
+}
+
+func TestOpenPolicyOpened(t *testing.T) {
+	assert := assert.New(t)
+
+	x := &countingExchange{}
+
+	c := newChannel("a", "ping", false, false, x, withOpenPolicy(OpenPolicy{
+		RetryInterval:   20 * time.Millisecond,
+		RetryUnreliable: true,
+	}))
+
+	err := c.WritePacket(lob.New([]byte("ping")))
+	assert.NoError(err)
+
+	c.receivedPacket(lob.New([]byte("pong")), nil)
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(1, x.count())
+
+	pkt, err := c.ReadPacket()
+	if assert.NoError(err) {
+		assert.Equal("pong", string(pkt.Body(nil)))
+	}
+}
+
+func TestOpenPolicyRetryInterval(t *testing.T) {
+	assert := assert.New(t)
+
+	p := DefaultOpenPolicy
+	assert.Equal(1*time.Second, p.retryInterval(0))
+	assert.Equal(2*time.Second, p.retryInterval(1))
+	assert.Equal(8*time.Second, p.retryInterval(3))
+	assert.Equal(8*time.Second, p.retryInterval(10))
+}
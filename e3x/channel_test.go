@@ -18,14 +18,26 @@ import (
 )
 
 func withTwoEndpoints(t testing.TB, f func(a, b *Endpoint)) {
-	withEndpoint(t, func(a *Endpoint) {
-		withEndpoint(t, func(b *Endpoint) {
+	withTwoEndpointsOptions(t, nil, f)
+}
+
+// withTwoEndpointsOptions is like withTwoEndpoints but opens both endpoints
+// with options.
+func withTwoEndpointsOptions(t testing.TB, options []EndpointOption, f func(a, b *Endpoint)) {
+	withEndpointOptions(t, options, func(a *Endpoint) {
+		withEndpointOptions(t, options, func(b *Endpoint) {
 			f(a, b)
 		})
 	})
 }
 
 func withEndpoint(t testing.TB, f func(e *Endpoint)) {
+	withEndpointOptions(t, nil, f)
+}
+
+// withEndpointOptions is like withEndpoint but opens the endpoint with
+// options.
+func withEndpointOptions(t testing.TB, options []EndpointOption, f func(e *Endpoint)) {
 	var (
 		err error
 		e   *Endpoint
@@ -42,9 +54,9 @@ func withEndpoint(t testing.TB, f func(e *Endpoint)) {
 			udp.Config{Network: "udp6"})
 	}
 
-	e, err = Open(
+	e, err = Open(append([]EndpointOption{
 		Transport(tr),
-		Log(nil))
+		Log(nil)}, options...)...)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -229,6 +241,55 @@ func TestFloodReliable(t *testing.T) {
 	})
 }
 
+func TestCopyReliable(t *testing.T) {
+	logs.ResetLogger()
+
+	withTwoEndpoints(t, func(A, B *Endpoint) {
+		var (
+			assert = assert.New(t)
+			data   = bytes.Repeat([]byte("0123456789abcdef"), 1000)
+			out    bytes.Buffer
+			done   = make(chan struct{})
+		)
+
+		go func() {
+			defer close(done)
+
+			c, err := A.Listen("copy", true).AcceptChannel()
+			if assert.NoError(err) && assert.NotNil(c) {
+				defer c.Close()
+
+				_, err = c.ReadPacket()
+				assert.NoError(err)
+
+				// hide bytes.Reader.WriteTo so io.Copy uses Channel.ReadFrom
+				n, err := io.Copy(c, struct{ io.Reader }{bytes.NewReader(data)})
+				assert.NoError(err)
+				assert.Equal(int64(len(data)), n)
+			}
+		}()
+
+		ident, err := A.LocalIdentity()
+		assert.NoError(err)
+
+		c, err := B.Open(ident, "copy", true)
+		if assert.NoError(err) && assert.NotNil(c) {
+			err = c.WritePacket(lob.New(nil))
+			assert.NoError(err)
+
+			// hide bytes.Buffer.ReadFrom so io.Copy uses Channel.WriteTo
+			_, err = io.Copy(struct{ io.Writer }{&out}, c)
+			assert.NoError(err)
+
+			err = c.Close()
+			assert.NoError(err)
+		}
+
+		<-done
+		assert.True(bytes.Equal(data, out.Bytes()))
+	})
+}
+
 func BenchmarkReadWriteReliable(b *testing.B) {
 	defer dumpExpVar(b)
 	logs.ResetLogger()
@@ -13,6 +13,7 @@ var (
 	ErrInvalidState   = errors.New("cipherset: invalid state")
 	ErrInvalidMessage = errors.New("cipherset: invalid message")
 	ErrInvalidPacket  = errors.New("cipherset: invalid packet")
+	ErrNoDecrypter    = errors.New("cipherset: cipher does not support external private keys")
 )
 
 type Cipher interface {
@@ -53,6 +54,28 @@ type State interface {
 	DecryptPacket(pkt *lob.Packet) (*lob.Packet, error)
 }
 
+// Wiper is implemented by states that can erase their secret key material.
+// Exchanges wipe their state when they are closed.
+type Wiper interface {
+	Wipe()
+}
+
+// PacketSealer is implemented by states that encrypt and decrypt channel
+// packets into caller-provided buffers. Exchanges use it on the packet hot
+// path; SealPacket and OpenPacket don't allocate when dst has enough capacity.
+type PacketSealer interface {
+	// SealPacket appends the encrypted packet body of the encoded inner packet
+	// to dst.
+	SealPacket(dst, inner []byte) ([]byte, error)
+
+	// OpenPacket appends the encoded inner packet of the encrypted packet body
+	// to dst.
+	OpenPacket(dst, body []byte) ([]byte, error)
+
+	// PacketOverhead is the number of bytes SealPacket adds to an inner packet.
+	PacketOverhead() int
+}
+
 type Handshake interface {
 	CSID() uint8
 
@@ -71,6 +94,30 @@ type Key interface {
 	CanEncrypt() bool
 }
 
+// A Decrypter performs the private key operation of a Key. Keys that are
+// kept in hardware (a PKCS#11 token or a TPM) are wrapped in a Decrypter so
+// the private key never has to leave the device (see KeyFromDecrypter).
+//
+// The cipher sets only use their private keys for Diffie-Hellman key
+// agreement; there is no signing operation.
+type Decrypter interface {
+	CSID() uint8
+
+	// Public returns the public key as it is encoded by the cipher set.
+	Public() []byte
+
+	// ECDH returns the shared secret of the private key and the public key
+	// peer (encoded as by the cipher set). For elliptic curves this is the X
+	// coordinate of the shared point.
+	ECDH(peer []byte) ([]byte, error)
+}
+
+// DecrypterCipher is implemented by ciphers that accept keys backed by a
+// Decrypter.
+type DecrypterCipher interface {
+	KeyFromDecrypter(d Decrypter) (Key, error)
+}
+
 type Token [16]byte
 
 var ZeroToken Token
@@ -22,9 +22,15 @@ import (
 
 var (
 	_ cipherset.Cipher    = (*cipher)(nil)
+	_ cipherset.Capable   = (*cipher)(nil)
 	_ cipherset.State     = (*state)(nil)
 	_ cipherset.Key       = (*key)(nil)
-	_ cipherset.Handshake = (*handshake)(nil)
+	_ cipherset.Decrypter = (*key)(nil)
+
+	_ cipherset.DecrypterCipher = (*cipher)(nil)
+	_ cipherset.SeedCipher      = (*cipher)(nil)
+	_ cipherset.PacketSealer    = (*state)(nil)
+	_ cipherset.Handshake       = (*handshake)(nil)
 )
 
 func init() {
@@ -52,14 +58,43 @@ func (h *handshake) At() uint32 { return h.at }
 func (*handshake) CSID() uint8  { return 0x1a }
 func (*cipher) CSID() uint8     { return 0x1a }
 
+func (*cipher) Capabilities() cipherset.Capabilities {
+	return cipherset.Capabilities{
+		CanEncryptMessage: true,
+		TokenSize:         16,
+		KeySize:           21,
+	}
+}
+
 func (c *cipher) DecodeKeyBytes(pub, prv []byte) (cipherset.Key, error) {
 	return decodeKeyBytes(pub, prv)
 }
 
+func (c *cipher) KeyFromDecrypter(d cipherset.Decrypter) (cipherset.Key, error) {
+	if d.CSID() != 0x1a {
+		return nil, cipherset.ErrInvalidKey
+	}
+
+	k, err := decodeKeyBytes(d.Public(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if !k.CanEncrypt() {
+		return nil, cipherset.ErrInvalidKey
+	}
+
+	k.dec = d
+	return k, nil
+}
+
 func (c *cipher) GenerateKey() (cipherset.Key, error) {
 	return generateKey()
 }
 
+func (c *cipher) GenerateKeyFromReader(r io.Reader) (cipherset.Key, error) {
+	return generateKeyFrom(r)
+}
+
 func (c *cipher) NewState(localKey cipherset.Key) (cipherset.State, error) {
 	if k, ok := localKey.(*key); ok && k != nil && k.CanEncrypt() && k.CanSign() {
 		s := &state{localKey: k}
@@ -90,8 +125,10 @@ func (c *cipher) DecryptMessage(localKey, remoteKey cipherset.Key, p []byte) ([]
 	}
 
 	{ // verify mac
-		macKey := ecdh.ComputeShared(secp160r1.P160(),
-			cs1aRemoteKey.pub.x, cs1aRemoteKey.pub.y, cs1aLocalKey.prv.d)
+		macKey := cs1aLocalKey.computeShared(cs1aRemoteKey.pub.x, cs1aRemoteKey.pub.y)
+		if macKey == nil {
+			return nil, cipherset.ErrInvalidMessage
+		}
 		macKey = append(macKey, iv...)
 
 		h := hmac.New(sha256.New, macKey)
@@ -107,7 +144,7 @@ func (c *cipher) DecryptMessage(localKey, remoteKey cipherset.Key, p []byte) ([]
 			return nil, cipherset.ErrInvalidMessage
 		}
 
-		shared := ecdh.ComputeShared(secp160r1.P160(), ephemX, ephemY, cs1aLocalKey.prv.d)
+		shared := cs1aLocalKey.computeShared(ephemX, ephemY)
 		if shared == nil {
 			return nil, cipherset.ErrInvalidMessage
 		}
@@ -165,7 +202,7 @@ func (c *cipher) DecryptHandshake(localKey cipherset.Key, p []byte) (cipherset.H
 			return nil, cipherset.ErrInvalidMessage
 		}
 
-		shared := ecdh.ComputeShared(secp160r1.P160(), ephemX, ephemY, cs1aLocalKey.prv.d)
+		shared := cs1aLocalKey.computeShared(ephemX, ephemY)
 		if shared == nil {
 			return nil, cipherset.ErrInvalidMessage
 		}
@@ -234,8 +271,10 @@ func (c *cipher) DecryptHandshake(localKey cipherset.Key, p []byte) (cipherset.H
 		var nonce [16]byte
 		copy(nonce[:], iv)
 
-		macKey := ecdh.ComputeShared(secp160r1.P160(),
-			remoteKey.pub.x, remoteKey.pub.y, cs1aLocalKey.prv.d)
+		macKey := cs1aLocalKey.computeShared(remoteKey.pub.x, remoteKey.pub.y)
+		if macKey == nil {
+			return nil, cipherset.ErrInvalidMessage
+		}
 		macKey = append(macKey, nonce[:]...)
 
 		h := hmac.New(sha256.New, macKey)
@@ -258,6 +297,8 @@ type state struct {
 	remoteToken       *cipherset.Token
 	lineEncryptionKey []byte
 	lineDecryptionKey []byte
+	encBlock          Cipher.Block
+	decBlock          Cipher.Block
 }
 
 func (*state) CSID() uint8 { return 0x1a }
@@ -343,6 +384,10 @@ func (s *state) update() {
 		sha.Write(s.remoteLineKey.Public())
 		sha.Write(s.localLineKey.Public())
 		s.lineDecryptionKey = fold(sha.Sum(nil), 16)
+
+		// the AES keys are always 16 bytes long
+		s.encBlock, _ = aes.NewCipher(s.lineEncryptionKey)
+		s.decBlock, _ = aes.NewCipher(s.lineDecryptionKey)
 	}
 }
 
@@ -426,8 +471,10 @@ func (s *state) EncryptMessage(in []byte) ([]byte, error) {
 	}
 
 	{ // compute HMAC
-		macKey := ecdh.ComputeShared(secp160r1.P160(),
-			s.remoteKey.pub.x, s.remoteKey.pub.y, s.localKey.prv.d)
+		macKey := s.localKey.computeShared(s.remoteKey.pub.x, s.remoteKey.pub.y)
+		if macKey == nil {
+			return nil, cipherset.ErrInvalidState
+		}
 		macKey = append(macKey, raw[21:21+4]...)
 
 		h := hmac.New(sha256.New, macKey)
@@ -470,6 +517,8 @@ func (s *state) ApplyHandshake(h cipherset.Handshake) bool {
 		s.remoteToken = nil
 		s.lineDecryptionKey = nil
 		s.lineEncryptionKey = nil
+		s.encBlock = nil
+		s.decBlock = nil
 	}
 
 	s.setRemoteLineKey(hs.lineKey)
@@ -481,19 +530,10 @@ func (s *state) ApplyHandshake(h cipherset.Handshake) bool {
 
 func (s *state) EncryptPacket(pkt *lob.Packet) (*lob.Packet, error) {
 	s.mtx.RLock()
-	defer s.mtx.RUnlock()
-
-	var (
-		outer   *lob.Packet
-		inner   *bufpool.Buffer
-		body    *bufpool.Buffer
-		bodyRaw []byte
-		nonce   [16]byte
-		ctLen   int
-		err     error
-	)
+	ok := s.CanEncryptPacket()
+	s.mtx.RUnlock()
 
-	if !s.CanEncryptPacket() {
+	if !ok {
 		return nil, cipherset.ErrInvalidState
 	}
 	if pkt == nil {
@@ -501,138 +541,127 @@ func (s *state) EncryptPacket(pkt *lob.Packet) (*lob.Packet, error) {
 	}
 
 	// encode inner packet
-	inner, err = lob.Encode(pkt)
+	inner, err := lob.Encode(pkt)
 	if err != nil {
 		return nil, err
 	}
+	defer inner.Free()
 
-	ctLen = inner.Len()
+	body := bufpool.New()
+	defer body.Free()
 
-	// make nonce
-	_, err = io.ReadFull(rand.Reader, nonce[:4])
+	bodyRaw, err := s.SealPacket(body.RawBytes()[:0], inner.RawBytes())
 	if err != nil {
 		return nil, err
 	}
 
-	// alloc enough space
-	body = bufpool.New().SetLen(16 + 4 + ctLen + 4)
-	bodyRaw = body.RawBytes()
-
-	// copy token
-	copy(bodyRaw[:16], (*s.remoteToken)[:])
-
-	// copy nonce
-	copy(bodyRaw[16:16+4], nonce[:])
+	return lob.New(bodyRaw), nil
+}
 
-	{ // encrypt inner
-		aesBlock, err := aes.NewCipher(s.lineEncryptionKey)
-		if err != nil {
-			return nil, err
-		}
+func (s *state) DecryptPacket(pkt *lob.Packet) (*lob.Packet, error) {
+	s.mtx.RLock()
+	ok := s.CanDecryptPacket()
+	s.mtx.RUnlock()
 
-		aes := Cipher.NewCTR(aesBlock, nonce[:])
-		if aes == nil {
-			return nil, cipherset.ErrInvalidMessage
-		}
+	if !ok {
+		return nil, cipherset.ErrInvalidState
+	}
+	if pkt == nil {
+		return nil, nil
+	}
 
-		aes.XORKeyStream(bodyRaw[16+4:16+4+ctLen], inner.RawBytes())
+	if !pkt.Header().IsZero() || pkt.BodyLen() < 16+4+4 {
+		return nil, cipherset.ErrInvalidPacket
 	}
 
-	{ // compute HMAC
-		macKey := append(s.lineEncryptionKey, bodyRaw[16:16+4]...)
+	var (
+		body  = bufpool.New()
+		inner = bufpool.New()
+	)
 
-		h := hmac.New(sha256.New, macKey)
-		h.Write(bodyRaw[16+4 : 16+4+ctLen])
-		sum := h.Sum(nil)
-		copy(bodyRaw[16+4+ctLen:], fold(sum, 4))
+	defer body.Free()
+	defer inner.Free()
+
+	innerRaw, err := s.OpenPacket(inner.RawBytes()[:0], pkt.Body(body.RawBytes()[:0]))
+	if err != nil {
+		return nil, err
 	}
+	inner.SetLen(len(innerRaw))
 
-	outer = lob.New(body.RawBytes())
-	inner.Free()
-	body.Free()
+	return lob.Decode(inner)
+}
 
-	return outer, nil
+func (s *state) PacketOverhead() int {
+	return 16 + 4 + 4
 }
 
-func (s *state) DecryptPacket(pkt *lob.Packet) (*lob.Packet, error) {
+func (s *state) SealPacket(dst, inner []byte) ([]byte, error) {
 	s.mtx.RLock()
 	defer s.mtx.RUnlock()
 
-	if !s.CanDecryptPacket() {
+	if !s.CanEncryptPacket() {
 		return nil, cipherset.ErrInvalidState
 	}
-	if pkt == nil {
-		return nil, nil
-	}
-
-	if !pkt.Header().IsZero() || pkt.BodyLen() < 16+4+4 {
-		return nil, cipherset.ErrInvalidPacket
-	}
 
 	var (
-		nonce    [16]byte
-		bodyRaw  []byte
-		innerRaw []byte
-		innerLen = pkt.BodyLen() - (16 + 4 + 4)
-		body     = bufpool.New()
-		inner    = bufpool.New().SetLen(innerLen)
+		ctLen    = len(inner)
+		ret, out = sliceForAppend(dst, 16+4+ctLen+4)
+		sc       = getScratch()
 	)
+	defer putScratch(sc)
 
-	pkt.Body(body.SetLen(pkt.BodyLen()).RawBytes()[:0])
-	bodyRaw = body.RawBytes()
-	innerRaw = inner.RawBytes()
+	// copy token
+	copy(out[:16], (*s.remoteToken)[:])
 
-	// compare token
-	if !bytes.Equal(bodyRaw[:16], (*s.localToken)[:]) {
-		inner.Free()
-		body.Free()
-		return nil, cipherset.ErrInvalidPacket
+	// make nonce
+	_, err := io.ReadFull(rand.Reader, out[16:16+4])
+	if err != nil {
+		return nil, err
 	}
 
-	// copy nonce
-	copy(nonce[:], bodyRaw[16:16+4])
+	// encrypt inner
+	sc.xorCTR(s.encBlock, out[16:16+4], out[16+4:16+4+ctLen], inner)
 
-	{ // verify hmac
-		mac := bodyRaw[16+4+innerLen:]
+	// compute HMAC
+	sc.mac(out[16+4+ctLen:], s.lineEncryptionKey, out[16:16+4], out[16+4:16+4+ctLen])
 
-		macKey := append(s.lineDecryptionKey, nonce[:4]...)
+	return ret, nil
+}
 
-		h := hmac.New(sha256.New, macKey)
-		h.Write(bodyRaw[16+4 : 16+4+innerLen])
-		if subtle.ConstantTimeCompare(mac, fold(h.Sum(nil), 4)) != 1 {
-			inner.Free()
-			body.Free()
-			return nil, cipherset.ErrInvalidPacket
-		}
+func (s *state) OpenPacket(dst, body []byte) ([]byte, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if !s.CanDecryptPacket() {
+		return nil, cipherset.ErrInvalidState
 	}
 
-	{ // decrypt inner
-		aesBlock, err := aes.NewCipher(s.lineDecryptionKey)
-		if err != nil {
-			inner.Free()
-			body.Free()
-			return nil, err
-		}
+	if len(body) < 16+4+4 {
+		return nil, cipherset.ErrInvalidPacket
+	}
 
-		aes := Cipher.NewCTR(aesBlock, nonce[:])
-		if aes == nil {
-			inner.Free()
-			body.Free()
-			return nil, cipherset.ErrInvalidPacket
-		}
+	var (
+		innerLen = len(body) - (16 + 4 + 4)
+		nonce    = body[16 : 16+4]
+		ct       = body[16+4 : 16+4+innerLen]
+		sc       = getScratch()
+	)
+	defer putScratch(sc)
 
-		aes.XORKeyStream(innerRaw, bodyRaw[16+4:16+4+innerLen])
+	// compare token
+	if subtle.ConstantTimeCompare(body[:16], (*s.localToken)[:]) != 1 {
+		return nil, cipherset.ErrInvalidPacket
 	}
 
-	innerPkt, err := lob.Decode(inner)
-	if err != nil {
-		inner.Free()
-		body.Free()
-		return nil, err
+	// verify hmac
+	sc.mac(sc.tag[:], s.lineDecryptionKey, nonce, ct)
+	if subtle.ConstantTimeCompare(body[16+4+innerLen:], sc.tag[:]) != 1 {
+		return nil, cipherset.ErrInvalidPacket
 	}
 
-	inner.Free()
-	body.Free()
+	// decrypt inner
+	ret, out := sliceForAppend(dst, innerLen)
+	sc.xorCTR(s.decBlock, nonce, out, ct)
 
-	return innerPkt, nil
+	return ret, nil
 }
@@ -17,3 +17,11 @@ func BenchmarkPacketEncryption(b *testing.B) {
 func BenchmarkPacketDecryption(b *testing.B) {
 	tests.BenchmarkPacketDecryption(b, &cipher{})
 }
+
+func BenchmarkSealPacket(b *testing.B) {
+	tests.BenchmarkSealPacket(b, &cipher{})
+}
+
+func BenchmarkOpenPacket(b *testing.B) {
+	tests.BenchmarkOpenPacket(b, &cipher{})
+}
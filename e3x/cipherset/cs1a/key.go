@@ -3,10 +3,12 @@ package cs1a
 import (
 	"crypto/elliptic"
 	"crypto/rand"
+	"io"
 	"math/big"
 
 	"github.com/telehash/gogotelehash/e3x/cipherset"
 	"github.com/telehash/gogotelehash/e3x/cipherset/cs1a/eccp"
+	"github.com/telehash/gogotelehash/e3x/cipherset/cs1a/ecdh"
 	"github.com/telehash/gogotelehash/e3x/cipherset/cs1a/secp160r1"
 	"github.com/telehash/gogotelehash/internal/util/base32util"
 )
@@ -14,6 +16,7 @@ import (
 type key struct {
 	pub struct{ x, y *big.Int }
 	prv struct{ d []byte }
+	dec cipherset.Decrypter
 }
 
 func decodeKeyBytes(pub, prv []byte) (*key, error) {
@@ -36,12 +39,16 @@ func decodeKeyBytes(pub, prv []byte) (*key, error) {
 }
 
 func generateKey() (*key, error) {
+	return generateKeyFrom(rand.Reader)
+}
+
+func generateKeyFrom(r io.Reader) (*key, error) {
 	var (
 		k   = &key{}
 		err error
 	)
 
-	k.prv.d, k.pub.x, k.pub.y, err = elliptic.GenerateKey(secp160r1.P160(), rand.Reader)
+	k.prv.d, k.pub.x, k.pub.y, err = elliptic.GenerateKey(secp160r1.P160(), r)
 	if err != nil {
 		return nil, err
 	}
@@ -74,7 +81,41 @@ func (k *key) String() string {
 }
 
 func (k *key) CanSign() bool {
-	return k != nil && k.prv.d != nil
+	return k != nil && (k.prv.d != nil || k.dec != nil)
+}
+
+// ECDH implements cipherset.Decrypter; peer is a compressed public key.
+func (k *key) ECDH(peer []byte) ([]byte, error) {
+	x, y := eccp.Unmarshal(secp160r1.P160(), peer)
+	if x == nil || y == nil {
+		return nil, cipherset.ErrInvalidKey
+	}
+
+	shared := k.computeShared(x, y)
+	if shared == nil {
+		return nil, cipherset.ErrInvalidState
+	}
+	return shared, nil
+}
+
+// computeShared returns the ECDH shared secret of the private key and the
+// point x, y. It returns nil when the Decrypter of k fails.
+func (k *key) computeShared(x, y *big.Int) []byte {
+	if k.prv.d != nil {
+		return ecdh.ComputeShared(secp160r1.P160(), x, y, k.prv.d)
+	}
+
+	if k.dec == nil {
+		return nil
+	}
+
+	shared, err := k.dec.ECDH(eccp.Marshal(secp160r1.P160(), x, y))
+	if err != nil {
+		return nil
+	}
+
+	// decrypters may return a fixed size X coordinate
+	return new(big.Int).SetBytes(shared).Bytes()
 }
 
 func (k *key) CanEncrypt() bool {
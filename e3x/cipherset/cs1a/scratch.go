@@ -0,0 +1,114 @@
+package cs1a
+
+import (
+	"crypto/aes"
+	Cipher "crypto/cipher"
+	"crypto/sha256"
+	"crypto/subtle"
+	"hash"
+	"sync"
+)
+
+// scratch holds the working memory of the packet encryption so that the hot
+// path doesn't allocate.
+type scratch struct {
+	sha  hash.Hash
+	iv   [16]byte
+	ks   [256]byte
+	pad  [64]byte
+	sum  [sha256.Size]byte
+	tag  [4]byte
+	zero [256]byte
+}
+
+var scratchPool = sync.Pool{
+	New: func() interface{} { return &scratch{sha: sha256.New()} },
+}
+
+func getScratch() *scratch {
+	return scratchPool.Get().(*scratch)
+}
+
+func putScratch(sc *scratch) {
+	// don't leave key stream or key material behind
+	copy(sc.ks[:], sc.zero[:])
+	copy(sc.pad[:], sc.zero[:])
+	copy(sc.sum[:], sc.zero[:])
+	sc.sha.Reset()
+	scratchPool.Put(sc)
+}
+
+// xorCTR is AES-CTR with the 4 byte nonce as the first bytes of the IV. It is
+// equivalent to crypto/cipher.NewCTR without allocating a stream.
+func (sc *scratch) xorCTR(block Cipher.Block, nonce, dst, src []byte) {
+	copy(sc.iv[:], sc.zero[:16])
+	copy(sc.iv[:], nonce)
+
+	for len(src) > 0 {
+		n := len(src)
+		if n > len(sc.ks) {
+			n = len(sc.ks)
+		}
+
+		// generate the key stream for the next n bytes
+		for off := 0; off < n; off += aes.BlockSize {
+			block.Encrypt(sc.ks[off:off+aes.BlockSize], sc.iv[:])
+
+			// increment the big-endian counter
+			for i := len(sc.iv) - 1; i >= 0; i-- {
+				sc.iv[i]++
+				if sc.iv[i] != 0 {
+					break
+				}
+			}
+		}
+
+		subtle.XORBytes(dst[:n], src[:n], sc.ks[:n])
+		dst, src = dst[n:], src[n:]
+	}
+}
+
+// mac writes the folded HMAC-SHA256 of msg keyed with key||nonce to dst (4 bytes).
+func (sc *scratch) mac(dst, key, nonce, msg []byte) {
+	const (
+		ipad = 0x36
+		opad = 0x5c
+	)
+
+	// key||nonce is shorter than the block size
+	copy(sc.pad[:], sc.zero[:])
+	copy(sc.pad[:], key)
+	copy(sc.pad[len(key):], nonce)
+
+	for i := range sc.pad {
+		sc.pad[i] ^= ipad
+	}
+	sc.sha.Reset()
+	sc.sha.Write(sc.pad[:])
+	sc.sha.Write(msg)
+	inner := sc.sha.Sum(sc.sum[:0])
+
+	for i := range sc.pad {
+		sc.pad[i] ^= ipad ^ opad
+	}
+	sc.sha.Reset()
+	sc.sha.Write(sc.pad[:])
+	sc.sha.Write(inner)
+	sum := sc.sha.Sum(sc.sum[:0])
+
+	for len(sum) > len(dst) {
+		sum = foldHalf(sum)
+	}
+	copy(dst, sum)
+}
+
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
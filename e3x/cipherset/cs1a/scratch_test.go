@@ -0,0 +1,46 @@
+package cs1a
+
+import (
+	"bytes"
+	"crypto/aes"
+	Cipher "crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+)
+
+// The scratch implementations must match the crypto/cipher and crypto/hmac
+// constructions they replace.
+func TestScratch(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		key   = bytes.Repeat([]byte{0x42}, 16)
+		nonce = []byte{1, 2, 3, 4}
+		msg   = bytes.Repeat([]byte("0123456789"), 100)
+		iv    [16]byte
+		sc    = getScratch()
+	)
+	defer putScratch(sc)
+
+	block, err := aes.NewCipher(key)
+	assert.NoError(err)
+
+	copy(iv[:], nonce)
+	expected := make([]byte, len(msg))
+	Cipher.NewCTR(block, iv[:]).XORKeyStream(expected, msg)
+
+	actual := make([]byte, len(msg))
+	sc.xorCTR(block, nonce, actual, msg)
+	assert.Equal(expected, actual)
+
+	h := hmac.New(sha256.New, append(append([]byte{}, key...), nonce...))
+	h.Write(msg)
+	expected = fold(h.Sum(nil), 4)
+
+	actual = make([]byte, 4)
+	sc.mac(actual, key, nonce, msg)
+	assert.Equal(expected, actual)
+}
@@ -4,13 +4,16 @@ import (
 	"bytes"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/binary"
 	"io"
 	"sync"
 	"sync/atomic"
 
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/golang.org/x/crypto/curve25519"
 	"github.com/telehash/gogotelehash/Godeps/_workspace/src/golang.org/x/crypto/nacl/box"
 	"github.com/telehash/gogotelehash/Godeps/_workspace/src/golang.org/x/crypto/poly1305"
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/golang.org/x/crypto/salsa20/salsa"
 
 	"github.com/telehash/gogotelehash/e3x/cipherset"
 	"github.com/telehash/gogotelehash/internal/lob"
@@ -20,9 +23,16 @@ import (
 
 var (
 	_ cipherset.Cipher    = (*cipher)(nil)
+	_ cipherset.Capable   = (*cipher)(nil)
 	_ cipherset.State     = (*state)(nil)
+	_ cipherset.Wiper     = (*state)(nil)
 	_ cipherset.Key       = (*key)(nil)
-	_ cipherset.Handshake = (*handshake)(nil)
+	_ cipherset.Decrypter = (*key)(nil)
+
+	_ cipherset.DecrypterCipher = (*cipher)(nil)
+	_ cipherset.SeedCipher      = (*cipher)(nil)
+	_ cipherset.PacketSealer    = (*state)(nil)
+	_ cipherset.Handshake       = (*handshake)(nil)
 )
 
 const (
@@ -57,6 +67,14 @@ func (h *handshake) At() uint32 { return h.at }
 func (*handshake) CSID() uint8  { return 0x3a }
 func (*cipher) CSID() uint8     { return 0x3a }
 
+func (*cipher) Capabilities() cipherset.Capabilities {
+	return cipherset.Capabilities{
+		CanEncryptMessage: true,
+		TokenSize:         lenToken,
+		KeySize:           lenKey,
+	}
+}
+
 func (c *cipher) DecodeKeyBytes(pub, prv []byte) (cipherset.Key, error) {
 	var (
 		pubKey *[lenKey]byte
@@ -82,10 +100,27 @@ func (c *cipher) DecodeKeyBytes(pub, prv []byte) (cipherset.Key, error) {
 	return &key{pub: pubKey, prv: prvKey}, nil
 }
 
+func (c *cipher) KeyFromDecrypter(d cipherset.Decrypter) (cipherset.Key, error) {
+	pub := d.Public()
+	if d.CSID() != 0x3a || len(pub) != lenKey {
+		return nil, cipherset.ErrInvalidKey
+	}
+
+	k := makeKey(nil, nil)
+	k.pub = new([lenKey]byte)
+	copy(k.pub[:], pub)
+	k.dec = d
+	return k, nil
+}
+
 func (c *cipher) GenerateKey() (cipherset.Key, error) {
 	return generateKey()
 }
 
+func (c *cipher) GenerateKeyFromReader(r io.Reader) (cipherset.Key, error) {
+	return generateKeyFrom(r)
+}
+
 func (c *cipher) NewState(localKey cipherset.Key) (cipherset.State, error) {
 	if k, ok := localKey.(*key); ok && k != nil && k.CanEncrypt() && k.CanSign() {
 		s := &state{localKey: k}
@@ -118,13 +153,18 @@ func (c *cipher) DecryptMessage(localKey, remoteKey cipherset.Key, p []byte) ([]
 		return nil, cipherset.ErrInvalidState
 	}
 
+	defer wipe(macKey[:])
+	defer wipe(agreedKey[:])
+
 	copy(remoteLineKey[:], p[:lenKey])
 	copy(nonce[:], p[lenKey:lenKey+lenNonce])
 	copy(mac[:], p[lenKey+lenNonce+ctLen:])
 	ciphertext = p[lenKey+lenNonce : lenKey+lenNonce+ctLen]
 
 	{ // make macKey
-		box.Precompute(&macKey, cs3aRemoteKey.pub, cs3aLocalKey.prv)
+		if !cs3aLocalKey.precompute(&macKey, cs3aRemoteKey.pub) {
+			return nil, cipherset.ErrInvalidMessage
+		}
 
 		var (
 			sha = sha256.New()
@@ -140,7 +180,9 @@ func (c *cipher) DecryptMessage(localKey, remoteKey cipherset.Key, p []byte) ([]
 	}
 
 	// make agreedKey
-	box.Precompute(&agreedKey, &remoteLineKey, cs3aLocalKey.prv)
+	if !cs3aLocalKey.precompute(&agreedKey, &remoteLineKey) {
+		return nil, cipherset.ErrInvalidMessage
+	}
 
 	// decode BODY
 	out, ok = box.OpenAfterPrecomputation(out[:0], ciphertext, &nonce, &agreedKey)
@@ -174,26 +216,36 @@ func (c *cipher) DecryptHandshake(localKey cipherset.Key, p []byte) (cipherset.H
 	)
 
 	if cs3aLocalKey == nil {
+		out.Free()
 		return nil, cipherset.ErrInvalidState
 	}
 
+	defer wipe(macKey[:])
+	defer wipe(agreedKey[:])
+
 	copy(remoteLineKey[:], p[:lenKey])
 	copy(nonce[:], p[lenKey:lenKey+lenNonce])
 	copy(mac[:], p[lenKey+lenNonce+ctLen:])
 	ciphertext = p[lenKey+lenNonce : lenKey+lenNonce+ctLen]
 
 	// make agreedKey
-	box.Precompute(&agreedKey, &remoteLineKey, cs3aLocalKey.prv)
+	if !cs3aLocalKey.precompute(&agreedKey, &remoteLineKey) {
+		out.Free()
+		return nil, cipherset.ErrInvalidMessage
+	}
 
 	// decode BODY
 	outBuf, ok := box.OpenAfterPrecomputation(out.RawBytes(), ciphertext, &nonce, &agreedKey)
 	if !ok {
+		out.Free()
 		return nil, cipherset.ErrInvalidMessage
 	}
 	out.SetLen(len(outBuf))
 
 	{ // decode inner
 		inner, err := lob.Decode(out)
+		wipe(out.RawBytes())
+		out.Free()
 		if err != nil {
 			return nil, cipherset.ErrInvalidMessage
 		}
@@ -222,7 +274,9 @@ func (c *cipher) DecryptHandshake(localKey cipherset.Key, p []byte) (cipherset.H
 	}
 
 	{ // make macKey
-		box.Precompute(&macKey, &remoteKey, cs3aLocalKey.prv)
+		if !cs3aLocalKey.precompute(&macKey, &remoteKey) {
+			return nil, cipherset.ErrInvalidMessage
+		}
 
 		var (
 			sha = sha256.New()
@@ -254,6 +308,7 @@ type state struct {
 	nonce             *[lenNonce]byte
 	pktNoncePrefix    *[16]byte
 	pktNonceSuffix    uint64
+	wiped             bool
 }
 
 func (*state) CSID() uint8 { return 0x3a }
@@ -301,6 +356,9 @@ func (s *state) setRemoteLineKey(k *key) {
 }
 
 func (s *state) update() {
+	if s.wiped {
+		return
+	}
 
 	if s.nonce == nil {
 		s.nonce = new([lenNonce]byte)
@@ -319,8 +377,10 @@ func (s *state) update() {
 
 	// generate mac key base
 	if s.macKeyBase == nil && s.localKey.CanSign() && s.remoteKey.CanEncrypt() {
-		s.macKeyBase = new([lenKey]byte)
-		box.Precompute(s.macKeyBase, s.remoteKey.pub, s.localKey.prv)
+		macKeyBase := new([lenKey]byte)
+		if s.localKey.precompute(macKeyBase, s.remoteKey.pub) {
+			s.macKeyBase = macKeyBase
+		}
 	}
 
 	// make local token
@@ -342,6 +402,7 @@ func (s *state) update() {
 		(s.lineEncryptionKey == nil || s.lineDecryptionKey == nil) {
 		var sharedKey [lenKey]byte
 		box.Precompute(&sharedKey, s.remoteLineKey.pub, s.localLineKey.prv)
+		defer wipe(sharedKey[:])
 
 		sha := sha256.New()
 		s.lineEncryptionKey = new([lenKey]byte)
@@ -394,6 +455,7 @@ func (s *state) sign(sig, seq, p []byte) {
 
 	poly1305.Sum(&sum, p, key)
 	copy(sig, sum[:])
+	wipe(key[:])
 }
 
 func (s *state) verify(sig, seq, p []byte) bool {
@@ -411,7 +473,9 @@ func (s *state) verify(sig, seq, p []byte) bool {
 	}
 
 	copy(sum[:], sig)
-	return poly1305.Verify(&sum, p, key)
+	ok := poly1305.Verify(&sum, p, key)
+	wipe(key[:])
+	return ok
 }
 
 func (s *state) NeedsRemoteKey() bool {
@@ -443,6 +507,13 @@ func (s *state) CanDecryptPacket() bool {
 }
 
 func (s *state) EncryptMessage(in []byte) ([]byte, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if !s.CanEncryptMessage() {
+		return nil, cipherset.ErrInvalidState
+	}
+
 	var (
 		out       = bufpool.New().SetLen(lenKey + lenNonce + len(in) + box.Overhead + lenAuth)
 		raw       = out.RawBytes()
@@ -450,9 +521,7 @@ func (s *state) EncryptMessage(in []byte) ([]byte, error) {
 		ctLen     int
 	)
 
-	if !s.CanEncryptMessage() {
-		panic("unable to encrypt message")
-	}
+	defer wipe(agreedKey[:])
 
 	// copy public senderLineKey
 	copy(raw[:lenKey], (*s.localLineKey.pub)[:])
@@ -514,19 +583,10 @@ func (s *state) ApplyHandshake(h cipherset.Handshake) bool {
 
 func (s *state) EncryptPacket(pkt *lob.Packet) (*lob.Packet, error) {
 	s.mtx.RLock()
-	defer s.mtx.RUnlock()
+	ok := s.CanEncryptPacket()
+	s.mtx.RUnlock()
 
-	var (
-		outer   *lob.Packet
-		inner   *bufpool.Buffer
-		body    *bufpool.Buffer
-		bodyRaw []byte
-		nonce   [lenNonce]byte
-		ctLen   int
-		err     error
-	)
-
-	if !s.CanEncryptPacket() {
+	if !ok {
 		return nil, cipherset.ErrInvalidState
 	}
 	if pkt == nil {
@@ -534,43 +594,30 @@ func (s *state) EncryptPacket(pkt *lob.Packet) (*lob.Packet, error) {
 	}
 
 	// encode inner packet
-	inner, err = lob.Encode(pkt)
+	inner, err := lob.Encode(pkt)
 	if err != nil {
 		return nil, err
 	}
+	defer inner.Free()
+	defer wipe(inner.RawBytes())
 
-	// make nonce
-	copy(nonce[:], s.pktNoncePrefix[:])
-	nonceSuffix := atomic.AddUint64(&s.pktNonceSuffix, 1)
-	binary.BigEndian.PutUint64(nonce[16:], nonceSuffix)
-
-	// alloc enough space
-	body = bufpool.New().SetLen(lenToken + lenNonce + inner.Len() + box.Overhead)
-	bodyRaw = body.RawBytes()
-
-	// copy token
-	copy(bodyRaw[:lenToken], s.remoteToken[:])
-
-	// copy nonce
-	copy(bodyRaw[lenToken:lenToken+lenNonce], nonce[:])
-
-	// encrypt inner packet
-	ctLen = len(box.SealAfterPrecomputation(
-		bodyRaw[lenToken+lenNonce:lenToken+lenNonce], inner.RawBytes(), &nonce, s.lineEncryptionKey))
-	body.SetLen(lenToken + lenNonce + ctLen)
+	body := bufpool.New()
+	defer body.Free()
 
-	outer = lob.New(body.RawBytes())
-	inner.Free()
-	body.Free()
+	bodyRaw, err := s.SealPacket(body.RawBytes()[:0], inner.RawBytes())
+	if err != nil {
+		return nil, err
+	}
 
-	return outer, nil
+	return lob.New(bodyRaw), nil
 }
 
 func (s *state) DecryptPacket(pkt *lob.Packet) (*lob.Packet, error) {
 	s.mtx.RLock()
-	defer s.mtx.RUnlock()
+	ok := s.CanDecryptPacket()
+	s.mtx.RUnlock()
 
-	if !s.CanDecryptPacket() {
+	if !ok {
 		return nil, cipherset.ErrInvalidState
 	}
 	if pkt == nil {
@@ -582,55 +629,142 @@ func (s *state) DecryptPacket(pkt *lob.Packet) (*lob.Packet, error) {
 	}
 
 	var (
-		nonce    [lenNonce]byte
-		bodyRaw  []byte
-		innerRaw []byte
-		innerPkt *lob.Packet
-		body     = bufpool.New()
-		inner    = bufpool.New()
-		ok       bool
+		body  = bufpool.New()
+		inner = bufpool.New()
 	)
 
-	pkt.Body(body.SetLen(pkt.BodyLen()).RawBytes()[:0])
-	bodyRaw = body.RawBytes()
-	innerRaw = inner.RawBytes()
+	defer body.Free()
+	defer inner.Free()
+
+	innerRaw, err := s.OpenPacket(inner.RawBytes()[:0], pkt.Body(body.RawBytes()[:0]))
+	if err != nil {
+		return nil, err
+	}
+	inner.SetLen(len(innerRaw))
+
+	innerPkt, err := lob.Decode(inner)
+	wipe(inner.RawBytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return innerPkt, nil
+}
+
+func (s *state) PacketOverhead() int {
+	return lenToken + lenNonce + box.Overhead
+}
+
+func (s *state) SealPacket(dst, inner []byte) ([]byte, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if !s.CanEncryptPacket() {
+		return nil, cipherset.ErrInvalidState
+	}
+
+	var nonce [lenNonce]byte
+
+	// make nonce
+	copy(nonce[:], s.pktNoncePrefix[:])
+	nonceSuffix := atomic.AddUint64(&s.pktNonceSuffix, 1)
+	binary.BigEndian.PutUint64(nonce[16:], nonceSuffix)
+
+	// token and nonce
+	ret, out := sliceForAppend(dst, lenToken+lenNonce)
+	copy(out[:lenToken], s.remoteToken[:])
+	copy(out[lenToken:], nonce[:])
+
+	// encrypt inner packet
+	return box.SealAfterPrecomputation(ret, inner, &nonce, s.lineEncryptionKey), nil
+}
+
+func (s *state) OpenPacket(dst, body []byte) ([]byte, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if !s.CanDecryptPacket() {
+		return nil, cipherset.ErrInvalidState
+	}
+
+	if len(body) < lenToken+lenNonce {
+		return nil, cipherset.ErrInvalidPacket
+	}
 
 	// compare token
-	if !bytes.Equal(bodyRaw[:lenToken], (*s.localToken)[:]) {
-		inner.Free()
-		body.Free()
+	if subtle.ConstantTimeCompare(body[:lenToken], (*s.localToken)[:]) != 1 {
 		return nil, cipherset.ErrInvalidPacket
 	}
 
-	// copy nonce
-	copy(nonce[:], bodyRaw[lenToken:lenToken+lenNonce])
+	var nonce [lenNonce]byte
+	copy(nonce[:], body[lenToken:lenToken+lenNonce])
 
 	// decrypt inner packet
-	innerRaw, ok = box.OpenAfterPrecomputation(
-		innerRaw[:0], bodyRaw[lenToken+lenNonce:], &nonce, s.lineDecryptionKey)
+	inner, ok := box.OpenAfterPrecomputation(dst, body[lenToken+lenNonce:], &nonce, s.lineDecryptionKey)
 	if !ok {
-		inner.Free()
-		body.Free()
 		return nil, cipherset.ErrInvalidPacket
 	}
-	inner.SetLen(len(innerRaw))
 
-	innerPkt, err := lob.Decode(inner)
-	if err != nil {
-		inner.Free()
-		body.Free()
-		return nil, err
+	return inner, nil
+}
+
+// Wipe zeroes the line keys, the mac key and the nonces of the state. The
+// long-term local key is owned by the endpoint and is left untouched.
+// The state can't encrypt or decrypt packets after it was wiped.
+func (s *state) Wipe() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.wiped = true
+
+	if s.localLineKey != nil {
+		s.localLineKey.wipe()
+		s.localLineKey = nil
+	}
+	if s.macKeyBase != nil {
+		wipe(s.macKeyBase[:])
+		s.macKeyBase = nil
+	}
+	if s.lineEncryptionKey != nil {
+		wipe(s.lineEncryptionKey[:])
+		s.lineEncryptionKey = nil
+	}
+	if s.lineDecryptionKey != nil {
+		wipe(s.lineDecryptionKey[:])
+		s.lineDecryptionKey = nil
+	}
+	if s.nonce != nil {
+		wipe(s.nonce[:])
+		s.nonce = nil
+	}
+	if s.pktNoncePrefix != nil {
+		wipe(s.pktNoncePrefix[:])
+		s.pktNoncePrefix = nil
 	}
+}
 
-	inner.Free()
-	body.Free()
+// wipe zeroes b. It is used for all temporary copies of secret material.
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
 
-	return innerPkt, nil
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
 }
 
 type key struct {
 	pub *[32]byte
 	prv *[32]byte
+	dec cipherset.Decrypter
 }
 
 func makeKey(prv, pub *[lenKey]byte) *key {
@@ -650,7 +784,11 @@ func makeKey(prv, pub *[lenKey]byte) *key {
 }
 
 func generateKey() (*key, error) {
-	pub, prv, err := box.GenerateKey(rand.Reader)
+	return generateKeyFrom(rand.Reader)
+}
+
+func generateKeyFrom(r io.Reader) (*key, error) {
+	pub, prv, err := box.GenerateKey(r)
 	if err != nil {
 		return nil, err
 	}
@@ -685,7 +823,60 @@ func (k *key) String() string {
 }
 
 func (k *key) CanSign() bool {
-	return k != nil && k.prv != nil
+	return k != nil && (k.prv != nil || k.dec != nil)
+}
+
+// ECDH implements cipherset.Decrypter; it returns the X25519 shared secret.
+func (k *key) ECDH(peer []byte) ([]byte, error) {
+	if len(peer) != lenKey {
+		return nil, cipherset.ErrInvalidKey
+	}
+
+	if k.prv == nil {
+		if k.dec == nil {
+			return nil, cipherset.ErrInvalidState
+		}
+		return k.dec.ECDH(peer)
+	}
+
+	var (
+		dst [lenKey]byte
+		pub [lenKey]byte
+	)
+	copy(pub[:], peer)
+	curve25519.ScalarMult(&dst, k.prv, &pub)
+	return dst[:], nil
+}
+
+// precompute is box.Precompute for the private key of k. It returns false
+// when the Decrypter of k fails.
+func (k *key) precompute(dst, peer *[lenKey]byte) bool {
+	if k.prv != nil {
+		box.Precompute(dst, peer, k.prv)
+		return true
+	}
+
+	if k.dec == nil {
+		return false
+	}
+
+	shared, err := k.dec.ECDH(peer[:])
+	if err != nil || len(shared) != lenKey {
+		return false
+	}
+
+	var zeros [16]byte
+	copy(dst[:], shared)
+	wipe(shared)
+	salsa.HSalsa20(dst, &zeros, dst, &salsa.Sigma)
+	return true
+}
+
+func (k *key) wipe() {
+	if k.prv != nil {
+		wipe(k.prv[:])
+		k.prv = nil
+	}
 }
 
 func (k *key) CanEncrypt() bool {
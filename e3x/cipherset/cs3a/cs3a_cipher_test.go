@@ -1,9 +1,14 @@
 package cs3a
 
 import (
+	"bytes"
 	"testing"
 
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/e3x/cipherset"
 	"github.com/telehash/gogotelehash/e3x/cipherset/tests"
+	"github.com/telehash/gogotelehash/internal/lob"
 )
 
 func TestCipher(t *testing.T) {
@@ -17,3 +22,80 @@ func BenchmarkPacketEncryption(b *testing.B) {
 func BenchmarkPacketDecryption(b *testing.B) {
 	tests.BenchmarkPacketDecryption(b, &cipher{})
 }
+
+func BenchmarkSealPacket(b *testing.B) {
+	tests.BenchmarkSealPacket(b, &cipher{})
+}
+
+func BenchmarkOpenPacket(b *testing.B) {
+	tests.BenchmarkOpenPacket(b, &cipher{})
+}
+
+func TestWipe(t *testing.T) {
+	assert := assert.New(t)
+
+	ka, err := generateKey()
+	assert.NoError(err)
+	kb, err := generateKey()
+	assert.NoError(err)
+
+	csa, err := (&cipher{}).NewState(ka)
+	assert.NoError(err)
+	csb, err := (&cipher{}).NewState(kb)
+	assert.NoError(err)
+
+	sa, sb := csa.(*state), csb.(*state)
+	assert.NoError(sa.SetRemoteKey(kb))
+	assert.NoError(sb.SetRemoteKey(ka))
+
+	box, err := sa.EncryptHandshake(1, nil)
+	assert.NoError(err)
+	hb, err := (&cipher{}).DecryptHandshake(kb, box)
+	assert.NoError(err)
+	assert.True(sb.ApplyHandshake(hb))
+
+	box, err = sb.EncryptHandshake(1, nil)
+	assert.NoError(err)
+	ha, err := (&cipher{}).DecryptHandshake(ka, box)
+	assert.NoError(err)
+	assert.True(sa.ApplyHandshake(ha))
+
+	assert.True(sa.CanEncryptPacket())
+	assert.True(sa.CanDecryptPacket())
+
+	var (
+		lineKey = sa.localLineKey.prv
+		secrets = [][]byte{
+			lineKey[:],
+			sa.macKeyBase[:],
+			sa.lineEncryptionKey[:],
+			sa.lineDecryptionKey[:],
+			sa.nonce[:],
+			sa.pktNoncePrefix[:],
+		}
+		zero = make([]byte, lenKey)
+	)
+
+	sa.Wipe()
+
+	for _, secret := range secrets {
+		assert.True(bytes.Equal(zero[:len(secret)], secret), "secret was not wiped")
+	}
+
+	// the long-term key belongs to the endpoint
+	assert.True(ka.CanSign())
+
+	assert.False(sa.CanEncryptPacket())
+	assert.False(sa.CanDecryptPacket())
+	assert.False(sa.CanEncryptMessage())
+
+	_, err = sa.EncryptPacket(lob.New([]byte("hello")))
+	assert.Equal(cipherset.ErrInvalidState, err)
+
+	_, err = sa.EncryptHandshake(2, nil)
+	assert.Equal(cipherset.ErrInvalidState, err)
+
+	// handshakes don't restore the wiped keys
+	assert.True(sa.ApplyHandshake(ha))
+	assert.False(sa.CanEncryptPacket())
+}
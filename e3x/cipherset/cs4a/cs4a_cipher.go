@@ -0,0 +1,832 @@
+package cs4a
+
+import (
+	"bytes"
+	stdcipher "crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/golang.org/x/crypto/chacha20poly1305"
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/golang.org/x/crypto/curve25519"
+
+	"github.com/telehash/gogotelehash/e3x/cipherset"
+	"github.com/telehash/gogotelehash/internal/lob"
+	"github.com/telehash/gogotelehash/internal/util/base32util"
+	"github.com/telehash/gogotelehash/internal/util/bufpool"
+)
+
+var (
+	_ cipherset.Cipher    = (*cipher)(nil)
+	_ cipherset.Capable   = (*cipher)(nil)
+	_ cipherset.State     = (*state)(nil)
+	_ cipherset.Wiper     = (*state)(nil)
+	_ cipherset.Key       = (*key)(nil)
+	_ cipherset.Decrypter = (*key)(nil)
+
+	_ cipherset.DecrypterCipher = (*cipher)(nil)
+	_ cipherset.SeedCipher      = (*cipher)(nil)
+	_ cipherset.PacketSealer    = (*state)(nil)
+	_ cipherset.Handshake       = (*handshake)(nil)
+)
+
+const (
+	lenKey     = 32
+	lenToken   = 16
+	lenCounter = 8
+
+	lenAEADKey   = chacha20poly1305.KeySize
+	lenAEADNonce = chacha20poly1305.NonceSize
+	lenAEADTag   = chacha20poly1305.Overhead
+
+	// line key, ephemeral key, encrypted static key and the payload tag
+	lenMessageOverhead = lenKey + lenKey + (lenKey + lenAEADTag) + lenAEADTag
+)
+
+var prologue = []byte("telehash cs4a")
+
+func init() {
+	cipherset.Register(0x4a, &cipher{})
+}
+
+type cipher struct{}
+
+type handshake struct {
+	key     *key
+	lineKey *key
+	parts   cipherset.Parts
+	at      uint32
+}
+
+func (h *handshake) Parts() cipherset.Parts {
+	return h.parts
+}
+
+func (h *handshake) PublicKey() cipherset.Key {
+	return h.key
+}
+
+func (h *handshake) At() uint32 { return h.at }
+func (*handshake) CSID() uint8  { return 0x4a }
+func (*cipher) CSID() uint8     { return 0x4a }
+
+func (*cipher) Capabilities() cipherset.Capabilities {
+	return cipherset.Capabilities{
+		CanEncryptMessage: true,
+		TokenSize:         lenToken,
+		KeySize:           lenKey,
+	}
+}
+
+func (c *cipher) DecodeKeyBytes(pub, prv []byte) (cipherset.Key, error) {
+	var (
+		pubKey *[lenKey]byte
+		prvKey *[lenKey]byte
+	)
+
+	if len(pub) != 0 {
+		if len(pub) != lenKey {
+			return nil, cipherset.ErrInvalidKey
+		}
+		pubKey = new([lenKey]byte)
+		copy((*pubKey)[:], pub)
+	}
+
+	if len(prv) != 0 {
+		if len(prv) != lenKey {
+			return nil, cipherset.ErrInvalidKey
+		}
+		prvKey = new([lenKey]byte)
+		copy((*prvKey)[:], prv)
+	}
+
+	return &key{pub: pubKey, prv: prvKey}, nil
+}
+
+func (c *cipher) KeyFromDecrypter(d cipherset.Decrypter) (cipherset.Key, error) {
+	pub := d.Public()
+	if d.CSID() != 0x4a || len(pub) != lenKey {
+		return nil, cipherset.ErrInvalidKey
+	}
+
+	k := &key{pub: new([lenKey]byte), dec: d}
+	copy(k.pub[:], pub)
+	return k, nil
+}
+
+func (c *cipher) GenerateKey() (cipherset.Key, error) {
+	return generateKey()
+}
+
+func (c *cipher) GenerateKeyFromReader(r io.Reader) (cipherset.Key, error) {
+	return generateKeyFrom(r)
+}
+
+func (c *cipher) NewState(localKey cipherset.Key) (cipherset.State, error) {
+	if k, ok := localKey.(*key); ok && k != nil && k.CanEncrypt() && k.CanSign() {
+		s := &state{localKey: k}
+		s.update()
+		return s, nil
+	}
+	return nil, cipherset.ErrInvalidKey
+}
+
+func (c *cipher) DecryptMessage(localKey, remoteKey cipherset.Key, p []byte) ([]byte, error) {
+	var (
+		cs4aLocalKey, _  = localKey.(*key)
+		cs4aRemoteKey, _ = remoteKey.(*key)
+	)
+
+	if !cs4aLocalKey.CanSign() || !cs4aRemoteKey.CanEncrypt() {
+		return nil, cipherset.ErrInvalidState
+	}
+
+	rs, _, payload, err := readMessage(cs4aLocalKey, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare(rs[:], cs4aRemoteKey.pub[:]) != 1 {
+		return nil, cipherset.ErrInvalidMessage
+	}
+
+	return payload, nil
+}
+
+func (c *cipher) DecryptHandshake(localKey cipherset.Key, p []byte) (cipherset.Handshake, error) {
+	cs4aLocalKey, _ := localKey.(*key)
+	if !cs4aLocalKey.CanSign() {
+		return nil, cipherset.ErrInvalidState
+	}
+
+	rs, lineKey, payload, err := readMessage(cs4aLocalKey, p)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bufpool.New().Set(payload)
+	inner, err := lob.Decode(buf)
+	buf.Free()
+	if err != nil {
+		return nil, cipherset.ErrInvalidMessage
+	}
+
+	at, hasAt := inner.Header().GetUint32("at")
+	if !hasAt {
+		return nil, cipherset.ErrInvalidMessage
+	}
+
+	delete(inner.Header().Extra, "at")
+
+	parts, err := cipherset.PartsFromHeader(inner.Header())
+	if err != nil {
+		return nil, cipherset.ErrInvalidMessage
+	}
+
+	return &handshake{
+		key:     makeKey(nil, rs),
+		lineKey: makeKey(nil, lineKey),
+		parts:   parts,
+		at:      at,
+	}, nil
+}
+
+// writeMessage encrypts payload for the remote static key with
+// the first message of the IK pattern:
+//
+//	<- s
+//	...
+//	-> e, es, s, ss
+//
+// The line key is prepended to the Noise message and authenticated as part of the prologue.
+func writeMessage(localKey, remoteKey, lineKey *key, payload []byte) ([]byte, error) {
+	var (
+		out = make([]byte, 0, lenMessageOverhead+len(payload))
+		st  = newSymmetricState(prologue, lineKey.pub[:])
+		dh  [lenKey]byte
+	)
+
+	defer st.wipe()
+	defer wipe(dh[:])
+
+	ephemeral, err := generateKey()
+	if err != nil {
+		return nil, err
+	}
+	defer ephemeral.wipe()
+
+	out = append(out, lineKey.pub[:]...)
+
+	// <- s
+	st.mixHash(remoteKey.pub[:])
+
+	// -> e
+	st.mixHash(ephemeral.pub[:])
+	out = append(out, ephemeral.pub[:]...)
+
+	// -> es
+	if !x25519(&dh, ephemeral.prv, remoteKey.pub) {
+		return nil, cipherset.ErrInvalidKey
+	}
+	st.mixKey(dh[:])
+
+	// -> s
+	out, err = st.encryptAndHash(out, localKey.pub[:])
+	if err != nil {
+		return nil, err
+	}
+
+	// -> ss
+	if !localKey.dh(&dh, remoteKey.pub) {
+		return nil, cipherset.ErrInvalidKey
+	}
+	st.mixKey(dh[:])
+
+	return st.encryptAndHash(out, payload)
+}
+
+// readMessage decrypts a message that was made by writeMessage. It returns the
+// static key and the line key of the sender and the payload.
+func readMessage(localKey *key, p []byte) (rs, lineKey *[lenKey]byte, payload []byte, err error) {
+	if len(p) < lenMessageOverhead {
+		return nil, nil, nil, cipherset.ErrInvalidMessage
+	}
+
+	var (
+		re [lenKey]byte
+		dh [lenKey]byte
+		st *symmetricState
+		ok bool
+	)
+
+	defer wipe(dh[:])
+
+	lineKey = new([lenKey]byte)
+	copy(lineKey[:], p[:lenKey])
+	p = p[lenKey:]
+
+	st = newSymmetricState(prologue, lineKey[:])
+	defer st.wipe()
+
+	// <- s
+	st.mixHash(localKey.pub[:])
+
+	// -> e
+	copy(re[:], p[:lenKey])
+	st.mixHash(re[:])
+	p = p[lenKey:]
+
+	// -> es
+	if !localKey.dh(&dh, &re) {
+		return nil, nil, nil, cipherset.ErrInvalidMessage
+	}
+	st.mixKey(dh[:])
+
+	// -> s
+	rs = new([lenKey]byte)
+	_, ok = st.decryptAndHash(rs[:0], p[:lenKey+lenAEADTag])
+	if !ok {
+		return nil, nil, nil, cipherset.ErrInvalidMessage
+	}
+	p = p[lenKey+lenAEADTag:]
+
+	// -> ss
+	if !localKey.dh(&dh, rs) {
+		return nil, nil, nil, cipherset.ErrInvalidMessage
+	}
+	st.mixKey(dh[:])
+
+	payload, ok = st.decryptAndHash(nil, p)
+	if !ok {
+		return nil, nil, nil, cipherset.ErrInvalidMessage
+	}
+
+	return rs, lineKey, payload, nil
+}
+
+// x25519 computes the shared secret of prv and pub. It returns false when pub
+// is a low order point.
+func x25519(dst, prv, pub *[lenKey]byte) bool {
+	var zero [lenKey]byte
+	curve25519.ScalarMult(dst, prv, pub)
+	return subtle.ConstantTimeCompare(dst[:], zero[:]) != 1
+}
+
+type state struct {
+	mtx               sync.RWMutex
+	localKey          *key
+	remoteKey         *key
+	localLineKey      *key
+	remoteLineKey     *key
+	localToken        *cipherset.Token
+	remoteToken       *cipherset.Token
+	lineEncryptionKey *[lenAEADKey]byte
+	lineDecryptionKey *[lenAEADKey]byte
+	lineEncryption    stdcipher.AEAD
+	lineDecryption    stdcipher.AEAD
+	pktCounter        uint64
+	wiped             bool
+}
+
+func (*state) CSID() uint8 { return 0x4a }
+
+func (s *state) IsHigh() bool {
+	if s.localKey != nil && s.remoteKey != nil {
+		return bytes.Compare((*s.remoteKey.pub)[:], (*s.localKey.pub)[:]) < 0
+	}
+	return false
+}
+
+func (s *state) LocalToken() cipherset.Token {
+	if s.localToken != nil {
+		return *s.localToken
+	}
+	return cipherset.ZeroToken
+}
+
+func (s *state) RemoteToken() cipherset.Token {
+	if s.remoteToken != nil {
+		return *s.remoteToken
+	}
+	return cipherset.ZeroToken
+}
+
+func (s *state) SetRemoteKey(remoteKey cipherset.Key) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if k, ok := remoteKey.(*key); ok && k != nil && k.CanEncrypt() {
+		s.remoteKey = k
+		s.update()
+		return nil
+	}
+
+	return cipherset.ErrInvalidKey
+}
+
+func (s *state) setRemoteLineKey(k *key) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.remoteLineKey = k
+	s.update()
+}
+
+func (s *state) update() {
+	if s.wiped {
+		return
+	}
+
+	// generate a local line Key
+	if s.localLineKey == nil {
+		s.localLineKey, _ = generateKey()
+	}
+
+	// make local token
+	if s.localToken == nil && s.localLineKey != nil {
+		s.localToken = makeToken(s.localLineKey)
+	}
+
+	// make remote token
+	if s.remoteToken == nil && s.remoteLineKey != nil {
+		s.remoteToken = makeToken(s.remoteLineKey)
+	}
+
+	// generate line keys
+	if s.localToken != nil && s.remoteToken != nil &&
+		(s.lineEncryptionKey == nil || s.lineDecryptionKey == nil) {
+		var sharedKey [lenKey]byte
+		if !x25519(&sharedKey, s.localLineKey.prv, s.remoteLineKey.pub) {
+			return
+		}
+		defer wipe(sharedKey[:])
+
+		sha := sha256.New()
+		s.lineEncryptionKey = new([lenAEADKey]byte)
+		sha.Write(sharedKey[:])
+		sha.Write(s.localLineKey.pub[:])
+		sha.Write(s.remoteLineKey.pub[:])
+		sha.Sum((*s.lineEncryptionKey)[:0])
+
+		sha.Reset()
+		s.lineDecryptionKey = new([lenAEADKey]byte)
+		sha.Write(sharedKey[:])
+		sha.Write(s.remoteLineKey.pub[:])
+		sha.Write(s.localLineKey.pub[:])
+		sha.Sum((*s.lineDecryptionKey)[:0])
+
+		s.lineEncryption, _ = chacha20poly1305.New(s.lineEncryptionKey[:])
+		s.lineDecryption, _ = chacha20poly1305.New(s.lineDecryptionKey[:])
+	}
+}
+
+// makeToken derives the token of a line key the same way
+// cipherset.ExtractToken does for handshakes.
+func makeToken(lineKey *key) *cipherset.Token {
+	token := new(cipherset.Token)
+	sha := sha256.Sum256((*lineKey.pub)[:lenToken])
+	copy((*token)[:], sha[:lenToken])
+	return token
+}
+
+func (s *state) NeedsRemoteKey() bool {
+	return s.remoteKey == nil
+}
+
+func (s *state) CanEncryptMessage() bool {
+	return s.localKey != nil && s.remoteKey != nil && s.localLineKey != nil
+}
+
+func (s *state) CanEncryptHandshake() bool {
+	return s.CanEncryptMessage()
+}
+
+func (s *state) CanEncryptPacket() bool {
+	return s.lineEncryption != nil && s.remoteToken != nil
+}
+
+func (s *state) CanDecryptMessage() bool {
+	return s.localKey != nil && s.remoteKey != nil && s.localLineKey != nil
+}
+
+func (s *state) CanDecryptHandshake() bool {
+	return s.localKey != nil && s.localLineKey != nil
+}
+
+func (s *state) CanDecryptPacket() bool {
+	return s.lineDecryption != nil && s.localToken != nil
+}
+
+func (s *state) EncryptMessage(in []byte) ([]byte, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if !s.CanEncryptMessage() {
+		return nil, cipherset.ErrInvalidState
+	}
+
+	return writeMessage(s.localKey, s.remoteKey, s.localLineKey, in)
+}
+
+func (s *state) EncryptHandshake(at uint32, compact cipherset.Parts) ([]byte, error) {
+	pkt := lob.New(nil)
+	compact.ApplyToHeader(pkt.Header())
+	pkt.Header().SetUint32("at", at)
+	data, err := lob.Encode(pkt)
+	if err != nil {
+		return nil, err
+	}
+	return s.EncryptMessage(data.Get(nil))
+}
+
+func (s *state) ApplyHandshake(h cipherset.Handshake) bool {
+	var (
+		hs, _ = h.(*handshake)
+	)
+
+	if hs == nil {
+		return false
+	}
+
+	if s.remoteKey != nil && *s.remoteKey.pub != *hs.key.pub {
+		return false
+	}
+
+	if s.remoteLineKey != nil && *s.remoteLineKey.pub != *hs.lineKey.pub {
+		s.mtx.Lock()
+		s.remoteLineKey = nil
+		s.remoteToken = nil
+		s.lineDecryptionKey = nil
+		s.lineEncryptionKey = nil
+		s.mtx.Unlock()
+	}
+
+	s.setRemoteLineKey(hs.lineKey)
+	if s.remoteKey == nil {
+		s.SetRemoteKey(hs.key)
+	}
+	return true
+}
+
+func (s *state) EncryptPacket(pkt *lob.Packet) (*lob.Packet, error) {
+	s.mtx.RLock()
+	ok := s.CanEncryptPacket()
+	s.mtx.RUnlock()
+
+	if !ok {
+		return nil, cipherset.ErrInvalidState
+	}
+	if pkt == nil {
+		return nil, nil
+	}
+
+	// encode inner packet
+	inner, err := lob.Encode(pkt)
+	if err != nil {
+		return nil, err
+	}
+	defer inner.Free()
+	defer wipe(inner.RawBytes())
+
+	body := bufpool.New()
+	defer body.Free()
+
+	bodyRaw, err := s.SealPacket(body.RawBytes()[:0], inner.RawBytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return lob.New(bodyRaw), nil
+}
+
+func (s *state) DecryptPacket(pkt *lob.Packet) (*lob.Packet, error) {
+	s.mtx.RLock()
+	ok := s.CanDecryptPacket()
+	s.mtx.RUnlock()
+
+	if !ok {
+		return nil, cipherset.ErrInvalidState
+	}
+	if pkt == nil {
+		return nil, nil
+	}
+
+	if !pkt.Header().IsZero() || pkt.BodyLen() < lenToken+lenCounter+lenAEADTag {
+		return nil, cipherset.ErrInvalidPacket
+	}
+
+	var (
+		body  = bufpool.New()
+		inner = bufpool.New()
+	)
+
+	defer body.Free()
+	defer inner.Free()
+
+	innerRaw, err := s.OpenPacket(inner.RawBytes()[:0], pkt.Body(body.RawBytes()[:0]))
+	if err != nil {
+		return nil, err
+	}
+	inner.SetLen(len(innerRaw))
+
+	innerPkt, err := lob.Decode(inner)
+	wipe(inner.RawBytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return innerPkt, nil
+}
+
+// noncePool holds the packet nonces; they escape through the AEAD interface.
+var noncePool = sync.Pool{
+	New: func() interface{} { return new([lenAEADNonce]byte) },
+}
+
+func (s *state) PacketOverhead() int {
+	return lenToken + lenCounter + lenAEADTag
+}
+
+func (s *state) SealPacket(dst, inner []byte) ([]byte, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if !s.CanEncryptPacket() {
+		return nil, cipherset.ErrInvalidState
+	}
+
+	nonce := noncePool.Get().(*[lenAEADNonce]byte)
+	defer noncePool.Put(nonce)
+
+	counter := atomic.AddUint64(&s.pktCounter, 1)
+	binary.BigEndian.PutUint64(nonce[4:], counter)
+
+	ret, out := sliceForAppend(dst, lenToken+lenCounter)
+	copy(out[:lenToken], s.remoteToken[:])
+	copy(out[lenToken:], nonce[4:])
+
+	return s.lineEncryption.Seal(ret, nonce[:], inner, out[:lenToken]), nil
+}
+
+func (s *state) OpenPacket(dst, body []byte) ([]byte, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if !s.CanDecryptPacket() {
+		return nil, cipherset.ErrInvalidState
+	}
+
+	if len(body) < lenToken+lenCounter+lenAEADTag {
+		return nil, cipherset.ErrInvalidPacket
+	}
+
+	// compare token
+	if subtle.ConstantTimeCompare(body[:lenToken], (*s.localToken)[:]) != 1 {
+		return nil, cipherset.ErrInvalidPacket
+	}
+
+	nonce := noncePool.Get().(*[lenAEADNonce]byte)
+	defer noncePool.Put(nonce)
+
+	copy(nonce[4:], body[lenToken:lenToken+lenCounter])
+
+	inner, err := s.lineDecryption.Open(dst, nonce[:],
+		body[lenToken+lenCounter:], body[:lenToken])
+	if err != nil {
+		return nil, cipherset.ErrInvalidPacket
+	}
+
+	return inner, nil
+}
+
+// Wipe zeroes the line keys of the state. The long-term local key is owned by
+// the endpoint and is left untouched.
+func (s *state) Wipe() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.wiped = true
+
+	if s.localLineKey != nil {
+		s.localLineKey.wipe()
+		s.localLineKey = nil
+	}
+	if s.lineEncryptionKey != nil {
+		wipe(s.lineEncryptionKey[:])
+		s.lineEncryptionKey = nil
+	}
+	if s.lineDecryptionKey != nil {
+		wipe(s.lineDecryptionKey[:])
+		s.lineDecryptionKey = nil
+	}
+	s.lineEncryption = nil
+	s.lineDecryption = nil
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// aeadSeal appends the ChaCha20-Poly1305 (RFC 7539) encryption of plaintext
+// to dst and returns the resulting slice.
+func aeadSeal(dst []byte, key *[lenAEADKey]byte, nonce *[lenAEADNonce]byte, plaintext, ad []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(dst, nonce[:], plaintext, ad), nil
+}
+
+// aeadOpen appends the decryption of ciphertext to dst. It returns false when
+// the ciphertext was not authentic.
+func aeadOpen(dst []byte, key *[lenAEADKey]byte, nonce *[lenAEADNonce]byte, ciphertext, ad []byte) ([]byte, bool) {
+	aead, err := chacha20poly1305.New(key[:])
+	if err != nil {
+		return nil, false
+	}
+	out, err := aead.Open(dst, nonce[:], ciphertext, ad)
+	return out, err == nil
+}
+
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
+
+type key struct {
+	pub *[32]byte
+	prv *[32]byte
+	dec cipherset.Decrypter
+}
+
+func makeKey(prv, pub *[lenKey]byte) *key {
+	if prv != nil {
+		prvCopy := new([lenKey]byte)
+		copy((*prvCopy)[:], (*prv)[:])
+		prv = prvCopy
+	}
+
+	if pub != nil {
+		pubCopy := new([lenKey]byte)
+		copy((*pubCopy)[:], (*pub)[:])
+		pub = pubCopy
+	}
+
+	return &key{pub: pub, prv: prv}
+}
+
+func generateKey() (*key, error) {
+	return generateKeyFrom(rand.Reader)
+}
+
+func generateKeyFrom(r io.Reader) (*key, error) {
+	var (
+		pub = new([lenKey]byte)
+		prv = new([lenKey]byte)
+	)
+
+	_, err := io.ReadFull(r, prv[:])
+	if err != nil {
+		return nil, err
+	}
+
+	curve25519.ScalarBaseMult(pub, prv)
+
+	return &key{pub: pub, prv: prv}, nil
+}
+
+func (k *key) CSID() uint8 { return 0x4a }
+
+func (k *key) Public() []byte {
+	if k == nil || k.pub == nil {
+		return nil
+	}
+
+	buf := make([]byte, lenKey)
+	copy(buf, (*k.pub)[:])
+	return buf
+}
+
+func (k *key) Private() []byte {
+	if k == nil || k.prv == nil {
+		return nil
+	}
+
+	buf := make([]byte, lenKey)
+	copy(buf, (*k.prv)[:])
+	return buf
+}
+
+func (k *key) String() string {
+	return base32util.EncodeToString((*k.pub)[:])
+}
+
+func (k *key) CanSign() bool {
+	return k != nil && (k.prv != nil || k.dec != nil)
+}
+
+// ECDH implements cipherset.Decrypter; it returns the X25519 shared secret.
+func (k *key) ECDH(peer []byte) ([]byte, error) {
+	if len(peer) != lenKey {
+		return nil, cipherset.ErrInvalidKey
+	}
+
+	if k.prv == nil {
+		if k.dec == nil {
+			return nil, cipherset.ErrInvalidState
+		}
+		return k.dec.ECDH(peer)
+	}
+
+	var (
+		dst [lenKey]byte
+		pub [lenKey]byte
+	)
+	copy(pub[:], peer)
+	curve25519.ScalarMult(&dst, k.prv, &pub)
+	return dst[:], nil
+}
+
+// dh is x25519 for the private key of k.
+func (k *key) dh(dst, pub *[lenKey]byte) bool {
+	if k.prv != nil {
+		return x25519(dst, k.prv, pub)
+	}
+
+	if k.dec == nil {
+		return false
+	}
+
+	shared, err := k.dec.ECDH(pub[:])
+	if err != nil || len(shared) != lenKey {
+		return false
+	}
+
+	var zero [lenKey]byte
+	copy(dst[:], shared)
+	wipe(shared)
+	return subtle.ConstantTimeCompare(dst[:], zero[:]) != 1
+}
+
+func (k *key) CanEncrypt() bool {
+	return k != nil && k.pub != nil
+}
+
+func (k *key) wipe() {
+	if k.prv != nil {
+		wipe(k.prv[:])
+		k.prv = nil
+	}
+}
@@ -0,0 +1,93 @@
+package cs4a
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/e3x/cipherset"
+	"github.com/telehash/gogotelehash/e3x/cipherset/tests"
+)
+
+func TestCipher(t *testing.T) {
+	tests.Run(t, &cipher{})
+}
+
+// Test vector from RFC 7539 section 2.8.2
+func TestAEAD(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		key       [lenAEADKey]byte
+		nonce     [lenAEADNonce]byte
+		ad, _     = hex.DecodeString("50515253c0c1c2c3c4c5c6c7")
+		plaintext = []byte("Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")
+		expected  = "d31a8d34648e60db7b86afbc53ef7ec2a4aded51296e08fea9e2b5a736ee62d6" +
+			"3dbea45e8ca9671282fafb69da92728b1a71de0a9e060b2905d6a5b67ecd3b36" +
+			"92ddbd7f2d778b8c9803aee328091b58fab324e4fad675945585808b4831d7bc" +
+			"3ff4def08e4b7a9de576d26586cec64b6116" +
+			"1ae10b594f09e26a7e902ecbd0600691"
+	)
+
+	for i := range key {
+		key[i] = byte(0x80 + i)
+	}
+	copy(nonce[:], []byte{0x07, 0x00, 0x00, 0x00, 0x40, 0x41, 0x42, 0x43, 0x44, 0x45, 0x46, 0x47})
+
+	box, err := aeadSeal(nil, &key, &nonce, plaintext, ad)
+	assert.NoError(err)
+	assert.Equal(expected, hex.EncodeToString(box))
+
+	out, ok := aeadOpen(nil, &key, &nonce, box, ad)
+	assert.True(ok)
+	assert.True(bytes.Equal(plaintext, out))
+
+	box[0] ^= 0x01
+	_, ok = aeadOpen(nil, &key, &nonce, box, ad)
+	assert.False(ok)
+}
+
+func TestMessageSender(t *testing.T) {
+	assert := assert.New(t)
+
+	ka, _ := generateKey()
+	kb, _ := generateKey()
+	kc, _ := generateKey()
+
+	sa, err := (&cipher{}).NewState(ka)
+	assert.NoError(err)
+	assert.NoError(sa.SetRemoteKey(kb))
+
+	box, err := sa.EncryptMessage([]byte("Hello World!"))
+	assert.NoError(err)
+
+	msg, err := (&cipher{}).DecryptMessage(kb, ka, box)
+	assert.NoError(err)
+	assert.True(bytes.Equal([]byte("Hello World!"), msg))
+
+	// the sender is authenticated by the static keys
+	_, err = (&cipher{}).DecryptMessage(kb, kc, box)
+	assert.Equal(cipherset.ErrInvalidMessage, err)
+
+	// only the recipient can decrypt the message
+	_, err = (&cipher{}).DecryptMessage(kc, ka, box)
+	assert.Equal(cipherset.ErrInvalidMessage, err)
+}
+
+func BenchmarkPacketEncryption(b *testing.B) {
+	tests.BenchmarkPacketEncryption(b, &cipher{})
+}
+
+func BenchmarkPacketDecryption(b *testing.B) {
+	tests.BenchmarkPacketDecryption(b, &cipher{})
+}
+
+func BenchmarkSealPacket(b *testing.B) {
+	tests.BenchmarkSealPacket(b, &cipher{})
+}
+
+func BenchmarkOpenPacket(b *testing.B) {
+	tests.BenchmarkOpenPacket(b, &cipher{})
+}
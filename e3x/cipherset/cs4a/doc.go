@@ -0,0 +1,18 @@
+// Package cs4a implements an experimental Cipher Set based on the Noise
+// protocol framework.
+//
+// CS4a is not part of the telehash specification. Both peers must import this
+// package (it is not registered by default).
+//
+// Handshakes are the first message of Noise_IK_25519_ChaChaPoly_SHA256 (the
+// remote static key is always known in telehash, so the XX pattern is never
+// needed). The payload of the handshake carries the sender's line key, which
+// is also sent in the clear in front of the Noise message so that the token of
+// the handshake can be extracted without decrypting it. Both line keys are
+// combined to derive the ChaCha20-Poly1305 keys used for channel packets.
+//
+// Reference
+//
+// Noise: https://noiseprotocol.org/noise.html
+// ChaCha20-Poly1305: https://tools.ietf.org/html/rfc7539
+package cs4a
@@ -0,0 +1,107 @@
+package cs4a
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// The name is exactly 32 bytes long so it is used as the initial hash as is.
+const protocolName = "Noise_IK_25519_ChaChaPoly_SHA256"
+
+// symmetricState is the SymmetricState object of the Noise specification
+// (section 5.2) with the CipherState folded in.
+type symmetricState struct {
+	ck     [32]byte
+	h      [32]byte
+	k      [lenAEADKey]byte
+	hasKey bool
+	n      uint64
+}
+
+func newSymmetricState(prologue ...[]byte) *symmetricState {
+	s := &symmetricState{}
+	copy(s.h[:], protocolName)
+	s.ck = s.h
+	s.mixHash(prologue...)
+	return s
+}
+
+func (s *symmetricState) mixHash(data ...[]byte) {
+	sha := sha256.New()
+	sha.Write(s.h[:])
+	for _, d := range data {
+		sha.Write(d)
+	}
+	sha.Sum(s.h[:0])
+}
+
+func (s *symmetricState) mixKey(ikm []byte) {
+	hkdf(&s.ck, &s.k, &s.ck, ikm)
+	s.hasKey = true
+	s.n = 0
+}
+
+func (s *symmetricState) encryptAndHash(dst, plaintext []byte) ([]byte, error) {
+	if !s.hasKey {
+		s.mixHash(plaintext)
+		return append(dst, plaintext...), nil
+	}
+
+	var nonce [lenAEADNonce]byte
+	binary.LittleEndian.PutUint64(nonce[4:], s.n)
+	s.n++
+
+	out, err := aeadSeal(dst, &s.k, &nonce, plaintext, s.h[:])
+	if err != nil {
+		return nil, err
+	}
+
+	s.mixHash(out[len(dst):])
+	return out, nil
+}
+
+func (s *symmetricState) decryptAndHash(dst, ciphertext []byte) ([]byte, bool) {
+	if !s.hasKey {
+		s.mixHash(ciphertext)
+		return append(dst, ciphertext...), true
+	}
+
+	var nonce [lenAEADNonce]byte
+	binary.LittleEndian.PutUint64(nonce[4:], s.n)
+	s.n++
+
+	out, ok := aeadOpen(dst, &s.k, &nonce, ciphertext, s.h[:])
+	if !ok {
+		return nil, false
+	}
+
+	s.mixHash(ciphertext)
+	return out, true
+}
+
+func (s *symmetricState) wipe() {
+	wipe(s.ck[:])
+	wipe(s.k[:])
+	s.hasKey = false
+}
+
+// hkdf derives two keys from ck and ikm (Noise section 4.3).
+func hkdf(out1, out2, ck *[32]byte, ikm []byte) {
+	var tempKey [32]byte
+
+	mac := hmac.New(sha256.New, ck[:])
+	mac.Write(ikm)
+	mac.Sum(tempKey[:0])
+
+	mac = hmac.New(sha256.New, tempKey[:])
+	mac.Write([]byte{0x01})
+	mac.Sum(out1[:0])
+
+	mac = hmac.New(sha256.New, tempKey[:])
+	mac.Write(out1[:])
+	mac.Write([]byte{0x02})
+	mac.Sum(out2[:0])
+
+	wipe(tempKey[:])
+}
@@ -0,0 +1,966 @@
+//go:build pq
+// +build pq
+
+package cs5a
+
+import (
+	"bytes"
+	"crypto/aes"
+	stdcipher "crypto/cipher"
+	"crypto/mlkem"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/golang.org/x/crypto/curve25519"
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/golang.org/x/crypto/poly1305"
+
+	"github.com/telehash/gogotelehash/e3x/cipherset"
+	"github.com/telehash/gogotelehash/internal/lob"
+	"github.com/telehash/gogotelehash/internal/util/base32util"
+	"github.com/telehash/gogotelehash/internal/util/bufpool"
+)
+
+var (
+	_ cipherset.Cipher    = (*cipher)(nil)
+	_ cipherset.Capable   = (*cipher)(nil)
+	_ cipherset.State     = (*state)(nil)
+	_ cipherset.Wiper     = (*state)(nil)
+	_ cipherset.Key       = (*key)(nil)
+	_ cipherset.Decrypter = (*key)(nil)
+
+	_ cipherset.DecrypterCipher = (*cipher)(nil)
+	_ cipherset.SeedCipher      = (*cipher)(nil)
+	_ cipherset.PacketSealer    = (*state)(nil)
+	_ cipherset.Handshake       = (*handshake)(nil)
+)
+
+const (
+	lenKey     = 32
+	lenNonce   = 12
+	lenAuth    = 16
+	lenToken   = 16
+	lenCounter = 8
+
+	lenKEMKey        = mlkem.EncapsulationKeySize768
+	lenKEMCiphertext = mlkem.CiphertextSize768
+)
+
+// The KEM field of a message either holds the encapsulation key of the sender
+// or a ciphertext encapsulated to the encapsulation key of the receiver.
+const (
+	kemEncapsulationKey uint8 = 1
+	kemCiphertext       uint8 = 2
+)
+
+var label = []byte("telehash cs5a")
+
+func init() {
+	cipherset.Register(0x5a, &cipher{})
+}
+
+type cipher struct{}
+
+type handshake struct {
+	key     *key
+	lineKey *key
+	kemType uint8
+	kemData []byte
+	parts   cipherset.Parts
+	at      uint32
+}
+
+func (h *handshake) Parts() cipherset.Parts {
+	return h.parts
+}
+
+func (h *handshake) PublicKey() cipherset.Key {
+	return h.key
+}
+
+func (h *handshake) At() uint32 { return h.at }
+func (*handshake) CSID() uint8  { return 0x5a }
+func (*cipher) CSID() uint8     { return 0x5a }
+
+func (*cipher) Capabilities() cipherset.Capabilities {
+	return cipherset.Capabilities{
+		CanEncryptMessage: true,
+		TokenSize:         lenToken,
+		KeySize:           lenKey,
+	}
+}
+
+func (c *cipher) DecodeKeyBytes(pub, prv []byte) (cipherset.Key, error) {
+	var (
+		pubKey *[lenKey]byte
+		prvKey *[lenKey]byte
+	)
+
+	if len(pub) != 0 {
+		if len(pub) != lenKey {
+			return nil, cipherset.ErrInvalidKey
+		}
+		pubKey = new([lenKey]byte)
+		copy((*pubKey)[:], pub)
+	}
+
+	if len(prv) != 0 {
+		if len(prv) != lenKey {
+			return nil, cipherset.ErrInvalidKey
+		}
+		prvKey = new([lenKey]byte)
+		copy((*prvKey)[:], prv)
+	}
+
+	return &key{pub: pubKey, prv: prvKey}, nil
+}
+
+func (c *cipher) KeyFromDecrypter(d cipherset.Decrypter) (cipherset.Key, error) {
+	pub := d.Public()
+	if d.CSID() != 0x5a || len(pub) != lenKey {
+		return nil, cipherset.ErrInvalidKey
+	}
+
+	k := &key{pub: new([lenKey]byte), dec: d}
+	copy(k.pub[:], pub)
+	return k, nil
+}
+
+func (c *cipher) GenerateKey() (cipherset.Key, error) {
+	return generateKey()
+}
+
+func (c *cipher) GenerateKeyFromReader(r io.Reader) (cipherset.Key, error) {
+	return generateKeyFrom(r)
+}
+
+func (c *cipher) NewState(localKey cipherset.Key) (cipherset.State, error) {
+	if k, ok := localKey.(*key); ok && k != nil && k.CanEncrypt() && k.CanSign() {
+		s := &state{localKey: k}
+		s.update()
+		return s, nil
+	}
+	return nil, cipherset.ErrInvalidKey
+}
+
+func (c *cipher) DecryptMessage(localKey, remoteKey cipherset.Key, p []byte) ([]byte, error) {
+	var (
+		cs5aLocalKey, _  = localKey.(*key)
+		cs5aRemoteKey, _ = remoteKey.(*key)
+	)
+
+	if !cs5aLocalKey.CanSign() || !cs5aRemoteKey.CanEncrypt() {
+		return nil, cipherset.ErrInvalidState
+	}
+
+	m, err := openMessage(cs5aLocalKey, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if !verifyMessage(cs5aLocalKey, cs5aRemoteKey, p) {
+		return nil, cipherset.ErrInvalidMessage
+	}
+
+	return m.payload, nil
+}
+
+func (c *cipher) DecryptHandshake(localKey cipherset.Key, p []byte) (cipherset.Handshake, error) {
+	cs5aLocalKey, _ := localKey.(*key)
+	if !cs5aLocalKey.CanSign() {
+		return nil, cipherset.ErrInvalidState
+	}
+
+	m, err := openMessage(cs5aLocalKey, p)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bufpool.New().Set(m.payload)
+	inner, err := lob.Decode(buf)
+	wipe(m.payload)
+	buf.Free()
+	if err != nil {
+		return nil, cipherset.ErrInvalidMessage
+	}
+
+	at, hasAt := inner.Header().GetUint32("at")
+	if !hasAt {
+		return nil, cipherset.ErrInvalidMessage
+	}
+
+	delete(inner.Header().Extra, "at")
+
+	parts, err := cipherset.PartsFromHeader(inner.Header())
+	if err != nil {
+		return nil, cipherset.ErrInvalidMessage
+	}
+
+	if inner.BodyLen() != lenKey {
+		return nil, cipherset.ErrInvalidMessage
+	}
+
+	var remoteKey [lenKey]byte
+	inner.Body(remoteKey[:0])
+	sender := makeKey(nil, &remoteKey)
+
+	if !verifyMessage(cs5aLocalKey, sender, p) {
+		return nil, cipherset.ErrInvalidMessage
+	}
+
+	return &handshake{
+		key:     sender,
+		lineKey: makeKey(nil, m.lineKey),
+		kemType: m.kemType,
+		kemData: m.kemData,
+		parts:   parts,
+		at:      at,
+	}, nil
+}
+
+// message is a decrypted message:
+//
+//	LINE KEY (32) | NONCE (12) | KEM TYPE (1) | KEM DATA | CIPHERTEXT | MAC (16)
+//
+// The ciphertext is sealed with AES-256-GCM using a key derived from the
+// sender line key and the receiver key; the rest of the header is the
+// additional data. The MAC is a Poly1305 tag over everything before it, keyed
+// with the nonce and the shared secret of both static keys.
+type message struct {
+	lineKey *[lenKey]byte
+	kemType uint8
+	kemData []byte
+	payload []byte
+}
+
+func sealMessage(localKey, remoteKey, lineKey *key, kemType uint8, kemData, payload []byte) ([]byte, error) {
+	var (
+		lenHeader = lenKey + lenNonce + 1 + len(kemData)
+		out       = make([]byte, lenHeader, lenHeader+len(payload)+2*lenAuth)
+		nonce     = out[lenKey : lenKey+lenNonce]
+		aeadKey   [lenKey]byte
+		sharedKey [lenKey]byte
+	)
+
+	defer wipe(aeadKey[:])
+	defer wipe(sharedKey[:])
+
+	copy(out, lineKey.pub[:])
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	out[lenKey+lenNonce] = kemType
+	copy(out[lenKey+lenNonce+1:], kemData)
+
+	if !x25519(&sharedKey, lineKey.prv, remoteKey.pub) {
+		return nil, cipherset.ErrInvalidKey
+	}
+	deriveKey(&aeadKey, sharedKey[:], lineKey.pub[:], remoteKey.pub[:])
+
+	aead, err := newAEAD(&aeadKey)
+	if err != nil {
+		return nil, err
+	}
+	out = aead.Seal(out, nonce, payload, out[:lenHeader])
+
+	if !localKey.dh(&sharedKey, remoteKey.pub) {
+		return nil, cipherset.ErrInvalidKey
+	}
+	var mac [lenAuth]byte
+	macKey := makeMACKey(nonce, &sharedKey)
+	poly1305.Sum(&mac, out, macKey)
+	wipe(macKey[:])
+
+	return append(out, mac[:]...), nil
+}
+
+// openMessage decrypts p. The MAC is not verified as the sender key of a
+// handshake is only known after decryption; callers must call verifyMessage.
+func openMessage(localKey *key, p []byte) (*message, error) {
+	if len(p) < lenKey+lenNonce+1+lenAuth+lenAuth {
+		return nil, cipherset.ErrInvalidMessage
+	}
+
+	var (
+		m         = &message{lineKey: new([lenKey]byte)}
+		lenHeader = lenKey + lenNonce + 1
+		aeadKey   [lenKey]byte
+		sharedKey [lenKey]byte
+	)
+
+	defer wipe(aeadKey[:])
+	defer wipe(sharedKey[:])
+
+	copy(m.lineKey[:], p[:lenKey])
+	m.kemType = p[lenKey+lenNonce]
+
+	switch m.kemType {
+	case kemEncapsulationKey:
+		lenHeader += lenKEMKey
+	case kemCiphertext:
+		lenHeader += lenKEMCiphertext
+	default:
+		return nil, cipherset.ErrInvalidMessage
+	}
+
+	if len(p) < lenHeader+lenAuth+lenAuth {
+		return nil, cipherset.ErrInvalidMessage
+	}
+
+	m.kemData = make([]byte, lenHeader-(lenKey+lenNonce+1))
+	copy(m.kemData, p[lenKey+lenNonce+1:lenHeader])
+
+	if !localKey.dh(&sharedKey, m.lineKey) {
+		return nil, cipherset.ErrInvalidMessage
+	}
+	deriveKey(&aeadKey, sharedKey[:], m.lineKey[:], localKey.pub[:])
+
+	aead, err := newAEAD(&aeadKey)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := aead.Open(nil, p[lenKey:lenKey+lenNonce], p[lenHeader:len(p)-lenAuth], p[:lenHeader])
+	if err != nil {
+		return nil, cipherset.ErrInvalidMessage
+	}
+	m.payload = payload
+
+	return m, nil
+}
+
+// verifyMessage checks that p was sent by remoteKey.
+func verifyMessage(localKey, remoteKey *key, p []byte) bool {
+	var (
+		mac       [lenAuth]byte
+		sharedKey [lenKey]byte
+	)
+
+	defer wipe(sharedKey[:])
+
+	if !localKey.dh(&sharedKey, remoteKey.pub) {
+		return false
+	}
+
+	copy(mac[:], p[len(p)-lenAuth:])
+	macKey := makeMACKey(p[lenKey:lenKey+lenNonce], &sharedKey)
+	ok := poly1305.Verify(&mac, p[:len(p)-lenAuth], macKey)
+	wipe(macKey[:])
+	return ok
+}
+
+func deriveKey(dst *[lenKey]byte, sharedKey, senderKey, receiverKey []byte) {
+	sha := sha256.New()
+	sha.Write(label)
+	sha.Write(sharedKey)
+	sha.Write(senderKey)
+	sha.Write(receiverKey)
+	sha.Sum(dst[:0])
+}
+
+func makeMACKey(nonce []byte, sharedKey *[lenKey]byte) *[lenKey]byte {
+	var (
+		macKey = new([lenKey]byte)
+		sha    = sha256.New()
+	)
+	sha.Write(nonce)
+	sha.Write(sharedKey[:])
+	sha.Sum(macKey[:0])
+	return macKey
+}
+
+func newAEAD(k *[lenKey]byte) (stdcipher.AEAD, error) {
+	block, err := aes.NewCipher(k[:])
+	if err != nil {
+		return nil, err
+	}
+	return stdcipher.NewGCM(block)
+}
+
+// x25519 computes the shared secret of prv and pub. It returns false when pub
+// is a low order point.
+func x25519(dst, prv, pub *[lenKey]byte) bool {
+	var zero [lenKey]byte
+	curve25519.ScalarMult(dst, prv, pub)
+	return subtle.ConstantTimeCompare(dst[:], zero[:]) != 1
+}
+
+type state struct {
+	mtx               sync.RWMutex
+	localKey          *key
+	remoteKey         *key
+	localLineKey      *key
+	remoteLineKey     *key
+	localKEMKey       *mlkem.DecapsulationKey768
+	kemCiphertext     []byte
+	kemSecret         *[lenKey]byte
+	localToken        *cipherset.Token
+	remoteToken       *cipherset.Token
+	lineEncryptionKey *[lenKey]byte
+	lineDecryptionKey *[lenKey]byte
+	lineEncryption    stdcipher.AEAD
+	lineDecryption    stdcipher.AEAD
+	pktCounter        uint64
+	wiped             bool
+}
+
+func (*state) CSID() uint8 { return 0x5a }
+
+func (s *state) IsHigh() bool {
+	if s.localKey != nil && s.remoteKey != nil {
+		return bytes.Compare((*s.remoteKey.pub)[:], (*s.localKey.pub)[:]) < 0
+	}
+	return false
+}
+
+func (s *state) LocalToken() cipherset.Token {
+	if s.localToken != nil {
+		return *s.localToken
+	}
+	return cipherset.ZeroToken
+}
+
+func (s *state) RemoteToken() cipherset.Token {
+	if s.remoteToken != nil {
+		return *s.remoteToken
+	}
+	return cipherset.ZeroToken
+}
+
+func (s *state) SetRemoteKey(remoteKey cipherset.Key) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if k, ok := remoteKey.(*key); ok && k != nil && k.CanEncrypt() {
+		s.remoteKey = k
+		s.update()
+		return nil
+	}
+
+	return cipherset.ErrInvalidKey
+}
+
+func (s *state) setRemoteLineKey(k *key) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.remoteLineKey = k
+	s.update()
+}
+
+func (s *state) update() {
+	if s.wiped {
+		return
+	}
+
+	// generate a local line Key
+	if s.localLineKey == nil {
+		s.localLineKey, _ = generateKey()
+	}
+
+	// generate a local KEM line key
+	if s.localKEMKey == nil {
+		s.localKEMKey, _ = mlkem.GenerateKey768()
+	}
+
+	// make local token
+	if s.localToken == nil && s.localLineKey != nil {
+		s.localToken = makeToken(s.localLineKey)
+	}
+
+	// make remote token
+	if s.remoteToken == nil && s.remoteLineKey != nil {
+		s.remoteToken = makeToken(s.remoteLineKey)
+	}
+
+	// generate line keys
+	if s.localToken != nil && s.remoteToken != nil && s.kemSecret != nil &&
+		(s.lineEncryptionKey == nil || s.lineDecryptionKey == nil) {
+		var sharedKey [lenKey]byte
+		if !x25519(&sharedKey, s.localLineKey.prv, s.remoteLineKey.pub) {
+			return
+		}
+		defer wipe(sharedKey[:])
+
+		sha := sha256.New()
+		s.lineEncryptionKey = new([lenKey]byte)
+		sha.Write(sharedKey[:])
+		sha.Write(s.kemSecret[:])
+		sha.Write(s.localLineKey.pub[:])
+		sha.Write(s.remoteLineKey.pub[:])
+		sha.Sum((*s.lineEncryptionKey)[:0])
+
+		sha.Reset()
+		s.lineDecryptionKey = new([lenKey]byte)
+		sha.Write(sharedKey[:])
+		sha.Write(s.kemSecret[:])
+		sha.Write(s.remoteLineKey.pub[:])
+		sha.Write(s.localLineKey.pub[:])
+		sha.Sum((*s.lineDecryptionKey)[:0])
+
+		s.lineEncryption, _ = newAEAD(s.lineEncryptionKey)
+		s.lineDecryption, _ = newAEAD(s.lineDecryptionKey)
+	}
+}
+
+// applyKEM processes the KEM field of a handshake. An encapsulation key is
+// answered with a fresh ciphertext unless a shared secret was already agreed
+// on. A ciphertext is decapsulated; when both peers encapsulated, the
+// ciphertext of the high peer is kept.
+func (s *state) applyKEM(hs *handshake) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.wiped || s.localKEMKey == nil {
+		return false
+	}
+
+	switch hs.kemType {
+
+	case kemEncapsulationKey:
+		if s.kemSecret != nil {
+			return true
+		}
+		ek, err := mlkem.NewEncapsulationKey768(hs.kemData)
+		if err != nil {
+			return false
+		}
+		sharedKey, ciphertext := ek.Encapsulate()
+		s.setKEMSecret(sharedKey)
+		s.kemCiphertext = ciphertext
+		wipe(sharedKey)
+		return true
+
+	case kemCiphertext:
+		if s.kemSecret != nil && (s.kemCiphertext == nil || s.IsHigh()) {
+			return true
+		}
+		sharedKey, err := s.localKEMKey.Decapsulate(hs.kemData)
+		if err != nil {
+			return false
+		}
+		s.setKEMSecret(sharedKey)
+		s.kemCiphertext = nil
+		wipe(sharedKey)
+		return true
+
+	default:
+		return false
+
+	}
+}
+
+func (s *state) setKEMSecret(sharedKey []byte) {
+	s.resetKEM()
+	s.kemSecret = new([lenKey]byte)
+	copy(s.kemSecret[:], sharedKey)
+}
+
+func (s *state) resetKEM() {
+	if s.kemSecret != nil {
+		wipe(s.kemSecret[:])
+		s.kemSecret = nil
+	}
+	if s.lineEncryptionKey != nil {
+		wipe(s.lineEncryptionKey[:])
+		s.lineEncryptionKey = nil
+	}
+	if s.lineDecryptionKey != nil {
+		wipe(s.lineDecryptionKey[:])
+		s.lineDecryptionKey = nil
+	}
+	s.lineEncryption = nil
+	s.lineDecryption = nil
+	s.kemCiphertext = nil
+}
+
+// makeToken derives the token of a line key the same way
+// cipherset.ExtractToken does for handshakes.
+func makeToken(lineKey *key) *cipherset.Token {
+	token := new(cipherset.Token)
+	sha := sha256.Sum256((*lineKey.pub)[:lenToken])
+	copy((*token)[:], sha[:lenToken])
+	return token
+}
+
+func (s *state) NeedsRemoteKey() bool {
+	return s.remoteKey == nil
+}
+
+func (s *state) CanEncryptMessage() bool {
+	return s.localKey != nil && s.remoteKey != nil && s.localLineKey != nil && s.localKEMKey != nil
+}
+
+func (s *state) CanEncryptHandshake() bool {
+	return s.CanEncryptMessage()
+}
+
+func (s *state) CanEncryptPacket() bool {
+	return s.lineEncryption != nil && s.remoteToken != nil
+}
+
+func (s *state) CanDecryptMessage() bool {
+	return s.localKey != nil && s.remoteKey != nil && s.localLineKey != nil
+}
+
+func (s *state) CanDecryptHandshake() bool {
+	return s.localKey != nil && s.localLineKey != nil && s.localKEMKey != nil
+}
+
+func (s *state) CanDecryptPacket() bool {
+	return s.lineDecryption != nil && s.localToken != nil
+}
+
+func (s *state) EncryptMessage(in []byte) ([]byte, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if !s.CanEncryptMessage() {
+		return nil, cipherset.ErrInvalidState
+	}
+
+	if s.kemCiphertext != nil {
+		return sealMessage(s.localKey, s.remoteKey, s.localLineKey, kemCiphertext, s.kemCiphertext, in)
+	}
+	return sealMessage(s.localKey, s.remoteKey, s.localLineKey, kemEncapsulationKey, s.localKEMKey.EncapsulationKey().Bytes(), in)
+}
+
+func (s *state) EncryptHandshake(at uint32, compact cipherset.Parts) ([]byte, error) {
+	pkt := lob.New(s.localKey.pub[:])
+	compact.ApplyToHeader(pkt.Header())
+	pkt.Header().SetUint32("at", at)
+	data, err := lob.Encode(pkt)
+	if err != nil {
+		return nil, err
+	}
+	defer data.Free()
+	return s.EncryptMessage(data.Get(nil))
+}
+
+func (s *state) ApplyHandshake(h cipherset.Handshake) bool {
+	var (
+		hs, _ = h.(*handshake)
+	)
+
+	if hs == nil {
+		return false
+	}
+
+	if s.remoteKey != nil && *s.remoteKey.pub != *hs.key.pub {
+		return false
+	}
+
+	if s.remoteLineKey != nil && *s.remoteLineKey.pub != *hs.lineKey.pub {
+		s.mtx.Lock()
+		s.remoteLineKey = nil
+		s.remoteToken = nil
+		s.resetKEM()
+		s.mtx.Unlock()
+	}
+
+	if !s.applyKEM(hs) {
+		return false
+	}
+
+	s.setRemoteLineKey(hs.lineKey)
+	if s.remoteKey == nil {
+		s.SetRemoteKey(hs.key)
+	}
+	return true
+}
+
+func (s *state) EncryptPacket(pkt *lob.Packet) (*lob.Packet, error) {
+	s.mtx.RLock()
+	ok := s.CanEncryptPacket()
+	s.mtx.RUnlock()
+
+	if !ok {
+		return nil, cipherset.ErrInvalidState
+	}
+	if pkt == nil {
+		return nil, nil
+	}
+
+	// encode inner packet
+	inner, err := lob.Encode(pkt)
+	if err != nil {
+		return nil, err
+	}
+	defer inner.Free()
+	defer wipe(inner.RawBytes())
+
+	body := bufpool.New()
+	defer body.Free()
+
+	bodyRaw, err := s.SealPacket(body.RawBytes()[:0], inner.RawBytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return lob.New(bodyRaw), nil
+}
+
+func (s *state) DecryptPacket(pkt *lob.Packet) (*lob.Packet, error) {
+	s.mtx.RLock()
+	ok := s.CanDecryptPacket()
+	s.mtx.RUnlock()
+
+	if !ok {
+		return nil, cipherset.ErrInvalidState
+	}
+	if pkt == nil {
+		return nil, nil
+	}
+
+	if !pkt.Header().IsZero() || pkt.BodyLen() < lenToken+lenCounter+lenAuth {
+		return nil, cipherset.ErrInvalidPacket
+	}
+
+	var (
+		body  = bufpool.New()
+		inner = bufpool.New()
+	)
+
+	defer body.Free()
+	defer inner.Free()
+
+	innerRaw, err := s.OpenPacket(inner.RawBytes()[:0], pkt.Body(body.RawBytes()[:0]))
+	if err != nil {
+		return nil, err
+	}
+	inner.SetLen(len(innerRaw))
+
+	innerPkt, err := lob.Decode(inner)
+	wipe(inner.RawBytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return innerPkt, nil
+}
+
+// noncePool holds the packet nonces; they escape through the AEAD interface.
+var noncePool = sync.Pool{
+	New: func() interface{} { return new([lenNonce]byte) },
+}
+
+func (s *state) PacketOverhead() int {
+	return lenToken + lenCounter + lenAuth
+}
+
+func (s *state) SealPacket(dst, inner []byte) ([]byte, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if !s.CanEncryptPacket() {
+		return nil, cipherset.ErrInvalidState
+	}
+
+	nonce := noncePool.Get().(*[lenNonce]byte)
+	defer noncePool.Put(nonce)
+
+	counter := atomic.AddUint64(&s.pktCounter, 1)
+	binary.BigEndian.PutUint64(nonce[4:], counter)
+
+	ret, out := sliceForAppend(dst, lenToken+lenCounter)
+	copy(out[:lenToken], s.remoteToken[:])
+	copy(out[lenToken:], nonce[4:])
+
+	return s.lineEncryption.Seal(ret, nonce[:], inner, out[:lenToken]), nil
+}
+
+func (s *state) OpenPacket(dst, body []byte) ([]byte, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	if !s.CanDecryptPacket() {
+		return nil, cipherset.ErrInvalidState
+	}
+
+	if len(body) < lenToken+lenCounter+lenAuth {
+		return nil, cipherset.ErrInvalidPacket
+	}
+
+	// compare token
+	if subtle.ConstantTimeCompare(body[:lenToken], (*s.localToken)[:]) != 1 {
+		return nil, cipherset.ErrInvalidPacket
+	}
+
+	nonce := noncePool.Get().(*[lenNonce]byte)
+	defer noncePool.Put(nonce)
+
+	copy(nonce[4:], body[lenToken:lenToken+lenCounter])
+
+	inner, err := s.lineDecryption.Open(dst, nonce[:],
+		body[lenToken+lenCounter:], body[:lenToken])
+	if err != nil {
+		return nil, cipherset.ErrInvalidPacket
+	}
+
+	return inner, nil
+}
+
+// Wipe zeroes the line keys of the state. The long-term local key is owned by
+// the endpoint and is left untouched. The ML-KEM line key can not be zeroed;
+// it is dropped instead.
+func (s *state) Wipe() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.wiped = true
+
+	if s.localLineKey != nil {
+		s.localLineKey.wipe()
+		s.localLineKey = nil
+	}
+	s.localKEMKey = nil
+	s.resetKEM()
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
+
+type key struct {
+	pub *[32]byte
+	prv *[32]byte
+	dec cipherset.Decrypter
+}
+
+func makeKey(prv, pub *[lenKey]byte) *key {
+	if prv != nil {
+		prvCopy := new([lenKey]byte)
+		copy((*prvCopy)[:], (*prv)[:])
+		prv = prvCopy
+	}
+
+	if pub != nil {
+		pubCopy := new([lenKey]byte)
+		copy((*pubCopy)[:], (*pub)[:])
+		pub = pubCopy
+	}
+
+	return &key{pub: pub, prv: prv}
+}
+
+func generateKey() (*key, error) {
+	return generateKeyFrom(rand.Reader)
+}
+
+func generateKeyFrom(r io.Reader) (*key, error) {
+	var (
+		pub = new([lenKey]byte)
+		prv = new([lenKey]byte)
+	)
+
+	_, err := io.ReadFull(r, prv[:])
+	if err != nil {
+		return nil, err
+	}
+
+	curve25519.ScalarBaseMult(pub, prv)
+
+	return &key{pub: pub, prv: prv}, nil
+}
+
+func (k *key) CSID() uint8 { return 0x5a }
+
+func (k *key) Public() []byte {
+	if k == nil || k.pub == nil {
+		return nil
+	}
+
+	buf := make([]byte, lenKey)
+	copy(buf, (*k.pub)[:])
+	return buf
+}
+
+func (k *key) Private() []byte {
+	if k == nil || k.prv == nil {
+		return nil
+	}
+
+	buf := make([]byte, lenKey)
+	copy(buf, (*k.prv)[:])
+	return buf
+}
+
+func (k *key) String() string {
+	return base32util.EncodeToString((*k.pub)[:])
+}
+
+func (k *key) CanSign() bool {
+	return k != nil && (k.prv != nil || k.dec != nil)
+}
+
+// ECDH implements cipherset.Decrypter; it returns the X25519 shared secret.
+func (k *key) ECDH(peer []byte) ([]byte, error) {
+	if len(peer) != lenKey {
+		return nil, cipherset.ErrInvalidKey
+	}
+
+	if k.prv == nil {
+		if k.dec == nil {
+			return nil, cipherset.ErrInvalidState
+		}
+		return k.dec.ECDH(peer)
+	}
+
+	var (
+		dst [lenKey]byte
+		pub [lenKey]byte
+	)
+	copy(pub[:], peer)
+	curve25519.ScalarMult(&dst, k.prv, &pub)
+	return dst[:], nil
+}
+
+// dh is x25519 for the private key of k.
+func (k *key) dh(dst, pub *[lenKey]byte) bool {
+	if k.prv != nil {
+		return x25519(dst, k.prv, pub)
+	}
+
+	if k.dec == nil {
+		return false
+	}
+
+	shared, err := k.dec.ECDH(pub[:])
+	if err != nil || len(shared) != lenKey {
+		return false
+	}
+
+	var zero [lenKey]byte
+	copy(dst[:], shared)
+	wipe(shared)
+	return subtle.ConstantTimeCompare(dst[:], zero[:]) != 1
+}
+
+func (k *key) CanEncrypt() bool {
+	return k != nil && k.pub != nil
+}
+
+func (k *key) wipe() {
+	if k.prv != nil {
+		wipe(k.prv[:])
+		k.prv = nil
+	}
+}
@@ -0,0 +1,132 @@
+//go:build pq
+// +build pq
+
+package cs5a
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/e3x/cipherset"
+	"github.com/telehash/gogotelehash/e3x/cipherset/tests"
+	"github.com/telehash/gogotelehash/internal/lob"
+)
+
+func TestCipher(t *testing.T) {
+	tests.Run(t, &cipher{})
+}
+
+func TestMessageSender(t *testing.T) {
+	assert := assert.New(t)
+
+	ka, _ := generateKey()
+	kb, _ := generateKey()
+	kc, _ := generateKey()
+
+	sa, err := (&cipher{}).NewState(ka)
+	assert.NoError(err)
+	assert.NoError(sa.SetRemoteKey(kb))
+
+	box, err := sa.EncryptMessage([]byte("Hello World!"))
+	assert.NoError(err)
+
+	msg, err := (&cipher{}).DecryptMessage(kb, ka, box)
+	assert.NoError(err)
+	assert.True(bytes.Equal([]byte("Hello World!"), msg))
+
+	// the sender is authenticated by the static keys
+	_, err = (&cipher{}).DecryptMessage(kb, kc, box)
+	assert.Equal(cipherset.ErrInvalidMessage, err)
+
+	// only the recipient can decrypt the message
+	_, err = (&cipher{}).DecryptMessage(kc, ka, box)
+	assert.Equal(cipherset.ErrInvalidMessage, err)
+}
+
+// When both peers open the line at the same time they both encapsulate; the
+// ciphertext of the high peer must win on both sides.
+func TestSimultaneousOpen(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		c      = &cipher{}
+		ka, _  = generateKey()
+		kb, _  = generateKey()
+		sa, _  = c.NewState(ka)
+		sb, _  = c.NewState(kb)
+		ha, hb cipherset.Handshake
+	)
+
+	assert.NoError(sa.SetRemoteKey(kb))
+	assert.NoError(sb.SetRemoteKey(ka))
+
+	exchange := func(from cipherset.State, to cipherset.Key) cipherset.Handshake {
+		box, err := from.EncryptHandshake(1, nil)
+		assert.NoError(err)
+		h, err := c.DecryptHandshake(to, box)
+		assert.NoError(err)
+		return h
+	}
+
+	// both send their encapsulation key
+	ha = exchange(sb, ka)
+	hb = exchange(sa, kb)
+	assert.True(sa.ApplyHandshake(ha))
+	assert.True(sb.ApplyHandshake(hb))
+
+	// both answer with a ciphertext
+	ha = exchange(sb, ka)
+	hb = exchange(sa, kb)
+	assert.True(sa.ApplyHandshake(ha))
+	assert.True(sb.ApplyHandshake(hb))
+
+	// the low peer adopted the ciphertext of the high peer
+	assert.Equal(sa.(*state).kemSecret, sb.(*state).kemSecret)
+
+	pkt, err := sa.EncryptPacket(lob.New([]byte("Hello world!")))
+	assert.NoError(err)
+	pkt, err = sb.DecryptPacket(pkt)
+	assert.NoError(err)
+	if assert.NotNil(pkt) {
+		assert.Equal([]byte("Hello world!"), pkt.Body(nil))
+	}
+}
+
+func TestHandshakeSize(t *testing.T) {
+	assert := assert.New(t)
+
+	ka, _ := generateKey()
+	kb, _ := generateKey()
+	sa, _ := (&cipher{}).NewState(ka)
+	assert.NoError(sa.SetRemoteKey(kb))
+
+	parts := cipherset.Parts{
+		0x1a: "foobarzzzzfoobarzzzzfoobarzzzzfoobarzzzzfoobarzzzz34",
+		0x3a: "foobarzzzzfoobarzzzzfoobarzzzzfoobarzzzzfoobarzzzz34",
+		0x5a: "foobarzzzzfoobarzzzzfoobarzzzzfoobarzzzzfoobarzzzz34",
+	}
+
+	box, err := sa.EncryptHandshake(0xffffffff, parts)
+	assert.NoError(err)
+
+	// 3 bytes of message header
+	assert.True(len(box)+3 <= 1500, "handshake is %d bytes", len(box))
+}
+
+func BenchmarkPacketEncryption(b *testing.B) {
+	tests.BenchmarkPacketEncryption(b, &cipher{})
+}
+
+func BenchmarkPacketDecryption(b *testing.B) {
+	tests.BenchmarkPacketDecryption(b, &cipher{})
+}
+
+func BenchmarkSealPacket(b *testing.B) {
+	tests.BenchmarkSealPacket(b, &cipher{})
+}
+
+func BenchmarkOpenPacket(b *testing.B) {
+	tests.BenchmarkOpenPacket(b, &cipher{})
+}
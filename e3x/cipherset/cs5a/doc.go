@@ -0,0 +1,26 @@
+//go:build pq
+// +build pq
+
+// Package cs5a implements an experimental hybrid post-quantum Cipher Set.
+//
+// CS5a is not part of the telehash specification. It is only compiled with the
+// pq build tag (go build -tags pq) and, like cs4a, it is not registered by
+// default: both peers must import this package.
+//
+// Hashnames are still derived from X25519 keys; the post-quantum part of the
+// cipher set lives entirely in the line. Next to its X25519 line key every
+// peer generates an ML-KEM-768 (Kyber) line key. The first handshake of a line
+// carries the encapsulation key, the peer answers with a ciphertext
+// encapsulated to that key. The packet keys are derived from both the X25519
+// line secret and the ML-KEM shared secret, so channel traffic stays
+// confidential as long as either of them holds. When both peers encapsulate at
+// the same time the ciphertext of the high peer wins.
+//
+// Handshakes themselves (parts, at and the sender key) are only protected by
+// X25519. A handshake carrying an encapsulation key is about 1.4KB; paths with
+// an MTU below 1500 bytes rely on IP fragmentation.
+//
+// Reference
+//
+// ML-KEM: https://csrc.nist.gov/pubs/fips/203/final
+package cs5a
@@ -0,0 +1,264 @@
+package cipherset
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/golang.org/x/crypto/nacl/secretbox"
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/golang.org/x/crypto/scrypt"
+
+	"github.com/telehash/gogotelehash/internal/util/base32util"
+)
+
+var (
+	ErrWrongPassphrase = errors.New("cipherset: wrong passphrase")
+	ErrNoPassphrase    = errors.New("cipherset: no passphrase")
+)
+
+// Default scrypt cost parameters of EncryptedFileKeyStore.
+const (
+	DefaultScryptN = 1 << 15
+	DefaultScryptR = 8
+	DefaultScryptP = 1
+)
+
+// Upper bounds for the cost parameters found in a key file; they keep a
+// corrupt file from exhausting memory.
+const (
+	maxScryptN = 1 << 22
+	maxScryptR = 32
+	maxScryptP = 16
+)
+
+// EncryptedFileKeyStore stores keys in a JSON file where the private keys are
+// encrypted with a passphrase. The encryption key is derived from the
+// passphrase with scrypt and the keys are sealed with NaCl secretbox:
+//
+//	{
+//	  "keys":  { "1a": "<public key>", ... },
+//	  "kdf":   { "name": "scrypt", "n": 32768, "r": 8, "p": 1, "salt": "..." },
+//	  "nonce": "...",
+//	  "box":   "..."
+//	}
+//
+// The public keys are stored in the clear so the hashname can be computed
+// without the passphrase.
+type EncryptedFileKeyStore struct {
+	Path string
+
+	// Passphrase is called each time the keys are loaded or saved. The returned
+	// slice is wiped after use.
+	Passphrase func() ([]byte, error)
+
+	// scrypt cost parameters used by Save. Zero values select the defaults.
+	N, R, P int
+}
+
+var _ KeyStore = (*EncryptedFileKeyStore)(nil)
+
+type encryptedKeyFile struct {
+	Keys  Keys      `json:"keys"`
+	KDF   kdfParams `json:"kdf"`
+	Nonce string    `json:"nonce"`
+	Box   string    `json:"box"`
+}
+
+type kdfParams struct {
+	Name string `json:"name"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt string `json:"salt"`
+}
+
+// NewEncryptedFileKeyStore returns a KeyStore for the file at path which is
+// unlocked with the passphrase returned by passphrase.
+func NewEncryptedFileKeyStore(path string, passphrase func() ([]byte, error)) *EncryptedFileKeyStore {
+	return &EncryptedFileKeyStore{Path: path, Passphrase: passphrase}
+}
+
+// StaticPassphrase returns a passphrase callback for a fixed passphrase.
+func StaticPassphrase(passphrase string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		return []byte(passphrase), nil
+	}
+}
+
+func (s *EncryptedFileKeyStore) Load() (Keys, error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoStoredKeys
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f encryptedKeyFile
+	err = json.Unmarshal(data, &f)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.KDF.Name != "scrypt" || f.KDF.N > maxScryptN || f.KDF.R > maxScryptR || f.KDF.P > maxScryptP {
+		return nil, ErrInvalidKeys
+	}
+
+	salt, err := base32util.DecodeString(f.KDF.Salt)
+	if err != nil {
+		return nil, ErrInvalidKeys
+	}
+
+	nonceBytes, err := base32util.DecodeString(f.Nonce)
+	if err != nil || len(nonceBytes) != 24 {
+		return nil, ErrInvalidKeys
+	}
+
+	box, err := base32util.DecodeString(f.Box)
+	if err != nil {
+		return nil, ErrInvalidKeys
+	}
+
+	key, err := s.deriveKey(salt, f.KDF.N, f.KDF.R, f.KDF.P)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(key[:])
+
+	var nonce [24]byte
+	copy(nonce[:], nonceBytes)
+
+	plain, ok := secretbox.Open(nil, box, &nonce, key)
+	if !ok {
+		return nil, ErrWrongPassphrase
+	}
+	defer wipe(plain)
+
+	var keys PrivateKeys
+	err = json.Unmarshal(plain, &keys)
+	if err != nil {
+		return nil, ErrInvalidKeys
+	}
+
+	for csid, k := range keys {
+		if !k.CanSign() {
+			return nil, ErrInvalidKeys
+		}
+		if pub := f.Keys[csid]; pub == nil || pub.String() != k.String() {
+			return nil, ErrInvalidKeys
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrNoStoredKeys
+	}
+
+	return Keys(keys), nil
+}
+
+func (s *EncryptedFileKeyStore) Save(keys Keys) error {
+	var (
+		f = encryptedKeyFile{
+			Keys: keys,
+			KDF: kdfParams{
+				Name: "scrypt",
+				N:    s.N,
+				R:    s.R,
+				P:    s.P,
+			},
+		}
+		salt  [32]byte
+		nonce [24]byte
+	)
+
+	if f.KDF.N == 0 {
+		f.KDF.N = DefaultScryptN
+	}
+	if f.KDF.R == 0 {
+		f.KDF.R = DefaultScryptR
+	}
+	if f.KDF.P == 0 {
+		f.KDF.P = DefaultScryptP
+	}
+
+	_, err := io.ReadFull(rand.Reader, salt[:])
+	if err != nil {
+		return err
+	}
+	_, err = io.ReadFull(rand.Reader, nonce[:])
+	if err != nil {
+		return err
+	}
+
+	key, err := s.deriveKey(salt[:], f.KDF.N, f.KDF.R, f.KDF.P)
+	if err != nil {
+		return err
+	}
+	defer wipe(key[:])
+
+	plain, err := json.Marshal(PrivateKeys(keys))
+	if err != nil {
+		return err
+	}
+	defer wipe(plain)
+
+	f.KDF.Salt = base32util.EncodeToString(salt[:])
+	f.Nonce = base32util.EncodeToString(nonce[:])
+	f.Box = base32util.EncodeToString(secretbox.Seal(nil, plain, &nonce, key))
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.Path, data)
+}
+
+func (s *EncryptedFileKeyStore) Generate(csids ...uint8) (Keys, error) {
+	keys, err := GenerateKeys(csids...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Save(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (s *EncryptedFileKeyStore) deriveKey(salt []byte, n, r, p int) (*[32]byte, error) {
+	if s.Passphrase == nil {
+		return nil, ErrNoPassphrase
+	}
+
+	passphrase, err := s.Passphrase()
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(passphrase)
+
+	if len(passphrase) == 0 {
+		return nil, ErrNoPassphrase
+	}
+
+	derived, err := scrypt.Key(passphrase, salt, n, r, p, 32)
+	if err != nil {
+		return nil, ErrInvalidKeys
+	}
+
+	key := new([32]byte)
+	copy(key[:], derived)
+	wipe(derived)
+	return key, nil
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
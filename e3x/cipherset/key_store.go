@@ -0,0 +1,138 @@
+package cipherset
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ErrNoStoredKeys is returned by (KeyStore).Load when no keys were saved yet.
+var ErrNoStoredKeys = errors.New("cipherset: no stored keys")
+
+// KeyStore persists the private keys of an endpoint.
+type KeyStore interface {
+	// Load returns the stored keys or ErrNoStoredKeys.
+	Load() (Keys, error)
+
+	// Save replaces the stored keys.
+	Save(keys Keys) error
+
+	// Generate generates new keys for csids (all registered CSIDs when csids
+	// is empty), saves them and returns them.
+	Generate(csids ...uint8) (Keys, error)
+}
+
+// LoadOrGenerate loads the keys from store and generates them when none were
+// saved yet.
+func LoadOrGenerate(store KeyStore, csids ...uint8) (Keys, error) {
+	keys, err := store.Load()
+	if err == ErrNoStoredKeys {
+		return store.Generate(csids...)
+	}
+	return keys, err
+}
+
+// FileKeyStore stores keys in a JSON file. The file has the same layout as the
+// files written by th-keygen:
+//
+//	{ "keys": { "1a": { "pub": "...", "prv": "..." }, ... } }
+//
+// Other fields in the file are ignored by Load and dropped by Save.
+type FileKeyStore struct {
+	Path string
+}
+
+var _ KeyStore = (*FileKeyStore)(nil)
+
+type keyFile struct {
+	Keys PrivateKeys `json:"keys"`
+}
+
+// NewFileKeyStore returns a KeyStore for the file at path.
+func NewFileKeyStore(path string) *FileKeyStore {
+	return &FileKeyStore{Path: path}
+}
+
+func (s *FileKeyStore) Load() (Keys, error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoStoredKeys
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f keyFile
+	err = json.Unmarshal(data, &f)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(f.Keys) == 0 {
+		return nil, ErrNoStoredKeys
+	}
+
+	for _, key := range f.Keys {
+		if !key.CanSign() {
+			return nil, ErrInvalidKeys
+		}
+	}
+
+	return Keys(f.Keys), nil
+}
+
+// Save atomically replaces the file at Path. The file is only readable by its
+// owner.
+func (s *FileKeyStore) Save(keys Keys) error {
+	data, err := json.MarshalIndent(keyFile{Keys: PrivateKeys(keys)}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.Path, data)
+}
+
+// writeFileAtomic writes data to a temporary file next to path which is then
+// renamed to path. The file is only readable by its owner.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(0600)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return nil
+}
+
+func (s *FileKeyStore) Generate(csids ...uint8) (Keys, error) {
+	keys, err := GenerateKeys(csids...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.Save(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
@@ -1,23 +1,122 @@
 package cipherset
 
 import (
+	"sort"
+	"sync"
+
 	"github.com/telehash/gogotelehash/internal/util/base32util"
 )
 
-var ciphers = map[uint8]Cipher{}
+var (
+	ciphersMtx sync.RWMutex
+	ciphers    = map[uint8]Cipher{}
+)
+
+// Capabilities describe what a registered cipher set supports.
+type Capabilities struct {
+	// CanEncryptMessage is true when the cipher set can encrypt and decrypt
+	// messages outside of a line (used for handshakes).
+	CanEncryptMessage bool
+
+	// TokenSize is the number of significant bytes in a Token.
+	TokenSize int
+
+	// KeySize is the size of an encoded public key in bytes
+	// (0 when keys have a variable size).
+	KeySize int
+}
+
+// DefaultCapabilities are assumed for ciphers that don't implement Capable.
+var DefaultCapabilities = Capabilities{
+	CanEncryptMessage: true,
+	TokenSize:         len(Token{}),
+}
+
+// Capable is implemented by ciphers that report their capabilities.
+type Capable interface {
+	Capabilities() Capabilities
+}
 
+// Register makes the cipher c available for csid. Cipher sets are expected
+// to call Register from an init function. Register panics when csid is
+// already registered, when c is nil, when c reports a different CSID or when
+// its capabilities are invalid.
 func Register(csid uint8, c Cipher) {
+	if c == nil {
+		panic("cipher must not be nil")
+	}
+	if c.CSID() != csid {
+		panic("cipher CSID does not match the registered CSID")
+	}
+
+	caps := capabilitiesOf(c)
+	if caps.TokenSize <= 0 || caps.TokenSize > len(Token{}) {
+		panic("cipher token size is invalid")
+	}
+	if caps.KeySize < 0 {
+		panic("cipher key size is invalid")
+	}
+
+	ciphersMtx.Lock()
+	defer ciphersMtx.Unlock()
+
 	if ciphers[csid] != nil {
 		panic("CSID is already registered")
 	}
+	ciphers[csid] = c
+}
+
+// Lookup returns the cipher that is registered for csid.
+func Lookup(csid uint8) (Cipher, bool) {
+	c := lookup(csid)
+	return c, c != nil
+}
+
+// LookupCapabilities returns the capabilities of the cipher that is
+// registered for csid.
+func LookupCapabilities(csid uint8) (Capabilities, error) {
+	c := lookup(csid)
 	if c == nil {
-		panic("cipher must no  be nil")
+		return Capabilities{}, ErrUnknownCSID
 	}
-	ciphers[csid] = c
+	return capabilitiesOf(c), nil
 }
 
-func GenerateKey(csid uint8) (Key, error) {
+// CSIDs returns the registered CSIDs in ascending order.
+func CSIDs() []uint8 {
+	ciphersMtx.RLock()
+	defer ciphersMtx.RUnlock()
+
+	csids := make([]uint8, 0, len(ciphers))
+	for csid := range ciphers {
+		csids = append(csids, csid)
+	}
+	sort.Sort(csidSlice(csids))
+	return csids
+}
+
+func lookup(csid uint8) Cipher {
+	ciphersMtx.RLock()
 	c := ciphers[csid]
+	ciphersMtx.RUnlock()
+	return c
+}
+
+func capabilitiesOf(c Cipher) Capabilities {
+	if x, ok := c.(Capable); ok {
+		return x.Capabilities()
+	}
+	return DefaultCapabilities
+}
+
+type csidSlice []uint8
+
+func (s csidSlice) Len() int           { return len(s) }
+func (s csidSlice) Less(i, j int) bool { return s[i] < s[j] }
+func (s csidSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func GenerateKey(csid uint8) (Key, error) {
+	c := lookup(csid)
 	if c == nil {
 		return nil, ErrUnknownCSID
 	}
@@ -29,16 +128,7 @@ func GenerateKeys(csids ...uint8) (Keys, error) {
 	keys := make(Keys)
 
 	if len(csids) == 0 {
-		for csid, cipher := range ciphers {
-			key, err := cipher.GenerateKey()
-			if err != nil {
-				return nil, err
-			}
-
-			keys[csid] = key
-		}
-
-		return keys, nil
+		csids = CSIDs()
 	}
 
 	for _, csid := range csids {
@@ -54,7 +144,7 @@ func GenerateKeys(csids ...uint8) (Keys, error) {
 }
 
 func DecodeKey(csid uint8, pub, prv string) (Key, error) {
-	c := ciphers[csid]
+	c := lookup(csid)
 
 	pubKey, err := base32util.DecodeString(pub)
 	if err != nil {
@@ -73,7 +163,7 @@ func DecodeKey(csid uint8, pub, prv string) (Key, error) {
 }
 
 func DecodeKeyBytes(csid uint8, pub, prv []byte) (Key, error) {
-	c := ciphers[csid]
+	c := lookup(csid)
 
 	if c == nil {
 		return opaqueKey{csid, pub, prv}, nil
@@ -82,8 +172,25 @@ func DecodeKeyBytes(csid uint8, pub, prv []byte) (Key, error) {
 	return c.DecodeKeyBytes(pub, prv)
 }
 
+// KeyFromDecrypter returns a Key whose private key operations are performed
+// by d. The returned key can be used as a local key but its Private method
+// returns nil.
+func KeyFromDecrypter(d Decrypter) (Key, error) {
+	c := lookup(d.CSID())
+	if c == nil {
+		return nil, ErrUnknownCSID
+	}
+
+	x, ok := c.(DecrypterCipher)
+	if !ok {
+		return nil, ErrNoDecrypter
+	}
+
+	return x.KeyFromDecrypter(d)
+}
+
 func DecryptMessage(csid uint8, localKey, remoteKey Key, p []byte) ([]byte, error) {
-	c := ciphers[csid]
+	c := lookup(csid)
 	if c == nil {
 		return nil, ErrUnknownCSID
 	}
@@ -92,7 +199,7 @@ func DecryptMessage(csid uint8, localKey, remoteKey Key, p []byte) ([]byte, erro
 }
 
 func DecryptHandshake(csid uint8, localKey Key, p []byte) (Handshake, error) {
-	c := ciphers[csid]
+	c := lookup(csid)
 	if c == nil {
 		return nil, ErrUnknownCSID
 	}
@@ -101,7 +208,7 @@ func DecryptHandshake(csid uint8, localKey Key, p []byte) (Handshake, error) {
 }
 
 func NewState(csid uint8, localKey Key) (State, error) {
-	c := ciphers[csid]
+	c := lookup(csid)
 	if c == nil {
 		return nil, ErrUnknownCSID
 	}
@@ -0,0 +1,63 @@
+package cipherset
+
+import (
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+)
+
+type fakeCipher struct {
+	Cipher
+	csid uint8
+	caps *Capabilities
+}
+
+func (c *fakeCipher) CSID() uint8 { return c.csid }
+
+type capableFakeCipher struct {
+	fakeCipher
+}
+
+func (c *capableFakeCipher) Capabilities() Capabilities { return *c.caps }
+
+func TestRegister(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func() {
+		ciphersMtx.Lock()
+		delete(ciphers, 0xf0)
+		delete(ciphers, 0xf1)
+		ciphersMtx.Unlock()
+	}()
+
+	Register(0xf0, &fakeCipher{csid: 0xf0})
+	Register(0xf1, &capableFakeCipher{fakeCipher{csid: 0xf1, caps: &Capabilities{TokenSize: 8, KeySize: 32}}})
+
+	c, ok := Lookup(0xf0)
+	assert.True(ok)
+	assert.Equal(uint8(0xf0), c.CSID())
+
+	_, ok = Lookup(0xf2)
+	assert.False(ok)
+
+	caps, err := LookupCapabilities(0xf0)
+	assert.NoError(err)
+	assert.Equal(DefaultCapabilities, caps)
+
+	caps, err = LookupCapabilities(0xf1)
+	assert.NoError(err)
+	assert.Equal(Capabilities{TokenSize: 8, KeySize: 32}, caps)
+
+	_, err = LookupCapabilities(0xf2)
+	assert.Equal(ErrUnknownCSID, err)
+
+	csids := CSIDs()
+	assert.Equal([]uint8{0xf0, 0xf1}, csids[len(csids)-2:])
+
+	assert.Panics(func() { Register(0xf0, &fakeCipher{csid: 0xf0}) })
+	assert.Panics(func() { Register(0xf2, &fakeCipher{csid: 0xf3}) })
+	assert.Panics(func() { Register(0xf2, nil) })
+	assert.Panics(func() {
+		Register(0xf2, &capableFakeCipher{fakeCipher{csid: 0xf2, caps: &Capabilities{TokenSize: 17}}})
+	})
+}
@@ -0,0 +1,118 @@
+package cipherset
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+)
+
+var (
+	ErrInvalidSeed = errors.New("cipherset: seed is too short")
+	ErrNoSeed      = errors.New("cipherset: cipher does not support seeds")
+)
+
+// MinSeedSize is the minimum size of a seed in bytes.
+const MinSeedSize = 16
+
+// seedSalt is the HKDF salt for key derivation. Changing it changes every key
+// derived from a seed.
+var seedSalt = []byte("telehash seed v1")
+
+// SeedCipher is implemented by ciphers that can derive a key from a seed.
+type SeedCipher interface {
+	// GenerateKeyFromReader generates a key with the bytes read from r instead
+	// of a random source. The same bytes must always produce the same key.
+	GenerateKeyFromReader(r io.Reader) (Key, error)
+}
+
+// GenerateKeyFromSeed deterministically derives the key for csid from seed.
+// The key stream of each CSID is derived from the seed with HKDF-SHA256 (the
+// CSID is the info parameter).
+func GenerateKeyFromSeed(csid uint8, seed []byte) (Key, error) {
+	if len(seed) < MinSeedSize {
+		return nil, ErrInvalidSeed
+	}
+
+	c := lookup(csid)
+	if c == nil {
+		return nil, ErrUnknownCSID
+	}
+
+	x, ok := c.(SeedCipher)
+	if !ok {
+		return nil, ErrNoSeed
+	}
+
+	return x.GenerateKeyFromReader(newSeedReader(seed, csid))
+}
+
+// GenerateKeysFromSeed deterministically derives the keys for csids (all
+// registered CSIDs when csids is empty) from seed. Identities can be backed up
+// and restored with the seed (or a mnemonic encoding of it) instead of the key
+// files.
+func GenerateKeysFromSeed(seed []byte, csids ...uint8) (Keys, error) {
+	keys := make(Keys)
+
+	if len(csids) == 0 {
+		csids = CSIDs()
+	}
+
+	for _, csid := range csids {
+		key, err := GenerateKeyFromSeed(csid, seed)
+		if err != nil {
+			return nil, err
+		}
+
+		keys[csid] = key
+	}
+
+	return keys, nil
+}
+
+// seedReader is the output of HKDF-Expand (RFC 5869) as a stream.
+type seedReader struct {
+	mac     hash.Hash
+	info    []byte
+	counter byte
+	prev    []byte
+	buf     []byte
+}
+
+func newSeedReader(seed []byte, csid uint8) *seedReader {
+	extract := hmac.New(sha256.New, seedSalt)
+	extract.Write(seed)
+	prk := extract.Sum(nil)
+
+	return &seedReader{
+		mac:  hmac.New(sha256.New, prk),
+		info: []byte{'c', 's', csid},
+	}
+}
+
+func (r *seedReader) Read(p []byte) (int, error) {
+	n := 0
+
+	for n < len(p) {
+		if len(r.buf) == 0 {
+			if r.counter == 255 {
+				return n, io.EOF
+			}
+			r.counter++
+
+			r.mac.Reset()
+			r.mac.Write(r.prev)
+			r.mac.Write(r.info)
+			r.mac.Write([]byte{r.counter})
+			r.prev = r.mac.Sum(r.prev[:0])
+			r.buf = r.prev
+		}
+
+		m := copy(p[n:], r.buf)
+		r.buf = r.buf[m:]
+		n += m
+	}
+
+	return n, nil
+}
@@ -0,0 +1,84 @@
+package cipherset
+
+import (
+	"bytes"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"io"
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+)
+
+type seedFakeCipher struct {
+	fakeCipher
+}
+
+func (c *seedFakeCipher) GenerateKeyFromReader(r io.Reader) (Key, error) {
+	prv := make([]byte, 32)
+	if _, err := io.ReadFull(r, prv); err != nil {
+		return nil, err
+	}
+	return opaqueKey{c.csid, nil, prv}, nil
+}
+
+func TestSeedReader(t *testing.T) {
+	assert := assert.New(t)
+
+	seed := []byte("correct horse battery staple")
+
+	expected, err := hkdf.Key(sha256.New, seed, seedSalt, "cs\x3a", 255*sha256.Size)
+	assert.NoError(err)
+
+	// read in odd sized chunks
+	var out []byte
+	r := newSeedReader(seed, 0x3a)
+	buf := make([]byte, 7)
+	for {
+		n, err := r.Read(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+	}
+	assert.Equal(expected, out)
+
+	a, _ := io.ReadAll(io.LimitReader(newSeedReader(seed, 0x1a), 64))
+	b, _ := io.ReadAll(io.LimitReader(newSeedReader(seed, 0x3a), 64))
+	assert.False(bytes.Equal(a, b))
+}
+
+func TestGenerateKeysFromSeed(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func() {
+		ciphersMtx.Lock()
+		delete(ciphers, 0xf0)
+		delete(ciphers, 0xf1)
+		ciphersMtx.Unlock()
+	}()
+
+	Register(0xf0, &seedFakeCipher{fakeCipher{csid: 0xf0}})
+	Register(0xf1, &fakeCipher{csid: 0xf1})
+
+	seed := []byte("0123456789abcdef")
+
+	keys1, err := GenerateKeysFromSeed(seed, 0xf0)
+	assert.NoError(err)
+	keys2, err := GenerateKeysFromSeed(seed, 0xf0)
+	assert.NoError(err)
+	assert.Equal(keys1[0xf0].Private(), keys2[0xf0].Private())
+
+	keys3, err := GenerateKeysFromSeed([]byte("0123456789abcdeg"), 0xf0)
+	assert.NoError(err)
+	assert.False(bytes.Equal(keys1[0xf0].Private(), keys3[0xf0].Private()))
+
+	_, err = GenerateKeysFromSeed(seed[:MinSeedSize-1], 0xf0)
+	assert.Equal(ErrInvalidSeed, err)
+
+	_, err = GenerateKeysFromSeed(seed, 0xf1)
+	assert.Equal(ErrNoSeed, err)
+
+	_, err = GenerateKeysFromSeed(seed, 0xf2)
+	assert.Equal(ErrUnknownCSID, err)
+}
@@ -2,6 +2,8 @@ package tests
 
 import (
 	"bytes"
+	mrand "math/rand"
+	"strconv"
 	"testing"
 
 	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/suite"
@@ -19,6 +21,134 @@ func Run(t *testing.T, c cipherset.Cipher) {
 	suite.Run(t, &cipherTestSuite{cipher: c})
 }
 
+func (s *cipherTestSuite) TestCapabilities() {
+	var (
+		assert = s.Assertions
+		c      = s.cipher
+	)
+
+	x, ok := c.(cipherset.Capable)
+	if !ok {
+		return
+	}
+
+	caps := x.Capabilities()
+	assert.True(caps.TokenSize > 0 && caps.TokenSize <= len(cipherset.ZeroToken))
+
+	k, err := c.GenerateKey()
+	assert.NoError(err)
+	if caps.KeySize > 0 {
+		assert.Len(k.Public(), caps.KeySize)
+	}
+}
+
+// hardwareKey only exposes the Decrypter methods of a key, like a key
+// that is stored on a hardware token.
+type hardwareKey struct {
+	d cipherset.Decrypter
+}
+
+func (k *hardwareKey) CSID() uint8                      { return k.d.CSID() }
+func (k *hardwareKey) Public() []byte                   { return k.d.Public() }
+func (k *hardwareKey) ECDH(peer []byte) ([]byte, error) { return k.d.ECDH(peer) }
+
+func (s *cipherTestSuite) TestDecrypter() {
+	var (
+		assert = s.Assertions
+		c      = s.cipher
+	)
+
+	x, ok := c.(cipherset.DecrypterCipher)
+	if !ok {
+		return
+	}
+
+	ka, err := c.GenerateKey()
+	assert.NoError(err)
+	kb, err := c.GenerateKey()
+	assert.NoError(err)
+
+	d, ok := ka.(cipherset.Decrypter)
+	if !assert.True(ok, "keys must implement cipherset.Decrypter") {
+		return
+	}
+
+	hk, err := x.KeyFromDecrypter(&hardwareKey{d})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Nil(hk.Private())
+	assert.True(hk.CanSign())
+	assert.Equal(ka.Public(), hk.Public())
+
+	sa, err := c.NewState(hk)
+	assert.NoError(err)
+	sb, err := c.NewState(kb)
+	assert.NoError(err)
+	assert.NoError(sa.SetRemoteKey(kb))
+
+	box, err := sa.EncryptHandshake(1, nil)
+	assert.NoError(err)
+	hb, err := c.DecryptHandshake(kb, box)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(ka.Public(), hb.PublicKey().Public())
+	assert.True(sb.ApplyHandshake(hb))
+
+	box, err = sb.EncryptHandshake(1, nil)
+	assert.NoError(err)
+	ha, err := c.DecryptHandshake(hk, box)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.True(sa.ApplyHandshake(ha))
+
+	box, err = sb.EncryptMessage([]byte("Hello World!"))
+	assert.NoError(err)
+	msg, err := c.DecryptMessage(hk, kb, box)
+	assert.NoError(err)
+	assert.Equal([]byte("Hello World!"), msg)
+
+	pkt, err := sb.EncryptPacket(lob.New([]byte("Hello world!")))
+	assert.NoError(err)
+	pkt, err = sa.DecryptPacket(pkt)
+	assert.NoError(err)
+	if assert.NotNil(pkt) {
+		assert.Equal([]byte("Hello world!"), pkt.Body(nil))
+	}
+}
+
+func (s *cipherTestSuite) TestGenerateKeyFromReader() {
+	var (
+		assert = s.Assertions
+		c      = s.cipher
+	)
+
+	x, ok := c.(cipherset.SeedCipher)
+	if !ok {
+		return
+	}
+
+	k1, err := x.GenerateKeyFromReader(mrand.New(mrand.NewSource(1)))
+	assert.NoError(err)
+	k2, err := x.GenerateKeyFromReader(mrand.New(mrand.NewSource(1)))
+	assert.NoError(err)
+	k3, err := x.GenerateKeyFromReader(mrand.New(mrand.NewSource(2)))
+	assert.NoError(err)
+
+	assert.Equal(k1.Public(), k2.Public())
+	assert.Equal(k1.Private(), k2.Private())
+	assert.False(bytes.Equal(k1.Public(), k3.Public()))
+
+	// the derived key is usable
+	k4, err := c.DecodeKeyBytes(k1.Public(), k1.Private())
+	assert.NoError(err)
+	assert.Equal(k1.Public(), k4.Public())
+	_, err = c.NewState(k1)
+	assert.NoError(err)
+}
+
 func (s *cipherTestSuite) TestMessage() {
 	var (
 		assert = s.Assertions
@@ -385,3 +515,188 @@ func BenchmarkPacketDecryption(b *testing.B, c cipherset.Cipher) {
 		}
 	}
 }
+
+// linkedStates returns two states of c that completed a handshake.
+func linkedStates(c cipherset.Cipher) (l, r cipherset.State, err error) {
+	lkey, err := c.GenerateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rkey, err := c.GenerateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	l, err = c.NewState(lkey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r, err = c.NewState(rkey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = l.SetRemoteKey(rkey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, x := range []struct {
+		from cipherset.State
+		to   cipherset.State
+		key  cipherset.Key
+	}{{l, r, rkey}, {r, l, lkey}} {
+		hs, err := x.from.EncryptHandshake(1, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		h, err := c.DecryptHandshake(x.key, hs)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if !x.to.ApplyHandshake(h) {
+			return nil, nil, cipherset.ErrInvalidState
+		}
+	}
+
+	return l, r, nil
+}
+
+func (s *cipherTestSuite) TestPacketSealer() {
+	var (
+		assert = s.Assertions
+		c      = s.cipher
+	)
+
+	l, r, err := linkedStates(c)
+	if !assert.NoError(err) {
+		return
+	}
+
+	ls, ok := l.(cipherset.PacketSealer)
+	if !ok {
+		return
+	}
+	rs := r.(cipherset.PacketSealer)
+
+	inner, err := lob.Encode(lob.New([]byte("Hello world!")))
+	if !assert.NoError(err) {
+		return
+	}
+	defer inner.Free()
+
+	// sealed packets can be decrypted with DecryptPacket
+	body, err := ls.SealPacket(nil, inner.RawBytes())
+	if assert.NoError(err) {
+		assert.Len(body, inner.Len()+ls.PacketOverhead())
+
+		pkt, err := r.DecryptPacket(lob.New(body))
+		if assert.NoError(err) && assert.NotNil(pkt) {
+			assert.Equal([]byte("Hello world!"), pkt.Body(nil))
+		}
+	}
+
+	// encrypted packets can be opened with OpenPacket
+	epkt, err := r.EncryptPacket(lob.New([]byte("Hello world!")))
+	if assert.NoError(err) {
+		plain, err := ls.OpenPacket([]byte("prefix"), epkt.Body(nil))
+		if assert.NoError(err) {
+			assert.Equal(append([]byte("prefix"), inner.RawBytes()...), plain)
+		}
+	}
+
+	// tampered packets are rejected
+	body, err = rs.SealPacket(nil, inner.RawBytes())
+	if assert.NoError(err) {
+		body[len(body)-1] ^= 1
+		_, err = ls.OpenPacket(nil, body)
+		assert.Equal(cipherset.ErrInvalidPacket, err)
+	}
+
+	// the hot path doesn't allocate
+	var (
+		sealed = make([]byte, 0, 1500)
+		opened = make([]byte, 0, 1500)
+	)
+	allocs := testing.AllocsPerRun(100, func() {
+		sealed, _ = ls.SealPacket(sealed[:0], inner.RawBytes())
+		opened, _ = rs.OpenPacket(opened[:0], sealed)
+	})
+	assert.Equal(float64(0), allocs)
+	assert.Equal(inner.RawBytes(), opened)
+}
+
+// packetSizes are the inner packet sizes used by the packet benchmarks; from
+// a bare ack to a full MTU sized packet.
+var packetSizes = []int{64, 512, 1024, 1400}
+
+func BenchmarkSealPacket(b *testing.B, c cipherset.Cipher) {
+	l, _, err := linkedStates(c)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	sealer, ok := l.(cipherset.PacketSealer)
+	if !ok {
+		b.Skip("state doesn't implement cipherset.PacketSealer")
+	}
+
+	for _, size := range packetSizes {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			var (
+				inner = bytes.Repeat([]byte{'x'}, size)
+				dst   = make([]byte, 0, 2048)
+			)
+
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				_, err := sealer.SealPacket(dst[:0], inner)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkOpenPacket(b *testing.B, c cipherset.Cipher) {
+	l, r, err := linkedStates(c)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	sealer, ok := l.(cipherset.PacketSealer)
+	if !ok {
+		b.Skip("state doesn't implement cipherset.PacketSealer")
+	}
+	opener := r.(cipherset.PacketSealer)
+
+	for _, size := range packetSizes {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			body, err := sealer.SealPacket(nil, bytes.Repeat([]byte{'x'}, size))
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			dst := make([]byte, 0, 2048)
+
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				_, err := opener.OpenPacket(dst[:0], body)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
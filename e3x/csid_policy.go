@@ -0,0 +1,79 @@
+package e3x
+
+import (
+	"errors"
+
+	"github.com/telehash/gogotelehash/e3x/cipherset"
+)
+
+var ErrCSIDNotAllowed = errors.New("e3x: cipher set is not allowed")
+
+// AllowCSIDs restricts the cipher sets used by the endpoint to csids (for
+// example AllowCSIDs(0x3a) for a "cs3a only" deployment).
+//
+// Local keys for other cipher sets are discarded; the hashname of the endpoint
+// is derived from the remaining keys. When the endpoint generates its keys
+// only keys for csids are generated. Handshakes from peers using other cipher
+// sets are dropped and exchanges with peers that have no key for any of csids
+// can't be created. Opening the endpoint fails with ErrCSIDNotAllowed when it
+// has no key for any of csids.
+func AllowCSIDs(csids ...uint8) EndpointOption {
+	return func(e *Endpoint) error {
+		if len(csids) == 0 {
+			return ErrCSIDNotAllowed
+		}
+
+		e.allowedCSIDs = make(map[uint8]bool, len(csids))
+		for _, csid := range csids {
+			e.allowedCSIDs[csid] = true
+		}
+
+		if len(e.keys) == 0 {
+			return nil
+		}
+
+		// re-apply the keys that were set by an earlier option
+		keys := e.keys
+		e.keys = nil
+		return Keys(keys)(e)
+	}
+}
+
+// csidAllowed returns true when the endpoint may use csid.
+func (e *Endpoint) csidAllowed(csid uint8) bool {
+	return e.allowedCSIDs == nil || e.allowedCSIDs[csid]
+}
+
+// allowedKeys returns the subset of keys the endpoint may use.
+func (e *Endpoint) allowedKeys(keys cipherset.Keys) cipherset.Keys {
+	if e.allowedCSIDs == nil {
+		return keys
+	}
+
+	allowed := make(cipherset.Keys, len(keys))
+	for csid, key := range keys {
+		if e.allowedCSIDs[csid] {
+			allowed[csid] = key
+		}
+	}
+	return allowed
+}
+
+// generateCSIDs returns the CSIDs for which the endpoint generates keys (nil
+// for all registered CSIDs).
+func (e *Endpoint) generateCSIDs() ([]uint8, error) {
+	if e.allowedCSIDs == nil {
+		return nil, nil
+	}
+
+	var csids []uint8
+	for _, csid := range cipherset.CSIDs() {
+		if e.allowedCSIDs[csid] {
+			csids = append(csids, csid)
+		}
+	}
+	if len(csids) == 0 {
+		return nil, ErrCSIDNotAllowed
+	}
+	return csids, nil
+}
@@ -0,0 +1,83 @@
+package e3x
+
+import (
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/e3x/cipherset"
+	"github.com/telehash/gogotelehash/transports/inproc"
+)
+
+func TestAllowCSIDs(t *testing.T) {
+	assert := assert.New(t)
+
+	keys, err := cipherset.GenerateKeys(0x1a, 0x3a)
+	if !assert.NoError(err) {
+		return
+	}
+
+	// the keys option may come before or after AllowCSIDs
+	for _, options := range [][]EndpointOption{
+		{AllowCSIDs(0x3a)},
+		{AllowCSIDs(0x3a), Keys(keys)},
+		{Keys(keys), AllowCSIDs(0x3a)},
+	} {
+		e, err := Open(append(options, Transport(inproc.Config{}))...)
+		if !assert.NoError(err) {
+			continue
+		}
+
+		assert.Len(e.keys, 1)
+		assert.NotNil(e.keys[0x3a])
+
+		ident, err := e.LocalIdentity()
+		assert.NoError(err)
+		assert.Len(ident.Keys(), 1)
+
+		e.Close()
+	}
+
+	_, err = Open(AllowCSIDs(0xff), Transport(inproc.Config{}))
+	assert.Equal(ErrCSIDNotAllowed, err)
+
+	_, err = Open(Keys(keys), AllowCSIDs(0xff), Transport(inproc.Config{}))
+	assert.Equal(ErrCSIDNotAllowed, err)
+}
+
+func TestAllowCSIDsPeers(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := Open(AllowCSIDs(0x3a), Transport(inproc.Config{}))
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := Open(Transport(inproc.Config{}))
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	C, err := Open(AllowCSIDs(0x1a), Transport(inproc.Config{}))
+	if !assert.NoError(err) {
+		return
+	}
+	defer C.Close()
+
+	identA, err := A.LocalIdentity()
+	assert.NoError(err)
+	identC, err := C.LocalIdentity()
+	assert.NoError(err)
+
+	// B supports cs3a
+	x, err := B.Dial(identA)
+	if assert.NoError(err) {
+		assert.Equal(uint8(0x3a), x.csid)
+	}
+
+	// A and C have no cipher set in common
+	_, err = A.Dial(identC)
+	assert.Equal(ErrCSIDNotAllowed, err)
+}
@@ -7,6 +7,7 @@ import (
 	"net"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/telehash/gogotelehash/e3x/cipherset"
 	"github.com/telehash/gogotelehash/internal/hashname"
@@ -42,6 +43,13 @@ type Endpoint struct {
 	transportConfig transports.Config
 	transport       transports.Transport
 	modules         map[interface{}]Module
+	openPolicy      OpenPolicy
+	channelLimit    ChannelLimit
+	replayGuard     *replayGuard
+	sessions        *sessionCache
+	allowedCSIDs    map[uint8]bool
+	allowDowngrade  bool
+	pathScorer      PathScorer
 
 	endpointHooks EndpointHooks
 	exchangeHooks ExchangeHooks
@@ -62,6 +70,8 @@ func Open(options ...EndpointOption) (*Endpoint, error) {
 		hashnames: make(map[hashname.H]*Exchange),
 	}
 
+	e.replayGuard = newReplayGuard(DefaultReplayPolicy)
+
 	e.listenerSet = newListenerSet()
 	e.listenerSet.addrFunc = func() net.Addr {
 		return e.LocalHashname()
@@ -76,7 +86,7 @@ func Open(options ...EndpointOption) (*Endpoint, error) {
 	e.exchangeHooks.Register(ExchangeHook{OnClosed: e.onExchangeClosed})
 
 	err := e.setOptions(
-		RegisterModule(modTransportsKey, &modTransports{e}),
+		RegisterModule(modTransportsKey, &modTransports{e: e}),
 		RegisterModule(modNetwatchKey, &modNetwatch{endpoint: e}))
 	if err != nil {
 		return nil, e.traceError(err)
@@ -89,7 +99,8 @@ func Open(options ...EndpointOption) (*Endpoint, error) {
 
 	err = e.setOptions(
 		defaultRandomKeys,
-		defaultTransport)
+		defaultTransport,
+		dynamicTransports)
 	if err != nil {
 		return nil, e.traceError(err)
 	}
@@ -224,6 +235,11 @@ func Keys(keys cipherset.Keys) EndpointOption {
 			return nil
 		}
 
+		keys = e.allowedKeys(keys)
+		if len(keys) == 0 {
+			return ErrCSIDNotAllowed
+		}
+
 		hn, err := hashname.FromKeys(keys)
 		if err != nil {
 			return err
@@ -240,12 +256,46 @@ func Keys(keys cipherset.Keys) EndpointOption {
 	}
 }
 
+// KeyStore loads the keys of the endpoint from store. New keys are generated
+// and saved when store is empty.
+func KeyStore(store cipherset.KeyStore) EndpointOption {
+	return func(e *Endpoint) error {
+		if e.keys != nil && len(e.keys) > 0 {
+			return nil
+		}
+
+		csids, err := e.generateCSIDs()
+		if err != nil {
+			return err
+		}
+
+		keys, err := cipherset.LoadOrGenerate(store, csids...)
+		if err != nil {
+			return err
+		}
+
+		return Keys(keys)(e)
+	}
+}
+
+// UnlockKeys loads the keys of the endpoint from the passphrase-encrypted key
+// file at path. passphrase is called once to unlock the file (or to encrypt it
+// when the file doesn't exist yet and new keys are generated).
+func UnlockKeys(path string, passphrase func() ([]byte, error)) EndpointOption {
+	return KeyStore(cipherset.NewEncryptedFileKeyStore(path, passphrase))
+}
+
 func defaultRandomKeys(e *Endpoint) error {
 	if e.keys != nil && len(e.keys) > 0 {
 		return nil
 	}
 
-	keys, err := cipherset.GenerateKeys()
+	csids, err := e.generateCSIDs()
+	if err != nil {
+		return err
+	}
+
+	keys, err := cipherset.GenerateKeys(csids...)
 	if err != nil {
 		return err
 	}
@@ -363,6 +413,7 @@ func (e *Endpoint) close() error {
 	for _, x := range e.tokens {
 		x.onBreak()
 	}
+	e.sessions.clear()
 
 	for _, mod := range e.modules {
 		err := mod.Stop()
@@ -438,6 +489,10 @@ func (e *Endpoint) accept(conn net.Conn) {
 		return
 	}
 
+	if e.resume(token, msg, conn) {
+		return
+	}
+
 	if raw := msg.RawBytes(); len(raw) < 3 || raw[0] != 0 || raw[1] != 1 {
 		if e.endpointHooks.DropPacket(msg.Get(nil), conn, nil) != ErrStopPropagation {
 			conn.Close()
@@ -464,6 +519,14 @@ func (e *Endpoint) accept(conn net.Conn) {
 		csid = msg.RawBytes()[2]
 		key  = e.keys[csid]
 	)
+	if !e.csidAllowed(csid) {
+		if e.endpointHooks.DropPacket(msg.Get(nil), conn, ErrCSIDNotAllowed) != ErrStopPropagation {
+			conn.Close()
+		}
+		e.traceDroppedPacket(msg.Get(nil), conn, ErrCSIDNotAllowed.Error())
+		msg.Free()
+		return // drop
+	}
 	if key == nil {
 		if e.endpointHooks.DropPacket(msg.Get(nil), conn, nil) != ErrStopPropagation {
 			conn.Close()
@@ -494,24 +557,39 @@ func (e *Endpoint) accept(conn net.Conn) {
 	}
 
 	exchange = e.hashnames[hn]
+	if exchange == nil {
+		if sess := e.sessions.take(hn); sess != nil {
+			exchange, err = resumeExchange(localIdent, nil, sess, e.log, registerEndpoint(e))
+			if err != nil {
+				e.sessions.restore(sess)
+				exchange = nil
+			} else {
+				e.hashnames[hn] = exchange
+				e.tokens[exchange.LocalToken()] = exchange
+				e.tokens[exchange.RemoteToken()] = exchange
+			}
+		}
+	}
 	if exchange != nil {
 		oldLocalToken := exchange.LocalToken()
 		oldRemoteToken := exchange.RemoteToken()
 		exchange.received(newMessage(msg, newPipe(e.transport, conn, nil, exchange)))
-		newLocalToken := exchange.LocalToken()
-		newRemoteToken := exchange.RemoteToken()
+		e.updateTokens(exchange, oldLocalToken, oldRemoteToken)
 
-		if oldLocalToken != newLocalToken {
-			delete(e.tokens, oldLocalToken)
-			e.tokens[newLocalToken] = exchange
-		}
+		return
+	}
 
-		if oldRemoteToken != newRemoteToken {
-			delete(e.tokens, oldRemoteToken)
-			e.tokens[newRemoteToken] = exchange
+	err = e.replayGuard.check(hn, handshake.At(), msg.RawBytes()[3:], time.Now())
+	if err == nil && !e.allowDowngrade {
+		err = checkDowngrade(e.keys, handshake.Parts(), csid)
+	}
+	if err != nil {
+		if e.endpointHooks.DropPacket(msg.Get(nil), conn, err) != ErrStopPropagation {
+			conn.Close()
 		}
-
-		return
+		e.traceDroppedPacket(msg.Get(nil), conn, err.Error())
+		msg.Free()
+		return // drop
 	}
 
 	exchange, err = newExchange(localIdent, nil, handshake, e.log, registerEndpoint(e))
@@ -531,6 +609,183 @@ func (e *Endpoint) accept(conn net.Conn) {
 	exchange.received(newMessage(msg, newPipe(e.transport, conn, nil, exchange)))
 }
 
+// resume restores the exchange that owns token from the session cache. It
+// returns false when no session was cached for token.
+//
+// Only a resume message resumes a session (see ResumePolicy). It must decrypt
+// with the cached line and carry an `at` value above the last one of the peer
+// that passes the replay guard; anyone who observed the cleartext token could
+// send a packet carrying it and anyone who captured packets of the line could
+// replay them. Other packets are dropped and the session is put back.
+// Handshakes are resumed by accept after they were decrypted.
+//
+// The path the resume message came from is not activated until the peer
+// answered the resume message of the exchange over it.
+func (e *Endpoint) resume(token cipherset.Token, msg *bufpool.Buffer, conn net.Conn) bool {
+	if raw := msg.RawBytes(); len(raw) < 2 || raw[0] != 0 || raw[1] != 0 {
+		return false
+	}
+
+	e.mtx.Lock()
+	sess := e.sessions.takeToken(token)
+	e.mtx.Unlock()
+
+	if sess == nil {
+		return false
+	}
+
+	var (
+		now    = time.Now()
+		remote = sess.remoteIdent.Hashname()
+		at     uint32
+	)
+
+	pkt, err := decryptPacket(sess.cipher, msg)
+	if err == nil {
+		var found bool
+		at, found = pkt.Header().GetUint32(resumeHeader)
+		pkt.Free()
+		if !found {
+			err = errNotResume
+		} else if at <= sess.lastRemoteSeq {
+			err = ErrResumeReplay
+		}
+	}
+	if err == nil {
+		err = e.replayGuard.check(remote, at, msg.RawBytes()[2:], now)
+	}
+	if err != nil {
+		e.sessions.restore(sess)
+		if e.endpointHooks.DropPacket(msg.Get(nil), conn, err) != ErrStopPropagation {
+			conn.Close()
+		}
+		e.traceDroppedPacket(msg.Get(nil), conn, err.Error())
+		msg.Free()
+		return true // drop
+	}
+
+	localIdent, err := e.LocalIdentity()
+	if err != nil {
+		e.sessions.restore(sess)
+		return false
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if x := e.hashnames[remote]; x != nil {
+		// the peer reconnected while the message was being decrypted
+		sess.wipe()
+		msg.Free()
+		return true
+	}
+
+	x, err := resumeExchange(localIdent, nil, sess, e.log, registerEndpoint(e))
+	if err != nil {
+		e.sessions.restore(sess)
+		return false
+	}
+
+	e.hashnames[remote] = x
+	e.tokens[x.LocalToken()] = x
+	e.tokens[x.RemoteToken()] = x
+
+	e.replayGuard.record(remote, at, msg.RawBytes()[2:], now)
+	msg.Free()
+
+	pipe := newPipe(e.transport, conn, nil, x)
+	x.addressBook.AddPipe(pipe)
+	x.answerResume(pipe, at)
+
+	return true
+}
+
+// updateTokens updates the token index after x applied a handshake.
+// e.mtx must be held by the caller.
+func (e *Endpoint) updateTokens(x *Exchange, oldLocalToken, oldRemoteToken cipherset.Token) {
+	newLocalToken := x.LocalToken()
+	newRemoteToken := x.RemoteToken()
+
+	if oldLocalToken != newLocalToken {
+		delete(e.tokens, oldLocalToken)
+		e.tokens[newLocalToken] = x
+	}
+
+	if oldRemoteToken != newRemoteToken {
+		delete(e.tokens, oldRemoteToken)
+		e.tokens[newRemoteToken] = x
+	}
+}
+
+// reroute passes a message that was read by a pipe of x to the exchange it
+// belongs to. This happens when multiple exchanges share a connection, for
+// example when multiple endpoints are reachable at the same address.
+// Messages that don't belong to any other exchange are left to x.
+//
+// Handshakes that don't match a known token are decrypted (outside e.mtx) to
+// find their sender. The decrypted handshake is kept in msg so the exchange
+// that handles it doesn't decrypt it again.
+func (e *Endpoint) reroute(x *Exchange, msg *message) bool {
+	conn := msg.Pipe.getConn()
+	if conn == nil {
+		return false
+	}
+
+	var (
+		raw   = msg.Data.RawBytes()
+		token = cipherset.ExtractToken(raw)
+	)
+
+	e.mtx.Lock()
+	y := e.tokens[token]
+	e.mtx.Unlock()
+
+	if y == nil && msg.IsHandshake {
+		key := e.keys[raw[2]]
+		if key == nil {
+			return false
+		}
+
+		handshake, err := cipherset.DecryptHandshake(raw[2], key, raw[3:])
+		if err != nil {
+			return false
+		}
+		msg.Handshake = handshake
+
+		hn, err := hashname.FromKeyAndIntermediates(raw[2],
+			handshake.PublicKey().Public(), handshake.Parts())
+		if err != nil {
+			return false
+		}
+
+		e.mtx.Lock()
+		y = e.hashnames[hn]
+		e.mtx.Unlock()
+	}
+
+	if y == nil || y == x {
+		return false
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	oldLocalToken := y.LocalToken()
+	oldRemoteToken := y.RemoteToken()
+	// prefer the pipe of y (the pipe of x is shared otherwise)
+	pipe := msg.Pipe
+	if p := y.addressBook.PipeToAddr(conn.RemoteAddr()); p != nil && p.getConn() == conn {
+		pipe = p
+	}
+
+	routed := newMessage(msg.Data, pipe)
+	routed.Handshake = msg.Handshake
+	y.dispatch(routed)
+	e.updateTokens(y, oldLocalToken, oldRemoteToken)
+
+	return true
+}
+
 func (e *Endpoint) onExchangeClosed(_ *Endpoint, x *Exchange, reason error) error {
 	e.mtx.Lock()
 	defer e.mtx.Unlock()
@@ -754,6 +1009,30 @@ func (e *Endpoint) CreateExchange(identity *Identity) (*Exchange, error) {
 		return nil, err
 	}
 
+	csid := cipherset.SelectCSID(localIdent.keys, identity.keys)
+	if csid == 0 && e.allowedCSIDs != nil {
+		return nil, ErrCSIDNotAllowed
+	}
+	if !e.allowDowngrade {
+		err = checkDowngrade(localIdent.keys, identity.parts, csid)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Resume the exchange from a cached line
+	if sess := e.sessions.take(identity.hashname); sess != nil {
+		x, err = resumeExchange(localIdent, identity, sess, e.log, registerEndpoint(e))
+		if err == nil {
+			e.tokens[x.LocalToken()] = x
+			e.tokens[x.RemoteToken()] = x
+			e.hashnames[identity.hashname] = x
+			x.startResume()
+			return x, nil
+		}
+		e.sessions.restore(sess)
+	}
+
 	// Make a new exchange struct
 	x, err = newExchange(localIdent, identity, nil, e.log, registerEndpoint(e))
 	if err != nil {
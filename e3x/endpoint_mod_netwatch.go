@@ -2,6 +2,7 @@ package e3x
 
 import (
 	"net"
+	"sync"
 	"time"
 
 	"github.com/telehash/gogotelehash/transports"
@@ -17,9 +18,13 @@ var (
 )
 
 type modNetwatch struct {
-	endpoint  *Endpoint
+	endpoint *Endpoint
+
+	mtx       sync.Mutex
 	timer     *time.Timer
 	addresses []net.Addr
+	external  []net.Addr
+	prefixes  map[string]bool
 }
 
 func (mod *modNetwatch) Init() error {
@@ -27,12 +32,18 @@ func (mod *modNetwatch) Init() error {
 }
 
 func (mod *modNetwatch) Start() error {
-	mod.update()
+	mod.mtx.Lock()
 	mod.timer = time.AfterFunc(interval, mod.update)
+	mod.mtx.Unlock()
+
+	mod.update()
 	return nil
 }
 
 func (mod *modNetwatch) Stop() error {
+	mod.mtx.Lock()
+	defer mod.mtx.Unlock()
+
 	if mod.timer != nil {
 		mod.timer.Stop()
 		mod.timer = nil
@@ -41,9 +52,14 @@ func (mod *modNetwatch) Stop() error {
 }
 
 func (mod *modNetwatch) update() {
-	if mod.timer != nil {
-		mod.timer.Reset(interval)
+	mod.mtx.Lock()
+	defer mod.mtx.Unlock()
+
+	// the module was stopped
+	if mod.timer == nil {
+		return
 	}
+	mod.timer.Reset(interval)
 
 	var (
 		addrs    = mod.endpoint.transport.Addrs()
@@ -98,4 +114,60 @@ func (mod *modNetwatch) update() {
 	if len(newAddrs) > 0 || len(oldAddrs) > 0 {
 		mod.endpoint.Hooks().NetChanged(newAddrs, oldAddrs)
 	}
+
+	// peers keep using the addresses of the old prefix until they receive
+	// a new handshake
+	prefixes := ipv6Prefixes(addrs)
+	if mod.prefixes != nil && !samePrefixes(prefixes, mod.prefixes) {
+		TransportsFromEndpoint(mod.endpoint).(*modTransports).announce()
+	}
+	mod.prefixes = prefixes
+
+	external := TransportsFromEndpoint(mod.endpoint).ExternalAddresses()
+	if !sameAddrs(external, mod.external) {
+		mod.external = external
+		mod.endpoint.Hooks().ExternalAddrsChanged(external)
+	}
+}
+
+// ipv6Prefixes returns the /64 prefixes of the global IPv6 addresses in addrs.
+func ipv6Prefixes(addrs []net.Addr) map[string]bool {
+	prefixes := make(map[string]bool)
+	for _, addr := range addrs {
+		host, _, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			continue
+		}
+		ip := net.ParseIP(host)
+		if ip == nil || ip.To4() != nil || !ip.IsGlobalUnicast() {
+			continue
+		}
+		prefixes[ip.Mask(net.CIDRMask(64, 128)).String()] = true
+	}
+	return prefixes
+}
+
+func samePrefixes(a, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for p := range a {
+		if !b[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// sameAddrs reports if a and b contain the same addresses.
+func sameAddrs(a, b []net.Addr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, x := range a {
+		if !containsAddr(b, x) {
+			return false
+		}
+	}
+	return true
 }
@@ -1,11 +1,18 @@
 package e3x
 
 import (
+	"errors"
+	"io"
 	"net"
+	"reflect"
+	"sync"
+	"time"
 
 	"github.com/telehash/gogotelehash/transports"
 )
 
+var ErrUnknownTransport = errors.New("e3x: unknown transport")
+
 // Transports exposes the Wrap method
 type Transports interface {
 	// Wrap must be called durring a Module.Init call. The existing endpoint
@@ -15,6 +22,24 @@ type Transports interface {
 
 	// LocalAddresses returns the list of discovered local addresses
 	LocalAddresses() []net.Addr
+
+	// Add opens an additional transport on the running endpoint. New handshakes
+	// are sent to all the peers so they learn about the new paths.
+	Add(config transports.Config) error
+
+	// Remove closes a transport that was previously added with Add.
+	Remove(config transports.Config) error
+
+	// ExternalAddresses returns the addresses at which the endpoint can be
+	// reached from the internet: the global addresses of the transports
+	// (including NAT mappings) and the addresses peers reported for the
+	// endpoint. Changes are reported with the OnExternalAddrsChanged hook.
+	ExternalAddresses() []net.Addr
+
+	// AddReflexiveAddress records addr as the address at which a peer sees
+	// the endpoint (like a STUN result). It replaces the previous reflexive
+	// address of the same network.
+	AddReflexiveAddress(addr net.Addr)
 }
 
 // TransportsFromEndpoint returns the Transports module for Endpoint.
@@ -29,7 +54,11 @@ func TransportsFromEndpoint(e *Endpoint) Transports {
 const modTransportsKey = pivateModKey("transports")
 
 type modTransports struct {
-	e *Endpoint
+	e         *Endpoint
+	transport *dynamicTransport
+
+	mtx       sync.Mutex
+	reflexive map[string]net.Addr
 }
 
 func (mod *modTransports) Init() error  { return nil }
@@ -43,3 +72,241 @@ func (mod *modTransports) Wrap(f func(transports.Config) transports.Config) {
 func (mod *modTransports) LocalAddresses() []net.Addr {
 	return mod.e.transport.Addrs()
 }
+
+func (mod *modTransports) ExternalAddresses() []net.Addr {
+	var addrs []net.Addr
+
+	for _, addr := range mod.LocalAddresses() {
+		if isGlobalAddr(addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	mod.mtx.Lock()
+	for _, addr := range mod.reflexive {
+		if !containsAddr(addrs, addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+	mod.mtx.Unlock()
+
+	return addrs
+}
+
+func (mod *modTransports) AddReflexiveAddress(addr net.Addr) {
+	mod.mtx.Lock()
+	if mod.reflexive == nil {
+		mod.reflexive = make(map[string]net.Addr)
+	}
+	mod.reflexive[addr.Network()] = addr
+	mod.mtx.Unlock()
+}
+
+// isGlobalAddr reports if addr has a public IP.
+func isGlobalAddr(addr net.Addr) bool {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
+
+func containsAddr(addrs []net.Addr, addr net.Addr) bool {
+	for _, x := range addrs {
+		if transports.EqualAddr(x, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (mod *modTransports) Add(config transports.Config) error {
+	if mod.transport == nil {
+		return ErrUnknownTransport
+	}
+
+	t, err := config.Open()
+	if err != nil {
+		return err
+	}
+
+	mod.transport.add(config, t)
+	mod.announce()
+	return nil
+}
+
+func (mod *modTransports) Remove(config transports.Config) error {
+	if mod.transport == nil {
+		return ErrUnknownTransport
+	}
+
+	err := mod.transport.remove(config)
+	if err != nil {
+		return err
+	}
+
+	mod.announce()
+	return nil
+}
+
+// announce sends new handshakes to all the peers.
+func (mod *modTransports) announce() {
+	for _, x := range mod.e.GetExchanges() {
+		if x.State().IsOpen() {
+			go x.onDeliverHandshake()
+		}
+	}
+}
+
+// dynamicTransports wraps the endpoint transport in a transport
+// to which transports can be added while the endpoint is running.
+func dynamicTransports(e *Endpoint) error {
+	mod := e.modules[modTransportsKey].(*modTransports)
+	e.transportConfig = &dynamicConfig{e.transportConfig, mod}
+	return nil
+}
+
+type dynamicConfig struct {
+	config transports.Config
+	mod    *modTransports
+}
+
+type dynamicTransport struct {
+	mtx     sync.RWMutex
+	entries []*dynamicEntry
+	cAccept chan net.Conn
+	wg      sync.WaitGroup
+}
+
+type dynamicEntry struct {
+	config    transports.Config
+	transport transports.Transport
+}
+
+func (c *dynamicConfig) Open() (transports.Transport, error) {
+	s, err := c.config.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	t := &dynamicTransport{cAccept: make(chan net.Conn)}
+	t.add(c.config, s)
+
+	c.mod.transport = t
+	return t, nil
+}
+
+func (t *dynamicTransport) add(config transports.Config, s transports.Transport) {
+	t.mtx.Lock()
+	t.entries = append(t.entries, &dynamicEntry{config, s})
+	t.wg.Add(1)
+	t.mtx.Unlock()
+
+	go t.runAccepter(s)
+}
+
+func (t *dynamicTransport) remove(config transports.Config) error {
+	var s transports.Transport
+
+	t.mtx.Lock()
+	for i, e := range t.entries {
+		if i > 0 && reflect.DeepEqual(e.config, config) {
+			s = e.transport
+			copy(t.entries[i:], t.entries[i+1:])
+			t.entries[len(t.entries)-1] = nil
+			t.entries = t.entries[:len(t.entries)-1]
+			break
+		}
+	}
+	t.mtx.Unlock()
+
+	if s == nil {
+		// the initial transport can't be removed
+		return ErrUnknownTransport
+	}
+
+	return s.Close()
+}
+
+func (t *dynamicTransport) list() []transports.Transport {
+	t.mtx.RLock()
+	l := make([]transports.Transport, len(t.entries))
+	for i, e := range t.entries {
+		l[i] = e.transport
+	}
+	t.mtx.RUnlock()
+	return l
+}
+
+func (t *dynamicTransport) Addrs() []net.Addr {
+	var addrs []net.Addr
+
+	for _, s := range t.list() {
+		addrs = append(addrs, s.Addrs()...)
+	}
+
+	return addrs
+}
+
+func (t *dynamicTransport) Dial(addr net.Addr) (net.Conn, error) {
+	for _, s := range t.list() {
+		conn, err := s.Dial(addr)
+		if err == transports.ErrInvalidAddr {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	}
+	return nil, transports.ErrInvalidAddr
+}
+
+func (t *dynamicTransport) Accept() (net.Conn, error) {
+	conn, ok := <-t.cAccept
+	if !ok {
+		return nil, io.EOF
+	}
+	return conn, nil
+}
+
+func (t *dynamicTransport) Close() error {
+	var lastErr error
+
+	t.mtx.Lock()
+	entries := t.entries
+	t.entries = nil
+	t.mtx.Unlock()
+
+	for _, e := range entries {
+		err := e.transport.Close()
+		if err != nil {
+			lastErr = err
+		}
+	}
+
+	t.wg.Wait()
+	close(t.cAccept)
+
+	return lastErr
+}
+
+func (t *dynamicTransport) runAccepter(s transports.Transport) {
+	defer t.wg.Done()
+	for {
+		conn, err := s.Accept()
+		if err == io.EOF {
+			break
+		}
+		if neterr, ok := err.(net.Error); ok && neterr.Temporary() {
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		t.cAccept <- conn
+	}
+}
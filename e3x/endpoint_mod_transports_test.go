@@ -0,0 +1,97 @@
+package e3x
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/transports"
+	"github.com/telehash/gogotelehash/transports/inproc"
+	"github.com/telehash/gogotelehash/transports/udp"
+)
+
+func TestHotTransports(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := Open(Transport(inproc.Config{}), DisableLog())
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := Open(Transport(udp.Config{Network: "udp4"}), DisableLog())
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	countUDP := func() int {
+		n := 0
+		for _, addr := range TransportsFromEndpoint(A).LocalAddresses() {
+			if addr.Network() == "udp4" {
+				n++
+			}
+		}
+		return n
+	}
+
+	assert.Equal(0, countUDP())
+
+	cfg := udp.Config{Network: "udp4", Addr: "127.0.0.1:0"}
+	assert.NoError(TransportsFromEndpoint(A).Add(cfg))
+	assert.Equal(1, countUDP())
+
+	ident, err := A.LocalIdentity()
+	assert.NoError(err)
+
+	x, err := B.Dial(ident)
+	if assert.NoError(err) {
+		assert.Equal("udp4", x.ActivePath().Network())
+	}
+
+	assert.NoError(TransportsFromEndpoint(A).Remove(cfg))
+	assert.Equal(0, countUDP())
+	assert.Equal(ErrUnknownTransport, TransportsFromEndpoint(A).Remove(cfg))
+	assert.Equal(ErrUnknownTransport, TransportsFromEndpoint(A).Remove(inproc.Config{}))
+}
+
+func TestExternalAddresses(t *testing.T) {
+	assert := assert.New(t)
+
+	changed := make(chan []net.Addr, 10)
+	hook := func(e *Endpoint) error {
+		e.Hooks().Register(EndpointHook{
+			OnExternalAddrsChanged: func(e *Endpoint, addrs []net.Addr) error {
+				changed <- addrs
+				return nil
+			},
+		})
+		return nil
+	}
+
+	A, err := Open(Transport(udp.Config{Network: "udp4", Addr: "127.0.0.1:0"}), DisableLog(), hook)
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	mod := TransportsFromEndpoint(A)
+	assert.Empty(mod.ExternalAddresses())
+
+	reflexive, err := transports.ResolveAddr("udp4", "203.0.113.7:42424")
+	if !assert.NoError(err) {
+		return
+	}
+	mod.AddReflexiveAddress(reflexive)
+
+	select {
+	case addrs := <-changed:
+		if assert.Len(addrs, 1) {
+			assert.True(transports.EqualAddr(reflexive, addrs[0]))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no OnExternalAddrsChanged event")
+	}
+}
@@ -1,6 +1,9 @@
 package e3x
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -66,3 +69,71 @@ func TestSimpleEndpoint(t *testing.T) {
 	err = eb.Close()
 	assert.NoError(err)
 }
+
+func TestEndpointKeyStore(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "e3x-keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := cipherset.NewFileKeyStore(filepath.Join(dir, "keys.json"))
+
+	_, err = store.Load()
+	assert.Equal(cipherset.ErrNoStoredKeys, err)
+
+	ea, err := Open(KeyStore(store), Transport(inproc.Config{}), DisableLog())
+	if !assert.NoError(err) {
+		return
+	}
+	hashname := ea.LocalHashname()
+	assert.NoError(ea.Close())
+
+	info, err := os.Stat(store.Path)
+	if assert.NoError(err) {
+		assert.Equal(os.FileMode(0600), info.Mode().Perm())
+	}
+
+	keys, err := store.Load()
+	assert.NoError(err)
+	assert.Len(keys, len(cipherset.CSIDs()))
+
+	// the identity survives a restart
+	eb, err := Open(KeyStore(store), Transport(inproc.Config{}), DisableLog())
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(hashname, eb.LocalHashname())
+	assert.NoError(eb.Close())
+}
+
+func TestEndpointUnlockKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "e3x-keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "keys.json")
+
+	ea, err := Open(UnlockKeys(path, cipherset.StaticPassphrase("secret")), Transport(inproc.Config{}), DisableLog())
+	if !assert.NoError(err) {
+		return
+	}
+	hashname := ea.LocalHashname()
+	assert.NoError(ea.Close())
+
+	_, err = Open(UnlockKeys(path, cipherset.StaticPassphrase("wrong")), Transport(inproc.Config{}), DisableLog())
+	assert.Equal(cipherset.ErrWrongPassphrase, err)
+
+	eb, err := Open(UnlockKeys(path, cipherset.StaticPassphrase("secret")), Transport(inproc.Config{}), DisableLog())
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(hashname, eb.LocalHashname())
+	assert.NoError(eb.Close())
+}
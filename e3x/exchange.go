@@ -20,6 +20,10 @@ import (
 
 var ErrInvalidHandshake = errors.New("e3x: invalid handshake")
 
+// cDialStagger is the delay between the initial handshakes that are sent
+// to the different paths of a dialing exchange.
+const cDialStagger = 250 * time.Millisecond
+
 type BrokenExchangeError hashname.H
 
 func (err BrokenExchangeError) Error() string {
@@ -91,9 +95,25 @@ type Exchange struct {
 	channelHooks  ChannelHooks
 
 	nextHandshake     int
+	probeUntil        time.Time
+	openPolicy        OpenPolicy
+	channelLimit      ChannelLimit
+	replayGuard       *replayGuard
+	allowDowngrade    bool
+	pathScorer        PathScorer
+	sessions          *sessionCache
+	resumeAt          uint32
+	inboundChannels   int32
+	pendingMtx        sync.Mutex
+	pendingChannels   []*lob.Packet
+	bandwidth         bandwidthMeter
 	tExpire           *time.Timer
 	tBreak            *time.Timer
 	tDeliverHandshake *time.Timer
+	tProbe            *time.Timer
+	probePipe         *Pipe
+	probeSentAt       time.Time
+	probeFailures     int
 }
 
 type ExchangeOption func(e *Exchange) error
@@ -121,6 +141,7 @@ func newExchange(
 	x.tBreak = time.AfterFunc(2*60*time.Second, x.onBreak)
 	x.tExpire = time.AfterFunc(60*time.Second, x.onExpire)
 	x.tDeliverHandshake = time.AfterFunc(60*time.Second, x.onDeliverHandshake)
+	x.tProbe = time.AfterFunc(cProbeInterval, x.onProbe)
 	x.resetExpire()
 	x.rescheduleHandshake()
 
@@ -146,6 +167,7 @@ func newExchange(
 		}
 
 		x.addressBook = newAddressBook(x.log)
+		x.addressBook.scorer = x.pathScorer
 		x.cipher = cipher
 		x.csid = csid
 
@@ -176,6 +198,7 @@ func newExchange(
 		x.cipher = cipher
 		x.csid = csid
 		x.addressBook = newAddressBook(x.log)
+		x.addressBook.scorer = x.pathScorer
 	}
 
 	return x, nil
@@ -196,6 +219,12 @@ func registerEndpoint(e *Endpoint) ExchangeOption {
 		x.listenerSet = e.listenerSet.Inherit()
 		x.exchangeHooks = e.exchangeHooks
 		x.channelHooks = e.channelHooks
+		x.openPolicy = e.openPolicy
+		x.channelLimit = e.channelLimit
+		x.replayGuard = e.replayGuard
+		x.allowDowngrade = e.allowDowngrade
+		x.pathScorer = e.pathScorer
+		x.sessions = e.sessions
 		x.exchangeHooks.exchange = x
 		x.channelHooks.exchange = x
 		return nil
@@ -382,6 +411,17 @@ func (x *Exchange) dialDialerAddr(addr dialerAddr) (net.Conn, error) {
 }
 
 func (x *Exchange) received(msg message) {
+	if !x.ownsMessage(msg) && msg.Pipe != nil {
+		if e, ok := x.endpoint.(*Endpoint); ok && e.reroute(x, &msg) {
+			return
+		}
+	}
+
+	x.dispatch(msg)
+}
+
+// dispatch handles a message that belongs to this exchange.
+func (x *Exchange) dispatch(msg message) {
 	if msg.IsHandshake {
 		x.receivedHandshake(msg)
 	} else {
@@ -391,12 +431,28 @@ func (x *Exchange) received(msg message) {
 	msg.Data.Free()
 }
 
+// ownsMessage returns false when msg carries the token of another exchange.
+func (x *Exchange) ownsMessage(msg message) bool {
+	if x.cipher == nil {
+		return true
+	}
+
+	token := cipherset.ExtractToken(msg.Data.RawBytes())
+	return token == cipherset.ZeroToken ||
+		token == x.cipher.LocalToken() ||
+		token == x.cipher.RemoteToken()
+}
+
 func (x *Exchange) onDeliverHandshake() {
 	x.mtx.Lock()
 	defer x.mtx.Unlock()
 
 	x.rescheduleHandshake()
 	x.deliverHandshake()
+
+	if x.state == ExchangeDialing {
+		go x.exchangeHooks.Unreachable()
+	}
 }
 
 func (x *Exchange) deliverHandshake() error {
@@ -412,6 +468,11 @@ func (x *Exchange) deliverHandshake() error {
 		return err
 	}
 
+	if x.state == ExchangeDialing {
+		x.raceHandshake(pktData, x.addressBook.HandshakePipes())
+		return nil
+	}
+
 	for _, pipe := range x.addressBook.HandshakePipes() {
 		_, err := pipe.Write(pktData)
 		if err == nil {
@@ -422,6 +483,107 @@ func (x *Exchange) deliverHandshake() error {
 	return nil
 }
 
+// raceHandshake sends the handshake to all pipes with staggered starts. The
+// first pipe to complete the handshake becomes the active pipe and any pending
+// attempts are abandoned. This prevents a broken path (like a blackholed IPv6
+// network or a slow TCP connect) from delaying the dial.
+func (x *Exchange) raceHandshake(pktData *bufpool.Buffer, pipes []*Pipe) {
+	var wg sync.WaitGroup
+
+	for i, pipe := range pipes {
+		wg.Add(1)
+		go func(pipe *Pipe, delay time.Duration) {
+			defer wg.Done()
+
+			if delay > 0 {
+				time.Sleep(delay)
+
+				x.mtx.Lock()
+				dialing := x.state == ExchangeDialing
+				x.mtx.Unlock()
+
+				if !dialing {
+					return
+				}
+			}
+
+			_, err := pipe.Write(pktData)
+			if err == nil {
+				x.addressBook.SentHandshake(pipe)
+			}
+		}(pipe, time.Duration(i)*cDialStagger)
+	}
+
+	go func() {
+		wg.Wait()
+		pktData.Free()
+	}()
+}
+
+// pathStalled is called by channels when the packets sent over p are no longer
+// being acknowledged. The exchange probes all the known paths with a fresh
+// handshake and migrates to the first path that responds. Channels deliver over
+// the active path so their pending packets are resent over the new path.
+func (x *Exchange) pathStalled(p *Pipe) {
+	x.mtx.Lock()
+	defer x.mtx.Unlock()
+
+	if !x.state.IsOpen() {
+		return
+	}
+
+	if p == nil {
+		p = x.addressBook.ActiveConnection()
+	}
+
+	if !x.addressBook.Stalled(p) {
+		return
+	}
+
+	x.probePaths()
+	go x.exchangeHooks.Unreachable()
+}
+
+// pathUnreachable fails over to an other path when the active path p was
+// reported unreachable by the network.
+func (x *Exchange) pathUnreachable(p *Pipe) {
+	x.mtx.Lock()
+	defer x.mtx.Unlock()
+
+	if !x.state.IsOpen() {
+		return
+	}
+
+	if !x.addressBook.Unreachable(p) {
+		return
+	}
+
+	x.probePaths()
+	go x.exchangeHooks.Unreachable()
+}
+
+// probePaths sends a fresh handshake over all the known paths and starts a
+// probe round. The first path to answer before the round times out becomes the
+// active path.
+func (x *Exchange) probePaths() error {
+	x.probeUntil = time.Now().Add(cProbeRoundTimeout)
+
+	pktData, err := x.generateHandshake(0)
+	if err != nil {
+		return err
+	}
+
+	for _, pipe := range x.addressBook.KnownPipes() {
+		_, err := pipe.Write(pktData)
+		if err == nil {
+			x.addressBook.SentHandshake(pipe)
+		}
+	}
+
+	pktData.Free()
+	return nil
+}
+
 func (x *Exchange) rescheduleHandshake() {
 	if x.nextHandshake <= 0 {
 		x.nextHandshake = 4
@@ -448,6 +610,7 @@ func (x *Exchange) receivedPacket(msg message) {
 		dropMissingChannelID      = "missing channel id header"
 		dropMissingChannelType    = "missing channel type header"
 		dropMissingChannelHandler = "missing channel handler"
+		dropTooManyChannels       = "too many channels"
 	)
 
 	{
@@ -462,21 +625,24 @@ func (x *Exchange) receivedPacket(msg message) {
 		}
 	}
 
-	pkt, err := lob.Decode(msg.Data)
-	if err != nil {
+	n := msg.Data.Len()
+
+	pkt2, err := x.decryptPacket(msg.Data)
+	if err == lob.ErrInvalidPacket {
 		x.exchangeHooks.DropPacket(msg.Data.Get(nil), msg.Pipe, nil)
 		x.traceDroppedPacket(msg, nil, dropInvalidPacket)
 		return // drop
 	}
-
-	pkt2, err := x.cipher.DecryptPacket(pkt)
-	pkt.Free()
 	if err != nil {
 		x.exchangeHooks.DropPacket(msg.Data.Get(nil), msg.Pipe, nil)
 		x.traceDroppedPacket(msg, nil, err.Error())
 		return // drop
 	}
 	pkt2.TID = msg.TID
+	if msg.Pipe != nil {
+		msg.Pipe.touch()
+	}
+
 	var (
 		hdr          = pkt2.Header()
 		cid, hasC    = hdr.C, hdr.HasC
@@ -485,6 +651,11 @@ func (x *Exchange) receivedPacket(msg message) {
 		c            *Channel
 	)
 
+	if !hasC && x.receivedResume(pkt2, msg) {
+		pkt2.Free()
+		return
+	}
+
 	if !hasC {
 		// drop: missing "c"
 		x.exchangeHooks.DropPacket(msg.Data.Get(nil), msg.Pipe, nil)
@@ -503,7 +674,7 @@ func (x *Exchange) receivedPacket(msg message) {
 				return // drop (missing typ)
 			}
 
-			listener := x.listenerSet.Get(typ)
+			listener := x.listenerSet.Lookup(typ)
 			if listener == nil {
 				addPromise.Cancel()
 				x.exchangeHooks.DropPacket(msg.Data.Get(nil), msg.Pipe, nil)
@@ -511,30 +682,60 @@ func (x *Exchange) receivedPacket(msg message) {
 				return // drop (no handler)
 			}
 
-			c = newChannel(
-				x.remoteIdent.Hashname(),
-				typ,
-				hasSeq,
-				true,
-				x,
-				registerExchange(x),
-			)
-			c.id = cid
-			addPromise.Add(c)
+			if !x.reserveChannel() {
+				addPromise.Cancel()
+
+				x.bandwidth.received(typ, n)
 
-			x.mtx.Lock()
-			x.resetExpire()
-			x.mtx.Unlock()
+				if x.queueChannel(pkt2) {
+					x.log.Printf("\x1B[33mQueued channel\x1B[0m %q %d", typ, cid)
+					return // queued
+				}
 
-			x.log.Printf("\x1B[32mOpened channel\x1B[0m %q %d", typ, cid)
-			c.channelHooks.Opened()
+				x.exchangeHooks.DropPacket(msg.Data.Get(nil), msg.Pipe, ErrTooManyChannels)
+				x.traceDroppedPacket(msg, pkt2, dropTooManyChannels)
+				x.log.Printf("\x1B[31mRejected channel\x1B[0m %q %d (too many channels)", typ, cid)
+				pkt2.Free()
+				x.rejectChannel(cid, hasSeq)
+				return // drop (too many channels)
+			}
 
-			listener.handle(c)
+			c = x.acceptChannel(addPromise, cid, typ, hasSeq, listener)
 		}
 	}
 
+	x.bandwidth.received(c.typ, n)
 	x.traceReceivedPacket(msg, pkt2)
-	c.receivedPacket(pkt2)
+	c.receivedPacket(pkt2, msg.Pipe)
+}
+
+// acceptChannel registers a channel that was opened by the remote endpoint
+// and passes it to its handler.
+func (x *Exchange) acceptChannel(
+	addPromise *channelSetAddPromise,
+	cid uint32, typ string, reliable bool,
+	listener channelHandler,
+) *Channel {
+	c := newChannel(
+		x.remoteIdent.Hashname(),
+		typ,
+		reliable,
+		true,
+		x,
+		registerExchange(x),
+	)
+	c.id = cid
+	addPromise.Add(c)
+
+	x.mtx.Lock()
+	x.resetExpire()
+	x.mtx.Unlock()
+
+	x.log.Printf("\x1B[32mOpened channel\x1B[0m %q %d", typ, cid)
+	c.channelHooks.Opened()
+
+	listener.handle(c)
+	return c
 }
 
 func (x *Exchange) deliverPacket(pkt *lob.Packet, p *Pipe) error {
@@ -551,23 +752,182 @@ func (x *Exchange) deliverPacket(pkt *lob.Packet, p *Pipe) error {
 		p = x.addressBook.ActiveConnection()
 	}
 
-	pkt2, err := x.cipher.EncryptPacket(pkt)
-	if err != nil {
-		return err
+	var typ string
+	if c := x.channels.Get(pkt.Header().C); c != nil {
+		typ = c.typ
 	}
 
-	msg, err := lob.Encode(pkt2)
-	pkt2.Free()
+	msg, err := x.encryptPacket(pkt)
 	if err != nil {
 		return err
 	}
 
-	_, err = p.Write(msg)
+	n := msg.Len()
+	_, err = p.WriteClass(msg, packetClass(pkt))
 	msg.Free()
 
+	if err == nil {
+		x.bandwidth.sent(typ, n)
+	}
+
 	return err
 }
 
+// deliverPackets sends a burst of packets over p (or the active path) and
+// returns the number of packets that were sent.
+func (x *Exchange) deliverPackets(pkts []*lob.Packet, p *Pipe) (int, error) {
+	if len(pkts) == 1 {
+		if err := x.deliverPacket(pkts[0], p); err != nil {
+			return 0, err
+		}
+		return 1, nil
+	}
+
+	x.mtx.Lock()
+	for x.state == ExchangeDialing {
+		x.cndState.Wait()
+	}
+	if !x.state.IsOpen() {
+		x.mtx.Unlock()
+		return 0, BrokenExchangeError(x.remoteIdent.Hashname())
+	}
+	x.mtx.Unlock()
+
+	if p == nil {
+		p = x.addressBook.ActiveConnection()
+	}
+
+	var (
+		msgs    = make([]*bufpool.Buffer, 0, len(pkts))
+		typs    = make([]string, 0, len(pkts))
+		classes = make([]Class, 0, len(pkts))
+	)
+
+	defer func() {
+		for _, msg := range msgs {
+			msg.Free()
+		}
+	}()
+
+	for _, pkt := range pkts {
+		var typ string
+		if c := x.channels.Get(pkt.Header().C); c != nil {
+			typ = c.typ
+		}
+
+		msg, err := x.encryptPacket(pkt)
+		if err != nil {
+			return 0, err
+		}
+
+		msgs = append(msgs, msg)
+		typs = append(typs, typ)
+		classes = append(classes, packetClass(pkt))
+	}
+
+	n, err := p.writeBatch(msgs, classes)
+	for i := 0; i < n; i++ {
+		x.bandwidth.sent(typs[i], msgs[i].Len())
+	}
+
+	return n, err
+}
+
+// packetClass returns the class of a channel packet. Packets that open or end
+// a channel or carry no data (acks, keepalives) are control packets.
+func packetClass(pkt *lob.Packet) Class {
+	hdr := pkt.Header()
+	if hdr.HasType || hdr.End || pkt.BodyLen() == 0 {
+		return ClassControl
+	}
+	return ClassBulk
+}
+
+// encryptPacket encrypts pkt and encodes the outer packet. States that
+// implement cipherset.PacketSealer encrypt directly into the outgoing buffer.
+func (x *Exchange) encryptPacket(pkt *lob.Packet) (*bufpool.Buffer, error) {
+	sealer, ok := x.cipher.(cipherset.PacketSealer)
+	if !ok {
+		return x.encryptPacketSlow(pkt)
+	}
+
+	inner, err := lob.Encode(pkt)
+	if err != nil {
+		return nil, err
+	}
+	defer inner.Free()
+
+	// the outer packet has an empty header
+	if 2+inner.Len()+sealer.PacketOverhead() > cap(inner.RawBytes()) {
+		return x.encryptPacketSlow(pkt)
+	}
+
+	msg := bufpool.New()
+	raw := append(msg.RawBytes()[:0], 0, 0)
+
+	raw, err = sealer.SealPacket(raw, inner.RawBytes())
+	if err != nil {
+		msg.Free()
+		return nil, err
+	}
+
+	msg.SetLen(len(raw))
+	return msg, nil
+}
+
+func (x *Exchange) encryptPacketSlow(pkt *lob.Packet) (*bufpool.Buffer, error) {
+	pkt2, err := x.cipher.EncryptPacket(pkt)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := lob.Encode(pkt2)
+	pkt2.Free()
+	return msg, err
+}
+
+// decryptPacket decodes the outer packet in data and decrypts it.
+func (x *Exchange) decryptPacket(data *bufpool.Buffer) (*lob.Packet, error) {
+	return decryptPacket(x.cipher, data)
+}
+
+// decryptPacket decodes the outer packet in data and decrypts it with cipher.
+// States that implement cipherset.PacketSealer decrypt directly from the
+// received buffer.
+func decryptPacket(cipher cipherset.State, data *bufpool.Buffer) (*lob.Packet, error) {
+	sealer, ok := cipher.(cipherset.PacketSealer)
+	if !ok {
+		pkt, err := lob.Decode(data)
+		if err != nil {
+			return nil, err
+		}
+
+		pkt2, err := cipher.DecryptPacket(pkt)
+		pkt.Free()
+		return pkt2, err
+	}
+
+	raw := data.RawBytes()
+	if len(raw) < 2 || raw[0] != 0 || raw[1] != 0 {
+		return nil, lob.ErrInvalidPacket
+	}
+
+	inner := bufpool.New()
+	defer inner.Free()
+
+	innerRaw, err := sealer.OpenPacket(inner.RawBytes()[:0], raw[2:])
+	if err != nil {
+		return nil, err
+	}
+	if cap(innerRaw) != cap(inner.RawBytes()) {
+		// the inner packet didn't fit in the buffer
+		return nil, cipherset.ErrInvalidPacket
+	}
+	inner.SetLen(len(innerRaw))
+
+	return lob.Decode(inner)
+}
+
 func (x *Exchange) expire(err error) {
 	x.mtx.Lock()
 	if x.state == ExchangeExpired || x.state == ExchangeBroken {
@@ -588,9 +948,15 @@ func (x *Exchange) expire(err error) {
 	x.tBreak.Stop()
 	x.tExpire.Stop()
 	x.tDeliverHandshake.Stop()
+	x.tProbe.Stop()
+
+	cipher := x.cipher
+	sess := x.suspend()
 
 	x.mtx.Unlock()
 
+	x.dropPendingChannels()
+
 	for _, c := range x.channels.All() {
 		c.onCloseDeadlineReached()
 	}
@@ -601,6 +967,15 @@ func (x *Exchange) expire(err error) {
 
 	x.traceStopped()
 	x.exchangeHooks.Closed(err)
+
+	// keep the line for session resumption or wipe the key material once the
+	// hooks are done with the exchange
+	if x.sessions.put(sess) {
+		return
+	}
+	if w, ok := cipher.(cipherset.Wiper); ok {
+		w.Wipe()
+	}
 }
 
 func (x *Exchange) getNextSeq() uint32 {
@@ -692,6 +1067,11 @@ func (x *Exchange) unregisterChannel(_ *Endpoint, _ *Exchange, c *Channel) error
 		x.mtx.Unlock()
 
 		x.log.Printf("\x1B[31mClosed channel\x1B[0m %q %d", c.typ, c.id)
+
+		if c.serverside {
+			x.releaseChannel()
+			go x.dequeueChannels()
+		}
 	}
 
 	return nil
@@ -785,6 +1165,31 @@ func (x *Exchange) AddPathCandidate(addr net.Addr) {
 	}
 }
 
+// PunchPaths adds the paths in addrs to the exchange and sends a handshake to
+// each of them at once. When the remote endpoint does the same, the packets
+// open the NAT mappings on both sides (hole punching).
+func (x *Exchange) PunchPaths(addrs []net.Addr) {
+	x.mtx.Lock()
+	defer x.mtx.Unlock()
+
+	pktData, err := x.generateHandshake(0)
+	if err != nil {
+		return
+	}
+
+	for _, addr := range addrs {
+		p := x.addressBook.PipeToAddr(addr)
+		if p == nil {
+			p = newPipe(x.endpoint.getTransport(), nil, addr, x)
+			x.addressBook.AddPipe(p)
+		}
+
+		if _, err := p.Write(pktData); err == nil {
+			x.addressBook.SentHandshake(p)
+		}
+	}
+}
+
 // GenerateHandshake can be used to generate a new handshake packet.
 // This is useful when the exchange doesn't know where to send the handshakes yet.
 func (x *Exchange) GenerateHandshake() (*bufpool.Buffer, error) {
@@ -873,6 +1278,16 @@ func (x *Exchange) applyHandshake(handshake cipherset.Handshake, pipe *Pipe) (re
 		return nil, false
 	}
 
+	if !x.allowDowngrade && checkDowngrade(x.localIdent.keys, handshake.Parts(), x.csid) != nil {
+		// drop; a stronger cipher set is available
+		return nil, false
+	}
+
+	if x.exchangeHooks.Handshake(handshake) != nil {
+		// drop; handshake was rejected by a hook
+		return nil, false
+	}
+
 	if !x.cipher.ApplyHandshake(handshake) {
 		// drop; handshake was rejected by the cipherset
 		return nil, false
@@ -895,6 +1310,12 @@ func (x *Exchange) applyHandshake(handshake cipherset.Handshake, pipe *Pipe) (re
 		x.resetBreak()
 		x.addressBook.ReceivedHandshake(pipe)
 
+		if x.state == ExchangeDialing || x.isProbing() {
+			// first path to complete the handshake wins the race
+			x.addressBook.Activate(pipe)
+			x.probeUntil = time.Time{}
+		}
+
 	} else {
 		x.addressBook.AddPipe(pipe)
 
@@ -918,6 +1339,17 @@ func (x *Exchange) applyHandshake(handshake cipherset.Handshake, pipe *Pipe) (re
 	return response, true
 }
 
+// handshakeHashname returns the hashname of the sender of handshake.
+func (x *Exchange) handshakeHashname(handshake cipherset.Handshake) hashname.H {
+	if x.remoteIdent != nil {
+		return x.remoteIdent.Hashname()
+	}
+
+	hn, _ := hashname.FromKeyAndIntermediates(handshake.CSID(),
+		handshake.PublicKey().Public(), handshake.Parts())
+	return hn
+}
+
 func (x *Exchange) receivedHandshake(msg message) bool {
 	x.mtx.Lock()
 	defer x.mtx.Unlock()
@@ -951,13 +1383,29 @@ func (x *Exchange) receivedHandshake(msg message) bool {
 	}
 	csid = uint8(hdr.Bytes[0])
 
-	handshake, err = cipherset.DecryptHandshake(csid, x.localIdent.keys[csid], pkt.Body(buf[:0]))
+	// the endpoint may have decrypted the handshake already to route it
+	handshake = msg.Handshake
+	if handshake == nil {
+		handshake, err = cipherset.DecryptHandshake(csid, x.localIdent.keys[csid], pkt.Body(buf[:0]))
+	}
 	if err != nil {
 		x.exchangeHooks.DropPacket(msg.Data.Get(nil), msg.Pipe, err)
 		x.traceDroppedHandshake(msg, nil, err.Error())
 		return false
 	}
 
+	var (
+		now    = time.Now()
+		remote = x.handshakeHashname(handshake)
+	)
+
+	err = x.replayGuard.check(remote, handshake.At(), pkt.Body(nil), now)
+	if err != nil {
+		x.exchangeHooks.DropPacket(msg.Data.Get(nil), msg.Pipe, err)
+		x.traceDroppedHandshake(msg, handshake, err.Error())
+		return false
+	}
+
 	resp, ok := x.applyHandshake(handshake, msg.Pipe)
 	if !ok {
 		x.exchangeHooks.DropPacket(msg.Data.Get(nil), msg.Pipe, nil)
@@ -966,6 +1414,8 @@ func (x *Exchange) receivedHandshake(msg message) bool {
 	}
 
 	x.lastRemoteSeq = handshake.At()
+	x.replayGuard.record(remote, handshake.At(), pkt.Body(nil), now)
+	msg.Pipe.touch()
 
 	if resp != nil {
 		msg.Pipe.Write(resp)
@@ -13,15 +13,19 @@ import (
 const (
 	cMaxAddressBookEntries = 16
 	cNumBackupAddresses    = 3
+	cFailoverInterval      = 5 * time.Second
+	cFailoverPenalty       = 2 * time.Second
 )
 
 type addressBook struct {
 	log *logs.Logger
 
-	mtx         sync.RWMutex
-	active      *addressBookEntry
-	known       []*addressBookEntry
-	unsupported []string
+	mtx          sync.RWMutex
+	active       *addressBookEntry
+	known        []*addressBookEntry
+	unsupported  []string
+	lastFailover time.Time
+	scorer       PathScorer // nil means DefaultPathScorer
 }
 
 const (
@@ -40,6 +44,8 @@ type addressBookEntry struct {
 
 	latency time.Duration
 	ewma    time.Duration
+	weight  int
+	score   float64
 }
 
 func newAddressBook(log *logs.Logger) *addressBook {
@@ -141,11 +147,12 @@ func (book *addressBook) NextHandshakeEpoch() {
 		// reset
 		e.SendHandshakeAt = time.Time{}
 		e.ReceivedHandshakeAt = time.Time{}
+		e.UpdateWeight()
 
 	}
 
-	// sort by state and latency
-	sort.Sort(sortedAddressBookEntries(book.known))
+	// sort by state, weight and latency
+	book.sort()
 
 	// trim
 	if len(book.known) > cMaxAddressBookEntries {
@@ -174,6 +181,88 @@ func (book *addressBook) NextHandshakeEpoch() {
 
 }
 
+// Activate makes p the active path when it is a known path.
+func (book *addressBook) Activate(p *Pipe) {
+	book.mtx.Lock()
+	defer book.mtx.Unlock()
+
+	idx := book.indexOfPipe(p)
+	if idx < 0 {
+		return
+	}
+
+	e := book.known[idx]
+	if e == book.active {
+		return
+	}
+
+	book.log.Printf("\x1B[32mChanged path\x1B[0m from %s to %s", book.active, e)
+	book.active = e
+}
+
+// Stalled marks p as stalled when p is the active path and an other path is
+// known. The stalled path is penalized so that it will only become active again
+// once it performs better than the alternatives. Stalled returns true when
+// the alternate paths should be probed.
+func (book *addressBook) Stalled(p *Pipe) bool {
+	book.mtx.Lock()
+	defer book.mtx.Unlock()
+
+	var (
+		now = time.Now()
+		old = book.active
+	)
+
+	if old == nil || old.Pipe != p || len(book.known) < 2 {
+		return false
+	}
+
+	if now.Sub(book.lastFailover) < cFailoverInterval {
+		return false
+	}
+
+	old.AddLatencySample(cFailoverPenalty)
+	book.lastFailover = now
+	book.sort()
+
+	book.log.Printf("\x1B[33mDetected stalled path\x1B[0m %s", old)
+	return true
+}
+
+// Unreachable marks p as unreachable after the network reported that its
+// remote end can't be reached. When p is the active path the best reachable
+// alternative becomes active; p becomes reachable again when it completes a
+// handshake. Unreachable returns true when p was the active path and the
+// other paths should be probed.
+func (book *addressBook) Unreachable(p *Pipe) bool {
+	book.mtx.Lock()
+	defer book.mtx.Unlock()
+
+	idx := book.indexOfPipe(p)
+	if idx < 0 {
+		return false
+	}
+
+	e := book.known[idx]
+	if e.Reachable {
+		e.Reachable = false
+		book.log.Printf("\x1B[31mDetected unreachable path\x1B[0m %s", e)
+	}
+
+	book.sort()
+
+	if e != book.active {
+		return false
+	}
+
+	if alt := book.known[0]; alt != e && alt.Reachable {
+		book.log.Printf("\x1B[32mChanged path\x1B[0m from %s to %s", e, alt)
+		book.active = alt
+	}
+
+	return true
+}
+
 func (book *addressBook) PipeToAddr(addr net.Addr) *Pipe {
 	book.mtx.RLock()
 	var (
@@ -196,6 +285,10 @@ func (book *addressBook) AddPipe(p *Pipe) {
 	book.mtx.Lock()
 	defer book.mtx.Unlock()
 
+	book.addPipe(p)
+}
+
+func (book *addressBook) addPipe(p *Pipe) {
 	var (
 		now = time.Now()
 		idx = book.indexOfPipe(p)
@@ -212,6 +305,7 @@ func (book *addressBook) AddPipe(p *Pipe) {
 	e.Reachable = true
 	e.IsBackup = true
 	e.InitSamples()
+	e.UpdateWeight()
 
 	book.known = append(book.known, e)
 	book.log.Printf("\x1B[32mDiscovered path\x1B[0m %s (latency=\x1B[33m%s\x1B[0m, emwa=\x1B[33m%s\x1B[0m)", e, e.latency, e.ewma)
@@ -248,7 +342,7 @@ func (book *addressBook) ReceivedHandshake(p *Pipe) {
 	)
 
 	if idx < 0 {
-		book.AddPipe(p)
+		book.addPipe(p)
 		return
 	}
 
@@ -288,11 +382,41 @@ func (a *addressBookEntry) AddLatencySample(d time.Duration) {
 	a.ewma = time.Duration(ewma_α*float64(d) + (1.0-ewma_α)*float64(a.ewma))
 }
 
+// UpdateWeight copies the weight of the connection of the path (see
+// transports.WeightedConn). Paths that were not dialed yet have weight 0.
+func (a *addressBookEntry) UpdateWeight() {
+	if a.Pipe == nil {
+		return
+	}
+	if conn := a.Pipe.getConn(); conn != nil {
+		a.weight = transports.ConnWeight(conn)
+	}
+}
+
 func (a *addressBookEntry) InitSamples() {
 	a.latency = 125 * time.Millisecond
 	a.ewma = 125 * time.Millisecond
 }
 
+// sort scores the paths and orders them by reachability and score.
+func (book *addressBook) sort() {
+	scorer := book.scorer
+	if scorer == nil {
+		scorer = DefaultPathScorer
+	}
+
+	for _, e := range book.known {
+		e.score = scorer.ScorePath(PathInfo{
+			Addr:    e.Address,
+			Class:   ClassifyPath(e.Address),
+			Latency: e.ewma,
+			Weight:  e.weight,
+		})
+	}
+
+	sort.Sort(sortedAddressBookEntries(book.known))
+}
+
 type sortedAddressBookEntries []*addressBookEntry
 
 func (s sortedAddressBookEntries) Len() int      { return len(s) }
@@ -306,5 +430,5 @@ func (s sortedAddressBookEntries) Less(i, j int) bool {
 		return false
 	}
 
-	return s[i].ewma < s[j].ewma
+	return s[i].score > s[j].score
 }
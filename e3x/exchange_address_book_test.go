@@ -0,0 +1,162 @@
+package e3x
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+)
+
+func TestAddressBookStalled(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		book = newAddressBook(nil)
+		pa   = newPipe(nil, nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4001}, nil)
+		pb   = newPipe(nil, nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4002}, nil)
+	)
+
+	book.AddPipe(pa)
+
+	// no alternate paths
+	assert.False(book.Stalled(pa))
+
+	book.AddPipe(pb)
+	assert.Equal(pa, book.ActiveConnection())
+
+	// not the active path
+	assert.False(book.Stalled(pb))
+
+	assert.True(book.Stalled(pa))
+
+	// rate limited
+	assert.False(book.Stalled(pa))
+
+	// the active path only changes when an alternate path responds
+	assert.Equal(pa, book.ActiveConnection())
+	book.Activate(pb)
+	assert.Equal(pb, book.ActiveConnection())
+
+	// the stalled path must not be restored by the next epoch
+	book.NextHandshakeEpoch()
+	assert.Equal(pb, book.ActiveConnection())
+}
+
+func TestAddressBookUnreachable(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		book = newAddressBook(nil)
+		pa   = newPipe(nil, nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4001}, nil)
+		pb   = newPipe(nil, nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4002}, nil)
+		pc   = newPipe(nil, nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4003}, nil)
+	)
+
+	book.AddPipe(pa)
+	book.AddPipe(pb)
+	book.AddPipe(pc)
+	assert.Equal(pa, book.ActiveConnection())
+
+	// not the active path
+	assert.False(book.Unreachable(pb))
+	assert.Equal(pa, book.ActiveConnection())
+
+	// fail over to the reachable path at once
+	assert.True(book.Unreachable(pa))
+	assert.Equal(pc, book.ActiveConnection())
+
+	// the active path is kept when there is no reachable alternative
+	assert.True(book.Unreachable(pc))
+	assert.Equal(pc, book.ActiveConnection())
+}
+
+func TestAddressBookActivate(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		book = newAddressBook(nil)
+		pa   = newPipe(nil, nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4001}, nil)
+		pb   = newPipe(nil, nil, &net.UDPAddr{IP: net.IPv6loopback, Port: 4001}, nil)
+		pc   = newPipe(nil, nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4003}, nil)
+	)
+
+	book.AddPipe(pa)
+	book.AddPipe(pb)
+	assert.Equal(pa, book.ActiveConnection())
+
+	book.Activate(pb)
+	assert.Equal(pb, book.ActiveConnection())
+
+	// unknown pipe
+	book.Activate(pc)
+	assert.Equal(pb, book.ActiveConnection())
+}
+
+func TestAddressBookWeight(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		book  = newAddressBook(nil)
+		ca, _ = net.Pipe()
+		cb, _ = net.Pipe()
+		pa    = newPipe(nil, ca, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4001}, nil)
+		pb    = newPipe(nil, &weightedConn{cb, 10}, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4002}, nil)
+		pc    = newPipe(nil, nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4003}, nil)
+	)
+	defer pa.Close()
+	defer pb.Close()
+
+	book.AddPipe(pa)
+	book.AddPipe(pb)
+	book.AddPipe(pc)
+	assert.Equal(pa, book.ActiveConnection())
+
+	// the path with the higher weight is preferred even when it is slower
+	for _, e := range book.known {
+		if e.Pipe == pb {
+			e.AddLatencySample(time.Second)
+		}
+	}
+	book.NextHandshakeEpoch()
+	assert.Equal(pb, book.ActiveConnection())
+}
+
+func TestAddressBookScorer(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		book = newAddressBook(nil)
+		pa   = newPipe(nil, nil, &net.UDPAddr{IP: net.IPv4(203, 0, 113, 7), Port: 4001}, nil)
+		pb   = newPipe(nil, nil, &net.UDPAddr{IP: net.IPv4(192, 168, 1, 10), Port: 4001}, nil)
+	)
+
+	assert.Equal(PathWAN, ClassifyPath(pa.RemoteAddr()))
+	assert.Equal(PathLAN, ClassifyPath(pb.RemoteAddr()))
+	assert.Equal(PathLoopback, ClassifyPath(&net.UDPAddr{IP: net.IPv6loopback, Port: 4001}))
+
+	book.AddPipe(pa)
+	book.AddPipe(pb)
+	assert.Equal(pa, book.ActiveConnection())
+
+	// LAN paths are preferred over WAN paths even when they are slower
+	for _, e := range book.known {
+		if e.Pipe == pb {
+			e.AddLatencySample(time.Second)
+		}
+	}
+	book.NextHandshakeEpoch()
+	assert.Equal(pb, book.ActiveConnection())
+
+	// only latency counts
+	book.scorer = PathScorerFunc(func(p PathInfo) float64 { return -p.Latency.Seconds() })
+	book.NextHandshakeEpoch()
+	assert.Equal(pa, book.ActiveConnection())
+}
+
+type weightedConn struct {
+	net.Conn
+	weight int
+}
+
+func (c *weightedConn) Weight() int { return c.weight }
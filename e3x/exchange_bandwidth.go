@@ -0,0 +1,120 @@
+package e3x
+
+import (
+	"sync"
+
+	"github.com/telehash/gogotelehash/internal/hashname"
+)
+
+// Bandwidth holds the traffic counters of an exchange or a channel type.
+// Bytes are counted on the wire (encrypted packets). Handshakes are not included.
+type Bandwidth struct {
+	BytesIn    uint64
+	BytesOut   uint64
+	PacketsIn  uint64
+	PacketsOut uint64
+}
+
+func (b *Bandwidth) add(o Bandwidth) {
+	b.BytesIn += o.BytesIn
+	b.BytesOut += o.BytesOut
+	b.PacketsIn += o.PacketsIn
+	b.PacketsOut += o.PacketsOut
+}
+
+// BandwidthStats is a snapshot of the traffic with a remote endpoint.
+type BandwidthStats struct {
+	Hashname hashname.H
+	Total    Bandwidth
+	Types    map[string]Bandwidth // by channel type
+}
+
+type bandwidthMeter struct {
+	mtx   sync.Mutex
+	types map[string]*Bandwidth
+}
+
+func (m *bandwidthMeter) get(typ string) *Bandwidth {
+	if m.types == nil {
+		m.types = make(map[string]*Bandwidth)
+	}
+
+	b := m.types[typ]
+	if b == nil {
+		b = &Bandwidth{}
+		m.types[typ] = b
+	}
+
+	return b
+}
+
+func (m *bandwidthMeter) received(typ string, n int) {
+	m.mtx.Lock()
+	b := m.get(typ)
+	b.BytesIn += uint64(n)
+	b.PacketsIn++
+	m.mtx.Unlock()
+
+	statExchangeRcvBytes.Add(int64(n))
+}
+
+func (m *bandwidthMeter) sent(typ string, n int) {
+	m.mtx.Lock()
+	b := m.get(typ)
+	b.BytesOut += uint64(n)
+	b.PacketsOut++
+	m.mtx.Unlock()
+
+	statExchangeSndBytes.Add(int64(n))
+}
+
+func (m *bandwidthMeter) snapshot() (total Bandwidth, types map[string]Bandwidth) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	types = make(map[string]Bandwidth, len(m.types))
+	for typ, b := range m.types {
+		types[typ] = *b
+		total.add(*b)
+	}
+
+	return total, types
+}
+
+// Bandwidth returns the traffic counters of the exchange.
+func (x *Exchange) Bandwidth() BandwidthStats {
+	total, types := x.bandwidth.snapshot()
+	return BandwidthStats{
+		Hashname: x.RemoteHashname(),
+		Total:    total,
+		Types:    types,
+	}
+}
+
+// Bandwidth returns the traffic counters of all the exchanges of the endpoint.
+func (e *Endpoint) Bandwidth() []BandwidthStats {
+	exchanges := e.GetExchanges()
+
+	l := make([]BandwidthStats, 0, len(exchanges))
+	for _, x := range exchanges {
+		l = append(l, x.Bandwidth())
+	}
+
+	return l
+}
+
+// BandwidthByType returns the traffic counters of the endpoint grouped by channel type.
+func (e *Endpoint) BandwidthByType() map[string]Bandwidth {
+	types := make(map[string]Bandwidth)
+
+	for _, x := range e.GetExchanges() {
+		_, t := x.bandwidth.snapshot()
+		for typ, b := range t {
+			sum := types[typ]
+			sum.add(b)
+			types[typ] = sum
+		}
+	}
+
+	return types
+}
@@ -0,0 +1,80 @@
+package e3x
+
+import (
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/internal/lob"
+)
+
+func TestBandwidthMeter(t *testing.T) {
+	assert := assert.New(t)
+
+	var m bandwidthMeter
+	m.sent("ping", 100)
+	m.sent("ping", 50)
+	m.received("ping", 70)
+	m.received("peers", 30)
+
+	total, types := m.snapshot()
+	assert.Equal(Bandwidth{BytesIn: 100, BytesOut: 150, PacketsIn: 2, PacketsOut: 2}, total)
+	assert.Equal(Bandwidth{BytesIn: 70, BytesOut: 150, PacketsIn: 1, PacketsOut: 2}, types["ping"])
+	assert.Equal(Bandwidth{BytesIn: 30, PacketsIn: 1}, types["peers"])
+}
+
+func TestBandwidth(t *testing.T) {
+	withTwoEndpoints(t, func(A, B *Endpoint) {
+		var (
+			assert = assert.New(t)
+			done   = make(chan bool)
+		)
+
+		l := A.Listen("ping", false)
+		defer l.Close()
+
+		go func() {
+			defer close(done)
+
+			c, err := l.AcceptChannel()
+			if err != nil {
+				return
+			}
+			defer c.Kill()
+
+			pkt, err := c.ReadPacket()
+			if err == nil {
+				pkt.Free()
+				c.WritePacket(lob.New([]byte("pong")))
+			}
+		}()
+
+		ident, err := A.LocalIdentity()
+		assert.NoError(err)
+
+		c, err := B.Open(ident, "ping", false)
+		if !assert.NoError(err) {
+			return
+		}
+		defer c.Kill()
+
+		assert.NoError(c.WritePacket(lob.New([]byte("ping"))))
+		_, err = c.ReadPacket()
+		assert.NoError(err)
+		<-done
+
+		stats := B.Bandwidth()
+		if assert.Len(stats, 1) {
+			assert.Equal(A.LocalHashname(), stats[0].Hashname)
+			ping := stats[0].Types["ping"]
+			assert.Equal(uint64(1), ping.PacketsOut)
+			assert.Equal(uint64(1), ping.PacketsIn)
+			assert.True(ping.BytesOut > 4)
+			assert.True(ping.BytesIn > 4)
+		}
+
+		ping := A.BandwidthByType()["ping"]
+		assert.Equal(uint64(1), ping.PacketsIn)
+		assert.Equal(uint64(1), ping.PacketsOut)
+	})
+}
@@ -0,0 +1,154 @@
+package e3x
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/telehash/gogotelehash/internal/lob"
+)
+
+var ErrTooManyChannels = errors.New("e3x: too many channels")
+
+// ChannelOverflowPolicy determines what happens to channels that are opened
+// by a peer that already reached the channel limit.
+type ChannelOverflowPolicy uint8
+
+const (
+	// RejectChannels responds to the open packet with an error.
+	RejectChannels ChannelOverflowPolicy = iota
+	// QueueChannels holds the open packet until one of the open channels is closed.
+	QueueChannels
+)
+
+// ChannelLimit caps the number of channels a single peer can have open
+// at the same time. Channels opened by the local endpoint are not counted.
+type ChannelLimit struct {
+	// Max is the number of concurrently open inbound channels per exchange.
+	// Zero means unlimited.
+	Max int
+
+	// Overflow is the policy applied to channels that exceed Max.
+	Overflow ChannelOverflowPolicy
+
+	// QueueSize is the number of channels that can be queued with QueueChannels.
+	// Channels beyond the queue are rejected. Defaults to Max.
+	QueueSize int
+}
+
+// LimitChannels sets the per-exchange channel limit of the endpoint.
+func LimitChannels(limit ChannelLimit) EndpointOption {
+	return func(e *Endpoint) error {
+		if limit.QueueSize <= 0 {
+			limit.QueueSize = limit.Max
+		}
+		e.channelLimit = limit
+		return nil
+	}
+}
+
+// reserveChannel reserves a slot for an inbound channel. It returns false
+// when the limit was reached.
+func (x *Exchange) reserveChannel() bool {
+	n := atomic.AddInt32(&x.inboundChannels, 1)
+	if x.channelLimit.Max > 0 && int(n) > x.channelLimit.Max {
+		atomic.AddInt32(&x.inboundChannels, -1)
+		return false
+	}
+	return true
+}
+
+func (x *Exchange) releaseChannel() {
+	atomic.AddInt32(&x.inboundChannels, -1)
+}
+
+// queueChannel holds the open packet of a channel until a slot is released.
+// It returns false when the channel must be rejected instead.
+func (x *Exchange) queueChannel(pkt *lob.Packet) bool {
+	if x.channelLimit.Overflow != QueueChannels {
+		return false
+	}
+
+	x.pendingMtx.Lock()
+	defer x.pendingMtx.Unlock()
+
+	cid := pkt.Header().C
+	for _, p := range x.pendingChannels {
+		if p.Header().C == cid {
+			// retransmitted open packet
+			pkt.Free()
+			return true
+		}
+	}
+
+	if len(x.pendingChannels) >= x.channelLimit.QueueSize {
+		return false
+	}
+
+	x.pendingChannels = append(x.pendingChannels, pkt)
+	return true
+}
+
+// dequeueChannels opens the queued channels for which a slot is available.
+func (x *Exchange) dequeueChannels() {
+	for {
+		if !x.reserveChannel() {
+			return
+		}
+
+		x.pendingMtx.Lock()
+		if len(x.pendingChannels) == 0 {
+			x.pendingMtx.Unlock()
+			x.releaseChannel()
+			return
+		}
+		pkt := x.pendingChannels[0]
+		copy(x.pendingChannels, x.pendingChannels[1:])
+		x.pendingChannels[len(x.pendingChannels)-1] = nil
+		x.pendingChannels = x.pendingChannels[:len(x.pendingChannels)-1]
+		x.pendingMtx.Unlock()
+
+		hdr := pkt.Header()
+
+		c, addPromise := x.channels.GetOrAdd(hdr.C)
+		if c != nil {
+			x.releaseChannel()
+			c.receivedPacket(pkt, nil)
+			continue
+		}
+
+		listener := x.listenerSet.Lookup(hdr.Type)
+		if listener == nil {
+			addPromise.Cancel()
+			x.releaseChannel()
+			pkt.Free()
+			continue
+		}
+
+		c = x.acceptChannel(addPromise, hdr.C, hdr.Type, hdr.HasSeq, listener)
+		c.receivedPacket(pkt, nil)
+	}
+}
+
+// dropPendingChannels forgets all the queued channels.
+func (x *Exchange) dropPendingChannels() {
+	x.pendingMtx.Lock()
+	pending := x.pendingChannels
+	x.pendingChannels = nil
+	x.pendingMtx.Unlock()
+
+	for _, pkt := range pending {
+		pkt.Free()
+	}
+}
+
+// rejectChannel notifies the peer that channel cid was not opened.
+func (x *Exchange) rejectChannel(cid uint32, reliable bool) {
+	pkt := &lob.Packet{}
+	hdr := pkt.Header()
+	hdr.C, hdr.HasC = cid, true
+	if reliable {
+		hdr.Seq, hdr.HasSeq = cInitialSeq, true
+	}
+	hdr.SetString("err", ErrTooManyChannels.Error())
+	x.deliverPacket(pkt, nil)
+}
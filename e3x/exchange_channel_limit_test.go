@@ -0,0 +1,110 @@
+package e3x
+
+import (
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/internal/lob"
+)
+
+func TestChannelLimitReject(t *testing.T) {
+	withTwoEndpoints(t, func(A, B *Endpoint) {
+		A.setOptions(LimitChannels(ChannelLimit{Max: 1}))
+
+		assert := assert.New(t)
+
+		l := A.Listen("limited", true)
+		defer l.Close()
+
+		ident, err := A.LocalIdentity()
+		assert.NoError(err)
+
+		c1, err := B.Open(ident, "limited", true)
+		if !assert.NoError(err) {
+			return
+		}
+		defer c1.Kill()
+		assert.NoError(c1.WritePacket(lob.New([]byte("one"))))
+
+		s1, err := l.AcceptChannel()
+		if !assert.NoError(err) {
+			return
+		}
+		defer s1.Kill()
+
+		c2, err := B.Open(ident, "limited", true)
+		if !assert.NoError(err) {
+			return
+		}
+		defer c2.Kill()
+		assert.NoError(c2.WritePacket(lob.New([]byte("two"))))
+
+		pkt, err := c2.ReadPacket()
+		if assert.NoError(err) {
+			reason, _ := pkt.Header().GetString("err")
+			assert.Equal(ErrTooManyChannels.Error(), reason)
+		}
+	})
+}
+
+func TestChannelLimitQueue(t *testing.T) {
+	withTwoEndpoints(t, func(A, B *Endpoint) {
+		A.setOptions(LimitChannels(ChannelLimit{Max: 1, Overflow: QueueChannels}))
+
+		assert := assert.New(t)
+
+		l := A.Listen("limited", true)
+		defer l.Close()
+
+		ident, err := A.LocalIdentity()
+		assert.NoError(err)
+
+		c1, err := B.Open(ident, "limited", true)
+		if !assert.NoError(err) {
+			return
+		}
+		defer c1.Kill()
+		assert.NoError(c1.WritePacket(lob.New([]byte("one"))))
+
+		s1, err := l.AcceptChannel()
+		if !assert.NoError(err) {
+			return
+		}
+
+		c2, err := B.Open(ident, "limited", true)
+		if !assert.NoError(err) {
+			return
+		}
+		defer c2.Kill()
+		assert.NoError(c2.WritePacket(lob.New([]byte("two"))))
+
+		accepted := make(chan *Channel, 1)
+		go func() {
+			c, err := l.AcceptChannel()
+			if err == nil {
+				accepted <- c
+			}
+		}()
+
+		select {
+		case <-accepted:
+			t.Fatal("expected the second channel to be queued")
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		s1.Kill()
+
+		select {
+		case s2 := <-accepted:
+			defer s2.Kill()
+			pkt, err := s2.ReadPacket()
+			if assert.NoError(err) {
+				assert.Equal("two", string(pkt.Body(nil)))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the second channel to be accepted")
+		}
+	})
+}
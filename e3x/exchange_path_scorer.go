@@ -0,0 +1,81 @@
+package e3x
+
+import (
+	"net"
+	"time"
+)
+
+// PathClass is the kind of network a path runs over.
+type PathClass uint8
+
+const (
+	PathRelay    PathClass = iota // bridged by a router
+	PathWAN                       // the internet (or an unknown network)
+	PathLAN                       // a private or link-local network
+	PathLoopback                  // the local host
+)
+
+// ClassifyPath returns the class of the path to addr.
+func ClassifyPath(addr net.Addr) PathClass {
+	if _, ok := addr.(dialerAddr); ok {
+		return PathRelay
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return PathWAN
+	}
+
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return PathWAN
+	case ip.IsLoopback():
+		return PathLoopback
+	case ip.IsPrivate() || ip.IsLinkLocalUnicast():
+		return PathLAN
+	default:
+		return PathWAN
+	}
+}
+
+// PathInfo describes a reachable path of an exchange.
+type PathInfo struct {
+	Addr    net.Addr
+	Class   PathClass
+	Latency time.Duration // smoothed handshake round trip time
+	Weight  int           // see transports.WeightedConn
+}
+
+// PathScorer scores the reachable paths of an exchange. The path with the
+// highest score becomes the active path.
+type PathScorer interface {
+	ScorePath(p PathInfo) float64
+}
+
+// PathScorerFunc adapts a function to the PathScorer interface.
+type PathScorerFunc func(p PathInfo) float64
+
+// ScorePath calls f.
+func (f PathScorerFunc) ScorePath(p PathInfo) float64 { return f(p) }
+
+// DefaultPathScorer prefers paths with a higher transport weight, then paths
+// over the local host over LAN paths over WAN paths over relayed paths, and
+// then paths with a lower latency.
+var DefaultPathScorer PathScorer = PathScorerFunc(defaultPathScore)
+
+func defaultPathScore(p PathInfo) float64 {
+	ms := float64(p.Latency) / float64(time.Millisecond)
+	if ms > 99999 {
+		ms = 99999
+	}
+	return float64(p.Weight)*1e6 + float64(p.Class)*1e5 - ms
+}
+
+// ScorePaths sets the path scorer of all the exchanges of the endpoint.
+func ScorePaths(scorer PathScorer) EndpointOption {
+	return func(e *Endpoint) error {
+		e.pathScorer = scorer
+		return nil
+	}
+}
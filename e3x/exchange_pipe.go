@@ -4,7 +4,10 @@ import (
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/telehash/gogotelehash/e3x/cipherset"
 	"github.com/telehash/gogotelehash/internal/util/bufpool"
 	"github.com/telehash/gogotelehash/internal/util/tracer"
 	"github.com/telehash/gogotelehash/transports"
@@ -18,6 +21,7 @@ type Pipe struct {
 	transport transports.Transport
 	raddr     net.Addr
 	conn      net.Conn
+	lastRecv  int64 // unix nanoseconds; accessed atomically
 }
 
 type message struct {
@@ -25,17 +29,44 @@ type message struct {
 	Data        *bufpool.Buffer
 	Pipe        *Pipe
 	IsHandshake bool
+
+	// Handshake is the decrypted handshake when the endpoint already
+	// decrypted it to route the message.
+	Handshake cipherset.Handshake
 }
 
 type pipeDelegate interface {
 	received(msg message)
 	dialDialerAddr(dialerAddr) (net.Conn, error)
+
+	// pathUnreachable is called when the network reported that the remote end
+	// of p can't be reached (see transports.ErrUnreachable).
+	pathUnreachable(p *Pipe)
 }
 
 type dialerAddr interface {
 	Dial(e *Endpoint, x *Exchange) (net.Conn, error)
 }
 
+// Class is the priority class the sender gives a message.
+type Class uint8
+
+const (
+	// ClassControl messages keep exchanges and channels alive: handshakes,
+	// acks, keepalives and channel opens and ends.
+	ClassControl Class = iota
+
+	// ClassBulk messages carry channel data.
+	ClassBulk
+)
+
+// ClassWriter is implemented by connections that relay messages through
+// routers (like bridge routes). WriteClass is used instead of Write so the
+// routers can send control messages before bulk messages.
+type ClassWriter interface {
+	WriteClass(b []byte, class Class) (int, error)
+}
+
 func newMessage(msg *bufpool.Buffer, p *Pipe) message {
 	raw := msg.RawBytes()
 
@@ -44,7 +75,7 @@ func newMessage(msg *bufpool.Buffer, p *Pipe) message {
 		isHandshake = true
 	}
 
-	return message{tracer.NewID(), msg, p, isHandshake}
+	return message{TID: tracer.NewID(), Data: msg, Pipe: p, IsHandshake: isHandshake}
 }
 
 func newPipe(t transports.Transport, conn net.Conn, addr net.Addr, delegate pipeDelegate) *Pipe {
@@ -116,19 +147,104 @@ func (p *Pipe) dial() (net.Conn, error) {
 	return conn, nil
 }
 
+func (p *Pipe) getConn() net.Conn {
+	p.mtx.RLock()
+	conn := p.conn
+	p.mtx.RUnlock()
+	return conn
+}
+
+// touch records that a message was received over p.
+func (p *Pipe) touch() {
+	atomic.StoreInt64(&p.lastRecv, time.Now().UnixNano())
+}
+
+// lastReceived returns the time the last message was received over p.
+func (p *Pipe) lastReceived() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&p.lastRecv))
+}
+
 func (p *Pipe) RemoteAddr() net.Addr {
 	return p.raddr
 }
 
+// LocalAddr returns the local address of the connection of p. It returns nil
+// when p is not connected yet.
+func (p *Pipe) LocalAddr() net.Addr {
+	if conn := p.getConn(); conn != nil {
+		return conn.LocalAddr()
+	}
+	return nil
+}
+
+// Write writes a control message.
 func (p *Pipe) Write(b *bufpool.Buffer) (int, error) {
+	return p.WriteClass(b, ClassControl)
+}
+
+// WriteClass writes a message of class.
+func (p *Pipe) WriteClass(b *bufpool.Buffer, class Class) (int, error) {
 	conn, err := p.dial()
 	if err != nil {
 		return 0, err
 	}
 
+	if cw, ok := conn.(ClassWriter); ok {
+		return cw.WriteClass(b.RawBytes(), class)
+	}
+
 	return conn.Write(b.RawBytes())
 }
 
+// WriteBatch writes bufs in order and returns the number of buffers that were
+// written. The buffers are sent with a single call when the transport can
+// send batches (see transports.BatchWriter).
+func (p *Pipe) WriteBatch(bufs []*bufpool.Buffer) (int, error) {
+	return p.writeBatch(bufs, nil)
+}
+
+// writeBatch is WriteBatch where classes[i] is the class of bufs[i]. Buffers
+// without a class are control messages.
+func (p *Pipe) writeBatch(bufs []*bufpool.Buffer, classes []Class) (int, error) {
+	conn, err := p.dial()
+	if err != nil {
+		return 0, err
+	}
+
+	var sent int
+
+	if _, ok := p.raddr.(dialerAddr); !ok && p.transport != nil {
+		msgs := make([]transports.Message, len(bufs))
+		for i, b := range bufs {
+			msgs[i] = transports.Message{Data: b.RawBytes(), Addr: p.raddr}
+		}
+
+		sent, err = transports.WriteMessages(p.transport, msgs)
+		if err != transports.ErrInvalidAddr {
+			return sent, err
+		}
+	}
+
+	cw, _ := conn.(ClassWriter)
+	for i, b := range bufs[sent:] {
+		if cw != nil {
+			class := ClassControl
+			if sent+i < len(classes) {
+				class = classes[sent+i]
+			}
+			_, err = cw.WriteClass(b.RawBytes(), class)
+		} else {
+			_, err = conn.Write(b.RawBytes())
+		}
+		if err != nil {
+			return sent, err
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
 func (p *Pipe) Close() error {
 	var (
 		conn   net.Conn
@@ -172,6 +288,13 @@ func (p *Pipe) reader(conn net.Conn) {
 		buf := bufpool.New()
 
 		n, err := conn.Read(buf.RawBytes()[:1500])
+		if err == transports.ErrUnreachable {
+			buf.Free()
+			if p.delegate != nil {
+				p.delegate.pathUnreachable(p)
+			}
+			continue
+		}
 		if err != nil {
 			buf.Free()
 			return
@@ -0,0 +1,94 @@
+package e3x
+
+import (
+	"time"
+)
+
+const (
+	// cProbeInterval is the time after which an idle active path is probed
+	// with a handshake.
+	cProbeInterval = 15 * time.Second
+
+	// cMaxProbeFailures is the number of consecutive unanswered probes after
+	// which the active path is considered dead.
+	cMaxProbeFailures = 3
+
+	// cProbeRoundTimeout is the time the known paths have to answer the
+	// handshakes sent by probePaths. Handshakes received later don't move the
+	// active path.
+	cProbeRoundTimeout = 5 * time.Second
+)
+
+// onProbe probes the active path when nothing was received over it for
+// cProbeInterval. NAT mappings expire silently; without probing an idle
+// exchange would only notice a dead path when it breaks. After
+// cMaxProbeFailures unanswered probes the path is marked unreachable and the
+// exchange fails over to another path.
+func (x *Exchange) onProbe() {
+	x.mtx.Lock()
+	defer x.mtx.Unlock()
+
+	if x.state == ExchangeExpired || x.state == ExchangeBroken {
+		return
+	}
+	x.tProbe.Reset(cProbeInterval)
+
+	if !x.state.IsOpen() {
+		return
+	}
+
+	p := x.addressBook.ActiveConnection()
+	if p == nil {
+		return
+	}
+
+	var (
+		now  = time.Now()
+		last = p.lastReceived()
+	)
+
+	if p != x.probePipe {
+		x.probePipe, x.probeSentAt, x.probeFailures = p, time.Time{}, 0
+	}
+
+	if !x.probeSentAt.IsZero() {
+		if last.Before(x.probeSentAt) {
+			x.probeFailures++
+		} else {
+			x.probeFailures = 0
+		}
+		x.probeSentAt = time.Time{}
+	}
+
+	if x.probeFailures >= cMaxProbeFailures {
+		x.log.Printf("\x1B[31mDetected dead path\x1B[0m %s", p.RemoteAddr())
+		x.probeFailures = 0
+
+		if x.addressBook.Unreachable(p) {
+			x.probePaths()
+			go x.exchangeHooks.Unreachable()
+		}
+		return
+	}
+
+	if now.Sub(last) < cProbeInterval {
+		return // not idle
+	}
+
+	pktData, err := x.generateHandshake(0)
+	if err != nil {
+		return
+	}
+	defer pktData.Free()
+
+	if _, err := p.Write(pktData); err == nil {
+		x.addressBook.SentHandshake(p)
+		x.probeSentAt = now
+	}
+}
+
+// isProbing returns true while a probe round started by probePaths is waiting
+// for its first answer.
+func (x *Exchange) isProbing() bool {
+	return time.Now().Before(x.probeUntil)
+}
@@ -0,0 +1,88 @@
+package e3x
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+)
+
+func TestExchangeProbe(t *testing.T) {
+	withTwoEndpoints(t, func(A, B *Endpoint) {
+		assert := assert.New(t)
+
+		ident, err := A.LocalIdentity()
+		assert.NoError(err)
+
+		x, err := B.Dial(ident)
+		if !assert.NoError(err) {
+			return
+		}
+
+		x.mtx.Lock()
+		p := x.addressBook.ActiveConnection()
+		x.mtx.Unlock()
+		if !assert.NotNil(p) {
+			return
+		}
+
+		// a recently used path is not probed
+		x.onProbe()
+		x.mtx.Lock()
+		assert.True(x.probeSentAt.IsZero())
+		x.mtx.Unlock()
+
+		// an idle path is probed
+		atomic.StoreInt64(&p.lastRecv, 0)
+		x.onProbe()
+		x.mtx.Lock()
+		sentAt := x.probeSentAt
+		x.mtx.Unlock()
+		if !assert.False(sentAt.IsZero()) {
+			return
+		}
+
+		// the peer answers the probe
+		deadline := time.Now().Add(2 * time.Second)
+		for p.lastReceived().Before(sentAt) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.False(p.lastReceived().Before(sentAt))
+
+		// unanswered probes count as failures
+		x.mtx.Lock()
+		x.probeSentAt = time.Now().Add(time.Hour)
+		x.mtx.Unlock()
+		x.onProbe()
+		x.mtx.Lock()
+		assert.Equal(1, x.probeFailures)
+		x.mtx.Unlock()
+	})
+}
+
+func TestExchangeProbeRoundTimeout(t *testing.T) {
+	withTwoEndpoints(t, func(A, B *Endpoint) {
+		assert := assert.New(t)
+
+		ident, err := A.LocalIdentity()
+		assert.NoError(err)
+
+		x, err := B.Dial(ident)
+		if !assert.NoError(err) {
+			return
+		}
+
+		x.mtx.Lock()
+		defer x.mtx.Unlock()
+
+		assert.False(x.isProbing())
+
+		assert.NoError(x.probePaths())
+		assert.True(x.isProbing())
+
+		// no path answered in time
+		x.probeUntil = time.Now().Add(-time.Millisecond)
+		assert.False(x.isProbing())
+	})
+}
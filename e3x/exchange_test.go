@@ -0,0 +1,45 @@
+package e3x
+
+import (
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/internal/lob"
+)
+
+func TestExchangeWipesCipher(t *testing.T) {
+	withTwoEndpoints(t, func(A, B *Endpoint) {
+		assert := assert.New(t)
+
+		ident, err := A.LocalIdentity()
+		assert.NoError(err)
+
+		x, err := B.Dial(ident)
+		if !assert.NoError(err) {
+			return
+		}
+
+		x.mtx.Lock()
+		cipher := x.cipher
+		x.mtx.Unlock()
+
+		assert.True(cipher.CanEncryptPacket())
+		assert.True(cipher.CanDecryptPacket())
+
+		x.onBreak()
+
+		assert.False(cipher.CanEncryptPacket())
+		assert.False(cipher.CanDecryptPacket())
+		assert.False(cipher.CanEncryptMessage())
+	})
+}
+
+func TestPacketClass(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(ClassControl, packetClass(lob.New(nil).SetHeader(lob.Header{HasType: true, Type: "stream", HasC: true, C: 1})))
+	assert.Equal(ClassControl, packetClass(lob.New(nil).SetHeader(lob.Header{HasC: true, C: 1, HasAck: true, Ack: 4})))
+	assert.Equal(ClassControl, packetClass(lob.New([]byte("bye")).SetHeader(lob.Header{HasC: true, C: 1, HasEnd: true, End: true})))
+	assert.Equal(ClassBulk, packetClass(lob.New([]byte("data")).SetHeader(lob.Header{HasC: true, C: 1, HasSeq: true, Seq: 5})))
+}
@@ -13,6 +13,8 @@ var (
 	statChannelSndPkt       *expvar.Int
 	statChannelSndAckInline *expvar.Int
 	statChannelSndAckAdHoc  *expvar.Int
+	statExchangeRcvBytes    *expvar.Int
+	statExchangeSndBytes    *expvar.Int
 )
 
 func init() {
@@ -29,6 +31,8 @@ func resetStats() {
 	statChannelSndPkt = new(expvar.Int)
 	statChannelSndAckInline = new(expvar.Int)
 	statChannelSndAckAdHoc = new(expvar.Int)
+	statExchangeRcvBytes = new(expvar.Int)
+	statExchangeSndBytes = new(expvar.Int)
 
 	statsMap.Set("channel.rcv.pkt", statChannelRcvPkt)
 	statsMap.Set("channel.rcv.pkt.drop", statChannelRcvPktDrop)
@@ -37,4 +41,6 @@ func resetStats() {
 	statsMap.Set("channel.snd.pkt", statChannelSndPkt)
 	statsMap.Set("channel.snd.ack.inline", statChannelSndAckInline)
 	statsMap.Set("channel.snd.ack.ad-hoc", statChannelSndAckAdHoc)
+	statsMap.Set("exchange.rcv.bytes", statExchangeRcvBytes)
+	statsMap.Set("exchange.snd.bytes", statExchangeSndBytes)
 }
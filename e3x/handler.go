@@ -0,0 +1,43 @@
+package e3x
+
+import (
+	"errors"
+)
+
+var ErrHandlerRegistered = errors.New("e3x: handler is already registered")
+
+// Handler handles channels that were opened by remote endpoints.
+type Handler interface {
+	ServeTelehash(c *Channel)
+}
+
+// HandlerFunc is an adapter to allow the use of ordinary functions as handlers.
+type HandlerFunc func(c *Channel)
+
+// ServeTelehash calls f(c).
+func (f HandlerFunc) ServeTelehash(c *Channel) {
+	f(c)
+}
+
+type handlerAdapter struct {
+	h Handler
+}
+
+func (a handlerAdapter) handle(c *Channel) {
+	go a.h.ServeTelehash(c)
+}
+
+// AddHandler registers h for channels of type typ. Handlers accept both
+// reliable and unreliable channels and each channel is served on its own
+// goroutine. AddHandler can be called while the endpoint is running; the handler
+// is used for all channels that are opened after the call returns.
+func (e *Endpoint) AddHandler(typ string, h Handler) error {
+	return e.listenerSet.AddHandler(typ, h)
+}
+
+// RemoveHandler unregisters the handler for channels of type typ. Channels
+// that are already being served are not affected. It returns false when no
+// handler was registered.
+func (e *Endpoint) RemoveHandler(typ string) bool {
+	return e.listenerSet.RemoveHandler(typ)
+}
@@ -0,0 +1,58 @@
+package e3x
+
+import (
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/internal/lob"
+)
+
+func TestDynamicHandlers(t *testing.T) {
+	options := []EndpointOption{ChannelOpenPolicy(OpenPolicy{
+		RetryInterval:   50 * time.Millisecond,
+		MaxRetries:      3,
+		RetryUnreliable: true,
+	})}
+	withTwoEndpointsOptions(t, options, func(A, B *Endpoint) {
+
+		var (
+			assert = assert.New(t)
+			served = make(chan string, 1)
+		)
+
+		err := A.AddHandler("echo", HandlerFunc(func(c *Channel) {
+			defer c.Kill()
+
+			pkt, err := c.ReadPacket()
+			if err != nil {
+				return
+			}
+			served <- string(pkt.Body(nil))
+			c.WritePacket(lob.New(nil))
+		}))
+		assert.NoError(err)
+		assert.Equal(ErrHandlerRegistered, A.AddHandler("echo", HandlerFunc(nil)))
+
+		ident, err := A.LocalIdentity()
+		assert.NoError(err)
+
+		c, err := B.Open(ident, "echo", false)
+		if assert.NoError(err) {
+			assert.NoError(c.WritePacket(lob.New([]byte("hello"))))
+			assert.Equal("hello", <-served)
+			c.Kill()
+		}
+
+		assert.True(A.RemoveHandler("echo"))
+		assert.False(A.RemoveHandler("echo"))
+
+		c, err = B.Open(ident, "echo", false)
+		if assert.NoError(err) {
+			assert.NoError(c.WritePacket(lob.New([]byte("hello"))))
+			_, err = c.ReadPacket()
+			assert.IsType(&BrokenChannelError{}, err)
+		}
+	})
+}
@@ -0,0 +1,37 @@
+package e3x
+
+import (
+	"errors"
+
+	"github.com/telehash/gogotelehash/e3x/cipherset"
+)
+
+var ErrCipherDowngrade = errors.New("e3x: cipher set downgrade")
+
+// DisableDowngradeProtection allows exchanges to use a weaker cipher set than
+// the strongest one both peers support.
+//
+// The parts of a handshake list every cipher set of the sender and are part of
+// the authenticated handshake message. By default a handshake is rejected when
+// both endpoints have a key for a stronger cipher set (a higher CSID) than the
+// one it uses. Likewise dialing fails when the remote identity lists the part
+// of a stronger common cipher set but not its key. This prevents an active
+// attacker from stripping keys from an identity to force the exchange onto a
+// weaker cipher set.
+func DisableDowngradeProtection() EndpointOption {
+	return func(e *Endpoint) error {
+		e.allowDowngrade = true
+		return nil
+	}
+}
+
+// checkDowngrade returns ErrCipherDowngrade when keys has a key for a CSID in
+// parts that is higher than csid.
+func checkDowngrade(keys cipherset.Keys, parts cipherset.Parts, csid uint8) error {
+	for id := range parts {
+		if id > csid && keys[id] != nil {
+			return ErrCipherDowngrade
+		}
+	}
+	return nil
+}
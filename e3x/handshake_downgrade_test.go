@@ -0,0 +1,77 @@
+package e3x
+
+import (
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/e3x/cipherset"
+	"github.com/telehash/gogotelehash/transports/inproc"
+)
+
+func TestCheckDowngrade(t *testing.T) {
+	assert := assert.New(t)
+
+	keys, err := cipherset.GenerateKeys(0x1a, 0x3a)
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.NoError(checkDowngrade(keys, cipherset.Parts{0x1a: "a", 0x3a: "b"}, 0x3a))
+	assert.NoError(checkDowngrade(keys, cipherset.Parts{0x1a: "a"}, 0x1a))
+	assert.NoError(checkDowngrade(keys, cipherset.Parts{0x1a: "a", 0x4a: "b"}, 0x1a))
+	assert.Equal(ErrCipherDowngrade, checkDowngrade(keys, cipherset.Parts{0x1a: "a", 0x3a: "b"}, 0x1a))
+}
+
+func TestDowngradeProtection(t *testing.T) {
+	assert := assert.New(t)
+
+	open := func(options ...EndpointOption) *Endpoint {
+		e, err := Open(append(options, Transport(inproc.Config{}))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	// strippedIdentity returns the identity of e without its cs3a key
+	strippedIdentity := func(e *Endpoint) *Identity {
+		ident, err := e.LocalIdentity()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parts := make(cipherset.Parts, len(ident.parts))
+		for csid, part := range ident.parts {
+			parts[csid] = part
+		}
+
+		stripped, err := NewIdentity(cipherset.Keys{0x1a: ident.keys[0x1a]}, parts, ident.addrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stripped
+	}
+
+	A := open()
+	defer A.Close()
+	B := open()
+	defer B.Close()
+
+	ident := strippedIdentity(B)
+	assert.Equal(B.LocalHashname(), ident.Hashname())
+
+	_, err := A.Dial(ident)
+	assert.Equal(ErrCipherDowngrade, err)
+
+	// both peers must allow the downgrade
+	C := open(DisableDowngradeProtection())
+	defer C.Close()
+	D := open(DisableDowngradeProtection())
+	defer D.Close()
+
+	x, err := C.Dial(strippedIdentity(D))
+	if assert.NoError(err) {
+		assert.Equal(uint8(0x1a), x.csid)
+	}
+}
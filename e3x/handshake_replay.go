@@ -0,0 +1,247 @@
+package e3x
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/telehash/gogotelehash/internal/hashname"
+)
+
+var ErrHandshakeReplay = errors.New("e3x: replayed handshake")
+
+// ReplayPolicy controls the handshake replay protection of an endpoint.
+//
+// For each ephemeral key of a peer the endpoint remembers the highest
+// handshake `at` value and the digests of the most recent handshake messages.
+// Handshakes with an older `at` are rejected, even when the exchange they
+// belonged to was closed in the mean time. A peer that restarts (possibly with
+// its clock behind) uses a new ephemeral key and starts over. An identical
+// handshake message is only accepted again within DuplicateWindow, as the same
+// handshake is sent over all known paths of an exchange.
+//
+// Ephemeral keys that were not used for Window are retired. The highest `at`
+// value of the retired keys of a peer is kept as a floor: handshakes with a
+// new ephemeral key must carry an `at` above it. The floor is kept until the
+// peer is evicted (see MaxPeers).
+type ReplayPolicy struct {
+	// Window is the time an ephemeral key is remembered after its last
+	// handshake. Defaults to 10 minutes.
+	Window time.Duration
+
+	// DuplicateWindow is the time during which an identical handshake message
+	// is accepted again. Defaults to 5 seconds.
+	DuplicateWindow time.Duration
+
+	// MaxPeers caps the number of remembered peers (including their floor).
+	// When the cap is reached the least recently seen peer is forgotten.
+	// Defaults to 4096.
+	MaxPeers int
+
+	// Disabled turns off the replay protection.
+	Disabled bool
+}
+
+// DefaultReplayPolicy is used by endpoints that were opened without
+// the HandshakeReplayPolicy option.
+var DefaultReplayPolicy = ReplayPolicy{
+	Window:          10 * time.Minute,
+	DuplicateWindow: 5 * time.Second,
+	MaxPeers:        4096,
+}
+
+// HandshakeReplayPolicy sets the handshake replay protection of the endpoint.
+func HandshakeReplayPolicy(policy ReplayPolicy) EndpointOption {
+	return func(e *Endpoint) error {
+		e.replayGuard = newReplayGuard(policy)
+		return nil
+	}
+}
+
+func (p ReplayPolicy) withDefaults() ReplayPolicy {
+	if p.Window <= 0 {
+		p.Window = DefaultReplayPolicy.Window
+	}
+	if p.DuplicateWindow <= 0 {
+		p.DuplicateWindow = DefaultReplayPolicy.DuplicateWindow
+	}
+	if p.DuplicateWindow > p.Window {
+		p.DuplicateWindow = p.Window
+	}
+	if p.MaxPeers <= 0 {
+		p.MaxPeers = DefaultReplayPolicy.MaxPeers
+	}
+	return p
+}
+
+type replayDigest [16]byte
+
+type replayGuard struct {
+	mtx    sync.Mutex
+	policy ReplayPolicy
+	peers  map[hashname.H]*replayPeer
+}
+
+type replayPeer struct {
+	floor    uint32 // the highest at of the retired keys
+	lastSeen time.Time
+	keys     map[replayDigest]replayKey
+	digests  map[replayDigest]replaySeen
+}
+
+// replayKey is the state of an ephemeral key of a peer.
+type replayKey struct {
+	at       uint32
+	lastSeen time.Time
+}
+
+type replaySeen struct {
+	key       replayDigest
+	at        uint32
+	firstSeen time.Time
+}
+
+func newReplayGuard(policy ReplayPolicy) *replayGuard {
+	return &replayGuard{
+		policy: policy.withDefaults(),
+		peers:  make(map[hashname.H]*replayPeer),
+	}
+}
+
+func digestHandshake(msg []byte) replayDigest {
+	var d replayDigest
+	sum := sha256.Sum256(msg)
+	copy(d[:], sum[:])
+	return d
+}
+
+// digestEphemeralKey identifies the ephemeral key of the handshake message
+// msg. Like the line token it is derived from the first 16 bytes of the
+// message, which hold the ephemeral key in all cipher sets.
+func digestEphemeralKey(msg []byte) replayDigest {
+	if len(msg) > 16 {
+		msg = msg[:16]
+	}
+	return digestHandshake(msg)
+}
+
+// check returns ErrHandshakeReplay when the handshake message msg with at from
+// peer was replayed. A nil guard accepts all handshakes.
+func (g *replayGuard) check(peer hashname.H, at uint32, msg []byte, now time.Time) error {
+	if g == nil || g.policy.Disabled {
+		return nil
+	}
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	p := g.lookup(peer, now)
+	if p == nil {
+		return nil
+	}
+
+	if k, found := p.keys[digestEphemeralKey(msg)]; found {
+		if at < k.at {
+			return ErrHandshakeReplay
+		}
+	} else if at <= p.floor {
+		// a retired key or a new key that is older than the retired keys
+		return ErrHandshakeReplay
+	}
+
+	if seen, found := p.digests[digestHandshake(msg)]; found {
+		if now.Sub(seen.firstSeen) > g.policy.DuplicateWindow {
+			return ErrHandshakeReplay
+		}
+	}
+
+	return nil
+}
+
+// record remembers a handshake that was accepted.
+func (g *replayGuard) record(peer hashname.H, at uint32, msg []byte, now time.Time) {
+	if g == nil || g.policy.Disabled {
+		return
+	}
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	p := g.lookup(peer, now)
+	if p == nil {
+		if len(g.peers) >= g.policy.MaxPeers {
+			g.evict()
+		}
+		p = &replayPeer{
+			keys:    make(map[replayDigest]replayKey),
+			digests: make(map[replayDigest]replaySeen),
+		}
+		g.peers[peer] = p
+	}
+
+	p.lastSeen = now
+
+	kd := digestEphemeralKey(msg)
+	k := p.keys[kd]
+	if k.at < at {
+		k.at = at
+	}
+	k.lastSeen = now
+	p.keys[kd] = k
+
+	d := digestHandshake(msg)
+	if _, found := p.digests[d]; !found {
+		p.digests[d] = replaySeen{key: kd, at: at, firstSeen: now}
+	}
+
+	g.retire(p, now)
+}
+
+// lookup returns the state of peer (or nil) after retiring its expired keys.
+// Must be called with g.mtx held.
+func (g *replayGuard) lookup(peer hashname.H, now time.Time) *replayPeer {
+	p := g.peers[peer]
+	if p != nil {
+		g.retire(p, now)
+	}
+	return p
+}
+
+// retire moves the keys of p that were not used within the window to the
+// floor of p and drops the digests that are rejected by their at value. Must
+// be called with g.mtx held.
+func (g *replayGuard) retire(p *replayPeer, now time.Time) {
+	for kd, k := range p.keys {
+		if now.Sub(k.lastSeen) > g.policy.Window {
+			if p.floor < k.at {
+				p.floor = k.at
+			}
+			delete(p.keys, kd)
+		}
+	}
+
+	for d, seen := range p.digests {
+		if k, found := p.keys[seen.key]; !found || seen.at < k.at {
+			delete(p.digests, d)
+		}
+	}
+}
+
+// evict forgets the least recently seen peer. Must be called with g.mtx held.
+func (g *replayGuard) evict() {
+	var (
+		oldest     hashname.H
+		oldestSeen time.Time
+	)
+
+	for hn, p := range g.peers {
+		if oldest == "" || p.lastSeen.Before(oldestSeen) {
+			oldest, oldestSeen = hn, p.lastSeen
+		}
+	}
+
+	if oldest != "" {
+		delete(g.peers, oldest)
+	}
+}
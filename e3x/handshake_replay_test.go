@@ -0,0 +1,138 @@
+package e3x
+
+import (
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/internal/hashname"
+)
+
+func TestReplayGuard(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		g    = newReplayGuard(ReplayPolicy{})
+		peer = hashname.H("aaaa")
+		now  = time.Now()
+		hs1  = []byte("ephemeral key A handshake 1")
+		hs2  = []byte("ephemeral key A handshake 2")
+	)
+
+	assert.NoError(g.check(peer, 10, hs1, now))
+	g.record(peer, 10, hs1, now)
+
+	// the same handshake over another path
+	assert.NoError(g.check(peer, 10, hs1, now.Add(time.Second)))
+
+	// the same handshake after the duplicate window
+	assert.Equal(ErrHandshakeReplay, g.check(peer, 10, hs1, now.Add(10*time.Second)))
+
+	// a fresh handshake with the same at
+	assert.NoError(g.check(peer, 10, hs2, now.Add(10*time.Second)))
+
+	g.record(peer, 12, hs2, now.Add(10*time.Second))
+
+	// an older handshake
+	assert.Equal(ErrHandshakeReplay, g.check(peer, 11, []byte("ephemeral key A handshake 3"), now.Add(11*time.Second)))
+
+	// the key is retired after the window but still rejects older handshakes
+	assert.Equal(ErrHandshakeReplay, g.check(peer, 10, hs1, now.Add(time.Hour)))
+
+	// other peers are unaffected
+	assert.NoError(g.check(hashname.H("bbbb"), 1, hs1, now))
+}
+
+func TestReplayGuardRestart(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		g    = newReplayGuard(ReplayPolicy{})
+		peer = hashname.H("aaaa")
+		now  = time.Now()
+		old  = []byte("ephemeral key A handshake 1")
+		hs1  = []byte("ephemeral key B handshake 1")
+		hs2  = []byte("ephemeral key B handshake 2")
+	)
+
+	g.record(peer, 1000, old, now)
+
+	// the peer restarted with its clock behind
+	assert.NoError(g.check(peer, 10, hs1, now.Add(time.Second)))
+	g.record(peer, 10, hs1, now.Add(time.Second))
+
+	// the new session continues from its own at values
+	assert.NoError(g.check(peer, 12, hs2, now.Add(2*time.Second)))
+	g.record(peer, 12, hs2, now.Add(2*time.Second))
+
+	// an older handshake of the new session
+	assert.Equal(ErrHandshakeReplay, g.check(peer, 11, []byte("ephemeral key B handshake 3"), now.Add(3*time.Second)))
+
+	// a replay of the old session
+	assert.Equal(ErrHandshakeReplay, g.check(peer, 1000, old, now.Add(10*time.Second)))
+	assert.Equal(ErrHandshakeReplay, g.check(peer, 999, []byte("ephemeral key A handshake 0"), now.Add(10*time.Second)))
+}
+
+func TestReplayGuardAfterWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		g     = newReplayGuard(ReplayPolicy{})
+		peer  = hashname.H("aaaa")
+		now   = time.Now()
+		hs1   = []byte("ephemeral key A handshake 1")
+		hs2   = []byte("ephemeral key A handshake 2")
+		later = now.Add(DefaultReplayPolicy.Window + time.Minute)
+	)
+
+	g.record(peer, 10, hs1, now)
+	g.record(peer, 12, hs2, now.Add(time.Second))
+
+	// captured handshakes replayed after the key was retired
+	assert.Equal(ErrHandshakeReplay, g.check(peer, 10, hs1, later))
+	assert.Equal(ErrHandshakeReplay, g.check(peer, 12, hs2, later))
+
+	// a new session that isn't older than the retired keys
+	hs3 := []byte("ephemeral key B handshake 1")
+	assert.NoError(g.check(peer, 13, hs3, later))
+	g.record(peer, 13, hs3, later)
+
+	// the floor outlives the key
+	g.mtx.Lock()
+	assert.Equal(uint32(12), g.peers[peer].floor)
+	assert.Len(g.peers[peer].keys, 1)
+	g.mtx.Unlock()
+}
+
+func TestReplayGuardEviction(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		g   = newReplayGuard(ReplayPolicy{MaxPeers: 2})
+		now = time.Now()
+		hs  = []byte("handshake")
+	)
+
+	g.record(hashname.H("aaaa"), 10, hs, now)
+	g.record(hashname.H("bbbb"), 10, hs, now.Add(time.Second))
+	g.record(hashname.H("cccc"), 10, hs, now.Add(2*time.Second))
+
+	assert.Len(g.peers, 2)
+	assert.Nil(g.peers[hashname.H("aaaa")])
+	assert.NotNil(g.peers[hashname.H("cccc")])
+}
+
+func TestReplayGuardDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		g        = newReplayGuard(ReplayPolicy{Disabled: true})
+		nilGuard *replayGuard
+		now      = time.Now()
+	)
+
+	g.record(hashname.H("aaaa"), 10, nil, now)
+	assert.NoError(g.check(hashname.H("aaaa"), 1, nil, now))
+	assert.NoError(nilGuard.check(hashname.H("aaaa"), 1, nil, now))
+}
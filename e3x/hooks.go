@@ -3,6 +3,9 @@ package e3x
 import (
 	"errors"
 	"net"
+
+	"github.com/telehash/gogotelehash/e3x/cipherset"
+	"github.com/telehash/gogotelehash/transports"
 )
 
 var ErrStopPropagation = errors.New("observer: stop propagation")
@@ -26,12 +29,30 @@ type ChannelHooks struct {
 type EndpointHook struct {
 	OnNetChanged func(e *Endpoint, up, down []net.Addr) error
 	OnDropPacket func(e *Endpoint, msg []byte, conn net.Conn, reason error) error
+
+	// OnNATChanged is called when the type of the NAT in front of the
+	// endpoint was (re)classified.
+	OnNATChanged func(e *Endpoint, typ transports.NATType) error
+
+	// OnExternalAddrsChanged is called with the new set of external addresses
+	// (see Transports.ExternalAddresses) when it changed.
+	OnExternalAddrsChanged func(e *Endpoint, addrs []net.Addr) error
 }
 
 type ExchangeHook struct {
 	OnOpened     func(*Endpoint, *Exchange) error
 	OnClosed     func(*Endpoint, *Exchange, error) error
 	OnDropPacket func(e *Endpoint, x *Exchange, msg []byte, pipe *Pipe, reason error) error
+
+	// OnHandshake is called before a handshake is applied to the exchange. The
+	// handshake is dropped when OnHandshake returns an error. It is called
+	// while the exchange is locked and must not call methods of x.
+	OnHandshake func(e *Endpoint, x *Exchange, handshake cipherset.Handshake) error
+
+	// OnUnreachable is called when the known paths of x don't answer; when a
+	// dial is still waiting for a handshake after the first retry and when the
+	// active path of an open exchange stalled or became unreachable.
+	OnUnreachable func(e *Endpoint, x *Exchange) error
 }
 
 type ChannelHook struct {
@@ -99,6 +120,24 @@ func (s *EndpointHooks) NetChanged(up, down []net.Addr) error {
 	})
 }
 
+func (s *EndpointHooks) NATChanged(typ transports.NATType) error {
+	return s.trigger(func(o EndpointHook) error {
+		if o.OnNATChanged == nil {
+			return nil
+		}
+		return o.OnNATChanged(s.endpoint, typ)
+	})
+}
+
+func (s *EndpointHooks) ExternalAddrsChanged(addrs []net.Addr) error {
+	return s.trigger(func(o EndpointHook) error {
+		if o.OnExternalAddrsChanged == nil {
+			return nil
+		}
+		return o.OnExternalAddrsChanged(s.endpoint, addrs)
+	})
+}
+
 func (s *EndpointHooks) DropPacket(msg []byte, conn net.Conn, reason error) error {
 	return s.trigger(func(o EndpointHook) error {
 		if o.OnDropPacket == nil {
@@ -135,6 +174,24 @@ func (s *ExchangeHooks) DropPacket(msg []byte, pipe *Pipe, reason error) error {
 	})
 }
 
+func (s *ExchangeHooks) Handshake(handshake cipherset.Handshake) error {
+	return s.trigger(func(o ExchangeHook) error {
+		if o.OnHandshake == nil {
+			return nil
+		}
+		return o.OnHandshake(s.endpoint, s.exchange, handshake)
+	})
+}
+
+func (s *ExchangeHooks) Unreachable() error {
+	return s.trigger(func(o ExchangeHook) error {
+		if o.OnUnreachable == nil {
+			return nil
+		}
+		return o.OnUnreachable(s.endpoint, s.exchange)
+	})
+}
+
 func (s *ChannelHooks) Opened() error {
 	return s.trigger(func(o ChannelHook) error {
 		if o.OnOpened == nil {
@@ -21,6 +21,12 @@ type listenerSet struct {
 	mtx       sync.RWMutex
 	parent    *listenerSet
 	listeners map[string]*Listener
+	handlers  map[string]Handler
+}
+
+// channelHandler is implemented by the receivers of new channels.
+type channelHandler interface {
+	handle(c *Channel)
 }
 
 var (
@@ -71,6 +77,61 @@ func (set *listenerSet) Get(typ string) *Listener {
 	return l
 }
 
+// Lookup returns the listener or handler for channels of type typ.
+func (set *listenerSet) Lookup(typ string) channelHandler {
+	if set == nil {
+		return nil
+	}
+
+	set.mtx.RLock()
+	var (
+		l = set.listeners[typ]
+		h = set.handlers[typ]
+	)
+	set.mtx.RUnlock()
+
+	if l != nil {
+		return l
+	}
+
+	if h != nil {
+		return handlerAdapter{h}
+	}
+
+	return set.parent.Lookup(typ)
+}
+
+func (set *listenerSet) AddHandler(typ string, h Handler) error {
+	set.mtx.Lock()
+	defer set.mtx.Unlock()
+
+	if set.handlers == nil {
+		set.handlers = make(map[string]Handler)
+	}
+
+	if _, f := set.handlers[typ]; f {
+		return ErrHandlerRegistered
+	}
+	if _, f := set.listeners[typ]; f {
+		return ErrHandlerRegistered
+	}
+
+	set.handlers[typ] = h
+	return nil
+}
+
+func (set *listenerSet) RemoveHandler(typ string) bool {
+	set.mtx.Lock()
+	defer set.mtx.Unlock()
+
+	if _, f := set.handlers[typ]; !f {
+		return false
+	}
+
+	delete(set.handlers, typ)
+	return true
+}
+
 func (set *listenerSet) remove(typ string) {
 	set.mtx.Lock()
 	defer set.mtx.Unlock()
@@ -103,6 +164,9 @@ func (set *listenerSet) Listen(typ string, reliable bool) *Listener {
 	if _, f := set.listeners[typ]; f {
 		panic("listener is already registered: " + typ)
 	}
+	if _, f := set.handlers[typ]; f {
+		panic("handler is already registered: " + typ)
+	}
 
 	l := newListener(set, typ, reliable, 0)
 	set.listeners[typ] = l
@@ -1,5 +1,10 @@
 package e3x
 
+import (
+	"fmt"
+	"sort"
+)
+
 // Module must be implemented by endpoint modules.
 type Module interface {
 	// Init is called after the creating the endpoint and before openeing the endpoint transport.
@@ -13,3 +18,31 @@ type Module interface {
 }
 
 type pivateModKey string
+
+// Modules returns the keys of the modules registered with e, sorted by their
+// string representation.
+func (e *Endpoint) Modules() []interface{} {
+	keys := make([]interface{}, 0, len(e.modules))
+	for key := range e.modules {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	return keys
+}
+
+// ModuleOf returns the first module of e (in the order of Modules) that
+// implements T. Most modules export an interface for this purpose:
+//
+//	b, ok := e3x.ModuleOf[bridge.Bridge](e)
+func ModuleOf[T any](e *Endpoint) (T, bool) {
+	for _, key := range e.Modules() {
+		if mod, ok := e.modules[key].(T); ok {
+			return mod, true
+		}
+	}
+
+	var zero T
+	return zero, false
+}
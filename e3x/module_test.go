@@ -0,0 +1,34 @@
+package e3x
+
+import (
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+)
+
+type testModKey string
+
+type testMod struct{ name string }
+
+func (m *testMod) Init() error  { return nil }
+func (m *testMod) Start() error { return nil }
+func (m *testMod) Stop() error  { return nil }
+func (m *testMod) Name() string { return m.name }
+
+func TestModules(t *testing.T) {
+	assert := assert.New(t)
+
+	e := &Endpoint{modules: make(map[interface{}]Module)}
+	assert.NoError(RegisterModule(testModKey("b"), &testMod{"b"})(e))
+	assert.NoError(RegisterModule(testModKey("a"), &testMod{"a"})(e))
+
+	assert.Equal([]interface{}{testModKey("a"), testModKey("b")}, e.Modules())
+
+	mod, ok := ModuleOf[interface{ Name() string }](e)
+	if assert.True(ok) {
+		assert.Equal("a", mod.Name())
+	}
+
+	_, ok = ModuleOf[Transports](e)
+	assert.False(ok)
+}
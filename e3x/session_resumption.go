@@ -0,0 +1,400 @@
+package e3x
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/telehash/gogotelehash/e3x/cipherset"
+	"github.com/telehash/gogotelehash/internal/hashname"
+	"github.com/telehash/gogotelehash/internal/lob"
+	"github.com/telehash/gogotelehash/internal/util/logs"
+	"github.com/telehash/gogotelehash/transports"
+)
+
+// ResumePolicy controls session resumption.
+//
+// When session resumption is enabled the line of an exchange that expired or
+// broke is kept for Timeout. When the peer reconnects within Timeout the
+// exchange is restored from the cached line instead of performing a new
+// handshake. The peer that reconnects sends a resume message: a packet
+// encrypted with the cached line that carries a fresh `at` value. The other
+// peer resumes the line when the `at` value is above the last one it saw
+// (and passes the replay guard) and answers with a resume message of its own.
+// Each peer only moves its active path to a path the other peer answered its
+// resume message over. Both peers must enable session resumption for the line
+// to be resumed; otherwise the regular handshakes re-establish it.
+type ResumePolicy struct {
+	// Timeout is the time the line of a closed exchange is kept.
+	// Defaults to 2 minutes.
+	Timeout time.Duration
+
+	// MaxSessions caps the number of cached lines. When the cap is reached the
+	// oldest line is dropped. Defaults to 1024.
+	MaxSessions int
+}
+
+// ErrResumeReplay is returned (to the DropPacket hooks) when a resume message
+// was replayed.
+var ErrResumeReplay = errors.New("e3x: replayed resume message")
+
+var errNotResume = errors.New("e3x: not a resume message")
+
+const (
+	// resumeHeader carries the `at` value of a resume message.
+	resumeHeader = "resume"
+
+	// resumedHeader carries the `at` value of the resume message of the peer
+	// that is answered.
+	resumedHeader = "resumed"
+)
+
+// DefaultResumePolicy is used by the SessionResumption option for the
+// fields that are not set.
+var DefaultResumePolicy = ResumePolicy{
+	Timeout:     2 * time.Minute,
+	MaxSessions: 1024,
+}
+
+// SessionResumption enables session resumption for the endpoint.
+func SessionResumption(policy ResumePolicy) EndpointOption {
+	return func(e *Endpoint) error {
+		e.sessions = newSessionCache(policy)
+		return nil
+	}
+}
+
+func (p ResumePolicy) withDefaults() ResumePolicy {
+	if p.Timeout <= 0 {
+		p.Timeout = DefaultResumePolicy.Timeout
+	}
+	if p.MaxSessions <= 0 {
+		p.MaxSessions = DefaultResumePolicy.MaxSessions
+	}
+	return p
+}
+
+// session is the cached line of a closed exchange.
+type session struct {
+	remoteIdent   *Identity
+	csid          uint8
+	cipher        cipherset.State
+	lastLocalSeq  uint32
+	lastRemoteSeq uint32
+	nextSeq       uint32
+	addrs         []net.Addr // active address first
+	expireAt      time.Time
+	timer         *time.Timer
+}
+
+type sessionCache struct {
+	mtx       sync.Mutex
+	policy    ResumePolicy
+	hashnames map[hashname.H]*session
+	tokens    map[cipherset.Token]*session
+}
+
+func newSessionCache(policy ResumePolicy) *sessionCache {
+	return &sessionCache{
+		policy:    policy.withDefaults(),
+		hashnames: make(map[hashname.H]*session),
+		tokens:    make(map[cipherset.Token]*session),
+	}
+}
+
+// suspend captures the line of x. It returns nil when the line can't be
+// resumed. Must be called with x.mtx held.
+func (x *Exchange) suspend() *session {
+	if x.sessions == nil || x.remoteIdent == nil || x.cipher == nil {
+		return nil
+	}
+	if !x.cipher.CanEncryptPacket() || !x.cipher.CanDecryptPacket() {
+		return nil
+	}
+
+	var addrs []net.Addr
+	if p := x.addressBook.ActiveConnection(); p != nil && p.RemoteAddr() != nil {
+		addrs = append(addrs, p.RemoteAddr())
+	}
+	for _, addr := range x.addressBook.KnownAddresses() {
+		if len(addrs) == 0 || !transports.EqualAddr(addrs[0], addr) {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	return &session{
+		remoteIdent:   x.remoteIdent,
+		csid:          x.csid,
+		cipher:        x.cipher,
+		lastLocalSeq:  x.lastLocalSeq,
+		lastRemoteSeq: x.lastRemoteSeq,
+		nextSeq:       x.nextSeq,
+		addrs:         addrs,
+	}
+}
+
+// put caches s. It returns false when s was not cached, in which case the
+// caller remains responsible for wiping the line.
+func (c *sessionCache) put(s *session) bool {
+	if c == nil || s == nil {
+		return false
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if old := c.hashnames[s.remoteIdent.Hashname()]; old != nil {
+		c.drop(old)
+	}
+
+	s.expireAt = time.Now().Add(c.policy.Timeout)
+	c.insert(s)
+	return true
+}
+
+// restore puts back a session that was taken but could not be resumed. The
+// session keeps its original expiry; it is wiped when it expired in the
+// meantime or when a newer session for the same peer was cached.
+func (c *sessionCache) restore(s *session) {
+	if c == nil || s == nil {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if !time.Now().Before(s.expireAt) || c.hashnames[s.remoteIdent.Hashname()] != nil {
+		s.wipe()
+		return
+	}
+
+	c.insert(s)
+}
+
+// insert registers s until s.expireAt, evicting the oldest session when the
+// cache is full. Must be called with c.mtx held.
+func (c *sessionCache) insert(s *session) {
+	if len(c.hashnames) >= c.policy.MaxSessions {
+		var oldest *session
+		for _, o := range c.hashnames {
+			if oldest == nil || o.expireAt.Before(oldest.expireAt) {
+				oldest = o
+			}
+		}
+		c.drop(oldest)
+	}
+
+	s.timer = time.AfterFunc(s.expireAt.Sub(time.Now()), func() {
+		c.mtx.Lock()
+		if c.hashnames[s.remoteIdent.Hashname()] == s {
+			c.drop(s)
+		}
+		c.mtx.Unlock()
+	})
+
+	c.hashnames[s.remoteIdent.Hashname()] = s
+	c.tokens[s.cipher.LocalToken()] = s
+	c.tokens[s.cipher.RemoteToken()] = s
+}
+
+// take removes and returns the session of peer.
+func (c *sessionCache) take(peer hashname.H) *session {
+	if c == nil {
+		return nil
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	s := c.hashnames[peer]
+	if s == nil {
+		return nil
+	}
+
+	c.remove(s)
+	return s
+}
+
+// takeToken removes and returns the session that owns token.
+func (c *sessionCache) takeToken(token cipherset.Token) *session {
+	if c == nil || token == cipherset.ZeroToken {
+		return nil
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	s := c.tokens[token]
+	if s == nil {
+		return nil
+	}
+
+	c.remove(s)
+	return s
+}
+
+// clear drops all cached sessions.
+func (c *sessionCache) clear() {
+	if c == nil {
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for _, s := range c.hashnames {
+		c.drop(s)
+	}
+}
+
+// remove unregisters s. Must be called with c.mtx held.
+func (c *sessionCache) remove(s *session) {
+	s.timer.Stop()
+	delete(c.hashnames, s.remoteIdent.Hashname())
+	delete(c.tokens, s.cipher.LocalToken())
+	delete(c.tokens, s.cipher.RemoteToken())
+}
+
+// drop unregisters s and wipes its line. Must be called with c.mtx held.
+func (c *sessionCache) drop(s *session) {
+	c.remove(s)
+	s.wipe()
+}
+
+// wipe erases the line of s.
+func (s *session) wipe() {
+	if w, ok := s.cipher.(cipherset.Wiper); ok {
+		w.Wipe()
+	}
+}
+
+// resumeExchange restores an exchange from a cached session. The exchange is
+// open immediately. Additional paths for the remote endpoint are taken from
+// remoteIdent (which may be nil).
+func resumeExchange(
+	localIdent *Identity, remoteIdent *Identity, s *session,
+	log *logs.Logger,
+	options ...ExchangeOption,
+) (*Exchange, error) {
+	x, err := newExchange(localIdent, nil, nil, log, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	x.remoteIdent = s.remoteIdent
+	x.csid = s.csid
+	x.cipher = s.cipher
+	x.lastLocalSeq = s.lastLocalSeq
+	x.lastRemoteSeq = s.lastRemoteSeq
+	x.nextSeq = s.nextSeq
+	x.log = log.To(s.remoteIdent.Hashname())
+	x.addressBook = newAddressBook(x.log)
+	x.addressBook.scorer = x.pathScorer
+
+	addrs := s.addrs
+	if remoteIdent != nil {
+		addrs = append(addrs, remoteIdent.addrs...)
+	}
+	for _, addr := range addrs {
+		x.addressBook.AddPipe(newPipe(x.endpoint.getTransport(), nil, addr, x))
+	}
+
+	x.traceStarted()
+	x.log.Printf("\x1B[32mResumed exchange\x1B[0m")
+
+	x.state = ExchangeIdle
+	x.resetExpire()
+	go x.exchangeHooks.Opened()
+
+	return x, nil
+}
+
+// startResume sends a resume message over all the known paths of x.
+func (x *Exchange) startResume() {
+	x.mtx.Lock()
+	defer x.mtx.Unlock()
+
+	x.resumeAt = x.getNextSeq()
+	for _, p := range x.addressBook.KnownPipes() {
+		x.writeResume(p, x.resumeAt, 0)
+	}
+}
+
+// answerResume answers the resume message at of the peer over p with a resume
+// message of x.
+func (x *Exchange) answerResume(p *Pipe, at uint32) {
+	x.mtx.Lock()
+	defer x.mtx.Unlock()
+
+	x.lastRemoteSeq = at
+	x.resumeAt = x.getNextSeq()
+	x.writeResume(p, x.resumeAt, at)
+}
+
+// receivedResume handles a resume message that was received over p. It
+// returns false when pkt is not a resume message.
+func (x *Exchange) receivedResume(pkt *lob.Packet, msg message) bool {
+	var (
+		hdr         = pkt.Header()
+		at, hasAt   = hdr.GetUint32(resumeHeader)
+		ack, hasAck = hdr.GetUint32(resumedHeader)
+		p           = msg.Pipe
+		now         = time.Now()
+		raw         = msg.Data.RawBytes()[2:]
+		remote      hashname.H
+	)
+
+	if !hasAt && !hasAck {
+		return false
+	}
+	if p == nil {
+		return true
+	}
+
+	x.mtx.Lock()
+	defer x.mtx.Unlock()
+
+	remote = x.remoteIdent.Hashname()
+
+	if hasAck && x.resumeAt != 0 && ack == x.resumeAt {
+		// the peer answered over p
+		x.resumeAt = 0
+		x.addressBook.AddPipe(p)
+		x.addressBook.Activate(p)
+	}
+
+	if !hasAt || at <= x.lastRemoteSeq {
+		return true
+	}
+	if x.replayGuard.check(remote, at, raw, now) != nil {
+		return true
+	}
+
+	x.lastRemoteSeq = at
+	x.replayGuard.record(remote, at, raw, now)
+	x.writeResume(p, 0, at)
+	return true
+}
+
+// writeResume sends a resume message with at (when not 0) that answers the
+// resume message ack of the peer (when not 0) over p.
+func (x *Exchange) writeResume(p *Pipe, at, ack uint32) error {
+	pkt := lob.New(nil)
+	if at != 0 {
+		pkt.Header().SetUint32(resumeHeader, at)
+	}
+	if ack != 0 {
+		pkt.Header().SetUint32(resumedHeader, ack)
+	}
+
+	msg, err := x.encryptPacket(pkt)
+	pkt.Free()
+	if err != nil {
+		return err
+	}
+
+	_, err = p.Write(msg)
+	msg.Free()
+	return err
+}
@@ -0,0 +1,147 @@
+package e3x
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/internal/lob"
+)
+
+func TestSessionResumption(t *testing.T) {
+	options := []EndpointOption{SessionResumption(ResumePolicy{})}
+	withTwoEndpointsOptions(t, options, func(A, B *Endpoint) {
+		var (
+			assert = assert.New(t)
+			served = make(chan string, 2)
+		)
+
+		err := B.AddHandler("echo", HandlerFunc(func(c *Channel) {
+			defer c.Kill()
+
+			pkt, err := c.ReadPacket()
+			if err != nil {
+				return
+			}
+			served <- string(pkt.Body(nil))
+		}))
+		assert.NoError(err)
+
+		ident, err := B.LocalIdentity()
+		assert.NoError(err)
+
+		c, err := A.Open(ident, "echo", false)
+		if assert.NoError(err) {
+			assert.NoError(c.WritePacket(lob.New([]byte("hello"))))
+			assert.Equal("hello", <-served)
+			c.Kill()
+		}
+
+		var (
+			xA = A.GetExchange(B.LocalHashname())
+			xB = B.GetExchange(A.LocalHashname())
+		)
+		if !assert.NotNil(xA) || !assert.NotNil(xB) {
+			return
+		}
+
+		// packets of the line captured before the blip
+		pkt := lob.New([]byte("captured"))
+		pkt.Header().C, pkt.Header().HasC = 1, true
+		pkt.Header().Type, pkt.Header().HasType = "echo", true
+		captured, err := xA.encryptPacket(pkt)
+		assert.NoError(err)
+		pkt.Free()
+
+		pkt = lob.New(nil)
+		xB.mtx.Lock()
+		pkt.Header().SetUint32(resumeHeader, xB.lastRemoteSeq)
+		xB.mtx.Unlock()
+		staleResume, err := xA.encryptPacket(pkt)
+		assert.NoError(err)
+		pkt.Free()
+
+		// simulate a network blip
+		cipherA, cipherB := xA.cipher, xB.cipher
+		xA.onBreak()
+		xB.onBreak()
+		assert.Nil(A.GetExchange(B.LocalHashname()))
+		assert.Nil(B.GetExchange(A.LocalHashname()))
+
+		// replayed packets of the line don't resume it
+		for _, msg := range [][]byte{captured.Get(nil), staleResume.Get(nil)} {
+			local, remote := net.Pipe()
+			go remote.Write(msg)
+			B.accept(local)
+			assert.Nil(B.GetExchange(A.LocalHashname()))
+			B.sessions.mtx.Lock()
+			assert.NotNil(B.sessions.hashnames[A.LocalHashname()])
+			B.sessions.mtx.Unlock()
+		}
+		captured.Free()
+		staleResume.Free()
+
+		// a forged packet with the token of the cached line doesn't resume it
+		token := cipherB.LocalToken()
+		forged := append(append([]byte{0, 0}, token[:]...), make([]byte, 64)...)
+		local, remote := net.Pipe()
+		go remote.Write(forged)
+		B.accept(local)
+		assert.Nil(B.GetExchange(A.LocalHashname()))
+		B.sessions.mtx.Lock()
+		assert.NotNil(B.sessions.hashnames[A.LocalHashname()])
+		B.sessions.mtx.Unlock()
+
+		// the line is resumed without a handshake
+		x, err := A.CreateExchange(ident)
+		if assert.NoError(err) {
+			assert.True(x.State().IsOpen())
+			assert.True(x.cipher == cipherA)
+		}
+
+		c, err = A.Open(ident, "echo", false)
+		if assert.NoError(err) {
+			assert.NoError(c.WritePacket(lob.New([]byte("again"))))
+			select {
+			case msg := <-served:
+				assert.Equal("again", msg)
+			case <-time.After(5 * time.Second):
+				t.Fatal("line was not resumed")
+			}
+			c.Kill()
+		}
+
+		if x := B.GetExchange(A.LocalHashname()); assert.NotNil(x) {
+			assert.True(x.cipher == cipherB)
+		}
+	})
+}
+
+func TestSessionCacheExpiry(t *testing.T) {
+	options := []EndpointOption{SessionResumption(ResumePolicy{Timeout: 50 * time.Millisecond})}
+	withTwoEndpointsOptions(t, options, func(A, B *Endpoint) {
+		assert := assert.New(t)
+
+		ident, err := B.LocalIdentity()
+		assert.NoError(err)
+
+		x, err := A.Dial(ident)
+		if !assert.NoError(err) {
+			return
+		}
+
+		x.onBreak()
+		A.sessions.mtx.Lock()
+		assert.NotNil(A.sessions.hashnames[B.LocalHashname()])
+		A.sessions.mtx.Unlock()
+
+		time.Sleep(200 * time.Millisecond)
+
+		A.sessions.mtx.Lock()
+		assert.Empty(A.sessions.hashnames)
+		assert.Empty(A.sessions.tokens)
+		A.sessions.mtx.Unlock()
+	})
+}
@@ -0,0 +1,235 @@
+// Package stream provides a byte stream over a reliable channel.
+//
+// The stream packs written bytes into channel packets of at most
+// Config.ChunkSize bytes. Bytes are buffered until a chunk is full or the
+// stream is flushed; the last chunk carries the "end" header of the channel
+// so the peer reads io.EOF after the last byte:
+//
+//	s := stream.New(c, stream.Config{MaxSize: 1 << 20})
+//	json.NewEncoder(s).Encode(req)
+//	s.CloseWrite()
+//	json.NewDecoder(s).Decode(&res)
+//	s.Close()
+//
+// A channel must be answered before the peer can send its next packets. When
+// the stream read a packet before anything was written it sends an empty
+// packet, so the accepting side can read a whole request before it writes the
+// response. The opening side has to write (or Flush) before it can read.
+package stream
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/internal/lob"
+)
+
+const (
+	// DefaultChunkSize is the default size of the packets.
+	DefaultChunkSize = 1024
+
+	// MaxChunkSize is the largest packet size that fits in the MTU of all
+	// transports.
+	MaxChunkSize = 1200
+)
+
+var (
+	// ErrTooLarge is returned by Read when the peer sent more than
+	// Config.MaxSize bytes.
+	ErrTooLarge = errors.New("stream: too large")
+
+	// ErrWriteClosed is returned by Write after CloseWrite.
+	ErrWriteClosed = errors.New("stream: write after CloseWrite")
+)
+
+type Config struct {
+	// ChunkSize is the size of the packets. Defaults to DefaultChunkSize and
+	// is capped at MaxChunkSize.
+	ChunkSize int
+
+	// MaxSize limits the number of bytes that can be read. Zero means no
+	// limit.
+	MaxSize int64
+}
+
+// Stream is a net.Conn over a reliable channel.
+type Stream struct {
+	c      *e3x.Channel
+	config Config
+
+	rmtx   sync.Mutex
+	rstore []byte
+	rbuf   []byte
+	nread  int64
+	rerr   error
+
+	wmtx    sync.Mutex
+	wbuf    []byte
+	wrote   bool
+	wclosed bool
+	werr    error
+}
+
+var _ net.Conn = (*Stream)(nil)
+
+// New returns a stream over c.
+func New(c *e3x.Channel, config Config) *Stream {
+	if config.ChunkSize <= 0 {
+		config.ChunkSize = DefaultChunkSize
+	}
+	if config.ChunkSize > MaxChunkSize {
+		config.ChunkSize = MaxChunkSize
+	}
+
+	return &Stream{c: c, config: config}
+}
+
+// Channel returns the channel of s.
+func (s *Stream) Channel() *e3x.Channel { return s.c }
+
+// Read reads from the stream. It returns io.EOF after the peer closed its
+// side of the stream.
+func (s *Stream) Read(p []byte) (int, error) {
+	s.rmtx.Lock()
+	defer s.rmtx.Unlock()
+
+	for len(s.rbuf) == 0 {
+		if s.rerr != nil {
+			return 0, s.rerr
+		}
+
+		pkt, err := s.c.ReadPacket()
+		if err != nil {
+			s.rerr = err
+			return 0, err
+		}
+
+		size := pkt.BodyLen()
+		if size > 0 {
+			s.rstore = pkt.Body(s.rstore[:0])
+			s.rbuf = s.rstore
+		}
+		pkt.Free()
+
+		if err := s.answer(); err != nil {
+			s.rerr = err
+			return 0, err
+		}
+
+		if s.config.MaxSize > 0 && s.nread+int64(size) > s.config.MaxSize {
+			s.rbuf = nil
+			s.rerr = ErrTooLarge
+			return 0, ErrTooLarge
+		}
+		s.nread += int64(size)
+	}
+
+	n := copy(p, s.rbuf)
+	s.rbuf = s.rbuf[n:]
+	return n, nil
+}
+
+// answer sends an empty packet when nothing was written yet.
+func (s *Stream) answer() error {
+	s.wmtx.Lock()
+	defer s.wmtx.Unlock()
+
+	if s.wrote || s.wclosed {
+		return nil
+	}
+	return s.send(nil, false)
+}
+
+// Write buffers p and sends all full chunks.
+func (s *Stream) Write(p []byte) (int, error) {
+	s.wmtx.Lock()
+	defer s.wmtx.Unlock()
+
+	if s.wclosed {
+		return 0, ErrWriteClosed
+	}
+	if s.werr != nil {
+		return 0, s.werr
+	}
+
+	s.wbuf = append(s.wbuf, p...)
+
+	// the last chunk is kept for the end header
+	for len(s.wbuf) > s.config.ChunkSize {
+		if err := s.send(s.wbuf[:s.config.ChunkSize], false); err != nil {
+			return 0, err
+		}
+		s.wbuf = s.wbuf[:copy(s.wbuf, s.wbuf[s.config.ChunkSize:])]
+	}
+
+	return len(p), nil
+}
+
+// Flush sends the buffered bytes.
+func (s *Stream) Flush() error {
+	s.wmtx.Lock()
+	defer s.wmtx.Unlock()
+
+	if s.wclosed || len(s.wbuf) == 0 {
+		return s.werr
+	}
+
+	if err := s.send(s.wbuf, false); err != nil {
+		return err
+	}
+	s.wbuf = s.wbuf[:0]
+	return nil
+}
+
+// CloseWrite sends the buffered bytes and ends the stream. The stream can
+// still be read until the peer ends its side.
+func (s *Stream) CloseWrite() error {
+	s.wmtx.Lock()
+	defer s.wmtx.Unlock()
+
+	if s.wclosed {
+		return s.werr
+	}
+	s.wclosed = true
+
+	err := s.send(s.wbuf, true)
+	s.wbuf = nil
+	return err
+}
+
+// send writes a packet. s.wmtx must be held.
+func (s *Stream) send(data []byte, end bool) error {
+	pkt := lob.New(data)
+	if end {
+		hdr := pkt.Header()
+		hdr.End, hdr.HasEnd = true, true
+	}
+
+	err := s.c.WritePacket(pkt)
+	if err != nil {
+		s.werr = err
+		return err
+	}
+
+	s.wrote = true
+	return nil
+}
+
+// Close ends the stream and waits for the peer to end its side.
+func (s *Stream) Close() error {
+	err := s.CloseWrite()
+	if err != nil {
+		s.c.Kill()
+		return err
+	}
+	return s.c.Close()
+}
+
+func (s *Stream) LocalAddr() net.Addr                { return s.c.LocalAddr() }
+func (s *Stream) RemoteAddr() net.Addr               { return s.c.RemoteAddr() }
+func (s *Stream) SetDeadline(t time.Time) error      { return s.c.SetDeadline(t) }
+func (s *Stream) SetReadDeadline(t time.Time) error  { return s.c.SetReadDeadline(t) }
+func (s *Stream) SetWriteDeadline(t time.Time) error { return s.c.SetWriteDeadline(t) }
@@ -0,0 +1,110 @@
+package stream
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/transports/inproc"
+)
+
+func withStream(t *testing.T, config Config, serve func(s *Stream), f func(s *Stream)) {
+	assert := assert.New(t)
+
+	A, err := e3x.Open(e3x.Transport(inproc.Config{}))
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := e3x.Open(e3x.Transport(inproc.Config{}))
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	done := make(chan bool)
+	A.AddHandler("stream", e3x.HandlerFunc(func(c *e3x.Channel) {
+		defer close(done)
+		serve(New(c, config))
+	}))
+
+	identA, err := A.LocalIdentity()
+	assert.NoError(err)
+
+	c, err := B.Open(identA, "stream", true)
+	if !assert.NoError(err) {
+		return
+	}
+
+	f(New(c, config))
+	<-done
+}
+
+func TestEcho(t *testing.T) {
+	assert := assert.New(t)
+	data := bytes.Repeat([]byte("0123456789"), 3000)
+
+	withStream(t, Config{}, func(s *Stream) {
+		// read the whole request before responding
+		req, err := ioutil.ReadAll(s)
+		assert.NoError(err)
+
+		_, err = s.Write(req)
+		assert.NoError(err)
+		assert.NoError(s.Close())
+	}, func(s *Stream) {
+		_, err := s.Write(data)
+		assert.NoError(err)
+		assert.NoError(s.CloseWrite())
+
+		_, err = s.Write(data)
+		assert.Equal(ErrWriteClosed, err)
+
+		res, err := ioutil.ReadAll(s)
+		assert.NoError(err)
+		assert.Equal(data, res)
+		assert.NoError(s.Close())
+	})
+}
+
+func TestMaxSize(t *testing.T) {
+	assert := assert.New(t)
+
+	withStream(t, Config{MaxSize: 2000}, func(s *Stream) {
+		_, err := ioutil.ReadAll(s)
+		assert.Equal(ErrTooLarge, err)
+		s.Channel().Kill()
+	}, func(s *Stream) {
+		s.Write(make([]byte, 5000))
+		s.CloseWrite()
+		s.Channel().Kill()
+	})
+}
+
+func TestDeadline(t *testing.T) {
+	assert := assert.New(t)
+
+	withStream(t, Config{}, func(s *Stream) {
+		buf := make([]byte, 10)
+		n, err := io.ReadFull(s, buf)
+		assert.NoError(err)
+		assert.Equal("pingpingpi", string(buf[:n]))
+
+		s.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		_, err = s.Read(buf)
+		assert.Equal(e3x.ErrTimeout, err)
+		s.Channel().Kill()
+	}, func(s *Stream) {
+		s.Write([]byte("pingpingpi"))
+		assert.NoError(s.Flush())
+
+		time.Sleep(200 * time.Millisecond)
+		s.Channel().Kill()
+	})
+}
@@ -0,0 +1,391 @@
+package e3x
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/telehash/gogotelehash/e3x/cipherset"
+	"github.com/telehash/gogotelehash/transports"
+	"github.com/telehash/gogotelehash/transports/transportsutil"
+)
+
+const cGroupAcceptBacklog = 1024
+
+// TransportGroup shares one set of transports between multiple endpoints.
+//
+// Incoming messages are routed to the endpoint that owns the exchange token
+// of the message. Handshakes for new exchanges are routed to the first endpoint
+// that is able to decrypt them.
+//
+//	g := e3x.NewTransportGroup(udp.Config{Addr: ":42424"})
+//	a, _ := e3x.Open(g.Transport())
+//	b, _ := e3x.Open(g.Transport())
+type TransportGroup struct {
+	config transports.Config
+
+	mtx       sync.Mutex
+	transport transports.Transport
+	members   []*groupTransport
+	readers   map[net.Conn]bool
+}
+
+type groupConfig struct {
+	group *TransportGroup
+	e     *Endpoint
+}
+
+// groupTransport is the transport of a single endpoint in the group.
+type groupTransport struct {
+	group   *TransportGroup
+	e       *Endpoint
+	cAccept chan net.Conn
+	done    chan struct{}
+
+	mtx    sync.Mutex
+	closed bool
+	conns  map[net.Conn]*groupConn
+}
+
+type groupConn struct {
+	t        *groupTransport
+	conn     net.Conn
+	halfPipe *transportsutil.HalfPipe
+}
+
+// NewTransportGroup makes a new group for config. The transport is opened
+// when the first endpoint joins the group and closed when the last endpoint
+// is closed.
+func NewTransportGroup(config transports.Config) *TransportGroup {
+	return &TransportGroup{config: config}
+}
+
+// Transport returns an EndpointOption that attaches the endpoint to the group.
+func (g *TransportGroup) Transport() EndpointOption {
+	return func(e *Endpoint) error {
+		return Transport(&groupConfig{g, e})(e)
+	}
+}
+
+func (c *groupConfig) Open() (transports.Transport, error) {
+	return c.group.join(c.e)
+}
+
+func (g *TransportGroup) join(e *Endpoint) (*groupTransport, error) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	if g.transport == nil {
+		t, err := g.config.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		g.transport = t
+		g.readers = make(map[net.Conn]bool)
+		go g.acceptConnections(t)
+	}
+
+	m := &groupTransport{
+		group:   g,
+		e:       e,
+		cAccept: make(chan net.Conn, cGroupAcceptBacklog),
+		done:    make(chan struct{}),
+		conns:   make(map[net.Conn]*groupConn),
+	}
+
+	g.members = append(g.members, m)
+	return m, nil
+}
+
+func (g *TransportGroup) leave(m *groupTransport) error {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	for i, o := range g.members {
+		if o == m {
+			copy(g.members[i:], g.members[i+1:])
+			g.members[len(g.members)-1] = nil
+			g.members = g.members[:len(g.members)-1]
+			break
+		}
+	}
+
+	if len(g.members) > 0 || g.transport == nil {
+		return nil
+	}
+
+	t := g.transport
+	g.transport = nil
+	return t.Close()
+}
+
+func (g *TransportGroup) acceptConnections(t transports.Transport) {
+	for {
+		conn, err := t.Accept()
+		if err == io.EOF {
+			return
+		}
+		if neterr, ok := err.(net.Error); ok && neterr.Temporary() {
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		g.startReader(conn)
+	}
+}
+
+func (g *TransportGroup) startReader(conn net.Conn) {
+	g.mtx.Lock()
+	if g.readers == nil || g.readers[conn] {
+		g.mtx.Unlock()
+		return
+	}
+	g.readers[conn] = true
+	g.mtx.Unlock()
+
+	go g.reader(conn)
+}
+
+func (g *TransportGroup) reader(conn net.Conn) {
+	var b [1500]byte
+
+	defer func() {
+		g.mtx.Lock()
+		delete(g.readers, conn)
+		members := append([]*groupTransport(nil), g.members...)
+		g.mtx.Unlock()
+
+		for _, m := range members {
+			m.dropConn(conn)
+		}
+	}()
+
+	for {
+		n, err := conn.Read(b[:])
+		if err != nil {
+			return
+		}
+
+		if m := g.route(b[:n]); m != nil {
+			m.deliver(conn, b[:n])
+		}
+	}
+}
+
+// route returns the member that must receive msg.
+func (g *TransportGroup) route(msg []byte) *groupTransport {
+	g.mtx.Lock()
+	members := append([]*groupTransport(nil), g.members...)
+	g.mtx.Unlock()
+
+	if len(members) == 1 {
+		return members[0]
+	}
+
+	var (
+		token = cipherset.ExtractToken(msg)
+		owner *groupTransport
+	)
+
+	if token != cipherset.ZeroToken {
+		for _, m := range members {
+			m.e.mtx.Lock()
+			x := m.e.tokens[token]
+			m.e.mtx.Unlock()
+
+			if x != nil {
+				owner = m
+				break
+			}
+		}
+	}
+
+	if len(msg) < 3 || msg[0] != 0 || msg[1] != 1 {
+		// channel packet
+		return owner
+	}
+
+	// Handshake tokens are derived from the sender's key and are therefore
+	// the same for all the endpoints in the group. Only the endpoint that
+	// can decrypt the handshake may receive it.
+	if owner != nil {
+		for i, m := range members {
+			if m == owner {
+				copy(members[1:i+1], members[:i])
+				members[0] = owner
+				break
+			}
+		}
+	}
+
+	csid := msg[2]
+	for _, m := range members {
+		m.e.mtx.Lock()
+		key := m.e.keys[csid]
+		m.e.mtx.Unlock()
+
+		if key == nil {
+			continue
+		}
+
+		if _, err := cipherset.DecryptHandshake(csid, key, msg[3:]); err == nil {
+			return m
+		}
+	}
+
+	return nil
+}
+
+func (t *groupTransport) getConn(conn net.Conn, accept bool) *groupConn {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.closed {
+		return nil
+	}
+
+	c := t.conns[conn]
+	if c != nil {
+		return c
+	}
+
+	c = &groupConn{t: t, conn: conn, halfPipe: transportsutil.NewHalfPipe()}
+	if accept {
+		select {
+		case t.cAccept <- c:
+		default:
+			return nil // backlog is full
+		}
+	}
+
+	t.conns[conn] = c
+	return c
+}
+
+func (t *groupTransport) deliver(conn net.Conn, msg []byte) {
+	if c := t.getConn(conn, true); c != nil {
+		c.halfPipe.PushMessage(msg)
+	}
+}
+
+func (t *groupTransport) dropConn(conn net.Conn) {
+	t.mtx.Lock()
+	c := t.conns[conn]
+	delete(t.conns, conn)
+	t.mtx.Unlock()
+
+	if c != nil {
+		c.halfPipe.Close()
+	}
+}
+
+func (t *groupTransport) Addrs() []net.Addr {
+	t.group.mtx.Lock()
+	s := t.group.transport
+	t.group.mtx.Unlock()
+
+	if s == nil {
+		return nil
+	}
+
+	return s.Addrs()
+}
+
+func (t *groupTransport) Dial(addr net.Addr) (net.Conn, error) {
+	t.group.mtx.Lock()
+	s := t.group.transport
+	t.group.mtx.Unlock()
+
+	if s == nil {
+		return nil, io.EOF
+	}
+
+	conn, err := s.Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	t.group.startReader(conn)
+
+	c := t.getConn(conn, false)
+	if c == nil {
+		return nil, io.EOF
+	}
+
+	return c, nil
+}
+
+func (t *groupTransport) Accept() (net.Conn, error) {
+	select {
+	case c := <-t.cAccept:
+		return c, nil
+	case <-t.done:
+		return nil, io.EOF
+	}
+}
+
+func (t *groupTransport) Close() error {
+	t.mtx.Lock()
+	if t.closed {
+		t.mtx.Unlock()
+		return nil
+	}
+	t.closed = true
+	conns := t.conns
+	t.conns = nil
+	close(t.done)
+	t.mtx.Unlock()
+
+	for _, c := range conns {
+		c.halfPipe.Close()
+	}
+
+	return t.group.leave(t)
+}
+
+func (c *groupConn) Read(b []byte) (int, error) {
+	return c.halfPipe.Read(b)
+}
+
+func (c *groupConn) Write(b []byte) (int, error) {
+	return c.conn.Write(b)
+}
+
+// Close detaches the connection from the endpoint. The underlying connection
+// is shared with the other endpoints of the group and remains open.
+func (c *groupConn) Close() error {
+	c.halfPipe.Close()
+
+	c.t.mtx.Lock()
+	if c.t.conns[c.conn] == c {
+		delete(c.t.conns, c.conn)
+	}
+	c.t.mtx.Unlock()
+
+	return nil
+}
+
+func (c *groupConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *groupConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *groupConn) SetDeadline(t time.Time) error {
+	return c.halfPipe.SetReadDeadline(t)
+}
+
+func (c *groupConn) SetReadDeadline(t time.Time) error {
+	return c.halfPipe.SetReadDeadline(t)
+}
+
+func (c *groupConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
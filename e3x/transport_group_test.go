@@ -0,0 +1,75 @@
+package e3x
+
+import (
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/internal/lob"
+	"github.com/telehash/gogotelehash/transports/udp"
+)
+
+func TestTransportGroup(t *testing.T) {
+	assert := assert.New(t)
+
+	group := NewTransportGroup(udp.Config{Network: "udp4", Addr: "127.0.0.1:0"})
+
+	A1, err := Open(group.Transport(), DisableLog())
+	if !assert.NoError(err) {
+		return
+	}
+	defer A1.Close()
+
+	A2, err := Open(group.Transport(), DisableLog())
+	if !assert.NoError(err) {
+		return
+	}
+	defer A2.Close()
+
+	B, err := Open(Transport(udp.Config{Network: "udp4", Addr: "127.0.0.1:0"}), DisableLog())
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	assert.Equal(A1.transport.Addrs(), A2.transport.Addrs())
+
+	serve := func(e *Endpoint) {
+		l := e.Listen("whoami", false)
+		go func() {
+			defer l.Close()
+			for {
+				c, err := l.AcceptChannel()
+				if err != nil {
+					return
+				}
+
+				pkt, err := c.ReadPacket()
+				if err == nil {
+					pkt.Free()
+					c.WritePacket(lob.New([]byte(e.LocalHashname())))
+				}
+				c.Kill()
+			}
+		}()
+	}
+	serve(A1)
+	serve(A2)
+
+	for _, A := range []*Endpoint{A1, A2, A1} {
+		ident, err := A.LocalIdentity()
+		assert.NoError(err)
+
+		c, err := B.Open(ident, "whoami", false)
+		if !assert.NoError(err) {
+			continue
+		}
+
+		assert.NoError(c.WritePacket(lob.New(nil)))
+		pkt, err := c.ReadPacket()
+		if assert.NoError(err) {
+			assert.Equal(string(A.LocalHashname()), string(pkt.Body(nil)))
+		}
+		c.Kill()
+	}
+}
@@ -23,6 +23,18 @@ func (m *MockExchange) deliverPacket(pkt *lob.Packet, dst *Pipe) error {
 	return args.Error(0)
 }
 
+func (m *MockExchange) deliverPackets(pkts []*lob.Packet, dst *Pipe) (int, error) {
+	for i, pkt := range pkts {
+		if err := m.deliverPacket(pkt, dst); err != nil {
+			return i, err
+		}
+	}
+	return len(pkts), nil
+}
+
+func (m *MockExchange) pathStalled(p *Pipe) {
+}
+
 func (m *MockExchange) RemoteIdentity() *Identity {
 	args := m.Called()
 	return args.Get(0).(*Identity)
@@ -0,0 +1,207 @@
+// Command iot demonstrates a fleet of constrained sensor devices that report
+// their readings to a gateway.
+//
+// Each device is an endpoint with a single cs1a key (the cipherset intended
+// for constrained hardware). Devices open an unreliable "sensor" channel to
+// the gateway and send one packet per reading. The gateway runs the bridge
+// module so devices that can't reach each other directly can still be routed,
+// and it republishes every reading on an MQTT style topic
+// (telehash/<hashname>/<sensor>).
+//
+// The devices are connected to the gateway with the in-process transport which
+// stands in for a framed serial link, and the gateway writes the republished
+// readings to stdout. Both are plain Publisher/transports.Config values and
+// can be replaced by real links and a real broker.
+//
+// Pass -gateway-keys=<file> to keep the hashname of the gateway across runs.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/e3x/cipherset"
+	"github.com/telehash/gogotelehash/internal/lob"
+	"github.com/telehash/gogotelehash/internal/modules/bridge"
+	"github.com/telehash/gogotelehash/transports/inproc"
+)
+
+// Publisher republishes sensor readings.
+type Publisher interface {
+	Publish(topic string, payload []byte) error
+}
+
+type writerPublisher struct {
+	mtx sync.Mutex
+	w   io.Writer
+}
+
+func (p *writerPublisher) Publish(topic string, payload []byte) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	_, err := fmt.Fprintf(p.w, "%s %s\n", topic, payload)
+	return err
+}
+
+func main() {
+	var (
+		numDevices = flag.Int("devices", 3, "number of sensor devices")
+		numSamples = flag.Int("samples", 5, "number of readings per device")
+		interval   = flag.Duration("interval", 500*time.Millisecond, "time between readings")
+		keysPath   = flag.String("gateway-keys", "", "file that holds the gateway keys (generated when missing)")
+		keyStore   cipherset.KeyStore
+	)
+	flag.Parse()
+
+	if *keysPath != "" {
+		keyStore = cipherset.NewFileKeyStore(*keysPath)
+	}
+
+	err := runFleet(*numDevices, *numSamples, *interval, keyStore, &writerPublisher{w: os.Stdout})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func runFleet(numDevices, numSamples int, interval time.Duration, keyStore cipherset.KeyStore, pub Publisher) error {
+	gateway, err := openGateway(keyStore)
+	if err != nil {
+		return err
+	}
+	defer gateway.Close()
+
+	ident, err := gateway.LocalIdentity()
+	if err != nil {
+		return err
+	}
+
+	listener := gateway.Listen("sensor", false)
+	defer listener.Close()
+	go republish(listener, pub)
+
+	var (
+		wg   sync.WaitGroup
+		errs = make(chan error, numDevices)
+	)
+
+	for i := 0; i < numDevices; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- runDevice(ident, numSamples, interval)
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// openGateway opens the gateway endpoint. When keyStore is nil the gateway
+// gets a new hashname on every run.
+func openGateway(keyStore cipherset.KeyStore) (*e3x.Endpoint, error) {
+	options := []e3x.EndpointOption{
+		e3x.Transport(inproc.Config{}),
+		bridge.Module(bridge.Config{}),
+		e3x.DisableLog(),
+	}
+
+	if keyStore != nil {
+		options = append(options, e3x.KeyStore(keyStore))
+	}
+
+	return e3x.Open(options...)
+}
+
+func republish(listener *e3x.Listener, pub Publisher) {
+	for {
+		c, err := listener.AcceptChannel()
+		if err != nil {
+			return
+		}
+
+		go func(c *e3x.Channel) {
+			defer c.Kill()
+
+			for i := 0; ; i++ {
+				pkt, err := c.ReadPacket()
+				if err != nil {
+					return
+				}
+
+				if i == 0 {
+					// accept the channel
+					c.WritePacket(lob.New(nil))
+				}
+
+				sensor, _ := pkt.Header().GetString("sensor")
+				topic := "telehash/" + string(c.RemoteHashname()) + "/" + sensor
+				pub.Publish(topic, pkt.Body(nil))
+				pkt.Free()
+			}
+		}(c)
+	}
+}
+
+func runDevice(gateway *e3x.Identity, numSamples int, interval time.Duration) error {
+	key, err := cipherset.GenerateKey(0x1a)
+	if err != nil {
+		return err
+	}
+
+	device, err := e3x.Open(
+		e3x.Keys(cipherset.Keys{0x1a: key}),
+		e3x.Transport(inproc.Config{}),
+		e3x.DisableLog())
+	if err != nil {
+		return err
+	}
+	defer device.Close()
+
+	c, err := device.Open(gateway, "sensor", false)
+	if err != nil {
+		return err
+	}
+	defer c.Kill()
+
+	for i := 0; i < numSamples; i++ {
+		err = c.WritePacket(reading("temperature", 18+4*rand.Float64()))
+		if err != nil {
+			return err
+		}
+
+		if i == 0 {
+			// wait for the gateway to accept the channel
+			_, err = c.ReadPacket()
+			if err != nil {
+				return err
+			}
+		}
+
+		time.Sleep(interval)
+	}
+
+	return nil
+}
+
+func reading(sensor string, value float64) *lob.Packet {
+	pkt := lob.New([]byte(strconv.FormatFloat(value, 'f', 2, 64)))
+	pkt.Header().SetString("sensor", sensor)
+	return pkt
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+)
+
+type recordingPublisher struct {
+	mtx    sync.Mutex
+	topics map[string]int
+}
+
+func (p *recordingPublisher) Publish(topic string, payload []byte) error {
+	p.mtx.Lock()
+	p.topics[topic]++
+	p.mtx.Unlock()
+	return nil
+}
+
+func TestFleet(t *testing.T) {
+	assert := assert.New(t)
+
+	pub := &recordingPublisher{topics: make(map[string]int)}
+
+	err := runFleet(3, 3, 50*time.Millisecond, nil, pub)
+	assert.NoError(err)
+
+	pub.mtx.Lock()
+	defer pub.mtx.Unlock()
+
+	assert.Equal(3, len(pub.topics))
+	for topic := range pub.topics {
+		assert.True(strings.HasPrefix(topic, "telehash/"))
+		assert.True(strings.HasSuffix(topic, "/temperature"))
+	}
+}
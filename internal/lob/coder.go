@@ -11,6 +11,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"sync"
 
 	"github.com/telehash/gogotelehash/internal/util/bufpool"
@@ -87,6 +88,31 @@ func (p *Packet) BodyLen() int {
 	return p.body.Len()
 }
 
+// ReadBodyFrom reads at most n bytes from r directly into the packet body.
+// It replaces the current body.
+func (p *Packet) ReadBodyFrom(r io.Reader, n int) (int, error) {
+	if p.body == nil {
+		p.body = bufpool.New()
+	}
+
+	m, err := r.Read(p.body.SetLen(n).RawBytes())
+	if m < 0 {
+		m = 0
+	}
+
+	p.body.SetLen(m)
+	return m, err
+}
+
+// WriteBodyTo writes the packet body to w without copying it.
+func (p *Packet) WriteBodyTo(w io.Writer) (int, error) {
+	if p.body == nil {
+		return 0, nil
+	}
+
+	return p.body.WriteTo(w)
+}
+
 func (p *Packet) SetHeader(header Header) *Packet {
 	p.header = header
 	return p
@@ -1,6 +1,7 @@
 package lob
 
 import (
+	"bytes"
 	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
 	"github.com/telehash/gogotelehash/internal/util/bufpool"
 	"testing"
@@ -61,6 +62,28 @@ func BenchmarkEncode(b *testing.B) {
 	}
 }
 
+func TestBodyIO(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		r   = bytes.NewReader([]byte("hello world"))
+		w   bytes.Buffer
+		pkt = New(nil)
+	)
+
+	n, err := pkt.ReadBodyFrom(r, 5)
+	assert.NoError(err)
+	assert.Equal(5, n)
+	assert.Equal("hello", string(pkt.Body(nil)))
+
+	n, err = pkt.WriteBodyTo(&w)
+	assert.NoError(err)
+	assert.Equal(5, n)
+	assert.Equal("hello", w.String())
+
+	pkt.Free()
+}
+
 func BenchmarkDecode(b *testing.B) {
 	var src = []*Packet{
 		New([]byte("world")).SetHeader(Header{Bytes: []byte("h")}),
@@ -0,0 +1,105 @@
+package bridge
+
+import (
+	"sync"
+
+	"github.com/telehash/gogotelehash/e3x/cipherset"
+	"github.com/telehash/gogotelehash/internal/hashname"
+)
+
+// RouteStats holds the traffic a router forwarded. Bytes are counted on the
+// wire (the end-to-end encrypted messages).
+type RouteStats struct {
+	Bytes   uint64
+	Packets uint64
+	Dropped uint64 // packets dropped because the queue was full or over quota
+}
+
+func (s *RouteStats) add(o RouteStats) {
+	s.Bytes += o.Bytes
+	s.Packets += o.Packets
+	s.Dropped += o.Dropped
+}
+
+// Usage is a snapshot of the relay capacity used on a router.
+type Usage struct {
+	Total   RouteStats                     // since the module was started
+	Tokens  map[cipherset.Token]RouteStats // by route (while the route exists)
+	Sources map[hashname.H]RouteStats      // by sending peer (while its exchange is open)
+}
+
+type usageMeter struct {
+	mtx     sync.Mutex
+	total   RouteStats
+	tokens  map[cipherset.Token]*RouteStats
+	sources map[hashname.H]*RouteStats
+}
+
+func (m *usageMeter) forwarded(token cipherset.Token, source hashname.H, n int) {
+	m.record(token, source, RouteStats{Bytes: uint64(n), Packets: 1})
+}
+
+func (m *usageMeter) dropped(token cipherset.Token, source hashname.H) {
+	m.record(token, source, RouteStats{Dropped: 1})
+}
+
+func (m *usageMeter) record(token cipherset.Token, source hashname.H, o RouteStats) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.tokens == nil {
+		m.tokens = make(map[cipherset.Token]*RouteStats)
+		m.sources = make(map[hashname.H]*RouteStats)
+	}
+
+	s := m.tokens[token]
+	if s == nil {
+		s = &RouteStats{}
+		m.tokens[token] = s
+	}
+	s.add(o)
+
+	s = m.sources[source]
+	if s == nil {
+		s = &RouteStats{}
+		m.sources[source] = s
+	}
+	s.add(o)
+
+	m.total.add(o)
+}
+
+func (m *usageMeter) forgetToken(token cipherset.Token) {
+	m.mtx.Lock()
+	delete(m.tokens, token)
+	m.mtx.Unlock()
+}
+
+func (m *usageMeter) forgetSource(source hashname.H) {
+	m.mtx.Lock()
+	delete(m.sources, source)
+	m.mtx.Unlock()
+}
+
+func (m *usageMeter) snapshot() Usage {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	u := Usage{
+		Total:   m.total,
+		Tokens:  make(map[cipherset.Token]RouteStats, len(m.tokens)),
+		Sources: make(map[hashname.H]RouteStats, len(m.sources)),
+	}
+	for token, s := range m.tokens {
+		u.Tokens[token] = *s
+	}
+	for source, s := range m.sources {
+		u.Sources[source] = *s
+	}
+	return u
+}
+
+// Usage returns the traffic the router forwarded by route and by source.
+func (mod *module) Usage() Usage {
+	return mod.usage.snapshot()
+}
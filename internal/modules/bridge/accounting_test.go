@@ -0,0 +1,37 @@
+package bridge
+
+import (
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/e3x/cipherset"
+)
+
+func TestUsageMeter(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		m      usageMeter
+		tokenA = cipherset.Token{1}
+		tokenB = cipherset.Token{2}
+	)
+
+	m.forwarded(tokenA, "a", 100)
+	m.forwarded(tokenA, "a", 50)
+	m.forwarded(tokenB, "b", 70)
+	m.dropped(tokenB, "b")
+
+	u := m.snapshot()
+	assert.Equal(RouteStats{Bytes: 220, Packets: 3, Dropped: 1}, u.Total)
+	assert.Equal(RouteStats{Bytes: 150, Packets: 2}, u.Tokens[tokenA])
+	assert.Equal(RouteStats{Bytes: 70, Packets: 1, Dropped: 1}, u.Sources["b"])
+
+	m.forgetToken(tokenA)
+	m.forgetSource("b")
+
+	u = m.snapshot()
+	assert.Equal(RouteStats{Bytes: 220, Packets: 3, Dropped: 1}, u.Total)
+	assert.Len(u.Tokens, 1)
+	assert.Len(u.Sources, 1)
+}
@@ -1,14 +1,23 @@
+// Package bridge implements the router role of telehash v3 and its client side.
+//
+// A router handles "peer" channels: the BODY of the request is a handshake (or
+// a key packet) for the hashname in the "peer" header. The router forwards the
+// BODY to that hashname in a "connect" channel and routes the messages with the
+// token of the handshake back to the requester. The target answers with a
+// "peer" request of its own, which installs the route in the other direction.
+// From then on the router forwards the end-to-end encrypted messages by token
+// without being able to read them.
 package bridge
 
 import (
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/telehash/gogotelehash/e3x"
 	"github.com/telehash/gogotelehash/e3x/cipherset"
 	"github.com/telehash/gogotelehash/internal/hashname"
-	"github.com/telehash/gogotelehash/internal/util/bufpool"
 	"github.com/telehash/gogotelehash/internal/util/logs"
 )
 
@@ -16,11 +25,62 @@ type Config struct {
 	DisableRouter bool
 	AllowPeer     func(from, to hashname.H) bool
 	AllowConnect  func(from, via hashname.H) bool
+
+	// DisableRelay stops RequestRoute from installing bridge routes as
+	// fallback paths for peers that can't be reached directly.
+	DisableRelay bool
+
+	// RouteTTL is the time a route is kept while it forwards no traffic.
+	// Defaults to 2 minutes.
+	RouteTTL time.Duration
+
+	// RouteExpired is called when a route expired or was evicted. source is
+	// the peer the route forwarded to. It must not block.
+	RouteExpired func(token cipherset.Token, source hashname.H)
+
+	// MaxRoutes limits the number of routes. When the limit is reached the
+	// least recently used route is evicted, unless it forwarded traffic in
+	// the last 5 seconds; then the new route is rejected. Zero means no limit.
+	MaxRoutes int
+
+	// RouteRejected is called when a route was rejected because MaxRoutes
+	// was reached. source is the peer that requested the route. It must not
+	// block.
+	RouteRejected func(token cipherset.Token, source hashname.H)
+
+	// RelayPolicy decides whether from may request routes and have traffic
+	// forwarded, and how many bytes per second (zero means no limit). It is
+	// asked when from requests a route or first sends traffic and the answer
+	// is kept until the exchange with from closes. Traffic over the quota is
+	// dropped. The default allows everyone without a limit.
+	RelayPolicy func(from hashname.H) (allowed bool, bytesPerSecond int64)
+
+	// MaxRelayHops is the number of routers a route may pass. A router that
+	// has no link to the target of a peer request forwards the request to
+	// the routers it knows (see Routers) until this limit is reached.
+	// Defaults to 2; 1 disables chaining.
+	MaxRelayHops int
+
+	// Routers are the routers peer requests may be forwarded to when we are
+	// not linked with the target. Routers our peers are reachable through
+	// (peer paths) and routers that chained requests to us are known as
+	// well; other exchanges are never asked.
+	Routers []hashname.H
 }
 
+const (
+	defaultRouteTTL     = 2 * time.Minute
+	defaultMaxRelayHops = 2
+
+	// minEvictIdle protects busy routes from eviction.
+	minEvictIdle = 5 * time.Second
+)
+
 type Bridge interface {
-	RouteToken(token cipherset.Token, source *e3x.Exchange)
+	RouteToken(token cipherset.Token, source *e3x.Exchange) bool
 	BreakRoute(token cipherset.Token)
+	RequestRoute(x *e3x.Exchange) int
+	Usage() Usage
 }
 
 type module struct {
@@ -30,9 +90,21 @@ type module struct {
 	peerListener    *e3x.Listener
 	connectListener *e3x.Listener
 	pending         map[hashname.H]*pendingIntroduction
-	packetRoutes    map[cipherset.Token]*e3x.Exchange
+	packetRoutes    map[cipherset.Token]*route
 	connections     map[*e3x.Exchange]map[cipherset.Token]*connection
+	routers         map[hashname.H]bool // routers that chained peer requests to us
+	scheduler       *scheduler
+	usage           usageMeter
 	log             *logs.Logger
+	done            chan struct{}
+
+	quotaMtx sync.Mutex
+	quotas   map[hashname.H]*quotaBucket
+}
+
+type route struct {
+	source   *e3x.Exchange
+	lastUsed int64 // unix nanoseconds; accessed atomically
 }
 
 type pendingIntroduction struct {
@@ -65,16 +137,27 @@ func FromEndpoint(e *e3x.Endpoint) Bridge {
 }
 
 func newBridge(e *e3x.Endpoint, config Config) *module {
+	if config.RouteTTL <= 0 {
+		config.RouteTTL = defaultRouteTTL
+	}
+	if config.MaxRelayHops <= 0 {
+		config.MaxRelayHops = defaultMaxRelayHops
+	}
+
 	return &module{
 		e:            e,
 		config:       config,
 		pending:      make(map[hashname.H]*pendingIntroduction),
-		packetRoutes: make(map[cipherset.Token]*e3x.Exchange),
+		packetRoutes: make(map[cipherset.Token]*route),
+		routers:      make(map[hashname.H]bool),
+		done:         make(chan struct{}),
+		quotas:       make(map[hashname.H]*quotaBucket),
 	}
 }
 
 func (mod *module) Init() error {
 	mod.log = logs.Module("bridge").From(mod.e.LocalHashname())
+	mod.scheduler = newScheduler(mod.log)
 
 	mod.e.DefaultExchangeHooks().Register(e3x.ExchangeHook{
 		OnClosed:     mod.on_exchange_closed,
@@ -90,11 +173,13 @@ func (mod *module) Start() error {
 
 	go mod.acceptPeerChannels()
 	go mod.acceptConnectChannels()
+	go mod.runRouteExpiry()
 
 	return nil
 }
 
 func (mod *module) Stop() error {
+	close(mod.done)
 	mod.peerListener.Close()
 	mod.connectListener.Close()
 
@@ -198,23 +283,120 @@ func (mod *module) acceptConnectChannels() {
 	}
 }
 
-func (mod *module) RouteToken(token cipherset.Token, source *e3x.Exchange) {
+// RouteToken routes the messages with token to source. It returns false when
+// the route was rejected because the route table is full.
+func (mod *module) RouteToken(token cipherset.Token, source *e3x.Exchange) bool {
+	var (
+		now          = time.Now()
+		evictedToken cipherset.Token
+		evicted      *route
+	)
+
 	mod.mtx.Lock()
-	mod.packetRoutes[token] = source
+	if _, found := mod.packetRoutes[token]; !found && mod.config.MaxRoutes > 0 && len(mod.packetRoutes) >= mod.config.MaxRoutes {
+		evictedToken, evicted = mod.leastRecentlyUsedRoute()
+		if evicted == nil || atomic.LoadInt64(&evicted.lastUsed) > now.Add(-minEvictIdle).UnixNano() {
+			mod.mtx.Unlock()
+
+			mod.log.To(source.RemoteHashname()).Printf("route rejected %x: route table is full", token)
+			if mod.config.RouteRejected != nil {
+				mod.config.RouteRejected(token, source.RemoteHashname())
+			}
+			return false
+		}
+		delete(mod.packetRoutes, evictedToken)
+	}
+	mod.packetRoutes[token] = &route{source: source, lastUsed: now.UnixNano()}
 	mod.mtx.Unlock()
+
+	if evicted != nil {
+		mod.usage.forgetToken(evictedToken)
+		mod.log.To(evicted.source.RemoteHashname()).Printf("route evicted %x", evictedToken)
+		if mod.config.RouteExpired != nil {
+			mod.config.RouteExpired(evictedToken, evicted.source.RemoteHashname())
+		}
+	}
+
+	return true
+}
+
+// leastRecentlyUsedRoute must be called while holding mod.mtx.
+func (mod *module) leastRecentlyUsedRoute() (cipherset.Token, *route) {
+	var (
+		lruToken cipherset.Token
+		lru      *route
+		lruUsed  int64
+	)
+
+	for token, r := range mod.packetRoutes {
+		if used := atomic.LoadInt64(&r.lastUsed); lru == nil || used < lruUsed {
+			lruToken, lru, lruUsed = token, r, used
+		}
+	}
+
+	return lruToken, lru
 }
 
 func (mod *module) BreakRoute(token cipherset.Token) {
 	mod.mtx.Lock()
 	delete(mod.packetRoutes, token)
 	mod.mtx.Unlock()
+
+	mod.usage.forgetToken(token)
 }
 
+// lookupToken returns the exchange the route for token forwards to and keeps
+// the route alive.
 func (mod *module) lookupToken(token cipherset.Token) (source *e3x.Exchange) {
 	mod.mtx.RLock()
-	source = mod.packetRoutes[token]
+	r := mod.packetRoutes[token]
 	mod.mtx.RUnlock()
-	return
+
+	if r == nil {
+		return nil
+	}
+
+	atomic.StoreInt64(&r.lastUsed, time.Now().UnixNano())
+	return r.source
+}
+
+func (mod *module) runRouteExpiry() {
+	var ticker = time.NewTicker(mod.config.RouteTTL / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mod.done:
+			return
+		case now := <-ticker.C:
+			mod.expireRoutes(now)
+		}
+	}
+}
+
+// expireRoutes removes the routes that forwarded no traffic for RouteTTL.
+func (mod *module) expireRoutes(now time.Time) {
+	var (
+		deadline = now.Add(-mod.config.RouteTTL).UnixNano()
+		expired  = make(map[cipherset.Token]*route)
+	)
+
+	mod.mtx.Lock()
+	for token, r := range mod.packetRoutes {
+		if atomic.LoadInt64(&r.lastUsed) < deadline {
+			delete(mod.packetRoutes, token)
+			expired[token] = r
+		}
+	}
+	mod.mtx.Unlock()
+
+	for token, r := range expired {
+		mod.usage.forgetToken(token)
+		mod.log.To(r.source.RemoteHashname()).Printf("route expired %x", token)
+		if mod.config.RouteExpired != nil {
+			mod.config.RouteExpired(token, r.source.RemoteHashname())
+		}
+	}
 }
 
 func (mod *module) registerConnection(x *e3x.Exchange, token cipherset.Token, conn *connection) {
@@ -286,12 +468,29 @@ func (mod *module) lookupConnection(x *e3x.Exchange, token cipherset.Token) *con
 	return conn
 }
 
+// lookupRoutedConnection returns the connection for token via any router.
+func (mod *module) lookupRoutedConnection(token cipherset.Token) *connection {
+	mod.mtx.RLock()
+	defer mod.mtx.RUnlock()
+
+	for _, tokens := range mod.connections {
+		if conn := tokens[token]; conn != nil {
+			return conn
+		}
+	}
+
+	return nil
+}
+
 func (mod *module) on_exchange_closed(e *e3x.Endpoint, x *e3x.Exchange, reason error) error {
+	var tokens []cipherset.Token
+
 	mod.mtx.Lock()
 
-	for token, exchange := range mod.packetRoutes {
-		if exchange == x {
+	for token, r := range mod.packetRoutes {
+		if r.source == x {
 			delete(mod.packetRoutes, token)
+			tokens = append(tokens, token)
 		}
 	}
 
@@ -303,8 +502,16 @@ func (mod *module) on_exchange_closed(e *e3x.Endpoint, x *e3x.Exchange, reason e
 		delete(mod.connections, x)
 	}
 
+	delete(mod.routers, x.RemoteHashname())
+
 	mod.mtx.Unlock()
 
+	for _, token := range tokens {
+		mod.usage.forgetToken(token)
+	}
+	mod.usage.forgetSource(x.RemoteHashname())
+	mod.forgetQuota(x.RemoteHashname())
+
 	for _, conn := range connections {
 		conn.Close()
 	}
@@ -339,20 +546,31 @@ func (mod *module) forwardMessage(e *e3x.Endpoint, x *e3x.Exchange, msg []byte,
 
 	// handle bridged message
 	dst := ex.ActivePipe()
-	if dst == pipe {
+	if dst == nil || dst == pipe {
 		return nil
 	}
 
-	buf := bufpool.New().Set(msg)
-	_, err := dst.Write(buf)
-	buf.Free()
-	if err != nil {
-		mod.log.To(ex.RemoteHashname()).Printf("\x1B[35mFWD %x %s error=%s\x1B[0m", token, dst.RemoteAddr(), err)
-		return nil
-	} else {
-		mod.log.To(ex.RemoteHashname()).Printf("\x1B[35mFWD %x %s\x1B[0m", token, dst.RemoteAddr())
+	_, class, ok := splitClass(msg)
+	if !ok {
+		mod.usage.dropped(token, x.RemoteHashname())
+		mod.log.To(ex.RemoteHashname()).Printf("\x1B[35mFWD %x %s error=no class\x1B[0m", token, dst.RemoteAddr())
 		return e3x.ErrStopPropagation
 	}
+
+	if !mod.allowTraffic(x.RemoteHashname(), len(msg)) {
+		mod.usage.dropped(token, x.RemoteHashname())
+		mod.log.To(ex.RemoteHashname()).Printf("\x1B[35mFWD %x %s error=over quota\x1B[0m", token, dst.RemoteAddr())
+		return e3x.ErrStopPropagation
+	}
+
+	if err := mod.scheduler.enqueue(dst, ex.RemoteHashname(), token, msg, class); err != nil {
+		mod.usage.dropped(token, x.RemoteHashname())
+		mod.log.To(ex.RemoteHashname()).Printf("\x1B[35mFWD %x %s error=%s\x1B[0m", token, dst.RemoteAddr(), err)
+		return err
+	}
+
+	mod.usage.forwarded(token, x.RemoteHashname(), len(msg))
+	return e3x.ErrStopPropagation
 }
 
 func (mod *module) receivedForwardedMessage(e *e3x.Endpoint, x *e3x.Exchange, msg []byte, pipe *e3x.Pipe, reason error) error {
@@ -361,10 +579,23 @@ func (mod *module) receivedForwardedMessage(e *e3x.Endpoint, x *e3x.Exchange, ms
 		conn  = mod.lookupConnection(x, token)
 	)
 
+	// the endpoint passed the message to the exchange it belongs to when it
+	// arrived from a router it has a path to
+	if conn == nil && pipe != nil && x.LocalToken() == token {
+		if _, bridged := pipe.RemoteAddr().(*peerAddr); !bridged {
+			conn = mod.lookupRoutedConnection(token)
+		}
+	}
+
 	if conn == nil {
 		return nil
 	}
 
-	conn.halfPipe.PushMessage(msg)
+	body, _, ok := splitClass(msg)
+	if !ok {
+		return e3x.ErrStopPropagation
+	}
+
+	conn.halfPipe.PushMessage(body)
 	return e3x.ErrStopPropagation
 }
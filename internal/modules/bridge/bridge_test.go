@@ -2,11 +2,15 @@ package bridge
 
 import (
 	"net"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
 
 	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/e3x/cipherset"
+	"github.com/telehash/gogotelehash/internal/hashname"
 	"github.com/telehash/gogotelehash/internal/lob"
 	"github.com/telehash/gogotelehash/internal/util/logs"
 	"github.com/telehash/gogotelehash/transports"
@@ -160,7 +164,206 @@ func TestBridge(t *testing.T) {
 
 	<-done
 
+	assert.NotEqual(uint64(0), FromEndpoint(R).Usage().Total.Packets)
+
+	assert.NoError(A.Close())
+	assert.NoError(B.Close())
+	assert.NoError(R.Close())
+}
+
+func TestRouteExpiry(t *testing.T) {
+	assert := assert.New(t)
+
+	var expired []cipherset.Token
+
+	A, err := e3x.Open(
+		e3x.Log(nil),
+		e3x.Transport(udp.Config{}),
+		Module(Config{}))
+	assert.NoError(err)
+	R, err := e3x.Open(
+		e3x.Log(nil),
+		e3x.Transport(udp.Config{}),
+		Module(Config{RouteExpired: func(token cipherset.Token, source hashname.H) {
+			assert.Equal(A.LocalHashname(), source)
+			expired = append(expired, token)
+		}}))
+	assert.NoError(err)
+
+	Aident, err := A.LocalIdentity()
+	assert.NoError(err)
+	x, err := R.Dial(Aident)
+	assert.NoError(err)
+
+	var (
+		mod   = FromEndpoint(R).(*module)
+		token = cipherset.Token{1}
+		now   = time.Now()
+	)
+
+	mod.RouteToken(token, x)
+	mod.expireRoutes(now.Add(defaultRouteTTL / 2))
+	assert.Equal(x, mod.lookupToken(token))
+	assert.Empty(expired)
+
+	mod.expireRoutes(time.Now().Add(defaultRouteTTL + time.Second))
+	assert.Nil(mod.lookupToken(token))
+	assert.Equal([]cipherset.Token{token}, expired)
+
+	assert.NoError(A.Close())
+	assert.NoError(R.Close())
+}
+
+func TestRouteLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	var rejected, evicted []cipherset.Token
+
+	A, err := e3x.Open(
+		e3x.Log(nil),
+		e3x.Transport(udp.Config{}),
+		Module(Config{}))
+	assert.NoError(err)
+	R, err := e3x.Open(
+		e3x.Log(nil),
+		e3x.Transport(udp.Config{}),
+		Module(Config{
+			MaxRoutes: 2,
+			RouteExpired: func(token cipherset.Token, source hashname.H) {
+				evicted = append(evicted, token)
+			},
+			RouteRejected: func(token cipherset.Token, source hashname.H) {
+				rejected = append(rejected, token)
+			},
+		}))
+	assert.NoError(err)
+
+	Aident, err := A.LocalIdentity()
+	assert.NoError(err)
+	x, err := R.Dial(Aident)
+	assert.NoError(err)
+
+	var (
+		mod = FromEndpoint(R).(*module)
+		t1  = cipherset.Token{1}
+		t2  = cipherset.Token{2}
+		t3  = cipherset.Token{3}
+	)
+
+	assert.True(mod.RouteToken(t1, x))
+	assert.True(mod.RouteToken(t2, x))
+
+	// both routes are busy
+	assert.False(mod.RouteToken(t3, x))
+	assert.Equal([]cipherset.Token{t3}, rejected)
+
+	// t1 is idle
+	mod.packetRoutes[t1].lastUsed = time.Now().Add(-time.Minute).UnixNano()
+	assert.True(mod.RouteToken(t3, x))
+	assert.Equal([]cipherset.Token{t1}, evicted)
+	assert.Nil(mod.lookupToken(t1))
+	assert.Equal(x, mod.lookupToken(t3))
+
+	assert.NoError(A.Close())
+	assert.NoError(R.Close())
+}
+
+func TestBridgeChain(t *testing.T) {
+	// given:
+	// A <-> R1 <-> R2 <-> B exchanges
+	// A --x B blocked by the firewall of B
+	// R2 is a configured router of R1
+	//
+	// then:
+	// A dials B via R1 and R2.
+
+	assert := assert.New(t)
+
+	var (
+		blacklistMtx sync.Mutex
+		blacklist    []net.Addr
+	)
+	blacklistRule := func(src net.Addr) bool {
+		blacklistMtx.Lock()
+		defer blacklistMtx.Unlock()
+		for _, addr := range blacklist {
+			if transports.EqualAddr(addr, src) {
+				return false
+			}
+		}
+		return true
+	}
+
+	A, err := e3x.Open(
+		e3x.Log(nil),
+		e3x.Transport(udp.Config{}),
+		Module(Config{}))
+	assert.NoError(err)
+	B, err := e3x.Open(
+		e3x.Log(nil),
+		e3x.Transport(fw.Config{Config: udp.Config{}, Allow: fw.RuleFunc(blacklistRule)}),
+		Module(Config{}))
+	assert.NoError(err)
+	R2, err := e3x.Open(
+		e3x.Log(nil),
+		e3x.Transport(udp.Config{}),
+		Module(Config{}))
+	assert.NoError(err)
+	R1, err := e3x.Open(
+		e3x.Log(nil),
+		e3x.Transport(udp.Config{}),
+		Module(Config{Routers: []hashname.H{R2.LocalHashname()}}))
+	assert.NoError(err)
+
+	Aident, err := A.LocalIdentity()
+	assert.NoError(err)
+	Bident, err := B.LocalIdentity()
+	assert.NoError(err)
+	R2ident, err := R2.LocalIdentity()
+	assert.NoError(err)
+
+	blacklistMtx.Lock()
+	blacklist = append(blacklist, Aident.Addresses()...)
+	blacklistMtx.Unlock()
+
+	_, err = R1.Dial(Aident)
+	assert.NoError(err)
+	_, err = R1.Dial(R2ident)
+	assert.NoError(err)
+	_, err = R2.Dial(Bident)
+	assert.NoError(err)
+
+	{
+		addr, err := transports.ResolveAddr("peer", string(R1.LocalHashname()))
+		assert.NoError(err)
+		Bident = Bident.AddPathCandiate(addr)
+	}
+
+	x, err := A.Dial(Bident)
+	if assert.NoError(err) {
+		assert.Equal("peer", x.ActivePath().Network())
+	}
+
 	assert.NoError(A.Close())
 	assert.NoError(B.Close())
+	assert.NoError(R1.Close())
+	assert.NoError(R2.Close())
+}
+
+func TestKnownRouters(t *testing.T) {
+	assert := assert.New(t)
+
+	R, err := e3x.Open(
+		e3x.Log(nil),
+		e3x.Transport(udp.Config{}),
+		Module(Config{Routers: []hashname.H{"router-a", "router-b", "router-a"}}))
+	assert.NoError(err)
+
+	mod := FromEndpoint(R).(*module)
+	mod.config.Routers = append(mod.config.Routers, R.LocalHashname())
+
+	// exchanges that aren't routers are never asked to forward a request
+	assert.Equal([]hashname.H{"router-a", "router-b"}, mod.knownRouters())
+
 	assert.NoError(R.Close())
 }
@@ -10,7 +10,9 @@ import (
 	"github.com/telehash/gogotelehash/internal/util/bufpool"
 )
 
-func (mod *module) peerVia(router *e3x.Exchange, to hashname.H, body *bufpool.Buffer) error {
+// peerVia asks router to connect to. via lists the routers that already
+// forwarded the request (see chain).
+func (mod *module) peerVia(router *e3x.Exchange, to hashname.H, body *bufpool.Buffer, via ...hashname.H) error {
 	ch, err := router.Open("peer", false)
 	if err != nil {
 		return err
@@ -19,11 +21,102 @@ func (mod *module) peerVia(router *e3x.Exchange, to hashname.H, body *bufpool.Bu
 
 	pkt := lob.New(body.RawBytes())
 	pkt.Header().SetString("peer", string(to))
+	if len(via) > 0 {
+		pkt.Header().Set("via", via)
+	}
 	ch.WritePacket(pkt)
 
 	return nil
 }
 
+// chain forwards a peer request for to, that arrived from requester, to the
+// routers we know (see knownRouters). One of them may be linked with to. Each
+// router that forwards the request adds itself to via; a router that finds
+// itself in via drops the request (loop) and the length of via is limited by
+// MaxRelayHops.
+func (mod *module) chain(requester, to hashname.H, via []hashname.H, body *bufpool.Buffer) {
+	var (
+		skip = map[hashname.H]bool{requester: true, to: true}
+		n    int
+	)
+	for _, hn := range via {
+		skip[hn] = true
+	}
+
+	for _, hn := range mod.knownRouters() {
+		if n == maxRelayRouters {
+			break
+		}
+		if skip[hn] || !mod.relayAllowed(hn) {
+			continue
+		}
+
+		r := mod.e.GetExchange(hn)
+		if r == nil || !r.State().IsOpen() {
+			continue
+		}
+
+		if err := mod.peerVia(r, to, body, via...); err == nil {
+			n++
+		}
+	}
+}
+
+// knownRouters returns the configured routers followed by the routers our
+// peers are reachable through and the routers that chained requests to us.
+func (mod *module) knownRouters() []hashname.H {
+	var (
+		routers []hashname.H
+		seen    = make(map[hashname.H]bool)
+	)
+
+	add := func(hn hashname.H) {
+		if !seen[hn] && hn != mod.e.LocalHashname() {
+			seen[hn] = true
+			routers = append(routers, hn)
+		}
+	}
+
+	for _, hn := range mod.config.Routers {
+		add(hn)
+	}
+	for _, x := range mod.e.GetExchanges() {
+		for _, addr := range x.KnownPaths() {
+			if paddr, ok := addr.(*peerAddr); ok {
+				add(paddr.router)
+			}
+		}
+	}
+
+	mod.mtx.RLock()
+	for hn := range mod.routers {
+		add(hn)
+	}
+	mod.mtx.RUnlock()
+
+	return routers
+}
+
+func getVia(hdr *lob.Header) []hashname.H {
+	v, found := hdr.Get("via")
+	if !found {
+		return nil
+	}
+
+	var via []hashname.H
+	switch l := v.(type) {
+	case []hashname.H:
+		via = l
+	case []interface{}:
+		for _, x := range l {
+			if s, ok := x.(string); ok {
+				via = append(via, hashname.H(s))
+			}
+		}
+	}
+	return via
+}
+
 func (mod *module) introduceVia(router *e3x.Exchange, to hashname.H) error {
 	localIdent, err := mod.e.LocalIdentity()
 	if err != nil {
@@ -80,6 +173,15 @@ func (mod *module) handle_peer(ch *e3x.Channel) {
 		return
 	}
 	peer := hashname.H(peerStr)
+	if !peer.Valid() || peer == mod.e.LocalHashname() || peer == ch.RemoteHashname() {
+		log.Printf("drop: invalid peer %q", peerStr)
+		return
+	}
+
+	if pkt.BodyLen() == 0 {
+		log.Printf("drop: no handshake in packet")
+		return
+	}
 
 	// MUST have link to either endpoint
 	if mod.e.GetExchange(ch.RemoteHashname()) == nil && mod.e.GetExchange(peer) == nil {
@@ -93,17 +195,58 @@ func (mod *module) handle_peer(ch *e3x.Channel) {
 		return
 	}
 
-	ex := mod.e.GetExchange(peer)
-	if ex == nil {
+	if !mod.allowRelay(ch.RemoteHashname()) {
+		log.Printf("drop: denied by relay policy")
+		return
+	}
+
+	var (
+		ex  = mod.e.GetExchange(peer)
+		via = getVia(pkt.Header())
+	)
+
+	for _, hn := range via {
+		if hn == mod.e.LocalHashname() {
+			log.Printf("drop: routing loop")
+			return
+		}
+
+		// every router the request passed MUST pass firewall and relay policy
+		if mod.config.AllowPeer != nil && !mod.config.AllowPeer(hn, peer) {
+			log.Printf("drop: router %s blocked by firewall", hn)
+			return
+		}
+		if !mod.relayAllowed(hn) {
+			log.Printf("drop: router %s denied by relay policy", hn)
+			return
+		}
+	}
+
+	// forward to an other router when we are not linked with the target
+	if ex == nil && len(via)+1 >= mod.config.MaxRelayHops {
 		log.Printf("drop: no exchange to target")
-		// resolve?
 		return
 	}
 
+	// the sender is a router; answers may be chained back through it
+	if len(via) > 0 {
+		mod.mtx.Lock()
+		mod.routers[ch.RemoteHashname()] = true
+		mod.mtx.Unlock()
+	}
+
 	token := cipherset.ExtractToken(pkt.Body(nil))
 	if token != cipherset.ZeroToken {
 		// add bridge back to requester
-		mod.RouteToken(token, ch.Exchange())
+		if !mod.RouteToken(token, ch.Exchange()) {
+			log.Printf("drop: route table is full")
+			return
+		}
+	}
+
+	if ex == nil {
+		mod.chain(ch.RemoteHashname(), peer, append(via, mod.e.LocalHashname()), bufpool.New().Set(pkt.Body(nil)))
+		return
 	}
 
 	mod.connect(ex, bufpool.New().Set(pkt.Body(nil)))
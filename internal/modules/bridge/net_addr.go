@@ -58,6 +58,10 @@ func (a *peerAddr) String() string {
 	return fmt.Sprintf("Peer{via: %q}", string(a.router[:8]))
 }
 
+func (a *peerAddr) URL() string {
+	return "peer://" + string(a.router)
+}
+
 func (a *peerAddr) MarshalJSON() ([]byte, error) {
 	var desc = struct {
 		Type string `json:"type"`
@@ -14,7 +14,8 @@ import (
 )
 
 var (
-	_ net.Conn = (*connection)(nil)
+	_ net.Conn        = (*connection)(nil)
+	_ e3x.ClassWriter = (*connection)(nil)
 )
 
 type connection struct {
@@ -43,7 +44,14 @@ func (c *connection) RemoteAddr() net.Addr {
 	return c.raddr
 }
 
+// Write writes a control message.
 func (c *connection) Write(b []byte) (int, error) {
+	return c.WriteClass(b, e3x.ClassControl)
+}
+
+// WriteClass writes b to the router and appends class so the routers can
+// honor it (see splitClass).
+func (c *connection) WriteClass(b []byte, class e3x.Class) (int, error) {
 	c.mtx.RLock()
 	closed := c.closed
 	c.mtx.RUnlock()
@@ -62,11 +70,14 @@ func (c *connection) Write(b []byte) (int, error) {
 		return len(b), nil
 	}
 
-	buf := bufpool.New().Set(b)
-	n, err := pipe.Write(buf)
+	buf := bufpool.New().Set(appendClass(b, class))
+	_, err := pipe.Write(buf)
 	buf.Free()
+	if err != nil {
+		return 0, err
+	}
 
-	return n, err
+	return len(b), nil
 }
 
 func (c *connection) sendHandshake(body []byte) error {
@@ -0,0 +1,108 @@
+package bridge
+
+import (
+	"time"
+
+	"github.com/telehash/gogotelehash/internal/hashname"
+)
+
+// quotaBucket is a token bucket that limits the bytes a peer may have
+// forwarded per second. Up to one second of traffic can be sent in a burst.
+type quotaBucket struct {
+	denied bool
+	rate   int64 // bytes per second; zero means no limit
+	tokens int64
+	last   time.Time
+}
+
+func newQuotaBucket(denied bool, rate int64, now time.Time) *quotaBucket {
+	return &quotaBucket{denied: denied, rate: rate, tokens: rate, last: now}
+}
+
+// take returns false when forwarding n bytes exceeds the quota.
+func (b *quotaBucket) take(n int, now time.Time) bool {
+	if b.denied {
+		return false
+	}
+	if b.rate <= 0 {
+		return true
+	}
+
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		if elapsed > time.Second {
+			elapsed = time.Second
+		}
+		b.tokens += int64(elapsed) * b.rate / int64(time.Second)
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+		b.last = now
+	}
+
+	if b.tokens < int64(n) {
+		return false
+	}
+
+	b.tokens -= int64(n)
+	return true
+}
+
+// allowRelay asks the relay policy whether from may use the router. The
+// answer is kept until the exchange with from closes.
+func (mod *module) allowRelay(from hashname.H) bool {
+	if mod.config.RelayPolicy == nil {
+		return true
+	}
+
+	allowed, rate := mod.config.RelayPolicy(from)
+
+	mod.quotaMtx.Lock()
+	if b := mod.quotas[from]; b == nil || b.denied == allowed || b.rate != rate {
+		mod.quotas[from] = newQuotaBucket(!allowed, rate, time.Now())
+	}
+	mod.quotaMtx.Unlock()
+
+	return allowed
+}
+
+// relayAllowed asks the relay policy whether hn may use the router without
+// keeping the answer. It is used for the routers a chained peer request
+// passed and the routers it is forwarded to (see chain); we may not have an
+// exchange with them whose close forgets the quota.
+func (mod *module) relayAllowed(hn hashname.H) bool {
+	if mod.config.RelayPolicy == nil {
+		return true
+	}
+
+	allowed, _ := mod.config.RelayPolicy(hn)
+	return allowed
+}
+
+// allowTraffic returns false when forwarding n bytes from source is not
+// allowed by the relay policy or exceeds the quota of source.
+func (mod *module) allowTraffic(source hashname.H, n int) bool {
+	if mod.config.RelayPolicy == nil {
+		return true
+	}
+
+	mod.quotaMtx.Lock()
+	b := mod.quotas[source]
+	mod.quotaMtx.Unlock()
+
+	// the peer didn't request a route itself; it answers a peer that did
+	if b == nil {
+		mod.allowRelay(source)
+	}
+
+	mod.quotaMtx.Lock()
+	defer mod.quotaMtx.Unlock()
+
+	b = mod.quotas[source]
+	return b != nil && b.take(n, time.Now())
+}
+
+func (mod *module) forgetQuota(source hashname.H) {
+	mod.quotaMtx.Lock()
+	delete(mod.quotas, source)
+	mod.quotaMtx.Unlock()
+}
@@ -0,0 +1,54 @@
+package bridge
+
+import (
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/internal/hashname"
+)
+
+func TestQuotaBucket(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		now = time.Now()
+		b   = newQuotaBucket(false, 1000, now)
+	)
+
+	assert.True(b.take(600, now))
+	assert.False(b.take(600, now))
+	assert.True(b.take(600, now.Add(200*time.Millisecond)))
+	assert.True(b.take(1000, now.Add(10*time.Second)))
+
+	assert.True(newQuotaBucket(false, 0, now).take(1<<20, now))
+	assert.False(newQuotaBucket(true, 0, now).take(1, now))
+}
+
+func TestRelayPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	mod := &module{
+		quotas: make(map[hashname.H]*quotaBucket),
+		config: Config{RelayPolicy: func(from hashname.H) (bool, int64) {
+			return from == "customer", 1000
+		}},
+	}
+
+	assert.True(mod.allowRelay("customer"))
+	assert.False(mod.allowRelay("stranger"))
+
+	assert.True(mod.allowTraffic("customer", 1000))
+	assert.False(mod.allowTraffic("customer", 1000))
+	assert.False(mod.allowTraffic("stranger", 1))
+	assert.False(mod.allowTraffic("other", 1))
+
+	mod.forgetQuota("customer")
+	assert.True(mod.allowTraffic("customer", 1000))
+
+	assert.True(mod.relayAllowed("customer"))
+	assert.False(mod.relayAllowed("router"))
+	_, found := mod.quotas["router"]
+	assert.False(found)
+}
@@ -0,0 +1,67 @@
+package bridge
+
+import (
+	"net"
+
+	"github.com/telehash/gogotelehash/e3x"
+)
+
+// maxRelayRouters limits the number of routers that are asked to bridge an
+// exchange at once.
+const maxRelayRouters = 4
+
+// RequestRoute installs bridge routes via other peers as fallback paths of x
+// and sends a handshake over each of them. Routers that have no link to the
+// remote endpoint of x drop the handshake; the route via a router that does
+// becomes a path like any other and is only used while it performs better
+// than the direct paths. Routers the remote endpoint announced (peer paths)
+// are tried first. It returns the number of routes that were requested.
+func (mod *module) RequestRoute(x *e3x.Exchange) int {
+	if mod.config.DisableRelay {
+		return 0
+	}
+
+	var (
+		target  = x.RemoteHashname()
+		addrs   []net.Addr
+		routers = make(map[string]bool)
+	)
+
+	add := func(r *e3x.Exchange) {
+		if r == nil || r == x || len(addrs) == maxRelayRouters {
+			return
+		}
+
+		hn := r.RemoteHashname()
+		if hn == target || routers[string(hn)] || !r.State().IsOpen() {
+			return
+		}
+
+		// don't bridge over a bridged exchange
+		if p := r.ActivePipe(); p == nil {
+			return
+		} else if _, bridged := p.RemoteAddr().(*peerAddr); bridged {
+			return
+		}
+
+		routers[string(hn)] = true
+		addrs = append(addrs, &peerAddr{router: hn})
+	}
+
+	for _, addr := range x.KnownPaths() {
+		if paddr, ok := addr.(*peerAddr); ok {
+			add(mod.e.GetExchange(paddr.router))
+		}
+	}
+	for _, r := range mod.e.GetExchanges() {
+		add(r)
+	}
+
+	if len(addrs) == 0 {
+		return 0
+	}
+
+	mod.log.To(target).Printf("requesting bridge routes via %v", addrs)
+	x.PunchPaths(addrs)
+	return len(addrs)
+}
@@ -0,0 +1,153 @@
+package bridge
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/e3x/cipherset"
+	"github.com/telehash/gogotelehash/internal/hashname"
+	"github.com/telehash/gogotelehash/internal/util/bufpool"
+	"github.com/telehash/gogotelehash/internal/util/logs"
+)
+
+const (
+	cMaxQueuedControl = 64
+	cMaxQueuedBulk    = 256
+)
+
+var errQueueFull = errors.New("bridge: queue full")
+
+// appendClass appends the class the originator gave msg. Relayed messages
+// are end-to-end encrypted so routers can't tell their class; they forward
+// the message with its class as is and the bridge at the target strips the
+// class again (see splitClass).
+func appendClass(msg []byte, class e3x.Class) []byte {
+	return append(msg[:len(msg):len(msg)], byte(class))
+}
+
+// splitClass returns the message and the class the originator appended.
+func splitClass(msg []byte) ([]byte, e3x.Class, bool) {
+	if len(msg) < 2 {
+		return nil, 0, false
+	}
+
+	class := e3x.Class(msg[len(msg)-1])
+	if class != e3x.ClassControl && class != e3x.ClassBulk {
+		return nil, 0, false
+	}
+
+	return msg[:len(msg)-1], class, true
+}
+
+// scheduler is the outbound scheduler of the router. Each destination pipe has
+// its own queue which is drained control messages first so relayed keepalives
+// are never starved behind relayed bulk transfers.
+type scheduler struct {
+	mtx    sync.Mutex
+	log    *logs.Logger
+	queues map[*e3x.Pipe]*pipeQueue
+}
+
+type pipeQueue struct {
+	control []*queuedMessage
+	bulk    []*queuedMessage
+}
+
+type queuedMessage struct {
+	buf   *bufpool.Buffer
+	token cipherset.Token
+	to    hashname.H
+}
+
+func newScheduler(log *logs.Logger) *scheduler {
+	return &scheduler{log: log, queues: make(map[*e3x.Pipe]*pipeQueue)}
+}
+
+// enqueue schedules msg to be written to dst. It returns errQueueFull when
+// the queue for class is full and the message was dropped.
+func (s *scheduler) enqueue(dst *e3x.Pipe, to hashname.H, token cipherset.Token, msg []byte, class e3x.Class) error {
+	var (
+		m     = &queuedMessage{token: token, to: to}
+		start bool
+	)
+
+	s.mtx.Lock()
+
+	q := s.queues[dst]
+	if q == nil {
+		q = &pipeQueue{}
+		s.queues[dst] = q
+		start = true
+	}
+
+	if !q.push(m, class) {
+		s.mtx.Unlock()
+		return errQueueFull
+	}
+
+	m.buf = bufpool.New().Set(msg)
+	s.mtx.Unlock()
+
+	if start {
+		go s.run(dst)
+	}
+
+	return nil
+}
+
+func (s *scheduler) run(dst *e3x.Pipe) {
+	for {
+		s.mtx.Lock()
+		q := s.queues[dst]
+		m := q.pop()
+		if m == nil {
+			delete(s.queues, dst)
+			s.mtx.Unlock()
+			return
+		}
+		s.mtx.Unlock()
+
+		_, err := dst.Write(m.buf)
+		m.buf.Free()
+		if err != nil {
+			s.log.To(m.to).Printf("\x1B[35mFWD %x %s error=%s\x1B[0m", m.token, dst.RemoteAddr(), err)
+		} else {
+			s.log.To(m.to).Printf("\x1B[35mFWD %x %s\x1B[0m", m.token, dst.RemoteAddr())
+		}
+	}
+}
+
+func (q *pipeQueue) push(m *queuedMessage, class e3x.Class) bool {
+	switch class {
+	case e3x.ClassControl:
+		if len(q.control) >= cMaxQueuedControl {
+			return false
+		}
+		q.control = append(q.control, m)
+	default:
+		if len(q.bulk) >= cMaxQueuedBulk {
+			return false
+		}
+		q.bulk = append(q.bulk, m)
+	}
+	return true
+}
+
+func (q *pipeQueue) pop() *queuedMessage {
+	var m *queuedMessage
+
+	if len(q.control) > 0 {
+		m, q.control[0] = q.control[0], nil
+		q.control = q.control[1:]
+		return m
+	}
+
+	if len(q.bulk) > 0 {
+		m, q.bulk[0] = q.bulk[0], nil
+		q.bulk = q.bulk[1:]
+		return m
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package bridge
+
+import (
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/e3x"
+)
+
+func TestSplitClass(t *testing.T) {
+	assert := assert.New(t)
+
+	msg := []byte("message")
+
+	body, class, ok := splitClass(appendClass(msg, e3x.ClassBulk))
+	assert.True(ok)
+	assert.Equal(e3x.ClassBulk, class)
+	assert.Equal(msg, body)
+
+	body, class, ok = splitClass(appendClass(msg, e3x.ClassControl))
+	assert.True(ok)
+	assert.Equal(e3x.ClassControl, class)
+	assert.Equal(msg, body)
+
+	_, _, ok = splitClass(append(msg, 7))
+	assert.False(ok)
+	_, _, ok = splitClass(nil)
+	assert.False(ok)
+}
+
+func TestPipeQueueControlFirst(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		q     pipeQueue
+		bulk1 = &queuedMessage{to: "bulk1"}
+		bulk2 = &queuedMessage{to: "bulk2"}
+		ctrl  = &queuedMessage{to: "ctrl"}
+	)
+
+	assert.True(q.push(bulk1, e3x.ClassBulk))
+	assert.True(q.push(bulk2, e3x.ClassBulk))
+	assert.True(q.push(ctrl, e3x.ClassControl))
+
+	assert.Equal(ctrl, q.pop())
+	assert.Equal(bulk1, q.pop())
+	assert.Equal(bulk2, q.pop())
+	assert.Nil(q.pop())
+
+	for i := 0; i < cMaxQueuedBulk; i++ {
+		assert.True(q.push(&queuedMessage{}, e3x.ClassBulk))
+	}
+	assert.False(q.push(&queuedMessage{}, e3x.ClassBulk))
+	assert.True(q.push(&queuedMessage{}, e3x.ClassControl))
+}
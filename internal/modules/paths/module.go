@@ -5,18 +5,36 @@ import (
 	"encoding/json"
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/telehash/gogotelehash/e3x"
 	"github.com/telehash/gogotelehash/internal/lob"
+	"github.com/telehash/gogotelehash/internal/modules/bridge"
 	"github.com/telehash/gogotelehash/transports"
+	"github.com/telehash/gogotelehash/transports/nat"
 )
 
 const moduleKey = "paths"
 
+// maxProbes is the number of reflexive addresses kept for NAT classification.
+const maxProbes = 32
+
+// punchBurst is the number of predicted ports that a peer tries when we are
+// behind a symmetric NAT.
+const punchBurst = 8
+
+// minAgreement is the number of distinct peers that must report the same
+// reflexive address before it is announced as an external address.
+const minAgreement = 2
+
 type module struct {
 	endpoint *e3x.Endpoint
 	listener *e3x.Listener
+
+	mtx     sync.Mutex
+	probes  []nat.Probe
+	natType transports.NATType
 }
 
 func Module() e3x.EndpointOption {
@@ -25,12 +43,27 @@ func Module() e3x.EndpointOption {
 	}
 }
 
+// NATType returns the type of the NAT in front of e as derived from the
+// addresses peers reported for e. Changes are reported with the OnNATChanged
+// endpoint hook.
+func NATType(e *e3x.Endpoint) transports.NATType {
+	mod, _ := e.Module(moduleKey).(*module)
+	if mod == nil {
+		return transports.NATUnknown
+	}
+
+	mod.mtx.Lock()
+	defer mod.mtx.Unlock()
+	return mod.natType
+}
+
 func (mod *module) Init() error {
 	mod.endpoint.Hooks().Register(e3x.EndpointHook{
 		OnNetChanged: mod.onNetChange,
 	})
 	mod.endpoint.DefaultExchangeHooks().Register(e3x.ExchangeHook{
-		OnOpened: mod.onNewLink,
+		OnOpened:      mod.onNewLink,
+		OnUnreachable: mod.onUnreachable,
 	})
 
 	mod.listener = mod.endpoint.Listen("path", false)
@@ -64,6 +97,15 @@ func (mod *module) onNewLink(e *e3x.Endpoint, x *e3x.Exchange) error {
 	return nil
 }
 
+// onUnreachable falls back to a bridge route when none of the (punched)
+// direct paths of x answer. This requires the bridge module.
+func (mod *module) onUnreachable(e *e3x.Endpoint, x *e3x.Exchange) error {
+	if b := bridge.FromEndpoint(e); b != nil {
+		b.RequestRoute(x)
+	}
+	return nil
+}
+
 func (mod *module) handlePathRequests() {
 	for {
 		c, err := mod.listener.AcceptChannel()
@@ -90,51 +132,198 @@ func (mod *module) negotiatePaths(x *e3x.Exchange) {
 
 	pkt := &lob.Packet{}
 	pkt.Header().Set("paths", addrs)
+	mod.setNATHeaders(pkt.Header())
 	if err := c.WritePacket(pkt); err != nil {
 		return // ignore
 	}
 
 	for {
-		_, err := c.ReadPacket()
+		pkt, pipe, err := c.ReadPacketFrom()
 		if err == io.EOF || err == e3x.ErrTimeout {
 			return
 		}
 		if err != nil {
 			return
 		}
+
+		// the peer reports the address it sees the socket of pipe at
+		if header, found := pkt.Header().Get("path"); found {
+			var local net.Addr
+			if pipe != nil {
+				local = pipe.LocalAddr()
+			}
+			if addr, err := decodeAddr(header); err == nil {
+				mod.observe(x.RemoteHashname().String(), local, addr)
+			}
+		}
 	}
 }
 
-func (mod *module) handlePathRequest(c *e3x.Channel) {
-	defer c.Kill()
+// observe records that server sees the local socket at reflexive (local is nil
+// when the socket is unknown) and reclassifies the NAT of the endpoint. The
+// reflexive address is only announced when other peers report it too; a
+// single peer can't be trusted with it.
+func (mod *module) observe(server string, local, reflexive net.Addr) {
+	var (
+		addrs   = e3x.TransportsFromEndpoint(mod.endpoint).LocalAddresses()
+		probe   = nat.Probe{Server: server, Reflexive: reflexive, Local: local}
+		changed bool
+		agreed  bool
+		typ     transports.NATType
+	)
 
-	pkt, err := c.ReadPacket()
-	if err != nil {
-		return // ignore
+	mod.mtx.Lock()
+	// keep the probes in the order they were observed (see setNATHeaders)
+	for i, p := range mod.probes {
+		if p.Server == server && socketOf(p) == socketOf(probe) {
+			mod.probes = append(mod.probes[:i], mod.probes[i+1:]...)
+			break
+		}
+	}
+	if len(mod.probes) == maxProbes {
+		mod.probes = append(mod.probes[:0], mod.probes[1:]...)
 	}
+	mod.probes = append(mod.probes, probe)
 
-	// decode paths known by peer and add them as candidates
-	if header, found := pkt.Header().Get("paths"); found {
-		data, err := json.Marshal(header)
-		if err != nil {
-			return // ignore
+	typ = nat.Classify(addrs, mod.probes)
+	if typ != mod.natType {
+		mod.natType = typ
+		changed = true
+	}
+
+	servers := make(map[string]bool)
+	for _, p := range mod.probes {
+		if socketOf(p) == socketOf(probe) && transports.EqualAddr(p.Reflexive, reflexive) {
+			servers[p.Server] = true
 		}
+	}
+	agreed = len(servers) >= minAgreement
+	mod.mtx.Unlock()
 
-		var entries []json.RawMessage
-		err = json.Unmarshal(data, &entries)
-		if err != nil {
-			return // ignore
+	// behind a symmetric NAT the reflexive address only works for server
+	if agreed && typ != transports.NATUnknown && typ != transports.NATSymmetric && !containsAddr(addrs, reflexive) {
+		e3x.TransportsFromEndpoint(mod.endpoint).AddReflexiveAddress(reflexive)
+	}
+
+	if changed {
+		mod.endpoint.Hooks().NATChanged(typ)
+	}
+}
+
+// setNATHeaders tells the peer the type of our NAT. Behind a symmetric NAT it
+// also lists the addresses our NAT will most likely allocate for the peer,
+// predicted from the ports it allocated for earlier peers.
+func (mod *module) setNATHeaders(hdr *lob.Header) {
+	local := e3x.TransportsFromEndpoint(mod.endpoint).LocalAddresses()
+
+	mod.mtx.Lock()
+	defer mod.mtx.Unlock()
+
+	if mod.natType == transports.NATUnknown {
+		return
+	}
+	hdr.SetString("nat", mod.natType.String())
+
+	if mod.natType != transports.NATSymmetric {
+		return
+	}
+
+	// the NAT allocates the ports of each local socket independently
+	var (
+		last  = make(map[string]net.Addr)
+		ports = make(map[string][]int)
+	)
+	for _, p := range mod.probes {
+		addr, ok := p.Reflexive.(nat.Addr)
+		if !ok || containsAddr(local, addr) {
+			continue
 		}
+		_, _, port := addr.InternalAddr()
+		socket := socketOf(p)
+		last[socket] = addr
+		ports[socket] = append(ports[socket], port)
+	}
 
-		for _, entry := range entries {
-			addr, err := transports.DecodeAddr(entry)
-			if err != nil {
-			}
-			if err == nil {
-				c.Exchange().AddPathCandidate(addr)
-			}
+	var predicted []net.Addr
+	for socket, addr := range last {
+		delta := nat.PortDelta(ports[socket])
+		if delta == 0 {
+			continue // unpredictable
+		}
+		predicted = append(predicted, nat.PredictAddrs(addr, delta, punchBurst)...)
+	}
+	if len(predicted) > 0 {
+		hdr.Set("predicted", predicted)
+	}
+}
+
+// socketOf identifies the local socket of p.
+func socketOf(p nat.Probe) string {
+	if p.Local == nil {
+		return p.Reflexive.Network()
+	}
+	return p.Reflexive.Network() + " " + p.Local.String()
+}
+
+func containsAddr(addrs []net.Addr, addr net.Addr) bool {
+	for _, x := range addrs {
+		if transports.EqualAddr(x, addr) {
+			return true
 		}
 	}
+	return false
+}
+
+func decodeAddrs(hdr *lob.Header, key string) []net.Addr {
+	header, found := hdr.Get(key)
+	if !found {
+		return nil
+	}
+
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil
+	}
+
+	var entries []json.RawMessage
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil
+	}
+
+	var addrs []net.Addr
+	for _, entry := range entries {
+		addr, err := transports.DecodeAddr(entry)
+		if err == nil {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+func decodeAddr(header interface{}) (net.Addr, error) {
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	return transports.DecodeAddr(data)
+}
+
+func (mod *module) handlePathRequest(c *e3x.Channel) {
+	defer c.Kill()
+
+	pkt, err := c.ReadPacket()
+	if err != nil {
+		return // ignore
+	}
+
+	// decode paths known by peer and punch them; the peer does the same with
+	// our paths when it handles our request
+	var candidates = decodeAddrs(pkt.Header(), "paths")
+	candidates = append(candidates, decodeAddrs(pkt.Header(), "predicted")...)
+	if len(candidates) > 0 {
+		c.Exchange().PunchPaths(candidates)
+	}
 
 	var pipes = c.Exchange().KnownPipes()
 
@@ -0,0 +1,128 @@
+package paths
+
+import (
+	"net"
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/internal/modules/bridge"
+	"github.com/telehash/gogotelehash/transports"
+	"github.com/telehash/gogotelehash/transports/fw"
+	"github.com/telehash/gogotelehash/transports/udp"
+)
+
+func TestRelayFallback(t *testing.T) {
+	// given:
+	// A <-> R exchange
+	// B <-> R exchange
+	// A --x B blocked by the firewall of B
+	//
+	// then:
+	// A dials B via a bridge route through R.
+
+	if testing.Short() {
+		t.Skip("this is a long running test.")
+	}
+
+	assert := assert.New(t)
+
+	var blacklist []net.Addr
+	blacklistRule := func(src net.Addr) bool {
+		for _, addr := range blacklist {
+			if transports.EqualAddr(addr, src) {
+				return false
+			}
+		}
+		return true
+	}
+
+	A, err := e3x.Open(
+		e3x.Log(nil),
+		e3x.Transport(udp.Config{}),
+		bridge.Module(bridge.Config{}),
+		Module())
+	assert.NoError(err)
+	B, err := e3x.Open(
+		e3x.Log(nil),
+		e3x.Transport(fw.Config{Config: udp.Config{}, Allow: fw.RuleFunc(blacklistRule)}),
+		bridge.Module(bridge.Config{}),
+		Module())
+	assert.NoError(err)
+	R, err := e3x.Open(
+		e3x.Log(nil),
+		e3x.Transport(udp.Config{}),
+		bridge.Module(bridge.Config{}))
+	assert.NoError(err)
+
+	Aident, err := A.LocalIdentity()
+	assert.NoError(err)
+	Bident, err := B.LocalIdentity()
+	assert.NoError(err)
+	Rident, err := R.LocalIdentity()
+	assert.NoError(err)
+
+	blacklist = append(blacklist, Aident.Addresses()...)
+
+	_, err = A.Dial(Rident)
+	assert.NoError(err)
+	_, err = B.Dial(Rident)
+	assert.NoError(err)
+
+	x, err := A.Dial(Bident)
+	if assert.NoError(err) {
+		assert.Equal("peer", x.ActivePath().Network())
+	}
+
+	assert.NoError(A.Close())
+	assert.NoError(B.Close())
+	assert.NoError(R.Close())
+}
+
+func TestObserve(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := e3x.Open(
+		e3x.Log(nil),
+		e3x.Transport(udp.Config{Network: "udp4", Addr: "127.0.0.1:0"}),
+		Module())
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	var (
+		mod = A.Module(moduleKey).(*module)
+		ext = e3x.TransportsFromEndpoint(A)
+	)
+
+	resolve := func(addr string) net.Addr {
+		a, err := transports.ResolveAddr("udp4", addr)
+		assert.NoError(err)
+		return a
+	}
+
+	var (
+		lan  = resolve("192.168.1.10:4242")
+		wan  = resolve("192.168.2.10:4242")
+		ext1 = resolve("203.0.113.7:42424")
+		ext2 = resolve("198.51.100.9:42424")
+	)
+
+	// each socket of a multihomed host has its own mapping
+	mod.observe("a", lan, ext1)
+	mod.observe("b", wan, ext2)
+	assert.Equal(transports.NATPortRestrictedCone, NATType(A))
+
+	// a reflexive address reported by one peer is not trusted
+	assert.Empty(ext.ExternalAddresses())
+	mod.observe("a", lan, ext1)
+	assert.Empty(ext.ExternalAddresses())
+
+	mod.observe("c", lan, ext1)
+	addrs := ext.ExternalAddresses()
+	if assert.Len(addrs, 1) {
+		assert.True(transports.EqualAddr(ext1, addrs[0]))
+	}
+}
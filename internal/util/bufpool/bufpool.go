@@ -58,7 +58,12 @@ func (b *Buffer) Get(buf []byte) []byte {
 func (b *Buffer) Set(buf []byte) *Buffer {
 	b.secure()
 	if len(buf) > bufferSize {
-		panic("data too large")
+		// packets on paths with a large MTU don't fit the pooled storage
+		b.bytes = append(make([]byte, 0, len(buf)), buf...)
+		return b
+	}
+	if cap(b.bytes) != bufferSize {
+		b.bytes = make([]byte, 0, bufferSize)
 	}
 	b.bytes = append(b.bytes[:0], buf...)
 	return b
@@ -93,6 +98,10 @@ func (b *Buffer) Free() {
 		return
 	}
 
+	if cap(b.bytes) > bufferSize {
+		b.bytes = make([]byte, 0, bufferSize)
+	}
+
 	if b.bytes == nil || cap(b.bytes) != bufferSize {
 		panic("invalid buffer return")
 	}
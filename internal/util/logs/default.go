@@ -10,7 +10,9 @@ var defaultLogger = New(os.Stdout)
 
 func ResetLogger() {
 	defaultLogger = New(os.Stderr)
+	disabledMtx.Lock()
 	disabledMods = map[string]bool{}
+	disabledMtx.Unlock()
 }
 
 func DisableLogger() {
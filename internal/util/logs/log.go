@@ -5,12 +5,18 @@ import (
 	"io"
 	"log"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/telehash/gogotelehash/internal/hashname"
 )
 
-var disabledMods = map[string]bool{}
+var (
+	disabledMtx  sync.RWMutex
+	disabledMods = map[string]bool{}
+	muted        int32 // accessed atomically
+)
 
 type Logger struct {
 	module string
@@ -27,16 +33,38 @@ func New(out io.Writer) *Logger {
 	return l
 }
 
+// DisableModule suppresses the output of the loggers of module name.
 func DisableModule(name string) {
+	disabledMtx.Lock()
 	disabledMods[name] = true
+	disabledMtx.Unlock()
 }
 
-func (l *Logger) Module(name string) *Logger {
-	if l == nil {
-		return nil
+// EnableModule re-enables a module that was disabled with DisableModule.
+func EnableModule(name string) {
+	disabledMtx.Lock()
+	delete(disabledMods, name)
+	disabledMtx.Unlock()
+}
+
+// SetMuted suppresses the output of all loggers while muted is true.
+func SetMuted(m bool) {
+	var v int32
+	if m {
+		v = 1
 	}
+	atomic.StoreInt32(&muted, v)
+}
+
+func isDisabled(name string) bool {
+	disabledMtx.RLock()
+	disabled := disabledMods[name]
+	disabledMtx.RUnlock()
+	return disabled
+}
 
-	if disabledMods[name] {
+func (l *Logger) Module(name string) *Logger {
+	if l == nil {
 		return nil
 	}
 
@@ -80,7 +108,7 @@ func (l *Logger) ResetTimer() *Logger {
 }
 
 func (l *Logger) Print(args ...interface{}) {
-	if l == nil {
+	if !l.enabled() {
 		return
 	}
 
@@ -88,7 +116,7 @@ func (l *Logger) Print(args ...interface{}) {
 }
 
 func (l *Logger) Println(args ...interface{}) {
-	if l == nil {
+	if !l.enabled() {
 		return
 	}
 
@@ -96,13 +124,18 @@ func (l *Logger) Println(args ...interface{}) {
 }
 
 func (l *Logger) Printf(format string, args ...interface{}) {
-	if l == nil {
+	if !l.enabled() {
 		return
 	}
 
 	l.emit(fmt.Sprintf(format, args...))
 }
 
+// enabled returns false when the output of l is suppressed.
+func (l *Logger) enabled() bool {
+	return l != nil && atomic.LoadInt32(&muted) == 0 && !isDisabled(l.module)
+}
+
 func (l *Logger) emit(msg string) {
 	if l == nil {
 		return
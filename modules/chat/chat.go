@@ -0,0 +1,526 @@
+// Package chat implements group chats between hashnames.
+//
+// A chat is led by the endpoint that created it and is identified by the
+// hashname of the leader and a name. Members join the chat by opening a
+// reliable "chat" channel to the leader. The leader keeps the roster, numbers
+// the messages and sends every message (including join and leave
+// notifications) to all members, so all members see the same messages in the
+// same order:
+//
+//	room, _ := chat.FromEndpoint(leader).Create("lobby")
+//
+//	room, _ := chat.FromEndpoint(e).Join(leaderIdent, "lobby")
+//	room.Send("hello")
+//	for {
+//	  msg, err := room.Receive()
+//	  ...
+//	}
+//
+// The first packet of the channel has the "chat" header set to the name of
+// the chat. The leader answers with the roster in the "roster" header (or an
+// "err" header). All other packets have a "kind" header ("message", "join" or
+// "leave"); the leader adds "id", "from" and "at" headers and the text of a
+// message is the body of the packet. The "end" of the channel leaves the chat.
+package chat
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/internal/hashname"
+	"github.com/telehash/gogotelehash/internal/lob"
+	"github.com/telehash/gogotelehash/internal/util/logs"
+)
+
+const (
+	channelType = "chat"
+
+	// queueSize is the number of messages that are buffered for a member.
+	// Members that fall further behind are removed from the chat.
+	queueSize = 256
+)
+
+var (
+	ErrUnknownChat = errors.New("chat: unknown chat")
+	ErrChatExists  = errors.New("chat: chat already exists")
+	ErrClosed      = errors.New("chat: chat is closed")
+)
+
+// Types of messages.
+const (
+	TypeMessage = "message"
+	TypeJoin    = "join"
+	TypeLeave   = "leave"
+)
+
+// Message is a message of a chat as numbered by the leader.
+type Message struct {
+	ID   uint64
+	Type string
+	From hashname.H
+	At   time.Time
+	Text string
+}
+
+type Chatter interface {
+	// Create starts a chat named name which is led by the endpoint.
+	Create(name string) (*Chat, error)
+
+	// Join joins the chat named name which is led by leader.
+	Join(leader e3x.Identifier, name string) (*Chat, error)
+}
+
+type moduleKeyType string
+
+const moduleKey = moduleKeyType("chat")
+
+type module struct {
+	e   *e3x.Endpoint
+	log *logs.Logger
+
+	mtx   sync.Mutex
+	chats map[string]*Chat
+}
+
+func Module() e3x.EndpointOption {
+	return func(e *e3x.Endpoint) error {
+		return e3x.RegisterModule(moduleKey, newModule(e))(e)
+	}
+}
+
+func FromEndpoint(e *e3x.Endpoint) Chatter {
+	mod := e.Module(moduleKey)
+	if mod == nil {
+		return nil
+	}
+	return mod.(*module)
+}
+
+func newModule(e *e3x.Endpoint) *module {
+	return &module{e: e, chats: make(map[string]*Chat)}
+}
+
+func (mod *module) Init() error {
+	mod.log = logs.Module("chat").From(mod.e.LocalHashname())
+	return nil
+}
+
+func (mod *module) Start() error {
+	return mod.e.AddHandler(channelType, e3x.HandlerFunc(mod.handleJoin))
+}
+
+func (mod *module) Stop() error {
+	mod.e.RemoveHandler(channelType)
+
+	mod.mtx.Lock()
+	chats := mod.chats
+	mod.chats = make(map[string]*Chat)
+	mod.mtx.Unlock()
+
+	for _, chat := range chats {
+		chat.Leave()
+	}
+	return nil
+}
+
+// Chat is a chat the endpoint leads or joined.
+type Chat struct {
+	mod    *module
+	name   string
+	leader hashname.H
+	c      *e3x.Channel // nil for the leader
+
+	mtx     sync.Mutex
+	cnd     *sync.Cond
+	closed  bool
+	roster  map[hashname.H]bool
+	queue   []*Message
+	lastID  uint64
+	members map[hashname.H]*member // leader only
+}
+
+type member struct {
+	c     *e3x.Channel
+	queue chan *Message
+}
+
+func newChat(mod *module, name string, leader hashname.H) *Chat {
+	chat := &Chat{
+		mod:     mod,
+		name:    name,
+		leader:  leader,
+		roster:  make(map[hashname.H]bool),
+		members: make(map[hashname.H]*member),
+	}
+	chat.cnd = sync.NewCond(&chat.mtx)
+	chat.roster[leader] = true
+	return chat
+}
+
+func (mod *module) Create(name string) (*Chat, error) {
+	mod.mtx.Lock()
+	defer mod.mtx.Unlock()
+
+	if mod.chats[name] != nil {
+		return nil, ErrChatExists
+	}
+
+	chat := newChat(mod, name, mod.e.LocalHashname())
+	mod.chats[name] = chat
+	return chat, nil
+}
+
+func (mod *module) Join(leader e3x.Identifier, name string) (*Chat, error) {
+	c, err := mod.e.Open(leader, channelType, true)
+	if err != nil {
+		return nil, err
+	}
+
+	pkt := &lob.Packet{}
+	pkt.Header().SetString("chat", name)
+	err = c.WritePacket(pkt)
+	if err != nil {
+		c.Kill()
+		return nil, err
+	}
+
+	pkt, err = c.ReadPacket()
+	if err != nil {
+		c.Kill()
+		return nil, err
+	}
+	if reason, failed := pkt.Header().GetString("err"); failed {
+		pkt.Free()
+		c.Kill()
+		return nil, errors.New(reason)
+	}
+
+	chat := newChat(mod, name, c.RemoteHashname())
+	chat.c = c
+	for _, hn := range decodeRoster(pkt.Header()) {
+		chat.roster[hn] = true
+	}
+	pkt.Free()
+
+	go chat.readMessages()
+	return chat, nil
+}
+
+// Name returns the name of the chat.
+func (chat *Chat) Name() string { return chat.name }
+
+// Leader returns the hashname of the leader of the chat.
+func (chat *Chat) Leader() hashname.H { return chat.leader }
+
+// Roster returns the hashnames of the members of the chat (including the
+// leader).
+func (chat *Chat) Roster() []hashname.H {
+	chat.mtx.Lock()
+	defer chat.mtx.Unlock()
+
+	roster := make([]hashname.H, 0, len(chat.roster))
+	for hn := range chat.roster {
+		roster = append(roster, hn)
+	}
+	sort.Sort(hashnames(roster))
+	return roster
+}
+
+// Send sends text to all members of the chat.
+func (chat *Chat) Send(text string) error {
+	if chat.c == nil {
+		chat.mtx.Lock()
+		defer chat.mtx.Unlock()
+
+		if chat.closed {
+			return ErrClosed
+		}
+		chat.publish(TypeMessage, chat.leader, text)
+		return nil
+	}
+
+	pkt := lob.New([]byte(text))
+	pkt.Header().SetString("kind", TypeMessage)
+	return chat.c.WritePacket(pkt)
+}
+
+// Receive returns the next message of the chat. It returns io.EOF after the
+// chat was left or closed by the leader.
+func (chat *Chat) Receive() (*Message, error) {
+	chat.mtx.Lock()
+	defer chat.mtx.Unlock()
+
+	for len(chat.queue) == 0 && !chat.closed {
+		chat.cnd.Wait()
+	}
+	if len(chat.queue) == 0 {
+		return nil, io.EOF
+	}
+
+	msg := chat.queue[0]
+	chat.queue = chat.queue[1:]
+	return msg, nil
+}
+
+// Leave leaves the chat. When the endpoint leads the chat all members are
+// removed.
+func (chat *Chat) Leave() error {
+	chat.mtx.Lock()
+	if chat.closed {
+		chat.mtx.Unlock()
+		return nil
+	}
+	chat.closed = true
+	members := chat.members
+	chat.members = make(map[hashname.H]*member)
+	chat.cnd.Broadcast()
+	chat.mtx.Unlock()
+
+	if chat.c != nil {
+		return chat.c.Close()
+	}
+
+	chat.mod.mtx.Lock()
+	if chat.mod.chats[chat.name] == chat {
+		delete(chat.mod.chats, chat.name)
+	}
+	chat.mod.mtx.Unlock()
+
+	for _, m := range members {
+		close(m.queue)
+	}
+	return nil
+}
+
+// readMessages receives the messages the leader sends to a member.
+func (chat *Chat) readMessages() {
+	defer func() {
+		chat.mtx.Lock()
+		chat.closed = true
+		chat.cnd.Broadcast()
+		chat.mtx.Unlock()
+	}()
+
+	for {
+		pkt, err := chat.c.ReadPacket()
+		if err == io.EOF {
+			// the leader closed the chat or removed the member
+			chat.c.Close()
+			return
+		}
+		if err != nil {
+			chat.c.Kill()
+			return
+		}
+
+		msg := decodeMessage(pkt)
+		pkt.Free()
+		if msg == nil {
+			continue
+		}
+
+		chat.mtx.Lock()
+		switch msg.Type {
+		case TypeJoin:
+			chat.roster[msg.From] = true
+		case TypeLeave:
+			delete(chat.roster, msg.From)
+		}
+		chat.lastID = msg.ID
+		chat.queue = append(chat.queue, msg)
+		chat.cnd.Broadcast()
+		chat.mtx.Unlock()
+	}
+}
+
+// publish numbers a message and sends it to all members. chat.mtx must be
+// held.
+func (chat *Chat) publish(typ string, from hashname.H, text string) {
+	chat.lastID++
+	msg := &Message{ID: chat.lastID, Type: typ, From: from, At: time.Now(), Text: text}
+
+	// the members share msg
+	local := *msg
+	chat.queue = append(chat.queue, &local)
+	chat.cnd.Broadcast()
+
+	for hn, m := range chat.members {
+		select {
+		case m.queue <- msg:
+		default:
+			// the member is too slow
+			chat.mod.log.To(hn).Printf("\x1B[31mDropped member\x1B[0m of %s: queue is full", chat.name)
+			delete(chat.members, hn)
+			delete(chat.roster, hn)
+			close(m.queue)
+			defer chat.publish(TypeLeave, hn, "")
+		}
+	}
+}
+
+func (mod *module) handleJoin(c *e3x.Channel) {
+	pkt, err := c.ReadPacket()
+	if err != nil {
+		c.Kill()
+		return
+	}
+	name, _ := pkt.Header().GetString("chat")
+	pkt.Free()
+
+	mod.mtx.Lock()
+	chat := mod.chats[name]
+	mod.mtx.Unlock()
+
+	if chat == nil {
+		c.Error(ErrUnknownChat)
+		return
+	}
+
+	var (
+		peer = c.RemoteHashname()
+		m    = &member{c: c, queue: make(chan *Message, queueSize)}
+	)
+
+	chat.mtx.Lock()
+	if chat.closed {
+		chat.mtx.Unlock()
+		c.Error(ErrClosed)
+		return
+	}
+	if old := chat.members[peer]; old != nil {
+		// the peer joined again
+		close(old.queue)
+	}
+
+	// the roster is sent before any message that is published after the
+	// join.
+	pkt = &lob.Packet{}
+	roster := make([]hashname.H, 0, len(chat.roster)+1)
+	for hn := range chat.roster {
+		roster = append(roster, hn)
+	}
+	if !chat.roster[peer] {
+		roster = append(roster, peer)
+	}
+	pkt.Header().Set("roster", roster)
+	m.queue <- nil // marks the roster packet
+
+	chat.members[peer] = m
+	chat.roster[peer] = true
+	chat.publish(TypeJoin, peer, "")
+	chat.mtx.Unlock()
+
+	go chat.writeMessages(m, pkt)
+	chat.readMember(m, peer)
+}
+
+// writeMessages sends the roster and the messages of the chat to a member.
+func (chat *Chat) writeMessages(m *member, roster *lob.Packet) {
+	for msg := range m.queue {
+		var pkt *lob.Packet
+		if msg == nil {
+			pkt = roster
+		} else {
+			pkt = encodeMessage(msg)
+		}
+
+		if err := m.c.WritePacket(pkt); err != nil {
+			m.c.Kill()
+			return
+		}
+	}
+
+	// the member was removed
+	m.c.Close()
+}
+
+// readMember publishes the messages of a member.
+func (chat *Chat) readMember(m *member, peer hashname.H) {
+	for {
+		pkt, err := m.c.ReadPacket()
+		if err != nil {
+			break
+		}
+
+		typ, _ := pkt.Header().GetString("kind")
+		text := string(pkt.Body(nil))
+		pkt.Free()
+
+		if typ != TypeMessage {
+			continue
+		}
+
+		chat.mtx.Lock()
+		if chat.members[peer] == m {
+			chat.publish(TypeMessage, peer, text)
+		}
+		chat.mtx.Unlock()
+	}
+
+	chat.mtx.Lock()
+	if chat.members[peer] == m {
+		delete(chat.members, peer)
+		delete(chat.roster, peer)
+		close(m.queue)
+		chat.publish(TypeLeave, peer, "")
+	}
+	chat.mtx.Unlock()
+}
+
+func encodeMessage(msg *Message) *lob.Packet {
+	pkt := lob.New([]byte(msg.Text))
+	hdr := pkt.Header()
+	hdr.SetString("kind", msg.Type)
+	hdr.SetInt("id", int(msg.ID))
+	hdr.SetString("from", string(msg.From))
+	hdr.SetInt("at", int(msg.At.UnixNano()/int64(time.Millisecond)))
+	return pkt
+}
+
+func decodeMessage(pkt *lob.Packet) *Message {
+	var (
+		hdr     = pkt.Header()
+		typ, _  = hdr.GetString("kind")
+		from, _ = hdr.GetString("from")
+		id, _   = hdr.GetInt("id")
+		at, _   = hdr.GetInt("at")
+	)
+
+	if typ == "" || from == "" {
+		return nil
+	}
+
+	msg := &Message{
+		ID:   uint64(id),
+		Type: typ,
+		From: hashname.H(from),
+		At:   time.Unix(0, int64(at)*int64(time.Millisecond)),
+	}
+	if pkt.BodyLen() > 0 {
+		msg.Text = string(pkt.Body(nil))
+	}
+	return msg
+}
+
+func decodeRoster(hdr *lob.Header) []hashname.H {
+	v, _ := hdr.Get("roster")
+	entries, _ := v.([]interface{})
+
+	var roster []hashname.H
+	for _, e := range entries {
+		if s, ok := e.(string); ok {
+			roster = append(roster, hashname.H(s))
+		}
+	}
+	return roster
+}
+
+type hashnames []hashname.H
+
+func (s hashnames) Len() int           { return len(s) }
+func (s hashnames) Less(i, j int) bool { return s[i] < s[j] }
+func (s hashnames) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
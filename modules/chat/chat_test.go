@@ -0,0 +1,104 @@
+package chat
+
+import (
+	"io"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/internal/hashname"
+	"github.com/telehash/gogotelehash/transports/inproc"
+)
+
+func TestChat(t *testing.T) {
+	assert := assert.New(t)
+
+	var endpoints []*e3x.Endpoint
+	for i := 0; i < 3; i++ {
+		e, err := e3x.Open(e3x.Transport(inproc.Config{}), Module())
+		if !assert.NoError(err) {
+			return
+		}
+		defer e.Close()
+		endpoints = append(endpoints, e)
+	}
+
+	var (
+		A, B, C = endpoints[0], endpoints[1], endpoints[2]
+		next    = func(chat *Chat) *Message {
+			msg, err := chat.Receive()
+			if !assert.NoError(err) {
+				t.FailNow()
+			}
+			return msg
+		}
+	)
+
+	identA, err := A.LocalIdentity()
+	assert.NoError(err)
+
+	lobby, err := FromEndpoint(A).Create("lobby")
+	if !assert.NoError(err) {
+		return
+	}
+
+	_, err = FromEndpoint(A).Create("lobby")
+	assert.Equal(ErrChatExists, err)
+
+	_, err = FromEndpoint(B).Join(identA, "missing")
+	assert.Error(err)
+
+	roomB, err := FromEndpoint(B).Join(identA, "lobby")
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(&Message{ID: 1, Type: TypeJoin, From: B.LocalHashname()}, strip(next(roomB)))
+
+	roomC, err := FromEndpoint(C).Join(identA, "lobby")
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(&Message{ID: 2, Type: TypeJoin, From: C.LocalHashname()}, strip(next(roomC)))
+	assert.Equal(sorted(A.LocalHashname(), B.LocalHashname(), C.LocalHashname()), roomC.Roster())
+
+	assert.Equal(&Message{ID: 1, Type: TypeJoin, From: B.LocalHashname()}, strip(next(lobby)))
+	assert.Equal(&Message{ID: 2, Type: TypeJoin, From: C.LocalHashname()}, strip(next(lobby)))
+	assert.Equal(&Message{ID: 2, Type: TypeJoin, From: C.LocalHashname()}, strip(next(roomB)))
+
+	assert.NoError(roomB.Send("hello"))
+	assert.Equal(&Message{ID: 3, Type: TypeMessage, From: B.LocalHashname(), Text: "hello"}, strip(next(lobby)))
+	assert.NoError(lobby.Send("welcome"))
+	assert.Equal(&Message{ID: 4, Type: TypeMessage, From: A.LocalHashname(), Text: "welcome"}, strip(next(lobby)))
+
+	for _, chat := range []*Chat{roomB, roomC} {
+		assert.Equal(&Message{ID: 3, Type: TypeMessage, From: B.LocalHashname(), Text: "hello"}, strip(next(chat)))
+		assert.Equal(&Message{ID: 4, Type: TypeMessage, From: A.LocalHashname(), Text: "welcome"}, strip(next(chat)))
+	}
+
+	assert.NoError(roomC.Leave())
+	_, err = roomC.Receive()
+	assert.Equal(io.EOF, err)
+
+	assert.Equal(&Message{ID: 5, Type: TypeLeave, From: C.LocalHashname()}, strip(next(roomB)))
+	assert.Equal(sorted(A.LocalHashname(), B.LocalHashname()), roomB.Roster())
+	assert.Equal(sorted(A.LocalHashname(), B.LocalHashname()), lobby.Roster())
+
+	// closing the chat ends it for all members
+	assert.NoError(lobby.Leave())
+	_, err = roomB.Receive()
+	assert.Equal(io.EOF, err)
+}
+
+// strip clears the time of msg.
+func strip(msg *Message) *Message {
+	msg.At = time.Time{}
+	return msg
+}
+
+func sorted(hns ...hashname.H) []hashname.H {
+	sort.Sort(hashnames(hns))
+	return hns
+}
@@ -0,0 +1,301 @@
+// Package portfwd forwards TCP connections over telehash channels, like
+// ssh -L and -R.
+//
+// An endpoint exposes local TCP services to its peers under a name:
+//
+//	e3x.Open(portfwd.Module(portfwd.Config{
+//	  Services: map[string]string{"ssh": "127.0.0.1:22"},
+//	}))
+//
+// A peer listens on a local port and tunnels each accepted connection to the
+// service of the endpoint:
+//
+//	l, _ := portfwd.FromEndpoint(e).Forward("127.0.0.1:2222", ident, "ssh")
+//	defer l.Close()
+//
+// Each connection uses its own reliable "portfwd" channel. The first packet
+// names the service in its "service" header. The exposing endpoint connects
+// to the service and answers with an empty packet (or an "err" header) after
+// which the channel carries the raw stream in both directions. The "end" of
+// the channel closes the writing side of the connection.
+package portfwd
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/internal/hashname"
+	"github.com/telehash/gogotelehash/internal/lob"
+	"github.com/telehash/gogotelehash/internal/util/logs"
+)
+
+const (
+	channelType = "portfwd"
+
+	dialTimeout = 10 * time.Second
+)
+
+var (
+	ErrUnknownService = errors.New("portfwd: unknown service")
+	ErrNotAllowed     = errors.New("portfwd: not allowed")
+)
+
+type Config struct {
+	// Services maps the names of the exposed services to the TCP addresses
+	// they are forwarded to.
+	Services map[string]string
+
+	// Allow is called for each connection of peer to service. When Allow is
+	// nil all peers can connect to all exposed services.
+	Allow func(peer hashname.H, service string) bool
+}
+
+type Forwarder interface {
+	// Forward listens on the TCP address laddr and tunnels each accepted
+	// connection to service of peer. Close the listener to stop forwarding.
+	Forward(laddr string, peer e3x.Identifier, service string) (net.Listener, error)
+
+	// Expose makes the TCP address addr available to peers as service.
+	Expose(service, addr string)
+
+	// Unexpose removes service. Open connections are not closed.
+	Unexpose(service string)
+}
+
+type moduleKeyType string
+
+const moduleKey = moduleKeyType("portfwd")
+
+type module struct {
+	e        *e3x.Endpoint
+	config   Config
+	log      *logs.Logger
+	listener *e3x.Listener
+
+	mtx       sync.Mutex
+	services  map[string]string
+	listeners map[net.Listener]bool
+}
+
+func Module(config Config) e3x.EndpointOption {
+	return func(e *e3x.Endpoint) error {
+		return e3x.RegisterModule(moduleKey, newModule(e, config))(e)
+	}
+}
+
+func FromEndpoint(e *e3x.Endpoint) Forwarder {
+	mod := e.Module(moduleKey)
+	if mod == nil {
+		return nil
+	}
+	return mod.(*module)
+}
+
+func newModule(e *e3x.Endpoint, config Config) *module {
+	mod := &module{
+		e:         e,
+		config:    config,
+		services:  make(map[string]string),
+		listeners: make(map[net.Listener]bool),
+	}
+	for service, addr := range config.Services {
+		mod.services[service] = addr
+	}
+	return mod
+}
+
+func (mod *module) Init() error {
+	mod.log = logs.Module("portfwd").From(mod.e.LocalHashname())
+	mod.listener = mod.e.Listen(channelType, true)
+	return nil
+}
+
+func (mod *module) Start() error {
+	go mod.acceptChannels()
+	return nil
+}
+
+func (mod *module) Stop() error {
+	mod.listener.Close()
+
+	mod.mtx.Lock()
+	listeners := mod.listeners
+	mod.listeners = make(map[net.Listener]bool)
+	mod.mtx.Unlock()
+
+	for l := range listeners {
+		l.Close()
+	}
+	return nil
+}
+
+func (mod *module) Expose(service, addr string) {
+	mod.mtx.Lock()
+	mod.services[service] = addr
+	mod.mtx.Unlock()
+}
+
+func (mod *module) Unexpose(service string) {
+	mod.mtx.Lock()
+	delete(mod.services, service)
+	mod.mtx.Unlock()
+}
+
+func (mod *module) Forward(laddr string, peer e3x.Identifier, service string) (net.Listener, error) {
+	l, err := net.Listen("tcp", laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	mod.mtx.Lock()
+	mod.listeners[l] = true
+	mod.mtx.Unlock()
+
+	go mod.acceptConns(l, peer, service)
+	return l, nil
+}
+
+func (mod *module) acceptConns(l net.Listener, peer e3x.Identifier, service string) {
+	defer func() {
+		mod.mtx.Lock()
+		delete(mod.listeners, l)
+		mod.mtx.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go mod.forward(conn, peer, service)
+	}
+}
+
+// forward tunnels conn to service of peer.
+func (mod *module) forward(conn net.Conn, peer e3x.Identifier, service string) {
+	defer conn.Close()
+
+	c, err := mod.e.Open(peer, channelType, true)
+	if err != nil {
+		mod.log.Printf("\x1B[31mFailed to forward\x1B[0m %s to %s: %s", service, peer, err)
+		return
+	}
+
+	pkt := &lob.Packet{}
+	pkt.Header().SetString("service", service)
+	err = c.WritePacket(pkt)
+	if err != nil {
+		c.Kill()
+		return
+	}
+
+	pkt, err = c.ReadPacket()
+	if err != nil {
+		c.Kill()
+		return
+	}
+	reason, failed := pkt.Header().GetString("err")
+	pkt.Free()
+	if failed {
+		mod.log.To(c.RemoteHashname()).Printf("\x1B[31mFailed to forward\x1B[0m %s: %s", service, reason)
+		c.Kill()
+		return
+	}
+
+	tunnel(c, conn)
+}
+
+func (mod *module) acceptChannels() {
+	for {
+		c, err := mod.listener.AcceptChannel()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		go mod.serve(c)
+	}
+}
+
+// serve connects c to the service it requested.
+func (mod *module) serve(c *e3x.Channel) {
+	pkt, err := c.ReadPacket()
+	if err != nil {
+		c.Kill()
+		return
+	}
+	service, _ := pkt.Header().GetString("service")
+	pkt.Free()
+
+	mod.mtx.Lock()
+	addr, found := mod.services[service]
+	mod.mtx.Unlock()
+
+	if !found {
+		c.Error(ErrUnknownService)
+		return
+	}
+	if mod.config.Allow != nil && !mod.config.Allow(c.RemoteHashname(), service) {
+		c.Error(ErrNotAllowed)
+		return
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	defer conn.Close()
+
+	err = c.WritePacket(&lob.Packet{})
+	if err != nil {
+		c.Kill()
+		return
+	}
+
+	tunnel(c, conn)
+}
+
+// tunnel copies the streams of c and conn until both sides ended.
+func tunnel(c *e3x.Channel, conn net.Conn) {
+	sent := make(chan error, 1)
+	go func() {
+		_, err := c.ReadFrom(conn)
+		if err == nil {
+			pkt := &lob.Packet{}
+			hdr := pkt.Header()
+			hdr.End, hdr.HasEnd = true, true
+			err = c.WritePacket(pkt)
+		}
+		sent <- err
+	}()
+
+	_, err := c.WriteTo(conn)
+	if err == nil {
+		if cw, ok := conn.(interface {
+			CloseWrite() error
+		}); ok {
+			cw.CloseWrite()
+		} else {
+			conn.Close()
+		}
+	} else {
+		conn.Close()
+	}
+
+	if err == nil {
+		err = <-sent
+	}
+	if err != nil {
+		conn.Close()
+		c.Kill()
+		return
+	}
+
+	c.Close()
+}
@@ -0,0 +1,89 @@
+package portfwd
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/internal/hashname"
+	"github.com/telehash/gogotelehash/transports/inproc"
+)
+
+func TestForward(t *testing.T) {
+	assert := assert.New(t)
+
+	// echo service
+	service, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	defer service.Close()
+	go func() {
+		for {
+			conn, err := service.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	A, err := e3x.Open(
+		e3x.Transport(inproc.Config{}),
+		Module(Config{
+			Services: map[string]string{"echo": service.Addr().String()},
+			Allow: func(peer hashname.H, service string) bool {
+				return service != "secret"
+			},
+		}))
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := e3x.Open(
+		e3x.Transport(inproc.Config{}),
+		Module(Config{}))
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	identA, err := A.LocalIdentity()
+	assert.NoError(err)
+
+	FromEndpoint(A).Expose("secret", service.Addr().String())
+
+	for _, name := range []string{"echo", "missing", "secret"} {
+		l, err := FromEndpoint(B).Forward("127.0.0.1:0", identA, name)
+		if !assert.NoError(err) {
+			return
+		}
+
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if !assert.NoError(err) {
+			return
+		}
+
+		conn.Write([]byte("hello telehash"))
+		conn.(*net.TCPConn).CloseWrite()
+
+		data, err := ioutil.ReadAll(conn)
+		if name == "echo" {
+			assert.NoError(err)
+			assert.Equal("hello telehash", string(data))
+		} else {
+			assert.Empty(data, name)
+		}
+
+		conn.Close()
+		l.Close()
+	}
+}
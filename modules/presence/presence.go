@@ -0,0 +1,372 @@
+// Package presence tracks the reachability of a set of peers.
+//
+// The module pings each watched peer at a fixed interval and records when it
+// was last seen:
+//
+//	e3x.Open(presence.Module(presence.Config{
+//	  Peers: []e3x.Identifier{alice, bob},
+//	  OnChange: func(status presence.Status) {
+//	    log.Printf("%s reachable=%v", status.Hashname, status.Reachable)
+//	  },
+//	}))
+//
+// A ping is an empty packet over an unreliable "presence" channel which the
+// module of the peer answers with an empty packet. A peer becomes unreachable
+// after two pings in a row went unanswered. Opened exchanges and pings from a
+// watched peer count as seeing the peer too and an exchange that reports its
+// paths as unreachable triggers an immediate ping.
+package presence
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/internal/hashname"
+	"github.com/telehash/gogotelehash/internal/lob"
+	"github.com/telehash/gogotelehash/internal/util/logs"
+)
+
+const (
+	channelType = "presence"
+
+	// DefaultInterval is the default time between two pings of a peer.
+	DefaultInterval = 30 * time.Second
+
+	// DefaultTimeout is the default time to wait for the answer to a ping.
+	DefaultTimeout = 10 * time.Second
+
+	maxMisses = 2
+)
+
+var ErrNotWatched = errors.New("presence: peer is not watched")
+
+type Config struct {
+	// Peers are watched from the start.
+	Peers []e3x.Identifier
+
+	// Interval is the time between two pings of a peer. Defaults to
+	// DefaultInterval.
+	Interval time.Duration
+
+	// Timeout is the time to wait for the answer to a ping. Defaults to
+	// DefaultTimeout.
+	Timeout time.Duration
+
+	// OnChange is called when a watched peer became reachable or unreachable.
+	// It may be called from multiple goroutines at once.
+	OnChange func(status Status)
+}
+
+// Status is the presence of a watched peer.
+type Status struct {
+	Hashname  hashname.H
+	Reachable bool
+
+	// LastSeen is the last time the peer answered a ping or was otherwise
+	// seen. It is zero when the peer was never seen.
+	LastSeen time.Time
+}
+
+type Presence interface {
+	// Watch starts tracking peer.
+	Watch(peer e3x.Identifier) error
+
+	// Unwatch stops tracking peer.
+	Unwatch(peer hashname.H)
+
+	// Status returns the status of peer.
+	Status(peer hashname.H) (Status, bool)
+
+	// Statuses returns the status of all watched peers ordered by hashname.
+	Statuses() []Status
+
+	// Ping pings peer and returns the round trip time. peer must be watched.
+	Ping(peer hashname.H) (time.Duration, error)
+}
+
+type moduleKeyType string
+
+const moduleKey = moduleKeyType("presence")
+
+type module struct {
+	e      *e3x.Endpoint
+	config Config
+	log    *logs.Logger
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	mtx   sync.Mutex
+	peers map[hashname.H]*peer
+}
+
+type peer struct {
+	ident   e3x.Identifier
+	status  Status
+	misses  int
+	pinging bool
+}
+
+func Module(config Config) e3x.EndpointOption {
+	return func(e *e3x.Endpoint) error {
+		return e3x.RegisterModule(moduleKey, newModule(e, config))(e)
+	}
+}
+
+func FromEndpoint(e *e3x.Endpoint) Presence {
+	mod := e.Module(moduleKey)
+	if mod == nil {
+		return nil
+	}
+	return mod.(*module)
+}
+
+func newModule(e *e3x.Endpoint, config Config) *module {
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+
+	return &module{e: e, config: config, peers: make(map[hashname.H]*peer)}
+}
+
+func (mod *module) Init() error {
+	mod.log = logs.Module("presence").From(mod.e.LocalHashname())
+	mod.e.DefaultExchangeHooks().Register(e3x.ExchangeHook{
+		OnOpened:      mod.onExchangeOpened,
+		OnUnreachable: mod.onExchangeUnreachable,
+	})
+	return nil
+}
+
+func (mod *module) Start() error {
+	err := mod.e.AddHandler(channelType, e3x.HandlerFunc(mod.handlePing))
+	if err != nil {
+		return err
+	}
+
+	mod.done = make(chan struct{})
+	mod.wg.Add(1)
+	go mod.run()
+
+	for _, ident := range mod.config.Peers {
+		err := mod.Watch(ident)
+		if err != nil {
+			mod.log.Printf("\x1B[31mFailed to watch\x1B[0m %s: %s", ident, err)
+		}
+	}
+
+	return nil
+}
+
+func (mod *module) Stop() error {
+	mod.e.RemoveHandler(channelType)
+	close(mod.done)
+	mod.wg.Wait()
+	return nil
+}
+
+func (mod *module) Watch(ident e3x.Identifier) error {
+	identity, err := ident.Identify(mod.e)
+	if err != nil {
+		return err
+	}
+	hn := identity.Hashname()
+
+	mod.mtx.Lock()
+	if mod.peers[hn] == nil {
+		mod.peers[hn] = &peer{ident: identity, status: Status{Hashname: hn}}
+	}
+	mod.mtx.Unlock()
+
+	mod.startPing(hn)
+	return nil
+}
+
+func (mod *module) Unwatch(hn hashname.H) {
+	mod.mtx.Lock()
+	delete(mod.peers, hn)
+	mod.mtx.Unlock()
+}
+
+func (mod *module) Status(hn hashname.H) (Status, bool) {
+	mod.mtx.Lock()
+	defer mod.mtx.Unlock()
+
+	p := mod.peers[hn]
+	if p == nil {
+		return Status{}, false
+	}
+	return p.status, true
+}
+
+func (mod *module) Statuses() []Status {
+	mod.mtx.Lock()
+	statuses := make([]Status, 0, len(mod.peers))
+	for _, p := range mod.peers {
+		statuses = append(statuses, p.status)
+	}
+	mod.mtx.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Hashname < statuses[j].Hashname
+	})
+	return statuses
+}
+
+func (mod *module) Ping(hn hashname.H) (time.Duration, error) {
+	mod.mtx.Lock()
+	p := mod.peers[hn]
+	mod.mtx.Unlock()
+
+	if p == nil {
+		return 0, ErrNotWatched
+	}
+
+	rtt, err := mod.ping(p.ident)
+	mod.update(hn, err == nil)
+	return rtt, err
+}
+
+func (mod *module) run() {
+	defer mod.wg.Done()
+
+	ticker := time.NewTicker(mod.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mod.done:
+			return
+		case <-ticker.C:
+		}
+
+		mod.mtx.Lock()
+		peers := make([]hashname.H, 0, len(mod.peers))
+		for hn := range mod.peers {
+			peers = append(peers, hn)
+		}
+		mod.mtx.Unlock()
+
+		for _, hn := range peers {
+			mod.startPing(hn)
+		}
+	}
+}
+
+// startPing pings hn in the background unless a ping is already in flight.
+func (mod *module) startPing(hn hashname.H) {
+	mod.mtx.Lock()
+	p := mod.peers[hn]
+	if p == nil || p.pinging {
+		mod.mtx.Unlock()
+		return
+	}
+	p.pinging = true
+	mod.mtx.Unlock()
+
+	go func() {
+		_, err := mod.ping(p.ident)
+
+		mod.mtx.Lock()
+		p.pinging = false
+		mod.mtx.Unlock()
+
+		mod.update(hn, err == nil)
+	}()
+}
+
+// ping sends a ping to ident and waits for the answer.
+func (mod *module) ping(ident e3x.Identifier) (time.Duration, error) {
+	start := time.Now()
+
+	c, err := mod.e.Open(ident, channelType, false)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Kill()
+
+	c.SetDeadline(start.Add(mod.config.Timeout))
+
+	err = c.WritePacket(&lob.Packet{})
+	if err != nil {
+		return 0, err
+	}
+
+	pkt, err := c.ReadPacket()
+	if err != nil {
+		return 0, err
+	}
+	pkt.Free()
+
+	return time.Since(start), nil
+}
+
+func (mod *module) handlePing(c *e3x.Channel) {
+	defer c.Kill()
+
+	c.SetDeadline(time.Now().Add(mod.config.Timeout))
+
+	pkt, err := c.ReadPacket()
+	if err != nil {
+		return
+	}
+	pkt.Free()
+
+	c.WritePacket(&lob.Packet{})
+	mod.update(c.RemoteHashname(), true)
+}
+
+func (mod *module) onExchangeOpened(e *e3x.Endpoint, x *e3x.Exchange) error {
+	mod.update(x.RemoteHashname(), true)
+	return nil
+}
+
+func (mod *module) onExchangeUnreachable(e *e3x.Endpoint, x *e3x.Exchange) error {
+	mod.startPing(x.RemoteHashname())
+	return nil
+}
+
+// update records a (failed) sighting of hn and calls OnChange when the
+// reachability of hn changed.
+func (mod *module) update(hn hashname.H, seen bool) {
+	mod.mtx.Lock()
+	p := mod.peers[hn]
+	if p == nil {
+		mod.mtx.Unlock()
+		return
+	}
+
+	reachable := p.status.Reachable
+	if seen {
+		p.status.LastSeen = time.Now()
+		p.status.Reachable = true
+		p.misses = 0
+	} else {
+		p.misses++
+		if p.misses >= maxMisses {
+			p.status.Reachable = false
+		}
+	}
+
+	status := p.status
+	mod.mtx.Unlock()
+
+	if status.Reachable == reachable {
+		return
+	}
+
+	if status.Reachable {
+		mod.log.To(hn).Printf("\x1B[32mReachable\x1B[0m")
+	} else {
+		mod.log.To(hn).Printf("\x1B[31mUnreachable\x1B[0m")
+	}
+
+	if mod.config.OnChange != nil {
+		mod.config.OnChange(status)
+	}
+}
@@ -0,0 +1,82 @@
+package presence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/transports/inproc"
+)
+
+func TestPresence(t *testing.T) {
+	assert := assert.New(t)
+
+	B, err := e3x.Open(e3x.Transport(inproc.Config{}), Module(Config{}))
+	if !assert.NoError(err) {
+		return
+	}
+	closedB := false
+	defer func() {
+		if !closedB {
+			B.Close()
+		}
+	}()
+
+	identB, err := B.LocalIdentity()
+	if !assert.NoError(err) {
+		return
+	}
+
+	changes := make(chan Status, 8)
+	A, err := e3x.Open(e3x.Transport(inproc.Config{}), Module(Config{
+		Peers:    []e3x.Identifier{identB},
+		Interval: 100 * time.Millisecond,
+		Timeout:  200 * time.Millisecond,
+		OnChange: func(status Status) { changes <- status },
+	}))
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	select {
+	case status := <-changes:
+		assert.Equal(B.LocalHashname(), status.Hashname)
+		assert.True(status.Reachable)
+		assert.False(status.LastSeen.IsZero())
+	case <-time.After(5 * time.Second):
+		t.Fatal("peer never became reachable")
+	}
+
+	rtt, err := FromEndpoint(A).Ping(B.LocalHashname())
+	assert.NoError(err)
+	assert.True(rtt > 0)
+
+	_, err = FromEndpoint(A).Ping(A.LocalHashname())
+	assert.Equal(ErrNotWatched, err)
+
+	statuses := FromEndpoint(A).Statuses()
+	if assert.Len(statuses, 1) {
+		assert.Equal(B.LocalHashname(), statuses[0].Hashname)
+		assert.True(statuses[0].Reachable)
+	}
+
+	closedB = true
+	B.Close()
+
+	select {
+	case status := <-changes:
+		assert.Equal(B.LocalHashname(), status.Hashname)
+		assert.False(status.Reachable)
+		assert.False(status.LastSeen.IsZero())
+	case <-time.After(5 * time.Second):
+		t.Fatal("peer never became unreachable")
+	}
+
+	FromEndpoint(A).Unwatch(B.LocalHashname())
+	_, ok := FromEndpoint(A).Status(B.LocalHashname())
+	assert.False(ok)
+	assert.Empty(FromEndpoint(A).Statuses())
+}
@@ -0,0 +1,493 @@
+// Package reload implements live-reloading of the endpoint configuration file.
+//
+// The configuration file is a JSON document:
+//
+//	{
+//	  "keys":   { ... },                         // private keys (requires a restart)
+//	  "log":    { "level": "all", "disable": ["bridge"] },
+//	  "limits": { "channels": 64, "queue": 16 }, // requires a restart
+//	  "seeds":  [ { "hashname": ..., "keys": ..., "parts": ..., "paths": ... } ],
+//	  "acl":    { "allow": ["<hashname>"], "deny": ["<hashname>"] }
+//	}
+//
+// On reload (SIGHUP or a call to Reload) the file is read again, compared to
+// the active configuration and the differences are applied incrementally.
+// Open exchanges are never restarted. Changes that can't be applied to a running
+// endpoint are reported in the returned Diff and Reload returns
+// ErrRestartRequired.
+//
+// The ACL is enforced for handshakes and channels: handshakes of peers that are
+// not allowed are dropped and their channels are killed, so peers that are
+// denied by a reload lose their exchange once it needs a new handshake.
+package reload
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/e3x/cipherset"
+	"github.com/telehash/gogotelehash/internal/hashname"
+	"github.com/telehash/gogotelehash/internal/util/logs"
+)
+
+var (
+	// ErrRestartRequired is returned by Reload when the changes were only
+	// partially applied; the endpoint must be restarted to apply the rest.
+	ErrRestartRequired = errors.New("reload: restart required")
+
+	// ErrDenied is returned (to the OnHandshake hooks) for handshakes of peers
+	// that are not allowed by the ACL.
+	ErrDenied = errors.New("reload: peer is denied by the acl")
+)
+
+type Config struct {
+	// Path of the configuration file.
+	Path string
+
+	// Signals that trigger a reload. Defaults to SIGHUP.
+	Signals []os.Signal
+
+	// OnReload is called after each reload.
+	OnReload func(diff *Diff, err error)
+}
+
+const (
+	// LevelAll logs the output of all modules that are not disabled.
+	LevelAll = "all"
+
+	// LevelOff suppresses all log output.
+	LevelOff = "off"
+)
+
+// File is the content of the configuration file.
+type File struct {
+	Keys   json.RawMessage `json:"keys,omitempty"`
+	Log    LogConfig       `json:"log"`
+	Limits LimitsConfig    `json:"limits"`
+	Seeds  []*e3x.Identity `json:"seeds,omitempty"`
+	ACL    ACLConfig       `json:"acl"`
+}
+
+type LogConfig struct {
+	// Level is LevelAll (the default) or LevelOff.
+	Level   string   `json:"level,omitempty"`
+	Disable []string `json:"disable,omitempty"`
+}
+
+// LimitsConfig sets the channel limit of the endpoint (see e3x.ChannelLimit).
+// Zero means unlimited. Channels beyond the limit are queued when Queue is set
+// and rejected otherwise.
+type LimitsConfig struct {
+	Channels int `json:"channels,omitempty"`
+	Queue    int `json:"queue,omitempty"`
+}
+
+// ACLConfig lists the peers that are allowed or denied. When Allow is
+// empty all peers that are not denied are allowed.
+type ACLConfig struct {
+	Allow []hashname.H `json:"allow,omitempty"`
+	Deny  []hashname.H `json:"deny,omitempty"`
+}
+
+// Diff describes the changes that were found during a reload.
+type Diff struct {
+	Changes []Change
+}
+
+type Change struct {
+	Field           string
+	Description     string
+	RestartRequired bool
+}
+
+// RestartRequired returns true when at least one change could not be applied.
+func (d *Diff) RestartRequired() bool {
+	for _, c := range d.Changes {
+		if c.RestartRequired {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Diff) add(field, description string, restart bool) {
+	d.Changes = append(d.Changes, Change{field, description, restart})
+}
+
+type Reloader interface {
+	// Reload the configuration file and apply the changes.
+	Reload() (*Diff, error)
+
+	// Config returns the active configuration.
+	Config() *File
+
+	// Allowed returns true when peer passes the active ACL. It can also be used
+	// as the AllowPeer/AllowConnect policy of the bridge.
+	Allowed(peer hashname.H) bool
+}
+
+type moduleKeyType string
+
+const moduleKey = moduleKeyType("reload")
+
+type module struct {
+	e      *e3x.Endpoint
+	config Config
+	log    *logs.Logger
+
+	mtx     sync.RWMutex
+	current *File
+	signals chan os.Signal
+	done    chan struct{}
+}
+
+func Module(config Config) e3x.EndpointOption {
+	return func(e *e3x.Endpoint) error {
+		return e3x.RegisterModule(moduleKey, newModule(e, config))(e)
+	}
+}
+
+func FromEndpoint(e *e3x.Endpoint) Reloader {
+	mod := e.Module(moduleKey)
+	if mod == nil {
+		return nil
+	}
+	return mod.(*module)
+}
+
+func newModule(e *e3x.Endpoint, config Config) *module {
+	if len(config.Signals) == 0 {
+		config.Signals = []os.Signal{syscall.SIGHUP}
+	}
+
+	return &module{e: e, config: config, current: &File{}}
+}
+
+func (mod *module) Init() error {
+	mod.log = logs.Module("reload").From(mod.e.LocalHashname())
+
+	f, err := ReadFile(mod.config.Path)
+	if err != nil {
+		return err
+	}
+
+	mod.apply(f, true)
+
+	if l := f.Limits; l.Channels > 0 {
+		overflow := e3x.RejectChannels
+		if l.Queue > 0 {
+			overflow = e3x.QueueChannels
+		}
+		err = e3x.LimitChannels(e3x.ChannelLimit{Max: l.Channels, Overflow: overflow, QueueSize: l.Queue})(mod.e)
+		if err != nil {
+			return err
+		}
+	}
+
+	mod.e.DefaultExchangeHooks().Register(e3x.ExchangeHook{OnHandshake: mod.onHandshake})
+	mod.e.DefaultChannelHooks().Register(e3x.ChannelHook{OnOpened: mod.onChannelOpened})
+	return nil
+}
+
+func (mod *module) Start() error {
+	mod.signals = make(chan os.Signal, 1)
+	mod.done = make(chan struct{})
+	signal.Notify(mod.signals, mod.config.Signals...)
+
+	go mod.run()
+
+	mod.dialSeeds(mod.Config().Seeds)
+	return nil
+}
+
+func (mod *module) Stop() error {
+	signal.Stop(mod.signals)
+	close(mod.done)
+	return nil
+}
+
+func (mod *module) run() {
+	for {
+		select {
+		case <-mod.done:
+			return
+		case <-mod.signals:
+			mod.Reload()
+		}
+	}
+}
+
+// ReadFile reads and parses a configuration file.
+func ReadFile(path string) (*File, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{}
+	err = json.Unmarshal(data, f)
+	if err != nil {
+		return nil, err
+	}
+
+	switch f.Log.Level {
+	case "", LevelAll, LevelOff:
+	default:
+		return nil, fmt.Errorf("reload: invalid log level %q", f.Log.Level)
+	}
+
+	return f, nil
+}
+
+func (mod *module) Config() *File {
+	mod.mtx.RLock()
+	f := mod.current
+	mod.mtx.RUnlock()
+	return f
+}
+
+func (mod *module) Allowed(peer hashname.H) bool {
+	mod.mtx.RLock()
+	acl := mod.current.ACL
+	mod.mtx.RUnlock()
+
+	for _, hn := range acl.Deny {
+		if hn == peer {
+			return false
+		}
+	}
+
+	if len(acl.Allow) == 0 {
+		return true
+	}
+
+	for _, hn := range acl.Allow {
+		if hn == peer {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (mod *module) Reload() (*Diff, error) {
+	f, err := ReadFile(mod.config.Path)
+	if err != nil {
+		mod.log.Printf("\x1B[31mReload failed\x1B[0m %s", err)
+		if mod.config.OnReload != nil {
+			mod.config.OnReload(nil, err)
+		}
+		return nil, err
+	}
+
+	diff, added := mod.apply(f, false)
+	mod.dialSeeds(added)
+
+	if diff.RestartRequired() {
+		err = ErrRestartRequired
+	}
+
+	for _, c := range diff.Changes {
+		if c.RestartRequired {
+			mod.log.Printf("\x1B[33mReloaded\x1B[0m %s: %s (restart required)", c.Field, c.Description)
+		} else {
+			mod.log.Printf("\x1B[32mReloaded\x1B[0m %s: %s", c.Field, c.Description)
+		}
+	}
+
+	if mod.config.OnReload != nil {
+		mod.config.OnReload(diff, err)
+	}
+
+	return diff, err
+}
+
+func (mod *module) onHandshake(e *e3x.Endpoint, x *e3x.Exchange, handshake cipherset.Handshake) error {
+	peer, err := hashname.FromKeyAndIntermediates(handshake.CSID(),
+		handshake.PublicKey().Public(), handshake.Parts())
+	if err != nil {
+		return err
+	}
+
+	if !mod.Allowed(peer) {
+		mod.log.To(peer).Printf("\x1B[31mRejected handshake\x1B[0m denied by the acl")
+		return ErrDenied
+	}
+	return nil
+}
+
+func (mod *module) onChannelOpened(e *e3x.Endpoint, x *e3x.Exchange, c *e3x.Channel) error {
+	if !mod.Allowed(x.RemoteHashname()) {
+		c.Kill()
+		return ErrDenied
+	}
+	return nil
+}
+
+// apply replaces the active configuration with f and returns the differences
+// and the seeds that were added.
+func (mod *module) apply(f *File, initial bool) (*Diff, []*e3x.Identity) {
+	mod.mtx.Lock()
+	defer mod.mtx.Unlock()
+
+	var (
+		old  = mod.current
+		diff = &Diff{}
+	)
+
+	if !initial && !bytes.Equal(old.Keys, f.Keys) {
+		diff.add("keys", "keys changed", true)
+	}
+
+	if !initial && old.Limits != f.Limits {
+		diff.add("limits", "limits changed", true)
+	}
+
+	if level := f.Log.Level; initial || level != old.Log.Level {
+		logs.SetMuted(level == LevelOff)
+		if !initial {
+			diff.add("log", "level "+levelName(level), false)
+		}
+	}
+
+	disable, enable := diffStrings(old.Log.Disable, f.Log.Disable)
+	for _, name := range disable {
+		logs.DisableModule(name)
+		diff.add("log", "disabled "+name, false)
+	}
+	for _, name := range enable {
+		logs.EnableModule(name)
+		diff.add("log", "enabled "+name, false)
+	}
+
+	added, removed := diffSeeds(old.Seeds, f.Seeds)
+	for _, seed := range added {
+		diff.add("seeds", "added "+string(seed.Hashname()), false)
+	}
+	for _, seed := range removed {
+		// open exchanges are kept
+		diff.add("seeds", "removed "+string(seed.Hashname()), false)
+	}
+
+	a, b := diffHashnames(old.ACL.Allow, f.ACL.Allow)
+	for _, hn := range a {
+		diff.add("acl", "allowed "+string(hn), false)
+	}
+	for _, hn := range b {
+		diff.add("acl", "no longer allowed "+string(hn), false)
+	}
+	a, b = diffHashnames(old.ACL.Deny, f.ACL.Deny)
+	for _, hn := range a {
+		diff.add("acl", "denied "+string(hn), false)
+	}
+	for _, hn := range b {
+		diff.add("acl", "no longer denied "+string(hn), false)
+	}
+
+	mod.current = f
+	return diff, added
+}
+
+func levelName(level string) string {
+	if level == "" {
+		return LevelAll
+	}
+	return level
+}
+
+func (mod *module) dialSeeds(seeds []*e3x.Identity) {
+	for _, seed := range seeds {
+		go func(seed *e3x.Identity) {
+			_, err := mod.e.Dial(seed)
+			if err != nil {
+				mod.log.To(seed.Hashname()).Printf("\x1B[31mFailed to dial seed\x1B[0m %s", err)
+			}
+		}(seed)
+	}
+}
+
+// diffStrings returns the strings that are only in b (added) and
+// the strings that are only in a (removed).
+func diffStrings(a, b []string) (added, removed []string) {
+	var (
+		inA = make(map[string]bool, len(a))
+		inB = make(map[string]bool, len(b))
+	)
+
+	for _, s := range a {
+		inA[s] = true
+	}
+	for _, s := range b {
+		inB[s] = true
+	}
+
+	for s := range inB {
+		if !inA[s] {
+			added = append(added, s)
+		}
+	}
+	for s := range inA {
+		if !inB[s] {
+			removed = append(removed, s)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+func diffHashnames(a, b []hashname.H) (added, removed []hashname.H) {
+	var sa, sb []string
+	for _, hn := range a {
+		sa = append(sa, string(hn))
+	}
+	for _, hn := range b {
+		sb = append(sb, string(hn))
+	}
+
+	x, y := diffStrings(sa, sb)
+	for _, s := range x {
+		added = append(added, hashname.H(s))
+	}
+	for _, s := range y {
+		removed = append(removed, hashname.H(s))
+	}
+	return added, removed
+}
+
+func diffSeeds(a, b []*e3x.Identity) (added, removed []*e3x.Identity) {
+	var (
+		inA = make(map[hashname.H]bool, len(a))
+		inB = make(map[hashname.H]bool, len(b))
+	)
+
+	for _, i := range a {
+		inA[i.Hashname()] = true
+	}
+	for _, i := range b {
+		inB[i.Hashname()] = true
+	}
+
+	for _, i := range b {
+		if !inA[i.Hashname()] {
+			added = append(added, i)
+		}
+	}
+	for _, i := range a {
+		if !inB[i.Hashname()] {
+			removed = append(removed, i)
+		}
+	}
+
+	return added, removed
+}
@@ -0,0 +1,133 @@
+package reload
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/internal/lob"
+	"github.com/telehash/gogotelehash/internal/util/logs"
+	"github.com/telehash/gogotelehash/transports/inproc"
+)
+
+func TestReloadDiff(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.json")
+	err = ioutil.WriteFile(path, []byte(`{
+		"keys": {"3a": "a"},
+		"acl": {"deny": ["aaaa"]}
+	}`), 0600)
+	assert.NoError(err)
+
+	mod := newModule(nil, Config{Path: path})
+	f, err := ReadFile(path)
+	assert.NoError(err)
+	mod.apply(f, true)
+
+	assert.False(mod.Allowed("aaaa"))
+	assert.True(mod.Allowed("bbbb"))
+
+	err = ioutil.WriteFile(path, []byte(`{
+		"keys": {"3a": "b"},
+		"log": {"level": "off", "disable": ["test-reload"]},
+		"limits": {"channels": 8},
+		"acl": {"allow": ["bbbb"]}
+	}`), 0600)
+	assert.NoError(err)
+	defer logs.SetMuted(false)
+	defer logs.EnableModule("test-reload")
+
+	diff, err := mod.Reload()
+	assert.Equal(ErrRestartRequired, err)
+	if assert.NotNil(diff) {
+		assert.True(diff.RestartRequired())
+		assert.Equal([]Change{
+			{"keys", "keys changed", true},
+			{"limits", "limits changed", true},
+			{"log", "level off", false},
+			{"log", "disabled test-reload", false},
+			{"acl", "allowed bbbb", false},
+			{"acl", "no longer denied aaaa", false},
+		}, diff.Changes)
+	}
+
+	assert.False(mod.Allowed("aaaa"))
+	assert.True(mod.Allowed("bbbb"))
+}
+
+func TestReloadACL(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "reload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.json")
+	assert.NoError(ioutil.WriteFile(path, []byte(`{}`), 0600))
+
+	A, err := e3x.Open(e3x.Transport(inproc.Config{}), Module(Config{Path: path}))
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := e3x.Open(e3x.Transport(inproc.Config{}))
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	served := make(chan error, 2)
+	assert.NoError(A.AddHandler("ping", e3x.HandlerFunc(func(c *e3x.Channel) {
+		defer c.Kill()
+		pkt, err := c.ReadPacket()
+		if err == nil {
+			pkt.Free()
+		}
+		served <- err
+	})))
+
+	ident, err := A.LocalIdentity()
+	if !assert.NoError(err) {
+		return
+	}
+
+	ping := func() error {
+		c, err := B.Open(ident, "ping", false)
+		if err != nil {
+			return err
+		}
+		defer c.Kill()
+		c.WritePacket(lob.New(nil))
+
+		select {
+		case err := <-served:
+			return err
+		case <-time.After(time.Second):
+			return e3x.ErrTimeout
+		}
+	}
+
+	assert.NoError(ping())
+
+	assert.NoError(ioutil.WriteFile(path, []byte(`{"acl": {"deny": ["`+string(B.LocalHashname())+`"]}}`), 0600))
+	_, err = FromEndpoint(A).Reload()
+	assert.NoError(err)
+
+	// the open exchange of B can't open channels anymore
+	assert.Error(ping())
+}
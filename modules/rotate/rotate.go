@@ -0,0 +1,372 @@
+// Package rotate implements key rotation with peer notification.
+//
+// A rotation replaces the identity of a node with a new one without losing
+// its links. The new identity runs on its own endpoint next to the old one
+// (use an e3x.TransportGroup to keep the same addresses):
+//
+//	keys, _ := rotate.NextKeys(oldKeys, 0x3a)
+//	next, _ := e3x.Open(e3x.Keys(keys), group.Transport(), rotate.Module(rotate.Config{}))
+//	rotation, _ := rotate.FromEndpoint(old).Rotate(next)
+//
+// Rotate announces the new identity to all peers that have an open exchange
+// with the old endpoint over a "rotate" channel. The new endpoint then dials
+// the same peers and confirms the rotation over its own exchange. Peers running
+// the module only accept a successor that was announced over the authenticated
+// exchange of the old identity and confirmed over the authenticated exchange of
+// the new one, so a peer can't redirect them to identities it doesn't own.
+// After the grace period the old endpoint is closed.
+package rotate
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/e3x/cipherset"
+	"github.com/telehash/gogotelehash/internal/hashname"
+	"github.com/telehash/gogotelehash/internal/lob"
+	"github.com/telehash/gogotelehash/internal/util/logs"
+)
+
+const (
+	channelType = "rotate"
+
+	// DefaultGracePeriod is the time the old identity stays reachable after a
+	// rotation.
+	DefaultGracePeriod = 1 * time.Hour
+
+	announceTimeout = 30 * time.Second
+)
+
+var (
+	ErrRotating     = errors.New("rotate: rotation already in progress")
+	ErrSameIdentity = errors.New("rotate: next endpoint has the same hashname")
+	ErrNotRotating  = errors.New("rotate: no rotation in progress")
+)
+
+type Config struct {
+	// GracePeriod is the time the old endpoint stays open after the new
+	// identity was announced. Defaults to DefaultGracePeriod.
+	GracePeriod time.Duration
+
+	// OnPeerRotated is called when a peer announced its successor and the
+	// successor confirmed the rotation.
+	OnPeerRotated func(peer hashname.H, next *e3x.Identity)
+
+	// OnRetired is called after the old endpoint was closed.
+	OnRetired func(err error)
+}
+
+// Rotation describes a started rotation.
+type Rotation struct {
+	// Next is the identity that was announced.
+	Next *e3x.Identity
+
+	// Notified are the peers that acknowledged the announcement and the
+	// confirmation of the next endpoint.
+	Notified []hashname.H
+
+	// Failed are the peers that could not be notified.
+	Failed []hashname.H
+
+	// RetireAt is the time the old endpoint will be closed.
+	RetireAt time.Time
+}
+
+type Rotator interface {
+	// Rotate announces the identity of next to all linked peers and closes the
+	// endpoint after the grace period.
+	Rotate(next *e3x.Endpoint) (*Rotation, error)
+
+	// Retire closes the endpoint of a started rotation without waiting for
+	// the grace period.
+	Retire() error
+
+	// Successor returns the identity announced by peer or nil.
+	Successor(peer hashname.H) *e3x.Identity
+}
+
+type moduleKeyType string
+
+const moduleKey = moduleKeyType("rotate")
+
+type module struct {
+	e      *e3x.Endpoint
+	config Config
+	log    *logs.Logger
+
+	mtx        sync.Mutex
+	rotating   bool
+	timer      *time.Timer
+	successors map[hashname.H]*e3x.Identity
+	announced  map[hashname.H]*e3x.Identity // awaiting confirmation by the successor
+}
+
+func Module(config Config) e3x.EndpointOption {
+	return func(e *e3x.Endpoint) error {
+		return e3x.RegisterModule(moduleKey, newModule(e, config))(e)
+	}
+}
+
+func FromEndpoint(e *e3x.Endpoint) Rotator {
+	mod := e.Module(moduleKey)
+	if mod == nil {
+		return nil
+	}
+	return mod.(*module)
+}
+
+func newModule(e *e3x.Endpoint, config Config) *module {
+	if config.GracePeriod <= 0 {
+		config.GracePeriod = DefaultGracePeriod
+	}
+
+	return &module{
+		e:          e,
+		config:     config,
+		successors: make(map[hashname.H]*e3x.Identity),
+		announced:  make(map[hashname.H]*e3x.Identity),
+	}
+}
+
+// NextKeys returns a copy of keys where the keys for csids are replaced by
+// newly generated keys. CSIDs that are not in keys yet are added.
+func NextKeys(keys cipherset.Keys, csids ...uint8) (cipherset.Keys, error) {
+	fresh, err := cipherset.GenerateKeys(csids...)
+	if err != nil {
+		return nil, err
+	}
+
+	next := make(cipherset.Keys, len(keys)+len(fresh))
+	for csid, key := range keys {
+		next[csid] = key
+	}
+	for csid, key := range fresh {
+		next[csid] = key
+	}
+
+	return next, nil
+}
+
+func (mod *module) Init() error {
+	mod.log = logs.Module("rotate").From(mod.e.LocalHashname())
+	return nil
+}
+
+func (mod *module) Start() error {
+	return mod.e.AddHandler(channelType, e3x.HandlerFunc(mod.handleAnnouncement))
+}
+
+func (mod *module) Stop() error {
+	mod.e.RemoveHandler(channelType)
+
+	mod.mtx.Lock()
+	if mod.timer != nil {
+		mod.timer.Stop()
+	}
+	mod.mtx.Unlock()
+
+	return nil
+}
+
+func (mod *module) Rotate(next *e3x.Endpoint) (*Rotation, error) {
+	if next.LocalHashname() == mod.e.LocalHashname() {
+		return nil, ErrSameIdentity
+	}
+
+	ident, err := next.LocalIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(ident)
+	if err != nil {
+		return nil, err
+	}
+
+	mod.mtx.Lock()
+	if mod.rotating {
+		mod.mtx.Unlock()
+		return nil, ErrRotating
+	}
+	mod.rotating = true
+	mod.mtx.Unlock()
+
+	type result struct {
+		peer hashname.H
+		err  error
+	}
+
+	var (
+		exchanges = mod.e.GetExchanges()
+		results   = make(chan result, len(exchanges))
+		rotation  = &Rotation{Next: ident}
+	)
+
+	for _, x := range exchanges {
+		go func(x *e3x.Exchange) {
+			results <- result{x.RemoteHashname(), mod.notify(x, next, data)}
+		}(x)
+	}
+
+	for range exchanges {
+		r := <-results
+		if r.err != nil {
+			mod.log.To(r.peer).Printf("\x1B[31mFailed to announce rotation\x1B[0m %s", r.err)
+			rotation.Failed = append(rotation.Failed, r.peer)
+		} else {
+			rotation.Notified = append(rotation.Notified, r.peer)
+		}
+	}
+
+	mod.log.Printf("\x1B[32mRotating\x1B[0m to %s (notified=%d failed=%d)",
+		ident.Hashname(), len(rotation.Notified), len(rotation.Failed))
+
+	rotation.RetireAt = time.Now().Add(mod.config.GracePeriod)
+
+	mod.mtx.Lock()
+	mod.timer = time.AfterFunc(mod.config.GracePeriod, func() { mod.Retire() })
+	mod.mtx.Unlock()
+
+	return rotation, nil
+}
+
+func (mod *module) Retire() error {
+	mod.mtx.Lock()
+	if !mod.rotating {
+		mod.mtx.Unlock()
+		return ErrNotRotating
+	}
+	if mod.timer != nil {
+		mod.timer.Stop()
+		mod.timer = nil
+	}
+	mod.mtx.Unlock()
+
+	err := mod.e.Close()
+	if mod.config.OnRetired != nil {
+		mod.config.OnRetired(err)
+	}
+	return err
+}
+
+func (mod *module) Successor(peer hashname.H) *e3x.Identity {
+	mod.mtx.Lock()
+	ident := mod.successors[peer]
+	mod.mtx.Unlock()
+	return ident
+}
+
+// notify announces the identity of next to the peer of x and has next confirm
+// it over its own exchange with the peer.
+func (mod *module) notify(x *e3x.Exchange, next *e3x.Endpoint, data []byte) error {
+	err := announce(x, lob.New(data))
+	if err != nil {
+		return err
+	}
+
+	nx, err := next.Dial(x.RemoteIdentity())
+	if err != nil {
+		return err
+	}
+
+	confirm := lob.New(nil)
+	confirm.Header().SetString("previous", string(mod.e.LocalHashname()))
+	return announce(nx, confirm)
+}
+
+// announce sends pkt to the peer of x and waits for the acknowledgement.
+func announce(x *e3x.Exchange, pkt *lob.Packet) error {
+	c, err := x.Open(channelType, true)
+	if err != nil {
+		return err
+	}
+	defer c.Kill()
+
+	c.SetDeadline(time.Now().Add(announceTimeout))
+
+	err = c.WritePacket(pkt)
+	if err != nil {
+		return err
+	}
+
+	ack, err := c.ReadPacket()
+	if err != nil {
+		return err
+	}
+	if reason, failed := ack.Header().GetString("err"); failed {
+		return errors.New("rotate: " + reason)
+	}
+
+	return c.Close()
+}
+
+func (mod *module) handleAnnouncement(c *e3x.Channel) {
+	defer c.Kill()
+
+	c.SetDeadline(time.Now().Add(announceTimeout))
+
+	pkt, err := c.ReadPacket()
+	if err != nil {
+		return // ignore
+	}
+
+	peer := c.RemoteHashname()
+
+	if previous, ok := pkt.Header().GetString("previous"); ok {
+		mod.handleConfirmation(c, hashname.H(previous))
+		return
+	}
+
+	ident := new(e3x.Identity)
+	err = json.Unmarshal(pkt.Body(nil), ident)
+	if err != nil || ident.Hashname() == peer {
+		return // ignore
+	}
+
+	// peer is authenticated by its exchange; its successor still has to
+	// confirm the rotation over its own exchange.
+	mod.mtx.Lock()
+	mod.announced[peer] = ident
+	mod.mtx.Unlock()
+
+	err = c.WritePacket(lob.New(nil))
+	if err != nil {
+		return // ignore
+	}
+	c.Close()
+}
+
+// handleConfirmation accepts the peer of c as the successor of previous when
+// previous announced it.
+func (mod *module) handleConfirmation(c *e3x.Channel, previous hashname.H) {
+	peer := c.RemoteHashname()
+
+	mod.mtx.Lock()
+	ident := mod.announced[previous]
+	if ident == nil || ident.Hashname() != peer {
+		mod.mtx.Unlock()
+		mod.log.To(peer).Printf("\x1B[31mDropped unannounced rotation\x1B[0m from %s", previous)
+		reject := lob.New(nil)
+		reject.Header().SetString("err", "rotation was not announced")
+		c.WritePacket(reject)
+		return
+	}
+	delete(mod.announced, previous)
+	mod.successors[previous] = ident
+	mod.mtx.Unlock()
+
+	err := c.WritePacket(lob.New(nil))
+	if err != nil {
+		return // ignore
+	}
+	c.Close()
+
+	mod.log.To(previous).Printf("\x1B[32mPeer rotated\x1B[0m to %s", peer)
+
+	if mod.config.OnPeerRotated != nil {
+		mod.config.OnPeerRotated(previous, ident)
+	}
+}
@@ -0,0 +1,170 @@
+package rotate
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/e3x/cipherset"
+	"github.com/telehash/gogotelehash/internal/hashname"
+	"github.com/telehash/gogotelehash/internal/lob"
+	"github.com/telehash/gogotelehash/transports/udp"
+)
+
+func TestRotate(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		rotated = make(chan hashname.H, 1)
+		retired = make(chan error, 1)
+	)
+
+	keys, err := cipherset.GenerateKeys(0x3a)
+	assert.NoError(err)
+
+	A, err := e3x.Open(
+		e3x.Log(nil),
+		e3x.Keys(keys),
+		e3x.Transport(udp.Config{}),
+		Module(Config{
+			GracePeriod: 200 * time.Millisecond,
+			OnRetired:   func(err error) { retired <- err },
+		}))
+	assert.NoError(err)
+
+	B, err := e3x.Open(
+		e3x.Log(nil),
+		e3x.Transport(udp.Config{}),
+		Module(Config{
+			OnPeerRotated: func(peer hashname.H, next *e3x.Identity) { rotated <- peer },
+		}))
+	assert.NoError(err)
+	defer B.Close()
+
+	nextKeys, err := NextKeys(keys, 0x3a)
+	assert.NoError(err)
+	assert.NotEqual(keys[0x3a].String(), nextKeys[0x3a].String())
+
+	A2, err := e3x.Open(
+		e3x.Log(nil),
+		e3x.Keys(nextKeys),
+		e3x.Transport(udp.Config{}),
+		Module(Config{}))
+	assert.NoError(err)
+	defer A2.Close()
+
+	Aident, err := A.LocalIdentity()
+	assert.NoError(err)
+	_, err = B.Dial(Aident)
+	assert.NoError(err)
+
+	_, err = FromEndpoint(A).Rotate(A)
+	assert.Equal(ErrSameIdentity, err)
+
+	rotation, err := FromEndpoint(A).Rotate(A2)
+	if assert.NoError(err) {
+		assert.Equal(A2.LocalHashname(), rotation.Next.Hashname())
+		assert.Equal([]hashname.H{B.LocalHashname()}, rotation.Notified)
+		assert.Empty(rotation.Failed)
+	}
+
+	_, err = FromEndpoint(A).Rotate(A2)
+	assert.Equal(ErrRotating, err)
+
+	select {
+	case peer := <-rotated:
+		assert.Equal(A.LocalHashname(), peer)
+	case <-time.After(5 * time.Second):
+		t.Fatal("rotation was not announced")
+	}
+
+	if ident := FromEndpoint(B).Successor(A.LocalHashname()); assert.NotNil(ident) {
+		assert.Equal(A2.LocalHashname(), ident.Hashname())
+	}
+
+	select {
+	case err := <-retired:
+		assert.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("old identity was not retired")
+	}
+
+	// the successor linked with B to confirm the rotation
+	assert.NotNil(B.GetExchange(A2.LocalHashname()))
+}
+
+func TestRotateUnconfirmed(t *testing.T) {
+	assert := assert.New(t)
+
+	var rotated = make(chan hashname.H, 1)
+
+	A, err := e3x.Open(
+		e3x.Log(nil),
+		e3x.Transport(udp.Config{}),
+		Module(Config{}))
+	assert.NoError(err)
+	defer A.Close()
+
+	B, err := e3x.Open(
+		e3x.Log(nil),
+		e3x.Transport(udp.Config{}),
+		Module(Config{
+			OnPeerRotated: func(peer hashname.H, next *e3x.Identity) { rotated <- peer },
+		}))
+	assert.NoError(err)
+	defer B.Close()
+
+	C, err := e3x.Open(
+		e3x.Log(nil),
+		e3x.Transport(udp.Config{}),
+		Module(Config{}))
+	assert.NoError(err)
+	defer C.Close()
+
+	Bident, err := B.LocalIdentity()
+	assert.NoError(err)
+	Cident, err := C.LocalIdentity()
+	assert.NoError(err)
+
+	// A announces an identity it doesn't own
+	x, err := A.Dial(Bident)
+	assert.NoError(err)
+	data, err := json.Marshal(Cident)
+	assert.NoError(err)
+	assert.NoError(announce(x, lob.New(data)))
+
+	// C never confirms; B doesn't dial C
+	assert.Nil(FromEndpoint(B).Successor(A.LocalHashname()))
+	assert.Nil(B.GetExchange(C.LocalHashname()))
+
+	// C claims to replace B, which announced nothing
+	cx, err := C.Dial(Bident)
+	assert.NoError(err)
+	confirm := lob.New(nil)
+	confirm.Header().SetString("previous", string(B.LocalHashname()))
+	assert.Error(announce(cx, confirm))
+
+	select {
+	case peer := <-rotated:
+		t.Fatalf("accepted unconfirmed rotation of %s", peer)
+	default:
+	}
+	assert.Nil(FromEndpoint(B).Successor(B.LocalHashname()))
+}
+
+func TestNextKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	keys, err := cipherset.GenerateKeys(0x3a)
+	assert.NoError(err)
+
+	next, err := NextKeys(keys, 0x1a)
+	assert.NoError(err)
+	assert.Len(next, 2)
+	assert.Equal(keys[0x3a], next[0x3a])
+	assert.NotNil(next[0x1a])
+	assert.Len(keys, 1)
+}
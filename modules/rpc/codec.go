@@ -0,0 +1,849 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Codec encodes the arguments, results and errors of calls.
+type Codec interface {
+	// Name identifies the codec on the wire.
+	Name() string
+
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSON encodes values with encoding/json.
+	JSON Codec = jsonCodec{}
+
+	// MsgPack encodes values as MessagePack. Structs are encoded as maps
+	// following the struct tags of encoding/json and []byte values travel as
+	// bin. Values that implement json.Marshaler or json.Unmarshaler are
+	// converted with those methods. Decoding into an interface{} yields
+	// int64, uint64, float64, string, []byte, bool, []interface{} and
+	// map[string]interface{} values.
+	MsgPack Codec = msgpackCodec{}
+)
+
+// maxMsgPackDepth limits the nesting of msgpack arrays and maps so a small
+// message can't exhaust the stack.
+const maxMsgPackDepth = 64
+
+var (
+	errInvalidMsgPack = errors.New("rpc: invalid msgpack data")
+	errMsgPackDepth   = errors.New("rpc: msgpack value is nested too deeply")
+)
+
+var (
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	jsonNumberType      = reflect.TypeOf(json.Number(""))
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                               { return "json" }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := encodeMsgPack(&buf, reflect.ValueOf(v), 0)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("rpc: msgpack can't decode into %T", v)
+	}
+
+	tree, rest, err := decodeMsgPack(data, 0)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errInvalidMsgPack
+	}
+
+	return assignMsgPack(rv.Elem(), tree)
+}
+
+// encodeMsgPack encodes v. depth is the number of enclosing values.
+func encodeMsgPack(buf *bytes.Buffer, v reflect.Value, depth int) error {
+	if depth > maxMsgPackDepth {
+		return errMsgPackDepth
+	}
+
+	if !v.IsValid() {
+		buf.WriteByte(0xc0)
+		return nil
+	}
+
+	if v.Type() == jsonNumberType {
+		return encodeMsgPackNumber(buf, json.Number(v.String()))
+	}
+
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		buf.WriteByte(0xc0)
+		return nil
+	}
+
+	if v.Type().Implements(jsonMarshalerType) {
+		return encodeMsgPackJSON(buf, v.Interface().(json.Marshaler), depth)
+	}
+	if v.Kind() != reflect.Ptr && v.CanAddr() && v.Addr().Type().Implements(jsonMarshalerType) {
+		return encodeMsgPackJSON(buf, v.Addr().Interface().(json.Marshaler), depth)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		encodeMsgPackInt(buf, v.Int())
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		encodeMsgPackUint(buf, v.Uint())
+
+	case reflect.Float32:
+		buf.WriteByte(0xca)
+		binary.Write(buf, binary.BigEndian, math.Float32bits(float32(v.Float())))
+
+	case reflect.Float64:
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v.Float()))
+
+	case reflect.String:
+		encodeMsgPackString(buf, v.String())
+
+	case reflect.Ptr, reflect.Interface:
+		return encodeMsgPack(buf, v.Elem(), depth+1)
+
+	case reflect.Slice:
+		if v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			encodeMsgPackBin(buf, v.Bytes())
+			return nil
+		}
+		fallthrough
+
+	case reflect.Array:
+		encodeMsgPackLen(buf, v.Len(), 0x90, 0xdc)
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeMsgPack(buf, v.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteByte(0xc0)
+			return nil
+		}
+		encodeMsgPackLen(buf, v.Len(), 0x80, 0xde)
+		for _, k := range v.MapKeys() {
+			name, err := msgpackMapKey(k)
+			if err != nil {
+				return err
+			}
+			encodeMsgPackString(buf, name)
+			if err := encodeMsgPack(buf, v.MapIndex(k), depth+1); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Struct:
+		var (
+			fields = msgpackFields(v.Type())
+			values = make([]reflect.Value, 0, len(fields))
+			names  = make([]string, 0, len(fields))
+		)
+		for _, f := range fields {
+			fv, ok := fieldByIndex(v, f.index)
+			if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+				continue
+			}
+			values = append(values, fv)
+			names = append(names, f.name)
+		}
+
+		encodeMsgPackLen(buf, len(values), 0x80, 0xde)
+		for i, fv := range values {
+			encodeMsgPackString(buf, names[i])
+			if err := encodeMsgPack(buf, fv, depth+1); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("rpc: msgpack can't encode %s", v.Type())
+	}
+
+	return nil
+}
+
+// encodeMsgPackJSON encodes the JSON representation of m.
+func encodeMsgPackJSON(buf *bytes.Buffer, m json.Marshaler, depth int) error {
+	data, err := m.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var tree interface{}
+	err = dec.Decode(&tree)
+	if err != nil {
+		return err
+	}
+
+	return encodeMsgPack(buf, reflect.ValueOf(tree), depth)
+}
+
+func encodeMsgPackNumber(buf *bytes.Buffer, n json.Number) error {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		encodeMsgPackInt(buf, i)
+	} else if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		encodeMsgPackUint(buf, u)
+	} else if f, err := strconv.ParseFloat(string(n), 64); err == nil {
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+	} else {
+		return err
+	}
+	return nil
+}
+
+func encodeMsgPackInt(buf *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i <= 0x7f:
+		buf.WriteByte(byte(i))
+	case i < 0 && i >= -32:
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		buf.WriteByte(0xd0)
+		buf.WriteByte(byte(int8(i)))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(i))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, i)
+	}
+}
+
+func encodeMsgPackUint(buf *bytes.Buffer, u uint64) {
+	if u <= math.MaxInt64 {
+		encodeMsgPackInt(buf, int64(u))
+		return
+	}
+	buf.WriteByte(0xcf)
+	binary.Write(buf, binary.BigEndian, u)
+}
+
+func encodeMsgPackString(buf *bytes.Buffer, s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xd9)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xda)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(0xdb)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+	buf.WriteString(s)
+}
+
+func encodeMsgPackBin(buf *bytes.Buffer, b []byte) {
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		buf.WriteByte(0xc4)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(0xc5)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(0xc6)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+	buf.Write(b)
+}
+
+// encodeMsgPackLen writes the header of an array or map. fix is the fixarray
+// or fixmap prefix and wide the array16 or map16 prefix (wide+1 is the 32-bit
+// variant).
+func encodeMsgPackLen(buf *bytes.Buffer, n int, fix, wide byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(wide)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(wide + 1)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+// msgpackMapKey returns the name of a map key like encoding/json does.
+func msgpackMapKey(k reflect.Value) (string, error) {
+	switch k.Kind() {
+	case reflect.String:
+		return k.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("rpc: msgpack can't encode map key %s", k.Type())
+}
+
+// msgpackField is an encoded struct field.
+type msgpackField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var (
+	msgpackFieldsMtx   sync.RWMutex
+	msgpackFieldsCache = make(map[reflect.Type][]msgpackField)
+)
+
+// msgpackFields returns the fields of t that encoding/json would encode.
+// Fields of embedded structs are promoted; when names collide the shallowest
+// field wins.
+func msgpackFields(t reflect.Type) []msgpackField {
+	msgpackFieldsMtx.RLock()
+	fields, found := msgpackFieldsCache[t]
+	msgpackFieldsMtx.RUnlock()
+	if found {
+		return fields
+	}
+
+	var (
+		byName = make(map[string]int)
+		walk   func(t reflect.Type, index []int)
+	)
+
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			var (
+				f         = t.Field(i)
+				tag       = f.Tag.Get("json")
+				name      = tag
+				omitEmpty bool
+				idx       = append(append([]int(nil), index...), i)
+			)
+
+			if tag == "-" {
+				continue
+			}
+			if j := strings.IndexByte(tag, ','); j >= 0 {
+				name = tag[:j]
+				omitEmpty = strings.Contains(tag[j:]+",", ",omitempty,")
+			}
+
+			if f.Anonymous && name == "" {
+				ft := f.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					walk(ft, idx)
+					continue
+				}
+			}
+			if f.PkgPath != "" {
+				continue // unexported
+			}
+			if name == "" {
+				name = f.Name
+			}
+
+			if j, dup := byName[name]; dup {
+				if len(fields[j].index) > len(idx) {
+					fields[j] = msgpackField{name, idx, omitEmpty}
+				}
+				continue
+			}
+			byName[name] = len(fields)
+			fields = append(fields, msgpackField{name, idx, omitEmpty})
+		}
+	}
+	walk(t, nil)
+
+	msgpackFieldsMtx.Lock()
+	msgpackFieldsCache[t] = fields
+	msgpackFieldsMtx.Unlock()
+
+	return fields
+}
+
+// fieldByIndex returns the field of v at index. It returns false when the
+// field is in a nil embedded struct.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// decodeMsgPack decodes the first value in data into a tree of int64, uint64,
+// float64, string, []byte, bool, []interface{} and map[string]interface{}
+// values. depth is the number of enclosing arrays and maps.
+func decodeMsgPack(data []byte, depth int) (v interface{}, rest []byte, err error) {
+	if len(data) == 0 {
+		return nil, nil, errInvalidMsgPack
+	}
+
+	b, data := data[0], data[1:]
+	switch {
+	case b <= 0x7f:
+		return int64(b), data, nil
+	case b >= 0xe0:
+		return int64(int8(b)), data, nil
+	case b&0xf0 == 0x80:
+		return decodeMsgPackMap(data, int(b&0x0f), depth)
+	case b&0xf0 == 0x90:
+		return decodeMsgPackArray(data, int(b&0x0f), depth)
+	case b&0xe0 == 0xa0:
+		return decodeMsgPackString(data, int(b&0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, data, nil
+	case 0xc2:
+		return false, data, nil
+	case 0xc3:
+		return true, data, nil
+
+	case 0xc4, 0xc5, 0xc6: // bin
+		n, data, err := readMsgPackUint(data, 1<<(b-0xc4))
+		if err != nil || uint64(len(data)) < n {
+			return nil, nil, errInvalidMsgPack
+		}
+		return append([]byte(nil), data[:n]...), data[n:], nil
+
+	case 0xca:
+		u, data, err := readMsgPackUint(data, 4)
+		return float64(math.Float32frombits(uint32(u))), data, err
+	case 0xcb:
+		u, data, err := readMsgPackUint(data, 8)
+		return math.Float64frombits(u), data, err
+
+	case 0xcc, 0xcd, 0xce, 0xcf: // uint
+		return readMsgPackUint(data, 1<<(b-0xcc))
+
+	case 0xd0, 0xd1, 0xd2, 0xd3: // int
+		size := 1 << (b - 0xd0)
+		u, data, err := readMsgPackUint(data, size)
+		if err != nil {
+			return nil, nil, err
+		}
+		shift := uint(64 - 8*size)
+		return int64(u<<shift) >> shift, data, nil
+
+	case 0xd9, 0xda, 0xdb: // str
+		n, data, err := readMsgPackUint(data, 1<<(b-0xd9))
+		if err != nil {
+			return nil, nil, err
+		}
+		return decodeMsgPackString(data, int(n))
+
+	case 0xdc, 0xdd: // array
+		n, data, err := readMsgPackUint(data, 2<<(b-0xdc))
+		if err != nil {
+			return nil, nil, err
+		}
+		return decodeMsgPackArray(data, int(n), depth)
+
+	case 0xde, 0xdf: // map
+		n, data, err := readMsgPackUint(data, 2<<(b-0xde))
+		if err != nil {
+			return nil, nil, err
+		}
+		return decodeMsgPackMap(data, int(n), depth)
+	}
+
+	return nil, nil, fmt.Errorf("rpc: unsupported msgpack type 0x%02x", b)
+}
+
+func readMsgPackUint(data []byte, size int) (uint64, []byte, error) {
+	if len(data) < size {
+		return 0, nil, errInvalidMsgPack
+	}
+
+	var u uint64
+	for _, b := range data[:size] {
+		u = u<<8 | uint64(b)
+	}
+	return u, data[size:], nil
+}
+
+func decodeMsgPackString(data []byte, n int) (interface{}, []byte, error) {
+	if n < 0 || len(data) < n {
+		return nil, nil, errInvalidMsgPack
+	}
+	return string(data[:n]), data[n:], nil
+}
+
+func decodeMsgPackArray(data []byte, n int, depth int) (interface{}, []byte, error) {
+	if depth >= maxMsgPackDepth {
+		return nil, nil, errMsgPackDepth
+	}
+
+	// each element takes at least one byte
+	if n < 0 || len(data) < n {
+		return nil, nil, errInvalidMsgPack
+	}
+
+	a := make([]interface{}, n)
+	for i := range a {
+		var err error
+		a[i], data, err = decodeMsgPack(data, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return a, data, nil
+}
+
+func decodeMsgPackMap(data []byte, n int, depth int) (interface{}, []byte, error) {
+	if depth >= maxMsgPackDepth {
+		return nil, nil, errMsgPackDepth
+	}
+
+	if n < 0 || len(data) < 2*n {
+		return nil, nil, errInvalidMsgPack
+	}
+
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		var k, v interface{}
+		var err error
+
+		k, data, err = decodeMsgPack(data, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		v, data, err = decodeMsgPack(data, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if s, ok := k.(string); ok {
+			m[s] = v
+		} else {
+			m[fmt.Sprint(k)] = v
+		}
+	}
+	return m, data, nil
+}
+
+// assignMsgPack stores a tree decoded by decodeMsgPack in v. Like
+// encoding/json a nil value leaves non-nillable values untouched.
+func assignMsgPack(v reflect.Value, tree interface{}) error {
+	if v.Kind() != reflect.Ptr && v.CanAddr() && v.Addr().Type().Implements(jsonUnmarshalerType) {
+		data, err := json.Marshal(tree)
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(json.Unmarshaler).UnmarshalJSON(data)
+	}
+
+	if tree == nil {
+		switch v.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+
+	mismatch := func() error {
+		return fmt.Errorf("rpc: msgpack can't decode %T into %s", tree, v.Type())
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return assignMsgPack(v.Elem(), tree)
+
+	case reflect.Interface:
+		if v.NumMethod() > 0 {
+			return mismatch()
+		}
+		v.Set(reflect.ValueOf(tree))
+
+	case reflect.Bool:
+		b, ok := tree.(bool)
+		if !ok {
+			return mismatch()
+		}
+		v.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch n := tree.(type) {
+		case int64:
+			i = n
+		case uint64:
+			if n > math.MaxInt64 {
+				return mismatch()
+			}
+			i = int64(n)
+		case float64:
+			if n != math.Trunc(n) {
+				return mismatch()
+			}
+			i = int64(n)
+		default:
+			return mismatch()
+		}
+		if v.OverflowInt(i) {
+			return mismatch()
+		}
+		v.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		switch n := tree.(type) {
+		case int64:
+			if n < 0 {
+				return mismatch()
+			}
+			u = uint64(n)
+		case uint64:
+			u = n
+		case float64:
+			if n < 0 || n != math.Trunc(n) {
+				return mismatch()
+			}
+			u = uint64(n)
+		default:
+			return mismatch()
+		}
+		if v.OverflowUint(u) {
+			return mismatch()
+		}
+		v.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		switch n := tree.(type) {
+		case int64:
+			v.SetFloat(float64(n))
+		case uint64:
+			v.SetFloat(float64(n))
+		case float64:
+			v.SetFloat(n)
+		default:
+			return mismatch()
+		}
+
+	case reflect.String:
+		switch s := tree.(type) {
+		case string:
+			v.SetString(s)
+		case []byte:
+			v.SetString(string(s))
+		default:
+			return mismatch()
+		}
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			switch b := tree.(type) {
+			case []byte:
+				v.SetBytes(b)
+				return nil
+			case string:
+				v.SetBytes([]byte(b))
+				return nil
+			}
+		}
+
+		a, ok := tree.([]interface{})
+		if !ok {
+			return mismatch()
+		}
+		s := reflect.MakeSlice(v.Type(), len(a), len(a))
+		for i, e := range a {
+			if err := assignMsgPack(s.Index(i), e); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+
+	case reflect.Array:
+		a, ok := tree.([]interface{})
+		if !ok {
+			return mismatch()
+		}
+		for i := 0; i < v.Len(); i++ {
+			if i >= len(a) {
+				v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+				continue
+			}
+			if err := assignMsgPack(v.Index(i), a[i]); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		m, ok := tree.(map[string]interface{})
+		if !ok {
+			return mismatch()
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for name, e := range m {
+			k, err := msgpackMapKeyValue(v.Type().Key(), name)
+			if err != nil {
+				return err
+			}
+			ev := reflect.New(v.Type().Elem()).Elem()
+			if err := assignMsgPack(ev, e); err != nil {
+				return err
+			}
+			v.SetMapIndex(k, ev)
+		}
+
+	case reflect.Struct:
+		m, ok := tree.(map[string]interface{})
+		if !ok {
+			return mismatch()
+		}
+		fields := msgpackFields(v.Type())
+		for name, e := range m {
+			f := findMsgPackField(fields, name)
+			if f == nil {
+				continue
+			}
+			if err := assignMsgPack(allocFieldByIndex(v, f.index), e); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return mismatch()
+	}
+
+	return nil
+}
+
+// msgpackMapKeyValue parses a map key of type t.
+func msgpackMapKeyValue(t reflect.Type, name string) (reflect.Value, error) {
+	k := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		k.SetString(name)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(name, 10, 64)
+		if err != nil || k.OverflowInt(i) {
+			return k, fmt.Errorf("rpc: msgpack can't decode map key %q into %s", name, t)
+		}
+		k.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(name, 10, 64)
+		if err != nil || k.OverflowUint(u) {
+			return k, fmt.Errorf("rpc: msgpack can't decode map key %q into %s", name, t)
+		}
+		k.SetUint(u)
+	default:
+		return k, fmt.Errorf("rpc: msgpack can't decode map key into %s", t)
+	}
+	return k, nil
+}
+
+// findMsgPackField returns the field for name, preferring an exact match
+// over a case-insensitive one like encoding/json.
+func findMsgPackField(fields []msgpackField, name string) *msgpackField {
+	var fold *msgpackField
+	for i := range fields {
+		if fields[i].name == name {
+			return &fields[i]
+		}
+		if fold == nil && strings.EqualFold(fields[i].name, name) {
+			fold = &fields[i]
+		}
+	}
+	return fold
+}
+
+// allocFieldByIndex returns the field of v at index and allocates nil
+// embedded structs on the way.
+func allocFieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
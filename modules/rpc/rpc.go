@@ -0,0 +1,568 @@
+// Package rpc implements request/response calls over telehash channels.
+//
+// Handlers are registered by method name:
+//
+//	e3x.Open(rpc.Module(rpc.Config{}))
+//
+//	rpc.FromEndpoint(e).Register("math.add", rpc.HandlerFunc(
+//	  func(w rpc.ResponseWriter, req *rpc.Request) error {
+//	    var args [2]int
+//	    if err := req.Decode(&args); err != nil {
+//	      return err
+//	    }
+//	    return w.Send(args[0] + args[1])
+//	  }))
+//
+// and called by peers:
+//
+//	var sum int
+//	err := rpc.FromEndpoint(e).Call(peer, "math.add", [2]int{1, 2}, &sum)
+//
+// A handler can Send any number of results, which the caller reads one by one
+// with a ResultStream. An error returned by the handler is sent to the
+// caller as an *Error.
+//
+// Each call uses its own reliable "rpc" channel carried as a byte stream (see
+// e3x/stream). Both sides write a sequence of frames: a kind byte, a 4-byte
+// big-endian length and the payload. The caller writes a JSON head frame
+// (method, codec and deadline) followed by the arguments; the handler
+// answers with result frames followed by at most one error frame. The "end"
+// of the channel ends each side.
+package rpc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/e3x/stream"
+	"github.com/telehash/gogotelehash/internal/hashname"
+	"github.com/telehash/gogotelehash/internal/util/logs"
+)
+
+const (
+	channelType = "rpc"
+
+	frameHead       = 'h'
+	frameValue      = 'v'
+	frameError      = 'e'
+	frameHeaderSize = 5
+
+	defaultTimeout      = 30 * time.Second
+	defaultMaxFrameSize = 1 << 20
+)
+
+// Error codes used by this package.
+const (
+	CodeUnknownMethod = "unknown-method"
+	CodeInternal      = "internal"
+	CodeInvalid       = "invalid"
+)
+
+var (
+	ErrUnknownMethod = &Error{Code: CodeUnknownMethod, Message: "unknown method"}
+	ErrFrameTooLarge = errors.New("rpc: frame too large")
+	ErrInvalidFrame  = errors.New("rpc: invalid frame")
+)
+
+// Error is an error returned by a remote handler. Handlers can return an
+// *Error to pass a code to the caller; all other errors are sent with the
+// CodeInternal code.
+type Error struct {
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+func (err *Error) Error() string {
+	return "rpc: " + err.Message
+}
+
+// Is reports whether target is an *Error with the same code.
+func (err *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code != "" && t.Code == err.Code
+}
+
+// Errorf returns an *Error with code and a formatted message.
+func Errorf(code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+type Config struct {
+	// Codec encodes the arguments and results of outgoing calls. Defaults to
+	// JSON. Incoming calls are answered with the codec of the caller.
+	Codec Codec
+
+	// Codecs are additional codecs accepted for incoming calls. JSON and
+	// MsgPack are always accepted.
+	Codecs []Codec
+
+	// Timeout is the default deadline of outgoing calls. Defaults to 30s; a
+	// negative value disables the deadline.
+	Timeout time.Duration
+
+	// MaxFrameSize limits the size of the encoded arguments and results.
+	// Defaults to 1MB.
+	MaxFrameSize int
+}
+
+// Handler serves calls of a method.
+type Handler interface {
+	ServeRPC(w ResponseWriter, req *Request) error
+}
+
+// HandlerFunc is an adapter to allow the use of ordinary functions as handlers.
+type HandlerFunc func(w ResponseWriter, req *Request) error
+
+// ServeRPC calls f(w, req).
+func (f HandlerFunc) ServeRPC(w ResponseWriter, req *Request) error {
+	return f(w, req)
+}
+
+// ResponseWriter sends the results of a call.
+type ResponseWriter interface {
+	// Send sends a result to the caller. Unary calls use the first result.
+	Send(v interface{}) error
+}
+
+// Request is an incoming call.
+type Request struct {
+	From   hashname.H
+	Method string
+
+	// Deadline is the deadline of the caller (zero when there is none).
+	Deadline time.Time
+
+	codec Codec
+	args  []byte
+}
+
+// Decode decodes the arguments of the call into v.
+func (req *Request) Decode(v interface{}) error {
+	if len(req.args) == 0 {
+		return nil
+	}
+	return req.codec.Unmarshal(req.args, v)
+}
+
+// CallOption configures an outgoing call.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	deadline time.Time
+	codec    Codec
+}
+
+// Deadline sets the deadline of a call.
+func Deadline(t time.Time) CallOption {
+	return func(o *callOptions) { o.deadline = t }
+}
+
+// Timeout sets the deadline of a call to d from now.
+func Timeout(d time.Duration) CallOption {
+	return func(o *callOptions) { o.deadline = time.Now().Add(d) }
+}
+
+// WithCodec sets the codec of a call.
+func WithCodec(codec Codec) CallOption {
+	return func(o *callOptions) { o.codec = codec }
+}
+
+type RPC interface {
+	// Register registers h for method, replacing the previous handler.
+	Register(method string, h Handler)
+
+	// Unregister removes the handler of method.
+	Unregister(method string)
+
+	// Call calls method of peer with args and decodes the first result into
+	// reply. reply is left untouched when the handler sent no results.
+	Call(peer e3x.Identifier, method string, args, reply interface{}, opts ...CallOption) error
+
+	// Stream calls method of peer with args and returns the stream of
+	// results.
+	Stream(peer e3x.Identifier, method string, args interface{}, opts ...CallOption) (*ResultStream, error)
+}
+
+type moduleKeyType string
+
+const moduleKey = moduleKeyType("rpc")
+
+type module struct {
+	e      *e3x.Endpoint
+	config Config
+	codecs map[string]Codec
+	log    *logs.Logger
+
+	mtx      sync.RWMutex
+	handlers map[string]Handler
+}
+
+func Module(config Config) e3x.EndpointOption {
+	return func(e *e3x.Endpoint) error {
+		return e3x.RegisterModule(moduleKey, newModule(e, config))(e)
+	}
+}
+
+func FromEndpoint(e *e3x.Endpoint) RPC {
+	mod := e.Module(moduleKey)
+	if mod == nil {
+		return nil
+	}
+	return mod.(*module)
+}
+
+func newModule(e *e3x.Endpoint, config Config) *module {
+	if config.Codec == nil {
+		config.Codec = JSON
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultTimeout
+	}
+	if config.MaxFrameSize <= 0 {
+		config.MaxFrameSize = defaultMaxFrameSize
+	}
+
+	mod := &module{
+		e:        e,
+		config:   config,
+		codecs:   make(map[string]Codec),
+		handlers: make(map[string]Handler),
+	}
+	for _, codec := range append([]Codec{JSON, MsgPack, config.Codec}, config.Codecs...) {
+		mod.codecs[codec.Name()] = codec
+	}
+	return mod
+}
+
+func (mod *module) Init() error {
+	mod.log = logs.Module("rpc").From(mod.e.LocalHashname())
+	return nil
+}
+
+func (mod *module) Start() error {
+	return mod.e.AddHandler(channelType, e3x.HandlerFunc(mod.serveTelehash))
+}
+
+func (mod *module) Stop() error {
+	mod.e.RemoveHandler(channelType)
+	return nil
+}
+
+func (mod *module) Register(method string, h Handler) {
+	mod.mtx.Lock()
+	mod.handlers[method] = h
+	mod.mtx.Unlock()
+}
+
+func (mod *module) Unregister(method string) {
+	mod.mtx.Lock()
+	delete(mod.handlers, method)
+	mod.mtx.Unlock()
+}
+
+// head is the first frame of a call.
+type head struct {
+	Method   string `json:"method"`
+	Codec    string `json:"codec"`
+	Deadline int64  `json:"deadline,omitempty"` // unix milliseconds
+}
+
+func (mod *module) serveTelehash(c *e3x.Channel) {
+	s := stream.New(c, stream.Config{ChunkSize: stream.MaxChunkSize})
+	w := &responseWriter{mod: mod, s: s, codec: JSON}
+
+	req, err := mod.readRequest(s)
+	if req != nil {
+		w.codec = req.codec
+		if !req.Deadline.IsZero() {
+			c.SetDeadline(req.Deadline)
+		}
+	}
+	if err == nil {
+		mod.mtx.RLock()
+		h := mod.handlers[req.Method]
+		mod.mtx.RUnlock()
+
+		if h == nil {
+			err = ErrUnknownMethod
+		} else {
+			err = mod.serve(h, w, req)
+		}
+	}
+
+	if err != nil && w.err == nil {
+		rerr, ok := err.(*Error)
+		if !ok {
+			rerr = &Error{Code: CodeInternal, Message: err.Error()}
+		}
+		w.send(frameError, rerr)
+	}
+
+	if w.err != nil {
+		c.Kill()
+		return
+	}
+	s.Close()
+}
+
+// serve calls h and recovers from panics.
+func (mod *module) serve(h Handler, w *responseWriter, req *Request) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			const size = 64 << 10
+			buf := make([]byte, size)
+			buf = buf[:runtime.Stack(buf, false)]
+			mod.log.To(req.From).Printf("panic serving %s: %v\n%s", req.Method, r, buf)
+			err = &Error{Code: CodeInternal, Message: "internal error"}
+		}
+	}()
+
+	return h.ServeRPC(w, req)
+}
+
+func (mod *module) readRequest(s *stream.Stream) (*Request, error) {
+	kind, data, err := readFrame(s, mod.config.MaxFrameSize)
+	if err != nil {
+		return nil, err
+	}
+	if kind != frameHead {
+		return nil, ErrInvalidFrame
+	}
+
+	var h head
+	err = json.Unmarshal(data, &h)
+	if err != nil {
+		return nil, &Error{Code: CodeInvalid, Message: err.Error()}
+	}
+
+	codec := mod.codecs[h.Codec]
+	if codec == nil {
+		return nil, &Error{Code: CodeInvalid, Message: "unknown codec " + h.Codec}
+	}
+
+	req := &Request{
+		From:   s.Channel().RemoteHashname(),
+		Method: h.Method,
+		codec:  codec,
+	}
+	if h.Deadline > 0 {
+		req.Deadline = time.Unix(0, h.Deadline*int64(time.Millisecond))
+	}
+
+	kind, data, err = readFrame(s, mod.config.MaxFrameSize)
+	if err == io.EOF {
+		return req, nil
+	}
+	if err != nil {
+		return req, err
+	}
+	if kind != frameValue {
+		return req, ErrInvalidFrame
+	}
+	req.args = data
+
+	return req, nil
+}
+
+type responseWriter struct {
+	mod   *module
+	s     *stream.Stream
+	codec Codec
+	err   error
+}
+
+func (w *responseWriter) Send(v interface{}) error {
+	return w.send(frameValue, v)
+}
+
+func (w *responseWriter) send(kind byte, v interface{}) error {
+	if w.err != nil {
+		return w.err
+	}
+
+	data, err := w.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	err = writeFrame(w.s, kind, data, w.mod.config.MaxFrameSize)
+	if err == ErrFrameTooLarge {
+		return err
+	}
+	if err == nil {
+		err = w.s.Flush()
+	}
+	if err != nil {
+		w.err = err
+	}
+	return err
+}
+
+func (mod *module) Call(peer e3x.Identifier, method string, args, reply interface{}, opts ...CallOption) error {
+	rs, err := mod.Stream(peer, method, args, opts...)
+	if err != nil {
+		return err
+	}
+
+	err = rs.Recv(reply)
+	for err == nil {
+		err = rs.Recv(nil)
+	}
+	if err != io.EOF {
+		rs.Close()
+		return err
+	}
+
+	return rs.Close()
+}
+
+func (mod *module) Stream(peer e3x.Identifier, method string, args interface{}, opts ...CallOption) (*ResultStream, error) {
+	o := callOptions{codec: mod.config.Codec}
+	if mod.config.Timeout > 0 {
+		o.deadline = time.Now().Add(mod.config.Timeout)
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	data, err := o.codec.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+
+	h := head{Method: method, Codec: o.codec.Name()}
+	if !o.deadline.IsZero() {
+		h.Deadline = o.deadline.UnixNano() / int64(time.Millisecond)
+	}
+	hdata, err := json.Marshal(&h)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := mod.e.Open(peer, channelType, true)
+	if err != nil {
+		return nil, err
+	}
+	if !o.deadline.IsZero() {
+		c.SetDeadline(o.deadline)
+	}
+
+	s := stream.New(c, stream.Config{ChunkSize: stream.MaxChunkSize})
+
+	err = writeFrame(s, frameHead, hdata, mod.config.MaxFrameSize)
+	if err == nil {
+		err = writeFrame(s, frameValue, data, mod.config.MaxFrameSize)
+	}
+	if err == nil {
+		err = s.CloseWrite()
+	}
+	if err != nil {
+		c.Kill()
+		return nil, err
+	}
+
+	return &ResultStream{s: s, codec: o.codec, maxFrameSize: mod.config.MaxFrameSize}, nil
+}
+
+// ResultStream reads the results of a call.
+type ResultStream struct {
+	s            *stream.Stream
+	codec        Codec
+	maxFrameSize int
+	err          error
+}
+
+// Recv decodes the next result into v. It returns io.EOF after the last
+// result and an *Error when the handler failed.
+func (rs *ResultStream) Recv(v interface{}) error {
+	if rs.err != nil {
+		return rs.err
+	}
+
+	kind, data, err := readFrame(rs.s, rs.maxFrameSize)
+	if err != nil {
+		rs.err = err
+		return err
+	}
+
+	switch kind {
+	case frameValue:
+		if v == nil {
+			return nil
+		}
+		return rs.codec.Unmarshal(data, v)
+
+	case frameError:
+		rerr := &Error{}
+		err = rs.codec.Unmarshal(data, rerr)
+		if err != nil {
+			rs.err = err
+			return err
+		}
+		rs.err = rerr
+		return rerr
+
+	default:
+		rs.err = ErrInvalidFrame
+		return ErrInvalidFrame
+	}
+}
+
+// Close ends the call. Results that were not read are discarded.
+func (rs *ResultStream) Close() error {
+	if rs.err == io.EOF {
+		return rs.s.Close()
+	}
+	rs.s.Channel().Kill()
+	return nil
+}
+
+func writeFrame(w io.Writer, kind byte, data []byte, max int) error {
+	if len(data) > max {
+		return ErrFrameTooLarge
+	}
+
+	var hdr [frameHeaderSize]byte
+	hdr[0] = kind
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(data)))
+
+	_, err := w.Write(hdr[:])
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// readFrame reads a frame from r. It returns io.EOF when r ended before the
+// frame.
+func readFrame(r io.Reader, max int) (kind byte, data []byte, err error) {
+	var hdr [frameHeaderSize]byte
+	_, err = io.ReadFull(r, hdr[:])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	size := binary.BigEndian.Uint32(hdr[1:])
+	if uint64(size) > uint64(max) {
+		return 0, nil, ErrFrameTooLarge
+	}
+
+	data = make([]byte, size)
+	_, err = io.ReadFull(r, data)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return hdr[0], data, nil
+}
@@ -0,0 +1,192 @@
+package rpc
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/transports/inproc"
+)
+
+func TestCall(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := e3x.Open(e3x.Transport(inproc.Config{}), Module(Config{}))
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := e3x.Open(e3x.Transport(inproc.Config{}), Module(Config{}))
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	FromEndpoint(A).Register("add", HandlerFunc(func(w ResponseWriter, req *Request) error {
+		var args [2]int
+		if err := req.Decode(&args); err != nil {
+			return err
+		}
+		return w.Send(args[0] + args[1])
+	}))
+	FromEndpoint(A).Register("count", HandlerFunc(func(w ResponseWriter, req *Request) error {
+		var n int
+		if err := req.Decode(&n); err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err := w.Send(i); err != nil {
+				return err
+			}
+		}
+		return Errorf("done", "counted to %d", n)
+	}))
+	FromEndpoint(A).Register("fail", HandlerFunc(func(w ResponseWriter, req *Request) error {
+		return errors.New("failed")
+	}))
+	FromEndpoint(A).Register("sleep", HandlerFunc(func(w ResponseWriter, req *Request) error {
+		assert.False(req.Deadline.IsZero())
+		time.Sleep(time.Second)
+		return w.Send(nil)
+	}))
+
+	identA, err := A.LocalIdentity()
+	if !assert.NoError(err) {
+		return
+	}
+
+	var sum int
+	assert.NoError(FromEndpoint(B).Call(identA, "add", [2]int{1, 2}, &sum))
+	assert.Equal(3, sum)
+
+	assert.NoError(FromEndpoint(B).Call(identA, "add", [2]int{3, 4}, &sum, WithCodec(MsgPack)))
+	assert.Equal(7, sum)
+
+	rs, err := FromEndpoint(B).Stream(identA, "count", 3)
+	if assert.NoError(err) {
+		var i int
+		for n := 0; n < 3; n++ {
+			assert.NoError(rs.Recv(&i))
+			assert.Equal(n, i)
+		}
+		err = rs.Recv(&i)
+		assert.Equal(&Error{Code: "done", Message: "counted to 3"}, err)
+		assert.Equal(err, rs.Recv(&i))
+		assert.NoError(rs.Close())
+	}
+
+	err = FromEndpoint(B).Call(identA, "fail", nil, nil)
+	assert.Equal(&Error{Code: CodeInternal, Message: "failed"}, err)
+
+	err = FromEndpoint(B).Call(identA, "missing", nil, nil)
+	assert.True(errors.Is(err, ErrUnknownMethod))
+
+	err = FromEndpoint(B).Call(identA, "sleep", nil, nil, Timeout(100*time.Millisecond))
+	assert.Equal(e3x.ErrTimeout, err)
+
+	rs, err = FromEndpoint(B).Stream(identA, "count", 0)
+	if assert.NoError(err) {
+		assert.Equal(&Error{Code: "done", Message: "counted to 0"}, rs.Recv(nil))
+		assert.NoError(rs.Close())
+	}
+}
+
+func TestMsgPack(t *testing.T) {
+	assert := assert.New(t)
+
+	type value struct {
+		Bool   bool              `json:"bool"`
+		Int    int               `json:"int"`
+		Neg    int64             `json:"neg"`
+		Big    uint64            `json:"big"`
+		Float  float64           `json:"float"`
+		String string            `json:"string"`
+		Bytes  []byte            `json:"bytes"`
+		List   []string          `json:"list"`
+		Map    map[string]int    `json:"map"`
+		Nil    *value            `json:"nil"`
+		Extra  map[string]string `json:"extra,omitempty"`
+	}
+
+	in := value{
+		Bool:   true,
+		Int:    70000,
+		Neg:    -129,
+		Big:    1 << 63,
+		Float:  1.5,
+		String: string(make([]byte, 300)),
+		Bytes:  []byte{1, 2, 3},
+		List:   []string{"a", "b"},
+		Map:    map[string]int{"x": -1, "y": 255},
+	}
+
+	data, err := MsgPack.Marshal(&in)
+	if !assert.NoError(err) {
+		return
+	}
+
+	var out value
+	assert.NoError(MsgPack.Unmarshal(data, &out))
+	assert.Equal(in, out)
+
+	assert.Error(MsgPack.Unmarshal(data[:len(data)-1], &out))
+	assert.Error(MsgPack.Unmarshal(append(data, 0xc0), &out))
+
+	// bin, float32 and int8 values from other encoders
+	var tree []interface{}
+	assert.NoError(MsgPack.Unmarshal([]byte{0x93, 0xc4, 0x01, 0x41, 0xca, 0x3f, 0xc0, 0x00, 0x00, 0xd0, 0x80}, &tree))
+	if assert.Len(tree, 3) {
+		assert.Equal([]byte("A"), tree[0])
+		assert.Equal(1.5, tree[1])
+		assert.Equal(int64(-128), tree[2])
+	}
+
+	// json.Marshalers and embedded structs
+	type embedded struct {
+		At time.Time `json:"at"`
+	}
+	type outer struct {
+		embedded
+		Name string `json:"name"`
+	}
+	at := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+	data, err = MsgPack.Marshal(outer{embedded{at}, "x"})
+	if assert.NoError(err) {
+		var o outer
+		assert.NoError(MsgPack.Unmarshal(data, &o))
+		assert.True(at.Equal(o.At))
+		assert.Equal("x", o.Name)
+	}
+
+	var s string
+	assert.NoError(MsgPack.Unmarshal([]byte{0xa2, 'h', 'i'}, &s))
+	assert.Equal("hi", s)
+}
+
+func TestMsgPackDepth(t *testing.T) {
+	assert := assert.New(t)
+
+	nested := func(depth int) []byte {
+		data := bytes.Repeat([]byte{0x91}, depth)
+		return append(data, 0xc0)
+	}
+
+	var v interface{}
+	assert.NoError(MsgPack.Unmarshal(nested(maxMsgPackDepth), &v))
+	assert.Equal(errMsgPackDepth, MsgPack.Unmarshal(nested(maxMsgPackDepth+1), &v))
+	assert.Equal(errMsgPackDepth, MsgPack.Unmarshal(nested(1<<20), &v))
+
+	// cyclic values can't be encoded
+	type node struct {
+		Next *node `json:"next"`
+	}
+	n := &node{}
+	n.Next = n
+	_, err := MsgPack.Marshal(n)
+	assert.Equal(errMsgPackDepth, err)
+}
@@ -0,0 +1,159 @@
+package thtp
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/e3x/stream"
+	"github.com/telehash/gogotelehash/internal/hashname"
+)
+
+var (
+	_ http.RoundTripper = (*RoundTripper)(nil)
+)
+
+var errMissingStatus = errors.New("thtp: missing :status header")
+
+// RoundTripper sends requests for "thtp://<hashname>/..." URLs to the
+// hashname.
+type RoundTripper struct {
+	Endpoint *e3x.Endpoint
+
+	// Resolver is used to dial hashnames the endpoint has no exchange with.
+	// When Resolver is nil only peers with an exchange can be reached.
+	Resolver Resolver
+}
+
+// Resolver finds the identity of a hashname.
+type Resolver interface {
+	Resolve(hn hashname.H) (*e3x.Identity, error)
+}
+
+func NewClient(e *e3x.Endpoint) *http.Client {
+	return &http.Client{Transport: &RoundTripper{Endpoint: e}}
+}
+
+// RegisterDefaultTransport registers the THTP protocol with http.DefaultTransport
+// and binds it to the provided Endpoint.
+func RegisterDefaultTransport(e *e3x.Endpoint) {
+	t := http.DefaultTransport.(*http.Transport)
+	t.RegisterProtocol("thtp", &RoundTripper{Endpoint: e})
+}
+
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		defer req.Body.Close()
+	}
+
+	x, err := rt.exchange(hashname.H(req.URL.Host))
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := x.Open("thtp", true)
+	if err != nil {
+		return nil, err
+	}
+
+	s := stream.New(c, stream.Config{ChunkSize: stream.MaxChunkSize})
+
+	err = rt.writeRequest(req, s)
+	if err != nil {
+		c.Kill()
+		return nil, err
+	}
+
+	resp, err := rt.readResponse(s)
+	if err != nil {
+		c.Kill()
+		return nil, err
+	}
+
+	resp.Request = req
+	return resp, nil
+}
+
+func (rt *RoundTripper) exchange(hn hashname.H) (*e3x.Exchange, error) {
+	if x := rt.Endpoint.GetExchange(hn); x != nil {
+		return x, nil
+	}
+
+	if rt.Resolver == nil {
+		return nil, e3x.UnreachableEndpointError(hn)
+	}
+
+	ident, err := rt.Resolver.Resolve(hn)
+	if err != nil {
+		return nil, err
+	}
+	return rt.Endpoint.Dial(ident)
+}
+
+func (rt *RoundTripper) writeRequest(req *http.Request, s *stream.Stream) error {
+	header := req.Header
+	if req.ContentLength > 0 {
+		header = cloneHeader(header)
+		header.Set("Content-Length", strconv.FormatInt(req.ContentLength, 10))
+	}
+
+	method := req.Method
+	if method == "" {
+		method = "GET"
+	}
+
+	err := writeHead(s, header, map[string]interface{}{
+		":method": method,
+		":path":   req.URL.RequestURI(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if req.Body != nil {
+		_, err = io.Copy(s, req.Body)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.CloseWrite()
+}
+
+func (rt *RoundTripper) readResponse(s *stream.Stream) (*http.Response, error) {
+	header, extra, err := readHead(s)
+	if err != nil {
+		return nil, err
+	}
+
+	status, _ := extra[":status"].(float64)
+	if status <= 0 {
+		return nil, errMissingStatus
+	}
+
+	resp := &http.Response{
+		StatusCode:    int(status),
+		Status:        strconv.Itoa(int(status)) + " " + http.StatusText(int(status)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		ContentLength: -1,
+		Body:          s,
+	}
+	if n, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil && n >= 0 {
+		resp.ContentLength = n
+	}
+
+	return resp, nil
+}
+
+func cloneHeader(h http.Header) http.Header {
+	h2 := make(http.Header, len(h)+1)
+	for k, v := range h {
+		h2[k] = v
+	}
+	return h2
+}
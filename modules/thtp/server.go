@@ -0,0 +1,200 @@
+package thtp
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/e3x/stream"
+	"github.com/telehash/gogotelehash/internal/util/logs"
+)
+
+var (
+	_ http.ResponseWriter = (*responseWriter)(nil)
+	_ http.Flusher        = (*responseWriter)(nil)
+	_ e3x.Module          = (*module)(nil)
+)
+
+// Server serves handler to the peers of the endpoint. The Host of the
+// requests is the local hashname and the RemoteAddr is the hashname of the
+// peer.
+func Server(handler http.Handler) e3x.EndpointOption {
+	return func(e *e3x.Endpoint) error {
+		return e3x.RegisterModule(moduleKey, &module{
+			endpoint: e,
+			handler:  handler,
+		})(e)
+	}
+}
+
+type moduleKeyType string
+
+const moduleKey = moduleKeyType("thtp")
+
+type module struct {
+	endpoint *e3x.Endpoint
+	listener *e3x.Listener
+	handler  http.Handler
+	log      *logs.Logger
+}
+
+func (mod *module) Init() error {
+	mod.log = logs.Module("thtp").From(mod.endpoint.LocalHashname())
+	mod.listener = mod.endpoint.Listen("thtp", true)
+	return nil
+}
+
+func (mod *module) Start() error {
+	go mod.run()
+	return nil
+}
+
+func (mod *module) Stop() error {
+	if mod.listener != nil {
+		mod.listener.Close()
+	}
+	return nil
+}
+
+func (mod *module) run() {
+	for {
+		c, err := mod.listener.AcceptChannel()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		go mod.serveTelehash(c)
+	}
+}
+
+func (mod *module) serveTelehash(c *e3x.Channel) {
+	defer func() {
+		if err := recover(); err != nil {
+			const size = 64 << 10
+			buf := make([]byte, size)
+			buf = buf[:runtime.Stack(buf, false)]
+			mod.log.To(c.RemoteHashname()).Printf("panic serving request: %v\n%s", err, buf)
+			c.Kill()
+		}
+	}()
+
+	s := stream.New(c, stream.Config{ChunkSize: stream.MaxChunkSize})
+
+	req, err := mod.readRequest(s)
+	if err != nil {
+		c.Kill()
+		return
+	}
+
+	rw := newResponseWriter(s)
+	mod.handler.ServeHTTP(rw, req)
+	rw.finish()
+}
+
+func (mod *module) readRequest(s *stream.Stream) (*http.Request, error) {
+	header, extra, err := readHead(s)
+	if err != nil {
+		return nil, err
+	}
+
+	method, _ := extra[":method"].(string)
+	path, _ := extra[":path"].(string)
+	if method == "" || path == "" {
+		return nil, errInvalidHead
+	}
+
+	u, err := url.ParseRequestURI(path)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = "thtp"
+	u.Host = string(mod.endpoint.LocalHashname())
+
+	req := &http.Request{
+		Method:        strings.ToUpper(method),
+		URL:           u,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Host:          u.Host,
+		RemoteAddr:    s.RemoteAddr().String(),
+		RequestURI:    path,
+		ContentLength: -1,
+		Body:          ioutil.NopCloser(s),
+	}
+	if n, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil && n >= 0 {
+		req.ContentLength = n
+	}
+
+	return req, nil
+}
+
+type responseWriter struct {
+	s      *stream.Stream
+	header http.Header
+	code   int
+	err    error
+}
+
+func newResponseWriter(s *stream.Stream) *responseWriter {
+	return &responseWriter{
+		s:      s,
+		header: make(http.Header),
+	}
+}
+
+func (rw *responseWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *responseWriter) Flush() {
+	if rw.code == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if rw.err == nil {
+		rw.err = rw.s.Flush()
+	}
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	if rw.code == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if rw.err != nil {
+		return 0, rw.err
+	}
+
+	n, err := rw.s.Write(p)
+	rw.err = err
+	return n, err
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if rw.code != 0 {
+		return
+	}
+	rw.code = code
+
+	rw.err = writeHead(rw.s, rw.header, map[string]interface{}{":status": code})
+}
+
+// finish ends the response and closes the channel.
+func (rw *responseWriter) finish() {
+	if rw.code == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if rw.err == nil {
+		rw.err = rw.s.Close()
+	}
+	if rw.err != nil {
+		rw.s.Channel().Kill()
+	}
+}
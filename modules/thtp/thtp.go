@@ -0,0 +1,110 @@
+// Package thtp implements THTP, HTTP over telehash channels.
+//
+// The Server option serves an http.Handler to peers and the RoundTripper
+// sends requests to the hashname in the host of "thtp://" URLs:
+//
+//	e3x.Open(thtp.Server(http.DefaultServeMux))
+//
+//	client := thtp.NewClient(e)
+//	resp, err := client.Get("thtp://" + string(peer) + "/status")
+//
+// Each request uses its own reliable "thtp" channel, read and written as a
+// byte stream (see e3x/stream). The request and the response each start
+// with a head (a 2-byte length followed by JSON) holding the lowercased HTTP
+// headers plus ":method" and ":path" (requests) or ":status" (responses).
+// The HTTP body follows the head and ends with the "end" of the channel.
+package thtp
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var errInvalidHead = errors.New("thtp: invalid head")
+
+// writeHead writes the LOB head of a request or response to w. The pseudo
+// headers in extra (":method", ":status", ...) are added to the HTTP headers.
+func writeHead(w io.Writer, header http.Header, extra map[string]interface{}) error {
+	head := make(map[string]interface{}, len(header)+len(extra))
+	for k, v := range header {
+		switch len(v) {
+		case 0:
+			continue
+		case 1:
+			head[strings.ToLower(k)] = v[0]
+		default:
+			head[strings.ToLower(k)] = v
+		}
+	}
+	for k, v := range extra {
+		head[k] = v
+	}
+
+	data, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+	if len(data) > 0xffff {
+		return errInvalidHead
+	}
+
+	var size [2]byte
+	binary.BigEndian.PutUint16(size[:], uint16(len(data)))
+	if _, err := w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// readHead reads the LOB head of a request or response from r. The pseudo
+// headers (starting with ":") are returned in extra.
+func readHead(r io.Reader) (header http.Header, extra map[string]interface{}, err error) {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, nil, err
+	}
+
+	data := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, nil, err
+	}
+
+	var head map[string]interface{}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, nil, errInvalidHead
+	}
+
+	header = make(http.Header, len(head))
+	extra = make(map[string]interface{})
+	for k, v := range head {
+		if strings.HasPrefix(k, ":") {
+			extra[k] = v
+			continue
+		}
+
+		k = http.CanonicalHeaderKey(k)
+		switch v := v.(type) {
+		case string:
+			header.Add(k, v)
+		case []interface{}:
+			for _, e := range v {
+				if s, ok := e.(string); ok {
+					header.Add(k, s)
+				}
+			}
+		}
+	}
+
+	return header, extra, nil
+}
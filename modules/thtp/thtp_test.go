@@ -0,0 +1,90 @@
+package thtp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/transports/inproc"
+)
+
+func TestRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header()["X-Values"] = req.Header["X-Values"]
+		w.Header().Set("X-Method", req.Method)
+		w.Header().Set("X-Query", req.URL.Query().Get("q"))
+		w.Header().Set("X-Peer", req.RemoteAddr)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	})
+
+	A, err := e3x.Open(
+		e3x.Transport(inproc.Config{}),
+		Server(mux))
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := e3x.Open(e3x.Transport(inproc.Config{}))
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	client := NewClient(B)
+	base := "thtp://" + string(A.LocalHashname())
+
+	// unknown peers are unreachable without a resolver
+	_, err = client.Get(base + "/echo")
+	assert.Error(err)
+
+	identA, err := A.LocalIdentity()
+	assert.NoError(err)
+	_, err = B.Dial(identA)
+	if !assert.NoError(err) {
+		return
+	}
+
+	body := bytes.Repeat([]byte("telehash"), 4096)
+	req, err := http.NewRequest("POST", base+"/echo?q=x", bytes.NewReader(body))
+	if !assert.NoError(err) {
+		return
+	}
+	req.Header["X-Values"] = []string{"a", "b"}
+
+	resp, err := client.Do(req)
+	if !assert.NoError(err) {
+		return
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(err)
+	assert.Equal(http.StatusCreated, resp.StatusCode)
+	assert.Equal(body, data)
+	assert.Equal([]string{"a", "b"}, resp.Header["X-Values"])
+	assert.Equal("POST", resp.Header.Get("X-Method"))
+	assert.Equal("x", resp.Header.Get("X-Query"))
+	assert.Equal(string(B.LocalHashname()), resp.Header.Get("X-Peer"))
+
+	resp, err = client.Get(base + "/missing")
+	if assert.NoError(err) {
+		assert.Equal(http.StatusNotFound, resp.StatusCode)
+		resp.Body.Close()
+	}
+}
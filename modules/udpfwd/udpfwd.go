@@ -0,0 +1,422 @@
+// Package udpfwd forwards UDP datagrams over unreliable telehash channels.
+//
+// An endpoint exposes local UDP services to its peers under a name and a peer
+// forwards a local UDP port to the service:
+//
+//	e3x.Open(udpfwd.Module(udpfwd.Config{
+//	  Services: map[string]string{"voip": "127.0.0.1:5060"},
+//	}))
+//
+//	conn, _ := udpfwd.FromEndpoint(e).Forward("127.0.0.1:5060", ident, "voip")
+//	defer conn.Close()
+//
+// Each local source address gets its own unreliable "udpfwd" channel; every
+// datagram is sent as the body of one packet, so datagrams are neither
+// retransmitted nor reordered. The first packet names the service in its
+// "service" header and carries the first datagram. The exposing endpoint
+// re-emits the datagrams from a socket of its own to the service and sends the
+// replies back over the channel. Idle channels are closed after
+// Config.IdleTimeout.
+package udpfwd
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/internal/hashname"
+	"github.com/telehash/gogotelehash/internal/lob"
+	"github.com/telehash/gogotelehash/internal/util/logs"
+)
+
+const (
+	channelType = "udpfwd"
+
+	// DefaultIdleTimeout is the time after which a channel without traffic is
+	// closed.
+	DefaultIdleTimeout = 2 * time.Minute
+
+	// maxDatagramSize is the largest datagram that is forwarded.
+	maxDatagramSize = 1200
+
+	// queueSize is the number of datagrams that are buffered per channel while
+	// the channel is opened. Datagrams are dropped when the queue is full.
+	queueSize = 64
+)
+
+var (
+	ErrUnknownService = errors.New("udpfwd: unknown service")
+	ErrNotAllowed     = errors.New("udpfwd: not allowed")
+)
+
+type Config struct {
+	// Services maps the names of the exposed services to the UDP addresses
+	// they are forwarded to.
+	Services map[string]string
+
+	// Allow is called for each channel of peer to service. When Allow is nil
+	// all peers can use all exposed services.
+	Allow func(peer hashname.H, service string) bool
+
+	// IdleTimeout defaults to DefaultIdleTimeout.
+	IdleTimeout time.Duration
+}
+
+type Forwarder interface {
+	// Forward listens on the UDP address laddr and forwards the datagrams it
+	// receives to service of peer. Close the returned connection to stop
+	// forwarding.
+	Forward(laddr string, peer e3x.Identifier, service string) (net.PacketConn, error)
+
+	// Expose makes the UDP address addr available to peers as service.
+	Expose(service, addr string)
+
+	// Unexpose removes service. Open channels are not closed.
+	Unexpose(service string)
+}
+
+type moduleKeyType string
+
+const moduleKey = moduleKeyType("udpfwd")
+
+type module struct {
+	e        *e3x.Endpoint
+	config   Config
+	log      *logs.Logger
+	listener *e3x.Listener
+
+	mtx      sync.Mutex
+	services map[string]string
+	conns    map[net.PacketConn]bool
+}
+
+func Module(config Config) e3x.EndpointOption {
+	return func(e *e3x.Endpoint) error {
+		return e3x.RegisterModule(moduleKey, newModule(e, config))(e)
+	}
+}
+
+func FromEndpoint(e *e3x.Endpoint) Forwarder {
+	mod := e.Module(moduleKey)
+	if mod == nil {
+		return nil
+	}
+	return mod.(*module)
+}
+
+func newModule(e *e3x.Endpoint, config Config) *module {
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = DefaultIdleTimeout
+	}
+
+	mod := &module{
+		e:        e,
+		config:   config,
+		services: make(map[string]string),
+		conns:    make(map[net.PacketConn]bool),
+	}
+	for service, addr := range config.Services {
+		mod.services[service] = addr
+	}
+	return mod
+}
+
+func (mod *module) Init() error {
+	mod.log = logs.Module("udpfwd").From(mod.e.LocalHashname())
+	mod.listener = mod.e.Listen(channelType, false)
+	return nil
+}
+
+func (mod *module) Start() error {
+	go mod.acceptChannels()
+	return nil
+}
+
+func (mod *module) Stop() error {
+	mod.listener.Close()
+
+	mod.mtx.Lock()
+	conns := mod.conns
+	mod.conns = make(map[net.PacketConn]bool)
+	mod.mtx.Unlock()
+
+	for conn := range conns {
+		conn.Close()
+	}
+	return nil
+}
+
+func (mod *module) Expose(service, addr string) {
+	mod.mtx.Lock()
+	mod.services[service] = addr
+	mod.mtx.Unlock()
+}
+
+func (mod *module) Unexpose(service string) {
+	mod.mtx.Lock()
+	delete(mod.services, service)
+	mod.mtx.Unlock()
+}
+
+func (mod *module) Forward(laddr string, peer e3x.Identifier, service string) (net.PacketConn, error) {
+	conn, err := net.ListenPacket("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	mod.mtx.Lock()
+	mod.conns[conn] = true
+	mod.mtx.Unlock()
+
+	f := &forward{
+		mod:      mod,
+		conn:     conn,
+		peer:     peer,
+		service:  service,
+		sessions: make(map[string]*session),
+	}
+	go f.run()
+	return conn, nil
+}
+
+// forward sends the datagrams received on a local socket to a service of a
+// peer.
+type forward struct {
+	mod     *module
+	conn    net.PacketConn
+	peer    e3x.Identifier
+	service string
+
+	mtx      sync.Mutex
+	sessions map[string]*session
+}
+
+// session is the channel for the datagrams of one local source address.
+type session struct {
+	addr  net.Addr
+	queue chan []byte
+	done  chan struct{}
+}
+
+func (f *forward) run() {
+	defer func() {
+		f.mod.mtx.Lock()
+		delete(f.mod.conns, f.conn)
+		f.mod.mtx.Unlock()
+
+		f.mtx.Lock()
+		for _, s := range f.sessions {
+			close(s.done)
+		}
+		f.sessions = nil
+		f.mtx.Unlock()
+	}()
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, addr, err := f.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if n > maxDatagramSize {
+			continue // drop
+		}
+
+		f.mtx.Lock()
+		s := f.sessions[addr.String()]
+		if s == nil {
+			s = &session{addr: addr, queue: make(chan []byte, queueSize), done: make(chan struct{})}
+			f.sessions[addr.String()] = s
+			go f.runSession(s)
+		}
+		f.mtx.Unlock()
+
+		select {
+		case s.queue <- append([]byte(nil), buf[:n]...):
+		default: // drop
+		}
+	}
+}
+
+func (f *forward) runSession(s *session) {
+	defer func() {
+		f.mtx.Lock()
+		if f.sessions != nil && f.sessions[s.addr.String()] == s {
+			delete(f.sessions, s.addr.String())
+		}
+		f.mtx.Unlock()
+	}()
+
+	c, err := f.mod.e.Open(f.peer, channelType, false)
+	if err != nil {
+		f.mod.log.Printf("\x1B[31mFailed to forward\x1B[0m %s to %s: %s", f.service, f.peer, err)
+		return
+	}
+
+	var first []byte
+	select {
+	case first = <-s.queue:
+	case <-s.done:
+		c.Kill()
+		return
+	}
+
+	// the first packet opens the channel
+	pkt := lob.New(first)
+	pkt.Header().SetString("service", f.service)
+	if err := c.WritePacket(pkt); err != nil {
+		c.Kill()
+		return
+	}
+
+	idle := time.AfterFunc(f.mod.config.IdleTimeout, func() { closeChannel(c) })
+	defer idle.Stop()
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		for {
+			select {
+			case data := <-s.queue:
+				if c.WritePacket(lob.New(data)) != nil {
+					return
+				}
+				idle.Reset(f.mod.config.IdleTimeout)
+			case <-s.done:
+				closeChannel(c)
+				return
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	for {
+		pkt, err := c.ReadPacket()
+		if err != nil {
+			closeChannel(c)
+			return
+		}
+
+		if reason, failed := pkt.Header().GetString("err"); failed {
+			f.mod.log.To(c.RemoteHashname()).Printf("\x1B[31mFailed to forward\x1B[0m %s: %s", f.service, reason)
+			pkt.Free()
+			c.Kill()
+			return
+		}
+
+		if pkt.BodyLen() > 0 {
+			f.conn.WriteTo(pkt.Body(nil), s.addr)
+			idle.Reset(f.mod.config.IdleTimeout)
+		}
+		pkt.Free()
+	}
+}
+
+func (mod *module) acceptChannels() {
+	for {
+		c, err := mod.listener.AcceptChannel()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		go mod.serve(c)
+	}
+}
+
+// serve re-emits the datagrams of c to the service it requested.
+func (mod *module) serve(c *e3x.Channel) {
+	pkt, err := c.ReadPacket()
+	if err != nil {
+		c.Kill()
+		return
+	}
+	service, _ := pkt.Header().GetString("service")
+
+	mod.mtx.Lock()
+	addr, found := mod.services[service]
+	mod.mtx.Unlock()
+
+	if !found {
+		pkt.Free()
+		c.Error(ErrUnknownService)
+		return
+	}
+	if mod.config.Allow != nil && !mod.config.Allow(c.RemoteHashname(), service) {
+		pkt.Free()
+		c.Error(ErrNotAllowed)
+		return
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		pkt.Free()
+		c.Error(err)
+		return
+	}
+	defer conn.Close()
+
+	// a channel must be answered before its next packets can be read
+	if err := c.WritePacket(&lob.Packet{}); err != nil {
+		pkt.Free()
+		c.Kill()
+		return
+	}
+
+	if pkt.BodyLen() > 0 {
+		conn.Write(pkt.Body(nil))
+	}
+	pkt.Free()
+
+	idle := time.AfterFunc(mod.config.IdleTimeout, func() { closeChannel(c) })
+	defer idle.Stop()
+
+	go func() {
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				closeChannel(c)
+				return
+			}
+			if n > maxDatagramSize {
+				continue // drop
+			}
+			if c.WritePacket(lob.New(buf[:n])) != nil {
+				return
+			}
+			idle.Reset(mod.config.IdleTimeout)
+		}
+	}()
+
+	for {
+		pkt, err := c.ReadPacket()
+		if err != nil {
+			closeChannel(c)
+			return
+		}
+		if pkt.BodyLen() > 0 {
+			conn.Write(pkt.Body(nil))
+			idle.Reset(mod.config.IdleTimeout)
+		}
+		pkt.Free()
+	}
+}
+
+// closeChannel ends c without waiting for the peer; the "end" of an
+// unreliable channel might get lost.
+func closeChannel(c *e3x.Channel) {
+	c.SetWriteDeadline(time.Now().Add(time.Second))
+
+	pkt := &lob.Packet{}
+	hdr := pkt.Header()
+	hdr.End, hdr.HasEnd = true, true
+	c.WritePacket(pkt)
+	c.Kill()
+}
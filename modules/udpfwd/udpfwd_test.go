@@ -0,0 +1,80 @@
+package udpfwd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/telehash/gogotelehash/e3x"
+	"github.com/telehash/gogotelehash/transports/inproc"
+)
+
+func TestForward(t *testing.T) {
+	assert := assert.New(t)
+
+	// echo service
+	service, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.NoError(err) {
+		return
+	}
+	defer service.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := service.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			service.WriteTo(buf[:n], addr)
+		}
+	}()
+
+	A, err := e3x.Open(
+		e3x.Transport(inproc.Config{}),
+		Module(Config{Services: map[string]string{"echo": service.LocalAddr().String()}}))
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := e3x.Open(
+		e3x.Transport(inproc.Config{}),
+		Module(Config{IdleTimeout: 200 * time.Millisecond}))
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	identA, err := A.LocalIdentity()
+	assert.NoError(err)
+
+	fwd, err := FromEndpoint(B).Forward("127.0.0.1:0", identA, "echo")
+	if !assert.NoError(err) {
+		return
+	}
+	defer fwd.Close()
+
+	conn, err := net.Dial("udp", fwd.LocalAddr().String())
+	if !assert.NoError(err) {
+		return
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 1500)
+	for _, msg := range []string{"first", "second", "after idle"} {
+		if msg == "after idle" {
+			time.Sleep(500 * time.Millisecond)
+		}
+
+		_, err = conn.Write([]byte(msg))
+		assert.NoError(err)
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := conn.Read(buf)
+		if assert.NoError(err) {
+			assert.Equal(msg, string(buf[:n]))
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package transports
+
+import (
+	"net"
+)
+
+// Message is a packet and its destination.
+type Message struct {
+	Data []byte
+	Addr net.Addr
+}
+
+// BatchWriter is implemented by transports that can send a burst of packets
+// with fewer system calls than writing them one by one (for example with UDP
+// segmentation offload).
+type BatchWriter interface {
+	Transport
+
+	// WriteMessages sends msgs in order and returns the number of messages
+	// that were sent. ErrInvalidAddr is returned for the first message whose
+	// destination can't be reached with a batch; the caller must write the
+	// remaining messages to their connections.
+	WriteMessages(msgs []Message) (int, error)
+}
+
+// WriteMessages sends msgs with t when t implements BatchWriter. Otherwise
+// ErrInvalidAddr is returned and no message is sent.
+func WriteMessages(t Transport, msgs []Message) (int, error) {
+	if b, ok := t.(BatchWriter); ok {
+		return b.WriteMessages(msgs)
+	}
+	return 0, ErrInvalidAddr
+}
@@ -0,0 +1,82 @@
+package compress
+
+import (
+	"encoding/json"
+	"net"
+
+	"github.com/telehash/gogotelehash/transports"
+)
+
+func init() {
+	transports.RegisterAddr(&addr{})
+
+	transports.RegisterResolver("compress", func(str string) (net.Addr, error) {
+		inner, err := transports.ParseAddr(str)
+		if err != nil {
+			return nil, transports.ErrInvalidAddr
+		}
+		if _, nested := inner.(*addr); nested {
+			return nil, transports.ErrInvalidAddr
+		}
+		return &addr{inner}, nil
+	})
+}
+
+// addr is the address of a transport that accepts compressed packets. It
+// wraps the address of the sub-transport.
+type addr struct {
+	inner net.Addr
+}
+
+func (a *addr) Network() string { return "compress" }
+
+func (a *addr) String() string { return a.inner.String() }
+
+func (a *addr) URL() string { return "compress://" + transports.FormatAddr(a.inner) }
+
+func (a *addr) Equal(other net.Addr) bool {
+	b, ok := other.(*addr)
+	return ok && transports.EqualAddr(a.inner, b.inner)
+}
+
+func (a *addr) MarshalJSON() ([]byte, error) {
+	inner, err := transports.EncodeAddr(a.inner)
+	if err != nil {
+		return nil, err
+	}
+
+	var desc = struct {
+		Type string          `json:"type"`
+		Alg  string          `json:"alg"`
+		Addr json.RawMessage `json:"addr"`
+	}{
+		Type: a.Network(),
+		Alg:  algDeflate,
+		Addr: inner,
+	}
+
+	return json.Marshal(&desc)
+}
+
+func (a *addr) UnmarshalJSON(data []byte) error {
+	var desc struct {
+		Alg  string          `json:"alg"`
+		Addr json.RawMessage `json:"addr"`
+	}
+
+	err := json.Unmarshal(data, &desc)
+	if err != nil || len(desc.Addr) == 0 || desc.Alg != algDeflate {
+		return transports.ErrInvalidAddr
+	}
+
+	inner, err := transports.DecodeAddr(desc.Addr)
+	if err != nil {
+		return transports.ErrInvalidAddr
+	}
+	if _, nested := inner.(*addr); nested {
+		return transports.ErrInvalidAddr
+	}
+
+	a.inner = inner
+	return nil
+}
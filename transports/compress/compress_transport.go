@@ -0,0 +1,262 @@
+// Package compress implements a transport that compresses packets.
+//
+// The compress transport wraps any sub-transport and compresses the packets
+// (with DEFLATE) it exchanges with peers that support it. This pays off for
+// JSON heavy protocols over constrained links:
+//
+//	e3x.New(keys, compress.Config{Config: udp.Config{}})
+//
+// The transport advertises the addresses of the sub-transport twice: as is,
+// for peers without compression, and wrapped in a "compress" address. Packets
+// are only compressed when the peer was dialed with a "compress" address or
+// when the peer sent compressed packets itself.
+//
+// Each packet on a compressed connection is prefixed with a marker byte.
+// Telehash packets start with the (big endian) length of their header, which
+// never starts with a marker byte, so plain packets are still recognized.
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/telehash/gogotelehash/transports"
+)
+
+// DefaultLevel is the compression level when Config.Level is not set.
+const DefaultLevel = flate.BestSpeed
+
+const (
+	algDeflate = "deflate"
+
+	markDeflate = 0xFD // followed by a DEFLATE compressed packet
+	markRaw     = 0xFE // followed by a packet that didn't compress
+)
+
+// maxPacketSize is the largest packet the sub-transports accept. Packets
+// that don't compress take one extra byte on compressed connections.
+const maxPacketSize = 1472
+
+var (
+	_ transports.Config    = Config{}
+	_ transports.Transport = (*transport)(nil)
+	_ net.Conn             = (*conn)(nil)
+)
+
+// Config for the compress transport.
+type Config struct {
+	// Config is the configuration of the sub-transport.
+	Config transports.Config
+
+	// Level is the DEFLATE compression level (1 to 9).
+	// Defaults to DefaultLevel.
+	Level int
+}
+
+type transport struct {
+	t     transports.Transport
+	level int
+}
+
+type conn struct {
+	net.Conn
+	t     *transport
+	raddr net.Addr
+
+	// compressing is set (to 1) when packets are compressed
+	compressing int32
+
+	mtxWrite sync.Mutex
+	wbuf     bytes.Buffer
+	w        *flate.Writer
+
+	mtxRead sync.Mutex
+	rbuf    []byte
+	r       io.ReadCloser
+}
+
+// Open opens the sub-transport.
+func (c Config) Open() (transports.Transport, error) {
+	if c.Config == nil {
+		return nil, errors.New("compress: missing sub-transport")
+	}
+	if c.Level == 0 {
+		c.Level = DefaultLevel
+	}
+	if c.Level < flate.BestSpeed || c.Level > flate.BestCompression {
+		return nil, errors.New("compress: invalid Level")
+	}
+
+	t, err := c.Config.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	return &transport{t: t, level: c.Level}, nil
+}
+
+func (t *transport) Addrs() []net.Addr {
+	inner := t.t.Addrs()
+
+	addrs := make([]net.Addr, 0, 2*len(inner))
+	for _, a := range inner {
+		addrs = append(addrs, &addr{a})
+	}
+	return append(addrs, inner...)
+}
+
+func (t *transport) Dial(a net.Addr) (net.Conn, error) {
+	if ca, ok := a.(*addr); ok {
+		c, err := t.t.Dial(ca.inner)
+		if err != nil {
+			return nil, err
+		}
+		return t.wrap(c, ca, true), nil
+	}
+
+	c, err := t.t.Dial(a)
+	if err != nil {
+		return nil, err
+	}
+	return t.wrap(c, c.RemoteAddr(), false), nil
+}
+
+func (t *transport) Accept() (net.Conn, error) {
+	c, err := t.t.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return t.wrap(c, c.RemoteAddr(), false), nil
+}
+
+func (t *transport) Close() error {
+	return t.t.Close()
+}
+
+func (t *transport) wrap(c net.Conn, raddr net.Addr, compressing bool) *conn {
+	w := &conn{Conn: c, t: t, raddr: raddr, rbuf: make([]byte, 1500)}
+	if compressing {
+		w.compressing = 1
+	}
+	return w
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	c.mtxRead.Lock()
+	defer c.mtxRead.Unlock()
+
+	for {
+		n, err := c.Conn.Read(c.rbuf)
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			continue
+		}
+
+		switch c.rbuf[0] {
+		case markDeflate:
+			atomic.StoreInt32(&c.compressing, 1)
+			n, err = c.inflate(b, c.rbuf[1:n])
+			if err == errInvalidPacket {
+				continue
+			}
+			return n, err
+
+		case markRaw:
+			atomic.StoreInt32(&c.compressing, 1)
+			if n-1 > len(b) {
+				return 0, io.ErrShortBuffer
+			}
+			return copy(b, c.rbuf[1:n]), nil
+
+		default:
+			if n > len(b) {
+				return 0, io.ErrShortBuffer
+			}
+			return copy(b, c.rbuf[:n]), nil
+		}
+	}
+}
+
+var errInvalidPacket = errors.New("compress: invalid packet")
+
+// inflate decompresses p into b.
+func (c *conn) inflate(b, p []byte) (int, error) {
+	if c.r == nil {
+		c.r = flate.NewReader(bytes.NewReader(p))
+	} else {
+		c.r.(flate.Resetter).Reset(bytes.NewReader(p), nil)
+	}
+
+	n := 0
+	for {
+		m, err := c.r.Read(b[n:])
+		n += m
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return 0, errInvalidPacket
+		}
+		if n == len(b) {
+			// b is full; make sure nothing is left
+			var extra [1]byte
+			if m, _ := c.r.Read(extra[:]); m > 0 {
+				return 0, io.ErrShortBuffer
+			}
+			return n, nil
+		}
+	}
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	if atomic.LoadInt32(&c.compressing) == 0 {
+		return c.Conn.Write(b)
+	}
+
+	if len(b) > maxPacketSize {
+		return 0, io.ErrShortWrite
+	}
+
+	c.mtxWrite.Lock()
+	defer c.mtxWrite.Unlock()
+
+	c.wbuf.Reset()
+	c.wbuf.WriteByte(markDeflate)
+
+	if c.w == nil {
+		w, err := flate.NewWriter(&c.wbuf, c.t.level)
+		if err != nil {
+			return 0, err
+		}
+		c.w = w
+	} else {
+		c.w.Reset(&c.wbuf)
+	}
+
+	c.w.Write(b)
+	c.w.Close()
+
+	p := c.wbuf.Bytes()
+	if len(p) > len(b) {
+		// the packet didn't compress
+		p = append(p[:0], markRaw)
+		p = append(p, b...)
+	}
+
+	_, err := c.Conn.Write(p)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,210 @@
+package compress
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+	"github.com/telehash/gogotelehash/transports"
+	"github.com/telehash/gogotelehash/transports/inproc"
+)
+
+var testPacket = append([]byte{0x00, 0x02, '{', '}'}, bytes.Repeat([]byte(`{"type":"chord","key":"value"}`), 40)...)
+
+func TestCompressed(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := Config{Config: inproc.Config{}}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := Config{Config: inproc.Config{}}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	addrs := B.Addrs()
+	if !assert.Len(addrs, 2) {
+		return
+	}
+	assert.Equal("compress", addrs[0].Network())
+	assert.Equal("inproc", addrs[1].Network())
+
+	c1, c2 := roundTrip(t, A, B, addrs[0], testPacket)
+	if c1 == nil {
+		return
+	}
+	assert.Equal(addrs[0], c1.RemoteAddr())
+
+	// B replies compressed as A sent compressed packets
+	assert.Equal(int32(1), c2.(*conn).compressing)
+	for _, p := range [][]byte{[]byte("x"), testPacket} {
+		_, err = c2.Write(p)
+		assert.NoError(err)
+
+		buf := make([]byte, 1500)
+		n, err := c1.Read(buf)
+		assert.NoError(err)
+		assert.Equal(p, buf[:n])
+	}
+}
+
+func TestOnTheWire(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := Config{Config: inproc.Config{}}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	P, err := inproc.Config{}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer P.Close()
+
+	// a compress address is dialed with compression
+	c, err := A.Dial(&addr{P.Addrs()[0]})
+	if !assert.NoError(err) {
+		return
+	}
+
+	_, err = c.Write(testPacket)
+	assert.NoError(err)
+
+	pc, err := P.Accept()
+	if !assert.NoError(err) {
+		return
+	}
+
+	p := readPacket(t, pc)
+	assert.Equal(byte(markDeflate), p[0])
+	assert.True(len(p) < len(testPacket)/4, "compressed to %d bytes", len(p))
+
+	// packets that don't compress are sent raw
+	_, err = c.Write([]byte("x"))
+	assert.NoError(err)
+	assert.Equal([]byte{markRaw, 'x'}, readPacket(t, pc))
+
+	// peers without compression get plain packets
+	c, err = A.Dial(P.Addrs()[0])
+	if !assert.NoError(err) {
+		return
+	}
+	_, err = c.Write(testPacket)
+	assert.NoError(err)
+	assert.Equal(testPacket, readPacket(t, pc))
+}
+
+func TestPlainPeer(t *testing.T) {
+	assert := assert.New(t)
+
+	P, err := inproc.Config{}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer P.Close()
+
+	B, err := Config{Config: inproc.Config{}}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	_, c2 := roundTrip(t, P, B, B.Addrs()[1], testPacket)
+	if c2 == nil {
+		return
+	}
+	assert.Equal(int32(0), c2.(*conn).compressing)
+
+	// a short buffer is reported
+	c, err := P.Dial(B.Addrs()[1])
+	if assert.NoError(err) {
+		_, err = c.Write(testPacket)
+		assert.NoError(err)
+		_, err = c2.Read(make([]byte, 10))
+		assert.Equal(io.ErrShortBuffer, err)
+	}
+}
+
+func TestAddrJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	inner, err := transports.ResolveAddr("inproc", "42")
+	if !assert.NoError(err) {
+		return
+	}
+
+	data, err := transports.EncodeAddr(&addr{inner})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(`{"type":"compress","alg":"deflate","addr":{"type":"inproc","id":42}}`, string(data))
+
+	b, err := transports.DecodeAddr(data)
+	if assert.NoError(err) {
+		assert.True(transports.EqualAddr(&addr{inner}, b))
+	}
+
+	_, err = transports.DecodeAddr([]byte(`{"type":"compress","alg":"lz4","addr":{"type":"inproc","id":42}}`))
+	assert.Error(err)
+}
+
+func TestAddrURL(t *testing.T) {
+	assert := assert.New(t)
+
+	a, err := transports.ParseAddr("compress://inproc://42")
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal("compress://inproc://42", transports.FormatAddr(a))
+
+	inner, err := transports.ResolveAddr("inproc", "42")
+	if assert.NoError(err) {
+		assert.True(transports.EqualAddr(&addr{inner}, a))
+	}
+
+	_, err = transports.ParseAddr("compress://compress://inproc://42")
+	assert.Error(err)
+}
+
+// roundTrip sends p from A to B and returns both ends of the connection.
+func roundTrip(t *testing.T, A, B transports.Transport, dst net.Addr, p []byte) (c1, c2 net.Conn) {
+	assert := assert.New(t)
+
+	c1, err := A.Dial(dst)
+	if !assert.NoError(err) {
+		return nil, nil
+	}
+
+	_, err = c1.Write(p)
+	assert.NoError(err)
+
+	c2, err = B.Accept()
+	if !assert.NoError(err) {
+		return nil, nil
+	}
+
+	buf := make([]byte, 1500)
+	n, err := c2.Read(buf)
+	assert.NoError(err)
+	assert.Equal(p, buf[:n])
+
+	return c1, c2
+}
+
+// readPacket reads the next packet from c.
+func readPacket(t *testing.T, c net.Conn) []byte {
+	buf := make([]byte, 1500)
+	n, err := c.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf[:n]
+}
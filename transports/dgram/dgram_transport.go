@@ -4,6 +4,7 @@ package dgram
 import (
 	"io"
 	"net"
+	"os"
 	"sync"
 	"time"
 
@@ -26,8 +27,67 @@ type Transport interface {
 	Close() error
 }
 
+// MTUTransport is implemented by datagram transports that discover the path
+// MTU of their destinations.
+type MTUTransport interface {
+	Transport
+
+	// MTU returns the largest packet that can currently be sent to addr.
+	MTU(addr Addr) int
+}
+
+// BatchTransport is implemented by datagram transports that can send several
+// packets to one destination at once.
+type BatchTransport interface {
+	Transport
+
+	// WriteBatch sends pkts to addr and returns the number of packets that
+	// were sent.
+	WriteBatch(pkts [][]byte, addr Addr) (int, error)
+}
+
+// FileTransport is implemented by datagram transports that can pass their
+// sockets to an other process (see transports.FileTransport).
+type FileTransport interface {
+	Transport
+
+	// Files returns duplicates of the sockets of the transport.
+	Files() ([]*os.File, error)
+}
+
+// UnreachableError is returned by Transport.Read when the network reported
+// that Addr can't be reached. The transport must continue to read after the
+// error. The connection to Addr returns transports.ErrUnreachable from Read.
+type UnreachableError struct {
+	Addr Addr
+}
+
+func (e *UnreachableError) Error() string {
+	return "dgram: " + e.Addr.String() + " is unreachable"
+}
+
+// maxPacketSize is the largest datagram the reader accepts.
+const maxPacketSize = 65535
+
+// Options tune the inbound path of a wrapped transport.
+type Options struct {
+	// Readers is the number of goroutines that read from the inner transport.
+	// The Read method of the inner transport must be safe for concurrent use
+	// when Readers is larger than one, and packets of one connection may be
+	// reordered. Defaults to 1.
+	Readers int
+
+	// QueueSize caps the number of received packets that are queued per
+	// connection. Zero means no cap.
+	QueueSize int
+
+	// DropPolicy decides which packet is dropped when a queue is full.
+	DropPolicy transports.DropPolicy
+}
+
 type transport struct {
 	inner Transport
+	opts  Options
 
 	mtx    sync.RWMutex
 	conns  map[interface{}]*connection
@@ -48,15 +108,29 @@ type connection struct {
 }
 
 var (
-	_ transports.Transport = (*transport)(nil)
+	_ transports.BatchWriter   = (*transport)(nil)
+	_ transports.FileTransport = (*transport)(nil)
+	_ transports.MTUConn       = (*connection)(nil)
 )
 
 // Wrap a drgram transport in a stream Transport
 func Wrap(inner Transport) (transports.Transport, error) {
-	t := &transport{inner: inner}
+	return WrapWithOptions(inner, Options{})
+}
+
+// WrapWithOptions wraps a datagram transport like Wrap and tunes its inbound
+// path with opts.
+func WrapWithOptions(inner Transport, opts Options) (transports.Transport, error) {
+	if opts.Readers <= 0 {
+		opts.Readers = 1
+	}
+
+	t := &transport{inner: inner, opts: opts}
 	t.cndAccept = sync.NewCond(&t.mtxAccept)
 
-	go t.reader()
+	for i := 0; i < opts.Readers; i++ {
+		go t.reader()
+	}
 
 	return t, nil
 }
@@ -82,6 +156,15 @@ func (t *transport) Close() error {
 	return err
 }
 
+// Files returns the sockets of the inner transport when it implements
+// FileTransport.
+func (t *transport) Files() ([]*os.File, error) {
+	if f, ok := t.inner.(FileTransport); ok {
+		return f.Files()
+	}
+	return nil, nil
+}
+
 func (t *transport) Dial(addr net.Addr) (net.Conn, error) {
 	daddr, err := t.inner.NormalizeAddr(addr)
 	if err != nil {
@@ -92,6 +175,84 @@ func (t *transport) Dial(addr net.Addr) (net.Conn, error) {
 	return conn, nil
 }
 
+// WriteMessages sends msgs. Runs of messages to the same destination are
+// sent with a single call when the inner transport implements BatchTransport.
+func (t *transport) WriteMessages(msgs []transports.Message) (int, error) {
+	t.mtx.RLock()
+	closed := t.closed
+	t.mtx.RUnlock()
+
+	if closed {
+		return 0, io.EOF
+	}
+
+	var (
+		sent int
+		pkts [][]byte
+	)
+
+	for sent < len(msgs) {
+		addr, err := t.inner.NormalizeAddr(msgs[sent].Addr)
+		if err != nil {
+			return sent, err
+		}
+
+		var (
+			k   = addr.Key()
+			mtu = t.mtu(addr)
+		)
+
+		pkts = pkts[:0]
+		for _, msg := range msgs[sent:] {
+			if len(pkts) > 0 {
+				other, err := t.inner.NormalizeAddr(msg.Addr)
+				if err != nil || other.Key() != k {
+					break
+				}
+			}
+			if len(msg.Data) > mtu {
+				break
+			}
+			pkts = append(pkts, msg.Data)
+		}
+
+		if len(pkts) == 0 {
+			return sent, io.ErrShortWrite
+		}
+
+		n, err := t.writeBatch(pkts, addr)
+		sent += n
+		if err != nil {
+			return sent, err
+		}
+	}
+
+	return sent, nil
+}
+
+func (t *transport) writeBatch(pkts [][]byte, addr Addr) (int, error) {
+	if b, ok := t.inner.(BatchTransport); ok {
+		return b.WriteBatch(pkts, addr)
+	}
+
+	for i, pkt := range pkts {
+		_, err := t.inner.Write(pkt, addr)
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(pkts), nil
+}
+
+// mtu returns the MTU of the path to addr when the inner transport discovers
+// it and transports.DefaultMTU otherwise.
+func (t *transport) mtu(addr Addr) int {
+	if m, ok := t.inner.(MTUTransport); ok {
+		return m.MTU(addr)
+	}
+	return transports.DefaultMTU
+}
+
 func (t *transport) Accept() (net.Conn, error) {
 	t.mtxAccept.Lock()
 	defer t.mtxAccept.Unlock()
@@ -136,6 +297,7 @@ func (t *transport) getConnection(addr Addr) (conn *connection, created bool) {
 			created = true
 			conn = &connection{transport: t, raddr: addr}
 			conn.halfPipe = transportsutil.NewHalfPipe()
+			conn.halfPipe.SetQueueLimit(t.opts.QueueSize, t.opts.DropPolicy)
 			t.conns[k] = conn
 		}
 		t.mtx.Unlock()
@@ -176,10 +338,14 @@ func (t *transport) dropConnection(addr Addr) {
 }
 
 func (t *transport) reader() {
-	var b [1500]byte
+	b := make([]byte, maxPacketSize)
 
 	for {
-		n, addr, err := t.inner.Read(b[:])
+		n, addr, err := t.inner.Read(b)
+		if uerr, ok := err.(*UnreachableError); ok {
+			t.unreachable(uerr.Addr)
+			continue
+		}
 		if err != nil {
 			return
 		}
@@ -208,12 +374,28 @@ func (t *transport) reader() {
 	}
 }
 
+// unreachable reports transports.ErrUnreachable to the connection to addr
+// when there is one.
+func (t *transport) unreachable(addr Addr) {
+	var conn *connection
+
+	t.mtx.RLock()
+	if t.conns != nil {
+		conn = t.conns[addr.Key()]
+	}
+	t.mtx.RUnlock()
+
+	if conn != nil {
+		conn.halfPipe.PushError(transports.ErrUnreachable)
+	}
+}
+
 func (c *connection) Read(b []byte) (n int, err error) {
 	return c.halfPipe.Read(b)
 }
 
 func (c *connection) Write(b []byte) (n int, err error) {
-	if len(b) > 1472 {
+	if len(b) > c.MTU() {
 		return 0, io.ErrShortWrite
 	}
 
@@ -227,6 +409,12 @@ func (c *connection) Write(b []byte) (n int, err error) {
 	return c.transport.inner.Write(b, c.raddr)
 }
 
+// MTU returns the MTU of the path when the transport discovers it and
+// transports.DefaultMTU otherwise.
+func (c *connection) MTU() int {
+	return c.transport.mtu(c.raddr)
+}
+
 func (c *connection) Close() error {
 	c.markAsClosed()
 	c.transport.dropConnection(c.raddr)
@@ -0,0 +1,250 @@
+// Package faulty implements a transport that simulates a bad network.
+//
+// The faulty transport wraps any sub-transport and injects loss, duplication,
+// reordering, latency and jitter into the packets it sends. With a fixed Seed
+// the same sequence of packets always suffers the same faults, so reliability
+// and congestion control can be tested deterministically:
+//
+//	e3x.New(keys, faulty.Config{
+//	  Config:  udp.Config{},
+//	  Loss:    0.05,
+//	  Reorder: 0.1,
+//	  Latency: 40 * time.Millisecond,
+//	  Seed:    1,
+//	})
+//
+// Faults only apply to outgoing packets; wrap the transports of both peers to
+// simulate faults in both directions.
+package faulty
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/telehash/gogotelehash/internal/util/bufpool"
+	"github.com/telehash/gogotelehash/transports"
+)
+
+var (
+	_ transports.Config    = Config{}
+	_ transports.Transport = (*transport)(nil)
+	_ net.Conn             = (*conn)(nil)
+)
+
+// maxHold is the longest time a reordered packet waits for the next packet.
+const maxHold = 100 * time.Millisecond
+
+// Config for the faulty transport. Probabilities range from 0 to 1; the zero
+// value of a fault disables it.
+type Config struct {
+	// The configuration of the sub-transport.
+	Config transports.Config
+
+	// Loss is the probability that a packet is dropped.
+	Loss float64
+
+	// Duplicate is the probability that a packet is sent twice.
+	Duplicate float64
+
+	// Reorder is the probability that a packet is held back and sent after
+	// the next packet on the same connection.
+	Reorder float64
+
+	// Latency delays each packet.
+	Latency time.Duration
+
+	// Jitter adds a random delay in [0, Jitter) to each packet. With Jitter
+	// packets may also be delivered out of order.
+	Jitter time.Duration
+
+	// Seed seeds the random source of the faults so test runs can be
+	// replayed. The zero value uses a random seed.
+	Seed int64
+}
+
+type transport struct {
+	t   transports.Transport
+	cfg Config
+
+	mtxRand sync.Mutex
+	rand    *rand.Rand
+}
+
+type conn struct {
+	net.Conn
+	t *transport
+
+	mtx  sync.Mutex
+	held *bufpool.Buffer
+	hold *time.Timer
+}
+
+// fault is the fate of a single packet.
+type fault struct {
+	drop    bool
+	dup     bool
+	reorder bool
+	delay   time.Duration
+}
+
+// Open opens the sub-transport.
+func (c Config) Open() (transports.Transport, error) {
+	if c.Config == nil {
+		return nil, errors.New("faulty: missing sub-transport")
+	}
+	if !isProbability(c.Loss) || !isProbability(c.Duplicate) || !isProbability(c.Reorder) ||
+		c.Latency < 0 || c.Jitter < 0 {
+		return nil, errors.New("faulty: invalid network simulation parameters")
+	}
+
+	seed := c.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	t, err := c.Config.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	return &transport{t: t, cfg: c, rand: rand.New(rand.NewSource(seed))}, nil
+}
+
+func isProbability(p float64) bool {
+	return p >= 0 && p <= 1
+}
+
+func (t *transport) Addrs() []net.Addr {
+	return t.t.Addrs()
+}
+
+func (t *transport) Dial(addr net.Addr) (net.Conn, error) {
+	c, err := t.t.Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: c, t: t}, nil
+}
+
+func (t *transport) Accept() (net.Conn, error) {
+	c, err := t.t.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: c, t: t}, nil
+}
+
+func (t *transport) Close() error {
+	return t.t.Close()
+}
+
+// next decides the fate of the next packet.
+func (t *transport) next() fault {
+	var (
+		cfg = &t.cfg
+		f   = fault{delay: cfg.Latency}
+	)
+
+	t.mtxRand.Lock()
+	defer t.mtxRand.Unlock()
+
+	// always draw all values so the sequence of faults only depends on the
+	// sequence of packets
+	var (
+		loss    = t.rand.Float64()
+		dup     = t.rand.Float64()
+		reorder = t.rand.Float64()
+		jitter  = t.rand.Int63()
+	)
+
+	f.drop = loss < cfg.Loss
+	f.dup = dup < cfg.Duplicate
+	f.reorder = reorder < cfg.Reorder
+	if cfg.Jitter > 0 {
+		f.delay += time.Duration(jitter % int64(cfg.Jitter))
+	}
+
+	return f
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	f := c.t.next()
+	if f.drop {
+		return len(p), nil
+	}
+
+	buf := bufpool.New().Set(p)
+	if f.dup {
+		c.send(bufpool.New().Set(p), f.delay)
+	}
+
+	c.mtx.Lock()
+	if f.reorder && c.held == nil {
+		c.held = buf
+		c.hold = time.AfterFunc(maxHold, c.flush)
+		c.mtx.Unlock()
+		return len(p), nil
+	}
+	held := c.held
+	c.held = nil
+	if c.hold != nil {
+		c.hold.Stop()
+		c.hold = nil
+	}
+	c.mtx.Unlock()
+
+	c.send(buf, f.delay)
+	if held != nil {
+		c.send(held, f.delay)
+	}
+
+	return len(p), nil
+}
+
+// flush sends the held packet when no packet followed it in time.
+func (c *conn) flush() {
+	c.mtx.Lock()
+	held := c.held
+	c.held = nil
+	c.hold = nil
+	c.mtx.Unlock()
+
+	if held != nil {
+		c.send(held, 0)
+	}
+}
+
+// send writes buf to the sub-connection after delay. Errors are ignored like
+// they would be on a real network.
+func (c *conn) send(buf *bufpool.Buffer, delay time.Duration) {
+	write := func() {
+		c.Conn.Write(buf.RawBytes())
+		buf.Free()
+	}
+
+	if delay > 0 {
+		time.AfterFunc(delay, write)
+	} else {
+		write()
+	}
+}
+
+func (c *conn) Close() error {
+	c.mtx.Lock()
+	held := c.held
+	c.held = nil
+	if c.hold != nil {
+		c.hold.Stop()
+		c.hold = nil
+	}
+	c.mtx.Unlock()
+
+	if held != nil {
+		held.Free()
+	}
+
+	return c.Conn.Close()
+}
@@ -0,0 +1,140 @@
+package faulty
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+	"github.com/telehash/gogotelehash/transports"
+	"github.com/telehash/gogotelehash/transports/inproc"
+)
+
+func TestInvalidConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	var invalid = []Config{
+		{},
+		{Config: inproc.Config{}, Loss: -0.1},
+		{Config: inproc.Config{}, Duplicate: 1.5},
+		{Config: inproc.Config{}, Reorder: 2},
+		{Config: inproc.Config{}, Latency: -time.Second},
+		{Config: inproc.Config{}, Jitter: -time.Second},
+	}
+
+	for _, c := range invalid {
+		_, err := c.Open()
+		assert.Error(err)
+	}
+}
+
+func TestLoss(t *testing.T) {
+	assert := assert.New(t)
+
+	got := sendAll(t, Config{Loss: 0.5, Seed: 1}, 200)
+	assert.True(len(got) > 50 && len(got) < 150, "received %d packets", len(got))
+
+	// the same seed drops the same packets
+	assert.Equal(got, sendAll(t, Config{Loss: 0.5, Seed: 1}, 200))
+}
+
+func TestDuplicate(t *testing.T) {
+	assert := assert.New(t)
+
+	got := sendAll(t, Config{Duplicate: 1, Seed: 1}, 10)
+	if assert.Len(got, 20) {
+		for i := 0; i < 10; i++ {
+			assert.Equal(i, got[2*i])
+			assert.Equal(i, got[2*i+1])
+		}
+	}
+}
+
+func TestReorder(t *testing.T) {
+	assert := assert.New(t)
+
+	got := sendAll(t, Config{Reorder: 1, Seed: 1}, 6)
+	assert.Equal([]int{1, 0, 3, 2, 5, 4}, got)
+
+	// a held packet is sent even when no packet follows
+	got = sendAll(t, Config{Reorder: 1, Seed: 1}, 1)
+	assert.Equal([]int{0}, got)
+}
+
+func TestLatency(t *testing.T) {
+	assert := assert.New(t)
+
+	start := time.Now()
+	got := sendAll(t, Config{Latency: 50 * time.Millisecond, Jitter: 10 * time.Millisecond, Seed: 1}, 1)
+	assert.Equal([]int{0}, got)
+	assert.True(time.Since(start) >= 50*time.Millisecond)
+}
+
+// sendAll sends n numbered packets from A to B through a faulty A and returns
+// the numbers B received.
+func sendAll(t *testing.T, c Config, n int) []int {
+	c.Config = inproc.Config{}
+
+	A, err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer A.Close()
+
+	B, err := inproc.Config{}.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer B.Close()
+
+	conn, err := A.Dial(B.Addrs()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan []int)
+	go func() { done <- receive(B) }()
+
+	for i := 0; i < n; i++ {
+		_, err = conn.Write([]byte(strconv.Itoa(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return <-done
+}
+
+// receive reads packets until none arrives for a while.
+func receive(tr transports.Transport) []int {
+	var (
+		got  []int
+		conn net.Conn
+		buf  = make([]byte, 1500)
+	)
+
+	cAccept := make(chan net.Conn, 1)
+	go func() {
+		c, err := tr.Accept()
+		if err == nil {
+			cAccept <- c
+		}
+	}()
+
+	select {
+	case conn = <-cAccept:
+	case <-time.After(500 * time.Millisecond):
+		return nil
+	}
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, err := conn.Read(buf)
+		if err != nil {
+			return got
+		}
+		i, _ := strconv.Atoi(string(buf[:n]))
+		got = append(got, i)
+	}
+}
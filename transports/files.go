@@ -0,0 +1,24 @@
+package transports
+
+import (
+	"os"
+)
+
+// FileTransport is implemented by transports that can pass their sockets to
+// an other process (see package handover).
+type FileTransport interface {
+	Transport
+
+	// Files returns duplicates of the sockets of the transport. The caller
+	// must close the files.
+	Files() ([]*os.File, error)
+}
+
+// TransportFiles returns the sockets of t when t implements FileTransport and
+// nil otherwise.
+func TransportFiles(t Transport) ([]*os.File, error) {
+	if f, ok := t.(FileTransport); ok {
+		return f.Files()
+	}
+	return nil, nil
+}
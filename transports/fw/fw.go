@@ -12,10 +12,14 @@ var (
 	_ transports.Transport = (*firewall)(nil)
 )
 
-// Config for the fw transport.
+// Config for the fw transport. The rules apply to the sources of inbound
+// connections and the destinations of outbound connections. A connection is
+// permitted when Allow matches (a nil Allow matches everything) and Deny
+// doesn't match.
 type Config struct {
 	Config transports.Config // the sub-transport configuration
 	Allow  Rule              // the firewall rule.
+	Deny   Rule              // addresses that are blocked even when allowed.
 }
 
 // Rule must be implemented by rule objects.
@@ -36,7 +40,15 @@ func (c Config) Open() (transports.Transport, error) {
 		return nil, err
 	}
 
-	return &firewall{t, c.Allow}, nil
+	rule := c.Allow
+	if c.Deny != nil {
+		if rule == nil {
+			rule = All
+		}
+		rule = WhenAll(rule, Negate(c.Deny))
+	}
+
+	return &firewall{t, rule}, nil
 }
 
 func (fw *firewall) Addrs() []net.Addr {
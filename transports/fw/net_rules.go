@@ -0,0 +1,179 @@
+package fw
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ParseRule parses address specifications into a rule that matches when any
+// of them matches the IP and port of an address. A specification is an IP or
+// a CIDR network, optionally followed by a port or a port range; a bare port
+// (range) matches any IP:
+//
+//   10.0.0.0/8
+//   192.168.1.5:42424
+//   [2001:db8::]/32:1000-2000
+//   :53
+//
+// Addresses without an IP and port (for example inproc addresses) never
+// match.
+//
+//   fw.Config{
+//     Config: udp.Config{},
+//     Allow:  fw.MustParseRule("10.0.0.0/8", "172.16.0.0/12"),
+//     Deny:   fw.MustParseRule("10.66.0.0/16"),
+//   }
+func ParseRule(specs ...string) (Rule, error) {
+	rules := make([]Rule, 0, len(specs))
+
+	for _, spec := range specs {
+		r, err := parseNetRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+
+	return WhenAny(rules...), nil
+}
+
+// MustParseRule is like ParseRule but panics when a specification is invalid.
+func MustParseRule(specs ...string) Rule {
+	r, err := ParseRule(specs...)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// netRule matches addresses in network (nil for any IP) with a port in
+// [minPort, maxPort] (0 for any port).
+type netRule struct {
+	network          *net.IPNet
+	minPort, maxPort int
+}
+
+func parseNetRule(spec string) (*netRule, error) {
+	var (
+		r       = &netRule{}
+		host    = spec
+		portStr string
+		hasPort bool
+	)
+
+	invalid := func() (*netRule, error) {
+		return nil, errors.New("fw: invalid address specification " + strconv.Quote(spec))
+	}
+
+	switch {
+	case strings.HasPrefix(spec, "["):
+		end := strings.Index(spec, "]")
+		if end < 0 {
+			return invalid()
+		}
+		host = spec[1:end]
+		rest := spec[end+1:]
+		if strings.HasPrefix(rest, "/") {
+			// [2001:db8::]/32:1000-2000
+			if i := strings.Index(rest, ":"); i >= 0 {
+				host += rest[:i]
+				portStr, hasPort = rest[i+1:], true
+			} else {
+				host += rest
+			}
+		} else if strings.HasPrefix(rest, ":") {
+			portStr, hasPort = rest[1:], true
+		} else if rest != "" {
+			return invalid()
+		}
+
+	case strings.Count(spec, ":") == 1:
+		i := strings.Index(spec, ":")
+		host, portStr, hasPort = spec[:i], spec[i+1:], true
+	}
+
+	if host != "" {
+		if !strings.Contains(host, "/") {
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return invalid()
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			host = ip.String() + "/" + strconv.Itoa(bits)
+		}
+
+		_, network, err := net.ParseCIDR(host)
+		if err != nil {
+			return invalid()
+		}
+		r.network = network
+	}
+
+	if hasPort {
+		lo, hi := portStr, portStr
+		if i := strings.Index(portStr, "-"); i >= 0 {
+			lo, hi = portStr[:i], portStr[i+1:]
+		}
+
+		var err1, err2 error
+		r.minPort, err1 = strconv.Atoi(lo)
+		r.maxPort, err2 = strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || r.minPort < 1 || r.maxPort > 65535 || r.minPort > r.maxPort {
+			return invalid()
+		}
+	}
+
+	if r.network == nil && r.minPort == 0 {
+		return invalid()
+	}
+
+	return r, nil
+}
+
+func (r *netRule) Match(addr net.Addr) bool {
+	ip, port, ok := ipPort(addr)
+	if !ok {
+		return false
+	}
+
+	if r.network != nil && !r.network.Contains(ip) {
+		return false
+	}
+
+	if r.minPort > 0 && (port < r.minPort || port > r.maxPort) {
+		return false
+	}
+
+	return true
+}
+
+// ipPort returns the IP and port of addr.
+func ipPort(addr net.Addr) (net.IP, int, bool) {
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		return a.IP, a.Port, true
+	case *net.TCPAddr:
+		return a.IP, a.Port, true
+	case interface {
+		InternalAddr() (proto string, ip net.IP, port int)
+	}:
+		_, ip, port := a.InternalAddr()
+		return ip, port, ip != nil
+	}
+
+	host, portStr, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil, 0, false
+	}
+	ip := net.ParseIP(host)
+	port, err := strconv.Atoi(portStr)
+	if ip == nil || err != nil {
+		return nil, 0, false
+	}
+	return ip, port, true
+}
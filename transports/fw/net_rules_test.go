@@ -0,0 +1,95 @@
+package fw
+
+import (
+	"net"
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+	"github.com/telehash/gogotelehash/transports/udp"
+)
+
+func TestParseRule(t *testing.T) {
+	assert := assert.New(t)
+
+	var tests = []struct {
+		spec  string
+		addr  string
+		match bool
+	}{
+		{"10.0.0.0/8", "10.1.2.3:42", true},
+		{"10.0.0.0/8", "11.1.2.3:42", false},
+		{"192.168.1.5", "192.168.1.5:1", true},
+		{"192.168.1.5", "192.168.1.6:1", false},
+		{"192.168.1.5:42424", "192.168.1.5:42424", true},
+		{"192.168.1.5:42424", "192.168.1.5:42425", false},
+		{"10.0.0.0/8:1000-2000", "10.0.0.1:1500", true},
+		{"10.0.0.0/8:1000-2000", "10.0.0.1:2001", false},
+		{":53", "8.8.8.8:53", true},
+		{":53", "[2001:db8::1]:53", true},
+		{":53", "8.8.8.8:54", false},
+		{"2001:db8::/32", "[2001:db8::1]:80", true},
+		{"[2001:db8::]/32:80", "[2001:db8::1]:80", true},
+		{"[2001:db8::]/32:80", "[2001:db8::1]:81", false},
+		{"[2001:db8::1]:80", "[2001:db8::1]:80", true},
+		{"[2001:db8::1]:80", "[2001:db8::2]:80", false},
+	}
+
+	for _, test := range tests {
+		r, err := ParseRule(test.spec)
+		if !assert.NoError(err, test.spec) {
+			continue
+		}
+
+		addr, err := net.ResolveUDPAddr("udp", test.addr)
+		if !assert.NoError(err, test.addr) {
+			continue
+		}
+
+		assert.Equal(test.match, r.Match(addr), "%s %s", test.spec, test.addr)
+	}
+
+	var invalid = []string{"", "example.com", "10.0.0.0/33", ":0", ":70000", ":20-10", "10.0.0.1:", "[::1", "[::1]x"}
+	for _, spec := range invalid {
+		_, err := ParseRule(spec)
+		assert.Error(err, spec)
+	}
+}
+
+func TestAllowDeny(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := Config{
+		Config: udp.Config{Addr: "127.0.0.1:0"},
+		Allow:  MustParseRule("127.0.0.0/8"),
+		Deny:   MustParseRule("127.0.0.2"),
+	}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	_, err = A.Dial(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4242})
+	assert.NoError(err)
+
+	_, err = A.Dial(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 4242})
+	assert.Error(err)
+
+	_, err = A.Dial(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 4242})
+	assert.Error(err)
+
+	// Deny without Allow
+	B, err := Config{
+		Config: udp.Config{Addr: "127.0.0.1:0"},
+		Deny:   MustParseRule(":4242"),
+	}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	_, err = B.Dial(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4242})
+	assert.Error(err)
+
+	_, err = B.Dial(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4243})
+	assert.NoError(err)
+}
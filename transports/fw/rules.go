@@ -43,7 +43,7 @@ func Negate(r Rule) Rule {
 
 type negateRule struct{ Rule }
 
-func (r *negateRule) Allow(src net.Addr) bool { return !r.Rule.Match(src) }
+func (r *negateRule) Match(src net.Addr) bool { return !r.Rule.Match(src) }
 
 // WhenAll matches when all rules Match
 func WhenAll(rules ...Rule) Rule {
@@ -0,0 +1,176 @@
+// Package handover passes the sockets of a running process to its successor,
+// so that a binary can be upgraded without closing its ports. Peers keep
+// using the same addresses and the new process answers on the paths they
+// already know.
+//
+// The old process starts the new process with the sockets of its transport
+// and closes its endpoint once the new process is running (until then either
+// process may receive a packet):
+//
+//   cmd := exec.Command(os.Args[0], os.Args[1:]...)
+//   err := handover.Prepare(cmd, transport)
+//   err = cmd.Start()
+//
+// The UDP and TCP transports of the new process adopt an inherited socket
+// instead of binding a new one when their Config binds the same address and
+// port. Sockets bound to a random port (":0") can't be handed over.
+//
+// Handover is only supported on Unix.
+package handover
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/telehash/gogotelehash/transports"
+)
+
+// EnvVar lists the file descriptors of the inherited sockets.
+const EnvVar = "TELEHASH_HANDOVER"
+
+// ErrNoSockets is returned by Prepare when the transport has no sockets that
+// can be handed over.
+var ErrNoSockets = errors.New("handover: transport has no sockets")
+
+var (
+	mtx       sync.Mutex
+	inherited []*os.File
+)
+
+// Prepare adds the sockets of t to the files that are inherited by cmd. The
+// caller should close the files in cmd.ExtraFiles after cmd was started.
+func Prepare(cmd *exec.Cmd, t transports.Transport) error {
+	files, err := transports.TransportFiles(t)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return ErrNoSockets
+	}
+
+	fds := make([]string, len(files))
+	for i := range files {
+		// the child receives ExtraFiles from fd 3 onwards
+		fds[i] = strconv.Itoa(3 + len(cmd.ExtraFiles) + i)
+	}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, files...)
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, EnvVar+"="+strings.Join(fds, ","))
+
+	return nil
+}
+
+// UDPConn returns the inherited UDP socket that is bound to addr or nil when
+// there is none. The socket is adopted by the caller.
+func UDPConn(network string, addr *net.UDPAddr) *net.UDPConn {
+	if addr == nil || addr.Port == 0 {
+		return nil
+	}
+
+	conn := adopt(func(f *os.File) (io.Closer, net.Addr, error) {
+		c, err := net.FilePacketConn(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		return c, c.LocalAddr(), nil
+	}, func(a net.Addr) bool {
+		b, ok := a.(*net.UDPAddr)
+		return ok && b.Port == addr.Port && matchIP(network, addr.IP, b.IP)
+	})
+
+	c, _ := conn.(*net.UDPConn)
+	return c
+}
+
+// TCPListener returns the inherited TCP listener that is bound to addr or nil
+// when there is none. The listener is adopted by the caller.
+func TCPListener(network string, addr *net.TCPAddr) *net.TCPListener {
+	if addr == nil || addr.Port == 0 {
+		return nil
+	}
+
+	l := adopt(func(f *os.File) (io.Closer, net.Addr, error) {
+		l, err := net.FileListener(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		return l, l.Addr(), nil
+	}, func(a net.Addr) bool {
+		b, ok := a.(*net.TCPAddr)
+		return ok && b.Port == addr.Port && matchIP(network, addr.IP, b.IP)
+	})
+
+	tl, _ := l.(*net.TCPListener)
+	return tl
+}
+
+// adopt returns the first inherited socket that open accepts and whose
+// address matches.
+func adopt(open func(*os.File) (io.Closer, net.Addr, error), match func(net.Addr) bool) io.Closer {
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	load()
+
+	for i, f := range inherited {
+		c, addr, err := open(f)
+		if err != nil {
+			continue
+		}
+
+		if !match(addr) {
+			c.Close()
+			continue
+		}
+
+		// c holds a duplicate of the descriptor
+		f.Close()
+		inherited = append(inherited[:i], inherited[i+1:]...)
+		return c
+	}
+
+	return nil
+}
+
+// load takes the inherited sockets that are listed in EnvVar. The variable
+// is cleared so that the sockets are not passed on to child processes.
+func load() {
+	env := os.Getenv(EnvVar)
+	if env == "" {
+		return
+	}
+	os.Unsetenv(EnvVar)
+
+	for _, s := range strings.Split(env, ",") {
+		fd, err := strconv.Atoi(s)
+		if err != nil || fd < 3 {
+			continue
+		}
+		inherited = append(inherited, os.NewFile(uintptr(fd), "handover"))
+	}
+}
+
+// matchIP reports if a socket bound to ip matches the requested ip on
+// network. An unspecified ip only matches the wildcard address of the
+// network's family.
+func matchIP(network string, want, ip net.IP) bool {
+	if want != nil && !want.IsUnspecified() {
+		return want.Equal(ip)
+	}
+	if !ip.IsUnspecified() {
+		return false
+	}
+	if strings.HasSuffix(network, "4") {
+		return ip.To4() != nil
+	}
+	return ip.To4() == nil
+}
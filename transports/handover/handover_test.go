@@ -0,0 +1,33 @@
+package handover
+
+import (
+	"net"
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+)
+
+func TestMatchIP(t *testing.T) {
+	assert := assert.New(t)
+
+	var tab = []struct {
+		network string
+		want    net.IP
+		ip      net.IP
+		match   bool
+	}{
+		{"udp4", nil, net.IPv4zero, true},
+		{"udp4", nil, net.IPv6unspecified, false},
+		{"udp6", nil, net.IPv6unspecified, true},
+		{"udp", nil, net.IPv6unspecified, true},
+		{"tcp4", net.IPv4zero, net.IPv4zero, true},
+		{"udp4", nil, net.IPv4(127, 0, 0, 1), false},
+		{"udp4", net.IPv4(127, 0, 0, 1), net.IPv4(127, 0, 0, 1), true},
+		{"udp4", net.IPv4(127, 0, 0, 1), net.IPv4(127, 0, 0, 2), false},
+		{"tcp6", net.IPv6loopback, net.IPv6loopback, true},
+	}
+
+	for _, row := range tab {
+		assert.Equal(row.match, matchIP(row.network, row.want, row.ip), "%s %s %s", row.network, row.want, row.ip)
+	}
+}
@@ -1,12 +1,21 @@
-// Package inproc implements the in-process transport
+// Package inproc implements the in-process transport.
+//
+// Endpoints in the same process exchange packets through channels, so tests
+// and simulations don't need to bind real ports. The transport can simulate
+// a bad network with latency, jitter and packet loss:
+//
+//	e3x.New(keys, inproc.Config{Latency: 50 * time.Millisecond, Loss: 0.1})
 package inproc
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
+	"math/rand"
 	"net"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/telehash/gogotelehash/internal/util/bufpool"
 	"github.com/telehash/gogotelehash/transports"
@@ -26,10 +35,26 @@ func init() {
 	})
 }
 
-// Config for the inproc transport. There are no configuration options for now.
+// Config for the inproc transport. The zero value delivers packets
+// immediately and never drops them.
 //
 //   e3x.New(keys, inproc.Config{})
+//
+// Latency, Jitter and Loss apply to the packets sent by the transport. With
+// Jitter packets may be delivered out of order.
 type Config struct {
+	// Latency delays the delivery of each packet.
+	Latency time.Duration
+
+	// Jitter adds a random delay in [0, Jitter) to the delivery of each packet.
+	Jitter time.Duration
+
+	// Loss is the probability (0 to 1) that a packet is dropped.
+	Loss float64
+
+	// Seed seeds the random source of Jitter and Loss so simulations can be
+	// replayed. The zero value uses a random seed.
+	Seed int64
 }
 
 type inprocAddr struct {
@@ -37,8 +62,14 @@ type inprocAddr struct {
 }
 
 type transport struct {
-	laddr *inprocAddr
-	c     chan packet
+	laddr   *inprocAddr
+	c       chan packet
+	latency time.Duration
+	jitter  time.Duration
+	loss    float64
+
+	mtxRand sync.Mutex
+	rand    *rand.Rand
 }
 
 type packet struct {
@@ -60,9 +91,25 @@ var (
 
 // Open opens the transport.
 func (c Config) Open() (transports.Transport, error) {
+	if c.Latency < 0 || c.Jitter < 0 || c.Loss < 0 || c.Loss > 1 {
+		return nil, errors.New("inproc: invalid network simulation parameters")
+	}
+
+	seed := c.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
 	mtx.Lock()
 	id := netxID
-	t := &transport{&inprocAddr{id}, make(chan packet, 10)}
+	t := &transport{
+		laddr:   &inprocAddr{id},
+		c:       make(chan packet, 10),
+		latency: c.Latency,
+		jitter:  c.Jitter,
+		loss:    c.Loss,
+		rand:    rand.New(rand.NewSource(seed)),
+	}
 	netxID++
 	pipes[id] = t
 	mtx.Unlock()
@@ -104,16 +151,54 @@ func (t *transport) Write(p []byte, dst dgram.Addr) (int, error) {
 		return 0, nil // drop
 	}
 
-	buf := bufpool.New().Set(p)
+	drop, delay := t.simulate()
+	if drop {
+		return len(p), nil
+	}
+
+	pkt := packet{t.laddr, bufpool.New().Set(p)}
 
-	func() {
-		defer func() { recover() }()
-		dstT.c <- packet{t.laddr, buf}
-	}()
+	if delay > 0 {
+		time.AfterFunc(delay, func() { dstT.deliver(pkt) })
+	} else {
+		dstT.deliver(pkt)
+	}
 
 	return len(p), nil
 }
 
+// simulate decides if the next packet is dropped and how long its delivery is
+// delayed.
+func (t *transport) simulate() (drop bool, delay time.Duration) {
+	if t.loss == 0 && t.jitter == 0 {
+		return false, t.latency
+	}
+
+	t.mtxRand.Lock()
+	defer t.mtxRand.Unlock()
+
+	if t.loss > 0 && t.rand.Float64() < t.loss {
+		return true, 0
+	}
+
+	delay = t.latency
+	if t.jitter > 0 {
+		delay += time.Duration(t.rand.Int63n(int64(t.jitter)))
+	}
+
+	return false, delay
+}
+
+func (t *transport) deliver(pkt packet) {
+	defer func() {
+		if recover() != nil {
+			// the transport was closed
+			pkt.buf.Free()
+		}
+	}()
+	t.c <- pkt
+}
+
 func (t *transport) Addrs() []net.Addr {
 	return []net.Addr{t.laddr}
 }
@@ -139,6 +224,10 @@ func (a *inprocAddr) String() string {
 	return string(data)
 }
 
+func (a *inprocAddr) URL() string {
+	return "inproc://" + strconv.FormatUint(uint64(a.id), 10)
+}
+
 func (a *inprocAddr) MarshalJSON() ([]byte, error) {
 	var desc = struct {
 		Type string `json:"type"`
@@ -2,8 +2,10 @@ package inproc
 
 import (
 	"bytes"
+	"math/rand"
 	"net"
 	"testing"
+	"time"
 )
 
 func Benchmark(b *testing.B) {
@@ -72,3 +74,111 @@ func Benchmark(b *testing.B) {
 		}
 	}
 }
+
+func TestLatency(t *testing.T) {
+	A, err := Config{Latency: 50 * time.Millisecond}.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer A.Close()
+
+	B, err := Config{}.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer B.Close()
+
+	w, err := A.Dial(B.Addrs()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = w.Write([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := B.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out [1500]byte
+	n, err := r.Read(out[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(out[:n]) != "hello" {
+		t.Fatalf("invalid message")
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Fatalf("expected a delay of at least 50ms (delay=%s)", d)
+	}
+}
+
+func TestLoss(t *testing.T) {
+	A, err := Config{Loss: 1}.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer A.Close()
+
+	B, err := Config{}.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer B.Close()
+
+	w, err := A.Dial(B.Addrs()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		_, err = w.Write([]byte("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	accepted := make(chan struct{})
+	go func() {
+		if _, err := B.Accept(); err == nil {
+			close(accepted)
+		}
+	}()
+
+	select {
+	case <-accepted:
+		t.Fatal("expected all packets to be dropped")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSimulateSeed(t *testing.T) {
+	var (
+		a = &transport{loss: 0.5, jitter: time.Second, rand: rand.New(rand.NewSource(1))}
+		b = &transport{loss: 0.5, jitter: time.Second, rand: rand.New(rand.NewSource(1))}
+
+		dropped int
+	)
+
+	for i := 0; i < 1000; i++ {
+		dropA, delayA := a.simulate()
+		dropB, delayB := b.simulate()
+		if dropA != dropB || delayA != delayB {
+			t.Fatal("expected the same seed to produce the same simulation")
+		}
+		if dropA {
+			dropped++
+		} else if delayA < 0 || delayA >= time.Second {
+			t.Fatalf("invalid delay %s", delayA)
+		}
+	}
+
+	if dropped < 400 || dropped > 600 {
+		t.Fatalf("expected about half of the packets to be dropped (dropped=%d)", dropped)
+	}
+}
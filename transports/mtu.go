@@ -0,0 +1,26 @@
+package transports
+
+import (
+	"net"
+)
+
+// DefaultMTU is the largest packet a connection accepts unless it knows the
+// MTU of its path (see MTUConn).
+const DefaultMTU = 1472
+
+// MTUConn is implemented by connections that discover the MTU of their path.
+type MTUConn interface {
+	net.Conn
+
+	// MTU returns the largest packet that can currently be written.
+	MTU() int
+}
+
+// ConnMTU returns the largest packet that can be written to conn.
+// Connections that don't implement MTUConn accept DefaultMTU bytes.
+func ConnMTU(conn net.Conn) int {
+	if c, ok := conn.(MTUConn); ok {
+		return c.MTU()
+	}
+	return DefaultMTU
+}
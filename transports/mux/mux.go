@@ -0,0 +1,85 @@
+package mux
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/telehash/gogotelehash/transports"
+)
+
+var (
+	ErrClosed           = errors.New("mux: transport is closed")
+	ErrNotOpened        = errors.New("mux: transport is not opened")
+	ErrUnknownTransport = errors.New("mux: unknown sub-transport")
+)
+
+var _ transports.Config = (*Mux)(nil)
+
+// Mux is a transport muxer whose sub-transports can be added and removed while
+// it is open. Connections are accepted from the other sub-transports without
+// interruption and Addrs reflects the change immediately.
+//
+//   m := mux.New(udp.Config{})
+//   e3x.New(keys, m)
+//
+//   // enable the TCP fallback on demand
+//   tcpTransport, err := m.Add(tcp.Config{})
+//   ...
+//   err = m.Remove(tcpTransport)
+type Mux struct {
+	mtx     sync.Mutex
+	configs []transports.Config
+	t       *transport
+}
+
+// New returns a Mux with the initial sub-transport configurations.
+func New(configs ...transports.Config) *Mux {
+	return &Mux{configs: configs}
+}
+
+// Open opens the initial sub-transports. A Mux can only be opened once.
+func (m *Mux) Open() (transports.Transport, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.t != nil {
+		return nil, errors.New("mux: already opened")
+	}
+
+	t, err := open(m.configs)
+	if err != nil {
+		return nil, err
+	}
+
+	m.t = t
+	return t, nil
+}
+
+// Add opens a sub-transport and attaches it to the open Mux. The returned
+// sub-transport identifies it for Remove.
+func (m *Mux) Add(c transports.Config) (transports.Transport, error) {
+	t, err := m.opened()
+	if err != nil {
+		return nil, err
+	}
+	return t.add(c)
+}
+
+// Remove detaches and closes a sub-transport that was returned by Add.
+func (m *Mux) Remove(s transports.Transport) error {
+	t, err := m.opened()
+	if err != nil {
+		return err
+	}
+	return t.remove(s)
+}
+
+func (m *Mux) opened() (*transport, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.t == nil {
+		return nil, ErrNotOpened
+	}
+	return m.t, nil
+}
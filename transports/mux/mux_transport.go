@@ -7,6 +7,7 @@ package mux
 import (
 	"io"
 	"net"
+	"os"
 	"sync"
 	"time"
 
@@ -14,8 +15,9 @@ import (
 )
 
 var (
-	_ transports.Config    = Config{}
-	_ transports.Transport = (*transport)(nil)
+	_ transports.Config        = Config{}
+	_ transports.BatchWriter   = (*transport)(nil)
+	_ transports.FileTransport = (*transport)(nil)
 )
 
 // Config is a list of sub-transport configurations.
@@ -29,19 +31,31 @@ var (
 type Config []transports.Config
 
 type transport struct {
+	cAccept chan net.Conn
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	mtx        sync.RWMutex
+	closed     bool
 	transports []transports.Transport
-	cAccept    chan net.Conn
-	wg         sync.WaitGroup
 }
 
 // Open opens the sub-transports.
 func (c Config) Open() (transports.Transport, error) {
+	return open(c)
+}
+
+func open(configs []transports.Config) (*transport, error) {
 	t := &transport{}
 	t.cAccept = make(chan net.Conn)
+	t.done = make(chan struct{})
 
-	for _, f := range c {
+	for _, f := range configs {
 		s, err := f.Open()
 		if err != nil {
+			for _, s := range t.transports {
+				s.Close()
+			}
 			return nil, err
 		}
 
@@ -56,10 +70,17 @@ func (c Config) Open() (transports.Transport, error) {
 	return t, nil
 }
 
+// subTransports returns a snapshot of the sub-transports.
+func (t *transport) subTransports() []transports.Transport {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+	return t.transports
+}
+
 func (t *transport) Addrs() []net.Addr {
 	var addrs []net.Addr
 
-	for _, s := range t.transports {
+	for _, s := range t.subTransports() {
 		addrs = append(addrs, s.Addrs()...)
 	}
 
@@ -67,7 +88,7 @@ func (t *transport) Addrs() []net.Addr {
 }
 
 func (t *transport) Dial(addr net.Addr) (net.Conn, error) {
-	for _, s := range t.transports {
+	for _, s := range t.subTransports() {
 		conn, err := s.Dial(addr)
 		if err == transports.ErrInvalidAddr {
 			continue
@@ -80,18 +101,85 @@ func (t *transport) Dial(addr net.Addr) (net.Conn, error) {
 	return nil, transports.ErrInvalidAddr
 }
 
+// WriteMessages sends msgs over the sub-transports that can send batches (see
+// transports.BatchWriter). Each message is sent by the first sub-transport
+// that accepts its destination.
+func (t *transport) WriteMessages(msgs []transports.Message) (int, error) {
+	var (
+		subs = t.subTransports()
+		sent = 0
+	)
+
+	for sent < len(msgs) {
+		n, err := writeMessages(subs, msgs[sent:])
+		sent += n
+		if err != nil {
+			return sent, err
+		}
+	}
+
+	return sent, nil
+}
+
+// writeMessages sends a prefix of msgs with the first sub-transport that
+// accepts the destination of msgs[0].
+func writeMessages(subs []transports.Transport, msgs []transports.Message) (int, error) {
+	for _, s := range subs {
+		n, err := transports.WriteMessages(s, msgs)
+		if err == transports.ErrInvalidAddr {
+			if n > 0 {
+				// the remaining messages may belong to an other sub-transport
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+	return 0, transports.ErrInvalidAddr
+}
+
+// Files returns the sockets of the sub-transports (see package handover).
+func (t *transport) Files() ([]*os.File, error) {
+	var files []*os.File
+
+	for _, s := range t.subTransports() {
+		f, err := transports.TransportFiles(s)
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, err
+		}
+		files = append(files, f...)
+	}
+
+	return files, nil
+}
+
 func (t *transport) Accept() (c net.Conn, err error) {
-	conn, ok := <-t.cAccept
-	if !ok {
+	select {
+	case conn := <-t.cAccept:
+		return conn, nil
+	case <-t.done:
 		return nil, io.EOF
 	}
-	return conn, nil
 }
 
 func (m *transport) Close() error {
 	var lastErr error
 
-	for _, t := range m.transports {
+	m.mtx.Lock()
+	if m.closed {
+		m.mtx.Unlock()
+		return nil
+	}
+	m.closed = true
+	subs := m.transports
+	m.transports = nil
+	close(m.done)
+	m.mtx.Unlock()
+
+	for _, t := range subs {
 		err := t.Close()
 		if err != nil {
 			lastErr = err
@@ -99,11 +187,57 @@ func (m *transport) Close() error {
 	}
 
 	m.wg.Wait()
-	close(m.cAccept)
 
 	return lastErr
 }
 
+// add opens c and attaches it.
+func (t *transport) add(c transports.Config) (transports.Transport, error) {
+	s, err := c.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	t.mtx.Lock()
+	if t.closed {
+		t.mtx.Unlock()
+		s.Close()
+		return nil, ErrClosed
+	}
+	// copy on write; snapshots may still be in use
+	subs := make([]transports.Transport, len(t.transports), len(t.transports)+1)
+	copy(subs, t.transports)
+	t.transports = append(subs, s)
+	t.wg.Add(1)
+	t.mtx.Unlock()
+
+	go t.runAccepter(s)
+	return s, nil
+}
+
+// remove detaches and closes s.
+func (t *transport) remove(s transports.Transport) error {
+	t.mtx.Lock()
+	idx := -1
+	for i, x := range t.transports {
+		if x == s {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		t.mtx.Unlock()
+		return ErrUnknownTransport
+	}
+	subs := make([]transports.Transport, 0, len(t.transports)-1)
+	subs = append(subs, t.transports[:idx]...)
+	subs = append(subs, t.transports[idx+1:]...)
+	t.transports = subs
+	t.mtx.Unlock()
+
+	return s.Close()
+}
+
 func (t *transport) runAccepter(s transports.Transport) {
 	defer t.wg.Done()
 	for {
@@ -119,6 +253,11 @@ func (t *transport) runAccepter(s transports.Transport) {
 			return
 		}
 
-		t.cAccept <- conn
+		select {
+		case t.cAccept <- conn:
+		case <-t.done:
+			conn.Close()
+			return
+		}
 	}
 }
@@ -2,12 +2,14 @@ package mux
 
 import (
 	"bytes"
+	"io"
 	"net"
 	"testing"
 
 	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
 
 	"github.com/telehash/gogotelehash/transports"
+	"github.com/telehash/gogotelehash/transports/tcp"
 	"github.com/telehash/gogotelehash/transports/udp"
 )
 
@@ -46,6 +48,95 @@ func TestManagerWithOneTransport(t *testing.T) {
 	}
 }
 
+func TestMuxAddRemove(t *testing.T) {
+	assert := assert.New(t)
+
+	m := New(udp.Config{Addr: "127.0.0.1:0"})
+
+	_, err := m.Add(tcp.Config{})
+	assert.Equal(ErrNotOpened, err)
+
+	tr, err := m.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer tr.Close()
+
+	_, err = m.Open()
+	assert.Error(err)
+	assert.Len(tr.Addrs(), 1)
+
+	B, err := tcp.Config{Addr: "127.0.0.1:0"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	// TCP can't be dialed before it is added
+	_, err = tr.Dial(B.Addrs()[0])
+	assert.Equal(transports.ErrInvalidAddr, err)
+
+	s, err := m.Add(tcp.Config{Addr: "127.0.0.1:0"})
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Len(tr.Addrs(), 2)
+
+	c1, err := tr.Dial(B.Addrs()[0])
+	if assert.NoError(err) {
+		c1.Close()
+	}
+
+	// connections are accepted from the added transport
+	c2, err := B.Dial(s.Addrs()[0])
+	if assert.NoError(err) {
+		_, err = c2.Write([]byte("hello"))
+		assert.NoError(err)
+
+		c3, err := tr.Accept()
+		if assert.NoError(err) {
+			buf := make([]byte, 1500)
+			n, err := c3.Read(buf)
+			assert.NoError(err)
+			assert.Equal("hello", string(buf[:n]))
+			c3.Close()
+		}
+		c2.Close()
+	}
+
+	assert.NoError(m.Remove(s))
+	assert.Equal(ErrUnknownTransport, m.Remove(s))
+	assert.Len(tr.Addrs(), 1)
+
+	_, err = tr.Dial(B.Addrs()[0])
+	assert.Equal(transports.ErrInvalidAddr, err)
+
+	// the remaining transport still works
+	U, err := udp.Config{Addr: "127.0.0.1:0"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer U.Close()
+
+	c4, err := U.Dial(tr.Addrs()[0])
+	if assert.NoError(err) {
+		_, err = c4.Write([]byte("world"))
+		assert.NoError(err)
+
+		c5, err := tr.Accept()
+		if assert.NoError(err) {
+			assert.Equal("udp4", c5.RemoteAddr().Network())
+		}
+	}
+
+	assert.NoError(tr.Close())
+	_, err = m.Add(tcp.Config{})
+	assert.Equal(ErrClosed, err)
+
+	_, err = tr.Accept()
+	assert.Equal(io.EOF, err)
+}
+
 func Benchmark(b *testing.B) {
 	A, err := Config{udp.Config{}}.Open()
 	if err != nil {
@@ -118,3 +209,80 @@ func Benchmark(b *testing.B) {
 		}
 	}
 }
+
+func TestWeighted(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := Config{
+		Weighted{Weight: 10, Config: udp.Config{Addr: "127.0.0.1:0"}},
+		tcp.Config{Addr: "127.0.0.1:0"},
+	}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	addrs := A.Addrs()
+	if !assert.Len(addrs, 2) {
+		return
+	}
+
+	c, err := A.Dial(addrs[0])
+	if assert.NoError(err) {
+		assert.Equal(10, transports.ConnWeight(c))
+		c.Close()
+	}
+
+	c, err = A.Dial(addrs[1])
+	if assert.NoError(err) {
+		assert.Equal(0, transports.ConnWeight(c))
+		c.Close()
+	}
+}
+
+func TestWriteMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := Config{
+		tcp.Config{Addr: "127.0.0.1:0"},
+		Weighted{Weight: 10, Config: udp.Config{Addr: "127.0.0.1:0"}},
+	}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := udp.Config{Addr: "127.0.0.1:0"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	var (
+		dst  = B.Addrs()[0]
+		msgs = []transports.Message{
+			{Data: []byte("a"), Addr: dst},
+			{Data: []byte("b"), Addr: dst},
+			{Data: []byte("c"), Addr: dst},
+			{Data: []byte("d"), Addr: A.Addrs()[0]},
+		}
+	)
+
+	// the tcp sub-transport can't send batches
+	n, err := A.(transports.BatchWriter).WriteMessages(msgs)
+	assert.Equal(transports.ErrInvalidAddr, err)
+	assert.Equal(3, n)
+
+	c, err := B.Accept()
+	if !assert.NoError(err) {
+		return
+	}
+
+	buf := make([]byte, 1500)
+	for _, msg := range msgs[:3] {
+		n, err := c.Read(buf)
+		if assert.NoError(err) {
+			assert.Equal(msg.Data, buf[:n])
+		}
+	}
+}
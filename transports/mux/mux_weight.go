@@ -0,0 +1,85 @@
+package mux
+
+import (
+	"net"
+	"os"
+
+	"github.com/telehash/gogotelehash/transports"
+)
+
+var (
+	_ transports.Config        = Weighted{}
+	_ transports.BatchWriter   = (*weightedTransport)(nil)
+	_ transports.FileTransport = (*weightedTransport)(nil)
+	_ transports.WeightedConn  = (*weightedConn)(nil)
+	_ transports.MTUConn       = (*weightedConn)(nil)
+)
+
+// Weighted assigns a weight to a sub-transport. When multiple paths to a peer
+// are reachable the endpoint prefers paths with a higher weight. Transports
+// that are not Weighted have weight 0.
+//
+//   e3x.New(keys, mux.Config{
+//     mux.Weighted{Weight: 10, Config: udp.Config{}},
+//     tcp.Config{},
+//   })
+type Weighted struct {
+	Weight int
+	Config transports.Config
+}
+
+type weightedTransport struct {
+	transports.Transport
+	weight int
+}
+
+type weightedConn struct {
+	net.Conn
+	weight int
+}
+
+// Open opens the sub-transport.
+func (c Weighted) Open() (transports.Transport, error) {
+	t, err := c.Config.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Weight == 0 {
+		return t, nil
+	}
+
+	return &weightedTransport{t, c.Weight}, nil
+}
+
+func (t *weightedTransport) Dial(addr net.Addr) (net.Conn, error) {
+	conn, err := t.Transport.Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &weightedConn{conn, t.weight}, nil
+}
+
+func (t *weightedTransport) WriteMessages(msgs []transports.Message) (int, error) {
+	return transports.WriteMessages(t.Transport, msgs)
+}
+
+func (t *weightedTransport) Files() ([]*os.File, error) {
+	return transports.TransportFiles(t.Transport)
+}
+
+func (t *weightedTransport) Accept() (net.Conn, error) {
+	conn, err := t.Transport.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &weightedConn{conn, t.weight}, nil
+}
+
+func (c *weightedConn) Weight() int {
+	return c.weight
+}
+
+func (c *weightedConn) MTU() int {
+	return transports.ConnMTU(c.Conn)
+}
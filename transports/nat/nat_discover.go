@@ -0,0 +1,187 @@
+package nat
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// ErrNoGateway is returned by a Discoverer when it found no gateway.
+var ErrNoGateway = errors.New("nat: no gateway found")
+
+// Gateway maps ports of the local host to an external address.
+type Gateway interface {
+	// Type describes the gateway ("UPNP (IG2-IP2)", "NAT-PMP", ...).
+	Type() string
+
+	// GetExternalAddress returns the external IP of the gateway.
+	GetExternalAddress() (net.IP, error)
+
+	// GetInternalAddress returns the IP of the local host on the network of
+	// the gateway. Only addresses with this IP are mapped.
+	GetInternalAddress() (net.IP, error)
+
+	// AddPortMapping maps internalPort to an external port for lease (zero
+	// requests a permanent mapping) and returns the external port.
+	AddPortMapping(proto string, internalPort int, description string, lease time.Duration) (externalPort int, err error)
+
+	// DeletePortMapping removes the mapping of internalPort.
+	DeletePortMapping(proto string, internalPort int) error
+}
+
+// Discoverer finds the gateway of the local network.
+type Discoverer interface {
+	// Discover returns the gateway or ErrNoGateway.
+	Discover() (Gateway, error)
+}
+
+// DiscovererFunc adapts a function to the Discoverer interface.
+type DiscovererFunc func() (Gateway, error)
+
+// Discover calls f.
+func (f DiscovererFunc) Discover() (Gateway, error) { return f() }
+
+// DefaultDiscoverers are used when Config.Discoverers is empty.
+func DefaultDiscoverers() []Discoverer {
+	return []Discoverer{UPnP(), NATPMP()}
+}
+
+// discoverGateway runs all discoverers at the same time and returns the
+// gateway of the first discoverer in ds that found one. Discoverers that
+// don't answer within timeout are ignored.
+func discoverGateway(ds []Discoverer, timeout time.Duration) (Gateway, error) {
+	type result struct {
+		idx int
+		gw  Gateway
+	}
+
+	var (
+		results = make(chan result, len(ds))
+		found   = make([]Gateway, len(ds))
+		done    = make([]bool, len(ds))
+		timer   = time.NewTimer(timeout)
+	)
+	defer timer.Stop()
+
+	for i, d := range ds {
+		go func(i int, d Discoverer) {
+			gw, err := d.Discover()
+			if err != nil {
+				gw = nil
+			}
+			results <- result{i, gw}
+		}(i, d)
+	}
+
+	for pending := len(ds); pending > 0; pending-- {
+		select {
+		case r := <-results:
+			found[r.idx], done[r.idx] = r.gw, true
+		case <-timer.C:
+			pending = 0
+		}
+
+		// a gateway wins once all discoverers before it are done
+		for i := range ds {
+			if found[i] != nil {
+				return found[i], nil
+			}
+			if !done[i] {
+				break
+			}
+		}
+	}
+
+	for _, gw := range found {
+		if gw != nil {
+			return gw, nil
+		}
+	}
+	return nil, ErrNoGateway
+}
+
+// Static is a gateway with manually configured port forwards.
+//
+//	nat.Config{
+//	  Config:      udp.Config{Addr: ":42424"},
+//	  Discoverers: []nat.Discoverer{&nat.Static{ExternalIP: net.ParseIP("203.0.113.7")}},
+//	}
+type Static struct {
+	// ExternalIP is the IP the ports are forwarded from.
+	ExternalIP net.IP
+
+	// InternalIP is the IP of the local host the ports are forwarded to.
+	// Defaults to the local IP that routes to ExternalIP.
+	InternalIP net.IP
+
+	// Ports maps internal ports to external ports. Ports that are not listed
+	// are forwarded from the same external port.
+	Ports map[int]int
+}
+
+var (
+	_ Discoverer = (*Static)(nil)
+	_ Gateway    = (*Static)(nil)
+)
+
+func (s *Static) Discover() (Gateway, error) {
+	if s.ExternalIP == nil {
+		return nil, ErrNoGateway
+	}
+	return s, nil
+}
+
+func (s *Static) Type() string { return "static" }
+
+func (s *Static) GetExternalAddress() (net.IP, error) { return s.ExternalIP, nil }
+
+func (s *Static) GetInternalAddress() (net.IP, error) {
+	if s.InternalIP != nil {
+		return s.InternalIP, nil
+	}
+	return routeIP(s.ExternalIP)
+}
+
+func (s *Static) AddPortMapping(proto string, internalPort int, description string, lease time.Duration) (int, error) {
+	if port, found := s.Ports[internalPort]; found {
+		return port, nil
+	}
+	return internalPort, nil
+}
+
+func (s *Static) DeletePortMapping(proto string, internalPort int) error { return nil }
+
+// routeIP returns the local IP that is used to reach ip.
+func routeIP(ip net.IP) (net.IP, error) {
+	// no packets are sent
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: ip, Port: 9})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+// interfaceIPFor returns the IP of the local interface on the network of ip.
+func interfaceIPFor(ip net.IP) (net.IP, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, addr := range addrs {
+			if x, ok := addr.(*net.IPNet); ok && x.Contains(ip) {
+				return x.IP, nil
+			}
+		}
+	}
+
+	return nil, ErrNoGateway
+}
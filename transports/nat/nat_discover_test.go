@@ -0,0 +1,98 @@
+package nat
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+)
+
+func TestDiscoverGatewayPriority(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		slow = &Static{ExternalIP: net.ParseIP("203.0.113.1")}
+		fast = &Static{ExternalIP: net.ParseIP("203.0.113.2")}
+	)
+
+	gw, err := discoverGateway([]Discoverer{
+		DiscovererFunc(func() (Gateway, error) { return nil, ErrNoGateway }),
+		DiscovererFunc(func() (Gateway, error) {
+			time.Sleep(50 * time.Millisecond)
+			return slow, nil
+		}),
+		fast,
+	}, time.Second)
+	assert.NoError(err)
+	assert.Equal(slow, gw)
+}
+
+func TestDiscoverGatewayTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		fast    = &Static{ExternalIP: net.ParseIP("203.0.113.2")}
+		blocked = make(chan struct{})
+	)
+	defer close(blocked)
+
+	gw, err := discoverGateway([]Discoverer{
+		DiscovererFunc(func() (Gateway, error) { <-blocked; return nil, ErrNoGateway }),
+		fast,
+	}, 50*time.Millisecond)
+	assert.NoError(err)
+	assert.Equal(fast, gw)
+
+	gw, err = discoverGateway([]Discoverer{&Static{}}, time.Second)
+	assert.Equal(ErrNoGateway, err)
+	assert.Nil(gw)
+}
+
+func TestStatic(t *testing.T) {
+	assert := assert.New(t)
+
+	gw := &Static{
+		ExternalIP: net.ParseIP("203.0.113.7"),
+		InternalIP: net.ParseIP("192.168.1.10"),
+		Ports:      map[int]int{4242: 50000},
+	}
+
+	port, err := gw.AddPortMapping("udp", 4242, defaultDescription, time.Hour)
+	assert.NoError(err)
+	assert.Equal(50000, port)
+
+	port, err = gw.AddPortMapping("udp", 5353, defaultDescription, time.Hour)
+	assert.NoError(err)
+	assert.Equal(5353, port)
+}
+
+func TestParseSTUNResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	txid := []byte("0123456789ab")
+
+	res := make([]byte, stunHeaderSize+12)
+	binary.BigEndian.PutUint16(res[0:], stunBindingResponse)
+	binary.BigEndian.PutUint16(res[2:], 12)
+	binary.BigEndian.PutUint32(res[4:], stunMagicCookie)
+	copy(res[8:], txid)
+
+	attr := res[stunHeaderSize:]
+	binary.BigEndian.PutUint16(attr[0:], stunXorMappedAddress)
+	binary.BigEndian.PutUint16(attr[2:], 8)
+	attr[5] = 0x01
+	binary.BigEndian.PutUint16(attr[6:], 42424^(stunMagicCookie>>16))
+	binary.BigEndian.PutUint32(attr[8:], binary.BigEndian.Uint32(net.ParseIP("203.0.113.7").To4())^stunMagicCookie)
+
+	ip, err := parseSTUNResponse(res, txid)
+	assert.NoError(err)
+	assert.Equal("203.0.113.7", ip.String())
+
+	_, err = parseSTUNResponse(res, []byte("ba9876543210"))
+	assert.Equal(errInvalidSTUNResponse, err)
+
+	_, err = parseSTUNResponse(res[:stunHeaderSize+4], txid)
+	assert.Equal(errInvalidSTUNResponse, err)
+}
@@ -0,0 +1,119 @@
+package nat
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/jackpal/go-nat-pmp"
+)
+
+type pmpGateway struct {
+	c       *natpmp.Client
+	gateway net.IP
+
+	mtx   sync.Mutex
+	ports map[string]int
+}
+
+var _ Gateway = (*pmpGateway)(nil)
+
+// NATPMP discovers NAT-PMP gateways. The gateway is assumed to be the first
+// host (x.x.x.1) of the private networks of the local interfaces.
+func NATPMP() Discoverer {
+	return DiscovererFunc(discoverNATPMP)
+}
+
+func discoverNATPMP() (Gateway, error) {
+	var ds []Discoverer
+	for _, ip := range pmpPotentialGateways() {
+		ip := ip
+		ds = append(ds, DiscovererFunc(func() (Gateway, error) {
+			gw := &pmpGateway{c: natpmp.NewClient(ip), gateway: ip, ports: make(map[string]int)}
+			if _, err := gw.GetExternalAddress(); err != nil {
+				return nil, err
+			}
+			return gw, nil
+		}))
+	}
+
+	return discoverGateway(ds, discoverTimeout)
+}
+
+func pmpPotentialGateways() []net.IP {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var ips []net.IP
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			x, ok := addr.(*net.IPNet)
+			if !ok || x.IP.To4() == nil || !x.IP.IsPrivate() {
+				continue
+			}
+
+			ip := x.IP.To4().Mask(x.Mask)
+			ip[3] |= 0x01
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+func (n *pmpGateway) Type() string { return "NAT-PMP" }
+
+func (n *pmpGateway) GetExternalAddress() (net.IP, error) {
+	res, err := n.c.GetExternalAddress()
+	if err != nil {
+		return nil, err
+	}
+	return net.IPv4(res.ExternalIPAddress[0], res.ExternalIPAddress[1], res.ExternalIPAddress[2], res.ExternalIPAddress[3]), nil
+}
+
+func (n *pmpGateway) GetInternalAddress() (net.IP, error) {
+	return interfaceIPFor(n.gateway)
+}
+
+func (n *pmpGateway) AddPortMapping(proto string, internalPort int, description string, lease time.Duration) (int, error) {
+	if lease <= 0 {
+		// NAT-PMP has no permanent mappings and a zero lifetime deletes them
+		lease = 24 * time.Hour
+	}
+
+	key := fmt.Sprintf("%s:%d", proto, internalPort)
+
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	requested := n.ports[key]
+	if requested == 0 {
+		requested = internalPort
+	}
+
+	res, err := n.c.AddPortMapping(proto, internalPort, requested, int(lease/time.Second))
+	if err != nil {
+		return 0, err
+	}
+
+	n.ports[key] = int(res.MappedExternalPort)
+	return int(res.MappedExternalPort), nil
+}
+
+func (n *pmpGateway) DeletePortMapping(proto string, internalPort int) error {
+	key := fmt.Sprintf("%s:%d", proto, internalPort)
+
+	n.mtx.Lock()
+	delete(n.ports, key)
+	n.mtx.Unlock()
+
+	_, err := n.c.AddPortMapping(proto, internalPort, 0, 0)
+	return err
+}
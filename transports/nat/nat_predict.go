@@ -0,0 +1,59 @@
+package nat
+
+import (
+	"net"
+)
+
+// maxPortDelta is the largest port increment that is considered predictable.
+// NATs with larger increments (or random ports) can't be predicted.
+const maxPortDelta = 32
+
+// PortDelta estimates the increment with which a symmetric NAT allocates
+// external ports from the ports it allocated for consecutive destinations
+// (oldest first). It returns 0 when the allocation is not predictable.
+func PortDelta(ports []int) int {
+	var (
+		counts = make(map[int]int)
+		delta  int
+	)
+
+	for i := 1; i < len(ports); i++ {
+		d := ports[i] - ports[i-1]
+		if d <= 0 || d > maxPortDelta {
+			continue
+		}
+		counts[d]++
+		if counts[d] > counts[delta] || counts[d] == counts[delta] && d < delta {
+			delta = d
+		}
+	}
+
+	return delta
+}
+
+// PredictAddrs returns the n addresses a symmetric NAT will most likely
+// allocate next when it allocated reflexive last and increments its ports by
+// delta. reflexive must implement Addr.
+func PredictAddrs(reflexive net.Addr, delta, n int) []net.Addr {
+	naddr, ok := reflexive.(Addr)
+	if !ok || delta <= 0 {
+		return nil
+	}
+
+	_, ip, port := asNATableAddr(reflexive)
+	if ip == nil {
+		return nil
+	}
+
+	var addrs []net.Addr
+	for i := 1; i <= n; i++ {
+		p := port + i*delta
+		if p > 65535 {
+			break
+		}
+		if addr := naddr.MakeGlobal(ip, p); addr != nil {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
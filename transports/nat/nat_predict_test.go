@@ -0,0 +1,32 @@
+package nat
+
+import (
+	"net"
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+)
+
+func TestPortDelta(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(0, PortDelta(nil))
+	assert.Equal(0, PortDelta([]int{50000}))
+	assert.Equal(1, PortDelta([]int{50000, 50001, 50002}))
+	assert.Equal(2, PortDelta([]int{50000, 50002, 50004, 50005}))
+	assert.Equal(0, PortDelta([]int{50000, 12345, 61000}))
+}
+
+func TestPredictAddrs(t *testing.T) {
+	assert := assert.New(t)
+
+	last := &testAddr{net.ParseIP("203.0.113.7"), 65530}
+
+	var ports []int
+	for _, addr := range PredictAddrs(last, 2, 8) {
+		ports = append(ports, addr.(*testAddr).port)
+	}
+	assert.Equal([]int{65532, 65534}, ports)
+
+	assert.Empty(PredictAddrs(last, 0, 8))
+}
@@ -0,0 +1,230 @@
+package nat
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	stunBindingRequest  = 0x0001
+	stunBindingResponse = 0x0101
+	stunMagicCookie     = 0x2112A442
+	stunHeaderSize      = 20
+
+	stunMappedAddress    = 0x0001
+	stunXorMappedAddress = 0x0020
+
+	stunTimeout = 3 * time.Second
+
+	// stunCacheTime limits how often the STUN server is asked for the
+	// external address.
+	stunCacheTime = time.Minute
+)
+
+var errInvalidSTUNResponse = errors.New("nat: invalid STUN response")
+
+type stunGateway struct {
+	server string
+
+	mtx      sync.Mutex
+	external net.IP
+	internal net.IP
+	expires  time.Time
+}
+
+var _ Gateway = (*stunGateway)(nil)
+
+// STUN discovers the external IP with a STUN server ("stun.example.com:3478",
+// RFC 5389). STUN doesn't open ports: the external ports are assumed to be the
+// same as the internal ports. This holds for NATs that preserve the port of
+// outgoing packets and for hosts with manually forwarded ports.
+func STUN(server string) Discoverer {
+	return DiscovererFunc(func() (Gateway, error) {
+		gw := &stunGateway{server: server}
+		if _, err := gw.GetExternalAddress(); err != nil {
+			return nil, err
+		}
+		return gw, nil
+	})
+}
+
+func (s *stunGateway) Type() string { return "STUN" }
+
+func (s *stunGateway) GetExternalAddress() (net.IP, error) {
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.external, nil
+}
+
+func (s *stunGateway) GetInternalAddress() (net.IP, error) {
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.internal, nil
+}
+
+func (s *stunGateway) AddPortMapping(proto string, internalPort int, description string, lease time.Duration) (int, error) {
+	return internalPort, nil
+}
+
+func (s *stunGateway) DeletePortMapping(proto string, internalPort int) error { return nil }
+
+func (s *stunGateway) refresh() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if time.Now().Before(s.expires) {
+		return nil
+	}
+
+	external, internal, err := stunBinding(s.server)
+	if err != nil {
+		return err
+	}
+
+	s.external, s.internal = external, internal
+	s.expires = time.Now().Add(stunCacheTime)
+	return nil
+}
+
+// stunBinding sends a binding request to server and returns the reflexive IP
+// and the local IP the request was sent from.
+func stunBinding(server string) (external, internal net.IP, err error) {
+	raddr, err := net.ResolveUDPAddr("udp", server)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn, err := net.DialUDP("udp", nil, raddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+
+	var req [stunHeaderSize]byte
+	binary.BigEndian.PutUint16(req[0:], stunBindingRequest)
+	binary.BigEndian.PutUint32(req[4:], stunMagicCookie)
+	if _, err := rand.Read(req[8:20]); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		buf      [1500]byte
+		deadline = time.Now().Add(stunTimeout)
+	)
+	conn.SetDeadline(deadline)
+
+	for attempt := 0; time.Now().Before(deadline); attempt++ {
+		if _, err := conn.Write(req[:]); err != nil {
+			return nil, nil, err
+		}
+
+		conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond << uint(attempt)))
+		n, err := conn.Read(buf[:])
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				continue
+			}
+			return nil, nil, err
+		}
+
+		ip, err := parseSTUNResponse(buf[:n], req[8:20])
+		if err != nil {
+			continue
+		}
+		return ip, conn.LocalAddr().(*net.UDPAddr).IP, nil
+	}
+
+	return nil, nil, ErrNoGateway
+}
+
+// parseSTUNResponse returns the mapped address of a binding response for the
+// transaction txid.
+func parseSTUNResponse(b []byte, txid []byte) (net.IP, error) {
+	if len(b) < stunHeaderSize ||
+		binary.BigEndian.Uint16(b[0:]) != stunBindingResponse ||
+		binary.BigEndian.Uint32(b[4:]) != stunMagicCookie ||
+		string(b[8:20]) != string(txid) {
+		return nil, errInvalidSTUNResponse
+	}
+
+	size := int(binary.BigEndian.Uint16(b[2:]))
+	if stunHeaderSize+size > len(b) {
+		return nil, errInvalidSTUNResponse
+	}
+
+	var (
+		attrs  = b[stunHeaderSize : stunHeaderSize+size]
+		mapped net.IP
+	)
+	for len(attrs) >= 4 {
+		typ := binary.BigEndian.Uint16(attrs[0:])
+		l := int(binary.BigEndian.Uint16(attrs[2:]))
+		if 4+l > len(attrs) {
+			return nil, errInvalidSTUNResponse
+		}
+		value := attrs[4 : 4+l]
+
+		switch typ {
+		case stunXorMappedAddress:
+			if ip := stunAddress(value, b[4:20]); ip != nil {
+				return ip, nil
+			}
+		case stunMappedAddress:
+			mapped = stunAddress(value, nil)
+		}
+
+		// attributes are padded to 4 bytes
+		l = (l + 3) &^ 3
+		if 4+l > len(attrs) {
+			break
+		}
+		attrs = attrs[4+l:]
+	}
+
+	if mapped == nil {
+		return nil, errInvalidSTUNResponse
+	}
+	return mapped, nil
+}
+
+// stunAddress decodes the IP of a (XOR-)MAPPED-ADDRESS attribute. The IP is
+// xored with key (the magic cookie and transaction id) when key is not nil.
+func stunAddress(value []byte, key []byte) net.IP {
+	if len(value) < 4 {
+		return nil
+	}
+
+	var size int
+	switch value[1] {
+	case 0x01:
+		size = net.IPv4len
+	case 0x02:
+		size = net.IPv6len
+	default:
+		return nil
+	}
+	if len(value) < 4+size {
+		return nil
+	}
+
+	ip := make(net.IP, size)
+	copy(ip, value[4:4+size])
+	if key != nil {
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+	}
+	return ip
+}
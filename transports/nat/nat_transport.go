@@ -7,17 +7,18 @@ package nat
 import (
 	"fmt"
 	"net"
+	"os"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/fd/go-nat"
-
 	"github.com/telehash/gogotelehash/transports"
 )
 
 var (
-	_ transports.Transport = (*transport)(nil)
-	_ transports.Config    = Config{}
+	_ transports.BatchWriter   = (*transport)(nil)
+	_ transports.FileTransport = (*transport)(nil)
+	_ transports.Config        = Config{}
 )
 
 // NATableAddr must be implemented by transports that support NAT port mapping.
@@ -37,16 +38,67 @@ type Addr interface {
 
 // Config must be given a sub-transport.
 //
-//   e3x.New(keys, nat.Config{udp.Config{}})
+//	e3x.New(keys, nat.Config{Config: udp.Config{}})
+//
+// The transport discovers a gateway (UPnP IGD and NAT-PMP by default) and
+// requests a port mapping for every UDP and TCP address of the sub-transport
+// on the LAN of the gateway. The mapped external addresses are reported by
+// Addrs and are announced to peers like any other address of the endpoint.
 type Config struct {
 	// The configuration of the sub-transport.
 	Config transports.Config
+
+	// Discoverers are asked for a gateway, all at the same time. When more
+	// than one finds a gateway the first one in the list is used.
+	// Defaults to DefaultDiscoverers().
+	Discoverers []Discoverer
+
+	// ProbeInterval is the time between two discovery rounds while no
+	// gateway is known. Discovery also runs when the addresses of the
+	// sub-transport change. Defaults to 10 minutes.
+	ProbeInterval time.Duration
+
+	// Lease is the lifetime that is requested for each port mapping. Mappings
+	// are renewed before they expire. Gateways that only support permanent
+	// mappings (UPnP error 725) are asked for a permanent mapping instead.
+	// Defaults to 60 minutes.
+	Lease time.Duration
+
+	// Description labels the port mappings on the gateway.
+	// Defaults to "Telehash".
+	Description string
+
+	// ExternalAddressChanged is called when a mapped external address
+	// changes. old is nil for new mappings and new is nil for mappings that
+	// were removed. It is called from the goroutine that maintains the
+	// mappings and must not block.
+	ExternalAddressChanged func(old, new net.Addr)
 }
 
+const (
+	defaultLease         = 60 * time.Minute
+	defaultDescription   = "Telehash"
+	defaultProbeInterval = 10 * time.Minute
+
+	// discoverTimeout bounds the time a discovery round waits for slow
+	// discoverers.
+	discoverTimeout = 10 * time.Second
+
+	// closeTimeout bounds the time Close waits for the mappings to be
+	// deleted from the gateway.
+	closeTimeout = 5 * time.Second
+)
+
 type transport struct {
-	t    transports.Transport
-	nat  nat.NAT
-	done chan struct{}
+	t             transports.Transport
+	nat           Gateway
+	discoverers   []Discoverer
+	probeInterval time.Duration
+	done          chan struct{}
+	stopped       chan struct{}
+	lease         time.Duration
+	description   string
+	onChange      func(old, new net.Addr)
 
 	mtx     sync.RWMutex
 	mapping map[string]*natMapping
@@ -56,6 +108,7 @@ type natMapping struct {
 	external net.Addr
 	internal net.Addr
 	stale    bool
+	expires  time.Time // zero for permanent mappings
 }
 
 // Open opens the sub-transport and starts the port mapper.
@@ -65,10 +118,29 @@ func (c Config) Open() (transports.Transport, error) {
 		return nil, err
 	}
 
+	if c.Lease <= 0 {
+		c.Lease = defaultLease
+	}
+	if c.Description == "" {
+		c.Description = defaultDescription
+	}
+	if len(c.Discoverers) == 0 {
+		c.Discoverers = DefaultDiscoverers()
+	}
+	if c.ProbeInterval <= 0 {
+		c.ProbeInterval = defaultProbeInterval
+	}
+
 	nat := &transport{
-		t:       t,
-		mapping: make(map[string]*natMapping),
-		done:    make(chan struct{}),
+		t:             t,
+		mapping:       make(map[string]*natMapping),
+		discoverers:   c.Discoverers,
+		probeInterval: c.ProbeInterval,
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+		lease:         c.Lease,
+		description:   c.Description,
+		onChange:      c.ExternalAddressChanged,
 	}
 
 	go nat.runMapper()
@@ -92,10 +164,20 @@ func (t *transport) Dial(addr net.Addr) (net.Conn, error) {
 	return t.t.Dial(addr)
 }
 
+func (t *transport) WriteMessages(msgs []transports.Message) (int, error) {
+	return transports.WriteMessages(t.t, msgs)
+}
+
+func (t *transport) Files() ([]*os.File, error) {
+	return transports.TransportFiles(t.t)
+}
+
 func (t *transport) Accept() (net.Conn, error) {
 	return t.t.Accept()
 }
 
+// Close stops the port mapper, deletes the mappings from the gateway and
+// closes the sub-transport.
 func (t *transport) Close() error {
 	select {
 	case <-t.done: // is closed
@@ -103,10 +185,23 @@ func (t *transport) Close() error {
 		close(t.done)
 	}
 
+	t.mtx.RLock()
+	mapped := len(t.mapping) > 0
+	t.mtx.RUnlock()
+
+	if mapped {
+		select {
+		case <-t.stopped:
+		case <-time.After(closeTimeout):
+		}
+	}
+
 	return t.t.Close()
 }
 
 func (t *transport) runMapper() {
+	defer close(t.stopped)
+
 	var closed bool
 	for !closed {
 		if t.nat == nil {
@@ -118,7 +213,7 @@ func (t *transport) runMapper() {
 }
 
 func (t *transport) runDiscoverMode() bool {
-	var discoverTicker = time.NewTicker(10 * time.Minute)
+	var discoverTicker = time.NewTicker(t.probeInterval)
 	defer discoverTicker.Stop()
 
 	var updateTicker = time.NewTicker(5 * time.Second)
@@ -198,9 +293,6 @@ func (t *transport) updateKnownAddresses(known map[string]bool) bool {
 }
 
 func (t *transport) runMappingMode() bool {
-	var refreshTicker = time.NewTicker(50 * time.Minute)
-	defer refreshTicker.Stop()
-
 	var updateTicker = time.NewTicker(5 * time.Second)
 	defer updateTicker.Stop()
 
@@ -208,36 +300,111 @@ func (t *transport) runMappingMode() bool {
 		select {
 
 		case <-t.done:
-			t.mapping = make(map[string]*natMapping)
+			t.deleteMappings()
 			return true // done
 
-		case <-refreshTicker.C:
-			t.refreshMapping()
-
 		case <-updateTicker.C:
 			t.updateMappings()
+			if t.nat != nil {
+				t.refreshMapping(time.Now())
+			}
 
 		}
 
 		if t.nat == nil {
-			t.mapping = make(map[string]*natMapping)
+			t.resetMappings()
 			return false // not done
 		}
 	}
 }
 
-func (t *transport) discoverNAT() {
-	nat, err := nat.DiscoverGateway()
-	if err != nil {
+func (t *transport) resetMappings() {
+	t.setMapping(make(map[string]*natMapping))
+}
+
+// deleteMappings removes all mappings from the gateway.
+func (t *transport) deleteMappings() {
+	t.mtx.RLock()
+	mapping := t.mapping
+	t.mtx.RUnlock()
+
+	for _, m := range mapping {
+		proto, _, internalPort := asNATableAddr(m.internal)
+		if proto == "" {
+			continue
+		}
+		t.nat.DeletePortMapping(proto, internalPort)
+	}
+
+	t.resetMappings()
+}
+
+// setMapping replaces the current mappings and reports the external
+// addresses that changed.
+func (t *transport) setMapping(mapping map[string]*natMapping) {
+	t.mtx.Lock()
+	prev := t.mapping
+	t.mapping = mapping
+	t.mtx.Unlock()
+
+	if t.onChange == nil {
 		return
 	}
 
-	_, err = nat.GetDeviceAddress()
+	for key, m := range prev {
+		if n := mapping[key]; n == nil {
+			t.onChange(m.external, nil)
+		} else if !transports.EqualAddr(m.external, n.external) {
+			t.onChange(m.external, n.external)
+		}
+	}
+	for key, n := range mapping {
+		if prev[key] == nil {
+			t.onChange(nil, n.external)
+		}
+	}
+}
+
+// addPortMapping requests a mapping for internalPort from the gateway. The
+// returned expiry is zero when the gateway only granted a permanent mapping.
+func (t *transport) addPortMapping(proto string, internalPort int) (int, time.Time, error) {
+	lease := t.lease
+	externalPort, err := t.nat.AddPortMapping(proto, internalPort, t.description, lease)
+	if err != nil && strings.HasPrefix(t.nat.Type(), "UPNP") {
+		// OnlyPermanentLeasesSupported (725); retry with a permanent lease
+		lease = 0
+		externalPort, err = t.nat.AddPortMapping(proto, internalPort, t.description, lease)
+	}
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if externalPort <= 0 || externalPort > 65535 {
+		return 0, time.Time{}, fmt.Errorf("nat: invalid external port %d", externalPort)
+	}
+
+	var expires time.Time
+	if lease > 0 {
+		expires = time.Now().Add(lease)
+	}
+	return externalPort, expires, nil
+}
+
+// renewAt returns the time at which m must be renewed; a sixth of the lease
+// before it expires. It returns the zero time for permanent mappings.
+func (t *transport) renewAt(m *natMapping) time.Time {
+	if m.expires.IsZero() {
+		return time.Time{}
+	}
+	return m.expires.Add(-t.lease / 6)
+}
+
+func (t *transport) discoverNAT() {
+	gw, err := discoverGateway(t.discoverers, discoverTimeout)
 	if err != nil {
 		return
 	}
 
-	t.nat = nat
+	t.nat = gw
 }
 
 func (t *transport) updateMappings() {
@@ -282,12 +449,12 @@ func (t *transport) updateMappings() {
 		}
 
 		key := mappingKey(proto, ip, internalPort)
-		if m := t.mapping[key]; m != nil {
+		if m := mapping[key]; m != nil {
 			m.stale = false
 			continue // Already exists
 		}
 
-		externalPort, err := t.nat.AddPortMapping(proto, internalPort, "Telehash", 60*time.Minute)
+		externalPort, expires, err := t.addPortMapping(proto, internalPort)
 		if err != nil {
 			continue // unable to map address
 		}
@@ -297,7 +464,7 @@ func (t *transport) updateMappings() {
 			continue // unable to map address
 		}
 
-		mapping[key] = &natMapping{external: globaddr, internal: addr, stale: false}
+		mapping[key] = &natMapping{external: globaddr, internal: addr, stale: false, expires: expires}
 	}
 
 	for key, m := range mapping {
@@ -319,25 +486,31 @@ func (t *transport) updateMappings() {
 		delete(mapping, key)
 	}
 
-	t.mtx.Lock()
-	t.mapping = mapping
-	t.mtx.Unlock()
+	t.setMapping(mapping)
 }
 
-func (t *transport) refreshMapping() {
+// refreshMapping renews the mappings that are due at now.
+func (t *transport) refreshMapping(now time.Time) {
 	var (
 		droplist []string
 		mapping  map[string]*natMapping
+		due      bool
 	)
 
 	t.mtx.Lock()
 	mapping = make(map[string]*natMapping, len(t.mapping))
 	for k, v := range t.mapping {
 		mapping[k] = v
-		v.stale = true
+		if renewAt := t.renewAt(v); !renewAt.IsZero() && !now.Before(renewAt) {
+			due = true
+		}
 	}
 	t.mtx.Unlock()
 
+	if !due {
+		return
+	}
+
 	externalIP, err := t.nat.GetExternalAddress()
 	if err != nil {
 		t.nat = nil
@@ -352,6 +525,10 @@ func (t *transport) refreshMapping() {
 
 	// remap addrs
 	for key, m := range mapping {
+		if renewAt := t.renewAt(m); renewAt.IsZero() || now.Before(renewAt) {
+			continue
+		}
+
 		proto, ip, internalPort := asNATableAddr(m.internal)
 		if proto == "" {
 			droplist = append(droplist, key)
@@ -364,7 +541,7 @@ func (t *transport) refreshMapping() {
 			continue
 		}
 
-		externalPort, err := t.nat.AddPortMapping(proto, internalPort, "Telehash", 60*time.Minute)
+		externalPort, expires, err := t.addPortMapping(proto, internalPort)
 		if err != nil {
 			droplist = append(droplist, key)
 			continue
@@ -376,16 +553,14 @@ func (t *transport) refreshMapping() {
 			continue
 		}
 
-		m.external = globaddr
+		mapping[key] = &natMapping{external: globaddr, internal: m.internal, expires: expires}
 	}
 
 	for _, key := range droplist {
 		delete(mapping, key)
 	}
 
-	t.mtx.Lock()
-	t.mapping = mapping
-	t.mtx.Unlock()
+	t.setMapping(mapping)
 }
 
 func mappingKey(proto string, ip net.IP, internalPort int) string {
@@ -0,0 +1,146 @@
+package nat
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+)
+
+type testAddr struct {
+	ip   net.IP
+	port int
+}
+
+func (a *testAddr) Network() string { return "test" }
+func (a *testAddr) String() string  { return net.JoinHostPort(a.ip.String(), strconv.Itoa(a.port)) }
+
+func (a *testAddr) InternalAddr() (string, net.IP, int) { return "udp", a.ip, a.port }
+func (a *testAddr) MakeGlobal(ip net.IP, port int) net.Addr {
+	return &testAddr{ip: ip, port: port}
+}
+
+type testTransport struct {
+	addrs []net.Addr
+}
+
+func (t *testTransport) Addrs() []net.Addr                    { return t.addrs }
+func (t *testTransport) Dial(addr net.Addr) (net.Conn, error) { return nil, io.EOF }
+func (t *testTransport) Accept() (net.Conn, error)            { return nil, io.EOF }
+func (t *testTransport) Close() error                         { return nil }
+
+type testNAT struct {
+	typ           string
+	permanentOnly bool
+	nextPort      int
+	leases        []time.Duration
+	deleted       []int
+}
+
+func (n *testNAT) Type() string                        { return n.typ }
+func (n *testNAT) GetExternalAddress() (net.IP, error) { return net.ParseIP("203.0.113.7"), nil }
+func (n *testNAT) GetInternalAddress() (net.IP, error) { return net.ParseIP("192.168.1.10"), nil }
+func (n *testNAT) DeletePortMapping(proto string, port int) error {
+	n.deleted = append(n.deleted, port)
+	return nil
+}
+
+func (n *testNAT) AddPortMapping(proto string, port int, desc string, lease time.Duration) (int, error) {
+	if n.permanentOnly && lease > 0 {
+		return 0, errors.New("OnlyPermanentLeasesSupported")
+	}
+	n.leases = append(n.leases, lease)
+	n.nextPort++
+	return n.nextPort, nil
+}
+
+func TestMapping(t *testing.T) {
+	assert := assert.New(t)
+
+	gw := &testNAT{typ: "UPNP (IG2-IP2)", nextPort: 40000}
+	tr := &transport{
+		t:           &testTransport{addrs: []net.Addr{&testAddr{net.ParseIP("192.168.1.10"), 4242}}},
+		nat:         gw,
+		mapping:     make(map[string]*natMapping),
+		lease:       time.Hour,
+		description: defaultDescription,
+	}
+
+	tr.updateMappings()
+	addrs := tr.Addrs()
+	if assert.Len(addrs, 2) {
+		assert.Equal("203.0.113.7:40001", addrs[1].String())
+	}
+
+	// not due yet
+	tr.refreshMapping(time.Now())
+	assert.Equal([]time.Duration{time.Hour}, gw.leases)
+
+	// renewed a sixth of the lease before it expires
+	tr.refreshMapping(time.Now().Add(51 * time.Minute))
+	assert.Equal([]time.Duration{time.Hour, time.Hour}, gw.leases)
+	addrs = tr.Addrs()
+	if assert.Len(addrs, 2) {
+		assert.Equal("203.0.113.7:40002", addrs[1].String())
+	}
+}
+
+func TestMappingPermanentOnly(t *testing.T) {
+	assert := assert.New(t)
+
+	gw := &testNAT{typ: "UPNP (IG1-IP1)", permanentOnly: true, nextPort: 40000}
+	tr := &transport{
+		t:           &testTransport{addrs: []net.Addr{&testAddr{net.ParseIP("192.168.1.10"), 4242}}},
+		nat:         gw,
+		mapping:     make(map[string]*natMapping),
+		lease:       time.Hour,
+		description: defaultDescription,
+	}
+
+	tr.updateMappings()
+	assert.Len(tr.Addrs(), 2)
+	assert.Equal([]time.Duration{0}, gw.leases)
+
+	// permanent mappings are not renewed
+	tr.refreshMapping(time.Now().Add(2 * time.Hour))
+	assert.Equal([]time.Duration{0}, gw.leases)
+}
+
+func TestMappingTeardown(t *testing.T) {
+	assert := assert.New(t)
+
+	var events []string
+
+	gw := &testNAT{typ: "NAT-PMP", nextPort: 40000}
+	tr := &transport{
+		t:           &testTransport{addrs: []net.Addr{&testAddr{net.ParseIP("192.168.1.10"), 4242}}},
+		nat:         gw,
+		mapping:     make(map[string]*natMapping),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+		lease:       time.Hour,
+		description: defaultDescription,
+		onChange: func(old, new net.Addr) {
+			events = append(events, fmt.Sprintf("%v -> %v", old, new))
+		},
+	}
+
+	tr.updateMappings()
+	tr.refreshMapping(time.Now().Add(51 * time.Minute))
+
+	go tr.runMapper()
+	assert.NoError(tr.Close())
+
+	assert.Equal([]int{4242}, gw.deleted)
+	assert.Len(tr.Addrs(), 1)
+	assert.Equal([]string{
+		"<nil> -> 203.0.113.7:40001",
+		"203.0.113.7:40001 -> 203.0.113.7:40002",
+		"203.0.113.7:40002 -> <nil>",
+	}, events)
+}
@@ -0,0 +1,116 @@
+package nat
+
+import (
+	"net"
+
+	"github.com/telehash/gogotelehash/transports"
+)
+
+// Probe is the answer to a probe: Server received a packet from the local
+// endpoint with the source address Reflexive.
+type Probe struct {
+	// Server identifies the answering host (for example its hashname).
+	Server string
+
+	// Reflexive is the address of the local endpoint as seen by Server. It
+	// must implement Addr.
+	Reflexive net.Addr
+
+	// Local is the local socket the probe was sent from. Probes without a
+	// local socket share one socket per protocol.
+	Local net.Addr
+
+	// Filtering is set when Server also tried to reach Reflexive from an
+	// other IP (FromOtherIP) and from an other port of the same IP
+	// (FromOtherPort). Those fields report if the packets arrived.
+	Filtering     bool
+	FromOtherIP   bool
+	FromOtherPort bool
+}
+
+// Classify returns the type of the NAT in front of the local addresses local
+// given the answers of at least two servers. NATs that map each local socket
+// to one external address are reported as port-restricted cones unless a
+// filtering test showed otherwise. Different local sockets (for example the
+// sockets of a multihomed host) may map to different external addresses.
+func Classify(local []net.Addr, probes []Probe) transports.NATType {
+	type mapping struct {
+		server string
+		ip     net.IP
+		port   int
+	}
+
+	var (
+		servers   = make(map[string]bool)
+		natted    = make(map[string]bool) // servers that saw an external address
+		mappings  = make(map[string]mapping)
+		global    bool
+		symmetric bool
+	)
+
+	for _, p := range probes {
+		proto, ip, port := asNATableAddr(p.Reflexive)
+		if proto == "" {
+			continue
+		}
+		servers[p.Server] = true
+
+		if isLocalAddr(local, proto, ip, port) {
+			if isGlobalIP(ip) {
+				global = true
+			}
+			continue
+		}
+		natted[p.Server] = true
+
+		socket := proto
+		if p.Local != nil {
+			socket = proto + " " + p.Local.String()
+		}
+
+		prev, found := mappings[socket]
+		if found && prev.server != p.Server && (!prev.ip.Equal(ip) || prev.port != port) {
+			symmetric = true
+		}
+		if !found {
+			mappings[socket] = mapping{p.Server, ip, port}
+		}
+	}
+
+	switch {
+	case symmetric:
+		return transports.NATSymmetric
+	case len(natted) == 0 && global && len(servers) >= 2:
+		return transports.NATOpen
+	case len(natted) < 2:
+		return transports.NATUnknown
+	}
+
+	typ := transports.NATPortRestrictedCone
+	for _, p := range probes {
+		if !p.Filtering {
+			continue
+		}
+		if p.FromOtherIP {
+			return transports.NATFullCone
+		}
+		if p.FromOtherPort {
+			typ = transports.NATRestrictedCone
+		}
+	}
+	return typ
+}
+
+func isLocalAddr(local []net.Addr, proto string, ip net.IP, port int) bool {
+	for _, addr := range local {
+		lproto, lip, lport := asNATableAddr(addr)
+		if lproto == proto && lip.Equal(ip) && lport == port {
+			return true
+		}
+	}
+	return false
+}
+
+func isGlobalIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate()
+}
@@ -0,0 +1,66 @@
+package nat
+
+import (
+	"net"
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+	"github.com/telehash/gogotelehash/transports"
+)
+
+func TestClassify(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		lan    = &testAddr{net.ParseIP("192.168.1.10"), 4242}
+		public = &testAddr{net.ParseIP("198.51.100.4"), 4242}
+		ext1   = &testAddr{net.ParseIP("203.0.113.7"), 4242}
+		ext2   = &testAddr{net.ParseIP("203.0.113.7"), 50123}
+		wan    = &testAddr{net.ParseIP("192.168.2.10"), 4242}
+		ext3   = &testAddr{net.ParseIP("198.51.100.9"), 4242}
+	)
+
+	var tab = []struct {
+		local  []net.Addr
+		probes []Probe
+		typ    transports.NATType
+	}{
+		{[]net.Addr{lan}, nil, transports.NATUnknown},
+		{[]net.Addr{lan}, []Probe{{Server: "a", Reflexive: ext1}}, transports.NATUnknown},
+		{[]net.Addr{lan}, []Probe{{Server: "a", Reflexive: lan}, {Server: "b", Reflexive: ext1}}, transports.NATUnknown},
+		{[]net.Addr{public}, []Probe{{Server: "a", Reflexive: public}, {Server: "b", Reflexive: public}}, transports.NATOpen},
+		{[]net.Addr{lan}, []Probe{{Server: "a", Reflexive: ext1}, {Server: "b", Reflexive: ext1}}, transports.NATPortRestrictedCone},
+		{[]net.Addr{lan}, []Probe{{Server: "a", Reflexive: ext1}, {Server: "b", Reflexive: ext2}}, transports.NATSymmetric},
+		{[]net.Addr{lan}, []Probe{
+			{Server: "a", Reflexive: ext1, Filtering: true, FromOtherPort: true},
+			{Server: "b", Reflexive: ext1}}, transports.NATRestrictedCone},
+		{[]net.Addr{lan}, []Probe{
+			{Server: "a", Reflexive: ext1, Filtering: true, FromOtherIP: true, FromOtherPort: true},
+			{Server: "b", Reflexive: ext1}}, transports.NATFullCone},
+
+		// a multihomed host: each local socket has its own (cone) mapping
+		{[]net.Addr{lan, wan}, []Probe{
+			{Server: "a", Reflexive: ext1, Local: lan},
+			{Server: "b", Reflexive: ext3, Local: wan},
+			{Server: "c", Reflexive: ext1, Local: lan},
+			{Server: "d", Reflexive: ext3, Local: wan}}, transports.NATPortRestrictedCone},
+		{[]net.Addr{lan, wan}, []Probe{
+			{Server: "a", Reflexive: ext1, Local: lan},
+			{Server: "b", Reflexive: ext3, Local: wan},
+			{Server: "c", Reflexive: ext2, Local: lan}}, transports.NATSymmetric},
+	}
+
+	for i, row := range tab {
+		assert.Equal(row.typ, Classify(row.local, row.probes), "row %d", i)
+	}
+}
+
+func TestCanHolePunch(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(transports.CanHolePunch(transports.NATPortRestrictedCone, transports.NATPortRestrictedCone))
+	assert.True(transports.CanHolePunch(transports.NATFullCone, transports.NATSymmetric))
+	assert.True(transports.CanHolePunch(transports.NATSymmetric, transports.NATRestrictedCone))
+	assert.False(transports.CanHolePunch(transports.NATSymmetric, transports.NATPortRestrictedCone))
+	assert.False(transports.CanHolePunch(transports.NATSymmetric, transports.NATSymmetric))
+}
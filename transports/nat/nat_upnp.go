@@ -0,0 +1,170 @@
+package nat
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/huin/goupnp"
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/huin/goupnp/dcps/internetgateway1"
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/huin/goupnp/dcps/internetgateway2"
+)
+
+type upnpClient interface {
+	GetExternalIPAddress() (string, error)
+	AddPortMapping(remoteHost string, externalPort uint16, proto string, internalPort uint16, internalClient string, enabled bool, description string, lease uint32) error
+	DeletePortMapping(remoteHost string, externalPort uint16, proto string) error
+}
+
+type upnpGateway struct {
+	c      upnpClient
+	typ    string
+	device *goupnp.RootDevice
+
+	mtx   sync.Mutex
+	ports map[string]int
+}
+
+var _ Gateway = (*upnpGateway)(nil)
+
+// UPnP discovers UPnP Internet Gateway Devices (IGD version 1 and 2).
+func UPnP() Discoverer {
+	return DiscovererFunc(discoverUPnP)
+}
+
+func discoverUPnP() (Gateway, error) {
+	// in order of preference
+	var searches = []func() []*upnpGateway{
+		func() (gws []*upnpGateway) {
+			cs, _, _ := internetgateway2.NewWANIPConnection2Clients()
+			for _, c := range cs {
+				gws = append(gws, newUPnPGateway(c, "UPNP (IG2-IP2)", c.RootDevice))
+			}
+			return gws
+		},
+		func() (gws []*upnpGateway) {
+			cs, _, _ := internetgateway2.NewWANIPConnection1Clients()
+			for _, c := range cs {
+				gws = append(gws, newUPnPGateway(c, "UPNP (IG2-IP1)", c.RootDevice))
+			}
+			return gws
+		},
+		func() (gws []*upnpGateway) {
+			cs, _, _ := internetgateway2.NewWANPPPConnection1Clients()
+			for _, c := range cs {
+				gws = append(gws, newUPnPGateway(c, "UPNP (IG2-PPP1)", c.RootDevice))
+			}
+			return gws
+		},
+		func() (gws []*upnpGateway) {
+			cs, _, _ := internetgateway1.NewWANIPConnection1Clients()
+			for _, c := range cs {
+				gws = append(gws, newUPnPGateway(c, "UPNP (IG1-IP1)", c.RootDevice))
+			}
+			return gws
+		},
+		func() (gws []*upnpGateway) {
+			cs, _, _ := internetgateway1.NewWANPPPConnection1Clients()
+			for _, c := range cs {
+				gws = append(gws, newUPnPGateway(c, "UPNP (IG1-PPP1)", c.RootDevice))
+			}
+			return gws
+		},
+	}
+
+	var ds []Discoverer
+	for _, search := range searches {
+		search := search
+		ds = append(ds, DiscovererFunc(func() (Gateway, error) {
+			for _, gw := range search() {
+				if _, err := gw.GetExternalAddress(); err == nil {
+					return gw, nil
+				}
+			}
+			return nil, ErrNoGateway
+		}))
+	}
+
+	return discoverGateway(ds, discoverTimeout)
+}
+
+func newUPnPGateway(c upnpClient, typ string, device *goupnp.RootDevice) *upnpGateway {
+	return &upnpGateway{c: c, typ: typ, device: device, ports: make(map[string]int)}
+}
+
+func (u *upnpGateway) Type() string { return u.typ }
+
+func (u *upnpGateway) GetExternalAddress() (net.IP, error) {
+	s, err := u.c.GetExternalIPAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	ip := net.ParseIP(s)
+	if ip == nil || ip.IsUnspecified() {
+		return nil, fmt.Errorf("nat: invalid external address %q", s)
+	}
+	return ip, nil
+}
+
+func (u *upnpGateway) GetInternalAddress() (net.IP, error) {
+	host := u.device.URLBase.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, ErrNoGateway
+	}
+	return interfaceIPFor(ip)
+}
+
+func (u *upnpGateway) AddPortMapping(proto string, internalPort int, description string, lease time.Duration) (int, error) {
+	ip, err := u.GetInternalAddress()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		key     = fmt.Sprintf("%s:%d", proto, internalPort)
+		seconds = uint32(lease / time.Second)
+		uproto  = strings.ToUpper(proto)
+	)
+
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+
+	// renew the previous mapping, then try the internal port and a few
+	// random ports
+	candidates := []int{internalPort, 10000 + rand.Intn(55000), 10000 + rand.Intn(55000)}
+	if port := u.ports[key]; port > 0 {
+		candidates = append([]int{port}, candidates...)
+	}
+
+	for _, port := range candidates {
+		err = u.c.AddPortMapping("", uint16(port), uproto, uint16(internalPort), ip.String(), true, description, seconds)
+		if err == nil {
+			u.ports[key] = port
+			return port, nil
+		}
+	}
+	return 0, err
+}
+
+func (u *upnpGateway) DeletePortMapping(proto string, internalPort int) error {
+	key := fmt.Sprintf("%s:%d", proto, internalPort)
+
+	u.mtx.Lock()
+	port := u.ports[key]
+	delete(u.ports, key)
+	u.mtx.Unlock()
+
+	if port == 0 {
+		return nil
+	}
+	return u.c.DeletePortMapping("", uint16(port), strings.ToUpper(proto))
+}
@@ -0,0 +1,67 @@
+package transports
+
+// NATType classifies the NAT in front of an endpoint (RFC 3489).
+type NATType int
+
+const (
+	// NATUnknown is reported until enough probes were answered.
+	NATUnknown NATType = iota
+
+	// NATOpen means the endpoint is reachable at its local addresses.
+	NATOpen
+
+	// NATFullCone maps a local address to one external address and accepts
+	// packets from any host.
+	NATFullCone
+
+	// NATRestrictedCone maps a local address to one external address and
+	// accepts packets from the IPs the endpoint sent packets to.
+	NATRestrictedCone
+
+	// NATPortRestrictedCone maps a local address to one external address and
+	// accepts packets from the addresses (IP and port) the endpoint sent
+	// packets to.
+	NATPortRestrictedCone
+
+	// NATSymmetric maps a local address to a different external address for
+	// every destination.
+	NATSymmetric
+)
+
+func (t NATType) String() string {
+	switch t {
+	case NATOpen:
+		return "open"
+	case NATFullCone:
+		return "full-cone"
+	case NATRestrictedCone:
+		return "restricted-cone"
+	case NATPortRestrictedCone:
+		return "port-restricted-cone"
+	case NATSymmetric:
+		return "symmetric"
+	default:
+		return "unknown"
+	}
+}
+
+// CanHolePunch reports if two endpoints behind NATs of type a and b can open a
+// direct path by sending packets to each other at the same time. When it
+// returns false the endpoints should use a relay (bridge) instead.
+func CanHolePunch(a, b NATType) bool {
+	if a == NATSymmetric {
+		a, b = b, a
+	}
+	if b != NATSymmetric {
+		return true
+	}
+
+	// the external port of the symmetric side is only known to the other side
+	// when a packet arrives; only NATs that ignore the port let it in.
+	switch a {
+	case NATSymmetric, NATPortRestrictedCone:
+		return false
+	default:
+		return true
+	}
+}
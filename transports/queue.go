@@ -0,0 +1,15 @@
+package transports
+
+// DropPolicy decides which packet is dropped when the inbound queue of a
+// connection is full.
+type DropPolicy int
+
+const (
+	// DropNewest drops the packets that arrive at a full queue. Bursts that
+	// fit the queue are delivered without loss.
+	DropNewest DropPolicy = iota
+
+	// DropOldest drops the oldest queued packet to make room for a new one.
+	// Packets wait less under load; older packets are lost instead.
+	DropOldest
+)
@@ -0,0 +1,233 @@
+package serial
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// Framing selects how packets are delimited on the serial line.
+type Framing int
+
+const (
+	// COBS frames packets with Consistent Overhead Byte Stuffing; each frame
+	// starts and ends with a zero byte.
+	COBS Framing = iota
+
+	// SLIP frames packets as in RFC 1055.
+	SLIP
+)
+
+func (f Framing) String() string {
+	switch f {
+	case COBS:
+		return "COBS"
+	case SLIP:
+		return "SLIP"
+	default:
+		return "unknown"
+	}
+}
+
+var errInvalidFrame = errors.New("serial: invalid frame")
+
+const (
+	slipEnd    = 0xC0
+	slipEsc    = 0xDB
+	slipEscEnd = 0xDC
+	slipEscEsc = 0xDD
+)
+
+// maxFrameSize is the largest decoded frame that is accepted.
+const maxFrameSize = 1472
+
+// appendFrame appends the frame of packet to dst.
+func (f Framing) appendFrame(dst, packet []byte) []byte {
+	if f == SLIP {
+		return appendSLIP(dst, packet)
+	}
+	return appendCOBS(dst, packet)
+}
+
+func appendCOBS(dst, packet []byte) []byte {
+	// the leading zero flushes line noise received before the frame
+	dst = append(dst, 0)
+
+	code := len(dst)
+	dst = append(dst, 0)
+
+	for _, c := range packet {
+		if c != 0 {
+			dst = append(dst, c)
+		}
+		if c == 0 || len(dst)-code == 0xFF {
+			dst[code] = byte(len(dst) - code)
+			code = len(dst)
+			dst = append(dst, 0)
+		}
+	}
+
+	dst[code] = byte(len(dst) - code)
+	return append(dst, 0)
+}
+
+func appendSLIP(dst, packet []byte) []byte {
+	// the leading END flushes line noise received before the frame
+	dst = append(dst, slipEnd)
+
+	for _, c := range packet {
+		switch c {
+		case slipEnd:
+			dst = append(dst, slipEsc, slipEscEnd)
+		case slipEsc:
+			dst = append(dst, slipEsc, slipEscEsc)
+		default:
+			dst = append(dst, c)
+		}
+	}
+
+	return append(dst, slipEnd)
+}
+
+// frameReader reads frames from a serial line.
+type frameReader struct {
+	framing Framing
+	r       *bufio.Reader
+	buf     []byte
+}
+
+func newFrameReader(r io.Reader, framing Framing) *frameReader {
+	return &frameReader{
+		framing: framing,
+		r:       bufio.NewReader(r),
+		buf:     make([]byte, 0, 2*maxFrameSize),
+	}
+}
+
+// ReadFrame returns the next non-empty packet. The packet is only valid
+// until the next call. errInvalidFrame is returned for frames that can't be
+// decoded or are too large; reading can continue with the next frame.
+func (r *frameReader) ReadFrame() ([]byte, error) {
+	var delim byte
+	if r.framing == SLIP {
+		delim = slipEnd
+	}
+
+	for {
+		raw, err := r.readRaw(delim)
+		if err != nil {
+			return nil, err
+		}
+		if raw == nil {
+			return nil, errInvalidFrame
+		}
+		if len(raw) == 0 {
+			// frames start with a delimiter; repeated delimiters are padding
+			continue
+		}
+
+		var packet []byte
+		if r.framing == SLIP {
+			packet, err = decodeSLIP(raw)
+		} else {
+			packet, err = decodeCOBS(raw)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(packet) == 0 {
+			continue
+		}
+
+		return packet, nil
+	}
+}
+
+// readRaw reads up to the next delimiter. It returns a nil slice when the
+// frame is too large (the frame is skipped).
+func (r *frameReader) readRaw(delim byte) ([]byte, error) {
+	r.buf = r.buf[:0]
+	tooLarge := false
+
+	for {
+		chunk, err := r.r.ReadSlice(delim)
+		if err != nil && err != bufio.ErrBufferFull {
+			return nil, err
+		}
+
+		if !tooLarge && len(r.buf)+len(chunk) <= cap(r.buf) {
+			r.buf = append(r.buf, chunk...)
+		} else {
+			tooLarge = true
+		}
+
+		if err == nil {
+			break
+		}
+	}
+
+	if tooLarge {
+		return nil, nil
+	}
+
+	return r.buf[:len(r.buf)-1], nil
+}
+
+// decodeCOBS decodes the COBS frame in place.
+func decodeCOBS(frame []byte) ([]byte, error) {
+	var (
+		out = frame[:0]
+		i   = 0
+	)
+
+	for i < len(frame) {
+		code := int(frame[i])
+		if code == 0 || i+code > len(frame) {
+			return nil, errInvalidFrame
+		}
+
+		out = append(out, frame[i+1:i+code]...)
+		i += code
+
+		if code < 0xFF && i < len(frame) {
+			out = append(out, 0)
+		}
+	}
+
+	if len(out) > maxFrameSize {
+		return nil, errInvalidFrame
+	}
+	return out, nil
+}
+
+// decodeSLIP decodes the SLIP frame in place.
+func decodeSLIP(frame []byte) ([]byte, error) {
+	var (
+		out = frame[:0]
+		esc = false
+	)
+
+	for _, c := range frame {
+		if esc {
+			switch c {
+			case slipEscEnd:
+				c = slipEnd
+			case slipEscEsc:
+				c = slipEsc
+			default:
+				return nil, errInvalidFrame
+			}
+			esc = false
+		} else if c == slipEsc {
+			esc = true
+			continue
+		}
+
+		out = append(out, c)
+	}
+
+	if esc || len(out) > maxFrameSize {
+		return nil, errInvalidFrame
+	}
+	return out, nil
+}
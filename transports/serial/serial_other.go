@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package serial
+
+import (
+	"os"
+	"syscall"
+)
+
+// openPort opens the serial device at path. The line settings are not
+// changed; the port must already be configured (with stty for example).
+func openPort(path string, baud int) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0)
+}
@@ -0,0 +1,197 @@
+// Package serial implements a transport over a serial port (UART, RS-485).
+//
+// A serial line is a point-to-point link: the transport exchanges packets
+// with the one peer at the other end of the line. Packets are framed with
+// COBS (the default) or SLIP so microcontrollers can parse them with a few
+// lines of code:
+//
+//	e3x.New(keys, serial.Config{Port: "/dev/ttyUSB0", Baud: 115200})
+//
+// The address of the transport names the local port; it is only meaningful
+// to the endpoint that owns the port.
+package serial
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/telehash/gogotelehash/transports"
+	"github.com/telehash/gogotelehash/transports/dgram"
+)
+
+func init() {
+	transports.RegisterAddr(&serialAddr{})
+
+	transports.RegisterResolver("serial", func(str string) (net.Addr, error) {
+		if str == "" {
+			return nil, transports.ErrInvalidAddr
+		}
+		return &serialAddr{port: str}, nil
+	})
+}
+
+// DefaultBaud is the baud rate when Config.Baud is not set.
+const DefaultBaud = 115200
+
+// Config for the serial transport.
+type Config struct {
+	// Port is the path of the serial device ("/dev/ttyUSB0").
+	Port string
+
+	// Baud is the baud rate of the line. Defaults to DefaultBaud.
+	Baud int
+
+	// Framing of the packets on the line. Defaults to COBS.
+	Framing Framing
+
+	// Device, when set, is used instead of opening Port (for example a pipe,
+	// or a device that was configured by the application). Port still names
+	// the link.
+	Device io.ReadWriteCloser
+}
+
+type serialAddr struct {
+	port string
+}
+
+type transport struct {
+	addr    *serialAddr
+	dev     io.ReadWriteCloser
+	framing Framing
+	r       *frameReader
+
+	mtxWrite sync.Mutex
+	wbuf     []byte
+}
+
+var (
+	_ dgram.Addr        = (*serialAddr)(nil)
+	_ dgram.Transport   = (*transport)(nil)
+	_ transports.Config = Config{}
+)
+
+// Open opens the transport.
+func (c Config) Open() (transports.Transport, error) {
+	if c.Port == "" {
+		return nil, errors.New("serial: missing Port")
+	}
+	if c.Framing != COBS && c.Framing != SLIP {
+		return nil, errors.New("serial: unknown framing")
+	}
+	if c.Baud == 0 {
+		c.Baud = DefaultBaud
+	}
+
+	dev := c.Device
+	if dev == nil {
+		f, err := openPort(c.Port, c.Baud)
+		if err != nil {
+			return nil, err
+		}
+		dev = f
+	}
+
+	return dgram.Wrap(&transport{
+		addr:    &serialAddr{port: c.Port},
+		dev:     dev,
+		framing: c.Framing,
+		r:       newFrameReader(dev, c.Framing),
+	})
+}
+
+// NormalizeAddr only accepts the address of the port of the transport; it
+// leads to the peer at the other end of the line.
+func (t *transport) NormalizeAddr(addr net.Addr) (dgram.Addr, error) {
+	if a, ok := addr.(*serialAddr); ok && a.port == t.addr.port {
+		return t.addr, nil
+	}
+	return nil, transports.ErrInvalidAddr
+}
+
+func (t *transport) Read(p []byte) (int, dgram.Addr, error) {
+	for {
+		packet, err := t.r.ReadFrame()
+		if err == errInvalidFrame {
+			// line noise or a frame that was cut off
+			continue
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(packet) > len(p) {
+			continue
+		}
+
+		return copy(p, packet), t.addr, nil
+	}
+}
+
+func (t *transport) Write(p []byte, dst dgram.Addr) (int, error) {
+	if a, ok := dst.(*serialAddr); !ok || a.port != t.addr.port {
+		return 0, transports.ErrInvalidAddr
+	}
+
+	t.mtxWrite.Lock()
+	defer t.mtxWrite.Unlock()
+
+	t.wbuf = t.framing.appendFrame(t.wbuf[:0], p)
+
+	_, err := t.dev.Write(t.wbuf)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (t *transport) Addrs() []net.Addr {
+	return []net.Addr{t.addr}
+}
+
+func (t *transport) Close() error {
+	return t.dev.Close()
+}
+
+func (a *serialAddr) Network() string {
+	return "serial"
+}
+
+func (a *serialAddr) String() string {
+	return a.port
+}
+
+func (a *serialAddr) Key() interface{} {
+	return a.port
+}
+
+func (a *serialAddr) MarshalJSON() ([]byte, error) {
+	var desc = struct {
+		Type string `json:"type"`
+		Port string `json:"port"`
+	}{
+		Type: "serial",
+		Port: a.port,
+	}
+	return json.Marshal(&desc)
+}
+
+func (a *serialAddr) UnmarshalJSON(data []byte) error {
+	var desc struct {
+		Port string `json:"port"`
+	}
+
+	err := json.Unmarshal(data, &desc)
+	if err != nil {
+		return err
+	}
+
+	if desc.Port == "" {
+		return transports.ErrInvalidAddr
+	}
+
+	a.port = desc.Port
+	return nil
+}
@@ -0,0 +1,165 @@
+package serial
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+	"github.com/telehash/gogotelehash/transports"
+)
+
+var testPackets = [][]byte{
+	{0x01},
+	{0x00},
+	{0x00, 0x00},
+	{slipEnd, slipEsc, slipEscEnd, slipEscEsc},
+	bytes.Repeat([]byte{0x11}, 253),
+	bytes.Repeat([]byte{0x11}, 254),
+	bytes.Repeat([]byte{0x11}, 255),
+	append(bytes.Repeat([]byte{0x11}, 254), 0x00),
+	bytes.Repeat([]byte{0x00, 0xC0, 0x42}, 490),
+}
+
+func TestFraming(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, framing := range []Framing{COBS, SLIP} {
+		var stream []byte
+		for _, p := range testPackets {
+			frame := framing.appendFrame(nil, p)
+			if framing == COBS {
+				assert.Equal(-1, bytes.IndexByte(frame[1:len(frame)-1], 0), "%s", framing)
+			}
+			stream = append(stream, frame...)
+		}
+
+		r := newFrameReader(bytes.NewReader(stream), framing)
+		for _, p := range testPackets {
+			packet, err := r.ReadFrame()
+			if assert.NoError(err, "%s", framing) {
+				assert.Equal(p, packet, "%s", framing)
+			}
+		}
+
+		_, err := r.ReadFrame()
+		assert.Equal(io.EOF, err, "%s", framing)
+	}
+}
+
+func TestFramingRecovers(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, framing := range []Framing{COBS, SLIP} {
+		var stream []byte
+
+		// line noise and an oversized frame are skipped
+		stream = append(stream, 0x05, 0x01, 0x00)
+		stream = append(stream, slipEsc, 0x01, slipEnd)
+		stream = append(stream, bytes.Repeat([]byte{0x42}, 4000)...)
+		stream = framing.appendFrame(stream, []byte("hello"))
+
+		r := newFrameReader(bytes.NewReader(stream), framing)
+
+		for {
+			packet, err := r.ReadFrame()
+			if err == errInvalidFrame {
+				continue
+			}
+			if assert.NoError(err, "%s", framing) {
+				assert.Equal("hello", string(packet), "%s", framing)
+			}
+			break
+		}
+	}
+}
+
+func TestDialAccept(t *testing.T) {
+	assert := assert.New(t)
+
+	devA, devB := pipeDevices()
+
+	A, err := Config{Port: "/dev/ttyA", Device: devA, Framing: SLIP}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := Config{Port: "/dev/ttyB", Device: devB, Framing: SLIP}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	dst, err := transports.ResolveAddr("serial", "/dev/ttyA")
+	if !assert.NoError(err) {
+		return
+	}
+
+	// only the own port can be dialed
+	_, err = A.Dial(B.Addrs()[0])
+	assert.Equal(transports.ErrInvalidAddr, err)
+
+	c1, err := A.Dial(dst)
+	if !assert.NoError(err) {
+		return
+	}
+
+	_, err = c1.Write([]byte("hello"))
+	assert.NoError(err)
+
+	c2, err := B.Accept()
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal("/dev/ttyB", c2.RemoteAddr().String())
+
+	buf := make([]byte, 1500)
+	n, err := c2.Read(buf)
+	assert.NoError(err)
+	assert.Equal("hello", string(buf[:n]))
+
+	_, err = c2.Write([]byte("world"))
+	assert.NoError(err)
+
+	n, err = c1.Read(buf)
+	assert.NoError(err)
+	assert.Equal("world", string(buf[:n]))
+}
+
+func TestAddrJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	a, err := transports.ResolveAddr("serial", "/dev/ttyUSB0")
+	if !assert.NoError(err) {
+		return
+	}
+
+	data, err := transports.EncodeAddr(a)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(`{"type":"serial","port":"/dev/ttyUSB0"}`, string(data))
+
+	b, err := transports.DecodeAddr(data)
+	if assert.NoError(err) {
+		assert.Equal(a, b)
+	}
+}
+
+type pipeDevice struct {
+	*io.PipeReader
+	*io.PipeWriter
+}
+
+func (d *pipeDevice) Close() error {
+	d.PipeReader.Close()
+	return d.PipeWriter.Close()
+}
+
+// pipeDevices returns the two ends of a simulated serial line.
+func pipeDevices() (a, b io.ReadWriteCloser) {
+	ra, wb := io.Pipe()
+	rb, wa := io.Pipe()
+	return &pipeDevice{ra, wa}, &pipeDevice{rb, wb}
+}
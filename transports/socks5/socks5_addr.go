@@ -0,0 +1,110 @@
+package socks5
+
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/telehash/gogotelehash/transports"
+)
+
+func init() {
+	transports.RegisterAddr(&onionAddr{})
+
+	transports.RegisterResolver("onion", func(str string) (net.Addr, error) {
+		return parseOnionAddr(str)
+	})
+}
+
+// onionAddr is the address of a Tor onion service. It can only be dialed
+// through Tor.
+type onionAddr struct {
+	host string
+	port uint16
+}
+
+func parseOnionAddr(str string) (*onionAddr, error) {
+	host, portStr, err := net.SplitHostPort(str)
+	if err != nil {
+		return nil, transports.ErrInvalidAddr
+	}
+
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, transports.ErrInvalidAddr
+	}
+
+	a := &onionAddr{host: strings.ToLower(host), port: uint16(port)}
+	if !a.valid() {
+		return nil, transports.ErrInvalidAddr
+	}
+
+	return a, nil
+}
+
+// valid reports whether a is a v2 (16 character) or v3 (56 character) onion
+// address.
+func (a *onionAddr) valid() bool {
+	if a.port == 0 || !strings.HasSuffix(a.host, ".onion") {
+		return false
+	}
+
+	name := strings.TrimSuffix(a.host, ".onion")
+	if len(name) != 16 && len(name) != 56 {
+		return false
+	}
+
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '2' && c <= '7') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (a *onionAddr) Network() string { return "onion" }
+
+func (a *onionAddr) String() string {
+	return net.JoinHostPort(a.host, strconv.Itoa(int(a.port)))
+}
+
+func (a *onionAddr) Equal(other net.Addr) bool {
+	b, ok := other.(*onionAddr)
+	return ok && a.host == b.host && a.port == b.port
+}
+
+func (a *onionAddr) MarshalJSON() ([]byte, error) {
+	var desc = struct {
+		Type string `json:"type"`
+		Host string `json:"host"`
+		Port uint16 `json:"port"`
+	}{
+		Type: a.Network(),
+		Host: a.host,
+		Port: a.port,
+	}
+
+	return json.Marshal(&desc)
+}
+
+func (a *onionAddr) UnmarshalJSON(data []byte) error {
+	var desc struct {
+		Host string `json:"host"`
+		Port uint16 `json:"port"`
+	}
+
+	err := json.Unmarshal(data, &desc)
+	if err != nil {
+		return transports.ErrInvalidAddr
+	}
+
+	x := onionAddr{host: strings.ToLower(desc.Host), port: desc.Port}
+	if !x.valid() {
+		return transports.ErrInvalidAddr
+	}
+
+	*a = x
+	return nil
+}
@@ -0,0 +1,231 @@
+package socks5
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// The SOCKS5 client (RFC 1928) with username/password authentication (RFC
+// 1929). Only the CONNECT command is implemented.
+
+// DefaultProxy is the address of the SOCKS5 port of a local Tor daemon.
+const DefaultProxy = "127.0.0.1:9050"
+
+// DefaultTimeout is used when Dialer.Timeout is not set.
+const DefaultTimeout = 30 * time.Second
+
+var (
+	ErrAuthRejected = errors.New("socks5: proxy rejected authentication")
+	errProtocol     = errors.New("socks5: protocol error")
+)
+
+// replyErrors are the errors for the reply codes of the proxy.
+var replyErrors = []string{
+	1: "general SOCKS server failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// A Dialer opens TCP connections through a SOCKS5 proxy. Host names are
+// resolved by the proxy, so .onion names can be dialed through Tor and DNS
+// queries don't leak.
+//
+// Dial can be used as the Dial function of other transports (for example
+// ws.Config).
+type Dialer struct {
+	// Proxy is the address of the SOCKS5 proxy. Defaults to DefaultProxy.
+	Proxy string
+
+	// Username and Password are sent when Username is set. Tor isolates
+	// streams with different credentials onto different circuits.
+	Username string
+	Password string
+
+	// Timeout limits connecting to the proxy and the proxy connecting to the
+	// destination. Defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Dial connects to address (host:port) through the proxy. network must be
+// tcp, tcp4 or tcp6.
+func (d *Dialer) Dial(network, address string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, errors.New("socks5: unsupported network " + network)
+	}
+
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil || port == 0 {
+		return nil, errors.New("socks5: invalid port " + portStr)
+	}
+	if len(host) > 255 {
+		return nil, errors.New("socks5: host name too long")
+	}
+
+	proxy := d.Proxy
+	if proxy == "" {
+		proxy = DefaultProxy
+	}
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	conn, err := net.DialTimeout("tcp", proxy, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	err = d.connect(conn, host, uint16(port))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func (d *Dialer) connect(conn net.Conn, host string, port uint16) error {
+	var buf = make([]byte, 0, 6+255)
+
+	{ // greeting
+		if d.Username != "" {
+			buf = append(buf, 5, 2, 0x00, 0x02)
+		} else {
+			buf = append(buf, 5, 1, 0x00)
+		}
+
+		_, err := conn.Write(buf)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.ReadFull(conn, buf[:2])
+		if err != nil {
+			return err
+		}
+		if buf[0] != 5 {
+			return errProtocol
+		}
+
+		switch buf[1] {
+		case 0x00:
+			// no authentication
+		case 0x02:
+			if d.Username == "" {
+				return errProtocol
+			}
+			err = d.authenticate(conn)
+			if err != nil {
+				return err
+			}
+		default:
+			return ErrAuthRejected
+		}
+	}
+
+	{ // connect
+		buf = append(buf[:0], 5, 1, 0)
+
+		ip := net.ParseIP(host)
+		if ip4 := ip.To4(); ip4 != nil {
+			buf = append(buf, 1)
+			buf = append(buf, ip4...)
+		} else if ip != nil {
+			buf = append(buf, 4)
+			buf = append(buf, ip.To16()...)
+		} else {
+			buf = append(buf, 3, byte(len(host)))
+			buf = append(buf, host...)
+		}
+		buf = append(buf, byte(port>>8), byte(port))
+
+		_, err := conn.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	{ // reply
+		_, err := io.ReadFull(conn, buf[:4])
+		if err != nil {
+			return err
+		}
+		if buf[0] != 5 {
+			return errProtocol
+		}
+		if rep := int(buf[1]); rep != 0 {
+			if rep < len(replyErrors) {
+				return errors.New("socks5: " + replyErrors[rep])
+			}
+			return errors.New("socks5: unknown reply " + strconv.Itoa(rep))
+		}
+
+		// skip the bound address
+		var n int
+		switch buf[3] {
+		case 1:
+			n = net.IPv4len
+		case 4:
+			n = net.IPv6len
+		case 3:
+			_, err = io.ReadFull(conn, buf[:1])
+			if err != nil {
+				return err
+			}
+			n = int(buf[0])
+		default:
+			return errProtocol
+		}
+
+		_, err = io.ReadFull(conn, buf[:n+2])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Dialer) authenticate(conn net.Conn) error {
+	if len(d.Username) > 255 || len(d.Password) > 255 {
+		return errors.New("socks5: username or password too long")
+	}
+
+	buf := make([]byte, 0, 3+len(d.Username)+len(d.Password))
+	buf = append(buf, 1, byte(len(d.Username)))
+	buf = append(buf, d.Username...)
+	buf = append(buf, byte(len(d.Password)))
+	buf = append(buf, d.Password...)
+
+	_, err := conn.Write(buf)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.ReadFull(conn, buf[:2])
+	if err != nil {
+		return err
+	}
+	if buf[0] != 1 || buf[1] != 0 {
+		return ErrAuthRejected
+	}
+
+	return nil
+}
@@ -0,0 +1,271 @@
+// Package socks5 implements a transport that dials TCP connections through a
+// SOCKS5 proxy (like Tor).
+//
+// All outbound connections go through the proxy; host names (including
+// .onion names) are resolved by the proxy. Incoming connections are accepted
+// by the wrapped stream transport, for example the local port a Tor onion
+// service forwards to:
+//
+//	e3x.Open(e3x.Transport(socks5.Config{
+//	  Config: tcp.Config{Addr: "127.0.0.1:4242"},
+//	  Onion:  "<name>.onion:4242",
+//	}))
+//
+// Only the onion address is advertised so the endpoint doesn't reveal its
+// location. The transport is also a transports.StreamConfig so it can be
+// wrapped in TLS. WebSocket connections can be dialed through the proxy with
+// Dialer.Dial (see ws.Config.Dial).
+//
+// Packets are framed with a 2 byte (big endian) length prefix.
+package socks5
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/telehash/gogotelehash/transports"
+)
+
+// Config for the SOCKS5 transport.
+type Config struct {
+	// Dialer connects to the proxy.
+	Dialer
+
+	// Config is the stream transport that accepts incoming connections. When
+	// Config is nil the transport only dials.
+	Config transports.StreamConfig
+
+	// Onion is the address ("<name>.onion:<port>") of the onion service of the
+	// endpoint. It is the only address the transport advertises.
+	Onion string
+}
+
+type streamTransport struct {
+	dialer Dialer
+	inner  transports.StreamTransport
+	onion  *onionAddr
+
+	done   chan struct{}
+	mtx    sync.Mutex
+	closed bool
+}
+
+// streamConn is a stream which reports the dialed address.
+type streamConn struct {
+	net.Conn
+	laddr net.Addr
+	raddr net.Addr
+}
+
+type transport struct {
+	s *streamTransport
+}
+
+type connection struct {
+	conn     net.Conn
+	bufr     *bufio.Reader
+	mtxWrite sync.Mutex
+	mtxRead  sync.Mutex
+}
+
+var (
+	_ transports.Transport       = (*transport)(nil)
+	_ transports.StreamTransport = (*streamTransport)(nil)
+	_ transports.Config          = Config{}
+	_ transports.StreamConfig    = Config{}
+)
+
+// Open opens the transport.
+func (c Config) Open() (transports.Transport, error) {
+	s, err := c.open()
+	if err != nil {
+		return nil, err
+	}
+	return &transport{s}, nil
+}
+
+// OpenStream opens the transport without framing. It is used by transports
+// that wrap it (like TLS).
+func (c Config) OpenStream() (transports.StreamTransport, error) {
+	return c.open()
+}
+
+func (c Config) open() (*streamTransport, error) {
+	t := &streamTransport{dialer: c.Dialer, done: make(chan struct{})}
+
+	if c.Onion != "" {
+		onion, err := parseOnionAddr(c.Onion)
+		if err != nil {
+			return nil, err
+		}
+		t.onion = onion
+	}
+
+	if c.Config != nil {
+		inner, err := c.Config.OpenStream()
+		if err != nil {
+			return nil, err
+		}
+		t.inner = inner
+	}
+
+	return t, nil
+}
+
+func (t *streamTransport) Addrs() []net.Addr {
+	if t.onion == nil {
+		return nil
+	}
+	return []net.Addr{t.onion}
+}
+
+func (t *streamTransport) DialStream(addr net.Addr) (net.Conn, error) {
+	switch addr.Network() {
+	case "onion", "tcp4", "tcp6", "tcp":
+	default:
+		return nil, transports.ErrInvalidAddr
+	}
+
+	t.mtx.Lock()
+	closed := t.closed
+	t.mtx.Unlock()
+	if closed {
+		return nil, io.EOF
+	}
+
+	conn, err := t.dialer.Dial("tcp", addr.String())
+	if err != nil {
+		return nil, err
+	}
+
+	var laddr net.Addr = t.onion
+	if t.onion == nil {
+		laddr = conn.LocalAddr()
+	}
+
+	return &streamConn{Conn: conn, laddr: laddr, raddr: addr}, nil
+}
+
+func (t *streamTransport) AcceptStream() (net.Conn, error) {
+	if t.inner == nil {
+		<-t.done
+		return nil, io.EOF
+	}
+	return t.inner.AcceptStream()
+}
+
+func (t *streamTransport) Close() error {
+	t.mtx.Lock()
+	if t.closed {
+		t.mtx.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.done)
+	t.mtx.Unlock()
+
+	if t.inner != nil {
+		return t.inner.Close()
+	}
+	return nil
+}
+
+func (c *streamConn) LocalAddr() net.Addr  { return c.laddr }
+func (c *streamConn) RemoteAddr() net.Addr { return c.raddr }
+
+func (t *transport) Addrs() []net.Addr {
+	return t.s.Addrs()
+}
+
+func (t *transport) Dial(addr net.Addr) (net.Conn, error) {
+	conn, err := t.s.DialStream(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &connection{conn: conn, bufr: bufio.NewReader(conn)}, nil
+}
+
+func (t *transport) Accept() (net.Conn, error) {
+	conn, err := t.s.AcceptStream()
+	if err != nil {
+		return nil, err
+	}
+	return &connection{conn: conn, bufr: bufio.NewReader(conn)}, nil
+}
+
+func (t *transport) Close() error {
+	return t.s.Close()
+}
+
+func (c *connection) Read(b []byte) (n int, err error) {
+	var hdr [2]byte
+
+	c.mtxRead.Lock()
+	defer c.mtxRead.Unlock()
+
+	_, err = io.ReadFull(c.bufr, hdr[:])
+	if err != nil {
+		return 0, err
+	}
+
+	msgLen := int(binary.BigEndian.Uint16(hdr[:]))
+	if msgLen > len(b) {
+		// skip the packet; the stream stays in sync
+		_, err = c.bufr.Discard(msgLen)
+		if err != nil {
+			return 0, err
+		}
+		return 0, io.ErrShortBuffer
+	}
+
+	return io.ReadFull(c.bufr, b[:msgLen])
+}
+
+func (c *connection) Write(b []byte) (n int, err error) {
+	var lenB = len(b)
+	if lenB > 1472 {
+		return 0, io.ErrShortWrite
+	}
+
+	var buf [2 + 1472]byte
+	binary.BigEndian.PutUint16(buf[:2], uint16(lenB))
+	copy(buf[2:], b)
+
+	c.mtxWrite.Lock()
+	defer c.mtxWrite.Unlock()
+
+	_, err = c.conn.Write(buf[:2+lenB])
+	if err != nil {
+		return 0, err
+	}
+
+	return lenB, nil
+}
+
+func (c *connection) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+func (c *connection) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *connection) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+func (c *connection) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *connection) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *connection) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,291 @@
+package socks5
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+	"github.com/telehash/gogotelehash/transports"
+	"github.com/telehash/gogotelehash/transports/tcp"
+	"github.com/telehash/gogotelehash/transports/ws"
+)
+
+const testOnion = "abcdefghijklmnopqrstuvwxyz234567abcdefghijklmnopqrstuvwx.onion"
+
+func TestDialTCP(t *testing.T) {
+	assert := assert.New(t)
+
+	proxy := startProxy(t, "", "", nil)
+	defer proxy.Close()
+
+	A, err := Config{Dialer: Dialer{Proxy: proxy.Addr().String()}}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+	assert.Empty(A.Addrs())
+
+	B, err := tcp.Config{Addr: "127.0.0.1:0"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	testRoundTrip(t, A, B, B.Addrs()[0])
+	assert.Equal(B.Addrs()[0].String(), <-proxy.requests)
+}
+
+func TestDialOnion(t *testing.T) {
+	assert := assert.New(t)
+
+	B, err := Config{Config: tcp.Config{Addr: "127.0.0.1:0"}, Onion: testOnion + ":4242"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	addrs := B.Addrs()
+	if !assert.Len(addrs, 1) {
+		return
+	}
+	assert.Equal("onion", addrs[0].Network())
+
+	// the proxy plays the role of Tor
+	local := B.(*transport).s.inner.Addrs()[0].String()
+	proxy := startProxy(t, "user", "secret", map[string]string{testOnion + ":4242": local})
+	defer proxy.Close()
+
+	A, err := Config{Dialer: Dialer{Proxy: proxy.Addr().String(), Username: "user", Password: "secret"}}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	testRoundTrip(t, A, B, addrs[0])
+	assert.Equal(testOnion+":4242", <-proxy.requests)
+}
+
+func TestDialAuthRejected(t *testing.T) {
+	assert := assert.New(t)
+
+	proxy := startProxy(t, "user", "secret", nil)
+	defer proxy.Close()
+
+	d := Dialer{Proxy: proxy.Addr().String(), Username: "user", Password: "wrong"}
+	_, err := d.Dial("tcp", "127.0.0.1:80")
+	assert.Equal(ErrAuthRejected, err)
+
+	d = Dialer{Proxy: proxy.Addr().String()}
+	_, err = d.Dial("tcp", "127.0.0.1:80")
+	assert.Equal(ErrAuthRejected, err)
+}
+
+func TestDialWebSocket(t *testing.T) {
+	assert := assert.New(t)
+
+	proxy := startProxy(t, "", "", nil)
+	defer proxy.Close()
+
+	d := &Dialer{Proxy: proxy.Addr().String()}
+
+	A, err := ws.Config{Dial: d.Dial}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := ws.Config{Addr: "127.0.0.1:0"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	testRoundTrip(t, A, B, B.Addrs()[0])
+	assert.NotEmpty(<-proxy.requests)
+}
+
+func TestOnionAddr(t *testing.T) {
+	assert := assert.New(t)
+
+	a, err := transports.ResolveAddr("onion", "ABCDEFGHIJKLMNOP.onion:80")
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal("abcdefghijklmnop.onion:80", a.String())
+
+	data, err := transports.EncodeAddr(a)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(`{"type":"onion","host":"abcdefghijklmnop.onion","port":80}`, string(data))
+
+	b, err := transports.DecodeAddr(data)
+	if assert.NoError(err) {
+		assert.True(transports.EqualAddr(a, b))
+	}
+
+	var invalid = []string{
+		"example.com:80",
+		"abcdefghijklmnop.onion:0",
+		"abcdefghijklmno1.onion:80",
+		"abcdefghijklmnopq.onion:80",
+		"abcdefghijklmnop.onion",
+	}
+	for _, s := range invalid {
+		_, err = transports.ResolveAddr("onion", s)
+		assert.Error(err, s)
+	}
+
+	_, err = transports.DecodeAddr([]byte(`{"type":"onion","host":"example.com","port":80}`))
+	assert.Error(err)
+}
+
+func testRoundTrip(t *testing.T, A, B transports.Transport, dst net.Addr) {
+	assert := assert.New(t)
+
+	c1, err := A.Dial(dst)
+	if !assert.NoError(err) {
+		return
+	}
+	defer c1.Close()
+
+	_, err = c1.Write([]byte("hello"))
+	assert.NoError(err)
+
+	c2, err := B.Accept()
+	if !assert.NoError(err) {
+		return
+	}
+	defer c2.Close()
+
+	buf := make([]byte, 1500)
+	n, err := c2.Read(buf)
+	assert.NoError(err)
+	assert.Equal("hello", string(buf[:n]))
+
+	_, err = c2.Write([]byte("world"))
+	assert.NoError(err)
+
+	n, err = c1.Read(buf)
+	assert.NoError(err)
+	assert.Equal("world", string(buf[:n]))
+}
+
+type testProxy struct {
+	net.Listener
+	requests chan string
+}
+
+// startProxy starts a SOCKS5 server. When username is set the client must
+// authenticate. Requested destinations are mapped with hosts and sent on
+// requests.
+func startProxy(t *testing.T, username, password string, hosts map[string]string) *testProxy {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &testProxy{Listener: l, requests: make(chan string, 10)}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go p.serve(conn, username, password, hosts)
+		}
+	}()
+
+	return p
+}
+
+func (p *testProxy) serve(conn net.Conn, username, password string, hosts map[string]string) {
+	var buf [512]byte
+
+	fail := func() { conn.Close() }
+
+	// greeting
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		fail()
+		return
+	}
+	methods := buf[:buf[1]]
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		fail()
+		return
+	}
+
+	want := byte(0x00)
+	if username != "" {
+		want = 0x02
+	}
+	found := false
+	for _, m := range methods {
+		found = found || m == want
+	}
+	if !found {
+		conn.Write([]byte{5, 0xFF})
+		fail()
+		return
+	}
+	conn.Write([]byte{5, want})
+
+	if username != "" {
+		io.ReadFull(conn, buf[:2])
+		user := make([]byte, buf[1])
+		io.ReadFull(conn, user)
+		io.ReadFull(conn, buf[:1])
+		pass := make([]byte, buf[0])
+		io.ReadFull(conn, pass)
+
+		if string(user) != username || string(pass) != password {
+			conn.Write([]byte{1, 1})
+			fail()
+			return
+		}
+		conn.Write([]byte{1, 0})
+	}
+
+	// request
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		fail()
+		return
+	}
+
+	var host string
+	switch buf[3] {
+	case 1:
+		io.ReadFull(conn, buf[:4])
+		host = net.IP(buf[:4]).String()
+	case 4:
+		io.ReadFull(conn, buf[:16])
+		host = net.IP(buf[:16]).String()
+	case 3:
+		io.ReadFull(conn, buf[:1])
+		name := make([]byte, buf[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	}
+	io.ReadFull(conn, buf[:2])
+	dst := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(buf[:2]))))
+	p.requests <- dst
+
+	if mapped, ok := hosts[dst]; ok {
+		dst = mapped
+	}
+
+	upstream, err := net.Dial("tcp", dst)
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		fail()
+		return
+	}
+	conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+
+	go func() { io.Copy(upstream, conn); upstream.Close() }()
+	go func() { io.Copy(conn, upstream); conn.Close() }()
+}
@@ -0,0 +1,32 @@
+package transports
+
+import (
+	"net"
+)
+
+// StreamConfig is implemented by the configurations of transports that run on
+// top of a byte stream (like TCP). Wrapping transports (like TLS) use it to
+// get at the raw streams and add their own framing.
+type StreamConfig interface {
+	OpenStream() (StreamTransport, error)
+}
+
+// StreamTransport is an opened stream transport. Its connections carry raw
+// byte streams; they are not framed into packets.
+type StreamTransport interface {
+
+	// Addrs returns all the known addresses this transport is reachable at.
+	Addrs() []net.Addr
+
+	// DialStream opens a new stream to addr.
+	// ErrInvalidAddr must be returned when the addr is
+	// not supported by the transport.
+	DialStream(addr net.Addr) (net.Conn, error)
+
+	// AcceptStream accepts the next incomming stream.
+	// io.EOF is returned when the transport is closed.
+	AcceptStream() (net.Conn, error)
+
+	// Close closes the transport.
+	Close() error
+}
@@ -0,0 +1,91 @@
+package tcp
+
+import (
+	"io"
+	"net"
+	"sync"
+
+	"github.com/telehash/gogotelehash/transports"
+)
+
+var _ transports.StreamConfig = Config{}
+
+type streamTransport struct {
+	net      string
+	laddr    tcpAddr
+	listener *net.TCPListener
+
+	mtx    sync.Mutex
+	closed bool
+}
+
+// streamConn is a raw TCP stream which reports registered addresses.
+type streamConn struct {
+	*net.TCPConn
+	laddr tcpAddr
+	raddr tcpAddr
+}
+
+// OpenStream opens a TCP transport which carries raw byte streams instead of
+// framed packets. It is used by transports that wrap TCP (like TLS).
+func (c Config) OpenStream() (transports.StreamTransport, error) {
+	listener, err := c.listen()
+	if err != nil {
+		return nil, err
+	}
+
+	addr := listener.Addr().(*net.TCPAddr)
+
+	return &streamTransport{net: c.Network, laddr: wrapAddr(addr), listener: listener}, nil
+}
+
+func (t *streamTransport) Addrs() []net.Addr {
+	return localAddrs(t.net, t.laddr)
+}
+
+func (t *streamTransport) DialStream(addr net.Addr) (net.Conn, error) {
+	switch x := addr.(type) {
+	case tcpAddr:
+		conn, err := net.DialTCP("tcp", nil, x.ToTCPAddr())
+		if err != nil {
+			return nil, err
+		}
+
+		return &streamConn{TCPConn: conn, laddr: t.laddr, raddr: x}, nil
+	case *net.TCPAddr:
+		return t.DialStream(wrapAddr(x))
+	default:
+		return nil, transports.ErrInvalidAddr
+	}
+}
+
+func (t *streamTransport) AcceptStream() (net.Conn, error) {
+	conn, err := t.listener.AcceptTCP()
+	if err != nil {
+		t.mtx.Lock()
+		closed := t.closed
+		t.mtx.Unlock()
+		if closed {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+
+	raddr := conn.RemoteAddr().(*net.TCPAddr)
+	return &streamConn{TCPConn: conn, laddr: t.laddr, raddr: wrapAddr(raddr)}, nil
+}
+
+func (t *streamTransport) Close() error {
+	t.mtx.Lock()
+	if t.closed {
+		t.mtx.Unlock()
+		return nil
+	}
+	t.closed = true
+	t.mtx.Unlock()
+
+	return t.listener.Close()
+}
+
+func (c *streamConn) LocalAddr() net.Addr  { return c.laddr }
+func (c *streamConn) RemoteAddr() net.Addr { return c.raddr }
@@ -1,4 +1,8 @@
 // Package tcp implements the TCP transport.
+//
+// Packets are framed with a 2 byte (big endian) length prefix. Dialed
+// connections are pooled: dialing an address that already has an open
+// connection returns that connection.
 package tcp
 
 import (
@@ -7,10 +11,12 @@ import (
 	"errors"
 	"io"
 	"net"
+	"os"
 	"sync"
 	"time"
 
 	"github.com/telehash/gogotelehash/transports"
+	"github.com/telehash/gogotelehash/transports/handover"
 	"github.com/telehash/gogotelehash/transports/transportsutil"
 )
 
@@ -40,6 +46,10 @@ type transport struct {
 	net      string
 	laddr    tcpAddr
 	listener *net.TCPListener
+
+	mtx    sync.Mutex
+	closed bool
+	conns  map[string]*connection // dialed connections by remote address
 }
 
 type connection struct {
@@ -49,15 +59,34 @@ type connection struct {
 	bufr      *bufio.Reader
 	mtxWrite  sync.Mutex
 	mtxRead   sync.Mutex
+	pooled    bool
 }
 
 var (
-	_ transports.Transport = (*transport)(nil)
-	_ transports.Config    = Config{}
+	_ transports.FileTransport = (*transport)(nil)
+	_ transports.Config        = Config{}
 )
 
 // Open opens the transport.
 func (c Config) Open() (transports.Transport, error) {
+	listener, err := c.listen()
+	if err != nil {
+		return nil, err
+	}
+
+	addr := listener.Addr().(*net.TCPAddr)
+
+	return &transport{
+		net:      c.Network,
+		laddr:    wrapAddr(addr),
+		listener: listener,
+		conns:    make(map[string]*connection),
+	}, nil
+}
+
+// listen validates the config and opens the listener. c.Network is set to
+// its default.
+func (c *Config) listen() (*net.TCPListener, error) {
 	var (
 		addr *net.TCPAddr
 		err  error
@@ -89,26 +118,37 @@ func (c Config) Open() (transports.Transport, error) {
 		}
 	}
 
-	listener, err := net.ListenTCP(c.Network, addr)
-	if err != nil {
-		return nil, err
+	if l := handover.TCPListener(c.Network, addr); l != nil {
+		return l, nil
 	}
 
-	addr = listener.Addr().(*net.TCPAddr)
+	return net.ListenTCP(c.Network, addr)
+}
 
-	return &transport{net: c.Network, laddr: wrapAddr(addr), listener: listener}, nil
+// Files returns the listening socket of the transport (see package handover).
+func (t *transport) Files() ([]*os.File, error) {
+	f, err := t.listener.File()
+	if err != nil {
+		return nil, err
+	}
+	return []*os.File{f}, nil
 }
 
 func (t *transport) Addrs() []net.Addr {
+	return localAddrs(t.net, t.laddr)
+}
+
+// localAddrs returns the addresses a listener on laddr is reachable at.
+func localAddrs(network string, laddr tcpAddr) []net.Addr {
 	var (
 		port  uint16
 		addrs []net.Addr
 	)
 
 	{
-		port = t.laddr.GetPort()
-		if !t.laddr.GetIP().IsUnspecified() {
-			addrs = append(addrs, t.laddr)
+		port = laddr.GetPort()
+		if !laddr.GetIP().IsUnspecified() {
+			addrs = append(addrs, laddr)
 			return addrs
 		}
 	}
@@ -124,7 +164,7 @@ func (t *transport) Addrs() []net.Addr {
 			Zone: addr.Zone,
 			Port: int(port),
 		})
-		if addr.IsIPv6() && t.net == TCPv6 || !addr.IsIPv6() && t.net == TCPv4 {
+		if addr.IsIPv6() && network == TCPv6 || !addr.IsIPv6() && network == TCPv4 {
 			addrs = append(addrs, addr)
 		}
 	}
@@ -135,12 +175,38 @@ func (t *transport) Addrs() []net.Addr {
 func (t *transport) Dial(addr net.Addr) (net.Conn, error) {
 	switch x := addr.(type) {
 	case tcpAddr:
+		key := x.String()
+
+		t.mtx.Lock()
+		closed, c := t.closed, t.conns[key]
+		t.mtx.Unlock()
+		if closed {
+			return nil, io.EOF
+		}
+		if c != nil {
+			return c, nil
+		}
+
 		conn, err := net.DialTCP("tcp", nil, x.ToTCPAddr())
 		if err != nil {
 			return nil, err
 		}
 
-		return &connection{transport: t, raddr: x, conn: conn, bufr: bufio.NewReader(conn)}, nil
+		c = &connection{transport: t, raddr: x, conn: conn, bufr: bufio.NewReader(conn), pooled: true}
+
+		t.mtx.Lock()
+		defer t.mtx.Unlock()
+		if t.closed {
+			conn.Close()
+			return nil, io.EOF
+		}
+		if other := t.conns[key]; other != nil {
+			// lost the race against a concurrent dial
+			conn.Close()
+			return other, nil
+		}
+		t.conns[key] = c
+		return c, nil
 	case *net.TCPAddr:
 		return t.Dial(wrapAddr(x))
 	default:
@@ -151,6 +217,12 @@ func (t *transport) Dial(addr net.Addr) (net.Conn, error) {
 func (t *transport) Accept() (c net.Conn, err error) {
 	tconn, err := t.listener.AcceptTCP()
 	if err != nil {
+		t.mtx.Lock()
+		closed := t.closed
+		t.mtx.Unlock()
+		if closed {
+			return nil, io.EOF
+		}
 		return nil, err
 	}
 
@@ -161,9 +233,38 @@ func (t *transport) Accept() (c net.Conn, err error) {
 }
 
 func (t *transport) Close() error {
+	t.mtx.Lock()
+	if t.closed {
+		t.mtx.Unlock()
+		return nil
+	}
+	t.closed = true
+	conns := t.conns
+	t.conns = nil
+	t.mtx.Unlock()
+
+	for _, c := range conns {
+		c.conn.Close()
+	}
+
 	return t.listener.Close()
 }
 
+// dropConnection removes c from the connection pool.
+func (t *transport) dropConnection(c *connection) {
+	if !c.pooled {
+		return
+	}
+
+	key := c.raddr.String()
+
+	t.mtx.Lock()
+	if t.conns[key] == c {
+		delete(t.conns, key)
+	}
+	t.mtx.Unlock()
+}
+
 func (c *connection) Read(b []byte) (n int, err error) {
 	var hdr [2]byte
 
@@ -172,12 +273,26 @@ func (c *connection) Read(b []byte) (n int, err error) {
 
 	_, err = io.ReadFull(c.bufr, hdr[:])
 	if err != nil {
+		c.transport.dropConnection(c)
 		return 0, err
 	}
 
-	msgLen := binary.BigEndian.Uint16(hdr[:])
+	msgLen := int(binary.BigEndian.Uint16(hdr[:]))
+	if msgLen > len(b) {
+		// skip the packet; the stream stays in sync
+		_, err = c.bufr.Discard(msgLen)
+		if err != nil {
+			c.transport.dropConnection(c)
+			return 0, err
+		}
+		return 0, io.ErrShortBuffer
+	}
 
-	return io.ReadFull(c.bufr, b[:msgLen])
+	n, err = io.ReadFull(c.bufr, b[:msgLen])
+	if err != nil {
+		c.transport.dropConnection(c)
+	}
+	return n, err
 }
 
 func (c *connection) Write(b []byte) (n int, err error) {
@@ -196,6 +311,7 @@ func (c *connection) Write(b []byte) (n int, err error) {
 	for len(hdrP) > 0 {
 		n, err := c.conn.Write(hdrP)
 		if err != nil {
+			c.transport.dropConnection(c)
 			return 0, err
 		}
 		hdrP = hdrP[n:]
@@ -204,6 +320,7 @@ func (c *connection) Write(b []byte) (n int, err error) {
 	for len(b) > 0 {
 		n, err := c.conn.Write(b)
 		if err != nil {
+			c.transport.dropConnection(c)
 			return 0, err
 		}
 		b = b[n:]
@@ -233,5 +350,6 @@ func (c *connection) RemoteAddr() net.Addr {
 }
 
 func (c *connection) Close() error {
+	c.transport.dropConnection(c)
 	return c.conn.Close()
 }
@@ -2,6 +2,7 @@ package tcp
 
 import (
 	"bytes"
+	"io"
 	"net"
 	"testing"
 
@@ -31,6 +32,111 @@ func TestLocalAddresses(t *testing.T) {
 	}
 }
 
+func TestConnectionPool(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := Config{Addr: "127.0.0.1:0"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := Config{Addr: "127.0.0.1:0"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	dst := B.Addrs()[0]
+
+	c1, err := A.Dial(dst)
+	assert.NoError(err)
+	c2, err := A.Dial(dst)
+	assert.NoError(err)
+	assert.True(c1 == c2)
+
+	_, err = c1.Write([]byte("hello"))
+	assert.NoError(err)
+
+	r, err := B.Accept()
+	if !assert.NoError(err) {
+		return
+	}
+	defer r.Close()
+
+	var buf [1500]byte
+	n, err := r.Read(buf[:])
+	assert.NoError(err)
+	assert.Equal("hello", string(buf[:n]))
+
+	// a closed connection is removed from the pool
+	assert.NoError(c1.Close())
+	c3, err := A.Dial(dst)
+	assert.NoError(err)
+	assert.False(c1 == c3)
+	c3.Close()
+}
+
+func TestReadShortBuffer(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := Config{Addr: "127.0.0.1:0"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := Config{Addr: "127.0.0.1:0"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	w, err := A.Dial(B.Addrs()[0])
+	if !assert.NoError(err) {
+		return
+	}
+
+	_, err = w.Write(bytes.Repeat([]byte{'x'}, 100))
+	assert.NoError(err)
+	_, err = w.Write([]byte("hello"))
+	assert.NoError(err)
+
+	r, err := B.Accept()
+	if !assert.NoError(err) {
+		return
+	}
+
+	var buf [10]byte
+	_, err = r.Read(buf[:])
+	assert.Equal(io.ErrShortBuffer, err)
+
+	n, err := r.Read(buf[:])
+	assert.NoError(err)
+	assert.Equal("hello", string(buf[:n]))
+}
+
+func TestAcceptAfterClose(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := Config{Addr: "127.0.0.1:0"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := A.Accept()
+		done <- err
+	}()
+
+	assert.NoError(A.Close())
+	assert.Equal(io.EOF, <-done)
+
+	_, err = A.Dial(A.Addrs()[0])
+	assert.Equal(io.EOF, err)
+}
+
 func Benchmark(b *testing.B) {
 	A, err := Config{}.Open()
 	if err != nil {
@@ -0,0 +1,112 @@
+package tls
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+
+	"github.com/telehash/gogotelehash/transports"
+)
+
+func init() {
+	transports.RegisterAddr(&addr{})
+
+	transports.RegisterResolver("tls", func(str string) (net.Addr, error) {
+		return parseAddr(str)
+	})
+}
+
+// addr is the address of a TLS endpoint. It wraps the address of the stream
+// transport and the server name that is used for SNI.
+type addr struct {
+	inner      net.Addr
+	serverName string
+}
+
+// parseAddr parses the URL form of an address without the scheme:
+// "[server-name@]<inner address URL>".
+func parseAddr(str string) (*addr, error) {
+	var serverName string
+
+	idx := strings.Index(str, "://")
+	if idx < 0 {
+		return nil, transports.ErrInvalidAddr
+	}
+	if at := strings.LastIndexByte(str[:idx], '@'); at >= 0 {
+		serverName, str = str[:at], str[at+1:]
+	}
+
+	inner, err := transports.ParseAddr(str)
+	if err != nil {
+		return nil, transports.ErrInvalidAddr
+	}
+	if _, nested := inner.(*addr); nested {
+		return nil, transports.ErrInvalidAddr
+	}
+
+	return &addr{inner: inner, serverName: serverName}, nil
+}
+
+func (a *addr) Network() string { return "tls" }
+
+func (a *addr) String() string {
+	if a.serverName != "" {
+		return a.serverName + "@" + a.inner.String()
+	}
+	return a.inner.String()
+}
+
+func (a *addr) URL() string {
+	if a.serverName != "" {
+		return "tls://" + a.serverName + "@" + transports.FormatAddr(a.inner)
+	}
+	return "tls://" + transports.FormatAddr(a.inner)
+}
+
+func (a *addr) Equal(other net.Addr) bool {
+	b, ok := other.(*addr)
+	return ok && a.serverName == b.serverName && transports.EqualAddr(a.inner, b.inner)
+}
+
+func (a *addr) MarshalJSON() ([]byte, error) {
+	inner, err := transports.EncodeAddr(a.inner)
+	if err != nil {
+		return nil, err
+	}
+
+	var desc = struct {
+		Type       string          `json:"type"`
+		Addr       json.RawMessage `json:"addr"`
+		ServerName string          `json:"server_name,omitempty"`
+	}{
+		Type:       a.Network(),
+		Addr:       inner,
+		ServerName: a.serverName,
+	}
+
+	return json.Marshal(&desc)
+}
+
+func (a *addr) UnmarshalJSON(data []byte) error {
+	var desc struct {
+		Addr       json.RawMessage `json:"addr"`
+		ServerName string          `json:"server_name"`
+	}
+
+	err := json.Unmarshal(data, &desc)
+	if err != nil || len(desc.Addr) == 0 {
+		return transports.ErrInvalidAddr
+	}
+
+	inner, err := transports.DecodeAddr(desc.Addr)
+	if err != nil {
+		return transports.ErrInvalidAddr
+	}
+	if _, nested := inner.(*addr); nested {
+		return transports.ErrInvalidAddr
+	}
+
+	a.inner = inner
+	a.serverName = desc.ServerName
+	return nil
+}
@@ -0,0 +1,299 @@
+// Package tls implements a transport that wraps a stream transport (like TCP)
+// in TLS.
+//
+// Telehash packets are already encrypted end-to-end; TLS is only used to
+// traverse middleboxes that only permit TLS (for example on port 443) and to
+// blend in with HTTPS traffic:
+//
+//	e3x.Open(e3x.Transport(tls.Config{
+//	  Config:     tcp.Config{Addr: ":443"},
+//	  TLS:        &tls.Config{Certificates: certs},
+//	  ServerName: "example.com",
+//	}))
+//
+// Packets are framed with a 2 byte (big endian) length prefix inside the TLS
+// stream.
+package tls
+
+import (
+	"bufio"
+	gotls "crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/telehash/gogotelehash/transports"
+)
+
+// DefaultHandshakeTimeout is used when Config.HandshakeTimeout is not set.
+const DefaultHandshakeTimeout = 10 * time.Second
+
+// Config for the TLS transport.
+type Config struct {
+	// Config is the configuration of the wrapped stream transport.
+	Config transports.StreamConfig
+
+	// TLS is used for both accepted (server) and dialed (client) connections.
+	// Accepting connections requires a certificate. When dialing, the
+	// server name of the address is used when TLS.ServerName is empty.
+	TLS *gotls.Config
+
+	// ServerName is advertised in the addresses of the transport. Dialing
+	// peers use it for SNI and to verify the certificate.
+	ServerName string
+
+	// HandshakeTimeout limits the duration of the TLS handshake.
+	// Defaults to DefaultHandshakeTimeout.
+	HandshakeTimeout time.Duration
+}
+
+type transport struct {
+	t          transports.StreamTransport
+	config     *gotls.Config
+	serverName string
+	timeout    time.Duration
+
+	accepted chan net.Conn
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	mtx    sync.Mutex
+	closed bool
+}
+
+type connection struct {
+	conn     *gotls.Conn
+	laddr    *addr
+	raddr    *addr
+	bufr     *bufio.Reader
+	mtxWrite sync.Mutex
+	mtxRead  sync.Mutex
+}
+
+var (
+	_ transports.Transport = (*transport)(nil)
+	_ transports.Config    = Config{}
+)
+
+// Open opens the wrapped stream transport.
+func (c Config) Open() (transports.Transport, error) {
+	if c.Config == nil {
+		return nil, errors.New("tls: missing stream transport")
+	}
+	if c.TLS == nil {
+		return nil, errors.New("tls: missing TLS config")
+	}
+	if c.HandshakeTimeout <= 0 {
+		c.HandshakeTimeout = DefaultHandshakeTimeout
+	}
+
+	t, err := c.Config.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+
+	tr := &transport{
+		t:          t,
+		config:     c.TLS,
+		serverName: c.ServerName,
+		timeout:    c.HandshakeTimeout,
+		accepted:   make(chan net.Conn),
+		done:       make(chan struct{}),
+	}
+
+	tr.wg.Add(1)
+	go tr.runAccepter()
+
+	return tr, nil
+}
+
+func (t *transport) Addrs() []net.Addr {
+	inner := t.t.Addrs()
+	addrs := make([]net.Addr, 0, len(inner))
+	for _, a := range inner {
+		addrs = append(addrs, &addr{inner: a, serverName: t.serverName})
+	}
+	return addrs
+}
+
+func (t *transport) Dial(a net.Addr) (net.Conn, error) {
+	x, ok := a.(*addr)
+	if !ok {
+		return nil, transports.ErrInvalidAddr
+	}
+
+	raw, err := t.t.DialStream(x.inner)
+	if err != nil {
+		return nil, err
+	}
+
+	config := t.config
+	if config.ServerName == "" && x.serverName != "" {
+		config = config.Clone()
+		config.ServerName = x.serverName
+	}
+
+	conn := gotls.Client(raw, config)
+	err = t.handshake(conn)
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+
+	return t.newConnection(conn, x), nil
+}
+
+func (t *transport) Accept() (net.Conn, error) {
+	select {
+	case conn := <-t.accepted:
+		return conn, nil
+	case <-t.done:
+		return nil, io.EOF
+	}
+}
+
+func (t *transport) Close() error {
+	t.mtx.Lock()
+	if t.closed {
+		t.mtx.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.done)
+	t.mtx.Unlock()
+
+	err := t.t.Close()
+	t.wg.Wait()
+	return err
+}
+
+// runAccepter accepts the raw streams of the wrapped transport. The TLS
+// handshakes run concurrently so a slow client can't block Accept.
+func (t *transport) runAccepter() {
+	defer t.wg.Done()
+
+	for {
+		raw, err := t.t.AcceptStream()
+		if err == io.EOF {
+			return
+		}
+		if neterr, ok := err.(net.Error); ok && neterr.Temporary() {
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		t.wg.Add(1)
+		go t.accept(raw)
+	}
+}
+
+func (t *transport) accept(raw net.Conn) {
+	defer t.wg.Done()
+
+	conn := gotls.Server(raw, t.config)
+	err := t.handshake(conn)
+	if err != nil {
+		raw.Close()
+		return
+	}
+
+	c := t.newConnection(conn, &addr{inner: raw.RemoteAddr()})
+
+	select {
+	case t.accepted <- c:
+	case <-t.done:
+		c.Close()
+	}
+}
+
+func (t *transport) handshake(conn *gotls.Conn) error {
+	conn.SetDeadline(time.Now().Add(t.timeout))
+	err := conn.Handshake()
+	conn.SetDeadline(time.Time{})
+	return err
+}
+
+func (t *transport) newConnection(conn *gotls.Conn, raddr *addr) *connection {
+	return &connection{
+		conn:  conn,
+		laddr: &addr{inner: conn.LocalAddr(), serverName: t.serverName},
+		raddr: raddr,
+		bufr:  bufio.NewReader(conn),
+	}
+}
+
+func (c *connection) Read(b []byte) (n int, err error) {
+	var hdr [2]byte
+
+	c.mtxRead.Lock()
+	defer c.mtxRead.Unlock()
+
+	_, err = io.ReadFull(c.bufr, hdr[:])
+	if err != nil {
+		return 0, err
+	}
+
+	msgLen := int(binary.BigEndian.Uint16(hdr[:]))
+	if msgLen > len(b) {
+		// skip the packet; the stream stays in sync
+		_, err = c.bufr.Discard(msgLen)
+		if err != nil {
+			return 0, err
+		}
+		return 0, io.ErrShortBuffer
+	}
+
+	return io.ReadFull(c.bufr, b[:msgLen])
+}
+
+func (c *connection) Write(b []byte) (n int, err error) {
+	var lenB = len(b)
+	if lenB > 1472 {
+		return 0, io.ErrShortWrite
+	}
+
+	// write the header and the packet in one TLS record
+	var buf [2 + 1472]byte
+	binary.BigEndian.PutUint16(buf[:2], uint16(lenB))
+	copy(buf[2:], b)
+
+	c.mtxWrite.Lock()
+	defer c.mtxWrite.Unlock()
+
+	_, err = c.conn.Write(buf[:2+lenB])
+	if err != nil {
+		return 0, err
+	}
+
+	return lenB, nil
+}
+
+func (c *connection) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+func (c *connection) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *connection) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+func (c *connection) LocalAddr() net.Addr {
+	return c.laddr
+}
+
+func (c *connection) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+func (c *connection) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,188 @@
+package tls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	gotls "crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+	"github.com/telehash/gogotelehash/transports"
+	"github.com/telehash/gogotelehash/transports/tcp"
+)
+
+func testTLSConfig(t *testing.T) *gotls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return &gotls.Config{
+		Certificates: []gotls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		RootCAs:      pool,
+	}
+}
+
+func TestDialAccept(t *testing.T) {
+	assert := assert.New(t)
+	config := testTLSConfig(t)
+
+	A, err := Config{Config: tcp.Config{Addr: "127.0.0.1:0"}, TLS: config, ServerName: "example.com"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := Config{Config: tcp.Config{Addr: "127.0.0.1:0"}, TLS: config, ServerName: "example.com"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	addrs := B.Addrs()
+	if !assert.NotEmpty(addrs) {
+		return
+	}
+	assert.Equal("tls", addrs[0].Network())
+
+	c1, err := A.Dial(addrs[0])
+	if !assert.NoError(err) {
+		return
+	}
+	defer c1.Close()
+
+	_, err = c1.Write([]byte("hello"))
+	assert.NoError(err)
+
+	c2, err := B.Accept()
+	if !assert.NoError(err) {
+		return
+	}
+	defer c2.Close()
+
+	buf := make([]byte, 1500)
+	n, err := c2.Read(buf)
+	assert.NoError(err)
+	assert.Equal("hello", string(buf[:n]))
+
+	_, err = c2.Write([]byte("world"))
+	assert.NoError(err)
+
+	n, err = c1.Read(buf)
+	assert.NoError(err)
+	assert.Equal("world", string(buf[:n]))
+}
+
+func TestDialUnknownServerName(t *testing.T) {
+	assert := assert.New(t)
+	config := testTLSConfig(t)
+
+	A, err := Config{Config: tcp.Config{Addr: "127.0.0.1:0"}, TLS: config}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := Config{Config: tcp.Config{Addr: "127.0.0.1:0"}, TLS: config, ServerName: "other.example.com"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	_, err = A.Dial(B.Addrs()[0])
+	assert.Error(err)
+}
+
+func TestAddrJSON(t *testing.T) {
+	assert := assert.New(t)
+	config := testTLSConfig(t)
+
+	A, err := Config{Config: tcp.Config{Addr: "127.0.0.1:0"}, TLS: config, ServerName: "example.com"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	a := A.Addrs()[0]
+
+	data, err := transports.EncodeAddr(a)
+	if !assert.NoError(err) {
+		return
+	}
+	t.Logf("addr=%s", data)
+
+	b, err := transports.DecodeAddr(data)
+	if assert.NoError(err) {
+		assert.True(transports.EqualAddr(a, b))
+	}
+}
+
+func TestAddrURL(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, s := range []string{
+		"tls://tcp4://127.0.0.1:4242",
+		"tls://example.com@tcp4://127.0.0.1:4242",
+		"tls://example.com@tcp6://[::1]:4242",
+	} {
+		a, err := transports.ParseAddr(s)
+		if assert.NoError(err, s) {
+			assert.Equal(s, transports.FormatAddr(a))
+		}
+	}
+
+	a, err := transports.ParseAddr("tls://example.com@tcp4://127.0.0.1:4242")
+	if assert.NoError(err) {
+		assert.Equal("example.com", a.(*addr).serverName)
+	}
+
+	for _, s := range []string{
+		"tls://127.0.0.1:4242",
+		"tls://tls://tcp4://127.0.0.1:4242",
+	} {
+		_, err := transports.ParseAddr(s)
+		assert.Error(err, s)
+	}
+}
+
+func TestAcceptAfterClose(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := Config{Config: tcp.Config{Addr: "127.0.0.1:0"}, TLS: testTLSConfig(t)}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.NoError(A.Close())
+
+	_, err = A.Accept()
+	assert.Equal(io.EOF, err)
+}
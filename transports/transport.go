@@ -7,9 +7,15 @@
 package transports
 
 import (
+	"errors"
 	"net"
 )
 
+// ErrUnreachable is returned by the Read method of a connection when the
+// network reported that the remote end can't be reached (for example with an
+// ICMP port unreachable error). The connection remains usable.
+var ErrUnreachable = errors.New("destination unreachable")
+
 // Config must be implemented by transport packages
 type Config interface {
 	Open() (Transport, error)
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/telehash/gogotelehash/internal/util/bufpool"
+	"github.com/telehash/gogotelehash/transports"
 )
 
 type HalfPipe struct {
@@ -15,7 +16,10 @@ type HalfPipe struct {
 	deadlineReached bool
 	deadlineTimer   *time.Timer
 	closed          bool
+	err             error
 	readQueue       []*bufpool.Buffer
+	limit           int
+	policy          transports.DropPolicy
 }
 
 func NewHalfPipe() *HalfPipe {
@@ -24,6 +28,16 @@ func NewHalfPipe() *HalfPipe {
 	return conn
 }
 
+// SetQueueLimit caps the number of queued messages. When the queue is full
+// PushMessage drops a message according to policy. A limit of zero removes the
+// cap.
+func (c *HalfPipe) SetQueueLimit(limit int, policy transports.DropPolicy) {
+	c.mtx.Lock()
+	c.limit = limit
+	c.policy = policy
+	c.mtx.Unlock()
+}
+
 func (c *HalfPipe) PushMessage(p []byte) {
 	c.mtx.Lock()
 
@@ -32,16 +46,43 @@ func (c *HalfPipe) PushMessage(p []byte) {
 		return
 	}
 
+	if c.limit > 0 && len(c.readQueue) >= c.limit {
+		if c.policy != transports.DropOldest {
+			c.mtx.Unlock()
+			return
+		}
+
+		c.readQueue[0].Free()
+		copy(c.readQueue, c.readQueue[1:])
+		c.readQueue = c.readQueue[:len(c.readQueue)-1]
+	}
+
 	c.readQueue = append(c.readQueue, bufpool.New().Set(p))
 
 	c.cndRead.Signal()
 	c.mtx.Unlock()
 }
 
+// PushError makes the next Read return err. Queued messages are read after
+// the error.
+func (c *HalfPipe) PushError(err error) {
+	c.mtx.Lock()
+
+	if c.closed {
+		c.mtx.Unlock()
+		return
+	}
+
+	c.err = err
+
+	c.cndRead.Signal()
+	c.mtx.Unlock()
+}
+
 func (c *HalfPipe) Read(b []byte) (n int, err error) {
 	c.mtx.Lock()
 
-	for !c.closed && !c.deadlineReached && len(c.readQueue) == 0 {
+	for !c.closed && !c.deadlineReached && c.err == nil && len(c.readQueue) == 0 {
 		c.cndRead.Wait()
 	}
 	if c.closed {
@@ -52,20 +93,34 @@ func (c *HalfPipe) Read(b []byte) (n int, err error) {
 		c.mtx.Unlock()
 		return 0, &net.OpError{Op: "read", Err: &timeoutError{}}
 	}
+	if c.err != nil {
+		err, c.err = c.err, nil
+		if len(c.readQueue) > 0 {
+			c.cndRead.Signal()
+		}
+		c.mtx.Unlock()
+		return 0, err
+	}
 
 	buf := c.readQueue[0]
-	n = len(buf.Get(b[:0]))
-	buf.Free()
-
 	copy(c.readQueue, c.readQueue[1:])
 	c.readQueue = c.readQueue[:len(c.readQueue)-1]
 
+	if buf.Len() > len(b) {
+		// the message is discarded
+		buf.Free()
+		err = io.ErrShortBuffer
+	} else {
+		n = len(buf.Get(b[:0]))
+		buf.Free()
+	}
+
 	if len(c.readQueue) > 0 {
 		c.cndRead.Signal()
 	}
 
 	c.mtx.Unlock()
-	return n, nil
+	return n, err
 }
 
 func (c *HalfPipe) Close() error {
@@ -104,6 +159,7 @@ func (c *HalfPipe) SetReadDeadline(t time.Time) error {
 func (c *HalfPipe) setDeadlineReached() {
 	c.mtx.Lock()
 	c.deadlineReached = true
+	c.cndRead.Broadcast()
 	c.mtx.Unlock()
 }
 
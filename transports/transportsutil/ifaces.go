@@ -4,9 +4,16 @@ import (
 	"net"
 )
 
+// InterfaceIPs returns the addresses of the interfaces that can be advertised
+// to peers. Deprecated and tentative IPv6 addresses are skipped. Temporary
+// (privacy) IPv6 addresses change regularly; they are only returned when there
+// is no stable global IPv6 address.
 func InterfaceIPs() ([]*net.IPAddr, error) {
 	var (
-		addrs []*net.IPAddr
+		addrs     []*net.IPAddr
+		temporary []*net.IPAddr
+		stable6   bool
+		flags     = ipv6AddrFlags()
 	)
 
 	ifaces, err := net.Interfaces()
@@ -44,6 +51,18 @@ func InterfaceIPs() ([]*net.IPAddr, error) {
 
 			if ipv4 := ip.To4(); ipv4 != nil {
 				ip = ipv4
+			} else {
+				f := flags[ip.String()]
+				if f&ipv6Unusable != 0 {
+					continue
+				}
+				if f&ipv6Temporary != 0 {
+					temporary = append(temporary, &net.IPAddr{IP: ip, Zone: zone})
+					continue
+				}
+				if ip.IsGlobalUnicast() && !ip.IsPrivate() {
+					stable6 = true
+				}
 			}
 
 			addrs = append(addrs, &net.IPAddr{
@@ -53,5 +72,46 @@ func InterfaceIPs() ([]*net.IPAddr, error) {
 		}
 	}
 
+	if !stable6 {
+		addrs = append(addrs, temporary...)
+	}
+
+	return addrs, nil
+}
+
+// LinkLocalIPv6s returns the IPv6 link-local addresses of the interfaces
+// that are up. The zone of each address is the name of its interface.
+func LinkLocalIPv6s() ([]*net.IPAddr, error) {
+	var (
+		addrs []*net.IPAddr
+	)
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		iaddrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, iaddr := range iaddrs {
+			x, ok := iaddr.(*net.IPNet)
+			if !ok || x.IP.To4() != nil || !x.IP.IsLinkLocalUnicast() {
+				continue
+			}
+
+			addrs = append(addrs, &net.IPAddr{
+				IP:   x.IP,
+				Zone: iface.Name,
+			})
+		}
+	}
+
 	return addrs, nil
 }
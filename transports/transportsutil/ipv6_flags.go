@@ -0,0 +1,49 @@
+package transportsutil
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Flags of IPv6 interface addresses (IFA_F_* on Linux).
+const (
+	ipv6Temporary  = 0x01
+	ipv6DADFailed  = 0x08
+	ipv6Deprecated = 0x20
+	ipv6Tentative  = 0x40
+)
+
+// ipv6Unusable are the flags of addresses that must not be advertised.
+const ipv6Unusable = ipv6DADFailed | ipv6Deprecated | ipv6Tentative
+
+// parseIfInet6 parses the format of /proc/net/if_inet6 and returns the flags
+// of each address.
+func parseIfInet6(r io.Reader) map[string]uint32 {
+	flags := make(map[string]uint32)
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 5 {
+			continue
+		}
+
+		b, err := hex.DecodeString(fields[0])
+		if err != nil || len(b) != net.IPv6len {
+			continue
+		}
+
+		f, err := strconv.ParseUint(fields[4], 16, 32)
+		if err != nil {
+			continue
+		}
+
+		flags[net.IP(b).String()] = uint32(f)
+	}
+
+	return flags
+}
@@ -0,0 +1,16 @@
+package transportsutil
+
+import (
+	"os"
+)
+
+// ipv6AddrFlags returns the flags of the IPv6 addresses of the host.
+func ipv6AddrFlags() map[string]uint32 {
+	f, err := os.Open("/proc/net/if_inet6")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	return parseIfInet6(f)
+}
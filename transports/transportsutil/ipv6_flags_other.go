@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package transportsutil
+
+// ipv6AddrFlags returns the flags of the IPv6 addresses of the host. The flags
+// are only known on Linux.
+func ipv6AddrFlags() map[string]uint32 {
+	return nil
+}
@@ -0,0 +1,29 @@
+package transportsutil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+)
+
+func TestParseIfInet6(t *testing.T) {
+	assert := assert.New(t)
+
+	flags := parseIfInet6(strings.NewReader(
+		"20010db8000000000000000000000001 02 40 00 80     eth0\n" +
+			"20010db80000000011223344aabbccdd 02 40 00 01     eth0\n" +
+			"20010db8000000000000000000000002 02 40 00 a0     eth0\n" +
+			"00000000000000000000000000000001 01 80 10 80       lo\n" +
+			"garbage\n"))
+
+	assert.Equal(map[string]uint32{
+		"2001:db8::1":                   0x80,
+		"2001:db8::1122:3344:aabb:ccdd": 0x01,
+		"2001:db8::2":                   0xa0,
+		"::1":                           0x80,
+	}, flags)
+
+	assert.NotEqual(uint32(0), flags["2001:db8::1122:3344:aabb:ccdd"]&ipv6Temporary)
+	assert.NotEqual(uint32(0), flags["2001:db8::2"]&ipv6Unusable)
+}
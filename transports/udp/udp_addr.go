@@ -5,6 +5,8 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"net"
+	"strconv"
+	"strings"
 
 	"github.com/telehash/gogotelehash/transports"
 	"github.com/telehash/gogotelehash/transports/dgram"
@@ -100,8 +102,8 @@ func (u *udpv4) Key() interface{} {
 		k connKey
 	)
 
-	copy(k[:16], u.IP.To16())
-	binary.BigEndian.PutUint16(k[16:], uint16(u.Port))
+	copy(k.addr[:16], u.IP.To16())
+	binary.BigEndian.PutUint16(k.addr[16:], uint16(u.Port))
 
 	return k
 }
@@ -110,8 +112,9 @@ func (u *udpv6) Key() interface{} {
 		k connKey
 	)
 
-	copy(k[:16], u.IP.To16())
-	binary.BigEndian.PutUint16(k[16:], uint16(u.Port))
+	copy(k.addr[:16], u.IP.To16())
+	binary.BigEndian.PutUint16(k.addr[16:], uint16(u.Port))
+	k.zone = u.Zone
 
 	return k
 }
@@ -149,6 +152,7 @@ func (u *udpv6) UnmarshalJSON(data []byte) error {
 	var desc struct {
 		IP   string `json:"ip"`
 		Port int    `json:"port"`
+		Zone string `json:"zone"`
 	}
 
 	err := json.Unmarshal(data, &desc)
@@ -156,6 +160,14 @@ func (u *udpv6) UnmarshalJSON(data []byte) error {
 		return transports.ErrInvalidAddr
 	}
 
+	// the zone may also be part of the ip ("fe80::1%eth0")
+	if i := strings.IndexByte(desc.IP, '%'); i >= 0 {
+		if desc.Zone == "" {
+			desc.Zone = desc.IP[i+1:]
+		}
+		desc.IP = desc.IP[:i]
+	}
+
 	ip := net.ParseIP(desc.IP)
 	if ip == nil || ip.IsUnspecified() {
 		return transports.ErrInvalidAddr
@@ -165,7 +177,7 @@ func (u *udpv6) UnmarshalJSON(data []byte) error {
 		return transports.ErrInvalidAddr
 	}
 
-	addr := wrapAddr(&net.UDPAddr{IP: ip, Port: desc.Port})
+	addr := wrapAddr(&net.UDPAddr{IP: ip, Port: desc.Port, Zone: desc.Zone})
 	if !addr.IsIPv6() {
 		return transports.ErrInvalidAddr
 	}
@@ -193,10 +205,12 @@ func (u *udpv6) MarshalJSON() ([]byte, error) {
 		Type string `json:"type"`
 		IP   string `json:"ip"`
 		Port int    `json:"port"`
+		Zone string `json:"zone,omitempty"`
 	}{
 		Type: u.Network(),
 		IP:   u.IP.String(),
 		Port: u.Port,
+		Zone: u.Zone,
 	}
 
 	return json.Marshal(&desc)
@@ -227,7 +241,37 @@ func (u *udpv4) Equal(other net.Addr) bool {
 
 func (u *udpv6) Equal(other net.Addr) bool {
 	if b, ok := other.(*udpv6); ok {
-		return bytes.Equal(u.IP.To16(), b.IP.To16()) && u.Port == b.Port
+		return bytes.Equal(u.IP.To16(), b.IP.To16()) && u.Port == b.Port && u.Zone == b.Zone
+	}
+	return false
+}
+
+// hasLocalZone reports if the zone of the link-local address u names a local
+// interface. Link-local addresses can only be reached through their zone.
+func (u *udpv6) hasLocalZone() bool {
+	if u.Zone == "" {
+		return false
+	}
+	if _, err := net.InterfaceByName(u.Zone); err == nil {
+		return true
+	}
+	if idx, err := strconv.Atoi(u.Zone); err == nil {
+		_, err = net.InterfaceByIndex(idx)
+		return err == nil
 	}
 	return false
 }
+
+// addrScope ranks addresses by their reach; lower is preferred.
+func addrScope(ip net.IP) int {
+	switch {
+	case ip.IsLoopback():
+		return 3
+	case ip.IsLinkLocalUnicast():
+		return 2
+	case ip.IsPrivate():
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,69 @@
+package udp
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+	"github.com/telehash/gogotelehash/transports"
+	"github.com/telehash/gogotelehash/transports/handover"
+)
+
+func TestHandover(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := Config{Addr: "127.0.0.1:0"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+
+	files, err := transports.TransportFiles(A)
+	if !assert.NoError(err) || !assert.Len(files, 1) {
+		A.Close()
+		return
+	}
+
+	// pretend the socket was inherited from the previous process
+	fd, err := syscall.Dup(int(files[0].Fd()))
+	files[0].Close()
+	if !assert.NoError(err) {
+		A.Close()
+		return
+	}
+	os.Setenv(handover.EnvVar, strconv.Itoa(fd))
+
+	B, err := Config{Addr: A.Addrs()[0].String()}.Open()
+	if !assert.NoError(err) {
+		A.Close()
+		return
+	}
+	defer B.Close()
+
+	assert.Equal(A.Addrs(), B.Addrs())
+	assert.Equal("", os.Getenv(handover.EnvVar))
+	A.Close()
+
+	C, err := Config{Addr: "127.0.0.1:0"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer C.Close()
+
+	c, err := C.Dial(B.Addrs()[0])
+	if !assert.NoError(err) {
+		return
+	}
+	_, err = c.Write([]byte("hello"))
+	assert.NoError(err)
+
+	conn, err := B.Accept()
+	if !assert.NoError(err) {
+		return
+	}
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	assert.NoError(err)
+	assert.Equal("hello", string(buf[:n]))
+}
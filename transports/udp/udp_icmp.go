@@ -0,0 +1,103 @@
+package udp
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/telehash/gogotelehash/transports/dgram"
+)
+
+// ICMP errors
+//
+// Unconnected UDP sockets normally ignore the ICMP errors caused by their
+// packets. With ICMPErrors enabled the kernel queues them on the socket
+// (IP_RECVERR) and a pending error fails the next read or write. The transport
+// then drains the error queue and reports each unreachable destination as a
+// *dgram.UnreachableError from Read, so that the exchange can fail over to an
+// other path without waiting for its acks to time out.
+
+var errICMPUnsupported = errors.New("udp: ICMP errors are not supported on this platform")
+
+// icmpErrors holds the unreachable destinations that were drained from the
+// error queue but were not reported yet.
+type icmpErrors struct {
+	conn *net.UDPConn
+
+	mtx     sync.Mutex
+	pending []udpAddr
+}
+
+func newICMPErrors(conn *net.UDPConn, network string) (*icmpErrors, error) {
+	if err := enableRecvErr(conn, network); err != nil {
+		return nil, err
+	}
+	return &icmpErrors{conn: conn}, nil
+}
+
+// drain moves the unreachable destinations from the error queue of the socket
+// to the pending list.
+func (e *icmpErrors) drain() {
+	addrs := readErrQueue(e.conn)
+	if len(addrs) == 0 {
+		return
+	}
+
+	e.mtx.Lock()
+	e.pending = append(e.pending, addrs...)
+	e.mtx.Unlock()
+}
+
+// next returns the next pending unreachable destination or nil.
+func (e *icmpErrors) next() udpAddr {
+	if e == nil {
+		return nil
+	}
+
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	if len(e.pending) == 0 {
+		return nil
+	}
+
+	addr := e.pending[0]
+	e.pending = e.pending[1:]
+	return addr
+}
+
+// readFrom reads the next packet from conn, which is either the socket of t or
+// an other socket that shares its port. The socket of t reports ICMP errors
+// when they are enabled.
+func (t *transport) readFrom(conn *net.UDPConn, gro *groReader, b []byte) (int, dgram.Addr, error) {
+	for {
+		if conn == t.c {
+			if addr := t.icmp.next(); addr != nil {
+				return 0, nil, &dgram.UnreachableError{Addr: addr}
+			}
+		}
+
+		var (
+			n    int
+			from dgram.Addr
+			err  error
+		)
+
+		if gro != nil {
+			n, from, err = gro.read(conn, b)
+		} else {
+			var uaddr *net.UDPAddr
+			n, uaddr, err = conn.ReadFromUDP(b)
+			if err == nil {
+				from = wrapAddr(uaddr)
+			}
+		}
+
+		if err != nil && conn == t.c && t.icmp != nil && isQueuedError(err) {
+			t.icmp.drain()
+			continue
+		}
+
+		return n, from, err
+	}
+}
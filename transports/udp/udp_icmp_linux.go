@@ -0,0 +1,144 @@
+package udp
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	soEEOriginICMP  = 2 // SO_EE_ORIGIN_ICMP
+	soEEOriginICMP6 = 3 // SO_EE_ORIGIN_ICMP6
+
+	maxErrQueueReads = 64
+)
+
+// enableRecvErr makes the kernel queue the ICMP errors caused by the packets
+// of conn.
+func enableRecvErr(conn *net.UDPConn, network string) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var serr error
+	err = rc.Control(func(fd uintptr) {
+		switch network {
+		case UDPv4:
+			serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_RECVERR, 1)
+		default:
+			serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_RECVERR, 1)
+			if network == UDP {
+				// the IPv4 peers of a dual-stack socket
+				syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_RECVERR, 1)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
+
+// readErrQueue drains the error queue of conn and returns the destinations
+// that were reported unreachable.
+func readErrQueue(conn *net.UDPConn) []udpAddr {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return nil
+	}
+
+	var (
+		addrs []udpAddr
+		buf   [1]byte
+		oob   [128]byte
+	)
+
+	rc.Control(func(fd uintptr) {
+		for i := 0; i < maxErrQueueReads; i++ {
+			_, oobn, _, from, err := syscall.Recvmsg(int(fd), buf[:], oob[:], syscall.MSG_ERRQUEUE|syscall.MSG_DONTWAIT)
+			if err != nil {
+				return
+			}
+			if !isUnreachableCmsg(oob[:oobn]) {
+				continue
+			}
+			if addr := sockaddrToUDP(from); addr != nil {
+				addrs = append(addrs, addr)
+			}
+		}
+	})
+
+	return addrs
+}
+
+// isUnreachableCmsg reports if the control messages of a queued error carry an
+// ICMP destination unreachable error (struct sock_extended_err).
+func isUnreachableCmsg(oob []byte) bool {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return false
+	}
+
+	for _, m := range msgs {
+		if !(m.Header.Level == syscall.SOL_IP && m.Header.Type == syscall.IP_RECVERR) &&
+			!(m.Header.Level == syscall.SOL_IPV6 && m.Header.Type == syscall.IPV6_RECVERR) {
+			continue
+		}
+		if len(m.Data) < 5 {
+			continue
+		}
+
+		var (
+			errno  = syscall.Errno(*(*uint32)(unsafe.Pointer(&m.Data[0])))
+			origin = m.Data[4]
+		)
+
+		if origin != soEEOriginICMP && origin != soEEOriginICMP6 {
+			continue
+		}
+		if isUnreachable(errno) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sockaddrToUDP returns the destination of a queued error.
+func sockaddrToUDP(sa syscall.Sockaddr) udpAddr {
+	switch a := sa.(type) {
+	case *syscall.SockaddrInet4:
+		ip := make(net.IP, net.IPv4len)
+		copy(ip, a.Addr[:])
+		return wrapAddr(&net.UDPAddr{IP: ip, Port: a.Port})
+
+	case *syscall.SockaddrInet6:
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, a.Addr[:])
+		addr := &net.UDPAddr{IP: ip, Port: a.Port}
+		if a.ZoneId != 0 {
+			if ifi, err := net.InterfaceByIndex(int(a.ZoneId)); err == nil {
+				addr.Zone = ifi.Name
+			}
+		}
+		return wrapAddr(addr)
+
+	default:
+		return nil
+	}
+}
+
+// isQueuedError reports if err is a socket error that was set by a queued
+// error. The error queue must be drained after such an error.
+func isQueuedError(err error) bool {
+	return isUnreachable(err) || isMsgSize(err)
+}
+
+// isUnreachable reports if err reports an unreachable destination.
+func isUnreachable(err error) bool {
+	return err != nil && (errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ENETUNREACH))
+}
@@ -0,0 +1,68 @@
+package udp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+	"github.com/telehash/gogotelehash/transports"
+)
+
+func TestICMPErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := Config{Addr: "127.0.0.1:0", ICMPErrors: true}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := Config{Addr: "127.0.0.1:0"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	// a port nobody listens on
+	closed, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if !assert.NoError(err) {
+		return
+	}
+	closed.Close()
+
+	c1, err := A.Dial(wrapAddr(closed.LocalAddr().(*net.UDPAddr)))
+	if !assert.NoError(err) {
+		return
+	}
+	c2, err := A.Dial(B.Addrs()[0])
+	if !assert.NoError(err) {
+		return
+	}
+
+	_, err = c1.Write([]byte("hello"))
+	assert.NoError(err)
+
+	buf := make([]byte, 1500)
+	c1.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = c1.Read(buf)
+	assert.Equal(transports.ErrUnreachable, err)
+
+	// the error does not affect the other peers
+	_, err = c2.Write([]byte("hello"))
+	assert.NoError(err)
+
+	c3, err := B.Accept()
+	if !assert.NoError(err) {
+		return
+	}
+	n, err := c3.Read(buf)
+	assert.NoError(err)
+	assert.Equal("hello", string(buf[:n]))
+
+	// the connection remains usable
+	_, err = c1.Write([]byte("hello"))
+	assert.NoError(err)
+	_, err = c1.Read(buf)
+	assert.Equal(transports.ErrUnreachable, err)
+}
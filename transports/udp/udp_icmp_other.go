@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package udp
+
+import (
+	"net"
+)
+
+func enableRecvErr(conn *net.UDPConn, network string) error {
+	return errICMPUnsupported
+}
+
+func readErrQueue(conn *net.UDPConn) []udpAddr {
+	return nil
+}
+
+func isQueuedError(err error) bool {
+	return false
+}
+
+func isUnreachable(err error) bool {
+	return false
+}
@@ -0,0 +1,272 @@
+package udp
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/telehash/gogotelehash/transports"
+	"github.com/telehash/gogotelehash/transports/dgram"
+)
+
+// Path MTU discovery
+//
+// The transport sets the don't-fragment flag on its packets and searches the
+// largest packet size that reaches each destination. Probes are padded to the
+// size under test; the peer answers each probe with a small ack. The kernel
+// handles ICMP "fragmentation needed" errors: it lowers the MTU of the route
+// and sending larger packets fails with EMSGSIZE, which ends the probe early
+// (and restarts the search when it happens to a regular packet).
+//
+// Probes and acks start with mtuMarker. Telehash packets start with the
+// (big endian) length of their header, which never starts with mtuMarker.
+
+const (
+	mtuMarker   = 0xFF
+	mtuProbe    = 'P' // marker, type, id (4), padding
+	mtuAck      = 'A' // marker, type, id (4), size (2)
+	mtuHdrSize  = 8
+	mtuAckSize  = 8
+	mtuBaseMTU  = 1232 // IPv6 minimum MTU minus the IPv6 and UDP headers
+	mtuAttempts = 3
+
+	mtuProbeTimeout = 200 * time.Millisecond
+	mtuExpire       = 10 * time.Minute
+)
+
+var errMTUUnsupported = errors.New("udp: MTU discovery is not supported on this platform")
+
+// mtuTransport discovers the path MTU of the destinations of the inner
+// transport.
+type mtuTransport struct {
+	dgram.Transport
+	max4, max6 int // the largest packets the local interfaces can send
+
+	mtx     sync.Mutex
+	paths   map[interface{}]*mtuPath
+	waiting map[uint32]chan struct{}
+}
+
+type mtuPath struct {
+	mtu      int // 0 until the first search completes
+	probing  bool
+	probedAt time.Time
+}
+
+var (
+	_ dgram.MTUTransport   = (*mtuTransport)(nil)
+	_ dgram.BatchTransport = (*mtuTransport)(nil)
+)
+
+func newMTUTransport(inner dgram.Transport, conn *net.UDPConn, network string) (*mtuTransport, error) {
+	if err := setDontFragment(conn, network); err != nil {
+		return nil, err
+	}
+
+	t := &mtuTransport{
+		Transport: inner,
+		max4:      transports.DefaultMTU,
+		max6:      transports.DefaultMTU,
+		paths:     make(map[interface{}]*mtuPath),
+		waiting:   make(map[uint32]chan struct{}),
+	}
+
+	if ifaces, err := net.Interfaces(); err == nil {
+		var max int
+		for _, ifi := range ifaces {
+			if ifi.Flags&net.FlagUp != 0 && ifi.MTU > max {
+				max = ifi.MTU
+			}
+		}
+		if max > 0 {
+			t.max4 = clampMTU(max - 28)
+			t.max6 = clampMTU(max - 48)
+		}
+	}
+
+	return t, nil
+}
+
+func clampMTU(n int) int {
+	if n > maxGSOSize {
+		return maxGSOSize
+	}
+	if n < mtuBaseMTU {
+		return mtuBaseMTU
+	}
+	return n
+}
+
+// MTU returns the discovered MTU of the path to addr. Until the first search
+// completes transports.DefaultMTU is returned.
+func (t *mtuTransport) MTU(addr dgram.Addr) int {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if p := t.paths[addr.Key()]; p != nil && p.mtu > 0 {
+		return p.mtu
+	}
+	return transports.DefaultMTU
+}
+
+func (t *mtuTransport) Read(b []byte) (int, dgram.Addr, error) {
+	for {
+		n, addr, err := t.Transport.Read(b)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if n >= mtuHdrSize && b[0] == mtuMarker {
+			t.handleControl(b[:n], addr)
+			continue
+		}
+
+		return n, addr, nil
+	}
+}
+
+func (t *mtuTransport) handleControl(b []byte, addr dgram.Addr) {
+	switch b[1] {
+	case mtuProbe:
+		// b may be truncated; the ack reports the received size
+		var ack [mtuAckSize]byte
+		ack[0], ack[1] = mtuMarker, mtuAck
+		copy(ack[2:6], b[2:6])
+		binary.BigEndian.PutUint16(ack[6:], uint16(len(b)))
+		t.Transport.Write(ack[:], addr)
+
+	case mtuAck:
+		id := binary.BigEndian.Uint32(b[2:6])
+		t.mtx.Lock()
+		if c := t.waiting[id]; c != nil {
+			delete(t.waiting, id)
+			close(c)
+		}
+		t.mtx.Unlock()
+	}
+}
+
+func (t *mtuTransport) Write(b []byte, addr dgram.Addr) (int, error) {
+	n, err := t.Transport.Write(b, addr)
+	if isMsgSize(err) {
+		// the route MTU was lowered; search again
+		t.discover(addr, true)
+	} else {
+		t.discover(addr, false)
+	}
+	return n, err
+}
+
+// WriteBatch sends pkts to addr with a single call when the inner transport
+// supports batches.
+func (t *mtuTransport) WriteBatch(pkts [][]byte, addr dgram.Addr) (int, error) {
+	b, ok := t.Transport.(dgram.BatchTransport)
+	if !ok {
+		for i, pkt := range pkts {
+			_, err := t.Write(pkt, addr)
+			if err != nil {
+				return i, err
+			}
+		}
+		return len(pkts), nil
+	}
+
+	n, err := b.WriteBatch(pkts, addr)
+	t.discover(addr, isMsgSize(err))
+	return n, err
+}
+
+// Files returns the sockets of the inner transport.
+func (t *mtuTransport) Files() ([]*os.File, error) {
+	if f, ok := t.Transport.(dgram.FileTransport); ok {
+		return f.Files()
+	}
+	return nil, nil
+}
+
+// discover starts a search for the MTU of the path to addr when the path is
+// unknown, expired or stale.
+func (t *mtuTransport) discover(addr dgram.Addr, stale bool) {
+	t.mtx.Lock()
+	p := t.paths[addr.Key()]
+	if p == nil {
+		p = &mtuPath{}
+		t.paths[addr.Key()] = p
+	}
+	start := !p.probing && (stale || p.probedAt.IsZero() || time.Since(p.probedAt) > mtuExpire)
+	if start {
+		p.probing = true
+	}
+	t.mtx.Unlock()
+
+	if start {
+		go t.search(addr, p)
+	}
+}
+
+// search performs a binary search for the largest packet that reaches addr.
+func (t *mtuTransport) search(addr dgram.Addr, p *mtuPath) {
+	lo, hi := mtuBaseMTU, t.max4
+	if a, ok := addr.(udpAddr); ok && a.IsIPv6() && a.GetIP().To4() == nil {
+		hi = t.max6
+	}
+
+	for lo < hi {
+		size := (lo + hi + 1) / 2
+		if t.probe(addr, size) {
+			lo = size
+		} else {
+			hi = size - 1
+		}
+	}
+
+	t.mtx.Lock()
+	p.mtu = lo
+	p.probing = false
+	p.probedAt = time.Now()
+	t.mtx.Unlock()
+}
+
+// probe reports if a packet of size bytes reaches addr.
+func (t *mtuTransport) probe(addr dgram.Addr, size int) bool {
+	buf := make([]byte, size)
+	buf[0], buf[1] = mtuMarker, mtuProbe
+
+	for i := 0; i < mtuAttempts; i++ {
+		id := rand.Uint32()
+		c := make(chan struct{})
+		binary.BigEndian.PutUint32(buf[2:6], id)
+
+		t.mtx.Lock()
+		t.waiting[id] = c
+		t.mtx.Unlock()
+
+		_, err := t.Transport.Write(buf, addr)
+		if err == nil {
+			select {
+			case <-c:
+				return true
+			case <-time.After(mtuProbeTimeout):
+			}
+		}
+
+		t.mtx.Lock()
+		delete(t.waiting, id)
+		t.mtx.Unlock()
+
+		if isMsgSize(err) {
+			return false
+		}
+	}
+
+	return false
+}
+
+func isMsgSize(err error) bool {
+	return err != nil && errors.Is(err, syscall.EMSGSIZE)
+}
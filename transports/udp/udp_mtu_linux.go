@@ -0,0 +1,33 @@
+package udp
+
+import (
+	"net"
+	"syscall"
+)
+
+// setDontFragment makes the kernel set the don't-fragment flag on all packets
+// and fail sends that exceed the MTU of the route.
+func setDontFragment(conn *net.UDPConn, network string) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var serr error
+	err = rc.Control(func(fd uintptr) {
+		switch network {
+		case UDPv4:
+			serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_DO)
+		default:
+			serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER, syscall.IPV6_PMTUDISC_DO)
+			if network == UDP {
+				// best effort for the IPv4 peers of a dual-stack socket
+				syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_DO)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
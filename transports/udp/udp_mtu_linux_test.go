@@ -0,0 +1,69 @@
+package udp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+	"github.com/telehash/gogotelehash/transports"
+)
+
+func TestMTUDiscovery(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := Config{Addr: "127.0.0.1:0", MTUDiscovery: true}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := Config{Addr: "127.0.0.1:0", MTUDiscovery: true}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	c1, err := A.Dial(B.Addrs()[0])
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(transports.DefaultMTU, transports.ConnMTU(c1))
+
+	// the first packet starts the search
+	_, err = c1.Write([]byte("hello"))
+	assert.NoError(err)
+
+	c2, err := B.Accept()
+	if !assert.NoError(err) {
+		return
+	}
+
+	buf := make([]byte, 1<<16)
+	n, err := c2.Read(buf)
+	assert.NoError(err)
+	assert.Equal("hello", string(buf[:n]))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for transports.ConnMTU(c1) == transports.DefaultMTU && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the loopback interface has a large MTU
+	mtu := transports.ConnMTU(c1)
+	if !assert.True(mtu > transports.DefaultMTU, "mtu=%d", mtu) {
+		return
+	}
+
+	// packets up to the MTU are delivered; probes are not
+	msg := bytes.Repeat([]byte{'x'}, 4000)
+	_, err = c1.Write(msg)
+	assert.NoError(err)
+
+	n, err = c2.Read(buf)
+	assert.NoError(err)
+	assert.Equal(msg, buf[:n])
+
+	_, err = c1.Write(make([]byte, mtu+1))
+	assert.Error(err)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package udp
+
+import (
+	"net"
+)
+
+func setDontFragment(conn *net.UDPConn, network string) error {
+	return errMTUUnsupported
+}
@@ -0,0 +1,148 @@
+package udp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/telehash/gogotelehash/internal/util/bufpool"
+	"github.com/telehash/gogotelehash/transports/dgram"
+	"github.com/telehash/gogotelehash/transports/transportsutil"
+)
+
+// multicastTransport is a UDP transport that also receives the packets sent
+// to a multicast group. Packets are always sent from the unicast socket, so
+// receivers see (and reply to) the unicast address of each sender.
+type multicastTransport struct {
+	*transport
+	mc    *net.UDPConn
+	local map[string]bool // IPs of this host; used to drop looped packets
+
+	c    chan multicastPacket
+	done chan struct{}
+	once sync.Once
+}
+
+type multicastPacket struct {
+	from udpAddr
+	buf  *bufpool.Buffer // nil when from is unreachable
+}
+
+var _ dgram.BatchTransport = (*multicastTransport)(nil)
+
+func openMulticast(c Config, unicast *transport) (*multicastTransport, error) {
+	group, err := net.ResolveUDPAddr(c.Network, c.Group)
+	if err != nil {
+		return nil, err
+	}
+	if !group.IP.IsMulticast() || group.Port == 0 {
+		return nil, errors.New("udp: Group must be a multicast address with a port")
+	}
+	network := c.Network
+	if network == UDP {
+		// the unicast socket is dual-stack; the group decides the family
+		network = UDPv6
+		if ipIs4(group.IP) {
+			network = UDPv4
+		}
+	}
+	if ipIs4(group.IP) != (network == UDPv4) {
+		return nil, errors.New("udp: Group doesn't match Network")
+	}
+
+	var ifi *net.Interface
+	if c.Interface != "" {
+		ifi, err = net.InterfaceByName(c.Interface)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	mc, err := net.ListenMulticastUDP(network, ifi, group)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &multicastTransport{
+		transport: unicast,
+		mc:        mc,
+		local:     map[string]bool{},
+		c:         make(chan multicastPacket, 64),
+		done:      make(chan struct{}),
+	}
+
+	if ips, err := transportsutil.InterfaceIPs(); err == nil {
+		for _, ip := range ips {
+			t.local[ip.IP.String()] = true
+		}
+	}
+	t.local[net.IPv4(127, 0, 0, 1).String()] = true
+	t.local[net.IPv6loopback.String()] = true
+
+	go t.reader(unicast.c, false)
+	go t.reader(mc, true)
+
+	return t, nil
+}
+
+func (t *multicastTransport) reader(conn *net.UDPConn, multicast bool) {
+	b := make([]byte, maxGSOSize)
+
+	for {
+		var pkt multicastPacket
+
+		n, addr, err := t.readFrom(conn, nil, b)
+		if uerr, ok := err.(*dgram.UnreachableError); ok {
+			// queued without a buffer; see Read
+			pkt.from = uerr.Addr.(udpAddr)
+		} else if err != nil {
+			t.Close()
+			return
+		} else {
+			from := addr.(udpAddr)
+			if multicast && t.isOwn(from) {
+				// our own packet looped back by the group
+				continue
+			}
+			pkt = multicastPacket{from, bufpool.New().Set(b[:n])}
+		}
+
+		select {
+		case t.c <- pkt:
+		case <-t.done:
+			pkt.buf.Free()
+			return
+		}
+	}
+}
+
+func (t *multicastTransport) isOwn(addr udpAddr) bool {
+	return addr.GetPort() == t.laddr.GetPort() && t.local[addr.GetIP().String()]
+}
+
+func (t *multicastTransport) Read(b []byte) (int, dgram.Addr, error) {
+	select {
+	case pkt := <-t.c:
+		if pkt.buf == nil {
+			return 0, nil, &dgram.UnreachableError{Addr: pkt.from}
+		}
+		n := len(pkt.buf.Get(b[:0]))
+		pkt.buf.Free()
+		return n, pkt.from, nil
+	case <-t.done:
+		return 0, nil, io.EOF
+	}
+}
+
+func (t *multicastTransport) Close() error {
+	var err error
+	t.once.Do(func() {
+		close(t.done)
+		err = t.transport.Close()
+		if err2 := t.mc.Close(); err == nil {
+			err = err2
+		}
+	})
+	return err
+}
@@ -0,0 +1,133 @@
+package udp
+
+import (
+	"net"
+
+	"github.com/telehash/gogotelehash/transports/transportsutil"
+)
+
+// ipv4OnlyName is resolved to discover the NAT64 prefixes of the network
+// (RFC 7050). A DNS64 resolver answers with AAAA records that embed one of
+// ipv4OnlyAddrs.
+const ipv4OnlyName = "ipv4only.arpa"
+
+var ipv4OnlyAddrs = []net.IP{
+	net.IPv4(192, 0, 0, 170).To4(),
+	net.IPv4(192, 0, 0, 171).To4(),
+}
+
+// nat64PrefixLens are the prefix lengths defined by RFC 6052 (longest first).
+var nat64PrefixLens = []int{96, 64, 56, 48, 40, 32}
+
+// nat64Prefix is an IPv6 prefix that is translated to IPv4 by a NAT64
+// gateway.
+type nat64Prefix struct {
+	ip   net.IP
+	bits int
+}
+
+// nat64Offsets returns the offsets of the bytes of an IPv6 address with a
+// prefix of bits that hold the embedded IPv4 address. Bits 64 to 71 are
+// reserved (RFC 6052 section 2.2).
+func nat64Offsets(bits int) [4]int {
+	var (
+		offs [4]int
+		n    int
+	)
+	for i := bits / 8; n < 4; i++ {
+		if i != 8 {
+			offs[n] = i
+			n++
+		}
+	}
+	return offs
+}
+
+// synthesize embeds ip4 in the prefix.
+func (p nat64Prefix) synthesize(ip4 net.IP) net.IP {
+	ip4 = ip4.To4()
+	ip6 := make(net.IP, net.IPv6len)
+	copy(ip6, p.ip[:p.bits/8])
+	for i, off := range nat64Offsets(p.bits) {
+		ip6[off] = ip4[i]
+	}
+	return ip6
+}
+
+// extractNAT64Prefix returns the prefix of ip6 when it embeds one of the
+// well-known addresses of ipv4only.arpa.
+func extractNAT64Prefix(ip6 net.IP) (nat64Prefix, bool) {
+	ip6 = ip6.To16()
+	if ip6 == nil || ipIs4(ip6) {
+		return nat64Prefix{}, false
+	}
+
+	for _, bits := range nat64PrefixLens {
+		var embedded [4]byte
+		for i, off := range nat64Offsets(bits) {
+			embedded[i] = ip6[off]
+		}
+
+		for _, known := range ipv4OnlyAddrs {
+			if net.IP(embedded[:]).Equal(known) {
+				prefix := make(net.IP, net.IPv6len)
+				copy(prefix, ip6[:bits/8])
+				return nat64Prefix{ip: prefix, bits: bits}, true
+			}
+		}
+	}
+
+	return nat64Prefix{}, false
+}
+
+// discoverNAT64 returns the NAT64 prefixes that are advertised by the DNS64
+// resolver of the host. It returns nil when the network has no NAT64 gateway.
+func discoverNAT64(lookup func(host string) ([]net.IP, error)) []nat64Prefix {
+	ips, err := lookup(ipv4OnlyName)
+	if err != nil {
+		return nil
+	}
+
+	var prefixes []nat64Prefix
+	for _, ip := range ips {
+		p, ok := extractNAT64Prefix(ip)
+		if !ok {
+			continue
+		}
+
+		dup := false
+		for _, q := range prefixes {
+			if q.bits == p.bits && q.ip.Equal(p.ip) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			prefixes = append(prefixes, p)
+		}
+	}
+
+	return prefixes
+}
+
+// hasIPv4Connectivity reports if any interface has a routable IPv4 address.
+func hasIPv4Connectivity() bool {
+	ips, err := transportsutil.InterfaceIPs()
+	if err != nil {
+		// assume the best; synthesized addresses are only a fallback
+		return true
+	}
+
+	for _, ip := range ips {
+		if ipIs4(ip.IP) && !ip.IP.IsLoopback() {
+			return true
+		}
+	}
+	return false
+}
+
+// nat64Addr returns the IPv6 address through which the IPv4 address a can be
+// reached.
+func (t *transport) nat64Addr(a *udpv4) udpAddr {
+	return wrapAddr(&net.UDPAddr{IP: t.nat64[0].synthesize(a.IP), Port: a.Port})
+}
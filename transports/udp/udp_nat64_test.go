@@ -0,0 +1,86 @@
+package udp
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+)
+
+func TestNAT64Synthesize(t *testing.T) {
+	assert := assert.New(t)
+
+	// examples from RFC 6052 section 2.4
+	var tab = []struct {
+		prefix string
+		bits   int
+		ip6    string
+	}{
+		{"2001:db8::", 32, "2001:db8:c000:221::"},
+		{"2001:db8:100::", 40, "2001:db8:1c0:2:21::"},
+		{"2001:db8:122::", 48, "2001:db8:122:c000:2:2100::"},
+		{"2001:db8:122:300::", 56, "2001:db8:122:3c0:0:221::"},
+		{"2001:db8:122:344::", 64, "2001:db8:122:344:c0:2:2100:0"},
+		{"2001:db8:122:344::", 96, "2001:db8:122:344::192.0.2.33"},
+		{"64:ff9b::", 96, "64:ff9b::192.0.2.33"},
+	}
+
+	for _, row := range tab {
+		p := nat64Prefix{ip: net.ParseIP(row.prefix), bits: row.bits}
+		assert.Equal(net.ParseIP(row.ip6).String(), p.synthesize(net.ParseIP("192.0.2.33")).String(), "bits=%d", row.bits)
+
+		// the same prefix embedding 192.0.0.170 is recognized
+		q, ok := extractNAT64Prefix(p.synthesize(net.IPv4(192, 0, 0, 170)))
+		if assert.True(ok, "bits=%d", row.bits) {
+			assert.Equal(row.bits, q.bits)
+			assert.True(q.ip.Equal(p.ip))
+		}
+	}
+
+	_, ok := extractNAT64Prefix(net.ParseIP("2001:db8::1"))
+	assert.False(ok)
+}
+
+func TestNAT64Discover(t *testing.T) {
+	assert := assert.New(t)
+
+	prefixes := discoverNAT64(func(host string) ([]net.IP, error) {
+		assert.Equal("ipv4only.arpa", host)
+		return []net.IP{
+			net.ParseIP("192.0.0.170"),
+			net.ParseIP("64:ff9b::192.0.0.170"),
+			net.ParseIP("64:ff9b::192.0.0.171"),
+		}, nil
+	})
+	if assert.Len(prefixes, 1) {
+		assert.Equal(96, prefixes[0].bits)
+		assert.True(prefixes[0].ip.Equal(net.ParseIP("64:ff9b::")))
+	}
+
+	prefixes = discoverNAT64(func(host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("192.0.0.170")}, nil
+	})
+	assert.Empty(prefixes)
+
+	prefixes = discoverNAT64(func(host string) ([]net.IP, error) {
+		return nil, errors.New("no such host")
+	})
+	assert.Empty(prefixes)
+}
+
+func TestNAT64NormalizeAddr(t *testing.T) {
+	assert := assert.New(t)
+
+	tr := &transport{net: UDPv6, nat64: []nat64Prefix{{ip: net.ParseIP("64:ff9b::"), bits: 96}}}
+
+	addr, err := tr.NormalizeAddr(&net.UDPAddr{IP: net.ParseIP("192.0.2.33"), Port: 42424})
+	if assert.NoError(err) {
+		assert.Equal("udp6", addr.Network())
+		assert.Equal("[64:ff9b::c000:221]:42424", addr.String())
+	}
+
+	tr.nat64 = nil
+	_, err = tr.NormalizeAddr(&net.UDPAddr{IP: net.ParseIP("192.0.2.33"), Port: 42424})
+	assert.Error(err)
+}
@@ -0,0 +1,120 @@
+package udp
+
+import (
+	"net"
+
+	"github.com/telehash/gogotelehash/transports/dgram"
+)
+
+const (
+	// maxGSOSegments is the maximum number of segments the kernel accepts in
+	// one GSO send.
+	maxGSOSegments = 64
+
+	// maxGSOSize is the largest payload of one GSO send (the largest IPv4 UDP
+	// payload).
+	maxGSOSize = 65507
+)
+
+// groReader splits the coalesced datagrams read from a socket with UDP GRO
+// enabled.
+type groReader struct {
+	buf     []byte
+	oob     []byte
+	pending []byte
+	segSize int
+	from    udpAddr
+}
+
+func newGROReader() *groReader {
+	return &groReader{buf: make([]byte, 1<<16), oob: make([]byte, 64)}
+}
+
+// read returns the next datagram. Datagrams that were coalesced by the
+// kernel are returned one by one.
+func (r *groReader) read(conn *net.UDPConn, b []byte) (int, dgram.Addr, error) {
+	for len(r.pending) == 0 {
+		n, oobn, _, uaddr, err := conn.ReadMsgUDP(r.buf, r.oob)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		r.pending = r.buf[:n]
+		r.segSize = groSegmentSize(r.oob[:oobn])
+		if r.segSize <= 0 {
+			r.segSize = n
+		}
+		r.from = wrapAddr(uaddr)
+	}
+
+	seg := r.pending
+	if len(seg) > r.segSize {
+		seg = seg[:r.segSize]
+	}
+	r.pending = r.pending[len(seg):]
+
+	return copy(b, seg), r.from, nil
+}
+
+// WriteBatch sends pkts to addr and returns the number of packets that were
+// sent. With GSO, runs of equally sized packets (the last packet of a run may
+// be shorter) are sent with a single system call.
+func (t *transport) WriteBatch(pkts [][]byte, addr dgram.Addr) (int, error) {
+	uaddr := addr.(udpAddr).ToUDPAddr()
+
+	if !t.gso {
+		for i, pkt := range pkts {
+			_, err := t.Write(pkt, addr)
+			if err != nil {
+				return i, err
+			}
+		}
+		return len(pkts), nil
+	}
+
+	t.mtxGSO.Lock()
+	defer t.mtxGSO.Unlock()
+
+	sent := 0
+	for sent < len(pkts) {
+		var (
+			run     = pkts[sent:]
+			segSize = len(run[0])
+			buf     = t.gsoBuf[:0]
+			n       = 0
+		)
+
+		for n < len(run) && n < maxGSOSegments &&
+			len(run[n]) <= segSize && len(buf)+len(run[n]) <= maxGSOSize {
+			buf = append(buf, run[n]...)
+			n++
+			if len(run[n-1]) < segSize {
+				// a short segment ends the run
+				break
+			}
+		}
+		t.gsoBuf = buf
+
+		var err error
+		if n == 1 || segSize == 0 {
+			n = 1
+			_, err = t.Write(run[0], addr)
+		} else {
+			_, _, err = t.c.WriteMsgUDP(buf, gsoControl(segSize), uaddr)
+			if err != nil && t.icmp != nil && isQueuedError(err) {
+				t.icmp.drain()
+				if isUnreachable(err) {
+					// caused by an earlier packet; see Write
+					_, _, err = t.c.WriteMsgUDP(buf, gsoControl(segSize), uaddr)
+				}
+			}
+		}
+		if err != nil {
+			return sent, err
+		}
+
+		sent += n
+	}
+
+	return sent, nil
+}
@@ -0,0 +1,71 @@
+package udp
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	solUDP     = 17  // SOL_UDP
+	udpSegment = 103 // UDP_SEGMENT
+	udpGRO     = 104 // UDP_GRO
+)
+
+// enableOffload enables the requested offloads the kernel supports (GSO since
+// Linux 4.18, GRO since Linux 5.0).
+func enableOffload(conn *net.UDPConn, gso, gro bool) (gsoOK, groOK bool) {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return false, false
+	}
+
+	rc.Control(func(fd uintptr) {
+		if gso {
+			_, err := syscall.GetsockoptInt(int(fd), solUDP, udpSegment)
+			gsoOK = err == nil
+		}
+		if gro {
+			groOK = syscall.SetsockoptInt(int(fd), solUDP, udpGRO, 1) == nil
+		}
+	})
+
+	return gsoOK, groOK
+}
+
+// gsoControl returns the control message that makes the kernel split a send
+// into segments of segSize bytes.
+func gsoControl(segSize int) []byte {
+	b := make([]byte, syscall.CmsgSpace(2))
+
+	h := (*syscall.Cmsghdr)(unsafe.Pointer(&b[0]))
+	h.Level = solUDP
+	h.Type = udpSegment
+	h.SetLen(syscall.CmsgLen(2))
+
+	*(*uint16)(unsafe.Pointer(&b[syscall.CmsgLen(0)])) = uint16(segSize)
+	return b
+}
+
+// groSegmentSize returns the segment size of a coalesced datagram or 0 when
+// the datagram was not coalesced.
+func groSegmentSize(oob []byte) int {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0
+	}
+
+	for _, m := range msgs {
+		if m.Header.Level != solUDP || m.Header.Type != udpGRO {
+			continue
+		}
+		switch {
+		case len(m.Data) >= 4:
+			return int(*(*int32)(unsafe.Pointer(&m.Data[0])))
+		case len(m.Data) >= 2:
+			return int(*(*uint16)(unsafe.Pointer(&m.Data[0])))
+		}
+	}
+
+	return 0
+}
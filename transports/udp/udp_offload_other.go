@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package udp
+
+import (
+	"net"
+)
+
+// UDP segmentation offloads are only supported on Linux.
+
+func enableOffload(conn *net.UDPConn, gso, gro bool) (gsoOK, groOK bool) {
+	return false, false
+}
+
+func gsoControl(segSize int) []byte { return nil }
+
+func groSegmentSize(oob []byte) int { return 0 }
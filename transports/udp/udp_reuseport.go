@@ -0,0 +1,138 @@
+package udp
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/telehash/gogotelehash/internal/util/bufpool"
+	"github.com/telehash/gogotelehash/transports/dgram"
+)
+
+// reusePortTransport receives on multiple sockets that are bound to the same
+// port with SO_REUSEPORT. The kernel spreads the flows over the sockets and
+// each socket is read by its own goroutine. Packets are sent from the first
+// socket.
+type reusePortTransport struct {
+	*transport
+	extra []*net.UDPConn
+
+	queue chan reusePortPacket
+	done  chan struct{}
+	once  sync.Once
+}
+
+type reusePortPacket struct {
+	from udpAddr
+	buf  *bufpool.Buffer // nil when from is unreachable
+}
+
+var _ dgram.BatchTransport = (*reusePortTransport)(nil)
+
+func openReusePort(c Config, first *transport) (*reusePortTransport, error) {
+	t := &reusePortTransport{
+		transport: first,
+		queue:     make(chan reusePortPacket, 64*c.Sockets),
+		done:      make(chan struct{}),
+	}
+
+	// bind the other sockets to the port of the first socket
+	addr := first.c.LocalAddr().(*net.UDPAddr)
+	for i := 1; i < c.Sockets; i++ {
+		conn, err := c.listen(addr)
+		if err != nil {
+			for _, conn := range t.extra {
+				conn.Close()
+			}
+			return nil, err
+		}
+		t.extra = append(t.extra, conn)
+	}
+
+	go t.reader(first.c, first.gro)
+	for _, conn := range t.extra {
+		var gro *groReader
+		if _, ok := enableOffload(conn, false, c.GRO); ok {
+			gro = newGROReader()
+		}
+		go t.reader(conn, gro)
+	}
+
+	return t, nil
+}
+
+func (t *reusePortTransport) reader(conn *net.UDPConn, gro *groReader) {
+	b := make([]byte, maxGSOSize)
+
+	for {
+		var pkt reusePortPacket
+
+		n, from, err := t.readFrom(conn, gro, b)
+		if uerr, ok := err.(*dgram.UnreachableError); ok {
+			// queued without a buffer; see Read
+			pkt.from = uerr.Addr.(udpAddr)
+		} else if err != nil {
+			t.Close()
+			return
+		} else {
+			pkt = reusePortPacket{from.(udpAddr), bufpool.New().Set(b[:n])}
+		}
+
+		select {
+		case t.queue <- pkt:
+		case <-t.done:
+			pkt.buf.Free()
+			return
+		}
+	}
+}
+
+func (t *reusePortTransport) Read(b []byte) (int, dgram.Addr, error) {
+	select {
+	case pkt := <-t.queue:
+		if pkt.buf == nil {
+			return 0, nil, &dgram.UnreachableError{Addr: pkt.from}
+		}
+		n := len(pkt.buf.Get(b[:0]))
+		pkt.buf.Free()
+		return n, pkt.from, nil
+	case <-t.done:
+		return 0, nil, io.EOF
+	}
+}
+
+// Files returns all sockets that are bound to the port.
+func (t *reusePortTransport) Files() ([]*os.File, error) {
+	files, err := t.transport.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, conn := range t.extra {
+		f, err := conn.File()
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	return files, nil
+}
+
+func (t *reusePortTransport) Close() error {
+	var err error
+	t.once.Do(func() {
+		close(t.done)
+		err = t.transport.Close()
+		for _, conn := range t.extra {
+			if err2 := conn.Close(); err == nil {
+				err = err2
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,65 @@
+package udp
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+)
+
+func TestSockets(t *testing.T) {
+	assert := assert.New(t)
+
+	inner, err := Config{Addr: "127.0.0.1:0", Sockets: 4}.open()
+	if !assert.NoError(err) {
+		return
+	}
+	rt := inner.(*reusePortTransport)
+	if !assert.Len(rt.extra, 3) {
+		return
+	}
+	for _, conn := range rt.extra {
+		assert.Equal(rt.c.LocalAddr().String(), conn.LocalAddr().String())
+	}
+	inner.Close()
+
+	A, err := Config{Addr: "127.0.0.1:0", Sockets: 4}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	// packets from many peers are received on all sockets
+	var peers = make(map[string]bool)
+	for i := 0; i < 16; i++ {
+		B, err := Config{Addr: "127.0.0.1:0"}.Open()
+		if !assert.NoError(err) {
+			return
+		}
+		defer B.Close()
+
+		c, err := B.Dial(A.Addrs()[0])
+		if !assert.NoError(err) {
+			return
+		}
+		_, err = c.Write([]byte(fmt.Sprint(i)))
+		assert.NoError(err)
+		peers[B.Addrs()[0].String()] = true
+	}
+
+	buf := make([]byte, 1500)
+	for i := 0; i < 16; i++ {
+		c, err := A.Accept()
+		if !assert.NoError(err) {
+			return
+		}
+		assert.True(peers[c.RemoteAddr().String()])
+		delete(peers, c.RemoteAddr().String())
+
+		_, err = c.Read(buf)
+		assert.NoError(err)
+	}
+
+	_, err = Config{Group: "239.192.84.72:42424", Sockets: 2}.Open()
+	assert.Error(err)
+}
@@ -0,0 +1,86 @@
+package udp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+
+	"github.com/telehash/gogotelehash/transports/handover"
+)
+
+var errSockoptUnsupported = errors.New("udp: socket options are not supported on this platform")
+
+// hasSockopts reports if c sets socket options that must be applied before
+// binding the socket.
+func (c *Config) hasSockopts() bool {
+	return c.DSCP != 0 || c.TTL != 0 || c.ReuseAddr || c.ReusePort
+}
+
+// listen binds the unicast socket of the transport and applies the socket
+// options of c.
+func (c *Config) listen(addr *net.UDPAddr) (*net.UDPConn, error) {
+	if c.DSCP < 0 || c.DSCP > 63 {
+		return nil, errors.New("udp: DSCP must be between 0 and 63")
+	}
+	if c.TTL < 0 || c.TTL > 255 {
+		return nil, errors.New("udp: TTL must be between 0 and 255")
+	}
+	if c.ReadBuffer < 0 || c.WriteBuffer < 0 {
+		return nil, errors.New("udp: buffer sizes must not be negative")
+	}
+
+	var (
+		conn *net.UDPConn
+		err  error
+	)
+
+	if conn = handover.UDPConn(c.Network, addr); conn != nil {
+		// inherited from the previous process; the socket options that
+		// must be set before binding were applied by that process
+	} else if c.hasSockopts() {
+		conn, err = listenWithSockopts(c.Network, addr, func(network string, fd uintptr) error {
+			return setSockopts(c, network, fd)
+		})
+	} else {
+		conn, err = net.ListenUDP(c.Network, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ReadBuffer > 0 {
+		err = conn.SetReadBuffer(c.ReadBuffer)
+	}
+	if err == nil && c.WriteBuffer > 0 {
+		err = conn.SetWriteBuffer(c.WriteBuffer)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// listenWithSockopts binds a socket after set was called with the socket.
+func listenWithSockopts(network string, addr *net.UDPAddr, set func(network string, fd uintptr) error) (*net.UDPConn, error) {
+	lc := net.ListenConfig{
+		Control: func(network, address string, rc syscall.RawConn) error {
+			var err error
+			cerr := rc.Control(func(fd uintptr) {
+				err = set(network, fd)
+			})
+			if cerr != nil {
+				return cerr
+			}
+			return err
+		},
+	}
+
+	conn, err := lc.ListenPacket(context.Background(), network, addr.String())
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*net.UDPConn), nil
+}
@@ -0,0 +1,10 @@
+//go:build darwin || freebsd || netbsd || openbsd
+// +build darwin freebsd netbsd openbsd
+
+package udp
+
+import (
+	"syscall"
+)
+
+const soReusePort = syscall.SO_REUSEPORT
@@ -0,0 +1,7 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+// +build linux,!mips,!mipsle,!mips64,!mips64le
+
+package udp
+
+// SO_REUSEPORT is missing from package syscall on Linux.
+const soReusePort = 0xf
@@ -0,0 +1,61 @@
+package udp
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+)
+
+func TestSockopts(t *testing.T) {
+	assert := assert.New(t)
+
+	inner, err := Config{
+		Addr:        "127.0.0.1:0",
+		ReadBuffer:  1 << 16,
+		WriteBuffer: 1 << 16,
+		DSCP:        46,
+		TTL:         7,
+		ReuseAddr:   true,
+		ReusePort:   true,
+	}.open()
+	if !assert.NoError(err) {
+		return
+	}
+	A := inner.(*transport)
+	defer A.Close()
+
+	rc, err := A.c.SyscallConn()
+	if !assert.NoError(err) {
+		return
+	}
+
+	rc.Control(func(fd uintptr) {
+		get := func(level, opt int) int {
+			v, err := syscall.GetsockoptInt(int(fd), level, opt)
+			assert.NoError(err)
+			return v
+		}
+
+		assert.Equal(46<<2, get(syscall.IPPROTO_IP, syscall.IP_TOS))
+		assert.Equal(7, get(syscall.IPPROTO_IP, syscall.IP_TTL))
+		assert.Equal(1, get(syscall.SOL_SOCKET, syscall.SO_REUSEADDR))
+		assert.Equal(1, get(syscall.SOL_SOCKET, soReusePort))
+
+		// the kernel doubles the requested size
+		assert.True(get(syscall.SOL_SOCKET, syscall.SO_RCVBUF) >= 1<<16)
+		assert.True(get(syscall.SOL_SOCKET, syscall.SO_SNDBUF) >= 1<<16)
+	})
+
+	// a second socket can bind the same port
+	B, err := Config{Addr: A.laddr.String(), ReusePort: true}.Open()
+	if assert.NoError(err) {
+		B.Close()
+	}
+
+	_, err = Config{Addr: A.laddr.String()}.Open()
+	assert.Error(err)
+
+	_, err = Config{DSCP: 64}.Open()
+	assert.Error(err)
+}
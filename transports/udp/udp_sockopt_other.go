@@ -0,0 +1,8 @@
+//go:build !darwin && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!freebsd,!linux,!netbsd,!openbsd
+
+package udp
+
+func setSockopts(c *Config, network string, fd uintptr) error {
+	return errSockoptUnsupported
+}
@@ -0,0 +1,64 @@
+//go:build darwin || freebsd || linux || netbsd || openbsd
+// +build darwin freebsd linux netbsd openbsd
+
+package udp
+
+import (
+	"syscall"
+)
+
+// setSockopts applies the socket options of c to the socket fd of network
+// (udp4 or udp6; udp6 sockets may be dual-stack).
+func setSockopts(c *Config, network string, fd uintptr) error {
+	var (
+		s   = int(fd)
+		v6  = network == UDPv6
+		err error
+	)
+
+	if c.ReuseAddr {
+		err = syscall.SetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.ReusePort {
+		err = syscall.SetsockoptInt(s, syscall.SOL_SOCKET, soReusePort, 1)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.DSCP != 0 {
+		tos := c.DSCP << 2
+		if v6 {
+			err = syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, tos)
+			if err == nil && c.Network == UDP {
+				// IPv4 peers of a dual-stack socket (best effort)
+				syscall.SetsockoptInt(s, syscall.IPPROTO_IP, syscall.IP_TOS, tos)
+			}
+		} else {
+			err = syscall.SetsockoptInt(s, syscall.IPPROTO_IP, syscall.IP_TOS, tos)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.TTL != 0 {
+		if v6 {
+			err = syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, c.TTL)
+			if err == nil && c.Network == UDP {
+				syscall.SetsockoptInt(s, syscall.IPPROTO_IP, syscall.IP_TTL, c.TTL)
+			}
+		} else {
+			err = syscall.SetsockoptInt(s, syscall.IPPROTO_IP, syscall.IP_TTL, c.TTL)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
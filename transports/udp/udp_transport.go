@@ -1,11 +1,21 @@
 // Package udp implements the UDP transport.
 //
 // The UDP transport is NAT-able.
+//
+// In multicast mode the transport also receives the packets sent to a
+// multicast group, which lets endpoints on a LAN find each other without any
+// configuration. Packets sent to the group address reach every member;
+// members reply to the unicast address of the sender:
+//
+//	e3x.New(keys, udp.Config{Group: "239.192.84.72:42424"})
 package udp
 
 import (
 	"errors"
 	"net"
+	"os"
+	"sort"
+	"sync"
 
 	"github.com/telehash/gogotelehash/transports"
 	"github.com/telehash/gogotelehash/transports/dgram"
@@ -14,9 +24,10 @@ import (
 
 // Config for the UDP transport. Typically the zero value is sufficient to get started.
 //
-//   e3x.New(keys, udp.Config{})
+//	e3x.New(keys, udp.Config{})
 type Config struct {
-	// Can be set to UDPv4, UDPv6 or can be left blank.
+	// Can be set to UDPv4, UDPv6, UDP or can be left blank.
+	// UDP binds a single dual-stack socket for both IPv4 and IPv6 peers.
 	// Defaults to UDPv4
 	Network string
 
@@ -25,6 +36,84 @@ type Config struct {
 	// When port is unspecified ("127.0.0.1") a random port will be chosen.
 	// When ip is unspecified (":3000") the transport will listen on all interfaces.
 	Addr string
+
+	// Group enables multicast mode when set to a multicast group address
+	// with a port ("239.192.84.72:42424"). Network defaults to the network
+	// of the group.
+	Group string
+
+	// Interface is the name of the network interface that joins Group.
+	// Defaults to the interface chosen by the system.
+	Interface string
+
+	// GSO enables UDP segmentation offload for batched sends when the kernel
+	// supports it (Linux 4.18 and later).
+	GSO bool
+
+	// GRO enables UDP generic receive offload when the kernel supports it
+	// (Linux 5.0 and later): the kernel coalesces the datagrams of a flow and
+	// the transport splits them again, which saves system calls on bulk
+	// transfers. GRO is not used in multicast mode.
+	GRO bool
+
+	// ReadBuffer and WriteBuffer set the sizes of the kernel buffers of the
+	// socket (SO_RCVBUF and SO_SNDBUF). Zero keeps the system defaults.
+	ReadBuffer  int
+	WriteBuffer int
+
+	// DSCP marks sent packets with a Differentiated Services code point
+	// (0-63; for example 46 for expedited forwarding). It sets the IPv4 TOS
+	// or IPv6 traffic class to DSCP << 2.
+	DSCP int
+
+	// TTL sets the IPv4 TTL or IPv6 hop limit of sent packets (1-255). Zero
+	// keeps the system default.
+	TTL int
+
+	// ReuseAddr and ReusePort set SO_REUSEADDR and SO_REUSEPORT on the
+	// socket before it is bound.
+	ReuseAddr bool
+	ReusePort bool
+
+	// Sockets is the number of sockets that are bound to the port. With more
+	// than one socket SO_REUSEPORT is enabled, the kernel spreads the packets
+	// of different peers over the sockets and each socket is read by its own
+	// goroutine, so receiving scales across cores. Defaults to 1. Not
+	// supported in multicast mode.
+	Sockets int
+
+	// MTUDiscovery enables path MTU discovery (Linux only): packets are sent
+	// with the don't-fragment flag and the transport probes the largest
+	// packet that reaches each destination. Connections report the result
+	// with transports.ConnMTU. Peers must enable MTUDiscovery too to answer
+	// the probes.
+	MTUDiscovery bool
+
+	// ICMPErrors makes the transport listen for the ICMP errors caused by its
+	// packets (Linux only). When a peer is reported unreachable (port, host or
+	// network unreachable) reading from the connection to the peer returns
+	// transports.ErrUnreachable, which lets the exchange fail over to an other
+	// path at once instead of waiting for its acks to time out.
+	ICMPErrors bool
+
+	// Readers is the number of goroutines that read received packets (see
+	// dgram.Options). Packets of one peer may be reordered when Readers is
+	// larger than one. GRO is not used on the first socket when Readers is
+	// larger than one. Defaults to 1.
+	Readers int
+
+	// QueueSize caps the number of received packets that are queued for each
+	// peer; DropPolicy decides which packet is dropped when the queue is full.
+	// Zero means no cap.
+	QueueSize  int
+	DropPolicy transports.DropPolicy
+
+	// NAT64 lets an IPv6 transport (Network UDPv6 or UDP) reach IPv4 peers on
+	// IPv6-only networks. When the host has no IPv4 address the transport
+	// discovers the NAT64 prefix of the network from its DNS64 resolver
+	// (RFC 7050) and sends the packets for IPv4 addresses to the synthesized
+	// IPv6 addresses (RFC 6052).
+	NAT64 bool
 }
 
 const (
@@ -32,28 +121,60 @@ const (
 	UDPv4 = "udp4"
 	// UDPv6 is used for IPv6 UDP networks
 	UDPv6 = "udp6"
+	// UDP is used for dual-stack (IPv4 and IPv6) UDP networks
+	UDP = "udp"
 )
 
-type connKey [18]byte
+type connKey struct {
+	addr [18]byte
+	zone string
+}
 
 type transport struct {
 	net   string
 	laddr udpAddr
 	c     *net.UDPConn
+	gro   *groReader    // nil when GRO is disabled
+	icmp  *icmpErrors   // nil when ICMP errors are disabled
+	nat64 []nat64Prefix // nil when IPv4 peers are reached directly
+
+	gso    bool
+	mtxGSO sync.Mutex
+	gsoBuf []byte
 }
 
 var (
-	_ dgram.Transport   = (*transport)(nil)
-	_ transports.Config = Config{}
+	_ dgram.BatchTransport = (*transport)(nil)
+	_ dgram.FileTransport  = (*transport)(nil)
+	_ transports.Config    = Config{}
 )
 
 // Open opens the transport.
 func (c Config) Open() (transports.Transport, error) {
+	t, err := c.open()
+	if err != nil {
+		return nil, err
+	}
+	return dgram.WrapWithOptions(t, dgram.Options{
+		Readers:    c.Readers,
+		QueueSize:  c.QueueSize,
+		DropPolicy: c.DropPolicy,
+	})
+}
+
+func (c Config) open() (dgram.Transport, error) {
 	var (
 		addr *net.UDPAddr
 		err  error
 	)
 
+	if c.Network == "" && c.Group != "" {
+		if host, _, err := net.SplitHostPort(c.Group); err == nil {
+			if ip := net.ParseIP(host); ip != nil && !ipIs4(ip) {
+				c.Network = UDPv6
+			}
+		}
+	}
 	if c.Network == "" {
 		c.Network = UDPv4
 	}
@@ -61,8 +182,24 @@ func (c Config) Open() (transports.Transport, error) {
 		c.Addr = ":0"
 	}
 
-	if c.Network != UDPv4 && c.Network != UDPv6 {
-		return nil, errors.New("udp: Network must be either `udp4` or `udp6`")
+	if c.Network != UDPv4 && c.Network != UDPv6 && c.Network != UDP {
+		return nil, errors.New("udp: Network must be either `udp4`, `udp6` or `udp`")
+	}
+
+	if c.Sockets < 0 {
+		return nil, errors.New("udp: Sockets must not be negative")
+	}
+	if c.Readers < 0 {
+		return nil, errors.New("udp: Readers must not be negative")
+	}
+	if c.QueueSize < 0 {
+		return nil, errors.New("udp: QueueSize must not be negative")
+	}
+	if c.Sockets > 1 && c.Group != "" {
+		return nil, errors.New("udp: Sockets is not supported in multicast mode")
+	}
+	if c.Sockets > 1 {
+		c.ReusePort = true
 	}
 
 	{ // parse and verify source address
@@ -80,27 +217,100 @@ func (c Config) Open() (transports.Transport, error) {
 		}
 	}
 
-	conn, err := net.ListenUDP(c.Network, addr)
+	conn, err := c.listen(addr)
 	if err != nil {
 		return nil, err
 	}
 
 	addr = conn.LocalAddr().(*net.UDPAddr)
 
+	if c.Network == UDP && !addr.IP.IsUnspecified() {
+		// only sockets bound to the wildcard address are dual-stack
+		c.Network = UDPv6
+		if ipIs4(addr.IP) {
+			c.Network = UDPv4
+		}
+	}
+
 	t := &transport{net: c.Network, laddr: wrapAddr(addr), c: conn}
-	return dgram.Wrap(t)
+
+	gso, gro := enableOffload(conn, c.GSO, c.GRO && c.Group == "" && c.Readers <= 1)
+	if gso {
+		t.gso = true
+		t.gsoBuf = make([]byte, 0, maxGSOSize)
+	}
+	if gro {
+		t.gro = newGROReader()
+	}
+
+	if c.NAT64 && t.net != UDPv4 && !hasIPv4Connectivity() {
+		t.nat64 = discoverNAT64(net.LookupIP)
+	}
+
+	if c.ICMPErrors {
+		t.icmp, err = newICMPErrors(conn, c.Network)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	var dt dgram.Transport = t
+
+	if c.Group != "" {
+		mt, err := openMulticast(c, t)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		dt = mt
+	}
+
+	if c.Sockets > 1 {
+		rt, err := openReusePort(c, t)
+		if err != nil {
+			dt.Close()
+			return nil, err
+		}
+		dt = rt
+	}
+
+	if c.MTUDiscovery {
+		mt, err := newMTUTransport(dt, conn, c.Network)
+		if err != nil {
+			dt.Close()
+			return nil, err
+		}
+		dt = mt
+	}
+
+	return dt, nil
 }
 
 func (t *transport) Close() error {
 	return t.c.Close()
 }
 
+// Files returns the socket of the transport (see package handover).
+func (t *transport) Files() ([]*os.File, error) {
+	f, err := t.c.File()
+	if err != nil {
+		return nil, err
+	}
+	return []*os.File{f}, nil
+}
+
 func (t *transport) NormalizeAddr(addr net.Addr) (dgram.Addr, error) {
 	if a, ok := addr.(*net.UDPAddr); ok {
 		return t.NormalizeAddr(wrapAddr(a))
-	} else if a, ok := addr.(*udpv4); ok && t.net == UDPv4 {
+	} else if a, ok := addr.(*udpv4); ok && t.nat64 != nil {
+		return t.nat64Addr(a), nil
+	} else if a, ok := addr.(*udpv4); ok && (t.net == UDPv4 || t.net == UDP) {
 		return a, nil
-	} else if a, ok := addr.(*udpv6); ok && t.net == UDPv6 {
+	} else if a, ok := addr.(*udpv6); ok && (t.net == UDPv6 || t.net == UDP) {
+		if a.IP.IsLinkLocalUnicast() && !a.hasLocalZone() {
+			return nil, transports.ErrInvalidAddr
+		}
 		return a, nil
 	} else {
 		return nil, transports.ErrInvalidAddr
@@ -108,15 +318,22 @@ func (t *transport) NormalizeAddr(addr net.Addr) (dgram.Addr, error) {
 }
 
 func (t *transport) Read(b []byte) (n int, addr dgram.Addr, err error) {
-	n, uaddr, err := t.c.ReadFromUDP(b)
-	if err != nil {
-		return 0, nil, err
-	}
-	return n, wrapAddr(uaddr), nil
+	return t.readFrom(t.c, t.gro, b)
 }
 
 func (t *transport) Write(b []byte, addr dgram.Addr) (n int, err error) {
-	return t.c.WriteToUDP(b, addr.(udpAddr).ToUDPAddr())
+	uaddr := addr.(udpAddr).ToUDPAddr()
+
+	n, err = t.c.WriteToUDP(b, uaddr)
+	if err != nil && t.icmp != nil && isQueuedError(err) {
+		t.icmp.drain()
+		if isUnreachable(err) {
+			// the error was caused by an earlier packet (possibly to an
+			// other destination)
+			n, err = t.c.WriteToUDP(b, uaddr)
+		}
+	}
+	return n, err
 }
 
 func (t *transport) Addrs() []net.Addr {
@@ -138,16 +355,28 @@ func (t *transport) Addrs() []net.Addr {
 		return addrs
 	}
 
+	if t.net != UDPv4 {
+		// IPv6-only LANs may not have any other addresses
+		if lls, err := transportsutil.LinkLocalIPv6s(); err == nil {
+			ips = append(ips, lls...)
+		}
+	}
+
 	for _, addr := range ips {
 		addr := wrapAddr(&net.UDPAddr{
 			IP:   addr.IP,
 			Zone: addr.Zone,
 			Port: int(port),
 		})
-		if addr.IsIPv6() && t.net == UDPv6 || !addr.IsIPv6() && t.net == UDPv4 {
+		if t.net == UDP || addr.IsIPv6() && t.net == UDPv6 || !addr.IsIPv6() && t.net == UDPv4 {
 			addrs = append(addrs, addr)
 		}
 	}
 
+	// global addresses first
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return addrScope(addrs[i].(udpAddr).GetIP()) < addrScope(addrs[j].(udpAddr).GetIP())
+	})
+
 	return addrs
 }
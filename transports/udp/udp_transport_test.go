@@ -2,10 +2,13 @@ package udp
 
 import (
 	"bytes"
+	"io"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+	"github.com/telehash/gogotelehash/transports"
 )
 
 func TestAddrs(t *testing.T) {
@@ -16,6 +19,8 @@ func TestAddrs(t *testing.T) {
 		{Network: "udp4", Addr: "127.0.0.1:8080"},
 		{Network: "udp4", Addr: ":0"},
 		{Network: "udp6", Addr: ":0"},
+		{Network: "udp", Addr: ":0"},
+		{Network: "udp", Addr: "127.0.0.1:0"},
 	}
 
 	for _, factory := range tab {
@@ -97,3 +102,408 @@ func Benchmark(b *testing.B) {
 		}
 	}
 }
+
+func TestMulticast(t *testing.T) {
+	assert := assert.New(t)
+
+	const group = "239.192.84.72:42424"
+
+	A, err := Config{Group: group}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := Config{Group: group}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	dst, err := net.ResolveUDPAddr("udp4", group)
+	if !assert.NoError(err) {
+		return
+	}
+
+	c1, err := A.Dial(dst)
+	if !assert.NoError(err) {
+		return
+	}
+
+	_, err = c1.Write([]byte("hello"))
+	if !assert.NoError(err) {
+		return
+	}
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if c, err := B.Accept(); err == nil {
+			accepted <- c
+		}
+	}()
+
+	var c2 net.Conn
+	select {
+	case c2 = <-accepted:
+	case <-time.After(2 * time.Second):
+		t.Skip("multicast is not available")
+	}
+
+	// the packet comes from the unicast address of A
+	assert.Equal(A.Addrs()[0].(udpAddr).GetPort(), c2.RemoteAddr().(udpAddr).GetPort())
+
+	buf := make([]byte, 1500)
+	n, err := c2.Read(buf)
+	assert.NoError(err)
+	assert.Equal("hello", string(buf[:n]))
+
+	_, err = c2.Write([]byte("world"))
+	assert.NoError(err)
+
+	// A doesn't receive its own packet; the reply arrives on a new connection
+	c3, err := A.Accept()
+	if assert.NoError(err) {
+		assert.Equal(B.Addrs()[0].(udpAddr).GetPort(), c3.RemoteAddr().(udpAddr).GetPort())
+
+		n, err = c3.Read(buf)
+		assert.NoError(err)
+		assert.Equal("world", string(buf[:n]))
+	}
+}
+
+func TestMulticastInvalidGroup(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := Config{Group: "192.0.2.1:42424"}.Open()
+	assert.Error(err)
+
+	_, err = Config{Network: UDPv6, Group: "239.192.84.72:42424"}.Open()
+	assert.Error(err)
+}
+
+func TestDualStack(t *testing.T) {
+	assert := assert.New(t)
+
+	B, err := Config{Network: UDP}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	var v4, v6 net.Addr
+	for _, addr := range B.Addrs() {
+		if addr.(udpAddr).IsIPv6() {
+			v6 = addr
+		} else {
+			v4 = addr
+		}
+	}
+	if v4 == nil || v6 == nil {
+		t.Skipf("host is not dual-stack (addrs=%v)", B.Addrs())
+	}
+
+	for _, tc := range []struct {
+		network string
+		dst     net.Addr
+	}{
+		{UDPv4, v4},
+		{UDPv6, v6},
+	} {
+		A, err := Config{Network: tc.network}.Open()
+		if !assert.NoError(err) {
+			return
+		}
+
+		c1, err := A.Dial(tc.dst)
+		if assert.NoError(err) {
+			_, err = c1.Write([]byte("hello"))
+			assert.NoError(err)
+
+			c2, err := B.Accept()
+			if assert.NoError(err) {
+				assert.Equal(tc.network, c2.RemoteAddr().Network())
+
+				buf := make([]byte, 1500)
+				n, err := c2.Read(buf)
+				assert.NoError(err)
+				assert.Equal("hello", string(buf[:n]))
+
+				_, err = c2.Write([]byte("world"))
+				assert.NoError(err)
+
+				n, err = c1.Read(buf)
+				assert.NoError(err)
+				assert.Equal("world", string(buf[:n]))
+			}
+		}
+
+		A.Close()
+	}
+}
+
+func TestOffload(t *testing.T) {
+	assert := assert.New(t)
+
+	B, err := Config{Addr: "127.0.0.1:0", GRO: true}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	var pkts [][]byte
+	for i := 0; i < 70; i++ {
+		pkts = append(pkts, bytes.Repeat([]byte{byte(i)}, 1000))
+	}
+	pkts = append(pkts, bytes.Repeat([]byte{0xff}, 300), []byte("end"))
+
+	for _, gso := range []bool{true, false} {
+		inner, err := Config{Addr: "127.0.0.1:0", GSO: gso}.open()
+		if !assert.NoError(err) {
+			return
+		}
+		A := inner.(*transport)
+		t.Logf("gso=%v enabled=%v", gso, A.gso)
+
+		dst, err := A.NormalizeAddr(B.Addrs()[0])
+		if !assert.NoError(err) {
+			return
+		}
+
+		n, err := A.WriteBatch(pkts, dst)
+		assert.NoError(err)
+		assert.Equal(len(pkts), n)
+
+		c, err := B.Accept()
+		if !assert.NoError(err) {
+			return
+		}
+
+		buf := make([]byte, 1500)
+		for i, pkt := range pkts {
+			n, err := c.Read(buf)
+			if !assert.NoError(err) || !assert.Equal(pkt, buf[:n], "packet %d", i) {
+				break
+			}
+		}
+
+		A.Close()
+	}
+}
+
+func TestWriteMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := Config{Addr: "127.0.0.1:0", GSO: true}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := Config{Addr: "127.0.0.1:0"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	C, err := Config{Addr: "127.0.0.1:0"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer C.Close()
+
+	var (
+		b    = B.Addrs()[0]
+		c    = C.Addrs()[0]
+		big  = bytes.Repeat([]byte{'x'}, 1000)
+		msgs = []transports.Message{
+			{Data: big, Addr: b},
+			{Data: big, Addr: b},
+			{Data: []byte("b"), Addr: b},
+			{Data: []byte("c"), Addr: c},
+			{Data: big, Addr: b},
+		}
+	)
+
+	n, err := A.(transports.BatchWriter).WriteMessages(msgs)
+	assert.NoError(err)
+	assert.Equal(len(msgs), n)
+
+	for _, x := range []struct {
+		T    transports.Transport
+		Addr net.Addr
+	}{{B, b}, {C, c}} {
+		conn, err := x.T.Accept()
+		if !assert.NoError(err) {
+			return
+		}
+
+		buf := make([]byte, 1500)
+		for _, msg := range msgs {
+			if msg.Addr != x.Addr {
+				continue
+			}
+			n, err := conn.Read(buf)
+			if assert.NoError(err) {
+				assert.Equal(msg.Data, buf[:n])
+			}
+		}
+	}
+
+	// packets larger than the MTU are not sent
+	n, err = A.(transports.BatchWriter).WriteMessages([]transports.Message{
+		{Data: []byte("b"), Addr: b},
+		{Data: make([]byte, transports.DefaultMTU+1), Addr: b},
+	})
+	assert.Equal(io.ErrShortWrite, err)
+	assert.Equal(1, n)
+}
+
+func TestAddrURL(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, s := range []string{
+		"udp4://1.2.3.4:42424",
+		"udp6://[2001:db8::1]:42424",
+		"udp6://[fe80::1%lo]:42424",
+	} {
+		a, err := transports.ParseAddr(s)
+		if assert.NoError(err, s) {
+			assert.Equal(s, transports.FormatAddr(a))
+		}
+	}
+
+	a, err := transports.ParseAddr("udp4://1.2.3.4:42424")
+	if assert.NoError(err) {
+		b, err := transports.ResolveAddr("udp4", "1.2.3.4:42424")
+		assert.NoError(err)
+		assert.True(transports.EqualAddr(a, b))
+	}
+
+	_, err = transports.ParseAddr("1.2.3.4:42424")
+	assert.Equal(transports.ErrInvalidAddr, err)
+
+	_, err = transports.ParseAddr("udp5://1.2.3.4:42424")
+	assert.Error(err)
+}
+
+func TestAddrZone(t *testing.T) {
+	assert := assert.New(t)
+
+	a, err := transports.ResolveAddr("udp6", "[fe80::1%lo]:4242")
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal("[fe80::1%lo]:4242", a.String())
+
+	data, err := transports.EncodeAddr(a)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(`{"type":"udp6","ip":"fe80::1","port":4242,"zone":"lo"}`, string(data))
+
+	b, err := transports.DecodeAddr(data)
+	if assert.NoError(err) {
+		assert.True(transports.EqualAddr(a, b))
+		assert.Equal(a.(*udpv6).Key(), b.(*udpv6).Key())
+	}
+
+	// the zone may be part of the ip
+	b, err = transports.DecodeAddr([]byte(`{"type":"udp6","ip":"fe80::1%lo","port":4242}`))
+	if assert.NoError(err) {
+		assert.True(transports.EqualAddr(a, b))
+	}
+
+	// the same ip on an other link is an other address
+	c, err := transports.DecodeAddr([]byte(`{"type":"udp6","ip":"fe80::1","port":4242,"zone":"eth7"}`))
+	if assert.NoError(err) {
+		assert.False(transports.EqualAddr(a, c))
+		assert.NotEqual(a.(*udpv6).Key(), c.(*udpv6).Key())
+	}
+
+	// global addresses don't carry a zone
+	data, err = transports.EncodeAddr(wrapAddr(&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 4242}))
+	if assert.NoError(err) {
+		assert.Equal(`{"type":"udp6","ip":"2001:db8::1","port":4242}`, string(data))
+	}
+
+	tr, err := Config{Network: UDPv6, Addr: "[::1]:0"}.open()
+	if err != nil {
+		t.Skip("IPv6 is not available")
+	}
+	defer tr.Close()
+
+	// link-local addresses need a local zone
+	_, err = tr.NormalizeAddr(c)
+	assert.Equal(transports.ErrInvalidAddr, err)
+	_, err = tr.NormalizeAddr(wrapAddr(&net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 4242}))
+	assert.Equal(transports.ErrInvalidAddr, err)
+	_, err = tr.NormalizeAddr(a)
+	assert.NoError(err)
+}
+
+func TestAddrsOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	tr, err := Config{Network: UDP}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer tr.Close()
+
+	addrs := tr.Addrs()
+	for i := 1; i < len(addrs); i++ {
+		assert.True(addrScope(addrs[i-1].(udpAddr).GetIP()) <= addrScope(addrs[i].(udpAddr).GetIP()), "%v", addrs)
+	}
+	t.Logf("addrs=%v", addrs)
+}
+
+func TestQueueSize(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, policy := range []transports.DropPolicy{transports.DropNewest, transports.DropOldest} {
+		A, err := Config{Addr: "127.0.0.1:0"}.Open()
+		if !assert.NoError(err) {
+			return
+		}
+		defer A.Close()
+
+		B, err := Config{Addr: "127.0.0.1:0", QueueSize: 4, DropPolicy: policy}.Open()
+		if !assert.NoError(err) {
+			return
+		}
+		defer B.Close()
+
+		w, err := A.Dial(B.Addrs()[0])
+		if !assert.NoError(err) {
+			return
+		}
+
+		for i := 0; i < 10; i++ {
+			_, err = w.Write([]byte{byte(i)})
+			assert.NoError(err)
+		}
+
+		r, err := B.Accept()
+		if !assert.NoError(err) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		first := byte(0)
+		if policy == transports.DropOldest {
+			first = 6
+		}
+
+		var buf [16]byte
+		for i := 0; i < 4; i++ {
+			n, err := r.Read(buf[:])
+			if assert.NoError(err) && assert.Equal(1, n) {
+				assert.Equal(first+byte(i), buf[0], "policy=%v", policy)
+			}
+		}
+
+		r.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		_, err = r.Read(buf[:])
+		assert.Error(err)
+	}
+}
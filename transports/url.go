@@ -0,0 +1,37 @@
+package transports
+
+import (
+	"net"
+	"strings"
+)
+
+// URLAddr is implemented by addresses whose URL form is not
+// "<network>://<String()>". ParseAddr must accept the returned URL.
+type URLAddr interface {
+	net.Addr
+
+	// URL returns the address in URL form.
+	URL() string
+}
+
+// ParseAddr parses an address in URL form ("udp4://1.2.3.4:42424"). The part
+// after the scheme is resolved with the resolver that was registered for the
+// scheme (see RegisterResolver). ErrInvalidAddr is returned when s is not in
+// URL form.
+func ParseAddr(s string) (net.Addr, error) {
+	idx := strings.Index(s, "://")
+	if idx <= 0 {
+		return nil, ErrInvalidAddr
+	}
+
+	return ResolveAddr(s[:idx], s[idx+3:])
+}
+
+// FormatAddr returns the URL form of addr. ParseAddr reverses FormatAddr for
+// all registered address types.
+func FormatAddr(addr net.Addr) string {
+	if u, ok := addr.(URLAddr); ok {
+		return u.URL()
+	}
+	return addr.Network() + "://" + addr.String()
+}
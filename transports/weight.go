@@ -0,0 +1,24 @@
+package transports
+
+import (
+	"net"
+)
+
+// WeightedConn is implemented by connections that carry a path weight. When
+// multiple paths to a peer are reachable, paths with a higher weight are
+// preferred; latency decides between paths of equal weight.
+type WeightedConn interface {
+	net.Conn
+
+	// Weight returns the weight of the path.
+	Weight() int
+}
+
+// ConnWeight returns the weight of conn. Connections that don't implement
+// WeightedConn have weight 0.
+func ConnWeight(conn net.Conn) int {
+	if w, ok := conn.(WeightedConn); ok {
+		return w.Weight()
+	}
+	return 0
+}
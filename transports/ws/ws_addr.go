@@ -0,0 +1,96 @@
+package ws
+
+import (
+	"encoding/json"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/telehash/gogotelehash/transports"
+)
+
+func init() {
+	transports.RegisterAddr(&addr{})
+
+	transports.RegisterResolver("ws", func(str string) (net.Addr, error) {
+		if !strings.Contains(str, "://") {
+			// from transports.ParseAddr
+			str = "ws://" + str
+		}
+		return parseAddr(str)
+	})
+
+	transports.RegisterResolver("wss", func(str string) (net.Addr, error) {
+		return parseAddr("wss://" + str)
+	})
+}
+
+// addr is the URL of a WebSocket endpoint (ws:// or wss://).
+type addr struct {
+	url *url.URL
+}
+
+func parseAddr(str string) (*addr, error) {
+	u, err := url.Parse(str)
+	if err != nil {
+		return nil, transports.ErrInvalidAddr
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" || u.Host == "" {
+		return nil, transports.ErrInvalidAddr
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return &addr{url: u}, nil
+}
+
+func (a *addr) Network() string { return "ws" }
+func (a *addr) String() string  { return a.url.String() }
+func (a *addr) URL() string     { return a.url.String() }
+
+func (a *addr) Equal(other net.Addr) bool {
+	b, ok := other.(*addr)
+	return ok && a.String() == b.String()
+}
+
+// hostPort returns the host and port to dial.
+func (a *addr) hostPort() string {
+	if a.url.Port() != "" {
+		return a.url.Host
+	}
+	if a.url.Scheme == "wss" {
+		return net.JoinHostPort(a.url.Hostname(), "443")
+	}
+	return net.JoinHostPort(a.url.Hostname(), "80")
+}
+
+func (a *addr) MarshalJSON() ([]byte, error) {
+	var desc = struct {
+		Type string `json:"type"`
+		URL  string `json:"url"`
+	}{
+		Type: a.Network(),
+		URL:  a.String(),
+	}
+
+	return json.Marshal(&desc)
+}
+
+func (a *addr) UnmarshalJSON(data []byte) error {
+	var desc struct {
+		URL string `json:"url"`
+	}
+
+	err := json.Unmarshal(data, &desc)
+	if err != nil {
+		return transports.ErrInvalidAddr
+	}
+
+	x, err := parseAddr(desc.URL)
+	if err != nil {
+		return err
+	}
+
+	*a = *x
+	return nil
+}
@@ -0,0 +1,411 @@
+package ws
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The WebSocket protocol (RFC 6455). Only what is needed to exchange binary
+// messages is implemented; extensions and subprotocols are not negotiated.
+
+var (
+	errProtocol  = errors.New("ws: protocol error")
+	errHandshake = errors.New("ws: handshake failed")
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+
+	// maxPacketSize is the largest message that is written.
+	maxPacketSize = 1472
+
+	// maxFrameSize is the largest frame that is read (and discarded when it
+	// doesn't fit). Larger frames close the connection.
+	maxFrameSize = 1 << 16
+
+	acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+type connection struct {
+	conn   net.Conn
+	bufr   *bufio.Reader
+	laddr  net.Addr
+	raddr  net.Addr
+	client bool // client frames are masked
+
+	mtxWrite sync.Mutex
+	mtxRead  sync.Mutex
+	closed   bool // a close frame was sent; guarded by mtxWrite
+}
+
+func newConnection(conn net.Conn, bufr *bufio.Reader, laddr, raddr net.Addr, client bool) *connection {
+	return &connection{conn: conn, bufr: bufr, laddr: laddr, raddr: raddr, client: client}
+}
+
+// Read reads the next binary message. Text messages are skipped and control
+// frames are handled. io.EOF is returned after the peer closed the
+// connection.
+func (c *connection) Read(b []byte) (n int, err error) {
+	c.mtxRead.Lock()
+	defer c.mtxRead.Unlock()
+
+	var (
+		inMessage bool
+		text      bool
+		skip      bool
+	)
+
+	for {
+		fin, op, payloadLen, mask, err := c.readHeader()
+		if err != nil {
+			return 0, err
+		}
+
+		switch op {
+		case opClose, opPing, opPong:
+			err = c.readControl(op, payloadLen, mask)
+			if err != nil {
+				return 0, err
+			}
+			continue
+
+		case opBinary, opText:
+			if inMessage {
+				return 0, c.fail()
+			}
+			inMessage, text, skip, n = true, op == opText, op == opText, 0
+
+		case opContinuation:
+			if !inMessage {
+				return 0, c.fail()
+			}
+
+		default:
+			return 0, c.fail()
+		}
+
+		if skip || n+payloadLen > len(b) {
+			skip = true
+			_, err = io.CopyN(ioutil.Discard, c.bufr, int64(payloadLen))
+		} else {
+			_, err = io.ReadFull(c.bufr, b[n:n+payloadLen])
+			maskBytes(b[n:n+payloadLen], mask)
+			n += payloadLen
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if !fin {
+			continue
+		}
+
+		if !skip {
+			return n, nil
+		}
+		if !text {
+			// the packet didn't fit in b; the stream stays in sync
+			return 0, io.ErrShortBuffer
+		}
+		inMessage, text, skip = false, false, false
+	}
+}
+
+func (c *connection) readHeader() (fin bool, op byte, payloadLen int, mask []byte, err error) {
+	var hdr [14]byte
+
+	_, err = io.ReadFull(c.bufr, hdr[:2])
+	if err != nil {
+		return
+	}
+
+	fin = hdr[0]&0x80 != 0
+	op = hdr[0] & 0x0F
+	masked := hdr[1]&0x80 != 0
+	length := uint64(hdr[1] & 0x7F)
+
+	if hdr[0]&0x70 != 0 || masked == c.client {
+		// no extensions were negotiated and only clients mask their frames
+		err = c.fail()
+		return
+	}
+
+	switch length {
+	case 126:
+		_, err = io.ReadFull(c.bufr, hdr[2:4])
+		length = uint64(binary.BigEndian.Uint16(hdr[2:4]))
+	case 127:
+		_, err = io.ReadFull(c.bufr, hdr[2:10])
+		length = binary.BigEndian.Uint64(hdr[2:10])
+	}
+	if err != nil {
+		return
+	}
+	if length > maxFrameSize {
+		err = c.fail()
+		return
+	}
+
+	if masked {
+		mask = hdr[10:14]
+		_, err = io.ReadFull(c.bufr, mask)
+		if err != nil {
+			return
+		}
+	}
+
+	payloadLen = int(length)
+	return
+}
+
+func (c *connection) readControl(op byte, payloadLen int, mask []byte) error {
+	var payload [125]byte
+
+	if payloadLen > len(payload) {
+		return c.fail()
+	}
+
+	_, err := io.ReadFull(c.bufr, payload[:payloadLen])
+	if err != nil {
+		return err
+	}
+	maskBytes(payload[:payloadLen], mask)
+
+	switch op {
+	case opPing:
+		c.writeFrame(opPong, payload[:payloadLen])
+		return nil
+	case opClose:
+		// echo the status code
+		if payloadLen > 2 {
+			payloadLen = 2
+		}
+		c.writeFrame(opClose, payload[:payloadLen])
+		c.conn.Close()
+		return io.EOF
+	default:
+		return nil
+	}
+}
+
+// fail closes the connection after a protocol error.
+func (c *connection) fail() error {
+	c.writeFrame(opClose, []byte{0x03, 0xEA}) // 1002 protocol error
+	c.conn.Close()
+	return errProtocol
+}
+
+func (c *connection) Write(b []byte) (n int, err error) {
+	if len(b) > maxPacketSize {
+		return 0, io.ErrShortWrite
+	}
+
+	err = c.writeFrame(opBinary, b)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+func (c *connection) writeFrame(op byte, payload []byte) error {
+	var (
+		buf [14 + maxPacketSize]byte
+		hdr = 2
+	)
+
+	buf[0] = 0x80 | op
+	if len(payload) < 126 {
+		buf[1] = byte(len(payload))
+	} else {
+		buf[1] = 126
+		binary.BigEndian.PutUint16(buf[2:4], uint16(len(payload)))
+		hdr = 4
+	}
+
+	if c.client {
+		buf[1] |= 0x80
+		_, err := io.ReadFull(rand.Reader, buf[hdr:hdr+4])
+		if err != nil {
+			return err
+		}
+		mask := buf[hdr : hdr+4]
+		hdr += 4
+
+		copy(buf[hdr:], payload)
+		maskBytes(buf[hdr:hdr+len(payload)], mask)
+	} else {
+		copy(buf[hdr:], payload)
+	}
+
+	c.mtxWrite.Lock()
+	defer c.mtxWrite.Unlock()
+
+	if c.closed {
+		return io.EOF
+	}
+	if op == opClose {
+		c.closed = true
+	}
+
+	_, err := c.conn.Write(buf[:hdr+len(payload)])
+	return err
+}
+
+func maskBytes(b, mask []byte) {
+	if mask == nil {
+		return
+	}
+	for i := range b {
+		b[i] ^= mask[i&3]
+	}
+}
+
+func (c *connection) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+func (c *connection) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *connection) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+func (c *connection) LocalAddr() net.Addr {
+	return c.laddr
+}
+
+func (c *connection) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+// Close sends a close frame (1000 normal closure) and closes the connection.
+func (c *connection) Close() error {
+	c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	c.writeFrame(opClose, []byte{0x03, 0xE8})
+	return c.conn.Close()
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key))
+	h.Write([]byte(acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// clientHandshake performs the opening handshake on conn for the URL of a.
+func clientHandshake(conn net.Conn, a *addr) (*bufio.Reader, error) {
+	var nonce [16]byte
+	_, err := io.ReadFull(rand.Reader, nonce[:])
+	if err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+
+	u := *a.url
+	u.Scheme = "http"
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	err = req.Write(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	bufr := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(bufr, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		!strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") ||
+		resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		return nil, errHandshake
+	}
+
+	return bufr, nil
+}
+
+// serverHandshake upgrades an HTTP request to a WebSocket connection.
+func serverHandshake(w http.ResponseWriter, req *http.Request) (net.Conn, *bufio.Reader, error) {
+	if req.Method != "GET" ||
+		!headerContains(req.Header, "Upgrade", "websocket") ||
+		!headerContains(req.Header, "Connection", "upgrade") {
+		http.Error(w, "expected a WebSocket handshake", http.StatusBadRequest)
+		return nil, nil, errHandshake
+	}
+
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, nil, errHandshake
+	}
+
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, nil, errHandshake
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "cannot upgrade connection", http.StatusInternalServerError)
+		return nil, nil, errHandshake
+	}
+
+	conn, bufrw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bufrw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	bufrw.WriteString("Upgrade: websocket\r\n")
+	bufrw.WriteString("Connection: Upgrade\r\n")
+	bufrw.WriteString("Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n")
+	err = bufrw.Flush()
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	return conn, bufrw.Reader, nil
+}
+
+// headerContains reports whether the comma separated header key contains
+// token (case insensitive).
+func headerContains(h http.Header, key, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(key)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,385 @@
+// Package ws implements the WebSocket transport.
+//
+// Packets are sent as binary WebSocket messages (one packet per message). The
+// transport lets Go endpoints exchange packets with telehash implementations
+// running in a browser and reach peers through HTTP-only proxies.
+//
+// A transport with a listen address serves WebSocket connections (ws://, or
+// wss:// when a TLS config is set):
+//
+//	e3x.Open(e3x.Transport(ws.Config{
+//	  Addr: ":443",
+//	  TLS:  &tls.Config{Certificates: certs},
+//	  URLs: []string{"wss://example.com/telehash"},
+//	}))
+//
+// A transport without a listen address only dials. Dialing goes through the
+// proxy returned by Config.Proxy (for example http.ProxyFromEnvironment).
+package ws
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/telehash/gogotelehash/transports"
+	"github.com/telehash/gogotelehash/transports/transportsutil"
+)
+
+// DefaultPath is the path of the WebSocket endpoint when Config.Path is not
+// set.
+const DefaultPath = "/telehash"
+
+// handshakeTimeout limits the opening handshake (including TLS).
+const handshakeTimeout = 10 * time.Second
+
+// Config for the WebSocket transport.
+type Config struct {
+	// Addr is the TCP address to listen on (":8080"). When Addr is empty the
+	// transport only dials.
+	Addr string
+
+	// Path of the WebSocket endpoint. Defaults to DefaultPath.
+	Path string
+
+	// TLS enables wss:// on the listener (it must have a certificate). It is
+	// also used to dial wss:// addresses; a nil TLS config dials with the
+	// default settings.
+	TLS *tls.Config
+
+	// URLs are the public URLs of the endpoint (for example when the
+	// transport is behind a reverse proxy). When URLs is empty the listen
+	// address is advertised.
+	URLs []string
+
+	// Proxy returns the HTTP proxy to use to dial a URL (the URL has the http
+	// or https scheme). Connections are tunneled through the proxy with
+	// CONNECT. When Proxy is nil or returns nil the URL is dialed directly.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// Dial opens the TCP connections to the host (or the HTTP proxy) of the
+	// dialed URLs (for example socks5.Dialer.Dial to go through Tor). When
+	// Dial is nil net.Dial is used.
+	Dial func(network, addr string) (net.Conn, error)
+}
+
+type transport struct {
+	path     string
+	tls      *tls.Config
+	urls     []*addr
+	proxy    func(*http.Request) (*url.URL, error)
+	dial     func(network, addr string) (net.Conn, error)
+	listener net.Listener
+	server   *http.Server
+
+	accepted chan net.Conn
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	mtx    sync.Mutex
+	closed bool
+}
+
+var (
+	_ transports.Transport = (*transport)(nil)
+	_ transports.Config    = Config{}
+)
+
+// Open opens the transport.
+func (c Config) Open() (transports.Transport, error) {
+	if c.Path == "" {
+		c.Path = DefaultPath
+	}
+	if c.Path[0] != '/' {
+		return nil, errors.New("ws: Path must start with a /")
+	}
+
+	t := &transport{
+		path:     c.Path,
+		tls:      c.TLS,
+		proxy:    c.Proxy,
+		dial:     c.Dial,
+		accepted: make(chan net.Conn),
+		done:     make(chan struct{}),
+	}
+
+	for _, s := range c.URLs {
+		a, err := parseAddr(s)
+		if err != nil {
+			return nil, err
+		}
+		t.urls = append(t.urls, a)
+	}
+
+	if c.Addr != "" {
+		listener, err := net.Listen("tcp", c.Addr)
+		if err != nil {
+			return nil, err
+		}
+		if c.TLS != nil {
+			listener = tls.NewListener(listener, c.TLS)
+		}
+
+		t.listener = listener
+		t.server = &http.Server{Handler: t, ReadHeaderTimeout: handshakeTimeout}
+
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			t.server.Serve(listener)
+		}()
+	}
+
+	return t, nil
+}
+
+func (t *transport) Addrs() []net.Addr {
+	var addrs []net.Addr
+
+	if len(t.urls) > 0 {
+		for _, a := range t.urls {
+			addrs = append(addrs, a)
+		}
+		return addrs
+	}
+
+	if t.listener == nil {
+		return nil
+	}
+
+	scheme := "ws"
+	if t.tls != nil {
+		scheme = "wss"
+	}
+
+	laddr := t.listener.Addr().(*net.TCPAddr)
+	port := strconv.Itoa(laddr.Port)
+
+	ips := []*net.IPAddr{{IP: laddr.IP}}
+	if laddr.IP.IsUnspecified() {
+		var err error
+		ips, err = transportsutil.InterfaceIPs()
+		if err != nil {
+			return nil
+		}
+	}
+
+	for _, ip := range ips {
+		if ip.Zone != "" {
+			continue
+		}
+		u := &url.URL{Scheme: scheme, Host: net.JoinHostPort(ip.IP.String(), port), Path: t.path}
+		addrs = append(addrs, &addr{url: u})
+	}
+
+	return addrs
+}
+
+func (t *transport) Dial(a net.Addr) (net.Conn, error) {
+	x, ok := a.(*addr)
+	if !ok {
+		return nil, transports.ErrInvalidAddr
+	}
+
+	t.mtx.Lock()
+	closed := t.closed
+	t.mtx.Unlock()
+	if closed {
+		return nil, io.EOF
+	}
+
+	conn, err := t.dialTCP(x)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	if x.url.Scheme == "wss" {
+		config := t.tls
+		if config == nil {
+			config = &tls.Config{}
+		}
+		if config.ServerName == "" {
+			config = config.Clone()
+			config.ServerName = x.url.Hostname()
+		}
+
+		tlsConn := tls.Client(conn, config)
+		err = tlsConn.Handshake()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	bufr, err := clientHandshake(conn, x)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	return newConnection(conn, bufr, t.localAddr(conn), x, true), nil
+}
+
+// dialTCP opens a TCP connection to the host of a, tunneled through the proxy
+// when there is one.
+func (t *transport) dialTCP(a *addr) (net.Conn, error) {
+	var proxy *url.URL
+
+	if t.proxy != nil {
+		u := *a.url
+		u.Scheme = "http"
+		if a.url.Scheme == "wss" {
+			u.Scheme = "https"
+		}
+
+		var err error
+		proxy, err = t.proxy(&http.Request{Method: "GET", URL: &u, Header: make(http.Header)})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if proxy == nil {
+		return t.dialHost(a.hostPort())
+	}
+
+	proxyHost := proxy.Host
+	if proxy.Port() == "" {
+		proxyHost = net.JoinHostPort(proxy.Hostname(), "80")
+	}
+
+	conn, err := t.dialHost(proxyHost)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: a.hostPort()},
+		Host:   a.hostPort(),
+		Header: make(http.Header),
+	}
+	if user := proxy.User; user != nil {
+		password, _ := user.Password()
+		req.SetBasicAuth(user.Username(), password)
+		req.Header.Set("Proxy-Authorization", req.Header.Get("Authorization"))
+		req.Header.Del("Authorization")
+	}
+
+	err = req.Write(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	bufr := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(bufr, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, errors.New("ws: proxy refused CONNECT: " + resp.Status)
+	}
+
+	conn.SetDeadline(time.Time{})
+	return &bufferedConn{Conn: conn, bufr: bufr}, nil
+}
+
+func (t *transport) dialHost(hostPort string) (net.Conn, error) {
+	if t.dial != nil {
+		return t.dial("tcp", hostPort)
+	}
+	return net.DialTimeout("tcp", hostPort, handshakeTimeout)
+}
+
+// bufferedConn reads the bytes that were buffered while reading the response
+// of the proxy before reading from the connection.
+type bufferedConn struct {
+	net.Conn
+	bufr *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.bufr.Read(b)
+}
+
+func (t *transport) localAddr(conn net.Conn) net.Addr {
+	if len(t.urls) > 0 {
+		return t.urls[0]
+	}
+
+	scheme := "ws"
+	if t.tls != nil {
+		scheme = "wss"
+	}
+	return &addr{url: &url.URL{Scheme: scheme, Host: conn.LocalAddr().String(), Path: t.path}}
+}
+
+// ServeHTTP upgrades WebSocket requests for the path of the transport.
+func (t *transport) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != t.path {
+		http.NotFound(w, req)
+		return
+	}
+
+	conn, bufr, err := serverHandshake(w, req)
+	if err != nil {
+		return
+	}
+
+	// remote endpoints are not reachable at their client address; the
+	// address only identifies the connection.
+	raddr := &addr{url: &url.URL{Scheme: "ws", Host: conn.RemoteAddr().String(), Path: "/"}}
+	c := newConnection(conn, bufr, t.localAddr(conn), raddr, false)
+
+	select {
+	case t.accepted <- c:
+	case <-t.done:
+		c.Close()
+	}
+}
+
+func (t *transport) Accept() (net.Conn, error) {
+	select {
+	case conn := <-t.accepted:
+		return conn, nil
+	case <-t.done:
+		return nil, io.EOF
+	}
+}
+
+func (t *transport) Close() error {
+	t.mtx.Lock()
+	if t.closed {
+		t.mtx.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.done)
+	t.mtx.Unlock()
+
+	var err error
+	if t.server != nil {
+		err = t.server.Close()
+	}
+	t.wg.Wait()
+	return err
+}
@@ -0,0 +1,324 @@
+package ws
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/telehash/gogotelehash/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+	"github.com/telehash/gogotelehash/transports"
+)
+
+func TestDialAccept(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := Config{}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+	assert.Empty(A.Addrs())
+
+	B, err := Config{Addr: "127.0.0.1:0"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	testRoundTrip(t, A, B)
+}
+
+func TestDialAcceptTLS(t *testing.T) {
+	assert := assert.New(t)
+	config := testTLSConfig(t)
+
+	A, err := Config{TLS: config}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := Config{
+		Addr: "127.0.0.1:0",
+		TLS:  config,
+	}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	// the certificate is issued for localhost
+	port := B.Addrs()[0].(*addr).url.Port()
+	dst, err := parseAddr("wss://localhost:" + port + DefaultPath)
+	if !assert.NoError(err) {
+		return
+	}
+
+	c1, err := A.Dial(dst)
+	if !assert.NoError(err) {
+		return
+	}
+	defer c1.Close()
+
+	_, err = c1.Write([]byte("hello"))
+	assert.NoError(err)
+
+	c2, err := B.Accept()
+	if !assert.NoError(err) {
+		return
+	}
+	defer c2.Close()
+
+	buf := make([]byte, 1500)
+	n, err := c2.Read(buf)
+	assert.NoError(err)
+	assert.Equal("hello", string(buf[:n]))
+}
+
+func TestDialProxy(t *testing.T) {
+	assert := assert.New(t)
+
+	proxy, connects := startProxy(t)
+	defer proxy.Close()
+
+	A, err := Config{Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: proxy.Addr().String()})}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := Config{Addr: "127.0.0.1:0"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	testRoundTrip(t, A, B)
+
+	select {
+	case host := <-connects:
+		assert.Equal(B.Addrs()[0].(*addr).url.Host, host)
+	default:
+		t.Error("expected a CONNECT request")
+	}
+}
+
+func TestReadShortBuffer(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := Config{}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	B, err := Config{Addr: "127.0.0.1:0"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer B.Close()
+
+	c1, err := A.Dial(B.Addrs()[0])
+	if !assert.NoError(err) {
+		return
+	}
+	defer c1.Close()
+
+	_, err = c1.Write(make([]byte, 1000))
+	assert.NoError(err)
+	_, err = c1.Write([]byte("hello"))
+	assert.NoError(err)
+
+	c2, err := B.Accept()
+	if !assert.NoError(err) {
+		return
+	}
+	defer c2.Close()
+
+	buf := make([]byte, 100)
+	_, err = c2.Read(buf)
+	assert.Equal(io.ErrShortBuffer, err)
+
+	n, err := c2.Read(buf)
+	assert.NoError(err)
+	assert.Equal("hello", string(buf[:n]))
+
+	// the peer closing the connection ends the stream
+	c1.Close()
+	_, err = c2.Read(buf)
+	assert.Equal(io.EOF, err)
+}
+
+func TestAddrJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := Config{URLs: []string{"wss://example.com/telehash"}}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+	defer A.Close()
+
+	a := A.Addrs()[0]
+	assert.Equal("wss://example.com/telehash", a.String())
+
+	data, err := transports.EncodeAddr(a)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Equal(`{"type":"ws","url":"wss://example.com/telehash"}`, string(data))
+
+	b, err := transports.DecodeAddr(data)
+	if assert.NoError(err) {
+		assert.True(transports.EqualAddr(a, b))
+	}
+
+	_, err = transports.DecodeAddr([]byte(`{"type":"ws","url":"http://example.com/"}`))
+	assert.Error(err)
+}
+
+func TestAddrURL(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, s := range []string{
+		"ws://example.com/",
+		"wss://example.com:8443/telehash",
+	} {
+		a, err := transports.ParseAddr(s)
+		if assert.NoError(err, s) {
+			assert.Equal(s, transports.FormatAddr(a))
+			assert.Equal("ws", a.Network())
+		}
+	}
+
+	// the path defaults to /
+	a, err := transports.ParseAddr("wss://example.com")
+	if assert.NoError(err) {
+		assert.Equal("wss://example.com/", transports.FormatAddr(a))
+	}
+}
+
+func TestAcceptAfterClose(t *testing.T) {
+	assert := assert.New(t)
+
+	A, err := Config{Addr: "127.0.0.1:0"}.Open()
+	if !assert.NoError(err) {
+		return
+	}
+
+	assert.NoError(A.Close())
+
+	_, err = A.Accept()
+	assert.Equal(io.EOF, err)
+}
+
+func testRoundTrip(t *testing.T, A, B transports.Transport) {
+	assert := assert.New(t)
+
+	c1, err := A.Dial(B.Addrs()[0])
+	if !assert.NoError(err) {
+		return
+	}
+	defer c1.Close()
+
+	_, err = c1.Write([]byte("hello"))
+	assert.NoError(err)
+
+	c2, err := B.Accept()
+	if !assert.NoError(err) {
+		return
+	}
+	defer c2.Close()
+
+	buf := make([]byte, 1500)
+	n, err := c2.Read(buf)
+	assert.NoError(err)
+	assert.Equal("hello", string(buf[:n]))
+
+	_, err = c2.Write(make([]byte, 1472))
+	assert.NoError(err)
+
+	n, err = c1.Read(buf)
+	assert.NoError(err)
+	assert.Equal(1472, n)
+}
+
+// startProxy starts an HTTP proxy that only supports CONNECT. The target of
+// each CONNECT request is sent on the returned channel.
+func startProxy(t *testing.T) (net.Listener, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connects := make(chan string, 10)
+
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "CONNECT" {
+			http.Error(w, "only CONNECT", http.StatusMethodNotAllowed)
+			return
+		}
+
+		upstream, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		connects <- req.Host
+
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+
+		go func() { io.Copy(upstream, conn); upstream.Close() }()
+		go func() { io.Copy(conn, upstream); conn.Close() }()
+	}))
+
+	return l, connects
+}
+
+func testTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		RootCAs:      pool,
+	}
+}